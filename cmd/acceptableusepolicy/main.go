@@ -1,13 +1,33 @@
 package main
 
 import (
+	"flag"
+	"log"
+	"os"
+
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 	"edgenet/pkg/controller/v1alpha/acceptableusepolicy"
 )
 
 func main() {
+	// The users who accepted an outdated version of the policy keep their access while being reminded
+	gracePeriod := flag.Duration("grace-period", 0, "period during which the users who accepted an outdated version of the policy keep their access while being reminded, 0 to withdraw it right away")
+	// The control loop takes the options of the other controllers
+	loop.AddFlags(flag.CommandLine)
+	// The settings of the controllers come from the config file, the environment, and then the command line
+	configFlags := config.AddFlags(flag.CommandLine)
 	// Set kubeconfig to be used to create clientsets
-	authorization.SetKubeConfig()
+	if err := authorization.SetKubeConfig(); err != nil {
+		os.Exit(1)
+	}
+	settings, err := configFlags.Load()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	acceptableusepolicy.SetGracePeriod(*gracePeriod)
 	// Start the controller to provide the functionalities of acceptableusepolicy resource
-	acceptableusepolicy.Start()
+	acceptableusepolicy.Start(settings)
 }
@@ -1,13 +1,43 @@
 package main
 
 import (
+	"flag"
+	"log"
+	"os"
+
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 	"edgenet/pkg/controller/v1alpha/authority"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
 )
 
 func main() {
+	// The cluster roles are named with the prefix to avoid conflicts with other systems in a shared cluster
+	clusterRolePrefix := flag.String("cluster-role-prefix", "", "prefix of the names of the cluster roles that the controllers create, such as edgenet:, to avoid conflicts with other systems")
+	// The options of the authority controller, such as the grace period of the teams of a disabled authority
+	authority.AddFlags(flag.CommandLine, "")
+	// The namespace names are formatted as those of the other controllers
+	namespace.AddFlags(flag.CommandLine)
+	// The control loop takes the options of the other controllers
+	loop.AddFlags(flag.CommandLine)
+	// The settings of the controllers come from the config file, the environment, and then the command line
+	configFlags := config.AddFlags(flag.CommandLine)
 	// Set kubeconfig to be used to create clientsets
-	authorization.SetKubeConfig()
+	if err := authorization.SetKubeConfig(); err != nil {
+		os.Exit(1)
+	}
+	settings, err := configFlags.Load()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	if err := namespace.LoadNameFormats(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	registration.SetClusterRolePrefix(*clusterRolePrefix)
 	// Start the controller to provide the functionalities of authority resource
-	authority.Start()
+	authority.Start(settings)
 }
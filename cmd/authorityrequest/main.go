@@ -1,13 +1,30 @@
 package main
 
 import (
+	"flag"
+	"log"
+	"os"
+
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 	"edgenet/pkg/controller/v1alpha/authorityrequest"
 )
 
 func main() {
+	// The control loop takes the options of the other controllers
+	loop.AddFlags(flag.CommandLine)
+	// The settings of the controllers come from the config file, the environment, and then the command line
+	configFlags := config.AddFlags(flag.CommandLine)
 	// Set kubeconfig to be used to create clientsets
-	authorization.SetKubeConfig()
+	if err := authorization.SetKubeConfig(); err != nil {
+		os.Exit(1)
+	}
+	settings, err := configFlags.Load()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
 	// Start the controller to provide the functionalities of authorityrequest resource
-	authorityrequest.Start()
+	authorityrequest.Start(settings)
 }
@@ -0,0 +1,184 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"time"
+
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/v1/nodelabeler"
+	"edgenet/pkg/controller/v1alpha/acceptableusepolicy"
+	"edgenet/pkg/controller/v1alpha/authority"
+	"edgenet/pkg/controller/v1alpha/authorityrequest"
+	"edgenet/pkg/controller/v1alpha/emailverification"
+	"edgenet/pkg/controller/v1alpha/nodecontribution"
+	"edgenet/pkg/controller/v1alpha/permission"
+	"edgenet/pkg/controller/v1alpha/selectivedeployment"
+	"edgenet/pkg/controller/v1alpha/slice"
+	"edgenet/pkg/controller/v1alpha/team"
+	"edgenet/pkg/controller/v1alpha/totalresourcequota"
+	"edgenet/pkg/controller/v1alpha/user"
+	"edgenet/pkg/controller/v1alpha/userregistrationrequest"
+	"edgenet/pkg/registration"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// The controllers that don't take any options besides the settings, the subcommand name is the resource name
+var controllers = map[string]func(*config.Config){
+	"authorityrequest":        authorityrequest.Start,
+	"emailverification":       emailverification.Start,
+	"nodecontribution":        nodecontribution.Start,
+	"nodelabeler":             nodelabeler.Start,
+	"permission":              permission.Start,
+	"selectivedeployment":     selectivedeployment.Start,
+	"slice":                   slice.Start,
+	"totalresourcequota":      totalresourcequota.Start,
+	"userregistrationrequest": userregistrationrequest.Start,
+}
+
+// newControllerCommand returns the command that has a subcommand to start each controller
+func newControllerCommand() *cobra.Command {
+	controllerCmd := &cobra.Command{
+		Use:   "controller",
+		Short: "Start the controller of a resource",
+	}
+	for name, start := range controllers {
+		start := start
+		controllerCmd.AddCommand(&cobra.Command{
+			Use:   name,
+			Short: "Start the controller to provide the functionalities of " + name + " resource",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := setup(); err != nil {
+					return err
+				}
+				start(settings)
+				return nil
+			},
+		})
+	}
+	controllerCmd.AddCommand(newAcceptableUsePolicyCommand())
+	controllerCmd.AddCommand(newAuthorityCommand())
+	controllerCmd.AddCommand(newTeamCommand())
+	controllerCmd.AddCommand(newUserCommand())
+	return controllerCmd
+}
+
+// Options of the controllers that take any besides those defined by their packages, which both the subcommand of the
+// controller and the controllers command take
+var gracePeriod, certificateValidity time.Duration
+
+// addAcceptableUsePolicyFlags defines the grace period of the acceptable use policy controller
+func addAcceptableUsePolicyFlags(flags *pflag.FlagSet) {
+	flags.DurationVar(&gracePeriod, "grace-period", 0, "period during which the users who accepted an outdated version of the policy keep their access while being reminded, 0 to withdraw it right away")
+}
+
+// applyAcceptableUsePolicyOptions sets the grace period before the controller starts
+func applyAcceptableUsePolicyOptions() {
+	acceptableusepolicy.SetGracePeriod(gracePeriod)
+}
+
+// addUserFlags defines the bound on the validity of the user certificates
+func addUserFlags(flags *pflag.FlagSet) {
+	flags.DurationVar(&certificateValidity, "certificate-validity", 365*24*time.Hour, "how long the certificates issued to the users may remain valid at most, those that the cluster signs for longer are rejected")
+}
+
+// applyUserOptions sets the bound on the validity of the user certificates before the controller starts
+func applyUserOptions() {
+	registration.SetCertificateValidity(certificateValidity)
+}
+
+// newAcceptableUsePolicyCommand returns the subcommand of the acceptable use policy controller, which has a grace period
+func newAcceptableUsePolicyCommand() *cobra.Command {
+	AUPCmd := &cobra.Command{
+		Use:   "acceptableusepolicy",
+		Short: "Start the controller to provide the functionalities of acceptableusepolicy resource",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setup(); err != nil {
+				return err
+			}
+			applyAcceptableUsePolicyOptions()
+			acceptableusepolicy.Start(settings)
+			return nil
+		},
+	}
+	addAcceptableUsePolicyFlags(AUPCmd.Flags())
+	return AUPCmd
+}
+
+// newAuthorityCommand returns the subcommand of the authority controller, whose cluster roles may be managed externally
+func newAuthorityCommand() *cobra.Command {
+	authorityCmd := &cobra.Command{
+		Use:   "authority",
+		Short: "Start the controller to provide the functionalities of authority resource",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setup(); err != nil {
+				return err
+			}
+			authority.Start(settings)
+			return nil
+		},
+	}
+	authorityFlags := flag.NewFlagSet("authority", flag.ExitOnError)
+	authority.AddFlags(authorityFlags, "")
+	authorityCmd.Flags().AddGoFlagSet(authorityFlags)
+	return authorityCmd
+}
+
+// newUserCommand returns the subcommand of the user controller, which bounds the validity of the user certificates
+func newUserCommand() *cobra.Command {
+	userCmd := &cobra.Command{
+		Use:   "user",
+		Short: "Start the controller to provide the functionalities of user resource",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setup(); err != nil {
+				return err
+			}
+			applyUserOptions()
+			user.Start(settings)
+			return nil
+		},
+	}
+	addUserFlags(userCmd.Flags())
+	return userCmd
+}
+
+// newTeamCommand returns the subcommand of the team controller, which has its own options
+func newTeamCommand() *cobra.Command {
+	teamCmd := &cobra.Command{
+		Use:   "team",
+		Short: "Start the controller to provide the functionalities of team resource",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setup(); err != nil {
+				return err
+			}
+			team.Start(settings)
+			return nil
+		},
+	}
+	teamFlags := flag.NewFlagSet("team", flag.ExitOnError)
+	team.AddFlags(teamFlags, "")
+	teamCmd.Flags().AddGoFlagSet(teamFlags)
+	return teamCmd
+}
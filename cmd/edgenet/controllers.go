@@ -0,0 +1,224 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"edgenet/pkg/authorization"
+	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/v1/nodelabeler"
+	"edgenet/pkg/controller/v1alpha/acceptableusepolicy"
+	"edgenet/pkg/controller/v1alpha/authority"
+	"edgenet/pkg/controller/v1alpha/authorityrequest"
+	"edgenet/pkg/controller/v1alpha/emailverification"
+	"edgenet/pkg/controller/v1alpha/nodecontribution"
+	"edgenet/pkg/controller/v1alpha/permission"
+	"edgenet/pkg/controller/v1alpha/selectivedeployment"
+	"edgenet/pkg/controller/v1alpha/slice"
+	"edgenet/pkg/controller/v1alpha/team"
+	"edgenet/pkg/controller/v1alpha/totalresourcequota"
+	"edgenet/pkg/controller/v1alpha/user"
+	"edgenet/pkg/controller/v1alpha/userregistrationrequest"
+	"edgenet/pkg/mailer"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The controllers that can share the process, each runs until the stop channel closes
+var runnableControllers = map[string]func(kubernetes.Interface, versioned.Interface, *config.Config, <-chan struct{}){
+	"acceptableusepolicy":     acceptableusepolicy.Run,
+	"authority":               authority.Run,
+	"authorityrequest":        authorityrequest.Run,
+	"emailverification":       emailverification.Run,
+	"nodecontribution":        nodecontribution.Run,
+	"nodelabeler":             nodelabeler.Run,
+	"permission":              permission.Run,
+	"selectivedeployment":     selectivedeployment.Run,
+	"slice":                   slice.Run,
+	"team":                    team.Run,
+	"totalresourcequota":      totalresourcequota.Run,
+	"user":                    user.Run,
+	"userregistrationrequest": userregistrationrequest.Run,
+}
+
+// Constant variables for the controller states
+const running = "running"
+const stopped = "stopped"
+const crashed = "crashed"
+
+// controllerStates is published along with the other metrics and used by the health endpoint
+var controllerStates = expvar.NewMap("controllers")
+
+// newControllersCommand returns the command that starts a set of controllers in a single process
+func newControllersCommand() *cobra.Command {
+	controllersCmd := &cobra.Command{
+		Use:   fmt.Sprintf("controllers [%s]...", strings.Join(runnableControllerNames(), "|")),
+		Short: "Start the controllers given, or all of them, in a single process that shares the clientsets",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = runnableControllerNames()
+			}
+			for _, name := range args {
+				if _, ok := runnableControllers[name]; !ok {
+					return fmt.Errorf("controller %q cannot run along with others, the choices are %s", name, strings.Join(runnableControllerNames(), ", "))
+				}
+			}
+			if err := setup(); err != nil {
+				return err
+			}
+			applyAcceptableUsePolicyOptions()
+			applyUserOptions()
+			return runControllers(args)
+		},
+	}
+	// The options of the team controller take its name as the prefix, as some of them are also those of the authority controller
+	teamFlags := flag.NewFlagSet("team", flag.ExitOnError)
+	team.AddFlags(teamFlags, "team-")
+	controllersCmd.Flags().AddGoFlagSet(teamFlags)
+	authorityFlags := flag.NewFlagSet("authority", flag.ExitOnError)
+	authority.AddFlags(authorityFlags, "")
+	controllersCmd.Flags().AddGoFlagSet(authorityFlags)
+	addAcceptableUsePolicyFlags(controllersCmd.Flags())
+	addUserFlags(controllersCmd.Flags())
+	return controllersCmd
+}
+
+// runControllers starts each controller on its own goroutine and stops all of them on SIGTERM
+func runControllers(names []string) error {
+	clientset, err := authorization.CreateClientSet()
+	if err != nil {
+		return err
+	}
+	edgenetClientset, err := authorization.CreateEdgeNetClientSet()
+	if err != nil {
+		return err
+	}
+	// A panic logged by HandleCrash stops the failing goroutine only, rather than the whole process along with the other controllers
+	utilruntime.ReallyCrash = false
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string, run func(kubernetes.Interface, versioned.Interface, *config.Config, <-chan struct{})) {
+			defer wg.Done()
+			runController(name, run, clientset, edgenetClientset, stopCh)
+		}(name, runnableControllers[name])
+	}
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+	log.Info("Stopping the controllers")
+	close(stopCh)
+	wg.Wait()
+	return nil
+}
+
+// runController runs the controller and records its state, the controller is expected to return only once the stop channel closes
+func runController(name string, run func(kubernetes.Interface, versioned.Interface, *config.Config, <-chan struct{}),
+	clientset kubernetes.Interface, edgenetClientset versioned.Interface, stopCh <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Controller %s crashed: %v\n%s", name, r, debug.Stack())
+			setControllerState(name, crashed)
+		}
+	}()
+	log.Infof("Starting controller %s", name)
+	setControllerState(name, running)
+	run(clientset, edgenetClientset, settings, stopCh)
+	select {
+	case <-stopCh:
+		setControllerState(name, stopped)
+	default:
+		log.Errorf("Controller %s stopped unexpectedly", name)
+		setControllerState(name, crashed)
+	}
+}
+
+func setControllerState(name, state string) {
+	value := new(expvar.String)
+	value.Set(state)
+	controllerStates.Set(name, value)
+}
+
+// serveHealth responds with an error if any of the controllers in the process isn't running
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	if unhealthy := unhealthyControllers(); len(unhealthy) > 0 {
+		http.Error(w, strings.Join(unhealthy, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// serveReadiness responds with an error if any of the controllers in the process isn't running or the SMTP server
+// cannot be reached, as the emails are part of the team and permission flows
+func serveReadiness(w http.ResponseWriter, r *http.Request) {
+	unready := unhealthyControllers()
+	if err := mailer.Ping(); err != nil {
+		unready = append(unready, fmt.Sprintf("smtp: %s", err))
+	}
+	if len(unready) > 0 {
+		http.Error(w, strings.Join(unready, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// unhealthyControllers returns the controllers that aren't running along with their states
+func unhealthyControllers() []string {
+	unhealthy := []string{}
+	controllerStates.Do(func(kv expvar.KeyValue) {
+		if state := kv.Value.(*expvar.String).Value(); state != running {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", kv.Key, state))
+		}
+	})
+	return unhealthy
+}
+
+// serveDebugState responds with the reconcile state of the controllers that record it
+func serveDebugState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"team": team.DebugState()}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func runnableControllerNames() []string {
+	names := []string{}
+	for name := range runnableControllers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"edgenet/pkg/authorization"
+	"edgenet/pkg/controller/v1alpha/team"
+
+	"github.com/spf13/cobra"
+)
+
+// newResendInvitationsCommand returns the command that sends the pending invitations of a team again
+func newResendInvitationsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resend-invitations NAMESPACE/TEAM",
+		Short: "Send the invitations of a team that couldn't be sent again, rather than waiting for the next resync",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			parts := strings.Split(args[0], "/")
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("team %q isn't in the form NAMESPACE/TEAM", args[0])
+			}
+			if err := setup(); err != nil {
+				return err
+			}
+			clientset, err := authorization.CreateClientSet()
+			if err != nil {
+				return err
+			}
+			edgenetClientset, err := authorization.CreateEdgeNetClientSet()
+			if err != nil {
+				return err
+			}
+			return team.ResendInvitations(clientset, edgenetClientset, parts[0], parts[1])
+		},
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The edgenet command runs any of the controllers, picked by the subcommand, from a single binary
+
+package main
+
+import (
+	"expvar"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"edgenet/pkg/authorization"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
+	"edgenet/pkg/events"
+	"edgenet/pkg/mailer"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Options shared by all subcommands, the settings of the controllers are loaded once along with the config file
+var settings *config.Config
+var metricsPort int
+var logLevel string
+var propagationPrefix string
+var clusterRolePrefix string
+var authorityNamespaceFormat string
+var childNamespaceFormat string
+var emailOutboxNamespace string
+var emailOutboxName string
+var emailOutboxPeriod time.Duration
+var debugState bool
+var debugPermissions bool
+var eventStream bool
+var eventStreamBuffer int
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// newRootCommand returns the edgenet command along with the shared options
+func newRootCommand() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:          "edgenet",
+		Short:        "EdgeNet runs the controllers that provide the functionalities of its resources",
+		SilenceUsage: true,
+	}
+	// The settings of the controllers come from the config file, the environment, and then the command line
+	configFlagSet := flag.NewFlagSet("config", flag.ExitOnError)
+	configFlags := config.AddFlags(configFlagSet)
+	rootCmd.PersistentFlags().AddGoFlagSet(configFlagSet)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		var err error
+		settings, err = configFlags.Load()
+		return err
+	}
+	// The options for the cluster config are those of authorization
+	kubeFlags := flag.NewFlagSet("kube", flag.ExitOnError)
+	authorization.AddFlags(kubeFlags)
+	rootCmd.PersistentFlags().AddGoFlagSet(kubeFlags)
+	// The options of the control loop are those of all controllers
+	loopFlags := flag.NewFlagSet("loop", flag.ExitOnError)
+	loop.AddFlags(loopFlags)
+	rootCmd.PersistentFlags().AddGoFlagSet(loopFlags)
+	rootCmd.PersistentFlags().IntVar(&metricsPort, "metrics-port", 0, "port to expose the metrics on /debug/vars, the health on /healthz, and the readiness on /readyz, 0 to disable")
+	rootCmd.PersistentFlags().BoolVar(&debugState, "debug-state", false, "expose the queue, the last reconcile times, and the recent errors of the controllers as JSON on /debug/state of the metrics port")
+	rootCmd.PersistentFlags().BoolVar(&debugPermissions, "debug-permissions", false, "expose the roles that a user holds across the namespaces as JSON on /debug/permissions?authority=&username= of the metrics port")
+	rootCmd.PersistentFlags().BoolVar(&eventStream, "event-stream", false, "stream the reconcile events of the controllers as server-sent events on /debug/events of the metrics port")
+	rootCmd.PersistentFlags().IntVar(&eventStreamBuffer, "event-stream-buffer", 100, "number of reconcile events kept for each client of the event stream, the events beyond are dropped for a slow client")
+	rootCmd.PersistentFlags().StringVar(&propagationPrefix, "propagation-prefix", "", "prefix of the label and annotation keys that child namespaces inherit from their parents, empty to propagate none")
+	rootCmd.PersistentFlags().StringVar(&clusterRolePrefix, "cluster-role-prefix", "", "prefix of the names of the cluster roles that the controllers create, such as edgenet:, to avoid conflicts with other systems")
+	rootCmd.PersistentFlags().StringVar(&authorityNamespaceFormat, "authority-namespace-format", "authority-%s", "format of the authority namespace names, which takes the authority name, such as east-authority-%s to include the cluster in a federation")
+	rootCmd.PersistentFlags().StringVar(&childNamespaceFormat, "child-namespace-format", "%s-%s-%s", "format of the child namespace names, which takes the parent namespace, the kind, such as team, and the name of the resource")
+	rootCmd.PersistentFlags().StringVar(&emailOutboxNamespace, "email-outbox-namespace", "", "namespace of the config map that keeps the emails until they are sent, so that they survive restarts, empty to send them right away")
+	rootCmd.PersistentFlags().StringVar(&emailOutboxName, "email-outbox-name", "edgenet-email-outbox", "name of the config map that keeps the emails until they are sent")
+	rootCmd.PersistentFlags().DurationVar(&emailOutboxPeriod, "email-outbox-period", 30*time.Second, "period to retry the emails in the outbox that aren't sent yet")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", log.InfoLevel.String(), "log level: debug, info, warning, error, fatal, or panic")
+	rootCmd.AddCommand(newControllerCommand())
+	rootCmd.AddCommand(newControllersCommand())
+	rootCmd.AddCommand(newWebhookCommand())
+	rootCmd.AddCommand(newResendInvitationsCommand())
+	return rootCmd
+}
+
+// setup applies the shared options before a controller starts
+func setup() error {
+	level, err := log.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+	namespace.SetPropagationPrefix(propagationPrefix)
+	if err := namespace.SetNameFormats(authorityNamespaceFormat, childNamespaceFormat); err != nil {
+		return err
+	}
+	registration.SetClusterRolePrefix(clusterRolePrefix)
+	if err := loop.Configure(settings); err != nil {
+		return err
+	}
+	// Set kubeconfig to be used to create clientsets
+	if err := authorization.LoadKubeConfig(); err != nil {
+		return err
+	}
+	if emailOutboxNamespace != "" {
+		clientset, err := authorization.CreateClientSet()
+		if err != nil {
+			return err
+		}
+		// The emails left unsent by the previous run get retried on the first drain
+		outbox := mailer.NewOutbox(clientset, emailOutboxNamespace, emailOutboxName)
+		mailer.SetOutbox(outbox)
+		go outbox.Run(emailOutboxPeriod, wait.NeverStop)
+	}
+	if metricsPort > 0 {
+		go serveMetrics(metricsPort)
+	}
+	return nil
+}
+
+// serveMetrics exposes the variables published by the controllers and their health
+func serveMetrics(port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/healthz", serveHealth)
+	mux.HandleFunc("/readyz", serveReadiness)
+	if debugState {
+		mux.HandleFunc("/debug/state", serveDebugState)
+	}
+	if debugPermissions {
+		if clientset, err := authorization.CreateClientSet(); err == nil {
+			mux.HandleFunc("/debug/permissions", registration.ServeEffectivePermissions(clientset))
+		} else {
+			log.Errorf("Couldn't serve the permissions: %s", err)
+		}
+	}
+	if eventStream {
+		events.SetBufferSize(eventStreamBuffer)
+		mux.HandleFunc("/debug/events", events.ServeSSE)
+	}
+	log.Infof("Serving metrics on port %d", port)
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), mux); err != nil {
+		log.Errorf("Metrics server stopped: %s", err)
+	}
+}
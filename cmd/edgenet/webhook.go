@@ -0,0 +1,136 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"edgenet/pkg/authorization"
+	"edgenet/pkg/webhook/authority"
+	"edgenet/pkg/webhook/namespace"
+	"edgenet/pkg/webhook/team"
+	"edgenet/pkg/webhook/user"
+
+	"github.com/spf13/cobra"
+)
+
+// newWebhookCommand returns the command that has a subcommand to serve each admission webhook
+func newWebhookCommand() *cobra.Command {
+	webhookCmd := &cobra.Command{
+		Use:   "webhook",
+		Short: "Serve the admission webhook of a resource",
+	}
+	webhookCmd.AddCommand(newTeamWebhookCommand())
+	webhookCmd.AddCommand(newAuthorityWebhookCommand())
+	webhookCmd.AddCommand(newNamespaceWebhookCommand())
+	webhookCmd.AddCommand(newUserWebhookCommand())
+	return webhookCmd
+}
+
+// newTeamWebhookCommand returns the subcommand of the webhooks that default the resource quota of teams and keep their child namespaces unique
+func newTeamWebhookCommand() *cobra.Command {
+	var port int
+	var certFile, keyFile string
+	teamWebhookCmd := &cobra.Command{
+		Use:   "team",
+		Short: "Serve the webhooks that default the resource quota of teams from the policy of their authorities, and reject the teams whose child namespace is taken",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setup(); err != nil {
+				return err
+			}
+			edgenetClientset, err := authorization.CreateEdgeNetClientSet()
+			if err != nil {
+				return err
+			}
+			return team.Serve(port, certFile, keyFile, edgenetClientset)
+		},
+	}
+	teamWebhookCmd.Flags().IntVar(&port, "port", 8443, "port to serve the webhook on")
+	teamWebhookCmd.Flags().StringVar(&certFile, "tls-cert-file", "/etc/webhook/certs/tls.crt", "certificate of the webhook")
+	teamWebhookCmd.Flags().StringVar(&keyFile, "tls-private-key-file", "/etc/webhook/certs/tls.key", "private key of the certificate")
+	return teamWebhookCmd
+}
+
+// newAuthorityWebhookCommand returns the subcommand of the webhook that guards the deletion of authorities
+func newAuthorityWebhookCommand() *cobra.Command {
+	var port int
+	var certFile, keyFile string
+	authorityWebhookCmd := &cobra.Command{
+		Use:   "authority",
+		Short: "Serve the webhook that rejects the deletion of authorities which still have enabled teams or slices",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setup(); err != nil {
+				return err
+			}
+			edgenetClientset, err := authorization.CreateEdgeNetClientSet()
+			if err != nil {
+				return err
+			}
+			return authority.Serve(port, certFile, keyFile, edgenetClientset)
+		},
+	}
+	authorityWebhookCmd.Flags().IntVar(&port, "port", 8443, "port to serve the webhook on")
+	authorityWebhookCmd.Flags().StringVar(&certFile, "tls-cert-file", "/etc/webhook/certs/tls.crt", "certificate of the webhook")
+	authorityWebhookCmd.Flags().StringVar(&keyFile, "tls-private-key-file", "/etc/webhook/certs/tls.key", "private key of the certificate")
+	return authorityWebhookCmd
+}
+
+// newNamespaceWebhookCommand returns the subcommand of the webhook that labels the namespaces by their authority
+func newNamespaceWebhookCommand() *cobra.Command {
+	var port int
+	var certFile, keyFile string
+	namespaceWebhookCmd := &cobra.Command{
+		Use:   "namespace",
+		Short: "Serve the webhook that sets the authority-name label of the authority namespaces and of the child namespaces of teams and slices",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setup(); err != nil {
+				return err
+			}
+			edgenetClientset, err := authorization.CreateEdgeNetClientSet()
+			if err != nil {
+				return err
+			}
+			return namespace.Serve(port, certFile, keyFile, edgenetClientset)
+		},
+	}
+	namespaceWebhookCmd.Flags().IntVar(&port, "port", 8443, "port to serve the webhook on")
+	namespaceWebhookCmd.Flags().StringVar(&certFile, "tls-cert-file", "/etc/webhook/certs/tls.crt", "certificate of the webhook")
+	namespaceWebhookCmd.Flags().StringVar(&keyFile, "tls-private-key-file", "/etc/webhook/certs/tls.key", "private key of the certificate")
+	return namespaceWebhookCmd
+}
+
+// newUserWebhookCommand returns the subcommand of the webhook that validates the roles of users
+func newUserWebhookCommand() *cobra.Command {
+	var port int
+	var certFile, keyFile string
+	userWebhookCmd := &cobra.Command{
+		Use:   "user",
+		Short: "Serve the webhook that rejects the users whose roles aren't among the roles that users can hold",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setup(); err != nil {
+				return err
+			}
+			return user.Serve(port, certFile, keyFile)
+		},
+	}
+	userWebhookCmd.Flags().IntVar(&port, "port", 8443, "port to serve the webhook on")
+	userWebhookCmd.Flags().StringVar(&certFile, "tls-cert-file", "/etc/webhook/certs/tls.crt", "certificate of the webhook")
+	userWebhookCmd.Flags().StringVar(&keyFile, "tls-private-key-file", "/etc/webhook/certs/tls.key", "private key of the certificate")
+	return userWebhookCmd
+}
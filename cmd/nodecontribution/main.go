@@ -1,13 +1,46 @@
 package main
 
 import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 	"edgenet/pkg/controller/v1alpha/nodecontribution"
+	"edgenet/pkg/namespace"
 )
 
 func main() {
+	// The node of a deleted node contribution stays cordoned if its pods aren't evicted in time
+	drainTimeout := flag.Duration("drain-timeout", 10*time.Minute, "maximum time to drain the node of a deleted node contribution before removing it")
+	// The contributed nodes go offline unpredictably, so they are checked periodically
+	reachabilityPeriod := flag.Duration("reachability-period", 5*time.Minute, "period to check whether the contributed nodes are reachable, 0 to disable")
+	unreachableThreshold := flag.Duration("unreachable-threshold", 30*time.Minute, "time that a contributed node can be unreachable before its contributors are informed")
+	// The namespace names are formatted as those of the other controllers
+	namespace.AddFlags(flag.CommandLine)
+	// The control loop takes the options of the other controllers
+	loop.AddFlags(flag.CommandLine)
+	// The settings of the controllers come from the config file, the environment, and then the command line
+	configFlags := config.AddFlags(flag.CommandLine)
 	// Set kubeconfig to be used to create clientsets
-	authorization.SetKubeConfig()
+	if err := authorization.SetKubeConfig(); err != nil {
+		os.Exit(1)
+	}
+	settings, err := configFlags.Load()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	if err := namespace.LoadNameFormats(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	nodecontribution.SetDrainTimeout(*drainTimeout)
+	nodecontribution.SetReachabilityPeriod(*reachabilityPeriod)
+	nodecontribution.SetUnreachableThreshold(*unreachableThreshold)
 	// Start the controller to provide the functionalities of nodecontribution resource
-	nodecontribution.Start()
+	nodecontribution.Start(settings)
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"edgenet/pkg/authorization"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
+	"edgenet/pkg/controller/v1alpha/permission"
+	"edgenet/pkg/namespace"
+)
+
+func main() {
+	// The namespace names are formatted as those of the other controllers
+	namespace.AddFlags(flag.CommandLine)
+	// The control loop takes the options of the other controllers
+	loop.AddFlags(flag.CommandLine)
+	// The settings of the controllers come from the config file, the environment, and then the command line
+	configFlags := config.AddFlags(flag.CommandLine)
+	// Set kubeconfig to be used to create clientsets
+	if err := authorization.SetKubeConfig(); err != nil {
+		os.Exit(1)
+	}
+	settings, err := configFlags.Load()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	if err := namespace.LoadNameFormats(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	// Start the controller to provide the functionalities of permission resource
+	permission.Start(settings)
+}
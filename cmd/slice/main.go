@@ -1,13 +1,47 @@
 package main
 
 import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 	"edgenet/pkg/controller/v1alpha/slice"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
 )
 
 func main() {
+	// The cluster roles are named with the prefix to avoid conflicts with other systems in a shared cluster
+	clusterRolePrefix := flag.String("cluster-role-prefix", "", "prefix of the names of the cluster roles that the controllers create, such as edgenet:, to avoid conflicts with other systems")
+	// The labels and annotations with the prefix are copied from the owner namespaces to the slice namespaces
+	propagationPrefix := flag.String("propagation-prefix", "", "prefix of the label and annotation keys that child namespaces inherit from their parents, empty to propagate none")
+	warningInterval := flag.Duration("warning-interval", 72*time.Hour, "time before the expiry of a slice when its users are warned")
+	// The namespace names are formatted as those of the other controllers
+	namespace.AddFlags(flag.CommandLine)
+	// The control loop takes the options of the other controllers
+	loop.AddFlags(flag.CommandLine)
+	// The settings of the controllers come from the config file, the environment, and then the command line
+	configFlags := config.AddFlags(flag.CommandLine)
 	// Set kubeconfig to be used to create clientsets
-	authorization.SetKubeConfig()
+	if err := authorization.SetKubeConfig(); err != nil {
+		os.Exit(1)
+	}
+	settings, err := configFlags.Load()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	if err := namespace.LoadNameFormats(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	namespace.SetPropagationPrefix(*propagationPrefix)
+	registration.SetClusterRolePrefix(*clusterRolePrefix)
+	slice.SetWarningInterval(*warningInterval)
 	// Start the controller to provide the functionalities of slice resource
-	slice.Start()
+	slice.Start(settings)
 }
@@ -1,13 +1,46 @@
 package main
 
 import (
+	"flag"
+	"log"
+	"os"
+
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 	"edgenet/pkg/controller/v1alpha/team"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
 )
 
 func main() {
+	// The cluster roles are named with the prefix to avoid conflicts with other systems in a shared cluster
+	clusterRolePrefix := flag.String("cluster-role-prefix", "", "prefix of the names of the cluster roles that the controllers create, such as edgenet:, to avoid conflicts with other systems")
+	// The labels and annotations with the prefix are copied from authority namespaces to the child namespaces
+	propagationPrefix := flag.String("propagation-prefix", "", "prefix of the label and annotation keys that child namespaces inherit from their parents, empty to propagate none")
+	// The options of the team controller, such as the shard of the teams to watch
+	team.AddFlags(flag.CommandLine, "")
+	// The namespace names are formatted as those of the other controllers
+	namespace.AddFlags(flag.CommandLine)
+	// The control loop takes the options of the other controllers
+	loop.AddFlags(flag.CommandLine)
+	// The settings of the controllers come from the config file, the environment, and then the command line
+	configFlags := config.AddFlags(flag.CommandLine)
 	// Set kubeconfig to be used to create clientsets
-	authorization.SetKubeConfig()
+	if err := authorization.SetKubeConfig(); err != nil {
+		os.Exit(1)
+	}
+	settings, err := configFlags.Load()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	if err := namespace.LoadNameFormats(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	namespace.SetPropagationPrefix(*propagationPrefix)
+	registration.SetClusterRolePrefix(*clusterRolePrefix)
 	// Start the controller to provide the functionalities of team resource
-	team.Start()
+	team.Start(settings)
 }
@@ -1,13 +1,44 @@
 package main
 
 import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 	"edgenet/pkg/controller/v1alpha/user"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
 )
 
 func main() {
+	// The cluster roles are named with the prefix to avoid conflicts with other systems in a shared cluster
+	clusterRolePrefix := flag.String("cluster-role-prefix", "", "prefix of the names of the cluster roles that the controllers create, such as edgenet:, to avoid conflicts with other systems")
+	certificateValidity := flag.Duration("certificate-validity", 365*24*time.Hour, "how long the certificates issued to the users may remain valid at most, those that the cluster signs for longer are rejected")
+	// The namespace names are formatted as those of the other controllers
+	namespace.AddFlags(flag.CommandLine)
+	// The control loop takes the options of the other controllers
+	loop.AddFlags(flag.CommandLine)
+	// The settings of the controllers come from the config file, the environment, and then the command line
+	configFlags := config.AddFlags(flag.CommandLine)
 	// Set kubeconfig to be used to create clientsets
-	authorization.SetKubeConfig()
+	if err := authorization.SetKubeConfig(); err != nil {
+		os.Exit(1)
+	}
+	settings, err := configFlags.Load()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	if err := namespace.LoadNameFormats(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	registration.SetClusterRolePrefix(*clusterRolePrefix)
+	registration.SetCertificateValidity(*certificateValidity)
 	// Start the controller to provide the functionalities of user resource
-	user.Start()
+	user.Start(settings)
 }
@@ -64,6 +64,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&SliceList{},
 		&Team{},
 		&TeamList{},
+		&Permission{},
+		&PermissionList{},
 		&NodeContribution{},
 		&NodeContributionList{},
 		&TotalResourceQuota{},
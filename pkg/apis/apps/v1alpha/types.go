@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha
 
 import (
+	core_v1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -109,6 +110,21 @@ type AuthoritySpec struct {
 	URL       string  `json:"url"`
 	Address   Address `json:"address"`
 	Contact   Contact `json:"contact"`
+	// TeamResourceQuota is the policy of the authority for the quota of its teams that don't specify one
+	TeamResourceQuota *core_v1.ResourceQuotaSpec `json:"teamResourceQuota,omitempty"`
+	// Notifications selects where the notifications about the authority go, by email only if it isn't set
+	Notifications *Notifications `json:"notifications,omitempty"`
+	// DefaultRoles are the roles of the users who register in the authority without any, the roles configured
+	// for the cluster if empty
+	DefaultRoles []string `json:"defaultRoles,omitempty"`
+}
+
+// Notifications are the sinks of the notifications about an authority
+type Notifications struct {
+	// DisableEmail stops the emails, so that the notifications go to the other sinks only
+	DisableEmail bool `json:"disableEmail,omitempty"`
+	// SlackWebhookURL is the incoming webhook of the Slack channel to post the notifications to
+	SlackWebhookURL string `json:"slackWebhookURL,omitempty"`
 }
 
 // Contact
@@ -170,6 +186,8 @@ type AuthorityRequestSpec struct {
 	URL       string  `json:"url"`
 	Address   Address `json:"address"`
 	Contact   Contact `json:"contact"`
+	// TeamResourceQuota is the policy of the authority for the quota of its teams that don't specify one
+	TeamResourceQuota *core_v1.ResourceQuotaSpec `json:"teamResourceQuota,omitempty"`
 }
 
 // AuthorityRequestStatus is the status for a AuthorityRequest resource
@@ -209,8 +227,12 @@ type Team struct {
 
 // TeamSpec is the spec for a Team resource
 type TeamSpec struct {
-	Users       []TeamUsers `json:"users"`
-	Description string      `json:"description"`
+	Users         []TeamUsers                `json:"users"`
+	Description   string                     `json:"description"`
+	ResourceQuota *core_v1.ResourceQuotaSpec `json:"resourceQuota,omitempty"`
+	// Groups pick the users who participate in the team by their authority and roles, as they are at the time,
+	// along with those listed one by one
+	Groups []TeamGroup `json:"groups,omitempty"`
 }
 
 type TeamUsers struct {
@@ -218,9 +240,36 @@ type TeamUsers struct {
 	Username  string `json:"username"`
 }
 
+// TeamGroup selects the users of an authority who hold any of the roles
+type TeamGroup struct {
+	// Authority of the users, the authority of the team if empty
+	Authority string `json:"authority,omitempty"`
+	// Roles of which the users hold any, such as Tech, all the users of the authority if empty
+	Roles []string `json:"roles,omitempty"`
+}
+
 // TeamStatus is the status for a Team resource
 type TeamStatus struct {
-	Enabled bool `json:"enabled"`
+	Enabled bool     `json:"enabled"`
+	State   string   `json:"state"`
+	Message []string `json:"message"`
+	// PendingInvitations are the users whose invitation email couldn't be sent, to be sent again
+	PendingInvitations []TeamUsers `json:"pendinginvitations,omitempty"`
+	// Users tells whether each user who participates in the team has access to its child namespace, and why not
+	Users []TeamUserStatus `json:"users,omitempty"`
+	// ObservedGeneration is the generation of the team that the controller reconciled successfully last, a lower one
+	// than that of the team tells that the latest change hasn't been processed yet
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastReconcileTime is when the controller updated the status of the team last
+	LastReconcileTime *meta_v1.Time `json:"lastReconcileTime,omitempty"`
+}
+
+// TeamUserStatus is the access of a user to the child namespace of a team
+type TeamUserStatus struct {
+	Authority string `json:"authority"`
+	Username  string `json:"username"`
+	// Access is one of bound, skipped-inactive, skipped-no-aup, not-found, authority-not-found, or failed
+	Access string `json:"access"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -236,6 +285,59 @@ type TeamList struct {
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
+// Permission describes a Permission resource, by which an authority grants a user roles in its namespaces
+type Permission struct {
+	// TypeMeta is the metadata for the resource, like kind and apiversion
+	meta_v1.TypeMeta `json:",inline"`
+	// ObjectMeta contains the metadata for the particular object, including
+	meta_v1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the permission resource spec
+	Spec PermissionSpec `json:"spec"`
+	// Status is the permission resource status
+	Status PermissionStatus `json:"status,omitempty"`
+}
+
+// PermissionSpec is the spec for a Permission resource
+type PermissionSpec struct {
+	// Authority of the user, the authority of the permission if empty
+	Authority string `json:"authority,omitempty"`
+	Username  string `json:"username"`
+	// Bindings are the roles granted to the user, each in a namespace of the authority
+	Bindings []PermissionBinding `json:"bindings"`
+	// Enabled grants the roles, disabling the permission revokes them
+	Enabled bool `json:"enabled"`
+	// ExpiresAt is when the roles are revoked, the permission is open-ended if empty
+	ExpiresAt *meta_v1.Time `json:"expiresAt,omitempty"`
+}
+
+// PermissionBinding is a role granted in a namespace
+type PermissionBinding struct {
+	Namespace string `json:"namespace"`
+	// RoleRef is one of admin, manager, tech, and user, which refer to the cluster role of that role for the kind of
+	// the namespace, such as team-manager, or the name of a cluster role labeled edge-net.io/grantable=true
+	RoleRef string `json:"roleRef"`
+}
+
+// PermissionStatus is the status for a Permission resource
+type PermissionStatus struct {
+	State   string   `json:"state"`
+	Message []string `json:"message"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PermissionList is a list of Permission resources
+type PermissionList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+
+	Items []Permission `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // Slice describes a Slice resource
 type Slice struct {
 	// TypeMeta is the metadata for the resource, like kind and apiversion
@@ -266,6 +368,8 @@ type SliceUsers struct {
 type SliceStatus struct {
 	Renew   bool          `json:"renew"`
 	Expires *meta_v1.Time `json:"expires"`
+	// WarningSent tells whether the users have been warned about the expiry, it is cleared when the expiry changes
+	WarningSent bool `json:"warningSent,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -296,12 +400,14 @@ type User struct {
 
 // UserSpec is the spec for a User resource
 type UserSpec struct {
-	FirstName string   `json:"firstname"`
-	LastName  string   `json:"lastname"`
-	Email     string   `json:"email"`
-	Roles     []string `json:"roles"`
-	URL       string   `json:"url"`
-	Bio       string   `json:"bio"`
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	Email     string `json:"email"`
+	// AdditionalEmails receive the notifications along with Email, such as the institutional address of the user
+	AdditionalEmails []string `json:"additionalemails,omitempty"`
+	Roles            []string `json:"roles"`
+	URL              string   `json:"url"`
+	Bio              string   `json:"bio"`
 }
 
 // UserStatus is the status for a User resource
@@ -386,12 +492,21 @@ type AcceptableUsePolicy struct {
 // AcceptableUsePolicySpec is the spec for a AcceptableUsePolicy resource
 type AcceptableUsePolicySpec struct {
 	Accepted bool `json:"accepted"`
+	// Version of the policy in force, acceptances of other versions are no longer valid
+	Version string `json:"version"`
 }
 
 // AcceptableUsePolicyStatus is the status for a AcceptableUsePolicy resource
 type AcceptableUsePolicyStatus struct {
-	Renew   bool          `json:"renew"`
-	Expires *meta_v1.Time `json:"expires"`
+	Renew           bool          `json:"renew"`
+	Expires         *meta_v1.Time `json:"expires"`
+	AcceptedVersion string        `json:"acceptedVersion"`
+	// AcceptedAt is when the user accepted the version of the policy
+	AcceptedAt *meta_v1.Time `json:"acceptedAt,omitempty"`
+	// OutdatedSince is when the acceptance was found to be of an outdated version, from which the grace period runs
+	OutdatedSince *meta_v1.Time `json:"outdatedSince,omitempty"`
+	// LastReminder is when the user was last asked to accept the version in force during the grace period
+	LastReminder *meta_v1.Time `json:"lastReminder,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -469,6 +584,10 @@ type NodeContributionSpec struct {
 	Password    string        `json:"password"`
 	Enabled     bool          `json:"enabled"`
 	Limitations []Limitations `json:"limitations"`
+	// Labels and Annotations are stamped onto the node once it joins the cluster, such as the owner and the contact of the
+	// contribution. They are merged with those of the node, and the keys in the system domains are not allowed.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type Limitations struct {
@@ -481,6 +600,11 @@ type Limitations struct {
 type NodeContributionStatus struct {
 	State   string   `json:"state"`
 	Message []string `json:"message"`
+	// Reachability is the result of the last periodic check of the node, and LastSeen is the last time it was reachable
+	Reachability string        `json:"reachability,omitempty"`
+	LastSeen     *meta_v1.Time `json:"lastSeen,omitempty"`
+	// UnreachableNotified tells whether the contributors have been informed that the node is unreachable
+	UnreachableNotified bool `json:"unreachableNotified,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
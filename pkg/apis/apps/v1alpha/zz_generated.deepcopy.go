@@ -21,6 +21,7 @@ limitations under the License.
 package v1alpha
 
 import (
+	v1 "k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -108,6 +109,18 @@ func (in *AcceptableUsePolicyStatus) DeepCopyInto(out *AcceptableUsePolicyStatus
 		in, out := &in.Expires, &out.Expires
 		*out = (*in).DeepCopy()
 	}
+	if in.AcceptedAt != nil {
+		in, out := &in.AcceptedAt, &out.AcceptedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.OutdatedSince != nil {
+		in, out := &in.OutdatedSince, &out.OutdatedSince
+		*out = (*in).DeepCopy()
+	}
+	if in.LastReminder != nil {
+		in, out := &in.LastReminder, &out.LastReminder
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -126,7 +139,7 @@ func (in *Authority) DeepCopyInto(out *Authority) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 	return
 }
@@ -289,6 +302,21 @@ func (in *AuthorityRequestStatus) DeepCopy() *AuthorityRequestStatus {
 func (in *AuthoritySpec) DeepCopyInto(out *AuthoritySpec) {
 	*out = *in
 	out.Contact = in.Contact
+	if in.TeamResourceQuota != nil {
+		in, out := &in.TeamResourceQuota, &out.TeamResourceQuota
+		*out = new(v1.ResourceQuotaSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Notifications != nil {
+		in, out := &in.Notifications, &out.Notifications
+		*out = new(Notifications)
+		**out = **in
+	}
+	if in.DefaultRoles != nil {
+		in, out := &in.DefaultRoles, &out.DefaultRoles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -559,6 +587,20 @@ func (in *NodeContributionSpec) DeepCopyInto(out *NodeContributionSpec) {
 		*out = make([]Limitations, len(*in))
 		copy(*out, *in)
 	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
@@ -580,6 +622,10 @@ func (in *NodeContributionStatus) DeepCopyInto(out *NodeContributionStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.LastSeen != nil {
+		in, out := &in.LastSeen, &out.LastSeen
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -593,6 +639,145 @@ func (in *NodeContributionStatus) DeepCopy() *NodeContributionStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Notifications) DeepCopyInto(out *Notifications) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Notifications.
+func (in *Notifications) DeepCopy() *Notifications {
+	if in == nil {
+		return nil
+	}
+	out := new(Notifications)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Permission) DeepCopyInto(out *Permission) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Permission.
+func (in *Permission) DeepCopy() *Permission {
+	if in == nil {
+		return nil
+	}
+	out := new(Permission)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Permission) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PermissionBinding) DeepCopyInto(out *PermissionBinding) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PermissionBinding.
+func (in *PermissionBinding) DeepCopy() *PermissionBinding {
+	if in == nil {
+		return nil
+	}
+	out := new(PermissionBinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PermissionList) DeepCopyInto(out *PermissionList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Permission, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PermissionList.
+func (in *PermissionList) DeepCopy() *PermissionList {
+	if in == nil {
+		return nil
+	}
+	out := new(PermissionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PermissionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PermissionSpec) DeepCopyInto(out *PermissionSpec) {
+	*out = *in
+	if in.Bindings != nil {
+		in, out := &in.Bindings, &out.Bindings
+		*out = make([]PermissionBinding, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PermissionSpec.
+func (in *PermissionSpec) DeepCopy() *PermissionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PermissionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PermissionStatus) DeepCopyInto(out *PermissionStatus) {
+	*out = *in
+	if in.Message != nil {
+		in, out := &in.Message, &out.Message
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PermissionStatus.
+func (in *PermissionStatus) DeepCopy() *PermissionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PermissionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SelectiveDeployment) DeepCopyInto(out *SelectiveDeployment) {
 	*out = *in
@@ -841,7 +1026,7 @@ func (in *Team) DeepCopyInto(out *Team) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -904,6 +1089,18 @@ func (in *TeamSpec) DeepCopyInto(out *TeamSpec) {
 		*out = make([]TeamUsers, len(*in))
 		copy(*out, *in)
 	}
+	if in.ResourceQuota != nil {
+		in, out := &in.ResourceQuota, &out.ResourceQuota
+		*out = new(v1.ResourceQuotaSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]TeamGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -920,6 +1117,25 @@ func (in *TeamSpec) DeepCopy() *TeamSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TeamStatus) DeepCopyInto(out *TeamStatus) {
 	*out = *in
+	if in.Message != nil {
+		in, out := &in.Message, &out.Message
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PendingInvitations != nil {
+		in, out := &in.PendingInvitations, &out.PendingInvitations
+		*out = make([]TeamUsers, len(*in))
+		copy(*out, *in)
+	}
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]TeamUserStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastReconcileTime != nil {
+		in, out := &in.LastReconcileTime, &out.LastReconcileTime
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -933,6 +1149,43 @@ func (in *TeamStatus) DeepCopy() *TeamStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TeamUserStatus) DeepCopyInto(out *TeamUserStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TeamUserStatus.
+func (in *TeamUserStatus) DeepCopy() *TeamUserStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TeamUserStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TeamGroup) DeepCopyInto(out *TeamGroup) {
+	*out = *in
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TeamGroup.
+func (in *TeamGroup) DeepCopy() *TeamGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(TeamGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TeamUsers) DeepCopyInto(out *TeamUsers) {
 	*out = *in
@@ -1269,6 +1522,11 @@ func (in *UserRegistrationRequestStatus) DeepCopy() *UserRegistrationRequestStat
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *UserSpec) DeepCopyInto(out *UserSpec) {
 	*out = *in
+	if in.AdditionalEmails != nil {
+		in, out := &in.AdditionalEmails, &out.AdditionalEmails
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Roles != nil {
 		in, out := &in.Roles, &out.Roles
 		*out = make([]string, len(*in))
@@ -21,19 +21,48 @@ package authorization
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 
 	edgenetclientset "edgenet/pkg/client/clientset/versioned"
 	"edgenet/pkg/config"
 
 	namecheap "github.com/billputer/go-namecheap"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 var kubeconfig string
+var kubeconfigMode string
+
+// Client-side rate limits applied to the clientsets, the defaults are the same as client-go's.
+// They can be set by the flags or the EDGENET_KUBE_API_QPS and EDGENET_KUBE_API_BURST env vars.
+const defaultQPS = 5
+const defaultBurst = 10
+
+var qps float64 = defaultQPS
+var burst int = defaultBurst
+
+// restConfig is the configuration resolved by SetKubeConfig to create clientsets
+var restConfig *rest.Config
+
+// Modes to obtain the configuration of the cluster
+const (
+	// ModeAuto tries the in-cluster config first, then the KUBECONFIG env var, and lastly ~/.kube/config
+	ModeAuto = "auto"
+	// ModeInCluster uses the service account of the pod
+	ModeInCluster = "in-cluster"
+	// ModeKubeconfig uses the kubeconfig file given by the flag, the KUBECONFIG env var, or ~/.kube/config
+	ModeKubeconfig = "kubeconfig"
+)
+
+// inClusterConfig is a variable to be replaced in tests
+var inClusterConfig = rest.InClusterConfig
 
 func homeDir() string {
 	if h := os.Getenv("HOME"); h != "" {
@@ -42,27 +71,163 @@ func homeDir() string {
 	return os.Getenv("USERPROFILE")
 }
 
-// SetKubeConfig declares the options and calls parse before using them to set kubeconfig variable
-func SetKubeConfig() {
+// SetKubeConfig declares the options and calls parse before using them to set kubeconfig variable.
+// The kubeconfig flag, if given, takes precedence over the others in the auto and kubeconfig modes.
+func SetKubeConfig() error {
+	AddFlags(flag.CommandLine)
+	flag.Parse()
+	return LoadKubeConfig()
+}
+
+// AddFlags declares the options of the cluster config in the flag set given, so that commands
+// with their own flag sets can share them
+func AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
+	fs.StringVar(&kubeconfigMode, "kubeconfig-mode", ModeAuto, fmt.Sprintf("how to obtain the cluster config: %s, %s, or %s", ModeAuto, ModeInCluster, ModeKubeconfig))
+	fs.Float64Var(&qps, "kube-api-qps", envFloat("EDGENET_KUBE_API_QPS", defaultQPS), "maximum queries per second to the API server")
+	fs.IntVar(&burst, "kube-api-burst", envInt("EDGENET_KUBE_API_BURST", defaultBurst), "maximum burst of queries to the API server")
+}
+
+// LoadKubeConfig resolves the cluster config, to be used to create clientsets, from the options once they are parsed
+func LoadKubeConfig() error {
+	var source string
+	var err error
+	restConfig, source, err = loadConfig(kubeconfigMode, kubeconfig)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	log.Printf("Cluster config loaded from %s", source)
+	return nil
+}
+
+// loadConfig selects the source of config according to the mode and returns the config along with its source
+func loadConfig(mode, path string) (*rest.Config, string, error) {
+	switch mode {
+	case ModeAuto, ModeInCluster, ModeKubeconfig:
+	default:
+		return nil, "", fmt.Errorf("unknown kubeconfig mode %q", mode)
+	}
+	if path != "" && mode != ModeInCluster {
+		config, err := clientcmd.BuildConfigFromFlags("", path)
+		return config, path, err
+	}
+	if mode != ModeKubeconfig {
+		config, err := inClusterConfig()
+		if err == nil {
+			return config, ModeInCluster, nil
+		}
+		if mode == ModeInCluster {
+			return nil, "", fmt.Errorf("in-cluster config unavailable: %s", err)
+		}
+	}
+	// The env var may contain a list of paths, clientcmd merges them as kubectl does
+	if env := os.Getenv(clientcmd.RecommendedConfigPathEnvVar); env != "" {
+		rules := &clientcmd.ClientConfigLoadingRules{Precedence: filepath.SplitList(env)}
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+		return config, env, err
+	}
 	if home := homeDir(); home != "" {
-		flag.StringVar(&kubeconfig, "kubeconfig", filepath.Join(home, ".kube", "config"), "")
-	} else {
-		flag.StringVar(&kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
+		path = filepath.Join(home, ".kube", "config")
+		if _, err := os.Stat(path); err == nil {
+			config, err := clientcmd.BuildConfigFromFlags("", path)
+			return config, path, err
+		}
 	}
-	flag.Parse()
+	return nil, "", fmt.Errorf("no cluster config found: not in a cluster, %s not set, and ~/.kube/config doesn't exist", clientcmd.RecommendedConfigPathEnvVar)
+}
+
+// getConfig returns the config resolved by SetKubeConfig, or builds it from the kubeconfig flag,
+// with the client-side rate limits applied
+func getConfig() (*rest.Config, error) {
+	config := restConfig
+	if config == nil {
+		var err error
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return withRateLimits(config, qps, burst), nil
+}
+
+// contextLoadingRules returns the rules to load the kubeconfig that has the contexts of the clusters, which is the file
+// given by the flag, otherwise those in the KUBECONFIG env var or ~/.kube/config as kubectl loads them
+func contextLoadingRules() *clientcmd.ClientConfigLoadingRules {
+	if kubeconfig != "" {
+		return &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig}
+	}
+	return clientcmd.NewDefaultClientConfigLoadingRules()
+}
+
+// Contexts returns the names of the contexts in the kubeconfig, each of which stands for a cluster such as the head
+// cluster or an edge cluster that the controllers can act on
+func Contexts() ([]string, error) {
+	kubeconfigLoaded, err := contextLoadingRules().Load()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range kubeconfigLoaded.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// getContextConfig returns the config of the context in the kubeconfig, the empty name stands for the current context
+func getContextConfig(name string) (*rest.Config, error) {
+	if name != "" {
+		names, err := Contexts()
+		if err != nil {
+			return nil, err
+		}
+		if i := sort.SearchStrings(names, name); i == len(names) || names[i] != name {
+			return nil, fmt.Errorf("context %q not found in the kubeconfig", name)
+		}
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(contextLoadingRules(), &clientcmd.ConfigOverrides{CurrentContext: name}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return withRateLimits(config, qps, burst), nil
+}
+
+// withRateLimits returns a copy of the config whose QPS and burst are set
+func withRateLimits(config *rest.Config, qps float64, burst int) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.QPS = float32(qps)
+	config.Burst = burst
+	return config
+}
+
+// envFloat reads a float from the env var, and returns the default if it is unset or malformed
+func envFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// envInt reads an integer from the env var, and returns the default if it is unset or malformed
+func envInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
 }
 
 // CreateEdgeNetClientSet generates the clientset to interact with custom resources of selective deployment, authority, user, and slice
 func CreateEdgeNetClientSet() (*edgenetclientset.Clientset, error) {
-	// Use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	// Use the config resolved from the cluster or the current context in kubeconfig
+	config, err := getConfig()
 	if err != nil {
 		log.Println(err.Error())
 		panic(err.Error())
 	}
 
 	// Create the clientset
-	clientset, err := edgenetclientset.NewForConfig(config)
+	clientset, err := CreateEdgeNetClientSetFromConfig(config)
 	if err != nil {
 		log.Println(err.Error())
 		panic(err.Error())
@@ -70,17 +235,22 @@ func CreateEdgeNetClientSet() (*edgenetclientset.Clientset, error) {
 	return clientset, err
 }
 
+// CreateEdgeNetClientSetFromConfig generates the clientset to interact with custom resources by the config given
+func CreateEdgeNetClientSetFromConfig(config *rest.Config) (*edgenetclientset.Clientset, error) {
+	return edgenetclientset.NewForConfig(config)
+}
+
 // CreateClientSet generates the clientset to interact with Kubernetes
 func CreateClientSet() (*kubernetes.Clientset, error) {
-	// Use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	// Use the config resolved from the cluster or the current context in kubeconfig
+	config, err := getConfig()
 	if err != nil {
 		log.Println(err.Error())
 		panic(err.Error())
 	}
 
 	// Create the clientset
-	clientset, err := kubernetes.NewForConfig(config)
+	clientset, err := CreateClientSetFromConfig(config)
 	if err != nil {
 		log.Println(err.Error())
 		panic(err.Error())
@@ -88,6 +258,31 @@ func CreateClientSet() (*kubernetes.Clientset, error) {
 	return clientset, err
 }
 
+// CreateClientSetForContext generates the clientset to interact with the cluster of the context in the kubeconfig, so that
+// a controller can act on several clusters. Unlike CreateClientSet, it returns the error as the context may be missing.
+func CreateClientSetForContext(name string) (*kubernetes.Clientset, error) {
+	config, err := getContextConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	return CreateClientSetFromConfig(config)
+}
+
+// CreateEdgeNetClientSetForContext generates the clientset to interact with custom resources in the cluster of the context
+// in the kubeconfig
+func CreateEdgeNetClientSetForContext(name string) (*edgenetclientset.Clientset, error) {
+	config, err := getContextConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	return CreateEdgeNetClientSetFromConfig(config)
+}
+
+// CreateClientSetFromConfig generates the clientset to interact with Kubernetes by the config given
+func CreateClientSetFromConfig(config *rest.Config) (*kubernetes.Clientset, error) {
+	return kubernetes.NewForConfig(config)
+}
+
 // CreateNameCheapClient generates the client to interact with Namecheap API
 func CreateNamecheapClient() (*namecheap.Client, error) {
 	apiuser, apitoken, username, err := config.GetNamecheapCredentials()
@@ -3,7 +3,11 @@ import (
 	"testing"
 	"path/filepath"
 	"flag"
-	
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"k8s.io/client-go/rest"
 )
 func TestHomeDir(t *testing.T) {
 	home := homeDir()
@@ -35,3 +39,223 @@ func TestSetKubeConfig(t *testing.T) {
 
 
 
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://%s:6443
+  name: test
+contexts:
+- context:
+    cluster: test
+    user: test
+  name: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test
+`
+
+func writeKubeconfig(t *testing.T, dir, host string) string {
+	path := filepath.Join(dir, host)
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf(testKubeconfig, host)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	flagPath := writeKubeconfig(t, dir, "flag")
+	envPath := writeKubeconfig(t, dir, "env")
+	home := filepath.Join(dir, "home")
+	os.MkdirAll(filepath.Join(home, ".kube"), 0700)
+	homePath := filepath.Join(home, ".kube", "config")
+	ioutil.WriteFile(homePath, []byte(fmt.Sprintf(testKubeconfig, "home")), 0600)
+	emptyHome := filepath.Join(dir, "empty")
+
+	defer func(home, env string) {
+		os.Setenv("HOME", home)
+		os.Setenv("KUBECONFIG", env)
+		inClusterConfig = rest.InClusterConfig
+	}(os.Getenv("HOME"), os.Getenv("KUBECONFIG"))
+	inCluster := func() (*rest.Config, error) { return &rest.Config{Host: "https://incluster:443"}, nil }
+	notInCluster := func() (*rest.Config, error) { return nil, rest.ErrNotInCluster }
+
+	cases := []struct {
+		name      string
+		mode      string
+		path      string
+		inCluster func() (*rest.Config, error)
+		env       string
+		home      string
+		host      string
+		fail      bool
+	}{
+		{"flag wins in auto", ModeAuto, flagPath, inCluster, envPath, home, "https://flag:6443", false},
+		{"in-cluster first", ModeAuto, "", inCluster, envPath, home, "https://incluster:443", false},
+		{"env fallback", ModeAuto, "", notInCluster, envPath, home, "https://env:6443", false},
+		{"home fallback", ModeAuto, "", notInCluster, "", home, "https://home:6443", false},
+		{"nothing found", ModeAuto, "", notInCluster, "", emptyHome, "", true},
+		{"forced in-cluster", ModeInCluster, flagPath, inCluster, envPath, home, "https://incluster:443", false},
+		{"forced in-cluster unavailable", ModeInCluster, "", notInCluster, envPath, home, "", true},
+		{"forced kubeconfig skips in-cluster", ModeKubeconfig, "", inCluster, envPath, home, "https://env:6443", false},
+		{"unknown mode", "remote", "", inCluster, envPath, home, "", true},
+	}
+	for _, c := range cases {
+		inClusterConfig = c.inCluster
+		os.Setenv("KUBECONFIG", c.env)
+		os.Setenv("HOME", c.home)
+		config, _, err := loadConfig(c.mode, c.path)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", c.name, err)
+			continue
+		}
+		if config.Host != c.host {
+			t.Errorf("%s: expected host %s, got %s", c.name, c.host, config.Host)
+		}
+	}
+}
+
+func TestCreateClientSetFromConfig(t *testing.T) {
+	config := &rest.Config{Host: "https://injected:6443"}
+	clientset, err := CreateClientSetFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host := clientset.CoreV1().RESTClient().Get().URL().Host; host != "injected:6443" {
+		t.Errorf("clientset doesn't use the injected config, host is %s", host)
+	}
+	edgenetClientset, err := CreateEdgeNetClientSetFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host := edgenetClientset.AppsV1alpha().RESTClient().Get().URL().Host; host != "injected:6443" {
+		t.Errorf("edgenet clientset doesn't use the injected config, host is %s", host)
+	}
+	// A config that cannot be used is reported rather than causing a panic
+	if _, err := CreateClientSetFromConfig(&rest.Config{Host: "https://injected:6443", TLSClientConfig: rest.TLSClientConfig{CAFile: "/nonexistent/ca.crt"}}); err == nil {
+		t.Error("expected an error for a missing CA file")
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	config := &rest.Config{Host: "https://injected:6443"}
+	limited := withRateLimits(config, 50, 100)
+	if limited.QPS != 50 || limited.Burst != 100 {
+		t.Errorf("rate limits not applied, QPS %v and burst %d", limited.QPS, limited.Burst)
+	}
+	if config.QPS != 0 || config.Burst != 0 {
+		t.Error("original config modified")
+	}
+
+	defer func(config *rest.Config) { restConfig = config }(restConfig)
+	restConfig = config
+	resolved, err := getConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.QPS != float32(qps) || resolved.Burst != burst {
+		t.Errorf("default rate limits not applied, QPS %v and burst %d", resolved.QPS, resolved.Burst)
+	}
+
+	os.Setenv("EDGENET_KUBE_API_QPS", "12.5")
+	os.Setenv("EDGENET_KUBE_API_BURST", "invalid")
+	defer os.Unsetenv("EDGENET_KUBE_API_QPS")
+	defer os.Unsetenv("EDGENET_KUBE_API_BURST")
+	if value := envFloat("EDGENET_KUBE_API_QPS", defaultQPS); value != 12.5 {
+		t.Errorf("expected QPS from env var, got %v", value)
+	}
+	if value := envInt("EDGENET_KUBE_API_BURST", defaultBurst); value != defaultBurst {
+		t.Errorf("expected default burst for malformed env var, got %v", value)
+	}
+}
+
+const testMultiContextKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://head:6443
+  name: head
+- cluster:
+    server: https://edge-paris:6443
+  name: edge-paris
+contexts:
+- context:
+    cluster: head
+    user: admin
+  name: head
+- context:
+    cluster: edge-paris
+    user: admin
+  name: edge-paris
+current-context: head
+users:
+- name: admin
+  user:
+    token: test
+`
+
+func TestCreateClientSetForContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(testMultiContextKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(path string) { kubeconfig = path }(kubeconfig)
+	kubeconfig = path
+
+	names, err := Contexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "edge-paris" || names[1] != "head" {
+		t.Errorf("contexts are %v", names)
+	}
+	cases := []struct {
+		context string
+		host    string
+	}{
+		{"head", "head:6443"},
+		{"edge-paris", "edge-paris:6443"},
+		// The empty name stands for the current context
+		{"", "head:6443"},
+	}
+	for _, c := range cases {
+		clientset, err := CreateClientSetForContext(c.context)
+		if err != nil {
+			t.Errorf("context %q: %s", c.context, err)
+			continue
+		}
+		if host := clientset.CoreV1().RESTClient().Get().URL().Host; host != c.host {
+			t.Errorf("context %q: clientset of %s, expected %s", c.context, host, c.host)
+		}
+		edgenetClientset, err := CreateEdgeNetClientSetForContext(c.context)
+		if err != nil {
+			t.Errorf("context %q: %s", c.context, err)
+			continue
+		}
+		if host := edgenetClientset.AppsV1alpha().RESTClient().Get().URL().Host; host != c.host {
+			t.Errorf("context %q: edgenet clientset of %s, expected %s", c.context, host, c.host)
+		}
+	}
+	// A missing context is reported rather than falling back to the current one
+	if _, err := CreateClientSetForContext("edge-tokyo"); err == nil {
+		t.Error("clientset created for a missing context")
+	}
+}
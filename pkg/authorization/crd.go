@@ -0,0 +1,69 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+// MissingCRDsError lists the resources that the cluster doesn't serve, as their CRDs aren't installed
+type MissingCRDsError struct {
+	Resources []schema.GroupVersionResource
+}
+
+func (e *MissingCRDsError) Error() string {
+	names := []string{}
+	for _, gvr := range e.Resources {
+		names = append(names, fmt.Sprintf("%s.%s/%s", gvr.Resource, gvr.Group, gvr.Version))
+	}
+	return fmt.Sprintf("CRDs not installed for %s, apply the EdgeNet CRDs before starting the controller", strings.Join(names, ", "))
+}
+
+// EnsureCRDs verifies through the discovery client that the cluster serves the resources given, so that a controller
+// fails at startup rather than its informer failing at runtime. It returns a MissingCRDsError listing those it doesn't serve.
+func EnsureCRDs(discoveryClient discovery.DiscoveryInterface, gvrs ...schema.GroupVersionResource) error {
+	served := map[schema.GroupVersion]map[string]bool{}
+	var missing []schema.GroupVersionResource
+	for _, gvr := range gvrs {
+		groupVersion := gvr.GroupVersion()
+		resources, ok := served[groupVersion]
+		if !ok {
+			resources = map[string]bool{}
+			resourceList, err := discoveryClient.ServerResourcesForGroupVersion(groupVersion.String())
+			if err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("resources of %s not discovered: %s", groupVersion, err)
+			} else if err == nil {
+				for _, resource := range resourceList.APIResources {
+					resources[resource.Name] = true
+				}
+			}
+			served[groupVersion] = resources
+		}
+		if !resources[gvr.Resource] {
+			missing = append(missing, gvr)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingCRDsError{Resources: missing}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package authorization
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestEnsureCRDs(t *testing.T) {
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: []*metav1.APIResourceList{
+		{GroupVersion: "apps.edgenet.io/v1alpha", APIResources: []metav1.APIResource{{Name: "teams"}, {Name: "authorities"}}},
+	}}}
+	teams := schema.GroupVersionResource{Group: "apps.edgenet.io", Version: "v1alpha", Resource: "teams"}
+	authorities := schema.GroupVersionResource{Group: "apps.edgenet.io", Version: "v1alpha", Resource: "authorities"}
+	slices := schema.GroupVersionResource{Group: "apps.edgenet.io", Version: "v1alpha", Resource: "slices"}
+	users := schema.GroupVersionResource{Group: "apps.edgenet.io", Version: "v1alpha", Resource: "users"}
+
+	if err := EnsureCRDs(discoveryClient, teams, authorities); err != nil {
+		t.Errorf("installed CRDs reported missing: %s", err)
+	}
+	err := EnsureCRDs(discoveryClient, teams, slices, users)
+	missingErr, ok := err.(*MissingCRDsError)
+	if !ok {
+		t.Fatalf("error is %v, expected the missing CRDs", err)
+	}
+	if len(missingErr.Resources) != 2 || missingErr.Resources[0] != slices || missingErr.Resources[1] != users {
+		t.Errorf("missing resources are %v, expected slices and users", missingErr.Resources)
+	}
+	if message := err.Error(); !strings.Contains(message, "slices.apps.edgenet.io/v1alpha") || !strings.Contains(message, "users.apps.edgenet.io/v1alpha") {
+		t.Errorf("error message %q doesn't list the missing CRDs", message)
+	}
+	// The version that the cluster doesn't serve at all fails the check as well
+	if err := EnsureCRDs(discoveryClient, schema.GroupVersionResource{Group: "apps.edgenet.io", Version: "v1", Resource: "teams"}); err == nil {
+		t.Error("resource of a version not served reported installed")
+	}
+}
@@ -33,6 +33,7 @@ type AppsV1alphaInterface interface {
 	AuthorityRequestsGetter
 	EmailVerificationsGetter
 	NodeContributionsGetter
+	PermissionsGetter
 	SelectiveDeploymentsGetter
 	SlicesGetter
 	TeamsGetter
@@ -66,6 +67,10 @@ func (c *AppsV1alphaClient) NodeContributions(namespace string) NodeContribution
 	return newNodeContributions(c, namespace)
 }
 
+func (c *AppsV1alphaClient) Permissions(namespace string) PermissionInterface {
+	return newPermissions(c, namespace)
+}
+
 func (c *AppsV1alphaClient) SelectiveDeployments(namespace string) SelectiveDeploymentInterface {
 	return newSelectiveDeployments(c, namespace)
 }
@@ -63,6 +63,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Apps().V1alpha().EmailVerifications().Informer()}, nil
 	case v1alpha.SchemeGroupVersion.WithResource("nodecontributions"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Apps().V1alpha().NodeContributions().Informer()}, nil
+	case v1alpha.SchemeGroupVersion.WithResource("permissions"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Apps().V1alpha().Permissions().Informer()}, nil
 	case v1alpha.SchemeGroupVersion.WithResource("selectivedeployments"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Apps().V1alpha().SelectiveDeployments().Informer()}, nil
 	case v1alpha.SchemeGroupVersion.WithResource("slices"):
@@ -0,0 +1,140 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EnvPrefix starts the names of the environment variables that override the settings, such as EDGENET_RESYNC_PERIOD
+// for resyncPeriod and EDGENET_MAILER_AUDIT_ADDRESS for the auditAddress of mailer
+const EnvPrefix = "EDGENET"
+
+// lookupEnv returns the value of the environment variable, which tests replace
+var lookupEnv = os.LookupEnv
+
+var durationType = reflect.TypeOf(metav1.Duration{})
+
+// overlayEnv sets the settings for which an environment variable is set to its value, so that the environment takes
+// precedence over the config file. The lists are separated by commas, as the pairs of the maps such as a=1,b=2 are.
+func overlayEnv(config *Config) error {
+	return overlayStruct(reflect.ValueOf(config).Elem(), EnvPrefix)
+}
+
+func overlayStruct(value reflect.Value, prefix string) error {
+	for i := 0; i < value.NumField(); i++ {
+		key := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		name := fmt.Sprintf("%s_%s", prefix, envName(key))
+		field := value.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != durationType {
+			if err := overlayStruct(field, name); err != nil {
+				return err
+			}
+			continue
+		}
+		raw, ok := lookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, strings.TrimSpace(raw)); err != nil {
+			return fmt.Errorf("environment variable %s=%q: %s", name, raw, err)
+		}
+	}
+	return nil
+}
+
+// setField parses the value by the type of the setting
+func setField(field reflect.Value, raw string) error {
+	switch {
+	case field.Type() == durationType:
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("not a duration such as 90s or 10m")
+		}
+		field.Set(reflect.ValueOf(metav1.Duration{Duration: duration}))
+	case field.Kind() == reflect.String:
+		field.SetString(raw)
+	case field.Kind() == reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("not a boolean such as true or false")
+		}
+		field.SetBool(parsed)
+	case field.Kind() == reflect.Int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("not an integer")
+		}
+		field.SetInt(int64(parsed))
+	case field.Kind() == reflect.Float32:
+		parsed, err := strconv.ParseFloat(raw, 32)
+		if err != nil {
+			return fmt.Errorf("not a number")
+		}
+		field.SetFloat(parsed)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case field.Kind() == reflect.Map && field.Type().Key().Kind() == reflect.String && field.Type().Elem().Kind() == reflect.Int:
+		items := map[string]int{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			pair := strings.SplitN(item, "=", 2)
+			if len(pair) != 2 {
+				return fmt.Errorf("%q is not a pair such as key=1", item)
+			}
+			parsed, err := strconv.Atoi(strings.TrimSpace(pair[1]))
+			if err != nil {
+				return fmt.Errorf("value of %s is not an integer", pair[0])
+			}
+			items[strings.TrimSpace(pair[0])] = parsed
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("settings of type %s cannot be set from the environment", field.Type())
+	}
+	return nil
+}
+
+// envName turns the key of a setting into the upper snake case of the environment variables, such as
+// REVERSE_GEOCODING_URL for reverseGeocodingURL
+func envName(key string) string {
+	runes := []rune(key)
+	var name strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			name.WriteRune('_')
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return name.String()
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setEnv replaces the environment by the variables given until the function returned is called
+func setEnv(env map[string]string) func() {
+	lookup := lookupEnv
+	lookupEnv = func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	return func() { lookupEnv = lookup }
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	defer setEnv(map[string]string{
+		"EDGENET_RESYNC_PERIOD":                     "2m",
+		"EDGENET_WORKERS":                           " 8 ",
+		"EDGENET_DEFAULT_ROLES":                     "User, Tech",
+		"EDGENET_MAILER_DISABLED":                   "true",
+		"EDGENET_MAILER_AUDIT_ADDRESS":              "audit@edge-net.org",
+		"EDGENET_MAILER_TEMPLATE_RATE_LIMITS":       "team-creation=5, slice-reminder=0",
+		"EDGENET_GEOLOCATION_QPS":                   "2.5",
+		"EDGENET_GEOLOCATION_REVERSE_GEOCODING_URL": "https://nominatim.edge-net.org",
+	})()
+	config, err := Parse([]byte("resyncPeriod: 1h\nworkers: 4\nmailer:\n  auditAddress: file@edge-net.org\n  greylistRetries: 5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Default()
+	expected.ResyncPeriod.Duration = 2 * time.Minute
+	expected.Workers = 8
+	expected.DefaultRoles = []string{"User", "Tech"}
+	expected.Mailer.Disabled = true
+	expected.Mailer.AuditAddress = "audit@edge-net.org"
+	expected.Mailer.TemplateRateLimits = map[string]int{"team-creation": 5, "slice-reminder": 0}
+	// The file sets what the environment leaves out
+	expected.Mailer.GreylistRetries = 5
+	expected.Geolocation.QPS = 2.5
+	expected.Geolocation.ReverseGeocodingURL = "https://nominatim.edge-net.org"
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("config is %+v, expected %+v", config, expected)
+	}
+	// The environment applies without a file too
+	config, err = Load("")
+	if err != nil || config.Workers != 8 {
+		t.Errorf("environment not applied without a file: %+v, %v", config, err)
+	}
+}
+
+func TestInvalidEnv(t *testing.T) {
+	cases := []struct {
+		name, value, expected string
+	}{
+		{"EDGENET_RESYNC_PERIOD", "10", "EDGENET_RESYNC_PERIOD=\"10\": not a duration"},
+		{"EDGENET_WORKERS", "many", "EDGENET_WORKERS=\"many\": not an integer"},
+		{"EDGENET_MAILER_DISABLED", "maybe", "EDGENET_MAILER_DISABLED=\"maybe\": not a boolean"},
+		{"EDGENET_GEOLOCATION_QPS", "fast", "EDGENET_GEOLOCATION_QPS=\"fast\": not a number"},
+		{"EDGENET_MAILER_TEMPLATE_RATE_LIMITS", "team-creation", "\"team-creation\" is not a pair"},
+		{"EDGENET_MAILER_TEMPLATE_RATE_LIMITS", "team-creation=five", "value of team-creation is not an integer"},
+		// The values that parse are still validated
+		{"EDGENET_WORKERS", "0", "workers 0 is less than 1"},
+	}
+	for _, c := range cases {
+		restore := setEnv(map[string]string{c.name: c.value})
+		if _, err := Parse(nil); err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%s=%s: expected an error containing %q, got %v", c.name, c.value, c.expected, err)
+		}
+		restore()
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	for key, expected := range map[string]string{
+		"workers":             "WORKERS",
+		"resyncPeriod":        "RESYNC_PERIOD",
+		"qps":                 "QPS",
+		"reverseGeocodingURL": "REVERSE_GEOCODING_URL",
+	} {
+		if name := envName(key); name != expected {
+			t.Errorf("environment variable of %s is %s, expected %s", key, name, expected)
+		}
+	}
+}
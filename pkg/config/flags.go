@@ -0,0 +1,175 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setting ties a flag of the command line to the field of the config that it overrides
+type setting struct {
+	name  string
+	usage string
+	field func(config *Config) interface{}
+}
+
+// settings are the fields of the config that the command line can set, the flags keep the names that the commands took
+// before the config file
+var settings = []setting{
+	{"resync-period", "period to re-validate the child resources of teams, authorities, and permissions, 0 to disable",
+		func(c *Config) interface{} { return &c.ResyncPeriod }},
+	{"workers", "number of teams to process in parallel",
+		func(c *Config) interface{} { return &c.Workers }},
+	{"default-roles", "comma-separated roles of the users who register without any in an authority that doesn't set its own, out of Admin, Manager, Tech, and User",
+		func(c *Config) interface{} { return &c.DefaultRoles }},
+	{"email-disabled", "log the emails rather than sending them, as MAILER_DISABLED=true does",
+		func(c *Config) interface{} { return &c.Mailer.Disabled }},
+	{"email-template-dir", "directory of the email templates, each of which is named after the email it renders",
+		func(c *Config) interface{} { return &c.Mailer.TemplateDir }},
+	{"email-audit-address", "mailbox that receives a blind copy of every email, empty to disable",
+		func(c *Config) interface{} { return &c.Mailer.AuditAddress }},
+	{"email-greylist-delay", "delay before retrying the emails that the SMTP server rejects temporarily with a 4xx reply, such as by greylisting",
+		func(c *Config) interface{} { return &c.Mailer.GreylistDelay }},
+	{"email-greylist-retries", "number of retries of the emails that the SMTP server rejects temporarily when there is no outbox, 0 to not retry",
+		func(c *Config) interface{} { return &c.Mailer.GreylistRetries }},
+	{"email-ping-timeout", "maximum time for the SMTP server to connect and reply to the readiness check on /readyz of the metrics port",
+		func(c *Config) interface{} { return &c.Mailer.PingTimeout }},
+	{"email-rate-limit", "number of emails of each template that a recipient gets within the rate limit period at most, the excess is deferred, 0 for no limit",
+		func(c *Config) interface{} { return &c.Mailer.RateLimit }},
+	{"email-rate-limit-period", "period of the email rate limit",
+		func(c *Config) interface{} { return &c.Mailer.RateLimitPeriod }},
+	{"email-template-rate-limits", "email rate limits that override the default one by template, such as team-creation=5, 0 for no limit",
+		func(c *Config) interface{} { return &c.Mailer.TemplateRateLimits }},
+	{"geolocation-qps", "geolocation lookups per second shared by all nodes, 0 to disable the limit",
+		func(c *Config) interface{} { return &c.Geolocation.QPS }},
+	{"geolocation-burst", "geolocation lookups allowed at once before the limit applies",
+		func(c *Config) interface{} { return &c.Geolocation.Burst }},
+	{"reverse-geocoding-url", "URL of the Nominatim server that names the city and the country of the coordinates the geo-IP database returns, empty to disable",
+		func(c *Config) interface{} { return &c.Geolocation.ReverseGeocodingURL }},
+	{"allowed-countries", "comma-separated ISO codes of the countries where the nodes take pods, the others get tainted, empty to allow all countries",
+		func(c *Config) interface{} { return &c.Geolocation.AllowedCountries }},
+}
+
+// Flags holds the path of the config file and the settings given on the command line
+type Flags struct {
+	path   string
+	values []*flagValue
+}
+
+// flagValue parses a flag into the field of the config as the environment variables are parsed, and records whether
+// the command line sets it
+type flagValue struct {
+	setting setting
+	field   reflect.Value
+	set     bool
+}
+
+// AddFlags declares the flag of the config file and those of the settings in the flag set given, the defaults of the
+// settings are those of the config
+func AddFlags(fs *flag.FlagSet) *Flags {
+	flags := &Flags{}
+	fs.StringVar(&flags.path, "config", "", fmt.Sprintf("YAML or JSON file of the controller settings, which the %s_* environment variables and the flags set on the command line override, %s if empty", EnvPrefix, PathEnv))
+	defaults := Default()
+	for _, setting := range settings {
+		value := &flagValue{setting: setting, field: reflect.ValueOf(setting.field(defaults)).Elem()}
+		flags.values = append(flags.values, value)
+		if value.field.Kind() == reflect.Bool {
+			fs.Var(boolFlagValue{value}, setting.name, setting.usage)
+		} else {
+			fs.Var(value, setting.name, setting.usage)
+		}
+	}
+	return flags
+}
+
+// Load reads the config file that the flag or the environment gives, and overlays the environment variables and then
+// the flags set on the command line on it before validating the result
+func (f *Flags) Load() (*Config, error) {
+	path := Path(f.path)
+	config, err := read(path)
+	if err != nil && path != "" {
+		return nil, fmt.Errorf("config file %s: %s", path, err)
+	} else if err != nil {
+		return nil, err
+	}
+	for _, value := range f.values {
+		if value.set {
+			reflect.ValueOf(value.setting.field(config)).Elem().Set(value.field)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (v *flagValue) Set(raw string) error {
+	if err := setField(v.field, strings.TrimSpace(raw)); err != nil {
+		return err
+	}
+	v.set = true
+	return nil
+}
+
+func (v *flagValue) String() string {
+	// The flag package formats the zero value of the flag type to tell whether the default is worth printing
+	if v == nil || !v.field.IsValid() {
+		return ""
+	}
+	switch field := v.field.Interface().(type) {
+	case []string:
+		return strings.Join(field, ",")
+	case metav1.Duration:
+		return field.Duration.String()
+	case map[string]int:
+		pairs := []string{}
+		for key, value := range field {
+			pairs = append(pairs, fmt.Sprintf("%s=%d", key, value))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+	return fmt.Sprint(v.field.Interface())
+}
+
+// boolFlagValue lets the boolean settings be set by the name of their flags alone
+type boolFlagValue struct {
+	*flagValue
+}
+
+func (v boolFlagValue) IsBoolFlag() bool {
+	return true
+}
+
+// Type names the kind of the setting in the usage of the commands that take the flags through pflag
+func (v *flagValue) Type() string {
+	switch v.field.Interface().(type) {
+	case metav1.Duration:
+		return "duration"
+	case []string:
+		return "strings"
+	case map[string]int:
+		return "stringToInt"
+	}
+	return v.field.Kind().String()
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlagsOverrideFileAndEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "edgenet.yaml")
+	if err := ioutil.WriteFile(path, []byte("workers: 4\nresyncPeriod: 1h\nmailer:\n  greylistRetries: 5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer setEnv(map[string]string{"EDGENET_RESYNC_PERIOD": "2m", "EDGENET_MAILER_RATE_LIMIT": "3"})()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := AddFlags(fs)
+	if err := fs.Parse([]string{"-config", path, "-workers", "8", "-email-disabled", "-email-rate-limit=6",
+		"-allowed-countries", "FR,DE", "-email-template-rate-limits", "team-creation=5"}); err != nil {
+		t.Fatal(err)
+	}
+	config, err := flags.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Default()
+	// The flags set on the command line take precedence over the environment and the file
+	expected.Workers = 8
+	expected.Mailer.Disabled = true
+	expected.Mailer.RateLimit = 6
+	expected.Geolocation.AllowedCountries = []string{"FR", "DE"}
+	expected.Mailer.TemplateRateLimits = map[string]int{"team-creation": 5}
+	// The environment and the file set what the command line leaves out
+	expected.ResyncPeriod.Duration = 2 * time.Minute
+	expected.Mailer.GreylistRetries = 5
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("config is %+v, expected %+v", config, expected)
+	}
+}
+
+func TestFlagDefaults(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := AddFlags(fs)
+	// The flags take the defaults of the config rather than defining their own
+	for name, expected := range map[string]string{
+		"resync-period":        "10m0s",
+		"workers":              "1",
+		"default-roles":        "User",
+		"email-greylist-delay": "5m0s",
+		"geolocation-qps":      "10",
+		"email-disabled":       "false",
+	} {
+		if value := fs.Lookup(name).DefValue; value != expected {
+			t.Errorf("default of %s is %q, expected %q", name, value, expected)
+		}
+	}
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if config, err := flags.Load(); err != nil || !reflect.DeepEqual(config, Default()) {
+		t.Errorf("config without file, environment, nor flags is %+v, %v", config, err)
+	}
+}
+
+func TestInvalidFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	AddFlags(fs)
+	if err := fs.Parse([]string{"-workers", "many"}); err == nil || !strings.Contains(err.Error(), "not an integer") {
+		t.Errorf("expected an error about the integer, got %v", err)
+	}
+	// The flags that parse are still validated along with the file
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := AddFlags(fs)
+	if err := fs.Parse([]string{"-workers", "0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flags.Load(); err == nil || !strings.Contains(err.Error(), "workers") {
+		t.Errorf("expected an error about the workers, got %v", err)
+	}
+}
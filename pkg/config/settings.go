@@ -0,0 +1,200 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"net/url"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// PathEnv is the environment variable of the config file path, which the flag overrides
+const PathEnv = "EDGENET_CONFIG"
+
+// Config holds the settings of the controllers that a YAML or JSON file provides, the environment variables and then
+// the flags set on the command line take precedence over them
+type Config struct {
+	// ResyncPeriod is the period to re-validate the child resources of teams, authorities, and permissions, 0 to disable
+	ResyncPeriod metav1.Duration `json:"resyncPeriod"`
+	// Workers is the number of objects to process in parallel
+	Workers int `json:"workers"`
+	// DefaultRoles are the roles of the users who register without any in an authority that doesn't set its own
+	DefaultRoles []string    `json:"defaultRoles"`
+	Mailer       Mailer      `json:"mailer"`
+	Geolocation  Geolocation `json:"geolocation"`
+}
+
+// Mailer holds the settings of the emails
+type Mailer struct {
+	// Disabled logs the emails rather than sending them
+	Disabled bool `json:"disabled"`
+	// TemplateDir is the directory of the email templates
+	TemplateDir string `json:"templateDir"`
+	// AuditAddress receives a blind copy of every email, empty to disable
+	AuditAddress string `json:"auditAddress"`
+	// GreylistDelay and GreylistRetries tell how to retry the emails that the SMTP server rejects temporarily
+	GreylistDelay   metav1.Duration `json:"greylistDelay"`
+	GreylistRetries int             `json:"greylistRetries"`
+	// PingTimeout bounds the readiness check of the SMTP server
+	PingTimeout metav1.Duration `json:"pingTimeout"`
+	// RateLimit is the number of emails of each template that a recipient gets within RateLimitPeriod at most, 0 for
+	// no limit, and TemplateRateLimits override it by template
+	RateLimit          int             `json:"rateLimit"`
+	RateLimitPeriod    metav1.Duration `json:"rateLimitPeriod"`
+	TemplateRateLimits map[string]int  `json:"templateRateLimits"`
+}
+
+// Geolocation holds the settings of the geolocation lookups of the nodes
+type Geolocation struct {
+	// QPS is the rate of the lookups shared by all nodes, 0 to disable the limit, and Burst the lookups allowed at once
+	QPS   float32 `json:"qps"`
+	Burst int     `json:"burst"`
+	// ReverseGeocodingURL is the Nominatim server that names the places of the coordinates, empty to disable
+	ReverseGeocodingURL string `json:"reverseGeocodingURL"`
+	// AllowedCountries are the ISO codes of the countries where the nodes take pods, empty to allow all countries
+	AllowedCountries []string `json:"allowedCountries"`
+}
+
+// Default returns the config with the settings that apply when neither a file nor a flag sets them
+func Default() *Config {
+	return &Config{
+		ResyncPeriod: metav1.Duration{Duration: 10 * time.Minute},
+		Workers:      1,
+		DefaultRoles: []string{"User"},
+		Mailer: Mailer{
+			TemplateDir:     "../../assets/templates/email",
+			GreylistDelay:   metav1.Duration{Duration: 5 * time.Minute},
+			GreylistRetries: 3,
+			PingTimeout:     metav1.Duration{Duration: 5 * time.Second},
+			RateLimitPeriod: metav1.Duration{Duration: time.Minute},
+		},
+		Geolocation: Geolocation{QPS: 10, Burst: 10},
+	}
+}
+
+// Path returns the path of the config file from the flag given, or from the environment if the flag is empty
+func Path(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(PathEnv)
+}
+
+// Load reads the YAML or JSON config file, if the path isn't empty, fills the settings that it leaves out by the defaults,
+// overlays the environment variables on them, and validates the result. The unknown settings are rejected so that a
+// misspelled one doesn't go unnoticed.
+func Load(path string) (*Config, error) {
+	config, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Parse does what Load does with the content of a config file
+func Parse(data []byte) (*Config, error) {
+	config, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// read does what Load does but the validation, which waits for the flags to be overlaid
+func read(path string) (*Config, error) {
+	if path == "" {
+		return decode(nil)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// decode fills the settings that the content leaves out by the defaults and overlays the environment variables on them
+func decode(data []byte) (*Config, error) {
+	config := Default()
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("config cannot be parsed: %s", err)
+	}
+	if err := overlayEnv(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate returns an error that tells the first setting out of its range
+func (c *Config) Validate() error {
+	switch {
+	case c.ResyncPeriod.Duration < 0:
+		return fmt.Errorf("resyncPeriod %s is negative", c.ResyncPeriod.Duration)
+	case c.Workers < 1:
+		return fmt.Errorf("workers %d is less than 1", c.Workers)
+	case len(c.DefaultRoles) == 0:
+		return fmt.Errorf("defaultRoles is empty")
+	case c.Mailer.TemplateDir == "":
+		return fmt.Errorf("mailer.templateDir is empty")
+	case c.Mailer.GreylistDelay.Duration < 0:
+		return fmt.Errorf("mailer.greylistDelay %s is negative", c.Mailer.GreylistDelay.Duration)
+	case c.Mailer.GreylistRetries < 0:
+		return fmt.Errorf("mailer.greylistRetries %d is negative", c.Mailer.GreylistRetries)
+	case c.Mailer.PingTimeout.Duration <= 0:
+		return fmt.Errorf("mailer.pingTimeout %s is not positive", c.Mailer.PingTimeout.Duration)
+	case c.Mailer.RateLimit < 0:
+		return fmt.Errorf("mailer.rateLimit %d is negative", c.Mailer.RateLimit)
+	case c.Mailer.RateLimitPeriod.Duration <= 0:
+		return fmt.Errorf("mailer.rateLimitPeriod %s is not positive", c.Mailer.RateLimitPeriod.Duration)
+	case c.Geolocation.QPS < 0:
+		return fmt.Errorf("geolocation.qps %g is negative", c.Geolocation.QPS)
+	case c.Geolocation.QPS > 0 && c.Geolocation.Burst < 1:
+		return fmt.Errorf("geolocation.burst %d is less than 1 while the rate is limited", c.Geolocation.Burst)
+	}
+	if c.Mailer.AuditAddress != "" {
+		if _, err := mail.ParseAddress(c.Mailer.AuditAddress); err != nil {
+			return fmt.Errorf("mailer.auditAddress %q is invalid: %s", c.Mailer.AuditAddress, err)
+		}
+	}
+	if c.Geolocation.ReverseGeocodingURL != "" {
+		if parsed, err := url.Parse(c.Geolocation.ReverseGeocodingURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("geolocation.reverseGeocodingURL %q is not an absolute URL", c.Geolocation.ReverseGeocodingURL)
+		}
+	}
+	for template, limit := range c.Mailer.TemplateRateLimits {
+		if limit < 0 {
+			return fmt.Errorf("mailer.templateRateLimits of %s %d is negative", template, limit)
+		}
+	}
+	for _, country := range c.Geolocation.AllowedCountries {
+		if len(country) != 2 {
+			return fmt.Errorf("geolocation.allowedCountries %q is not an ISO code of two letters", country)
+		}
+	}
+	return nil
+}
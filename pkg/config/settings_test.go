@@ -0,0 +1,94 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFillsDefaults(t *testing.T) {
+	config, err := Parse([]byte("workers: 4\nmailer:\n  auditAddress: audit@edge-net.org\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Workers != 4 || config.Mailer.AuditAddress != "audit@edge-net.org" {
+		t.Errorf("settings of the file not loaded: %+v", config)
+	}
+	// The settings that the file leaves out, including those of the sections it sets, keep their defaults
+	expected := Default()
+	expected.Workers = 4
+	expected.Mailer.AuditAddress = "audit@edge-net.org"
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("config is %+v, expected %+v", config, expected)
+	}
+	// A setting given as its zero value overrides the default
+	if config, err := Parse([]byte(`{"resyncPeriod": "0s", "geolocation": {"qps": 0, "burst": 0}}`)); err != nil {
+		t.Error(err)
+	} else if config.ResyncPeriod.Duration != 0 || config.Geolocation.QPS != 0 {
+		t.Errorf("zero settings replaced by the defaults: %+v", config)
+	}
+	if config, err := Parse([]byte("resyncPeriod: 90s\n")); err != nil || config.ResyncPeriod.Duration != 90*time.Second {
+		t.Errorf("resync period not parsed: %v, %v", config, err)
+	}
+}
+
+func TestParseRejectsInvalidConfig(t *testing.T) {
+	cases := []struct {
+		data     string
+		expected string
+	}{
+		{"workers: 0\n", "workers"},
+		{"resyncPeriod: -1m\n", "resyncPeriod"},
+		{"resyncPeriod: ten minutes\n", "parsed"},
+		{"defaultRoles: []\n", "defaultRoles"},
+		{"mailer:\n  templateDir: \"\"\n", "templateDir"},
+		{"mailer:\n  auditAddress: not an address\n", "auditAddress"},
+		{"mailer:\n  greylistRetries: -1\n", "greylistRetries"},
+		{"mailer:\n  pingTimeout: 0s\n", "pingTimeout"},
+		{"mailer:\n  rateLimit: -1\n", "rateLimit"},
+		{"mailer:\n  templateRateLimits: {team-creation: -2}\n", "templateRateLimits"},
+		{"geolocation:\n  burst: 0\n", "burst"},
+		{"geolocation:\n  reverseGeocodingURL: nominatim\n", "reverseGeocodingURL"},
+		{"geolocation:\n  allowedCountries: [France]\n", "allowedCountries"},
+		// A misspelled setting would otherwise be left out silently
+		{"worker: 2\n", "parsed"},
+	}
+	for _, c := range cases {
+		if _, err := Parse([]byte(c.data)); err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("config %q: expected an error about %s, got %v", c.data, c.expected, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "edgenet.yaml")
+	if err := ioutil.WriteFile(path, []byte("geolocation:\n  allowedCountries: [FR, DE]\nmailer:\n  templateRateLimits: {team-creation: 5, slice-reminder: 1}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.Geolocation.AllowedCountries, []string{"FR", "DE"}) || config.Workers != 1 ||
+		!reflect.DeepEqual(config.Mailer.TemplateRateLimits, map[string]int{"team-creation": 5, "slice-reminder": 1}) {
+		t.Errorf("config is %+v", config)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("missing config file loaded")
+	}
+
+	defer os.Setenv(PathEnv, os.Getenv(PathEnv))
+	os.Setenv(PathEnv, path)
+	if Path("") != path || Path("other.yaml") != "other.yaml" {
+		t.Errorf("path is %s from the environment, %s from the flag", Path(""), Path("other.yaml"))
+	}
+}
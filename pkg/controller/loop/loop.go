@@ -0,0 +1,171 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package loop provides the parts of the control loop that the controllers share
+package loop
+
+import (
+	"expvar"
+	"flag"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"time"
+
+	"edgenet/pkg/config"
+	"edgenet/pkg/mailer"
+	"edgenet/pkg/registration"
+
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// resyncPeriod makes the informers of the controllers whose handlers reconcile the child resources redeliver all
+// objects periodically, so that the child resources deleted or changed out-of-band get rebuilt
+var resyncPeriod = 10 * time.Minute
+
+// SetResyncPeriod configures the period of the informers to redeliver all objects, 0 to disable
+func SetResyncPeriod(period time.Duration) {
+	resyncPeriod = period
+}
+
+// ResyncPeriod returns the period of the informers to redeliver all objects
+func ResyncPeriod() time.Duration {
+	return resyncPeriod
+}
+
+// resyncJitter is the window over which the objects redelivered on resync get spread, so that the handlers don't
+// stampede the API server and the mailer at each resync period
+var resyncJitter = 30 * time.Second
+
+// SetResyncJitter configures the window over which the objects redelivered on resync get spread, 0 to disable
+func SetResyncJitter(window time.Duration) {
+	resyncJitter = window
+}
+
+// cacheSyncTimeout bounds the wait for the caches of the controllers to sync, so that a controller that cannot reach
+// the API server exits to be restarted rather than hanging without any sign of it
+var cacheSyncTimeout = 2 * time.Minute
+
+// SetCacheSyncTimeout configures the maximum time to wait for the caches to sync, 0 to wait forever
+func SetCacheSyncTimeout(timeout time.Duration) {
+	cacheSyncTimeout = timeout
+}
+
+// AddFlags declares the options of the control loop in the flag set given, so that the commands of the controllers
+// share them
+func AddFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&resyncJitter, "resync-jitter", resyncJitter, "window over which the objects redelivered on resync get spread, 0 to disable")
+	fs.DurationVar(&cacheSyncTimeout, "cache-sync-timeout", cacheSyncTimeout, "maximum time to wait for the cache to sync, 0 to wait forever")
+}
+
+// Configure applies the settings of the config that the controllers share, which are the resync period, the default
+// roles of the users, and those of the emails
+func Configure(settings *config.Config) error {
+	if err := registration.SetDefaultRoles(settings.DefaultRoles); err != nil {
+		return err
+	}
+	SetResyncPeriod(settings.ResyncPeriod.Duration)
+	mailer.SetTemplateDir(settings.Mailer.TemplateDir)
+	mailer.SetAuditAddress(settings.Mailer.AuditAddress)
+	mailer.SetGreylistRetry(settings.Mailer.GreylistDelay.Duration, settings.Mailer.GreylistRetries)
+	mailer.SetPingTimeout(settings.Mailer.PingTimeout.Duration)
+	mailer.SetRateLimit(settings.Mailer.RateLimit, settings.Mailer.RateLimitPeriod.Duration, settings.Mailer.TemplateRateLimits)
+	// The emails stay disabled when MAILER_DISABLED=true disables them
+	if settings.Mailer.Disabled {
+		mailer.SetEnabled(false)
+	}
+	return nil
+}
+
+// IsResync tells whether the update is the redelivery of the same version of the object on resync
+func IsResync(oldObj, newObj interface{}) bool {
+	oldObject, err := meta.Accessor(oldObj)
+	if err != nil {
+		return false
+	}
+	newObject, err := meta.Accessor(newObj)
+	if err != nil {
+		return false
+	}
+	return oldObject.GetResourceVersion() == newObject.GetResourceVersion()
+}
+
+// AddWithJitter adds the object redelivered on resync to the queue after a random delay within the jitter window
+func AddWithJitter(queue workqueue.DelayingInterface, item interface{}) {
+	addWithJitter(queue, item, resyncJitter)
+}
+
+// addWithJitter adds the item to the queue after a random delay within the window
+func addWithJitter(queue workqueue.DelayingInterface, item interface{}, window time.Duration) {
+	if window <= 0 {
+		queue.Add(item)
+		return
+	}
+	queue.AddAfter(item, time.Duration(rand.Int63n(int64(window))))
+}
+
+// WaitForCacheSync waits for the caches to sync, and exits the process to be restarted if they don't sync within the
+// cache sync timeout. It returns false if the stop channel closes in the meantime.
+func WaitForCacheSync(logger *log.Entry, stopCh <-chan struct{}, cacheSyncs ...cache.InformerSynced) bool {
+	if waitForCacheSync(stopCh, cacheSyncTimeout, cacheSyncs...) {
+		return true
+	}
+	select {
+	case <-stopCh:
+	default:
+		logger.Fatalf("run: cache couldn't sync in %s", cacheSyncTimeout)
+	}
+	return false
+}
+
+// waitForCacheSync waits for the caches to sync until the stop channel closes or the timeout expires, zero timeout waits forever
+func waitForCacheSync(stopCh <-chan struct{}, timeout time.Duration, cacheSyncs ...cache.InformerSynced) bool {
+	if timeout <= 0 {
+		return cache.WaitForCacheSync(stopCh, cacheSyncs...)
+	}
+	syncStopCh := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(syncStopCh)
+		select {
+		case <-stopCh:
+		case <-time.After(timeout):
+		case <-done:
+		}
+	}()
+	return cache.WaitForCacheSync(syncStopCh, cacheSyncs...)
+}
+
+// panics counts the panics of the handlers that the workers have recovered from, by controller
+var panics = expvar.NewMap("edgenet_controller_panics_total")
+
+// Recover, deferred by the worker in processing an item, recovers from a panic of the handler so that the worker goes
+// on with the next item rather than exiting. It logs the panic along with the key of the item and the stack, counts it
+// by controller, and passes it as an error to the function given, which requeues the item.
+func Recover(logger *log.Entry, controller, key string, failed func(err error)) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	panics.Add(controller, 1)
+	err := fmt.Errorf("handler panicked: %v", recovered)
+	logger.WithFields(log.Fields{"key": key, "stack": string(debug.Stack())}).Errorf("Controller.processNextItem: %s", err)
+	failed(err)
+}
@@ -0,0 +1,139 @@
+package loop
+
+import (
+	"expvar"
+	"strings"
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/config"
+	"edgenet/pkg/registration"
+
+	log "github.com/Sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestIsResync(t *testing.T) {
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", ResourceVersion: "1"}}
+	if !IsResync(team, team.DeepCopy()) {
+		t.Error("redelivery of the same version not taken as a resync")
+	}
+	updated := team.DeepCopy()
+	updated.SetResourceVersion("2")
+	if IsResync(team, updated) {
+		t.Error("update taken as a resync")
+	}
+	if IsResync("demo", team) {
+		t.Error("object without metadata taken as a resync")
+	}
+}
+
+func TestWaitForCacheSync(t *testing.T) {
+	neverSynced := func() bool { return false }
+	synced := func() bool { return true }
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	start := time.Now()
+	if waitForCacheSync(stopCh, 200*time.Millisecond, neverSynced) {
+		t.Fatal("never-syncing informer reported as synced")
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("wait didn't end at the timeout, it took %s", elapsed)
+	}
+	if !waitForCacheSync(stopCh, time.Minute, synced) {
+		t.Error("synced informer reported as not synced")
+	}
+
+	// Stopping the controller ends the wait before the timeout
+	closedCh := make(chan struct{})
+	close(closedCh)
+	start = time.Now()
+	if waitForCacheSync(closedCh, time.Minute, neverSynced) || time.Since(start) > 2*time.Second {
+		t.Error("wait didn't end when the controller stopped")
+	}
+}
+
+func TestAddWithJitter(t *testing.T) {
+	queue := workqueue.NewDelayingQueue()
+	defer queue.ShutDown()
+	window := 500 * time.Millisecond
+	items := 20
+	start := time.Now()
+	for i := 0; i < items; i++ {
+		addWithJitter(queue, i, window)
+	}
+	// Items come out of the queue as their delays expire
+	var first, last time.Duration
+	for i := 0; i < items; i++ {
+		item, _ := queue.Get()
+		elapsed := time.Since(start)
+		if i == 0 {
+			first = elapsed
+		}
+		last = elapsed
+		queue.Done(item)
+	}
+	if last-first < window/4 {
+		t.Errorf("items are added within %s, expected them to spread over %s", last-first, window)
+	}
+	if last > window+time.Second {
+		t.Errorf("last item added after %s, beyond the window of %s", last, window)
+	}
+	// No jitter adds the item right away
+	addWithJitter(queue, "now", 0)
+	if queue.Len() != 1 {
+		t.Error("item not added right away without jitter")
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer SetResyncPeriod(ResyncPeriod())
+	defer registration.SetDefaultRoles([]string{"User"})
+	settings := config.Default()
+	settings.ResyncPeriod.Duration = time.Minute
+	settings.DefaultRoles = []string{"Tech"}
+	if err := Configure(settings); err != nil {
+		t.Fatal(err)
+	}
+	if ResyncPeriod() != time.Minute {
+		t.Errorf("resync period is %s, expected that of the config", ResyncPeriod())
+	}
+	if roles, _ := registration.UserRoles(nil, &apps_v1alpha.Authority{}); len(roles) != 1 || roles[0] != "Tech" {
+		t.Errorf("roles of the users who register without any are %v, expected those of the config", roles)
+	}
+	settings.DefaultRoles = []string{"Owner"}
+	if err := Configure(settings); err == nil {
+		t.Error("config with an unknown default role applied")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	before, _ := panics.Get("test").(*expvar.Int)
+	var panicsBefore int64
+	if before != nil {
+		panicsBefore = before.Value()
+	}
+	var failed error
+	func() {
+		defer Recover(log.NewEntry(log.New()), "test", "default/panicking", func(err error) { failed = err })
+		var nilMap map[string]*int
+		_ = *nilMap["nil"]
+	}()
+	if failed == nil || !strings.Contains(failed.Error(), "handler panicked") {
+		t.Errorf("failed with %v, expected the panic", failed)
+	}
+	if after := panics.Get("test").(*expvar.Int).Value(); after != panicsBefore+1 {
+		t.Errorf("%d panics counted, expected %d", after, panicsBefore+1)
+	}
+	// No panic calls nothing
+	failed = nil
+	func() {
+		defer Recover(log.NewEntry(log.New()), "test", "default/fine", func(err error) { failed = err })
+	}()
+	if failed != nil {
+		t.Errorf("failed with %v without a panic", failed)
+	}
+}
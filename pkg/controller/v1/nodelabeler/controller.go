@@ -8,6 +8,9 @@ import (
 	"time"
 
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 	"edgenet/pkg/node"
 
 	log "github.com/Sirupsen/logrus"
@@ -32,13 +35,38 @@ type controller struct {
 }
 
 // Start function is entry point of the controller
-func Start() {
+func Start(settings *config.Config) {
+	if err := loop.Configure(settings); err != nil {
+		log.Fatal(err.Error())
+	}
 	clientset, err := authorization.CreateClientSet()
 	if err != nil {
 		log.Println(err.Error())
 		panic(err.Error())
 	}
 
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	// Run the controller loop as a background task to start processing resources
+	go Run(clientset, nil, settings, stopCh)
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+}
+
+// Run creates the controller with the clientsets given and runs it until the stop channel closes,
+// which allows the controller to share the clientsets and the process with other controllers, the
+// node labeler needs the Kubernetes clientset alone. The geolocation settings apply here as the node
+// labeler is the only controller to look up the locations of the nodes
+func Run(clientset kubernetes.Interface, _ versioned.Interface, settings *config.Config, stopCh <-chan struct{}) {
+	node.SetGeolocationRateLimit(settings.Geolocation.QPS, settings.Geolocation.Burst)
+	if settings.Geolocation.ReverseGeocodingURL != "" {
+		node.SetReverseGeocoder(node.NewNominatimGeocoder(settings.Geolocation.ReverseGeocodingURL))
+	}
+	node.SetAllowedCountries(settings.Geolocation.AllowedCountries)
 	// Create the shared informer to list and watch node resources
 	informer := cache.NewSharedIndexInformer(
 		&cache.ListWatch{
@@ -84,19 +112,10 @@ func Start() {
 		clientset: clientset,
 		informer:  informer,
 		queue:     queue,
-		handler:   &Handler{},
+		handler:   &Handler{clientset: clientset},
 	}
 
-	// A channel to terminate elegantly
-	stopCh := make(chan struct{})
-	defer close(stopCh)
-	// Run the controller loop as a background task to start processing resources
-	go controller.run(stopCh)
-	// A channel to observe OS signals for smooth shut down
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, syscall.SIGTERM)
-	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
+	controller.run(stopCh)
 }
 
 // Run starts the controller loop
@@ -110,8 +129,8 @@ func (c *controller) run(stopCh <-chan struct{}) {
 	// Run the informer to list and watch resources
 	go c.informer.Run(stopCh)
 
-	// Synchronization to settle resources one
-	if !cache.WaitForCacheSync(stopCh, c.hasSynced) {
+	// Synchronization to settle resources one, the process exits to be restarted if the API server is unreachable
+	if !loop.WaitForCacheSync(c.logger, stopCh, c.hasSynced) {
 		utilruntime.HandleError(fmt.Errorf("Error syncing cache"))
 		return
 	}
@@ -137,7 +156,7 @@ func (c *controller) runWorker() {
 }
 
 // This function deals with the queue and sends each item in it to the specified handler to be processed.
-func (c *controller) processNextItem() bool {
+func (c *controller) processNextItem() (processed bool) {
 	log.Info("processNextItem: start")
 	// Fetch the next item of the queue
 	key, quit := c.queue.Get()
@@ -147,6 +166,15 @@ func (c *controller) processNextItem() bool {
 	defer c.queue.Done(key)
 	// Get the key string
 	keyRaw := key.(string)
+	// A panic of the handler fails the item rather than the worker, which goes on with the next one
+	defer loop.Recover(c.logger, "nodelabeler", keyRaw, func(err error) {
+		if c.queue.NumRequeues(key) < 3 {
+			c.queue.AddRateLimited(key)
+		} else {
+			c.queue.Forget(key)
+		}
+		processed = true
+	})
 	// Use the string key to get the object from the indexer
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	if err != nil {
@@ -162,8 +190,13 @@ func (c *controller) processNextItem() bool {
 
 	if exists {
 		c.logger.Infof("processNextItem: object created/updated detected: %s", keyRaw)
-		c.handler.SetNodeGeolocation(item)
-		c.queue.Forget(key)
+		if err := c.handler.SetNodeGeolocation(item); err != nil {
+			// Retry with backoff until the geolocation provider recovers
+			c.logger.Errorf("processNextItem: %s, retrying...", err)
+			c.queue.AddRateLimited(key)
+		} else {
+			c.queue.Forget(key)
+		}
 	}
 	return true
 }
@@ -1,42 +1,119 @@
 package nodelabeler
 
 import (
+	"fmt"
+
+	"edgenet/pkg/authorization"
 	"edgenet/pkg/node"
-	
+
 	log "github.com/Sirupsen/logrus"
 	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init() error
-	SetNodeGeolocation(obj interface{})
+	SetNodeGeolocation(obj interface{}) error
 }
 
 // Handler is a sample implementation of Handler
-type Handler struct{}
+type Handler struct {
+	clientset kubernetes.Interface
+}
+
+// geolocateByIP looks up the location of the IP address to attach geolabels to the node
+var geolocateByIP = node.GetGeolocationByIP
 
 // Init handles any handler initialization
 func (t *Handler) Init() error {
 	log.Info("Handler.Init")
-	return nil
+	var err error
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
+	}
+	return err
 }
 
-// SetNodeGeolocation is called when an object is created or updated
-func (t *Handler) SetNodeGeolocation(obj interface{}) {
+// SetNodeGeolocation is called when an object is created or updated,
+// it returns an error if the geolocation lookups failed or the geo-pending taint couldn't be set or removed
+// so that the node gets requeued
+func (t *Handler) SetNodeGeolocation(obj interface{}) error {
 	log.Info("Handler.ObjectCreated")
+	nodeObj := obj.(*api_v1.Node)
+	// The node whose geolocation has never been resolved, such as a freshly joined one, takes no pods until
+	// its geolabels are attached, which prevents the pods of geo-targeted deployments from landing on it beforehand
+	if source, resolved := nodeObj.Annotations[node.GeoSourceAnnotation]; !resolved || source == node.GeoSourcePending {
+		if err := node.SetGeoPendingTaint(nodeObj.Name, t.clientset); err != nil {
+			log.Infof("Couldn't taint %s until its geolocation is resolved: %s", nodeObj.Name, err)
+			return fmt.Errorf("geo-pending taint of node %s not set: %s", nodeObj.Name, err)
+		}
+	}
+	// The location declared by the node annotations takes precedence over the IP addresses
+	// as the IP addresses of the nodes behind NAT point to somewhere else
+	if node.SetDeclaredGeolocation(nodeObj, t.clientset) {
+		log.Infof("Declared geolocation: %s", nodeObj.Name)
+		return t.setGeolocationResolved(nodeObj.Name, node.GeoSourceDeclared)
+	}
 	// Get internal and external IP addresses of the node
-	internalIP, externalIP := node.GetNodeIPAddresses(obj.(*api_v1.Node))	
-	result := false
+	internalIP, externalIP := node.GetNodeIPAddresses(nodeObj)
+	var lookupErr error
 	// Check if the external IP exists to use it in the first place
 	if externalIP != "" {
 		log.Infof("External IP: %s", externalIP)
-		result = node.GetGeolocationByIP(obj.(*api_v1.Node).Name, externalIP)
+		result, err := geolocateByIP(nodeObj.Name, externalIP, t.clientset)
+		if result {
+			return t.setGeolocationResolved(nodeObj.Name, node.GeoSourceExternalIP)
+		}
+		lookupErr = err
 	}
-	// Check if the internal IP exists and 
-	// the result of detecting geolocation by external IP is false
-	if internalIP != "" && result == false {
+	// Check if the internal IP exists as
+	// the geolocation couldn't be detected by the external IP
+	if internalIP != "" {
 		log.Infof("Internal IP: %s", internalIP)
-		node.GetGeolocationByIP(obj.(*api_v1.Node).Name, internalIP)
+		result, err := geolocateByIP(nodeObj.Name, internalIP, t.clientset)
+		if result {
+			return t.setGeolocationResolved(nodeObj.Name, node.GeoSourceInternalIP)
+		}
+		if lookupErr == nil {
+			lookupErr = err
+		}
+	}
+	// The lookups will be repeated once the provider is available again
+	if lookupErr != nil {
+		node.SetGeolocationPending(nodeObj.Name, t.clientset)
+		return fmt.Errorf("geolocation of node %s pending: %s", nodeObj.Name, lookupErr)
 	}
+	// No lookup failed but none found the node either, such as for the node that only has a private IP address.
+	// Another lookup would end the same way, so the node takes pods without the geolabels rather than none at all.
+	log.Infof("Geolocation of node %s unresolved", nodeObj.Name)
+	if err := node.RemoveGeoPendingTaint(nodeObj.Name, t.clientset); err != nil {
+		log.Infof("Couldn't remove the geo-pending taint from %s: %s", nodeObj.Name, err)
+		return fmt.Errorf("geo-pending taint of node %s not removed: %s", nodeObj.Name, err)
+	}
+	return nil
+}
+
+// setGeolocationResolved records the source of the geolabels attached and lets the node take pods,
+// unless the country of the node is outside the allowed countries. The node keeps the geo-pending taint
+// until the country policy is enforced, so that it doesn't take pods in a country that isn't allowed.
+func (t *Handler) setGeolocationResolved(hostname string, source string) error {
+	node.SetGeolocationSource(hostname, source, t.clientset)
+	allowed, err := node.EnforceCountryPolicy(hostname, t.clientset)
+	if err != nil {
+		log.Infof("Couldn't enforce the country policy on %s: %s", hostname, err)
+		return fmt.Errorf("country policy of node %s pending: %s", hostname, err)
+	}
+	if !allowed {
+		log.Infof("Node %s is outside the allowed countries", hostname)
+	}
+	if err := node.RemoveGeoPendingTaint(hostname, t.clientset); err != nil {
+		log.Infof("Couldn't remove the geo-pending taint from %s: %s", hostname, err)
+		return fmt.Errorf("geo-pending taint of node %s not removed: %s", hostname, err)
+	}
+	return nil
 }
@@ -0,0 +1,295 @@
+package nodelabeler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"edgenet/pkg/node"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// stubGeolocateByIP replaces the IP-based lookup, which succeeds only for the IP address found, and returns the IP addresses looked up
+func stubGeolocateByIP(t *testing.T, found string) *[]string {
+	lookups := []string{}
+	geolocateByIP = func(hostname string, ipStr string, clientset kubernetes.Interface) (bool, error) {
+		lookups = append(lookups, ipStr)
+		return ipStr == found, nil
+	}
+	t.Cleanup(func() { geolocateByIP = node.GetGeolocationByIP })
+	return &lookups
+}
+
+func newNATNode(annotations map[string]string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Annotations: annotations, Labels: map[string]string{"kubernetes.io/hostname": "node-1"}},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Address: "192.168.0.1", Type: "InternalIP"}, {Address: "10.0.0.1", Type: "ExternalIP"}}}}
+}
+
+func TestDeclaredGeolocationOverridesIP(t *testing.T) {
+	lookups := stubGeolocateByIP(t, "10.0.0.1")
+	nodeObj := newNATNode(map[string]string{node.DeclaredLatitudeAnnotation: "48.846", node.DeclaredLongitudeAnnotation: "2.357", node.DeclaredCountryAnnotation: "FR"})
+	handler := &Handler{clientset: testclient.NewSimpleClientset(nodeObj)}
+
+	handler.SetNodeGeolocation(nodeObj)
+	if len(*lookups) != 0 {
+		t.Errorf("IP addresses %v looked up despite the declared geolocation", *lookups)
+	}
+	nodeUpdated, _ := handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	expected := map[string]string{"edge-net.io/lat": "n48.846000", "edge-net.io/lon": "e2.357000", "edge-net.io/country-iso": "FR"}
+	for label, value := range expected {
+		if nodeUpdated.Labels[label] != value {
+			t.Errorf("label %s is %q, expected %q", label, nodeUpdated.Labels[label], value)
+		}
+	}
+}
+
+func TestGeolocationFallsBackToIP(t *testing.T) {
+	lookups := stubGeolocateByIP(t, "")
+	nodeObj := newNATNode(nil)
+	handler := &Handler{clientset: testclient.NewSimpleClientset(nodeObj)}
+
+	handler.SetNodeGeolocation(nodeObj)
+	// The external IP comes first, then the internal IP as the stub finds nothing
+	if len(*lookups) != 2 || (*lookups)[0] != "10.0.0.1" || (*lookups)[1] != "192.168.0.1" {
+		t.Errorf("looked up %v, expected the external then the internal IP", *lookups)
+	}
+	nodeUpdated, _ := handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	if _, exists := nodeUpdated.Labels["edge-net.io/lat"]; exists {
+		t.Error("geolabels attached without any declaration")
+	}
+}
+
+func TestGeolocationSourceAnnotation(t *testing.T) {
+	data := []struct {
+		annotations map[string]string
+		found       string
+		source      string
+	}{
+		{map[string]string{node.DeclaredLatitudeAnnotation: "48.846", node.DeclaredLongitudeAnnotation: "2.357"}, "10.0.0.1", node.GeoSourceDeclared},
+		{nil, "10.0.0.1", node.GeoSourceExternalIP},
+		{nil, "192.168.0.1", node.GeoSourceInternalIP},
+		{nil, "", ""},
+	}
+	for _, test := range data {
+		stubGeolocateByIP(t, test.found)
+		nodeObj := newNATNode(test.annotations)
+		handler := &Handler{clientset: testclient.NewSimpleClientset(nodeObj)}
+
+		handler.SetNodeGeolocation(nodeObj)
+		nodeUpdated, _ := handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+		if source := nodeUpdated.Annotations[node.GeoSourceAnnotation]; source != test.source {
+			t.Errorf("geolocation source is %q, expected %q", source, test.source)
+		}
+		resolvedAt, resolved := nodeUpdated.Annotations[node.GeoResolvedAtAnnotation]
+		if resolved != (test.source != "") {
+			t.Errorf("resolution time %q attached for the source %q", resolvedAt, test.source)
+		} else if _, err := time.Parse(time.RFC3339, resolvedAt); resolved && err != nil {
+			t.Errorf("resolution time %q isn't in RFC 3339: %s", resolvedAt, err)
+		}
+	}
+}
+
+func TestGeolocationRetriedAfterOutage(t *testing.T) {
+	outage := true
+	geolocateByIP = func(hostname string, ipStr string, clientset kubernetes.Interface) (bool, error) {
+		if outage {
+			return false, errors.New("provider unavailable")
+		}
+		return true, nil
+	}
+	t.Cleanup(func() { geolocateByIP = node.GetGeolocationByIP })
+	nodeObj := newNATNode(nil)
+	handler := &Handler{clientset: testclient.NewSimpleClientset(nodeObj)}
+
+	// The failure is returned for the node to be requeued, and the geolocation is marked as pending
+	if err := handler.SetNodeGeolocation(nodeObj); err == nil {
+		t.Fatal("lookup failure not returned")
+	}
+	nodeUpdated, _ := handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	if source := nodeUpdated.Annotations[node.GeoSourceAnnotation]; source != node.GeoSourcePending {
+		t.Errorf("geolocation source is %q during the outage, expected %q", source, node.GeoSourcePending)
+	}
+	// The requeued node gets its geolocation once the provider recovers
+	outage = false
+	if err := handler.SetNodeGeolocation(nodeObj); err != nil {
+		t.Fatalf("lookup failed after the recovery: %s", err)
+	}
+	nodeUpdated, _ = handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	if source := nodeUpdated.Annotations[node.GeoSourceAnnotation]; source != node.GeoSourceExternalIP {
+		t.Errorf("geolocation source is %q after the recovery, expected %q", source, node.GeoSourceExternalIP)
+	}
+}
+
+func hasGeoPendingTaint(nodeObj *corev1.Node) bool {
+	for _, taint := range nodeObj.Spec.Taints {
+		if taint.Key == node.GeoPendingTaintKey && taint.Effect == corev1.TaintEffectNoSchedule {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGeoPendingTaint(t *testing.T) {
+	nodeObj := newNATNode(nil)
+	nodeObj.Spec.Taints = []corev1.Taint{{Key: "node.kubernetes.io/unreachable", Effect: corev1.TaintEffectNoExecute}}
+	handler := &Handler{clientset: testclient.NewSimpleClientset(nodeObj)}
+	// The node is tainted by the time of the lookup, and stays tainted while the lookups fail
+	taintedOnLookup := false
+	outage := true
+	geolocateByIP = func(hostname string, ipStr string, clientset kubernetes.Interface) (bool, error) {
+		nodeCurrent, _ := clientset.CoreV1().Nodes().Get(hostname, metav1.GetOptions{})
+		taintedOnLookup = hasGeoPendingTaint(nodeCurrent)
+		if outage {
+			return false, errors.New("provider unavailable")
+		}
+		return true, nil
+	}
+	t.Cleanup(func() { geolocateByIP = node.GetGeolocationByIP })
+
+	handler.SetNodeGeolocation(nodeObj)
+	if !taintedOnLookup {
+		t.Error("node not tainted before the lookup")
+	}
+	nodeUpdated, _ := handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	if !hasGeoPendingTaint(nodeUpdated) {
+		t.Error("taint removed while the geolocation is pending")
+	}
+	// Once the geolabels are attached, the taint is gone and the others remain
+	outage = false
+	if err := handler.SetNodeGeolocation(nodeUpdated); err != nil {
+		t.Fatalf("lookup failed after the recovery: %s", err)
+	}
+	nodeUpdated, _ = handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	if hasGeoPendingTaint(nodeUpdated) {
+		t.Error("taint remains after the geolabels are attached")
+	}
+	if len(nodeUpdated.Spec.Taints) != 1 || nodeUpdated.Spec.Taints[0].Key != "node.kubernetes.io/unreachable" {
+		t.Errorf("other taints not kept: %v", nodeUpdated.Spec.Taints)
+	}
+}
+
+func TestDeclaredGeolocationRemovesTaint(t *testing.T) {
+	stubGeolocateByIP(t, "")
+	nodeObj := newNATNode(map[string]string{node.DeclaredLatitudeAnnotation: "48.846", node.DeclaredLongitudeAnnotation: "2.357"})
+	nodeObj.Spec.Taints = []corev1.Taint{{Key: node.GeoPendingTaintKey, Effect: corev1.TaintEffectNoSchedule}}
+	handler := &Handler{clientset: testclient.NewSimpleClientset(nodeObj)}
+
+	handler.SetNodeGeolocation(nodeObj)
+	nodeUpdated, _ := handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	if hasGeoPendingTaint(nodeUpdated) {
+		t.Error("taint remains after the declared geolabels are attached")
+	}
+}
+
+func TestCountryPolicy(t *testing.T) {
+	stubGeolocateByIP(t, "")
+	node.SetAllowedCountries([]string{"DE"})
+	defer node.SetAllowedCountries(nil)
+	nodeObj := newNATNode(map[string]string{node.DeclaredLatitudeAnnotation: "48.846", node.DeclaredLongitudeAnnotation: "2.357", node.DeclaredCountryAnnotation: "FR"})
+	handler := &Handler{clientset: testclient.NewSimpleClientset(nodeObj)}
+
+	handler.SetNodeGeolocation(nodeObj)
+	nodeUpdated, _ := handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	if hasGeoPendingTaint(nodeUpdated) {
+		t.Error("geo-pending taint remains after the geolabels are attached")
+	}
+	tainted := false
+	for _, taint := range nodeUpdated.Spec.Taints {
+		tainted = tainted || taint.Key == node.CountryTaintKey
+	}
+	if !tainted || nodeUpdated.Annotations[node.CountryPolicyAnnotation] == "" {
+		t.Errorf("node in FR not kept from taking pods: taints %v, annotations %v", nodeUpdated.Spec.Taints, nodeUpdated.Annotations)
+	}
+}
+
+func TestCountryPolicyFailureKeepsTaint(t *testing.T) {
+	stubGeolocateByIP(t, "")
+	node.SetAllowedCountries([]string{"DE"})
+	defer node.SetAllowedCountries(nil)
+	nodeObj := newNATNode(map[string]string{node.DeclaredLatitudeAnnotation: "48.846", node.DeclaredLongitudeAnnotation: "2.357", node.DeclaredCountryAnnotation: "FR"})
+	nodeObj.Spec.Taints = []corev1.Taint{{Key: node.GeoPendingTaintKey, Effect: corev1.TaintEffectNoSchedule}}
+	clientset := testclient.NewSimpleClientset(nodeObj)
+	// The country taint cannot be written
+	clientset.PrependReactor("update", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		nodeUpdate := action.(k8stesting.UpdateAction).GetObject().(*corev1.Node)
+		if nodeUpdate.Annotations[node.CountryPolicyAnnotation] != "" {
+			return true, nil, errors.New("API server unavailable")
+		}
+		return false, nil, nil
+	})
+	handler := &Handler{clientset: clientset}
+
+	if err := handler.SetNodeGeolocation(nodeObj); err == nil {
+		t.Error("node not requeued while the country policy is not enforced")
+	}
+	nodeUpdated, _ := handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	if !hasGeoPendingTaint(nodeUpdated) {
+		t.Error("geo-pending taint removed before the country policy is enforced")
+	}
+}
+
+func TestPrivateIPRemovesTaint(t *testing.T) {
+	// The lookup of a private IP address finds nothing, without failing
+	stubGeolocateByIP(t, "")
+	nodeObj := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Address: "192.168.0.1", Type: "InternalIP"}}}}
+	handler := &Handler{clientset: testclient.NewSimpleClientset(nodeObj)}
+
+	if err := handler.SetNodeGeolocation(nodeObj); err != nil {
+		t.Errorf("node requeued although another lookup would find nothing either: %s", err)
+	}
+	nodeUpdated, _ := handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	if hasGeoPendingTaint(nodeUpdated) {
+		t.Error("taint remains on the node that has only a private IP address")
+	}
+}
+
+func TestGeoPendingTaintRemovalRetried(t *testing.T) {
+	stubGeolocateByIP(t, "10.0.0.1")
+	nodeObj := newNATNode(nil)
+	clientset := testclient.NewSimpleClientset(nodeObj)
+	// The node gets modified by another client while the taint is removed
+	conflicts := 1
+	clientset.PrependReactor("update", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		nodeUpdate := action.(k8stesting.UpdateAction).GetObject().(*corev1.Node)
+		if !hasGeoPendingTaint(nodeUpdate) && conflicts > 0 {
+			conflicts--
+			return true, nil, apierrors.NewConflict(corev1.Resource("nodes"), nodeUpdate.GetName(), errors.New("object modified"))
+		}
+		return false, nil, nil
+	})
+	handler := &Handler{clientset: clientset}
+
+	if err := handler.SetNodeGeolocation(nodeObj); err != nil {
+		t.Fatalf("conflict not retried: %s", err)
+	}
+	nodeUpdated, _ := handler.clientset.CoreV1().Nodes().Get(nodeObj.Name, metav1.GetOptions{})
+	if hasGeoPendingTaint(nodeUpdated) {
+		t.Error("taint remains after the conflict")
+	}
+}
+
+func TestGeoPendingTaintRemovalFailureRequeued(t *testing.T) {
+	stubGeolocateByIP(t, "10.0.0.1")
+	nodeObj := newNATNode(nil)
+	clientset := testclient.NewSimpleClientset(nodeObj)
+	// The taint cannot be removed
+	clientset.PrependReactor("update", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !hasGeoPendingTaint(action.(k8stesting.UpdateAction).GetObject().(*corev1.Node)) {
+			return true, nil, errors.New("API server unavailable")
+		}
+		return false, nil, nil
+	})
+	handler := &Handler{clientset: clientset}
+
+	if err := handler.SetNodeGeolocation(nodeObj); err == nil {
+		t.Error("node not requeued while the taint remains")
+	}
+}
@@ -25,12 +25,16 @@ import (
 
 	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/client/clientset/versioned"
 	appsinformer_v1 "edgenet/pkg/client/informers/externalversions/apps/v1alpha"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 
 	log "github.com/Sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
@@ -53,6 +57,7 @@ type informerevent struct {
 // This contains the fields to check whether they are updated
 type fields struct {
 	accepted bool
+	version  bool
 }
 
 // Constant variables for events
@@ -61,14 +66,46 @@ const update = "update"
 const delete = "delete"
 
 // Start function is entry point of the controller
-func Start() {
+func Start(settings *config.Config) {
+	if err := loop.Configure(settings); err != nil {
+		log.Fatal(err.Error())
+	}
+	clientset, err := authorization.CreateClientSet()
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
 	edgenetClientset, err := authorization.CreateEdgeNetClientSet()
 	if err != nil {
 		log.Println(err.Error())
 		panic(err.Error())
 	}
+	if err := authorization.EnsureCRDs(edgenetClientset.Discovery(), apps_v1alpha.SchemeGroupVersion.WithResource("acceptableusepolicies")); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	// Run the controller loop as a background task to start processing resources
+	go Run(clientset, edgenetClientset, settings, stopCh)
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+}
 
-	AUPHandler := &Handler{}
+// Run creates the controller with the clientsets given and runs it until the stop channel closes,
+// which allows the controller to share the clientsets and the process with other controllers
+func Run(clientset kubernetes.Interface, edgenetClientset versioned.Interface, _ *config.Config, stopCh <-chan struct{}) {
+	newController(clientset, edgenetClientset).run(stopCh)
+}
+
+// newController creates the controller along with its handler, both of which use the clientsets given
+func newController(clientset kubernetes.Interface, edgenetClientset versioned.Interface) *controller {
+	var err error
+	AUPHandler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
 	// Create the acceptableusepolicy informer which was generated by the code generator to list and watch acceptableusepolicy resources
 	informer := appsinformer_v1.NewAcceptableUsePolicyInformer(
 		edgenetClientset,
@@ -99,6 +136,11 @@ func Start() {
 			if oldObj.(*apps_v1alpha.AcceptableUsePolicy).Spec.Accepted != newObj.(*apps_v1alpha.AcceptableUsePolicy).Spec.Accepted {
 				event.updated.accepted = true
 			}
+			// Find out whether the policy version updated
+			event.updated.version = false
+			if oldObj.(*apps_v1alpha.AcceptableUsePolicy).Spec.Version != newObj.(*apps_v1alpha.AcceptableUsePolicy).Spec.Version {
+				event.updated.version = true
+			}
 			log.Infof("Update acceptableusepolicy: %s", event.key)
 			if err == nil {
 				queue.Add(event)
@@ -122,16 +164,7 @@ func Start() {
 		handler:  AUPHandler,
 	}
 
-	// A channel to terminate elegantly
-	stopCh := make(chan struct{})
-	defer close(stopCh)
-	// Run the controller loop as a background task to start processing resources
-	go controller.run(stopCh)
-	// A channel to observe OS signals for smooth shut down
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, syscall.SIGTERM)
-	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
+	return &controller
 }
 
 // Run starts the controller loop
@@ -145,8 +178,8 @@ func (c *controller) run(stopCh <-chan struct{}) {
 	// Run the informer to list and watch resources
 	go c.informer.Run(stopCh)
 
-	// Synchronization to settle resources one
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+	// Synchronization to settle resources one, the process exits to be restarted if the API server is unreachable
+	if !loop.WaitForCacheSync(c.logger, stopCh, c.informer.HasSynced) {
 		utilruntime.HandleError(fmt.Errorf("Error syncing cache"))
 		return
 	}
@@ -169,7 +202,7 @@ func (c *controller) runWorker() {
 }
 
 // This function deals with the queue and sends each item in it to the specified handler to be processed.
-func (c *controller) processNextItem() bool {
+func (c *controller) processNextItem() (processed bool) {
 	log.Info("processNextItem: start")
 	// Fetch the next item of the queue
 	event, quit := c.queue.Get()
@@ -179,6 +212,15 @@ func (c *controller) processNextItem() bool {
 	defer c.queue.Done(event)
 	// Get the key string
 	keyRaw := event.(informerevent).key
+	// A panic of the handler fails the item rather than the worker, which goes on with the next one
+	defer loop.Recover(c.logger, "acceptableusepolicy", keyRaw, func(err error) {
+		if c.queue.NumRequeues(event) < 5 {
+			c.queue.AddRateLimited(event)
+		} else {
+			c.queue.Forget(event)
+		}
+		processed = true
+	})
 	// Use the string key to get the object from the indexer
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	if err != nil {
@@ -205,6 +247,11 @@ func (c *controller) processNextItem() bool {
 			c.logger.Infof("Controller.processNextItem: object updated detected: %s", keyRaw)
 			c.handler.ObjectUpdated(item, event.(informerevent).updated)
 		}
+		// An outdated acceptance gets checked again when the next reminder is due or the grace period is over,
+		// as the version of the policy had been updated
+		if delay, ok := c.handler.GraceRecheck(item); ok {
+			c.queue.AddAfter(informerevent{key: keyRaw, function: update, updated: fields{version: true}}, delay)
+		}
 	}
 	c.queue.Forget(event.(informerevent).key)
 
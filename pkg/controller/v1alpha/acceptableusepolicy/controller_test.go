@@ -0,0 +1,30 @@
+package acceptableusepolicy
+
+import (
+	"testing"
+
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+// TestNewControllerSharesClientsets checks that the handler of the controller uses the clientsets given to Run, which the controllers in a process share
+func TestNewControllerSharesClientsets(t *testing.T) {
+	clientset := testclient.NewSimpleClientset()
+	edgenetClientset := edgenettestclient.NewSimpleClientset()
+	controller := newController(clientset, edgenetClientset)
+	handler, ok := controller.handler.(*Handler)
+	if !ok {
+		t.Fatalf("Handler type: expected *Handler, got %T", controller.handler)
+	}
+	// Init must keep the clientsets rather than create its own from the config file
+	if err := handler.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if handler.clientset != clientset {
+		t.Errorf("Handler clientset: expected the one given, got %v", handler.clientset)
+	}
+	if handler.edgenetClientset != edgenetClientset {
+		t.Errorf("Handler EdgeNet clientset: expected the one given, got %v", handler.edgenetClientset)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package acceptableusepolicy
+
+import (
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// gracePeriod lets the users who accepted an outdated version of the policy keep their access while they are
+// reminded to accept the version in force, 0 withdraws the acceptance right away
+var gracePeriod time.Duration
+
+// SetGracePeriod configures how long the acceptance of an outdated version of the policy remains valid
+func SetGracePeriod(period time.Duration) {
+	gracePeriod = period
+}
+
+// The interval between the reminders sent during the grace period
+const graceReminderInterval = 24 * time.Hour
+
+// graceAction is what to do about an acceptance at a point in time
+type graceAction string
+
+// Constant variables for the grace actions
+const (
+	// graceValid is for the acceptance of the version in force, or for no acceptance at all
+	graceValid graceAction = "valid"
+	// graceRemind is for an outdated acceptance during the grace period when a reminder is due
+	graceRemind graceAction = "remind"
+	// graceWait is for an outdated acceptance during the grace period between two reminders
+	graceWait graceAction = "wait"
+	// graceRevoke is for an outdated acceptance once the grace period is over
+	graceRevoke graceAction = "revoke"
+)
+
+// checkGrace tells what to do about the acceptance at the time given. It records in the status when the acceptance
+// was found to be outdated and when the user was reminded, and clears them once the acceptance is valid. During the
+// grace period, it also returns how long until the acceptance needs to be checked again.
+func checkGrace(spec apps_v1alpha.AcceptableUsePolicySpec, status *apps_v1alpha.AcceptableUsePolicyStatus, period time.Duration, now time.Time) (graceAction, time.Duration) {
+	if !spec.Accepted || status.AcceptedVersion == spec.Version {
+		status.OutdatedSince = nil
+		status.LastReminder = nil
+		return graceValid, 0
+	}
+	if status.OutdatedSince == nil {
+		status.OutdatedSince = &metav1.Time{Time: now}
+	}
+	deadline := status.OutdatedSince.Add(period)
+	if !now.Before(deadline) {
+		return graceRevoke, 0
+	}
+	action := graceWait
+	if status.LastReminder == nil || now.Sub(status.LastReminder.Time) >= graceReminderInterval {
+		status.LastReminder = &metav1.Time{Time: now}
+		action = graceRemind
+	}
+	next := deadline.Sub(now)
+	if untilReminder := status.LastReminder.Add(graceReminderInterval).Sub(now); untilReminder < next {
+		next = untilReminder
+	}
+	return action, next
+}
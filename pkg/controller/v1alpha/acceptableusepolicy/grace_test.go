@@ -0,0 +1,119 @@
+package acceptableusepolicy
+
+import (
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestCheckGrace(t *testing.T) {
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	spec := apps_v1alpha.AcceptableUsePolicySpec{Accepted: true, Version: "2"}
+	status := &apps_v1alpha.AcceptableUsePolicyStatus{AcceptedVersion: "1"}
+	steps := []struct {
+		elapsed  time.Duration
+		expected graceAction
+		next     time.Duration
+	}{
+		// The first check starts the grace period and reminds the user
+		{0, graceRemind, 24 * time.Hour},
+		{time.Hour, graceWait, 23 * time.Hour},
+		{24 * time.Hour, graceRemind, 24 * time.Hour},
+		{47 * time.Hour, graceWait, time.Hour},
+		{48 * time.Hour, graceRemind, 12 * time.Hour},
+		// The last check happens at the end of the period rather than at the next reminder
+		{60 * time.Hour, graceRevoke, 0},
+		{61 * time.Hour, graceRevoke, 0},
+	}
+	for _, step := range steps {
+		action, next := checkGrace(spec, status, 60*time.Hour, start.Add(step.elapsed))
+		if action != step.expected || next != step.next {
+			t.Errorf("after %s: action %s and next check in %s, expected %s and %s", step.elapsed, action, next, step.expected, step.next)
+		}
+		if !status.OutdatedSince.Time.Equal(start) {
+			t.Errorf("after %s: outdated since %s, expected %s", step.elapsed, status.OutdatedSince, start)
+		}
+	}
+	if !status.LastReminder.Time.Equal(start.Add(48 * time.Hour)) {
+		t.Errorf("last reminder at %s, expected the third one", status.LastReminder)
+	}
+
+	// Accepting the version in force ends the grace period
+	status.AcceptedVersion = "2"
+	if action, _ := checkGrace(spec, status, 60*time.Hour, start.Add(62*time.Hour)); action != graceValid || status.OutdatedSince != nil || status.LastReminder != nil {
+		t.Errorf("acceptance of the version in force: action %s, status %+v", action, status)
+	}
+	// Without a grace period, the outdated acceptance is revoked right away
+	status = &apps_v1alpha.AcceptableUsePolicyStatus{AcceptedVersion: "1"}
+	if action, _ := checkGrace(spec, status, 0, start); action != graceRevoke {
+		t.Errorf("action %s without a grace period, expected %s", action, graceRevoke)
+	}
+	// No acceptance, nothing to revoke
+	status = &apps_v1alpha.AcceptableUsePolicyStatus{AcceptedVersion: "1", OutdatedSince: &metav1.Time{Time: start}}
+	if action, _ := checkGrace(apps_v1alpha.AcceptableUsePolicySpec{Version: "2"}, status, time.Hour, start); action != graceValid || status.OutdatedSince != nil {
+		t.Errorf("action %s for a policy not accepted, status %+v", action, status)
+	}
+}
+
+func TestGracePeriodRetainsAccess(t *testing.T) {
+	SetGracePeriod(72 * time.Hour)
+	defer SetGracePeriod(0)
+	AUP := &apps_v1alpha.AcceptableUsePolicy{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.AcceptableUsePolicySpec{Accepted: true, Version: "2"},
+		Status: apps_v1alpha.AcceptableUsePolicyStatus{AcceptedVersion: "1", Expires: &metav1.Time{Time: time.Now().Add(time.Hour)}}}
+	handler := newTestHandler(AUP)
+	fakeClock := clock.NewFakeClock(time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC))
+	handler.clock = fakeClock
+	// The controller requeues the object for the next check, which the test runs by moving the clock
+	var scheduled []time.Duration
+	recheck := func(AUP *apps_v1alpha.AcceptableUsePolicy) *apps_v1alpha.AcceptableUsePolicy {
+		delay, ok := handler.GraceRecheck(AUP)
+		if !ok {
+			t.Fatalf("no recheck scheduled at %s", fakeClock.Now())
+		}
+		scheduled = append(scheduled, delay)
+		fakeClock.Step(delay)
+		AUPLatest, _ := handler.edgenetClientset.AppsV1alpha().AcceptableUsePolicies("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+		handler.ObjectUpdated(AUPLatest, fields{version: true})
+		return AUPLatest
+	}
+	accepted := func() bool {
+		user, _ := handler.edgenetClientset.AppsV1alpha().Users("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+		AUPLatest, _ := handler.edgenetClientset.AppsV1alpha().AcceptableUsePolicies("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+		return user.Status.AUP && AUPLatest.Spec.Accepted
+	}
+
+	handler.ObjectUpdated(AUP, fields{version: true})
+	AUPHandled := AUP
+	if !accepted() {
+		t.Fatal("access withdrawn at the start of the grace period")
+	}
+	AUPLatest, _ := handler.edgenetClientset.AppsV1alpha().AcceptableUsePolicies("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+	if AUPLatest.Status.OutdatedSince == nil || AUPLatest.Status.LastReminder == nil || !AUPLatest.Status.LastReminder.Time.Equal(fakeClock.Now()) {
+		t.Fatalf("grace period not recorded: %+v", AUPLatest.Status)
+	}
+	for i, elapsed := range []time.Duration{24 * time.Hour, 48 * time.Hour} {
+		AUPHandled = recheck(AUPHandled)
+		if !accepted() {
+			t.Fatalf("access withdrawn %s into the grace period", elapsed)
+		}
+		AUPLatest, _ = handler.edgenetClientset.AppsV1alpha().AcceptableUsePolicies("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+		if !AUPLatest.Status.LastReminder.Time.Equal(fakeClock.Now()) {
+			t.Errorf("reminder %d not recorded: %+v", i+2, AUPLatest.Status)
+		}
+	}
+	AUPHandled = recheck(AUPHandled)
+	if accepted() {
+		t.Error("access retained after the grace period")
+	}
+	if _, ok := handler.GraceRecheck(AUPHandled); ok {
+		t.Error("recheck scheduled after the grace period")
+	}
+	if len(scheduled) != 3 || scheduled[0] != 24*time.Hour || scheduled[2] != 24*time.Hour {
+		t.Errorf("rechecks scheduled in %v, expected one per reminder", scheduled)
+	}
+}
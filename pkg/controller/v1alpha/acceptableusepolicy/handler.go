@@ -27,6 +27,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -36,27 +37,38 @@ type HandlerInterface interface {
 	ObjectCreated(obj interface{})
 	ObjectUpdated(obj, updated interface{})
 	ObjectDeleted(obj interface{})
+	GraceRecheck(obj interface{}) (time.Duration, bool)
 }
 
 // Handler implementation
 type Handler struct {
-	clientset        *kubernetes.Clientset
-	edgenetClientset *versioned.Clientset
+	clientset        kubernetes.Interface
+	edgenetClientset versioned.Interface
+	clock            clock.Clock
 }
 
 // Init handles any handler initialization
 func (t *Handler) Init() error {
 	log.Info("AUPHandler.Init")
 	var err error
-	t.clientset, err = authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clientsets may be injected beforehand, such as those that the controllers in a process share
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
+	}
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
-	t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clock may be injected as well, so that tests control the grace period
+	if t.clock == nil {
+		t.clock = clock.RealClock{}
 	}
 	return err
 }
@@ -80,11 +92,19 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 			if AUPCopy.Status.Renew {
 				AUPCopy.Status.Renew = false
 			}
+			AUPCopy.Status.AcceptedVersion = AUPCopy.Spec.Version
+			if AUPCopy.Status.AcceptedAt == nil {
+				AUPCopy.Status.AcceptedAt = &metav1.Time{Time: t.clock.Now()}
+			}
 			// Set a timeout cycle which makes the acceptable use policy expires every 6 months
 			AUPCopy.Status.Expires = &metav1.Time{
 				Time: time.Now().Add(4382 * time.Hour),
 			}
 		} else if AUPCopy.Spec.Accepted && AUPCopy.Status.Expires != nil {
+			// The policy may have been updated while the service was down
+			if t.invalidateOutdatedAcceptance(AUPCopy, AUPOwnerNamespace.Labels["authority-name"]) {
+				return
+			}
 			// Check if the 6 months cycle expired
 			if AUPCopy.Status.Expires.Time.Sub(time.Now()) >= 0 {
 				go t.runApprovalTimeout(AUPCopy)
@@ -121,6 +141,11 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 			AUPUser, _ := t.edgenetClientset.AppsV1alpha().Users(AUPCopy.GetNamespace()).Get(AUPCopy.GetName(), metav1.GetOptions{})
 			if AUPCopy.Spec.Accepted {
 				AUPUser.Status.AUP = true
+				// The user accepts the version of the policy in force, which ends the grace period if any
+				AUPCopy.Status.AcceptedVersion = AUPCopy.Spec.Version
+				AUPCopy.Status.AcceptedAt = &metav1.Time{Time: t.clock.Now()}
+				AUPCopy.Status.OutdatedSince = nil
+				AUPCopy.Status.LastReminder = nil
 
 				go t.runApprovalTimeout(AUPCopy)
 				// Set the expiration date according to the 6-month cycle
@@ -138,6 +163,8 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 				AUPUser.Status.AUP = false
 			}
 			go t.edgenetClientset.AppsV1alpha().Users(AUPUser.GetNamespace()).UpdateStatus(AUPUser)
+		} else if fieldUpdated.version && t.invalidateOutdatedAcceptance(AUPCopy, AUPOwnerNamespace.Labels["authority-name"]) {
+			log.Infof("Acceptable use policy of %s in %s is outdated", AUPCopy.GetName(), AUPCopy.GetNamespace())
 		} else if AUPCopy.Spec.Accepted && AUPCopy.Status.Renew {
 			AUPCopy.Status.Expires = &metav1.Time{
 				Time: time.Now().Add(4382 * time.Hour),
@@ -156,6 +183,57 @@ func (t *Handler) ObjectDeleted(obj interface{}) {
 	// Mail notification, TBD
 }
 
+// invalidateOutdatedAcceptance handles the acceptance of a version other than the one in force. During the grace period,
+// the user keeps the access and gets reminded by email to accept the version in force. Afterwards, the acceptance is withdrawn and the user is asked by email
+// to accept the policy again. It returns whether the acceptance is outdated.
+func (t *Handler) invalidateOutdatedAcceptance(AUPCopy *apps_v1alpha.AcceptableUsePolicy, authorityName string) bool {
+	action, _ := checkGrace(AUPCopy.Spec, &AUPCopy.Status, gracePeriod, t.clock.Now())
+	if action == graceValid {
+		return false
+	}
+	AUPUser, err := t.edgenetClientset.AppsV1alpha().Users(AUPCopy.GetNamespace()).Get(AUPCopy.GetName(), metav1.GetOptions{})
+	if err == nil && action != graceWait {
+		if action == graceRevoke {
+			AUPUser.Status.AUP = false
+			t.edgenetClientset.AppsV1alpha().Users(AUPUser.GetNamespace()).UpdateStatus(AUPUser)
+		}
+		contentData := mailer.CommonContentData{}
+		contentData.CommonData.Authority = authorityName
+		contentData.CommonData.Username = AUPCopy.GetName()
+		contentData.CommonData.Name = fmt.Sprintf("%s %s", AUPUser.Spec.FirstName, AUPUser.Spec.LastName)
+		contentData.CommonData.Email = []string{AUPUser.Spec.Email}
+		mailer.Send("acceptable-use-policy-update", contentData)
+	}
+	if action != graceRevoke {
+		log.Infof("Acceptable use policy of %s in %s is outdated, access retained for %s", AUPCopy.GetName(), AUPCopy.GetNamespace(),
+			AUPCopy.Status.OutdatedSince.Add(gracePeriod).Sub(t.clock.Now()).Round(time.Second))
+		AUPCopyUpdated, err := t.edgenetClientset.AppsV1alpha().AcceptableUsePolicies(AUPCopy.GetNamespace()).UpdateStatus(AUPCopy)
+		if err == nil {
+			AUPCopy.SetResourceVersion(AUPCopyUpdated.GetResourceVersion())
+		}
+		return true
+	}
+	AUPCopy.Spec.Accepted = false
+	AUPCopyUpdated, err := t.edgenetClientset.AppsV1alpha().AcceptableUsePolicies(AUPCopy.GetNamespace()).Update(AUPCopy)
+	if err == nil {
+		// The status gets updated afterwards, so it needs the latest version of the object
+		AUPCopy.SetResourceVersion(AUPCopyUpdated.GetResourceVersion())
+	}
+	return true
+}
+
+// GraceRecheck tells how long until the outdated acceptance needs to be checked again, which is when the next reminder
+// is due or the grace period is over. The object may predate the handling of the event, so the check is worked out on
+// a copy of its status as the handler does. It returns false if the acceptance doesn't need to be checked again.
+func (t *Handler) GraceRecheck(obj interface{}) (time.Duration, bool) {
+	AUP := obj.(*apps_v1alpha.AcceptableUsePolicy)
+	action, next := checkGrace(AUP.Spec, AUP.Status.DeepCopy(), gracePeriod, t.clock.Now())
+	if action != graceRemind && action != graceWait {
+		return 0, false
+	}
+	return next, true
+}
+
 // runApprovalTimeout puts a procedure in place to remove requests by approval or timeout
 func (t *Handler) runApprovalTimeout(AUPCopy *apps_v1alpha.AcceptableUsePolicy) {
 	timeoutRenewed := make(chan bool, 1)
@@ -0,0 +1,80 @@
+package acceptableusepolicy
+
+import (
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestHandler(AUP *apps_v1alpha.AcceptableUsePolicy) *Handler {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: AUP.Spec.Accepted}}
+	return &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, user, AUP),
+		clock:            clock.RealClock{},
+	}
+}
+
+func TestVersionBumpInvalidatesAcceptance(t *testing.T) {
+	AUP := &apps_v1alpha.AcceptableUsePolicy{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.AcceptableUsePolicySpec{Accepted: true, Version: "1"},
+		Status: apps_v1alpha.AcceptableUsePolicyStatus{AcceptedVersion: "1", Expires: &metav1.Time{Time: time.Now().Add(time.Hour)}}}
+	handler := newTestHandler(AUP)
+
+	// The version doesn't change, so the acceptance remains valid
+	handler.ObjectUpdated(AUP, fields{version: true})
+	user, _ := handler.edgenetClientset.AppsV1alpha().Users("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+	if !user.Status.AUP {
+		t.Fatal("acceptance of the current version invalidated")
+	}
+	// Bumping the version invalidates the acceptance of the previous version
+	AUP.Spec.Version = "2"
+	handler.edgenetClientset.AppsV1alpha().AcceptableUsePolicies("authority-edgenet").Update(AUP)
+	handler.ObjectUpdated(AUP, fields{version: true})
+	user, _ = handler.edgenetClientset.AppsV1alpha().Users("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+	if user.Status.AUP {
+		t.Error("user AUP status remains true after the version bump")
+	}
+	AUPUpdated, _ := handler.edgenetClientset.AppsV1alpha().AcceptableUsePolicies("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+	if AUPUpdated.Spec.Accepted {
+		t.Error("acceptance of the outdated version not withdrawn")
+	}
+}
+
+func TestAcceptanceRecordsVersion(t *testing.T) {
+	AUP := &apps_v1alpha.AcceptableUsePolicy{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.AcceptableUsePolicySpec{Accepted: true, Version: "2"},
+		Status: apps_v1alpha.AcceptableUsePolicyStatus{AcceptedVersion: "1"}}
+	handler := newTestHandler(AUP)
+
+	handler.ObjectUpdated(AUP, fields{accepted: true})
+	AUPUpdated, _ := handler.edgenetClientset.AppsV1alpha().AcceptableUsePolicies("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+	if AUPUpdated.Status.AcceptedVersion != "2" || !AUPUpdated.Spec.Accepted {
+		t.Errorf("acceptance of version 2 not recorded: %+v", AUPUpdated.Status)
+	}
+}
+
+func TestOutdatedAcceptanceInvalidatedOnCreate(t *testing.T) {
+	AUP := &apps_v1alpha.AcceptableUsePolicy{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.AcceptableUsePolicySpec{Accepted: true, Version: "2"},
+		Status: apps_v1alpha.AcceptableUsePolicyStatus{AcceptedVersion: "1", Expires: &metav1.Time{Time: time.Now().Add(time.Hour)}}}
+	handler := newTestHandler(AUP)
+
+	handler.ObjectCreated(AUP)
+	user, _ := handler.edgenetClientset.AppsV1alpha().Users("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+	if user.Status.AUP {
+		t.Error("outdated acceptance remains valid after restart")
+	}
+}
@@ -17,21 +17,29 @@ limitations under the License.
 package authority
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/client/clientset/versioned"
 	appsinformer_v1 "edgenet/pkg/client/informers/externalversions/apps/v1alpha"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
+	"edgenet/pkg/events"
+	"edgenet/pkg/registration"
 
 	log "github.com/Sirupsen/logrus"
 	rbacv1 "k8s.io/api/rbac/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
@@ -48,18 +56,50 @@ type controller struct {
 type informerevent struct {
 	key      string
 	function string
+	change   fields
+}
+
+// This contains the fields to check whether they are updated, and those of the object to be used after it is gone
+type fields struct {
+	spec    bool
+	enabled bool
+	object  objectData
+}
+
+type objectData struct {
+	name string
 }
 
 // Constant variables for events
 const create = "create"
 const update = "update"
 const delete = "delete"
+const teardown = "teardown"
 const failure = "Failure"
 const success = "Successful"
 const established = "Established"
 
+// clusterRoleManagement makes the controller create the cluster roles of authorities and keep their rules up to date,
+// which the clusters whose RBAC is managed externally, such as by a GitOps tool, disable to provide the roles themselves
+var clusterRoleManagement = true
+
+// SetClusterRoleManagement configures whether the controller creates and updates the cluster roles, or assumes they exist
+func SetClusterRoleManagement(enabled bool) {
+	clusterRoleManagement = enabled
+}
+
+// AddFlags defines the options of the authority controller in the flag set given, under the names with the prefix so
+// that they don't conflict with those of the other controllers in the same process
+func AddFlags(fs *flag.FlagSet, prefix string) {
+	fs.BoolVar(&clusterRoleManagement, prefix+"manage-cluster-roles", clusterRoleManagement, "create the cluster roles of authorities and keep their rules up to date, disable when they are managed externally such as by a GitOps tool")
+	fs.DurationVar(&teardownGracePeriod, prefix+"teardown-grace-period", teardownGracePeriod, "how long the teams of a disabled authority are kept before they are torn down, so that a brief disabling such as for maintenance leaves them in place, 0 to keep them until the authority is enabled again or deleted")
+}
+
 // Start function is entry point of the controller
-func Start() {
+func Start(settings *config.Config) {
+	if err := loop.Configure(settings); err != nil {
+		log.Fatal(err.Error())
+	}
 	clientset, err := authorization.CreateClientSet()
 	if err != nil {
 		log.Println(err.Error())
@@ -70,19 +110,89 @@ func Start() {
 		log.Println(err.Error())
 		panic(err.Error())
 	}
+	if err := authorization.EnsureCRDs(edgenetClientset.Discovery(), apps_v1alpha.SchemeGroupVersion.WithResource("authorities")); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	// Run the controller loop as a background task to start processing resources
+	go Run(clientset, edgenetClientset, settings, stopCh)
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+}
 
-	authorityHandler := &Handler{}
-	// Create the authority informer which was generated by the code generator to list and watch authority resources
+// Run creates the controller with the clientsets given and runs it until the stop channel closes,
+// which allows the controller to share the clientsets and the process with other controllers
+func Run(clientset kubernetes.Interface, edgenetClientset versioned.Interface, _ *config.Config, stopCh <-chan struct{}) {
+	authorityHandler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+	// Create the authority informer which was generated by the code generator to list and watch authority resources,
+	// it redelivers all authorities at the resync period so that their namespaces, cluster roles, and total resource
+	// quotas get rebuilt if deleted out-of-band
 	informer := appsinformer_v1.NewAuthorityInformer(
 		edgenetClientset,
-		0,
+		loop.ResyncPeriod(),
 		cache.Indexers{},
 	)
 	// Create a work queue which contains a key of the resource to be handled by the handler
 	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	informer.AddEventHandler(eventHandlers(queue))
+	controller := controller{
+		logger:   log.NewEntry(log.New()),
+		informer: informer,
+		queue:    queue,
+		handler:  authorityHandler,
+	}
+
+	if clusterRoleManagement {
+		ensureClusterRoles(clientset)
+	}
+
+	controller.run(stopCh)
+}
+
+// ensureClusterRoles creates the cluster roles that the role bindings of authorities refer to,
+// and brings the rules of the existing ones up to date
+func ensureClusterRoles(clientset kubernetes.Interface) {
+	for _, authorityRole := range clusterRoles() {
+		registration.SetManagedLabels(authorityRole, "authority")
+		if err := registration.EnsureClusterRole(authorityRole, clientset); err != nil {
+			log.Infof("Couldn't create %s cluster role: %s", authorityRole.GetName(), err)
+		}
+	}
+}
+
+// clusterRoles returns the cluster roles for authorities
+func clusterRoles() []*rbacv1.ClusterRole {
+	// Authority Admin
+	policyRule := []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"users", "users/status", "userregistrationrequests",
+		"userregistrationrequests/status", "slices", "slices/status", "teams", "teams/status", "nodecontributions", "permissions"}, Verbs: []string{"*"}},
+		{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"acceptableusepolicies"}, Verbs: []string{"get", "list"}}}
+	authorityAdmin := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: registration.ClusterRoleName("authority-admin")}, Rules: policyRule}
+	// Authority Manager
+	policyRule = []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"userregistrationrequests", "userregistrationrequests/status",
+		"slices", "slices/status", "teams", "teams/status"}, Verbs: []string{"*"}},
+		{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"users", "acceptableusepolicies", "nodecontributions"}, Verbs: []string{"get", "list"}}}
+	authorityManager := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: registration.ClusterRoleName("authority-manager")}, Rules: policyRule}
+	// Authority Tech
+	policyRule = []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"nodecontributions"}, Verbs: []string{"*"}}}
+	authorityTech := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: registration.ClusterRoleName("authority-tech")}, Rules: policyRule}
+	// Authority User
+	policyRule = []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"slices", "teams", "nodecontributions"}, Verbs: []string{"get", "list"}}}
+	authorityUser := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: registration.ClusterRoleName("authority-user")}, Rules: policyRule}
+	return []*rbacv1.ClusterRole{authorityAdmin, authorityManager, authorityTech, authorityUser}
+}
+
+// eventHandlers returns the handlers that put the events of authorities into the queue
+func eventHandlers(queue workqueue.RateLimitingInterface) cache.ResourceEventHandlerFuncs {
+	var err error
 	var event informerevent
 	// Event handlers deal with events of resources. Here, there are three types of events as Add, Update, and Delete
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	return cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			// Put the resource object into a key
 			event.key, err = cache.MetaNamespaceKeyFunc(obj)
@@ -96,9 +206,19 @@ func Start() {
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			event.key, err = cache.MetaNamespaceKeyFunc(newObj)
 			event.function = update
+			event.change = changedFields(oldObj.(*apps_v1alpha.Authority), newObj.(*apps_v1alpha.Authority))
+			// The updates of the metadata alone, such as the resource version and the managed fields, need no reconcile,
+			// unlike the redelivery of the authority on resync
+			if !event.change.spec && !event.change.enabled && !loop.IsResync(oldObj, newObj) {
+				return
+			}
 			log.Infof("Update authority: %s", event.key)
 			if err == nil {
-				queue.Add(event)
+				if loop.IsResync(oldObj, newObj) {
+					loop.AddWithJitter(queue, event)
+				} else {
+					queue.Add(event)
+				}
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
@@ -106,107 +226,26 @@ func Start() {
 			// Put the resource object into a key
 			event.key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 			event.function = delete
+			if authority, ok := obj.(*apps_v1alpha.Authority); ok {
+				event.change.object.name = authority.GetName()
+			} else if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				event.change.object.name = tombstone.Key
+			}
 			log.Infof("Delete authority: %s", event.key)
 			if err == nil {
 				queue.Add(event)
 			}
 		},
-	})
-	controller := controller{
-		logger:   log.NewEntry(log.New()),
-		informer: informer,
-		queue:    queue,
-		handler:  authorityHandler,
-	}
-
-	// Cluster Roles for Authorities
-	// Authority Admin
-	policyRule := []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"users", "users/status", "userregistrationrequests",
-		"userregistrationrequests/status", "slices", "slices/status", "teams", "teams/status", "nodecontributions"}, Verbs: []string{"*"}},
-		{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"acceptableusepolicies"}, Verbs: []string{"get", "list"}}}
-	authorityRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "authority-admin"},
-		Rules: policyRule}
-	_, err = clientset.RbacV1().ClusterRoles().Create(authorityRole)
-	if err != nil {
-		log.Infof("Couldn't create authority-admin cluster role: %s", err)
-		if errors.IsAlreadyExists(err) {
-			authorityClusterRole, err := clientset.RbacV1().ClusterRoles().Get(authorityRole.GetName(), metav1.GetOptions{})
-			if err == nil {
-				authorityClusterRole.Rules = policyRule
-				_, err = clientset.RbacV1().ClusterRoles().Update(authorityClusterRole)
-				if err == nil {
-					log.Infoln("Authority-admin cluster role updated")
-				}
-			}
-		}
-	}
-	// Authority Manager
-	policyRule = []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"userregistrationrequests", "userregistrationrequests/status",
-		"slices", "slices/status", "teams", "teams/status"}, Verbs: []string{"*"}},
-		{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"users", "acceptableusepolicies", "nodecontributions"}, Verbs: []string{"get", "list"}}}
-	authorityRole = &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "authority-manager"},
-		Rules: policyRule}
-	_, err = clientset.RbacV1().ClusterRoles().Create(authorityRole)
-	if err != nil {
-		log.Infof("Couldn't create authority-manager cluster role: %s", err)
-		if errors.IsAlreadyExists(err) {
-			authorityClusterRole, err := clientset.RbacV1().ClusterRoles().Get(authorityRole.GetName(), metav1.GetOptions{})
-			if err == nil {
-				authorityClusterRole.Rules = policyRule
-				_, err = clientset.RbacV1().ClusterRoles().Update(authorityClusterRole)
-				if err == nil {
-					log.Infoln("Authority-manager cluster role updated")
-				}
-			}
-		}
-	}
-	// Authority Tech
-	policyRule = []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"nodecontributions"}, Verbs: []string{"*"}}}
-	authorityRole = &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "authority-tech"},
-		Rules: policyRule}
-	_, err = clientset.RbacV1().ClusterRoles().Create(authorityRole)
-	if err != nil {
-		log.Infof("Couldn't create authority-tech cluster role: %s", err)
-		if errors.IsAlreadyExists(err) {
-			authorityClusterRole, err := clientset.RbacV1().ClusterRoles().Get(authorityRole.GetName(), metav1.GetOptions{})
-			if err == nil {
-				authorityClusterRole.Rules = policyRule
-				_, err = clientset.RbacV1().ClusterRoles().Update(authorityClusterRole)
-				if err == nil {
-					log.Infoln("Authority-tech cluster role updated")
-				}
-			}
-		}
-	}
-	// Authority User
-	policyRule = []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"slices", "teams", "nodecontributions"}, Verbs: []string{"get", "list"}}}
-	authorityRole = &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "authority-user"},
-		Rules: policyRule}
-	_, err = clientset.RbacV1().ClusterRoles().Create(authorityRole)
-	if err != nil {
-		log.Infof("Couldn't create authority-user cluster role: %s", err)
-		if errors.IsAlreadyExists(err) {
-			authorityClusterRole, err := clientset.RbacV1().ClusterRoles().Get(authorityRole.GetName(), metav1.GetOptions{})
-			if err == nil {
-				authorityClusterRole.Rules = policyRule
-				_, err = clientset.RbacV1().ClusterRoles().Update(authorityClusterRole)
-				if err == nil {
-					log.Infoln("Authority-user cluster role updated")
-				}
-			}
-		}
 	}
+}
 
-	// A channel to terminate elegantly
-	stopCh := make(chan struct{})
-	defer close(stopCh)
-	// Run the controller loop as a background task to start processing resources
-	go controller.run(stopCh)
-	// A channel to observe OS signals for smooth shut down
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, syscall.SIGTERM)
-	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
+// changedFields finds out which of the fields that the handler acts on have been updated
+func changedFields(oldObj, newObj *apps_v1alpha.Authority) fields {
+	change := fields{}
+	change.spec = !apiequality.Semantic.DeepEqual(oldObj.Spec, newObj.Spec)
+	change.enabled = oldObj.Status.Enabled != newObj.Status.Enabled
+	change.object.name = newObj.GetName()
+	return change
 }
 
 // Run starts the controller loop
@@ -220,8 +259,8 @@ func (c *controller) run(stopCh <-chan struct{}) {
 	// Run the informer to list and watch resources
 	go c.informer.Run(stopCh)
 
-	// Synchronization to settle resources one
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+	// Synchronization to settle resources one, the process exits to be restarted if the API server is unreachable
+	if !loop.WaitForCacheSync(c.logger, stopCh, c.informer.HasSynced) {
 		utilruntime.HandleError(fmt.Errorf("Error syncing cache"))
 		return
 	}
@@ -244,7 +283,7 @@ func (c *controller) runWorker() {
 }
 
 // This function deals with the queue and sends each item in it to the specified handler to be processed.
-func (c *controller) processNextItem() bool {
+func (c *controller) processNextItem() (processed bool) {
 	log.Info("processNextItem: start")
 	// Fetch the next item of the queue
 	event, quit := c.queue.Get()
@@ -254,6 +293,15 @@ func (c *controller) processNextItem() bool {
 	defer c.queue.Done(event)
 	// Get the key string
 	keyRaw := event.(informerevent).key
+	// A panic of the handler fails the item rather than the worker, which goes on with the next one
+	defer loop.Recover(c.logger, "authority", keyRaw, func(err error) {
+		if c.queue.NumRequeues(event) < 5 {
+			c.queue.AddRateLimited(event)
+		} else {
+			c.queue.Forget(event)
+		}
+		processed = true
+	})
 	// Use the string key to get the object from the indexer
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	if err != nil {
@@ -270,7 +318,7 @@ func (c *controller) processNextItem() bool {
 	if !exists {
 		if event.(informerevent).function == delete {
 			c.logger.Infof("Controller.processNextItem: object deleted detected: %s", keyRaw)
-			c.handler.ObjectDeleted(item)
+			c.handler.ObjectDeleted(item, event.(informerevent).change)
 		}
 	} else {
 		if event.(informerevent).function == create {
@@ -281,7 +329,13 @@ func (c *controller) processNextItem() bool {
 			c.logger.Infof("Controller.processNextItem: object updated detected: %s", keyRaw)
 			c.handler.ObjectUpdated(item)
 		}
+		// The teams of a disabled authority are torn down once their deadline has passed, the authority is processed
+		// again at the next deadline, which the queue keeps once however many times it is added
+		if delay, ok := c.handler.TeardownExpired(item); ok {
+			c.queue.AddAfter(informerevent{key: keyRaw, function: teardown}, delay)
+		}
 	}
+	events.Publish("Authority", keyRaw, event.(informerevent).function, nil)
 	c.queue.Forget(event.(informerevent).key)
 
 	return true
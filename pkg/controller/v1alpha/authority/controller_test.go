@@ -0,0 +1,114 @@
+package authority
+
+import (
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
+	"edgenet/pkg/mailer"
+	"edgenet/pkg/registration"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestUpdateFilter(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet", ResourceVersion: "1"},
+		Spec:   apps_v1alpha.AuthoritySpec{FullName: "EdgeNet", ShortName: "EdgeNet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	metadataUpdated := authority.DeepCopy()
+	metadataUpdated.ResourceVersion = "2"
+	metadataUpdated.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationUpdate}}
+	metadataUpdated.Status.Message = []string{"Authority successfully established"}
+	specUpdated := authority.DeepCopy()
+	specUpdated.ResourceVersion = "2"
+	specUpdated.Spec.FullName = "EdgeNet Testbed"
+	disabled := authority.DeepCopy()
+	disabled.ResourceVersion = "2"
+	disabled.Status.Enabled = false
+
+	data := []struct {
+		name     string
+		newObj   *apps_v1alpha.Authority
+		enqueued bool
+	}{
+		{"metadata only", metadataUpdated, false},
+		{"resync", authority.DeepCopy(), true},
+		{"spec", specUpdated, true},
+		{"enabled", disabled, true},
+	}
+	// The redelivery on resync is enqueued right away without jitter
+	loop.SetResyncJitter(0)
+	defer loop.SetResyncJitter(30 * time.Second)
+	for _, test := range data {
+		queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		eventHandlers(queue).OnUpdate(authority, test.newObj)
+		if enqueued := queue.Len() == 1; enqueued != test.enqueued {
+			t.Errorf("update of %s enqueued: %t, expected %t", test.name, enqueued, test.enqueued)
+		}
+		queue.ShutDown()
+	}
+}
+
+func TestClusterRolePrefix(t *testing.T) {
+	registration.SetClusterRolePrefix("edgenet:")
+	defer registration.SetClusterRolePrefix("")
+	clientset := testclient.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet"}})
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenettestclient.NewSimpleClientset()}
+
+	ensureClusterRoles(clientset)
+	handler.setClusterRoles(&apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"}})
+	expected := []string{"edgenet:authority-admin", "edgenet:authority-manager", "edgenet:authority-tech", "edgenet:authority-user", "edgenet:authority-edgenet"}
+	clusterRolesRaw, _ := clientset.RbacV1().ClusterRoles().List(metav1.ListOptions{})
+	if len(clusterRolesRaw.Items) != len(expected) {
+		t.Errorf("%d cluster roles created, expected %v", len(clusterRolesRaw.Items), expected)
+	}
+	for _, name := range expected {
+		if _, err := clientset.RbacV1().ClusterRoles().Get(name, metav1.GetOptions{}); err != nil {
+			t.Errorf("cluster role %s not created: %s", name, err)
+		}
+	}
+	// The cluster role of the authority goes along with it under the prefixed name
+	handler.ObjectDeleted(nil, fields{object: objectData{name: "edgenet"}})
+	if _, err := clientset.RbacV1().ClusterRoles().Get("edgenet:authority-edgenet", metav1.GetOptions{}); err == nil {
+		t.Error("cluster role of the authority left behind")
+	}
+}
+
+func TestClusterRoleManagementDisabled(t *testing.T) {
+	mailer.SetEnabled(false)
+	defer mailer.SetEnabled(true)
+	SetClusterRoleManagement(false)
+	defer SetClusterRoleManagement(true)
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Spec: apps_v1alpha.AuthoritySpec{Contact: apps_v1alpha.Contact{Username: "johndoe", Email: "john.doe@edge-net.org"}}}
+	clientset := testclient.NewSimpleClientset(&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet"}})
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority)
+	// The controller stops right after the start, which has ensured the cluster roles if they are managed
+	stopCh := make(chan struct{})
+	close(stopCh)
+	Run(clientset, edgenetClientset, config.Default(), stopCh)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+	handler.Init()
+	handler.authorityPreparation(authority.DeepCopy())
+	handler.authorityPreparation(authority.DeepCopy())
+	handler.ObjectDeleted(nil, fields{object: objectData{name: "edgenet"}})
+
+	for _, action := range clientset.Actions() {
+		if action.GetResource().Resource == "clusterroles" && action.GetVerb() != "get" && action.GetVerb() != "list" {
+			t.Errorf("cluster roles written while managed externally: %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+	if _, err := clientset.RbacV1().ClusterRoles().Get("authority-edgenet", metav1.GetOptions{}); err != nil {
+		t.Errorf("cluster role managed externally deleted: %s", err)
+	}
+	if _, err := clientset.CoreV1().Namespaces().Get("authority-edgenet", metav1.GetOptions{}); err == nil {
+		t.Error("authority namespace left behind")
+	}
+}
@@ -20,11 +20,16 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
 	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/controller/v1alpha/team"
+	userctl "edgenet/pkg/controller/v1alpha/user"
 	"edgenet/pkg/mailer"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
 
 	log "github.com/Sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
@@ -32,40 +37,57 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/kubernetes"
 )
 
+// SuspendedAnnotation marks a disabled authority and the users that its suspension deactivated,
+// which are activated again, along with their role bindings, once the authority is enabled
+const SuspendedAnnotation = "edge-net.io/suspended-by-authority"
+
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init() error
 	ObjectCreated(obj interface{})
 	ObjectUpdated(obj interface{})
-	ObjectDeleted(obj interface{})
+	ObjectDeleted(obj, deleted interface{})
+	TeardownExpired(obj interface{}) (time.Duration, bool)
 }
 
 // Handler implementation
 type Handler struct {
-	clientset        *kubernetes.Clientset
-	edgenetClientset *versioned.Clientset
+	clientset        kubernetes.Interface
+	edgenetClientset versioned.Interface
 	resourceQuota    *corev1.ResourceQuota
+	clock            clock.Clock
 }
 
 // Init handles any handler initialization
 func (t *Handler) Init() error {
 	log.Info("AuthorityHandler.Init")
 	var err error
-	t.clientset, err = authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clientsets may have been given to share them with other controllers
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
-	t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
+	}
+	// The clock may be injected as well, so that tests control the teardown deadlines
+	if t.clock == nil {
+		t.clock = clock.RealClock{}
 	}
 	t.resourceQuota = &corev1.ResourceQuota{}
 	t.resourceQuota.Name = "authority-quota"
+	registration.SetManagedLabels(t.resourceQuota, "authority")
 	t.resourceQuota.Spec = corev1.ResourceQuotaSpec{
 		Hard: map[corev1.ResourceName]resource.Quantity{
 			"cpu":                           resource.MustParse("5m"),
@@ -104,6 +126,10 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 		return
 	}
 	authorityCopy = t.authorityPreparation(authorityCopy)
+	// The teardown of the teams of a disabled authority is scheduled again once the controller restarts
+	if !authorityCopy.Status.Enabled {
+		t.scheduleTeardown(authorityCopy)
+	}
 }
 
 // ObjectUpdated is called when an object is updated
@@ -124,44 +150,233 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 	} else {
 		authorityCopy = t.authorityPreparation(authorityCopy)
 	}
-	// Check whether the authority disabled
+	// Disabling suspends the authority, which can be undone, whereas the deletion removes everything
 	if authorityCopy.Status.Enabled == false {
-		// Delete all RoleBindings, Teams, and Slices in the namespace of authority
-		t.edgenetClientset.AppsV1alpha().Slices(fmt.Sprintf("authority-%s", authorityCopy.GetName())).DeleteCollection(&metav1.DeleteOptions{}, metav1.ListOptions{})
-		t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", authorityCopy.GetName())).DeleteCollection(&metav1.DeleteOptions{}, metav1.ListOptions{})
-		t.clientset.RbacV1().RoleBindings(fmt.Sprintf("authority-%s", authorityCopy.GetName())).DeleteCollection(&metav1.DeleteOptions{}, metav1.ListOptions{})
-		// List all authority users to deactivate and to remove their cluster role binding to get the authority
-		usersRaw, _ := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", authorityCopy.GetName())).List(metav1.ListOptions{})
-		for _, user := range usersRaw.Items {
-			userCopy := user.DeepCopy()
+		t.suspend(authorityCopy)
+	} else {
+		t.restore(authorityCopy)
+	}
+}
+
+// suspend deactivates the users of the authority and removes the role bindings in its namespace and in those of its teams
+// and slices, while the teams, the slices, and their namespaces remain
+func (t *Handler) suspend(authorityCopy *apps_v1alpha.Authority) {
+	authorityNamespace := namespace.AuthorityName(authorityCopy.GetName())
+	if _, suspended := authorityCopy.GetAnnotations()[SuspendedAnnotation]; !suspended {
+		authorityCopy.SetAnnotations(withSuspendedAnnotation(authorityCopy.GetAnnotations()))
+		if _, err := t.edgenetClientset.AppsV1alpha().Authorities().Update(authorityCopy); err != nil {
+			log.Infof("Couldn't mark authority %s as suspended: %s", authorityCopy.GetName(), err)
+		}
+	}
+	// List all authority users to deactivate and to remove their cluster role binding to get the authority
+	usersRaw, _ := t.edgenetClientset.AppsV1alpha().Users(authorityNamespace).List(metav1.ListOptions{})
+	for _, user := range usersRaw.Items {
+		userCopy := user.DeepCopy()
+		if userCopy.Status.Active {
+			// The annotation tells the users to activate again on restore from those that were inactive beforehand
+			userCopy.SetAnnotations(withSuspendedAnnotation(userCopy.GetAnnotations()))
+			if userCopyUpdated, err := t.edgenetClientset.AppsV1alpha().Users(authorityNamespace).Update(userCopy); err == nil {
+				userCopy = userCopyUpdated
+			} else {
+				log.Infof("Couldn't mark user %s in %s as suspended: %s", userCopy.GetName(), authorityNamespace, err)
+			}
 			userCopy.Status.Active = false
-			t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).UpdateStatus(userCopy)
-			t.clientset.RbacV1().ClusterRoleBindings().Delete(fmt.Sprintf("%s-%s-for-authority", userCopy.GetNamespace(), userCopy.GetName()), &metav1.DeleteOptions{})
+			t.edgenetClientset.AppsV1alpha().Users(authorityNamespace).UpdateStatus(userCopy)
+		}
+		t.clientset.RbacV1().ClusterRoleBindings().Delete(fmt.Sprintf("%s-%s-for-authority", userCopy.GetNamespace(), userCopy.GetName()), &metav1.DeleteOptions{})
+	}
+	t.deleteRoleBindings(authorityNamespace, "authority", "user")
+	teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(authorityNamespace).List(metav1.ListOptions{})
+	if err == nil {
+		for _, teamRow := range teamsRaw.Items {
+			t.deleteRoleBindings(namespace.ChildName(teamRow.GetNamespace(), "team", teamRow.GetName()), "team")
 		}
 	}
+	for _, sliceRow := range t.listSlices(authorityNamespace) {
+		t.deleteRoleBindings(namespace.ChildName(sliceRow.GetNamespace(), "slice", sliceRow.GetName()), "slice")
+	}
+	// The teams are torn down if the authority is still disabled after the grace period
+	t.scheduleTeardown(authorityCopy)
+}
+
+// restore activates the users that the suspension of the authority deactivated and brings back the role bindings
+// in the namespaces of the authority, its teams, and its slices
+func (t *Handler) restore(authorityCopy *apps_v1alpha.Authority) {
+	authorityNamespace := namespace.AuthorityName(authorityCopy.GetName())
+	// Enabling the authority within the grace period keeps its teams
+	t.cancelTeardown(authorityNamespace)
+	usersRaw, err := t.edgenetClientset.AppsV1alpha().Users(authorityNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return
+	}
+	_, restored := authorityCopy.GetAnnotations()[SuspendedAnnotation]
+	for _, user := range usersRaw.Items {
+		if _, suspended := user.GetAnnotations()[SuspendedAnnotation]; !suspended {
+			continue
+		}
+		restored = true
+		userCopy := user.DeepCopy()
+		userCopy.Status.Active = true
+		if userCopyUpdated, err := t.edgenetClientset.AppsV1alpha().Users(authorityNamespace).UpdateStatus(userCopy); err == nil {
+			userCopy = userCopyUpdated
+		} else {
+			log.Infof("Couldn't activate user %s in %s: %s", userCopy.GetName(), authorityNamespace, err)
+			continue
+		}
+		userCopy.SetAnnotations(withoutSuspendedAnnotation(userCopy.GetAnnotations()))
+		t.edgenetClientset.AppsV1alpha().Users(authorityNamespace).Update(userCopy)
+		if userCopy.Status.AUP {
+			registration.CreateSpecificRoleBindings(userCopy, t.clientset)
+			registration.CreateRoleBindingsByRoles(userCopy, authorityNamespace, "Authority", t.clientset)
+		}
+	}
+	// There is nothing to restore unless the authority has been suspended
+	if !restored {
+		return
+	}
+	authorityCopy.SetAnnotations(withoutSuspendedAnnotation(authorityCopy.GetAnnotations()))
+	if _, err := t.edgenetClientset.AppsV1alpha().Authorities().Update(authorityCopy); err != nil {
+		log.Infof("Couldn't unmark authority %s as suspended: %s", authorityCopy.GetName(), err)
+	}
+	teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(authorityNamespace).List(metav1.ListOptions{})
+	if err == nil {
+		for _, teamRow := range teamsRaw.Items {
+			if !teamRow.Status.Enabled {
+				continue
+			}
+			if err := team.Reconcile(t.clientset, t.edgenetClientset, teamRow.GetNamespace(), teamRow.GetName()); err != nil {
+				log.Infof("Couldn't restore team %s in %s: %s", teamRow.GetName(), teamRow.GetNamespace(), err)
+			}
+		}
+	}
+	for _, sliceRow := range t.listSlices(authorityNamespace) {
+		team.RestoreSliceRoleBindings(t.clientset, t.edgenetClientset, sliceRow.DeepCopy(), authorityCopy.GetName())
+	}
+}
+
+// withSuspendedAnnotation returns the annotations along with the one that marks the object as suspended
+func withSuspendedAnnotation(annotations map[string]string) map[string]string {
+	annotated := map[string]string{SuspendedAnnotation: "true"}
+	for key, value := range annotations {
+		annotated[key] = value
+	}
+	return annotated
+}
+
+// withoutSuspendedAnnotation returns the annotations except the one that marks the object as suspended
+func withoutSuspendedAnnotation(annotations map[string]string) map[string]string {
+	unannotated := map[string]string{}
+	for key, value := range annotations {
+		if key != SuspendedAnnotation {
+			unannotated[key] = value
+		}
+	}
+	return unannotated
+}
+
+// listSlices returns the slices of the authority, both in the authority namespace and in the team namespaces
+func (t *Handler) listSlices(authorityNamespace string) []apps_v1alpha.Slice {
+	slices := []apps_v1alpha.Slice{}
+	namespaces := []string{authorityNamespace}
+	teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(authorityNamespace).List(metav1.ListOptions{})
+	if err == nil {
+		for _, teamRow := range teamsRaw.Items {
+			namespaces = append(namespaces, namespace.ChildName(teamRow.GetNamespace(), "team", teamRow.GetName()))
+		}
+	}
+	for _, slicesNamespace := range namespaces {
+		slicesRaw, err := t.edgenetClientset.AppsV1alpha().Slices(slicesNamespace).List(metav1.ListOptions{})
+		if err == nil {
+			slices = append(slices, slicesRaw.Items...)
+		}
+	}
+	return slices
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+func (t *Handler) ObjectDeleted(obj, deleted interface{}) {
 	log.Info("AuthorityHandler.ObjectDeleted")
+	fieldDeleted := deleted.(fields)
 	// Delete or disable nodes added by authority, TBD.
+	// Tear down the objects in the authority namespace in order rather than waiting for the garbage collector.
+	authorityNamespace := namespace.AuthorityName(fieldDeleted.object.name)
+	teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(authorityNamespace).List(metav1.ListOptions{})
+	if err == nil {
+		for _, teamRow := range teamsRaw.Items {
+			t.teardownTeam(teamRow.DeepCopy())
+		}
+	}
+	t.deleteSlices(authorityNamespace)
+	usersRaw, err := t.edgenetClientset.AppsV1alpha().Users(authorityNamespace).List(metav1.ListOptions{})
+	if err == nil {
+		for _, userRow := range usersRaw.Items {
+			t.clientset.RbacV1().ClusterRoleBindings().Delete(fmt.Sprintf("%s-%s-for-authority", userRow.GetNamespace(), userRow.GetName()), &metav1.DeleteOptions{})
+			t.edgenetClientset.AppsV1alpha().Users(authorityNamespace).Delete(userRow.GetName(), &metav1.DeleteOptions{})
+		}
+	}
+	t.deleteRoleBindings(authorityNamespace, "authority", "user")
+	if clusterRoleManagement {
+		t.clientset.RbacV1().ClusterRoles().Delete(registration.ClusterRoleName(authorityNamespace), &metav1.DeleteOptions{})
+	}
+	t.clientset.CoreV1().Namespaces().Delete(authorityNamespace, &metav1.DeleteOptions{})
+}
+
+// teardownTeam deletes the slices, role bindings, and child namespace of the team, and then the team itself
+func (t *Handler) teardownTeam(teamCopy *apps_v1alpha.Team) {
+	teamChildNamespace := namespace.ChildName(teamCopy.GetNamespace(), "team", teamCopy.GetName())
+	t.deleteSlices(teamChildNamespace)
+	t.deleteRoleBindings(teamChildNamespace, "team")
+	t.clientset.CoreV1().Namespaces().Delete(teamChildNamespace, &metav1.DeleteOptions{})
+	err := t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Delete(teamCopy.GetName(), &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		log.Infof("Couldn't delete team %s in %s: %s", teamCopy.GetName(), teamCopy.GetNamespace(), err)
+	}
+}
+
+// deleteSlices deletes the slices in the namespace along with their child namespaces
+func (t *Handler) deleteSlices(sliceNamespace string) {
+	slicesRaw, err := t.edgenetClientset.AppsV1alpha().Slices(sliceNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return
+	}
+	for _, sliceRow := range slicesRaw.Items {
+		sliceChildNamespace := namespace.ChildName(sliceNamespace, "slice", sliceRow.GetName())
+		t.deleteRoleBindings(sliceChildNamespace, "slice")
+		t.clientset.CoreV1().Namespaces().Delete(sliceChildNamespace, &metav1.DeleteOptions{})
+		t.edgenetClientset.AppsV1alpha().Slices(sliceNamespace).Delete(sliceRow.GetName(), &metav1.DeleteOptions{})
+	}
+}
+
+// deleteRoleBindings deletes one by one the role bindings in the namespace that the controllers created for the objects of the kinds given,
+// the others, such as the bindings of permissions or those that the cluster admins made, remain
+func (t *Handler) deleteRoleBindings(namespace string, ownerKinds ...string) {
+	for _, ownerKind := range ownerKinds {
+		roleBindingsRaw, err := t.clientset.RbacV1().RoleBindings(namespace).List(metav1.ListOptions{LabelSelector: registration.ManagedSelector(ownerKind)})
+		if err != nil {
+			continue
+		}
+		for _, roleBindingRow := range roleBindingsRaw.Items {
+			t.clientset.RbacV1().RoleBindings(namespace).Delete(roleBindingRow.GetName(), &metav1.DeleteOptions{})
+		}
+	}
 }
 
 // authorityPreparation basically generates a namespace and creates authority-admin
 func (t *Handler) authorityPreparation(authorityCopy *apps_v1alpha.Authority) *apps_v1alpha.Authority {
 	// If the service restarts, it creates all objects again
 	// Because of that, this section covers a variety of possibilities
-	_, err := t.clientset.CoreV1().Namespaces().Get(fmt.Sprintf("authority-%s", authorityCopy.GetName()), metav1.GetOptions{})
+	_, err := t.clientset.CoreV1().Namespaces().Get(namespace.AuthorityName(authorityCopy.GetName()), metav1.GetOptions{})
 	if err != nil {
 		t.setClusterRoles(authorityCopy)
 		// Automatically create a namespace to host users, slices, and teams
 		// When a authority is deleted, the owner references feature allows the namespace to be automatically removed
 		authorityOwnerReferences := t.setOwnerReferences(authorityCopy)
 		// Every namespace of a authority has the prefix as "authority" to provide singularity
-		authorityChildNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("authority-%s", authorityCopy.GetName()), OwnerReferences: authorityOwnerReferences}}
+		authorityChildNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace.AuthorityName(authorityCopy.GetName()), OwnerReferences: authorityOwnerReferences}}
 		// Namespace labels indicate this namespace created by a authority, not by a team or slice
 		namespaceLabels := map[string]string{"owner": "authority", "owner-name": authorityCopy.GetName(), "authority-name": authorityCopy.GetName()}
 		authorityChildNamespace.SetLabels(namespaceLabels)
+		registration.SetManagedLabels(authorityChildNamespace, "authority")
 		authorityChildNamespaceCreated, _ := t.clientset.CoreV1().Namespaces().Create(authorityChildNamespace)
 		// Create the resource quota to ban users from using this namespace for their applications
 		_, err = t.clientset.CoreV1().ResourceQuotas(authorityChildNamespaceCreated.GetName()).Create(t.resourceQuota)
@@ -189,7 +404,10 @@ func (t *Handler) authorityPreparation(authorityCopy *apps_v1alpha.Authority) *a
 			user.Spec.FirstName = authorityCopy.Spec.Contact.FirstName
 			user.Spec.LastName = authorityCopy.Spec.Contact.LastName
 			user.Spec.Roles = []string{"Admin"}
-			_, err = t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", authorityCopy.GetName())).Create(user.DeepCopy())
+			// The email address has been verified along with the authority request
+			user.SetAnnotations(map[string]string{userctl.EmailVerifiedAnnotation: "true"})
+			registration.SetManagedLabels(&user, "authority")
+			_, err = t.edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(authorityCopy.GetName())).Create(user.DeepCopy())
 			if err != nil {
 				t.sendEmail(authorityCopy, "user-creation-failure")
 				authorityCopy.Status.State = failure
@@ -207,23 +425,16 @@ func (t *Handler) authorityPreparation(authorityCopy *apps_v1alpha.Authority) *a
 
 // setClusterRoles create or update the cluster role attached to the authority
 func (t *Handler) setClusterRoles(authorityCopy *apps_v1alpha.Authority) {
+	// The cluster role is expected to exist when the cluster roles are managed externally
+	if !clusterRoleManagement {
+		return
+	}
 	// Create a cluster role to be used by authority users
 	policyRule := []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"authorities", "totalresourcequotas"}, ResourceNames: []string{authorityCopy.GetName()}, Verbs: []string{"get"}}}
-	authorityRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("authority-%s", authorityCopy.GetName())}, Rules: policyRule}
-	_, err := t.clientset.RbacV1().ClusterRoles().Create(authorityRole)
-	if err != nil {
-		log.Infof("Couldn't create authority-%s role: %s", authorityCopy.GetName(), err)
-		log.Infoln(errors.IsAlreadyExists(err))
-		if errors.IsAlreadyExists(err) {
-			authorityClusterRole, err := t.clientset.RbacV1().ClusterRoles().Get(authorityRole.GetName(), metav1.GetOptions{})
-			if err == nil {
-				authorityClusterRole.Rules = policyRule
-				_, err = t.clientset.RbacV1().ClusterRoles().Update(authorityClusterRole)
-				if err == nil {
-					log.Infof("Authority-%s cluster role updated", authorityCopy.GetName())
-				}
-			}
-		}
+	authorityRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: registration.ClusterRoleName(fmt.Sprintf("authority-%s", authorityCopy.GetName()))}, Rules: policyRule}
+	registration.SetManagedLabels(authorityRole, "authority")
+	if err := registration.EnsureClusterRole(authorityRole, t.clientset); err != nil {
+		log.Infof("Couldn't create %s cluster role: %s", authorityRole.GetName(), err)
 	}
 }
 
@@ -233,6 +444,7 @@ func (t *Handler) createTotalResourceQuota(authorityCopy *apps_v1alpha.Authority
 		// Set a total resource quota
 		authorityTRQ := apps_v1alpha.TotalResourceQuota{}
 		authorityTRQ.SetName(authorityCopy.GetName())
+		registration.SetManagedLabels(&authorityTRQ, "authority")
 		authorityTRQClaim := apps_v1alpha.TotalResourceDetails{}
 		authorityTRQClaim.Name = "Default"
 		authorityTRQClaim.CPU = "12000m"
@@ -265,7 +477,7 @@ func (t *Handler) checkDuplicateObject(authorityCopy *apps_v1alpha.Authority) (b
 	userRaw, _ := t.edgenetClientset.AppsV1alpha().Users("").List(metav1.ListOptions{})
 	for _, userRow := range userRaw.Items {
 		if userRow.Spec.Email == authorityCopy.Spec.Contact.Email {
-			if userRow.GetNamespace() == fmt.Sprintf("authority-%s", authorityCopy.GetName()) && userRow.GetName() == strings.ToLower(authorityCopy.Spec.Contact.Username) {
+			if userRow.GetNamespace() == namespace.AuthorityName(authorityCopy.GetName()) && userRow.GetName() == strings.ToLower(authorityCopy.Spec.Contact.Username) {
 				continue
 			}
 			exists = true
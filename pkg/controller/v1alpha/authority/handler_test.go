@@ -0,0 +1,326 @@
+package authority
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	"edgenet/pkg/mailer"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// managedLabels returns the labels of the resources that the controllers create for the objects of the kind given
+func managedLabels(ownerKind string) map[string]string {
+	return map[string]string{registration.ManagedByLabel: registration.ManagedBy, registration.OwnerKindLabel: ownerKind}
+}
+
+func TestObjectDeletedTearsDownTeams(t *testing.T) {
+	objects := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet"}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet"}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authority-admin", Namespace: "authority-edgenet", Labels: managedLabels("authority")}},
+	}
+	edgenetObjects := []runtime.Object{}
+	for _, teamName := range []string{"alpha", "beta"} {
+		teamChildNamespace := fmt.Sprintf("authority-edgenet-team-%s", teamName)
+		edgenetObjects = append(edgenetObjects,
+			&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: teamName, Namespace: "authority-edgenet"}},
+			&apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: teamChildNamespace}})
+		objects = append(objects,
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: teamChildNamespace}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-slice-demo", teamChildNamespace)}},
+			&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "team-user", Namespace: teamChildNamespace, Labels: managedLabels("team")}})
+	}
+	clientset := testclient.NewSimpleClientset(objects...)
+	edgenetClientset := edgenettestclient.NewSimpleClientset(edgenetObjects...)
+	// Record the deletions in the order that they are made and let the tracker handle them
+	deletions := []string{}
+	record := func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deleteAction := action.(k8stesting.DeleteAction)
+		deletions = append(deletions, fmt.Sprintf("%s/%s/%s", action.GetResource().Resource, action.GetNamespace(), deleteAction.GetName()))
+		return false, nil, nil
+	}
+	clientset.PrependReactor("delete", "*", record)
+	edgenetClientset.PrependReactor("delete", "*", record)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+
+	handler.ObjectDeleted(nil, fields{object: objectData{name: "edgenet"}})
+
+	index := func(deletion string) int {
+		for i, value := range deletions {
+			if value == deletion {
+				return i
+			}
+		}
+		t.Fatalf("%s not deleted, deletions: %v", deletion, deletions)
+		return -1
+	}
+	for _, teamName := range []string{"alpha", "beta"} {
+		teamChildNamespace := fmt.Sprintf("authority-edgenet-team-%s", teamName)
+		order := []int{
+			index(fmt.Sprintf("slices/%s/demo", teamChildNamespace)),
+			index(fmt.Sprintf("rolebindings/%s/team-user", teamChildNamespace)),
+			index(fmt.Sprintf("namespaces//%s", teamChildNamespace)),
+			index(fmt.Sprintf("teams/authority-edgenet/%s", teamName)),
+		}
+		for i := 1; i < len(order); i++ {
+			if order[i-1] > order[i] {
+				t.Errorf("team %s torn down out of order: %v", teamName, deletions)
+			}
+		}
+		if index(fmt.Sprintf("namespaces//%s-slice-demo", teamChildNamespace)) > index(fmt.Sprintf("namespaces//%s", teamChildNamespace)) {
+			t.Errorf("slice namespace of team %s deleted after the team namespace: %v", teamName, deletions)
+		}
+	}
+	if index("rolebindings/authority-edgenet/authority-admin") > index("namespaces//authority-edgenet") {
+		t.Errorf("authority role bindings deleted after the namespace: %v", deletions)
+	}
+	index("clusterroles//authority-edgenet")
+	if teamsRaw, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").List(metav1.ListOptions{}); len(teamsRaw.Items) != 0 {
+		t.Errorf("teams left behind: %v", teamsRaw.Items)
+	}
+	if namespacesRaw, _ := clientset.CoreV1().Namespaces().List(metav1.ListOptions{}); len(namespacesRaw.Items) != 0 {
+		t.Errorf("namespaces left behind: %v", namespacesRaw.Items)
+	}
+}
+
+func TestSuspendAndRestore(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Spec:   apps_v1alpha.AuthoritySpec{Contact: apps_v1alpha.Contact{Username: "joe", Email: "joe@edge-net.org"}},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	joe := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "joe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Email: "joe@edge-net.org", Roles: []string{"Admin"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	// A user who hasn't verified the email address yet
+	ann := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "ann", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Email: "ann@edge-net.org", Roles: []string{"User"}},
+		Status: apps_v1alpha.UserStatus{Active: false, AUP: true}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "lab", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "joe"}}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	slice := &apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet-team-lab"},
+		Spec: apps_v1alpha.SliceSpec{Users: []apps_v1alpha.SliceUsers{{Authority: "edgenet", Username: "joe"}}}}
+	namespaces := []string{"authority-edgenet", "authority-edgenet-team-lab", "authority-edgenet-team-lab-slice-demo"}
+	clientset := testclient.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+			Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-team-lab",
+			Labels: map[string]string{"owner": "team", "owner-name": "lab", "authority-name": "edgenet"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-team-lab-slice-demo",
+			Labels: map[string]string{"owner": "slice", "owner-name": "demo", "authority-name": "edgenet"}}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-joe-authority-admin", Namespace: "authority-edgenet", Labels: managedLabels("authority")}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-user-joe", Namespace: "authority-edgenet", Labels: managedLabels("user")}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-joe-team-admin", Namespace: "authority-edgenet-team-lab", Labels: managedLabels("team")}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-joe-slice-admin", Namespace: "authority-edgenet-team-lab-slice-demo", Labels: managedLabels("slice")}},
+		// The bindings that the controller of the authority didn't create, which the suspension leaves alone
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "monitoring", Namespace: "authority-edgenet"}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "monitoring", Namespace: "authority-edgenet-team-lab"}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "permission-audit-monitoring", Namespace: "authority-edgenet-team-lab", Labels: managedLabels("permission")}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "permission-audit-monitoring", Namespace: "authority-edgenet-team-lab-slice-demo", Labels: managedLabels("permission")}})
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, joe, ann, team, slice)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset, resourceQuota: &corev1.ResourceQuota{}}
+	setEnabled := func(enabled bool) {
+		authorityCopy, _ := edgenetClientset.AppsV1alpha().Authorities().Get("edgenet", metav1.GetOptions{})
+		authorityCopy.Status.Enabled = enabled
+		authorityCopy, _ = edgenetClientset.AppsV1alpha().Authorities().UpdateStatus(authorityCopy)
+		handler.ObjectUpdated(authorityCopy)
+	}
+	roleBindings := func(namespace string) []string {
+		names := []string{}
+		roleBindingsRaw, _ := clientset.RbacV1().RoleBindings(namespace).List(metav1.ListOptions{LabelSelector: registration.ManagedByLabel + "=" + registration.ManagedBy})
+		for _, roleBindingRow := range roleBindingsRaw.Items {
+			names = append(names, roleBindingRow.GetName())
+		}
+		return names
+	}
+
+	for round := 1; round <= 2; round++ {
+		setEnabled(false)
+		for _, namespace := range namespaces {
+			if _, err := clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{}); err != nil {
+				t.Errorf("round %d: namespace %s removed on suspension: %s", round, namespace, err)
+			}
+			for _, name := range roleBindings(namespace) {
+				if !strings.HasPrefix(name, "permission-") {
+					t.Errorf("round %d: role binding %s left in %s on suspension", round, name, namespace)
+				}
+			}
+		}
+		kept := func(stage string) {
+			for _, roleBinding := range [][2]string{{"authority-edgenet", "monitoring"}, {"authority-edgenet-team-lab", "monitoring"},
+				{"authority-edgenet-team-lab", "permission-audit-monitoring"}, {"authority-edgenet-team-lab-slice-demo", "permission-audit-monitoring"}} {
+				if _, err := clientset.RbacV1().RoleBindings(roleBinding[0]).Get(roleBinding[1], metav1.GetOptions{}); err != nil {
+					t.Errorf("round %d: role binding %s in %s removed on %s: %s", round, roleBinding[1], roleBinding[0], stage, err)
+				}
+			}
+		}
+		kept("suspension")
+		if _, err := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("lab", metav1.GetOptions{}); err != nil {
+			t.Errorf("round %d: team removed on suspension: %s", round, err)
+		}
+		if _, err := edgenetClientset.AppsV1alpha().Slices("authority-edgenet-team-lab").Get("demo", metav1.GetOptions{}); err != nil {
+			t.Errorf("round %d: slice removed on suspension: %s", round, err)
+		}
+		if user, _ := edgenetClientset.AppsV1alpha().Users("authority-edgenet").Get("joe", metav1.GetOptions{}); user.Status.Active {
+			t.Errorf("round %d: user joe active on suspension", round)
+		}
+
+		setEnabled(true)
+		expected := map[string]string{
+			"authority-edgenet":                     "authority-edgenet-joe-authority-admin",
+			"authority-edgenet-team-lab":            "authority-edgenet-joe-team-admin",
+			"authority-edgenet-team-lab-slice-demo": "authority-edgenet-joe-slice-admin",
+		}
+		for namespace, name := range expected {
+			if _, err := clientset.RbacV1().RoleBindings(namespace).Get(name, metav1.GetOptions{}); err != nil {
+				t.Errorf("round %d: role binding %s not restored in %s: %s", round, name, namespace, err)
+			}
+		}
+		kept("restore")
+		user, _ := edgenetClientset.AppsV1alpha().Users("authority-edgenet").Get("joe", metav1.GetOptions{})
+		if _, suspended := user.GetAnnotations()[SuspendedAnnotation]; !user.Status.Active || suspended {
+			t.Errorf("round %d: user joe not restored: active %t, annotations %v", round, user.Status.Active, user.GetAnnotations())
+		}
+		// The user who was inactive beforehand stays inactive
+		if user, _ := edgenetClientset.AppsV1alpha().Users("authority-edgenet").Get("ann", metav1.GetOptions{}); user.Status.Active {
+			t.Errorf("round %d: user ann activated on restore", round)
+		}
+		if authorityCopy, _ := edgenetClientset.AppsV1alpha().Authorities().Get("edgenet", metav1.GetOptions{}); len(authorityCopy.GetAnnotations()) != 0 {
+			t.Errorf("round %d: authority still marked as suspended: %v", round, authorityCopy.GetAnnotations())
+		}
+	}
+}
+
+func TestAuthorityPreparationLabels(t *testing.T) {
+	mailer.SetEnabled(false)
+	defer mailer.SetEnabled(true)
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Spec: apps_v1alpha.AuthoritySpec{Contact: apps_v1alpha.Contact{Username: "johndoe", Email: "john.doe@edge-net.org"}}}
+	clientset := testclient.NewSimpleClientset()
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+	handler.Init()
+	handler.authorityPreparation(authority.DeepCopy())
+
+	managed := func(kind string, object metav1.Object, err error) {
+		if err != nil {
+			t.Errorf("%s not created: %s", kind, err)
+		} else if labels := object.GetLabels(); labels["app.kubernetes.io/managed-by"] != "edgenet" || labels["edge-net.io/owner-kind"] != "authority" {
+			t.Errorf("%s %s labeled %v", kind, object.GetName(), labels)
+		}
+	}
+	childNamespace, err := clientset.CoreV1().Namespaces().Get("authority-edgenet", metav1.GetOptions{})
+	managed("namespace", childNamespace, err)
+	resourceQuota, err := clientset.CoreV1().ResourceQuotas("authority-edgenet").Get("authority-quota", metav1.GetOptions{})
+	managed("resource quota", resourceQuota, err)
+	clusterRole, err := clientset.RbacV1().ClusterRoles().Get("authority-edgenet", metav1.GetOptions{})
+	managed("cluster role", clusterRole, err)
+	TRQ, err := edgenetClientset.AppsV1alpha().TotalResourceQuotas().Get("edgenet", metav1.GetOptions{})
+	managed("total resource quota", TRQ, err)
+	admin, err := edgenetClientset.AppsV1alpha().Users("authority-edgenet").Get("johndoe", metav1.GetOptions{})
+	managed("user", admin, err)
+}
+
+func TestAuthorityPreparationCustomNameFormat(t *testing.T) {
+	mailer.SetEnabled(false)
+	defer mailer.SetEnabled(true)
+	defer namespace.SetNameFormats("authority-%s", "%s-%s-%s")
+	if err := namespace.SetNameFormats("east-authority-%s", "%s-%s-%s"); err != nil {
+		t.Fatal(err)
+	}
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Spec: apps_v1alpha.AuthoritySpec{Contact: apps_v1alpha.Contact{Username: "johndoe", Email: "john.doe@edge-net.org"}}}
+	clientset := testclient.NewSimpleClientset()
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+	handler.Init()
+	handler.authorityPreparation(authority.DeepCopy())
+
+	if _, err := clientset.CoreV1().Namespaces().Get("east-authority-edgenet", metav1.GetOptions{}); err != nil {
+		t.Errorf("authority namespace not created by the format: %s", err)
+	}
+	if _, err := edgenetClientset.AppsV1alpha().Users("east-authority-edgenet").Get("johndoe", metav1.GetOptions{}); err != nil {
+		t.Errorf("authority admin not created in the authority namespace: %s", err)
+	}
+	// The cluster role of the authority is not a namespace, so its name doesn't follow the format
+	if _, err := clientset.RbacV1().ClusterRoles().Get("authority-edgenet", metav1.GetOptions{}); err != nil {
+		t.Errorf("cluster role of the authority not created: %s", err)
+	}
+}
+
+func TestTeardownGracePeriod(t *testing.T) {
+	defer SetTeardownGracePeriod(0)
+	SetTeardownGracePeriod(time.Hour)
+
+	for _, reenabled := range []bool{false, true} {
+		fakeClock := clock.NewFakeClock(time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC))
+		authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+			Spec:   apps_v1alpha.AuthoritySpec{Contact: apps_v1alpha.Contact{Username: "joe", Email: "joe@edge-net.org"}},
+			Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+		team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "lab", Namespace: "authority-edgenet"},
+			Status: apps_v1alpha.TeamStatus{Enabled: true}}
+		clientset := testclient.NewSimpleClientset(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+				Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-team-lab",
+				Labels: map[string]string{"owner": "team", "owner-name": "lab", "authority-name": "edgenet"}}})
+		edgenetClientset := edgenettestclient.NewSimpleClientset(authority, team)
+		handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset, resourceQuota: &corev1.ResourceQuota{}, clock: fakeClock}
+		setEnabled := func(enabled bool) *apps_v1alpha.Authority {
+			authorityCopy, _ := edgenetClientset.AppsV1alpha().Authorities().Get("edgenet", metav1.GetOptions{})
+			authorityCopy.Status.Enabled = enabled
+			authorityCopy, _ = edgenetClientset.AppsV1alpha().Authorities().UpdateStatus(authorityCopy)
+			handler.ObjectUpdated(authorityCopy)
+			return authorityCopy
+		}
+
+		disabled := setEnabled(false)
+		teamMarked, err := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("lab", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("team torn down right away: %s", err)
+		}
+		if deadline := teamMarked.GetAnnotations()[TeardownDeadlineAnnotation]; deadline != "2020-06-01T13:00:00Z" {
+			t.Errorf("teardown deadline is %q", deadline)
+		}
+		if delay, ok := handler.TeardownExpired(disabled); !ok || delay != time.Hour {
+			t.Fatalf("authority processed again in %s (%t), expected after the grace period", delay, ok)
+		}
+		// An update while the authority is still disabled keeps the deadline, whereas enabling it cancels the teardown
+		fakeClock.Step(30 * time.Minute)
+		updated := setEnabled(reenabled)
+		if delay, ok := handler.TeardownExpired(updated); ok != !reenabled || (ok && delay != 30*time.Minute) {
+			t.Errorf("authority processed again in %s (%t) after the update", delay, ok)
+		}
+		// The controller processes the authority again at the deadline, even after a restart
+		fakeClock.Step(time.Hour)
+		restarted := &Handler{clientset: clientset, edgenetClientset: edgenetClientset, resourceQuota: &corev1.ResourceQuota{}, clock: fakeClock}
+		if _, ok := restarted.TeardownExpired(updated); ok {
+			t.Error("authority processed again after its teams are torn down")
+		}
+
+		_, teamErr := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("lab", metav1.GetOptions{})
+		_, namespaceErr := clientset.CoreV1().Namespaces().Get("authority-edgenet-team-lab", metav1.GetOptions{})
+		if reenabled {
+			if teamErr != nil || namespaceErr != nil {
+				t.Errorf("team torn down after the authority was enabled within the grace period: %v, %v", teamErr, namespaceErr)
+			}
+			if teamKept, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("lab", metav1.GetOptions{}); teamKept != nil && len(teamKept.GetAnnotations()) != 0 {
+				t.Errorf("teardown not canceled, annotations are %v", teamKept.GetAnnotations())
+			}
+		} else if teamErr == nil || namespaceErr == nil {
+			t.Error("team kept after the grace period while the authority is still disabled")
+		}
+	}
+}
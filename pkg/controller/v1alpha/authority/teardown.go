@@ -0,0 +1,136 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authority
+
+import (
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/namespace"
+
+	log "github.com/Sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TeardownDeadlineAnnotation marks the teams of a disabled authority with the time after which they are torn down
+// unless the authority has been enabled again
+const TeardownDeadlineAnnotation = "edge-net.io/teardown-deadline"
+
+// teardownGracePeriod is how long the teams of a disabled authority are kept, so that a brief disabling such as for
+// maintenance leaves them in place, 0 keeps them until the authority is enabled again or deleted
+var teardownGracePeriod time.Duration
+
+// SetTeardownGracePeriod configures how long the teams of a disabled authority are kept before they are torn down,
+// 0 to keep them
+func SetTeardownGracePeriod(period time.Duration) {
+	teardownGracePeriod = period
+}
+
+// scheduleTeardown marks the teams of the disabled authority with the deadline of their teardown, the teams already
+// marked keep their deadline. The controller tears them down once their deadline has passed, see TeardownExpired
+func (t *Handler) scheduleTeardown(authorityCopy *apps_v1alpha.Authority) {
+	if teardownGracePeriod <= 0 {
+		return
+	}
+	teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(namespace.AuthorityName(authorityCopy.GetName())).List(metav1.ListOptions{})
+	if err != nil {
+		log.Infof("Couldn't list the teams of authority %s to schedule their teardown: %s", authorityCopy.GetName(), err)
+		return
+	}
+	for _, teamRow := range teamsRaw.Items {
+		if _, marked := teamRow.GetAnnotations()[TeardownDeadlineAnnotation]; marked {
+			continue
+		}
+		teamCopy := teamRow.DeepCopy()
+		annotations := map[string]string{TeardownDeadlineAnnotation: t.clock.Now().Add(teardownGracePeriod).UTC().Format(time.RFC3339)}
+		for key, value := range teamCopy.GetAnnotations() {
+			annotations[key] = value
+		}
+		teamCopy.SetAnnotations(annotations)
+		if _, err := t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Update(teamCopy); err != nil {
+			log.Infof("Couldn't mark team %s in %s for teardown: %s", teamCopy.GetName(), teamCopy.GetNamespace(), err)
+		}
+	}
+}
+
+// TeardownExpired tears down the teams of the authority whose deadline has passed while the authority is still
+// disabled, and returns how long until the deadline of the next team, if any, so that the controller processes the
+// authority again then. As the deadlines are kept in the teams, the teardown resumes after a restart.
+func (t *Handler) TeardownExpired(obj interface{}) (time.Duration, bool) {
+	if teardownGracePeriod <= 0 {
+		return 0, false
+	}
+	authorityName := obj.(*apps_v1alpha.Authority).GetName()
+	authorityCopy, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(authorityName, metav1.GetOptions{})
+	// The deletion of the authority tears down its teams by itself
+	if err != nil || authorityCopy.Status.Enabled {
+		return 0, false
+	}
+	teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(namespace.AuthorityName(authorityName)).List(metav1.ListOptions{})
+	if err != nil {
+		log.Infof("Couldn't list the teams of authority %s to tear them down: %s", authorityName, err)
+		return 0, false
+	}
+	var next time.Time
+	for _, teamRow := range teamsRaw.Items {
+		value, marked := teamRow.GetAnnotations()[TeardownDeadlineAnnotation]
+		if !marked {
+			continue
+		}
+		deadline, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			log.Infof("Team %s in %s has a malformed teardown deadline %q: %s", teamRow.GetName(), teamRow.GetNamespace(), value, err)
+			continue
+		}
+		if t.clock.Now().Before(deadline) {
+			if next.IsZero() || deadline.Before(next) {
+				next = deadline
+			}
+			continue
+		}
+		log.Infof("Authority %s is still disabled after the grace period, tearing down team %s", authorityName, teamRow.GetName())
+		t.teardownTeam(teamRow.DeepCopy())
+	}
+	if next.IsZero() {
+		return 0, false
+	}
+	return next.Sub(t.clock.Now()), true
+}
+
+// cancelTeardown unmarks the teams of the authority enabled again within the grace period
+func (t *Handler) cancelTeardown(authorityNamespace string) {
+	teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(authorityNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return
+	}
+	for _, teamRow := range teamsRaw.Items {
+		if _, marked := teamRow.GetAnnotations()[TeardownDeadlineAnnotation]; !marked {
+			continue
+		}
+		teamCopy := teamRow.DeepCopy()
+		annotations := map[string]string{}
+		for key, value := range teamCopy.GetAnnotations() {
+			if key != TeardownDeadlineAnnotation {
+				annotations[key] = value
+			}
+		}
+		teamCopy.SetAnnotations(annotations)
+		if _, err := t.edgenetClientset.AppsV1alpha().Teams(authorityNamespace).Update(teamCopy); err != nil {
+			log.Infof("Couldn't cancel the teardown of team %s in %s: %s", teamCopy.GetName(), authorityNamespace, err)
+		}
+	}
+}
@@ -23,12 +23,17 @@ import (
 	"syscall"
 	"time"
 
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/client/clientset/versioned"
 	appsinformer_v1 "edgenet/pkg/client/informers/externalversions/apps/v1alpha"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 
 	log "github.com/Sirupsen/logrus"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
@@ -56,14 +61,46 @@ const issue = "Malfunction"
 const success = "Successful"
 
 // Start function is entry point of the controller
-func Start() {
+func Start(settings *config.Config) {
+	if err := loop.Configure(settings); err != nil {
+		log.Fatal(err.Error())
+	}
+	clientset, err := authorization.CreateClientSet()
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
 	edgenetClientset, err := authorization.CreateEdgeNetClientSet()
 	if err != nil {
 		log.Println(err.Error())
 		panic(err.Error())
 	}
+	if err := authorization.EnsureCRDs(edgenetClientset.Discovery(), apps_v1alpha.SchemeGroupVersion.WithResource("authorityrequests")); err != nil {
+		log.Fatal(err.Error())
+	}
 
-	authorityRequestHandler := &Handler{}
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	// Run the controller loop as a background task to start processing resources
+	go Run(clientset, edgenetClientset, settings, stopCh)
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+}
+
+// Run creates the controller with the clientsets given and runs it until the stop channel closes,
+// which allows the controller to share the clientsets and the process with other controllers
+func Run(clientset kubernetes.Interface, edgenetClientset versioned.Interface, _ *config.Config, stopCh <-chan struct{}) {
+	newController(clientset, edgenetClientset).run(stopCh)
+}
+
+// newController creates the controller along with its handler, both of which use the clientsets given
+func newController(clientset kubernetes.Interface, edgenetClientset versioned.Interface) *controller {
+	var err error
+	authorityRequestHandler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
 	// Create the authorityrequest informer which was generated by the code generator to list and watch authorityrequest resources
 	informer := appsinformer_v1.NewAuthorityRequestInformer(
 		edgenetClientset,
@@ -111,16 +148,7 @@ func Start() {
 		handler:  authorityRequestHandler,
 	}
 
-	// A channel to terminate elegantly
-	stopCh := make(chan struct{})
-	defer close(stopCh)
-	// Run the controller loop as a background task to start processing resources
-	go controller.run(stopCh)
-	// A channel to observe OS signals for smooth shut down
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, syscall.SIGTERM)
-	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
+	return &controller
 }
 
 // Run starts the controller loop
@@ -134,8 +162,8 @@ func (c *controller) run(stopCh <-chan struct{}) {
 	// Run the informer to list and watch resources
 	go c.informer.Run(stopCh)
 
-	// Synchronization to settle resources one
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+	// Synchronization to settle resources one, the process exits to be restarted if the API server is unreachable
+	if !loop.WaitForCacheSync(c.logger, stopCh, c.informer.HasSynced) {
 		utilruntime.HandleError(fmt.Errorf("Error syncing cache"))
 		return
 	}
@@ -158,7 +186,7 @@ func (c *controller) runWorker() {
 }
 
 // This function deals with the queue and sends each item in it to the specified handler to be processed.
-func (c *controller) processNextItem() bool {
+func (c *controller) processNextItem() (processed bool) {
 	log.Info("processNextItem: start")
 	// Fetch the next item of the queue
 	event, quit := c.queue.Get()
@@ -168,6 +196,15 @@ func (c *controller) processNextItem() bool {
 	defer c.queue.Done(event)
 	// Get the key string
 	keyRaw := event.(informerevent).key
+	// A panic of the handler fails the item rather than the worker, which goes on with the next one
+	defer loop.Recover(c.logger, "authorityrequest", keyRaw, func(err error) {
+		if c.queue.NumRequeues(event) < 5 {
+			c.queue.AddRateLimited(event)
+		} else {
+			c.queue.Forget(event)
+		}
+		processed = true
+	})
 	// Use the string key to get the object from the indexer
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	if err != nil {
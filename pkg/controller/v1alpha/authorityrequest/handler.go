@@ -42,23 +42,28 @@ type HandlerInterface interface {
 
 // Handler implementation
 type Handler struct {
-	clientset        *kubernetes.Clientset
-	edgenetClientset *versioned.Clientset
+	clientset        kubernetes.Interface
+	edgenetClientset versioned.Interface
 }
 
 // Init handles any handler initialization
 func (t *Handler) Init() error {
 	log.Info("authorityRequestHandler.Init")
 	var err error
-	t.clientset, err = authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clientsets may be injected beforehand, such as those that the controllers in a process share
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
-	t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
 	return err
 }
@@ -27,7 +27,10 @@ import (
 
 	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/client/clientset/versioned"
 	appsinformer_v1 "edgenet/pkg/client/informers/externalversions/apps/v1alpha"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 	"edgenet/pkg/node"
 
 	log "github.com/Sirupsen/logrus"
@@ -38,6 +41,7 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
@@ -92,7 +96,10 @@ const falseStr = "False"
 const unknownStr = "Unknown"
 
 // Start function is entry point of the controller
-func Start() {
+func Start(settings *config.Config) {
+	if err := loop.Configure(settings); err != nil {
+		log.Fatal(err.Error())
+	}
 	clientset, err := authorization.CreateClientSet()
 	if err != nil {
 		log.Println(err.Error())
@@ -103,8 +110,32 @@ func Start() {
 		log.Println(err.Error())
 		panic(err.Error())
 	}
+	if err := authorization.EnsureCRDs(edgenetClientset.Discovery(), apps_v1alpha.SchemeGroupVersion.WithResource("nodecontributions")); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	// Run the controller loop as a background task to start processing resources
+	go Run(clientset, edgenetClientset, settings, stopCh)
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+}
+
+// Run creates the controller with the clientsets given and runs it until the stop channel closes,
+// which allows the controller to share the clientsets and the process with other controllers
+func Run(clientset kubernetes.Interface, edgenetClientset versioned.Interface, _ *config.Config, stopCh <-chan struct{}) {
+	newController(clientset, edgenetClientset).run(stopCh)
+}
 
-	NCHandler := &Handler{}
+// newController creates the controller along with its handler, both of which use the clientsets given
+func newController(clientset kubernetes.Interface, edgenetClientset versioned.Interface) *controller {
+	var err error
+	NCHandler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
 	// Create the nodecontribution informer which was generated by the code generator to list and watch nodecontribution resources
 	informer := appsinformer_v1.NewNodeContributionInformer(
 		edgenetClientset,
@@ -284,16 +315,7 @@ func Start() {
 		handler:      NCHandler,
 	}
 
-	// A channel to terminate elegantly
-	stopCh := make(chan struct{})
-	defer close(stopCh)
-	// Run the controller loop as a background task to start processing resources
-	go controller.run(stopCh)
-	// A channel to observe OS signals for smooth shut down
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, syscall.SIGTERM)
-	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
+	return &controller
 }
 
 // Run starts the controller loop
@@ -308,14 +330,18 @@ func (c *controller) run(stopCh <-chan struct{}) {
 	go c.informer.Run(stopCh)
 	go c.nodeInformer.Run(stopCh)
 
-	// Synchronization to settle resources one
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced, c.nodeInformer.HasSynced) {
+	// Synchronization to settle resources one, the process exits to be restarted if the API server is unreachable
+	if !loop.WaitForCacheSync(c.logger, stopCh, c.informer.HasSynced, c.nodeInformer.HasSynced) {
 		utilruntime.HandleError(fmt.Errorf("Error syncing cache"))
 		return
 	}
 	c.logger.Info("run: cache sync complete")
 	// Operate the runWorker
 	go wait.Until(c.runWorker, time.Second, stopCh)
+	// The contributed nodes get checked periodically as they go offline unpredictably
+	if reachabilityPeriod > 0 {
+		go wait.Until(c.handler.CheckReachability, reachabilityPeriod, stopCh)
+	}
 
 	<-stopCh
 }
@@ -332,7 +358,7 @@ func (c *controller) runWorker() {
 }
 
 // This function deals with the queue and sends each item in it to the specified handler to be processed.
-func (c *controller) processNextItem() bool {
+func (c *controller) processNextItem() (processed bool) {
 	log.Info("processNextItem: start")
 	// Fetch the next item of the queue
 	event, quit := c.queue.Get()
@@ -342,6 +368,15 @@ func (c *controller) processNextItem() bool {
 	defer c.queue.Done(event)
 	// Get the key string
 	keyRaw := event.(informerevent).key
+	// A panic of the handler fails the item rather than the worker, which goes on with the next one
+	defer loop.Recover(c.logger, "nodecontribution", keyRaw, func(err error) {
+		if c.queue.NumRequeues(event) < 5 {
+			c.queue.AddRateLimited(event)
+		} else {
+			c.queue.Forget(event)
+		}
+		processed = true
+	})
 	// Use the string key to get the object from the indexer
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	if err != nil {
@@ -358,7 +393,7 @@ func (c *controller) processNextItem() bool {
 	if !exists {
 		if event.(informerevent).function == delete {
 			c.logger.Infof("Controller.processNextItem: object deleted detected: %s", keyRaw)
-			c.handler.ObjectDeleted(item)
+			c.handler.ObjectDeleted(item, keyRaw)
 		}
 	} else {
 		if event.(informerevent).function == create {
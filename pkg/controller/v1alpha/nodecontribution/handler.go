@@ -23,6 +23,7 @@ import (
 	"net"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,6 +33,7 @@ import (
 	"edgenet/pkg/authorization"
 	"edgenet/pkg/client/clientset/versioned"
 	"edgenet/pkg/mailer"
+	"edgenet/pkg/namespace"
 	"edgenet/pkg/node"
 
 	log "github.com/Sirupsen/logrus"
@@ -40,6 +42,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
 )
 
 // HandlerInterface interface contains the methods that are required
@@ -47,13 +51,23 @@ type HandlerInterface interface {
 	Init() error
 	ObjectCreated(obj interface{})
 	ObjectUpdated(obj interface{})
-	ObjectDeleted(obj interface{})
+	ObjectDeleted(obj interface{}, key string)
+	CheckReachability()
+}
+
+// drainTimeout is the time limit for the node of a deleted node contribution to be drained before its removal
+var drainTimeout = 10 * time.Minute
+
+// SetDrainTimeout configures the time limit to drain the node of a deleted node contribution, the node that isn't
+// drained in time stays cordoned in the cluster
+func SetDrainTimeout(timeout time.Duration) {
+	drainTimeout = timeout
 }
 
 // Handler implementation
 type Handler struct {
-	clientset        *kubernetes.Clientset
-	edgenetClientset *versioned.Clientset
+	clientset        kubernetes.Interface
+	edgenetClientset versioned.Interface
 	publicKey        ssh.Signer
 }
 
@@ -61,15 +75,20 @@ type Handler struct {
 func (t *Handler) Init() error {
 	log.Info("NCHandler.Init")
 	var err error
-	t.clientset, err = authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clientsets may be injected beforehand, such as those that the controllers in a process share
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
-	t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
 	// Get the SSH Public Key of the headnode
 	key, err := ioutil.ReadFile("../../.ssh/id_rsa")
@@ -93,11 +112,7 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 	NCCopy.Status.Message = []string{}
 	// Find the authority from the namespace in which the object is
 	NCOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(NCCopy.GetNamespace(), metav1.GetOptions{})
-	nodeName := fmt.Sprintf("%s.%s.edge-net.io", NCOwnerNamespace.Labels["authority-name"], NCCopy.GetName())
-	// Don't use the authority name if the node belongs to EdgeNet
-	if NCOwnerNamespace.GetName() == "authority-edgenet" {
-		nodeName = fmt.Sprintf("%s.edge-net.io", NCCopy.GetName())
-	}
+	nodeName := contributedNodeName(NCOwnerNamespace.Labels["authority-name"], NCCopy.GetName())
 	NCOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(NCOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
 	authorityEnabled := NCOwnerAuthority.Status.Enabled
 	log.Println("AUTHORITY CHECK")
@@ -106,15 +121,12 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 		log.Println("AUTHORITY ENABLED")
 		// If the service restarts, it creates all objects again
 		// Because of that, this section covers a variety of possibilities
-		// Check whether the host has been given as an IP address or else
-		recordType := getRecordType(NCCopy.Spec.Host)
-		if recordType == "" {
-			NCCopy.Status.State = failure
-			NCCopy.Status.Message = append(NCCopy.Status.Message, "Host field must be an IP Address")
-			t.edgenetClientset.AppsV1alpha().NodeContributions(NCCopy.GetNamespace()).UpdateStatus(NCCopy)
-			t.sendEmail(NCCopy)
+		// Check whether the connection fields are valid before trying to reach the host
+		if !t.validateNodeContribution(NCCopy) {
 			return
 		}
+		// Check whether the host has been given as an IP address or else
+		recordType := getRecordType(NCCopy.Spec.Host)
 		// Set the client config according to the node contribution,
 		// with the maximum time of 15 seconds to establist the connection.
 		config := &ssh.ClientConfig{
@@ -123,7 +135,7 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 			Timeout:         15 * time.Second,
 		}
-		addr := fmt.Sprintf("%s:%d", NCCopy.Spec.Host, NCCopy.Spec.Port)
+		addr := sshAddress(NCCopy.Spec)
 		contributedNode, err := t.clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
 		if err == nil {
 			// The node corresponding to the contributed node exists in the cluster
@@ -131,6 +143,9 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 			if node.GetConditionReadyStatus(contributedNode.DeepCopy()) != trueStr {
 				go t.runRecoveryProcedure(addr, config, nodeName, NCCopy, contributedNode)
 			} else {
+				if err := setNodeMetadata(t.clientset, nodeName, NCCopy.Spec); err != nil {
+					log.Printf("Node %s labels and annotations couldn't be set: %s", nodeName, err)
+				}
 				NCCopy.Status.State = success
 				NCCopy.Status.Message = append(NCCopy.Status.Message, "Node is up and running")
 				t.edgenetClientset.AppsV1alpha().NodeContributions(NCCopy.GetNamespace()).UpdateStatus(NCCopy)
@@ -162,10 +177,9 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 	NCCopy.Status.Message = []string{}
 
 	NCOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(NCCopy.GetNamespace(), metav1.GetOptions{})
-	nodeName := fmt.Sprintf("%s.%s.edge-net.io", NCOwnerNamespace.Labels["authority-name"], NCCopy.GetName())
+	nodeName := contributedNodeName(NCOwnerNamespace.Labels["authority-name"], NCCopy.GetName())
 	var authorityEnabled bool
-	if NCOwnerNamespace.GetName() == "authority-edgenet" {
-		nodeName = fmt.Sprintf("%s.edge-net.io", NCCopy.GetName())
+	if NCOwnerNamespace.GetName() == namespace.AuthorityName("edgenet") {
 		authorityEnabled = true
 	} else {
 		NCOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(NCOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
@@ -175,27 +189,26 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 	// Check if the authority is active
 	if authorityEnabled {
 		log.Println("AUTHORITY ENABLED")
-		recordType := getRecordType(NCCopy.Spec.Host)
-		if recordType == "" {
-			NCCopy.Status.State = failure
-			NCCopy.Status.Message = append(NCCopy.Status.Message, "Host field must be an IP Address")
-			t.edgenetClientset.AppsV1alpha().NodeContributions(NCCopy.GetNamespace()).UpdateStatus(NCCopy)
-			t.sendEmail(NCCopy)
+		if !t.validateNodeContribution(NCCopy) {
 			return
 		}
+		recordType := getRecordType(NCCopy.Spec.Host)
 		config := &ssh.ClientConfig{
 			User:            NCCopy.Spec.User,
 			Auth:            []ssh.AuthMethod{ssh.PublicKeys(t.publicKey), ssh.Password(NCCopy.Spec.Password)},
 			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 			Timeout:         15 * time.Second,
 		}
-		addr := fmt.Sprintf("%s:%d", NCCopy.Spec.Host, NCCopy.Spec.Port)
+		addr := sshAddress(NCCopy.Spec)
 		contributedNode, err := t.clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
 		if err == nil {
 			log.Println("NODE FOUND")
 			if contributedNode.Spec.Unschedulable != !NCCopy.Spec.Enabled {
 				t.setNodeScheduling(nodeName, !NCCopy.Spec.Enabled)
 			}
+			if err := setNodeMetadata(t.clientset, nodeName, NCCopy.Spec); err != nil {
+				log.Printf("Node %s labels and annotations couldn't be set: %s", nodeName, err)
+			}
 			if NCCopy.Status.State == failure {
 				go t.runRecoveryProcedure(addr, config, nodeName, NCCopy, contributedNode)
 			}
@@ -216,42 +229,102 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 	}
 }
 
-// ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+// ObjectDeleted is called when an object is deleted, the node that the contributor withdraws is drained and removed
+func (t *Handler) ObjectDeleted(obj interface{}, key string) {
 	log.Info("NCHandler.ObjectDeleted")
+	NCNamespace, NCName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	// The namespace may be gone along with the authority, in which case its name tells the authority
+	authorityName, _ := namespace.AuthorityOf(NCNamespace)
+	if NCOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(NCNamespace, metav1.GetOptions{}); err == nil {
+		authorityName = NCOwnerNamespace.Labels["authority-name"]
+	}
+	nodeName := contributedNodeName(authorityName, NCName)
+	drainer := &node.Drainer{Clientset: t.clientset, Timeout: drainTimeout, PollInterval: 5 * time.Second}
+	// Draining takes as long as the pods take to terminate, so it doesn't hold the other node contributions
+	go func() {
+		if err := drainer.DrainAndDelete(nodeName); err != nil {
+			log.Printf("Node %s of the deleted node contribution couldn't be removed: %s", nodeName, err)
+		}
+	}()
 	// Mail notification, TBD
 }
 
+// contributedNodeName returns the name of the node that the node contribution makes join the cluster, the nodes
+// of EdgeNet don't have the authority name
+func contributedNodeName(authorityName, NCName string) string {
+	if authorityName == "edgenet" {
+		return fmt.Sprintf("%s.edge-net.io", NCName)
+	}
+	return fmt.Sprintf("%s.%s.edge-net.io", authorityName, NCName)
+}
+
+// validateNodeContribution normalizes the spec and, if it is invalid, records the errors in the status
+func (t *Handler) validateNodeContribution(NCCopy *apps_v1alpha.NodeContribution) bool {
+	NormalizeSpec(&NCCopy.Spec)
+	if errs := ValidateSpec(NCCopy.Spec); len(errs) > 0 {
+		NCCopy.Status.State = failure
+		for _, err := range errs {
+			NCCopy.Status.Message = append(NCCopy.Status.Message, err.Error())
+		}
+		t.edgenetClientset.AppsV1alpha().NodeContributions(NCCopy.GetNamespace()).UpdateStatus(NCCopy)
+		t.sendEmail(NCCopy)
+		return false
+	}
+	return true
+}
+
 // sendEmail to send notification to participants
 func (t *Handler) sendEmail(NCCopy *apps_v1alpha.NodeContribution) {
+	subject := ""
+	if NCCopy.Status.State == failure {
+		subject = "node-contribution-failure"
+	} else if NCCopy.Status.State == success {
+		subject = "node-contribution-successful"
+	}
+	contentData, _, err := t.notifyContributors(NCCopy, subject)
+	if err == nil && contentData.Status == failure {
+		mailer.Send("node-contribution-failure-support", contentData)
+	}
+}
+
+// notifyContributors sends the email of the subject to the admins and managers of the authority, and returns the
+// content of the last email along with whether any of the emails was sent. An empty subject sends nothing.
+func (t *Handler) notifyContributors(NCCopy *apps_v1alpha.NodeContribution, subject string) (mailer.MultiProviderData, bool, error) {
+	contentData := mailer.MultiProviderData{}
+	contentData.Name = NCCopy.GetName()
+	contentData.Host = NCCopy.Spec.Host
+	if authorityName, ok := namespace.AuthorityOf(NCCopy.GetNamespace()); ok {
+		contentData.Node = contributedNodeName(authorityName, NCCopy.GetName())
+	}
+	contentData.Status = NCCopy.Status.State
+	contentData.Message = NCCopy.Status.Message
 	// For those who are authority-admin and managers of the authority
 	userRaw, err := t.edgenetClientset.AppsV1alpha().Users(NCCopy.GetNamespace()).List(metav1.ListOptions{})
-	if err == nil {
-		contentData := mailer.MultiProviderData{}
-		contentData.Name = NCCopy.GetName()
-		contentData.Host = NCCopy.Spec.Host
-		contentData.Status = NCCopy.Status.State
-		contentData.Message = NCCopy.Status.Message
-		for _, userRow := range userRaw.Items {
-			if userRow.Status.Active && userRow.Status.AUP && (containsRole(userRow.Spec.Roles, "admin") || containsRole(userRow.Spec.Roles, "manager")) {
-				if err == nil && userRow.Status.Active && userRow.Status.AUP {
-					// Set the HTML template variables
-					contentData.CommonData.Authority = userRow.GetNamespace()
-					contentData.CommonData.Username = userRow.GetName()
-					contentData.CommonData.Name = fmt.Sprintf("%s %s", userRow.Spec.FirstName, userRow.Spec.LastName)
-					contentData.CommonData.Email = []string{userRow.Spec.Email}
-					if contentData.Status == failure {
-						mailer.Send("node-contribution-failure", contentData)
-					} else if contentData.Status == success {
-						mailer.Send("node-contribution-successful", contentData)
-					}
-				}
+	if err != nil {
+		return contentData, false, err
+	}
+	sent := false
+	for _, userRow := range userRaw.Items {
+		if userRow.Status.Active && userRow.Status.AUP && (containsRole(userRow.Spec.Roles, "admin") || containsRole(userRow.Spec.Roles, "manager")) {
+			// Set the HTML template variables
+			contentData.CommonData.Authority = userRow.GetNamespace()
+			contentData.CommonData.Username = userRow.GetName()
+			contentData.CommonData.Name = fmt.Sprintf("%s %s", userRow.Spec.FirstName, userRow.Spec.LastName)
+			contentData.CommonData.Email = []string{userRow.Spec.Email}
+			if subject == "" {
+				continue
+			}
+			// The email deferred is retried in the background, so it isn't sent again
+			if err := mailer.Send(subject, contentData); err == nil || mailer.IsDeferred(err) {
+				sent = true
 			}
-		}
-		if contentData.Status == failure {
-			mailer.Send("node-contribution-failure-support", contentData)
 		}
 	}
+	return contentData, sent, nil
 }
 
 // runSetupProcedure installs necessary packages from scratch and makes the node join into the cluster
@@ -359,6 +432,14 @@ nodeInstallLoop:
 				t.sendEmail(NCCopy)
 				patchStatus = false
 			}
+			err = setNodeMetadata(t.clientset, nodeName, NCCopy.Spec)
+			if err != nil {
+				NCCopy.Status.State = incomplete
+				NCCopy.Status.Message = append(NCCopy.Status.Message, "Setting labels and annotations failed")
+				t.edgenetClientset.AppsV1alpha().NodeContributions(NCCopy.GetNamespace()).UpdateStatus(NCCopy)
+				t.sendEmail(NCCopy)
+				patchStatus = false
+			}
 			if patchStatus {
 				break nodeInstallLoop
 			}
@@ -567,7 +648,7 @@ func (t *Handler) setAuthorityAsOwnerReference(authorityName, nodeName string) e
 		nodePatchOwnerReference.Name = authorityCopy.GetName()
 		nodePatchOwnerReference.UID = string(authorityCopy.GetUID())
 		nodePatchOwnerReferences := append([]patchOwnerReference{}, nodePatchOwnerReference)
-		NCOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(fmt.Sprintf("authority-%s", authorityName), metav1.GetOptions{})
+		NCOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(namespace.AuthorityName(authorityName), metav1.GetOptions{})
 		if err == nil {
 			nodePatchOwnerReference = patchOwnerReference{}
 			nodePatchOwnerReference.APIVersion = "apps.edgenet.io/v1alpha"
@@ -596,6 +677,47 @@ func (t *Handler) setAuthorityAsOwnerReference(authorityName, nodeName string) e
 	return err
 }
 
+// setNodeMetadata stamps the labels and annotations of the node contribution onto the node, those of the node that
+// the node contribution doesn't declare are kept
+func setNodeMetadata(clientset kubernetes.Interface, nodeName string, spec apps_v1alpha.NodeContributionSpec) error {
+	if len(spec.Labels) == 0 && len(spec.Annotations) == 0 {
+		return nil
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		contributedNode, err := clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		nodeCopy := contributedNode.DeepCopy()
+		labelsChanged := mergeMetadata(nodeCopy.GetLabels(), spec.Labels, nodeCopy.SetLabels)
+		annotationsChanged := mergeMetadata(nodeCopy.GetAnnotations(), spec.Annotations, nodeCopy.SetAnnotations)
+		if !labelsChanged && !annotationsChanged {
+			return nil
+		}
+		_, err = clientset.CoreV1().Nodes().Update(nodeCopy)
+		return err
+	})
+}
+
+// mergeMetadata adds the entries given to the metadata of the node, and returns whether any of them was missing
+func mergeMetadata(current, desired map[string]string, set func(map[string]string)) bool {
+	changed := false
+	for key, value := range desired {
+		if existing, ok := current[key]; ok && existing == value {
+			continue
+		}
+		if current == nil {
+			current = map[string]string{}
+		}
+		current[key] = value
+		changed = true
+	}
+	if changed {
+		set(current)
+	}
+	return changed
+}
+
 // setNodeScheduling syncs the node with the node contribution
 func (t *Handler) setNodeScheduling(nodeName string, unschedulable bool) error {
 	// Create a patch slice and initialize it to the size of 1
@@ -619,7 +741,7 @@ func (t *Handler) cleanInstallation(conn *ssh.Client, nodeName string, NCCopy *a
 		log.Println(err)
 		return err
 	}
-	installationCommands, err := getInstallCommands(conn, nodeName, t.getKubernetesVersion()[1:])
+	installationCommands, err := getInstallCommands(conn, nodeName, t.getKubernetesVersion()[1:], t.clientset)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -751,7 +873,7 @@ func startShell(sess *ssh.Session) (*ssh.Session, error) {
 }
 
 // getInstallCommands prepares the commands necessary according to the OS
-func getInstallCommands(conn *ssh.Client, hostname string, kubernetesVersion string) ([]string, error) {
+func getInstallCommands(conn *ssh.Client, hostname string, kubernetesVersion string, clientset kubernetes.Interface) ([]string, error) {
 	sess, err := startSession(conn)
 	if err != nil {
 		log.Println(err)
@@ -789,7 +911,7 @@ func getInstallCommands(conn *ssh.Client, hostname string, kubernetesVersion str
 			fmt.Sprintf("hostname %s", hostname),
 			"systemctl enable docker",
 			"systemctl start docker",
-			node.CreateJoinToken("600s", hostname),
+			node.CreateJoinToken("600s", hostname, clientset),
 			"systemctl daemon-reload",
 			"systemctl restart kubelet",
 		}
@@ -826,7 +948,7 @@ func getInstallCommands(conn *ssh.Client, hostname string, kubernetesVersion str
 			fmt.Sprintf("hostname %s", hostname),
 			"systemctl enable docker",
 			"systemctl start docker",
-			node.CreateJoinToken("600s", hostname),
+			node.CreateJoinToken("600s", hostname, clientset),
 			"systemctl daemon-reload",
 			"systemctl restart kubelet",
 		}
@@ -929,10 +1051,10 @@ func (t *Handler) getKubernetesVersion() string {
 	return kubeletVersion
 }
 
-// getRecordType determines if the IP string is in the form of IPv4 or IPv6 and returns the record type
+// getRecordType determines if the host string is in the form of IPv4, IPv6, or a DNS name and returns the record type
 func getRecordType(ip string) string {
 	if net.ParseIP(ip) == nil {
-		return ""
+		return "CNAME"
 	}
 	for i := 0; i < len(ip); i++ {
 		switch ip[i] {
@@ -945,6 +1067,12 @@ func getRecordType(ip string) string {
 	return ""
 }
 
+// sshAddress returns the address to reach the host of the node contribution over SSH,
+// in which an IPv6 host is enclosed in square brackets
+func sshAddress(spec apps_v1alpha.NodeContributionSpec) string {
+	return net.JoinHostPort(spec.Host, strconv.Itoa(spec.Port))
+}
+
 // To check whether user is holder of a role
 func containsRole(roles []string, value string) bool {
 	for _, ele := range roles {
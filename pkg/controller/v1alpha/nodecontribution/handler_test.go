@@ -0,0 +1,50 @@
+package nodecontribution
+
+import (
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSetNodeMetadata(t *testing.T) {
+	joinedNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "lip6.node-1.edge-net.io",
+		Labels:      map[string]string{"kubernetes.io/hostname": "lip6.node-1.edge-net.io", "edge-net.io/city": "paris"},
+		Annotations: map[string]string{"node.alpha.kubernetes.io/ttl": "0"}}}
+	clientset := testclient.NewSimpleClientset(joinedNode)
+	spec := apps_v1alpha.NodeContributionSpec{
+		Labels:      map[string]string{"example.org/owner": "lip6", "contribution-id": "node-1"},
+		Annotations: map[string]string{"example.org/contact": "admin@lip6.fr"},
+	}
+	if err := setNodeMetadata(clientset, "lip6.node-1.edge-net.io", spec); err != nil {
+		t.Fatal(err)
+	}
+	nodeUpdated, _ := clientset.CoreV1().Nodes().Get("lip6.node-1.edge-net.io", metav1.GetOptions{})
+	expectedLabels := map[string]string{"kubernetes.io/hostname": "lip6.node-1.edge-net.io", "edge-net.io/city": "paris",
+		"example.org/owner": "lip6", "contribution-id": "node-1"}
+	if len(nodeUpdated.Labels) != len(expectedLabels) {
+		t.Errorf("labels are %v, expected %v", nodeUpdated.Labels, expectedLabels)
+	}
+	for key, value := range expectedLabels {
+		if nodeUpdated.Labels[key] != value {
+			t.Errorf("label %s is %q, expected %q", key, nodeUpdated.Labels[key], value)
+		}
+	}
+	if nodeUpdated.Annotations["example.org/contact"] != "admin@lip6.fr" || nodeUpdated.Annotations["node.alpha.kubernetes.io/ttl"] != "0" {
+		t.Errorf("annotations are %v", nodeUpdated.Annotations)
+	}
+
+	// The node that has the labels and annotations already isn't updated again
+	clientset.ClearActions()
+	if err := setNodeMetadata(clientset, "lip6.node-1.edge-net.io", spec); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "update" {
+			t.Error("node updated although it has the labels and annotations")
+		}
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodecontribution
+
+import (
+	"net"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/node"
+
+	log "github.com/Sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Constant variables for the reachability of the contributed nodes
+const reachable = "Reachable"
+const unreachable = "Unreachable"
+
+// ReachabilityChecker tells whether the node of a node contribution is reachable, a checker that probes the nodes
+// another way can be plugged in. The node is nil if it isn't in the cluster.
+type ReachabilityChecker interface {
+	Reachable(NCCopy *apps_v1alpha.NodeContribution, contributedNode *corev1.Node) bool
+}
+
+// sshReachabilityChecker considers the node reachable if it is ready, or else if its SSH port accepts connections
+type sshReachabilityChecker struct {
+	dialTimeout time.Duration
+}
+
+func (c sshReachabilityChecker) Reachable(NCCopy *apps_v1alpha.NodeContribution, contributedNode *corev1.Node) bool {
+	if contributedNode != nil && node.GetConditionReadyStatus(contributedNode) == trueStr {
+		return true
+	}
+	conn, err := net.DialTimeout("tcp", sshAddress(NCCopy.Spec), c.dialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// reachabilityChecker checks the nodes over SSH by default
+var reachabilityChecker ReachabilityChecker = sshReachabilityChecker{dialTimeout: 15 * time.Second}
+
+// SetReachabilityChecker configures how the nodes are checked, nil restores the check over SSH
+func SetReachabilityChecker(checker ReachabilityChecker) {
+	if checker == nil {
+		checker = sshReachabilityChecker{dialTimeout: 15 * time.Second}
+	}
+	reachabilityChecker = checker
+}
+
+// The period of the reachability checks, and how long a node can be unreachable before its contributors are informed
+var reachabilityPeriod = 5 * time.Minute
+var unreachableThreshold = 30 * time.Minute
+
+// SetReachabilityPeriod configures the period to check the nodes of the node contributions, 0 disables the checks
+func SetReachabilityPeriod(period time.Duration) {
+	reachabilityPeriod = period
+}
+
+// SetUnreachableThreshold configures how long a node can be unreachable before its contributors are informed
+func SetUnreachableThreshold(threshold time.Duration) {
+	unreachableThreshold = threshold
+}
+
+// CheckReachability checks the nodes of all node contributions and records the result in their status
+func (t *Handler) CheckReachability() {
+	NCRaw, err := t.edgenetClientset.AppsV1alpha().NodeContributions("").List(metav1.ListOptions{})
+	if err != nil {
+		log.Infof("Couldn't list the node contributions to check their nodes: %s", err)
+		return
+	}
+	for _, NCRow := range NCRaw.Items {
+		t.updateReachability(NCRow.DeepCopy(), time.Now())
+	}
+}
+
+// updateReachability checks the node of the node contribution, and informs the contributors once the node has been
+// unreachable beyond the threshold. The node contributions whose node is being set up are skipped.
+func (t *Handler) updateReachability(NCCopy *apps_v1alpha.NodeContribution, now time.Time) {
+	if NCCopy.Status.State == inprogress || NCCopy.Status.State == recover {
+		return
+	}
+	NCOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(NCCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		log.Infof("Couldn't check the node of node contribution %s in %s: %s", NCCopy.GetName(), NCCopy.GetNamespace(), err)
+		return
+	}
+	nodeName := contributedNodeName(NCOwnerNamespace.Labels["authority-name"], NCCopy.GetName())
+	var contributedNode *corev1.Node
+	if nodeRaw, err := t.clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{}); err == nil {
+		contributedNode = nodeRaw
+	}
+	status := NCCopy.Status.DeepCopy()
+	if reachabilityChecker.Reachable(NCCopy, contributedNode) {
+		seen := metav1.NewTime(now)
+		status.Reachability = reachable
+		status.LastSeen = &seen
+		status.UnreachableNotified = false
+	} else {
+		status.Reachability = unreachable
+		// The node that has never been seen is unreachable since the node contribution exists
+		since := NCCopy.GetCreationTimestamp().Time
+		if status.LastSeen != nil {
+			since = status.LastSeen.Time
+		}
+		if !status.UnreachableNotified && now.Sub(since) > unreachableThreshold {
+			log.Infof("Node %s has been unreachable since %s", nodeName, since)
+			if _, sent, err := t.notifyContributors(NCCopy, "node-contribution-unreachable"); err == nil && sent {
+				status.UnreachableNotified = true
+			}
+		}
+	}
+	NCCopy.Status = *status
+	if _, err := t.edgenetClientset.AppsV1alpha().NodeContributions(NCCopy.GetNamespace()).UpdateStatus(NCCopy); err != nil {
+		log.Infof("Couldn't update the reachability of node contribution %s in %s: %s", NCCopy.GetName(), NCCopy.GetNamespace(), err)
+	}
+}
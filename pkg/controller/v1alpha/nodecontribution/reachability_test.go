@@ -0,0 +1,101 @@
+package nodecontribution
+
+import (
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	"edgenet/pkg/mailer"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeReachabilityChecker returns the reachability that the test sets
+type fakeReachabilityChecker struct {
+	reachable bool
+}
+
+func (c *fakeReachabilityChecker) Reachable(NCCopy *apps_v1alpha.NodeContribution, contributedNode *corev1.Node) bool {
+	return c.reachable
+}
+
+// sendRecorder counts the send attempts by template
+type sendRecorder struct {
+	sent map[string]int
+}
+
+func (r *sendRecorder) ObserveSend(template, result string, latency time.Duration) {
+	r.sent[template]++
+}
+
+func TestUnreachableNode(t *testing.T) {
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-lip6",
+		Labels: map[string]string{"owner": "authority", "owner-name": "lip6", "authority-name": "lip6"}}}
+	manager := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-lip6"},
+		Spec:   apps_v1alpha.UserSpec{Email: "john.doe@lip6.fr", Roles: []string{"Manager"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	created := time.Now().Add(-2 * time.Hour)
+	NC := &apps_v1alpha.NodeContribution{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Namespace: "authority-lip6", CreationTimestamp: metav1.NewTime(created)},
+		Spec: apps_v1alpha.NodeContributionSpec{Host: "192.168.0.1", Port: 22, User: "edgenet"}, Status: apps_v1alpha.NodeContributionStatus{State: success}}
+	edgenetClientset := edgenettestclient.NewSimpleClientset(NC, manager)
+	handler := &Handler{clientset: testclient.NewSimpleClientset(authorityNamespace), edgenetClientset: edgenetClientset}
+	checker := &fakeReachabilityChecker{reachable: true}
+	defer SetReachabilityChecker(nil)
+	SetReachabilityChecker(checker)
+	recorder := &sendRecorder{sent: map[string]int{}}
+	defer mailer.SetMetricsRecorder(nil)
+	mailer.SetMetricsRecorder(recorder)
+	defer mailer.SetEnabled(true)
+	mailer.SetEnabled(true)
+	current := func() *apps_v1alpha.NodeContribution {
+		NCUpdated, _ := edgenetClientset.AppsV1alpha().NodeContributions("authority-lip6").Get("node-1", metav1.GetOptions{})
+		return NCUpdated
+	}
+
+	// The node answers, so it is last seen now
+	lastSeen := created.Add(time.Hour)
+	handler.updateReachability(current(), lastSeen)
+	if status := current().Status; status.Reachability != reachable || status.LastSeen == nil || !status.LastSeen.Time.Equal(lastSeen) {
+		t.Fatalf("status is %+v, expected the node reachable", status)
+	}
+
+	// The node goes offline, the contributors aren't bothered within the threshold
+	checker.reachable = false
+	handler.updateReachability(current(), lastSeen.Add(unreachableThreshold/2))
+	if status := current().Status; status.Reachability != unreachable || status.LastSeen == nil || status.UnreachableNotified {
+		t.Errorf("status is %+v, expected the node unreachable and last seen before", status)
+	}
+	if recorder.sent["node-contribution-unreachable"] != 0 {
+		t.Error("contributors informed within the threshold")
+	}
+
+	// Beyond the threshold, the manager is informed, and the email is retried as long as it fails
+	handler.updateReachability(current(), lastSeen.Add(2*unreachableThreshold))
+	if recorder.sent["node-contribution-unreachable"] != 1 {
+		t.Errorf("%d unreachable emails sent, expected 1", recorder.sent["node-contribution-unreachable"])
+	}
+	if current().Status.UnreachableNotified {
+		t.Error("contributors considered informed although the email failed")
+	}
+	mailer.SetEnabled(false)
+	handler.updateReachability(current(), lastSeen.Add(2*unreachableThreshold))
+	if !current().Status.UnreachableNotified {
+		t.Error("contributors not considered informed")
+	}
+	// They are informed once only
+	mailer.SetEnabled(true)
+	handler.updateReachability(current(), lastSeen.Add(3*unreachableThreshold))
+	if recorder.sent["node-contribution-unreachable"] != 1 {
+		t.Errorf("contributors informed again: %d emails", recorder.sent["node-contribution-unreachable"])
+	}
+
+	// The node that is back clears the notification, so that the next outage is reported as well
+	checker.reachable = true
+	handler.updateReachability(current(), lastSeen.Add(4*unreachableThreshold))
+	if status := current().Status; status.Reachability != reachable || status.UnreachableNotified {
+		t.Errorf("status is %+v, expected the node reachable again", status)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodecontribution
+
+import (
+	"net"
+	"strings"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// defaultSSHPort is used when the node contribution doesn't declare a port
+const defaultSSHPort = 22
+
+// reservedDomains are those of the labels and annotations that the system sets on the nodes, such as the location
+// labels of the node labeler, which the node contributions cannot set
+var reservedDomains = []string{"kubernetes.io", "k8s.io", "edge-net.io"}
+
+// NormalizeSpec trims the connection fields and applies the default SSH port
+func NormalizeSpec(spec *apps_v1alpha.NodeContributionSpec) {
+	spec.Host = strings.TrimSpace(spec.Host)
+	spec.User = strings.TrimSpace(spec.User)
+	if spec.Port == 0 {
+		spec.Port = defaultSSHPort
+	}
+}
+
+// ValidateSpec checks the connection fields of a node contribution spec. The host must be
+// an IP address or a DNS name, the port must be in the TCP range, and the user must be set.
+// It doesn't modify the spec, so NormalizeSpec should be called first to have the defaults.
+func ValidateSpec(spec apps_v1alpha.NodeContributionSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+	if spec.Host == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("host"), "host must be an IP address or a DNS name"))
+	} else if net.ParseIP(spec.Host) == nil {
+		for _, msg := range validation.IsDNS1123Subdomain(strings.ToLower(spec.Host)) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("host"), spec.Host, msg))
+		}
+	}
+	for _, msg := range validation.IsValidPortNum(spec.Port) {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("port"), spec.Port, msg))
+	}
+	if spec.User == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("user"), "user to establish the SSH connection must be set"))
+	}
+	allErrs = append(allErrs, validateNodeMetadata(spec.Labels, specPath.Child("labels"), true)...)
+	allErrs = append(allErrs, validateNodeMetadata(spec.Annotations, specPath.Child("annotations"), false)...)
+	return allErrs
+}
+
+// validateNodeMetadata checks the keys of the labels or annotations to stamp onto the node, and the values of the labels
+func validateNodeMetadata(metadata map[string]string, fldPath *field.Path, labels bool) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for key, value := range metadata {
+		for _, msg := range validation.IsQualifiedName(key) {
+			allErrs = append(allErrs, field.Invalid(fldPath, key, msg))
+		}
+		if isReservedKey(key) {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Key(key), "keys in the system domains are set by the cluster"))
+		}
+		if labels {
+			for _, msg := range validation.IsValidLabelValue(value) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(key), value, msg))
+			}
+		}
+	}
+	return allErrs
+}
+
+// isReservedKey checks whether the prefix of the key is one of the system domains or a subdomain of them
+func isReservedKey(key string) bool {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	for _, domain := range reservedDomains {
+		if parts[0] == domain || strings.HasSuffix(parts[0], "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package nodecontribution
+
+import (
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+)
+
+func TestValidateSpec(t *testing.T) {
+	cases := []struct {
+		name   string
+		spec   apps_v1alpha.NodeContributionSpec
+		fields []string
+	}{
+		{"ipv4", apps_v1alpha.NodeContributionSpec{Host: "192.168.0.1", Port: 22, User: "edgenet"}, nil},
+		{"ipv6", apps_v1alpha.NodeContributionSpec{Host: "2001:db8::68", Port: 22, User: "edgenet"}, nil},
+		{"hostname", apps_v1alpha.NodeContributionSpec{Host: "node-1.edge-net.io", Port: 2222, User: "edgenet"}, nil},
+		{"invalid hostname", apps_v1alpha.NodeContributionSpec{Host: "node_1..edge-net", Port: 22, User: "edgenet"}, []string{"spec.host"}},
+		{"empty host", apps_v1alpha.NodeContributionSpec{Host: "", Port: 22, User: "edgenet"}, []string{"spec.host"}},
+		{"bad port", apps_v1alpha.NodeContributionSpec{Host: "192.168.0.1", Port: 70000, User: "edgenet"}, []string{"spec.port"}},
+		{"negative port", apps_v1alpha.NodeContributionSpec{Host: "192.168.0.1", Port: -1, User: "edgenet"}, []string{"spec.port"}},
+		{"empty user", apps_v1alpha.NodeContributionSpec{Host: "192.168.0.1", Port: 22, User: ""}, []string{"spec.user"}},
+		{"empty host and user", apps_v1alpha.NodeContributionSpec{Port: 22}, []string{"spec.host", "spec.user"}},
+	}
+	for _, c := range cases {
+		errs := ValidateSpec(c.spec)
+		if len(errs) != len(c.fields) {
+			t.Errorf("%s: expected %d errors, got %v", c.name, len(c.fields), errs)
+			continue
+		}
+		for i, err := range errs {
+			if err.Field != c.fields[i] {
+				t.Errorf("%s: expected error on %s, got %s", c.name, c.fields[i], err.Field)
+			}
+		}
+	}
+}
+
+func TestNormalizeSpec(t *testing.T) {
+	cases := []struct {
+		spec     apps_v1alpha.NodeContributionSpec
+		expected apps_v1alpha.NodeContributionSpec
+	}{
+		{apps_v1alpha.NodeContributionSpec{Host: " 192.168.0.1 ", User: " edgenet\n"},
+			apps_v1alpha.NodeContributionSpec{Host: "192.168.0.1", Port: 22, User: "edgenet"}},
+		{apps_v1alpha.NodeContributionSpec{Host: "node-1.edge-net.io", Port: 2222, User: "edgenet"},
+			apps_v1alpha.NodeContributionSpec{Host: "node-1.edge-net.io", Port: 2222, User: "edgenet"}},
+	}
+	for _, c := range cases {
+		NormalizeSpec(&c.spec)
+		if c.spec.Host != c.expected.Host || c.spec.Port != c.expected.Port || c.spec.User != c.expected.User {
+			t.Errorf("expected %+v, got %+v", c.expected, c.spec)
+		}
+	}
+}
+
+func TestGetRecordType(t *testing.T) {
+	cases := []struct {
+		host     string
+		expected string
+	}{
+		{"192.168.0.1", "A"},
+		{"2001:db8::68", "AAAA"},
+		{"node-1.edge-net.io", "CNAME"},
+	}
+	for _, c := range cases {
+		if output := getRecordType(c.host); output != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.host, c.expected, output)
+		}
+	}
+}
+
+func TestSSHAddress(t *testing.T) {
+	cases := []struct {
+		host     string
+		port     int
+		expected string
+	}{
+		{"192.168.0.1", 22, "192.168.0.1:22"},
+		{"2001:db8::68", 2222, "[2001:db8::68]:2222"},
+		{"node-1.edge-net.io", 22, "node-1.edge-net.io:22"},
+	}
+	for _, c := range cases {
+		if output := sshAddress(apps_v1alpha.NodeContributionSpec{Host: c.host, Port: c.port}); output != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.host, c.expected, output)
+		}
+	}
+}
+
+func TestValidateNodeMetadata(t *testing.T) {
+	cases := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		fields      []string
+	}{
+		{"organizational", map[string]string{"example.org/owner": "lip6", "contribution-id": "nc-42"},
+			map[string]string{"example.org/contact": "admin@example.org"}, nil},
+		{"invalid label key", map[string]string{"owner/team/lab": "lip6"}, nil, []string{"spec.labels"}},
+		{"invalid label value", map[string]string{"contact": "admin@example.org"}, nil, []string{"spec.labels[contact]"}},
+		{"system label", map[string]string{"edge-net.io/city": "paris"}, nil, []string{"spec.labels[edge-net.io/city]"}},
+		{"system subdomain", map[string]string{"node-role.kubernetes.io/master": ""}, nil, []string{"spec.labels[node-role.kubernetes.io/master]"}},
+		{"invalid annotation key", nil, map[string]string{"-contact": "admin@example.org"}, []string{"spec.annotations"}},
+		{"system annotation", nil, map[string]string{"kubeadm.alpha.kubernetes.io/cri-socket": "/run/crio.sock"},
+			[]string{"spec.annotations[kubeadm.alpha.kubernetes.io/cri-socket]"}},
+	}
+	for _, c := range cases {
+		spec := apps_v1alpha.NodeContributionSpec{Host: "192.168.0.1", Port: 22, User: "edgenet", Labels: c.labels, Annotations: c.annotations}
+		errs := ValidateSpec(spec)
+		if len(errs) != len(c.fields) {
+			t.Errorf("%s: expected %d errors, got %v", c.name, len(c.fields), errs)
+			continue
+		}
+		for i, err := range errs {
+			if err.Field != c.fields[i] {
+				t.Errorf("%s: expected error on %s, got %s", c.name, c.fields[i], err.Field)
+			}
+		}
+	}
+}
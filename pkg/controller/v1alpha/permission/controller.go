@@ -0,0 +1,277 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package permission
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/authorization"
+	"edgenet/pkg/client/clientset/versioned"
+	appsinformer_v1 "edgenet/pkg/client/informers/externalversions/apps/v1alpha"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
+	"edgenet/pkg/suspension"
+
+	log "github.com/Sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// The main structure of controller
+type controller struct {
+	logger   *log.Entry
+	queue    workqueue.RateLimitingInterface
+	informer cache.SharedIndexInformer
+	handler  HandlerInterface
+}
+
+// The main structure of informerevent
+type informerevent struct {
+	key      string
+	function string
+	deleted  deletedObject
+}
+
+// deletedObject is the permission that has been deleted, whose role bindings are to be revoked
+type deletedObject struct {
+	name      string
+	namespace string
+	suspended bool
+}
+
+// Constant variables for events
+const create = "create"
+const update = "update"
+const delete = "delete"
+
+// Constant variables for the permission status
+const failure = "Failure"
+const success = "Successful"
+const disabled = "Disabled"
+const expired = "Expired"
+
+// Start function is entry point of the controller
+func Start(settings *config.Config) {
+	if err := loop.Configure(settings); err != nil {
+		log.Fatal(err.Error())
+	}
+	clientset, err := authorization.CreateClientSet()
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+	edgenetClientset, err := authorization.CreateEdgeNetClientSet()
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+	if err := authorization.EnsureCRDs(edgenetClientset.Discovery(), apps_v1alpha.SchemeGroupVersion.WithResource("permissions")); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	// Run the controller loop as a background task to start processing resources
+	go Run(clientset, edgenetClientset, settings, stopCh)
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+}
+
+// Run creates the controller with the clientsets given and runs it until the stop channel closes,
+// which allows the controller to share the clientsets and the process with other controllers
+func Run(clientset kubernetes.Interface, edgenetClientset versioned.Interface, _ *config.Config, stopCh <-chan struct{}) {
+	newController(clientset, edgenetClientset).run(stopCh)
+}
+
+// newController creates the controller along with its handler, both of which use the clientsets given
+func newController(clientset kubernetes.Interface, edgenetClientset versioned.Interface) *controller {
+	var err error
+	permissionHandler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+	// Create the permission informer which was generated by the code generator to list and watch permission resources,
+	// it redelivers all permissions at the resync period so that their role bindings get rebuilt if deleted out-of-band
+	informer := appsinformer_v1.NewPermissionInformer(
+		edgenetClientset,
+		metav1.NamespaceAll,
+		loop.ResyncPeriod(),
+		cache.Indexers{},
+	)
+	// Create a work queue which contains a key of the resource to be handled by the handler
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	var event informerevent
+	// Event handlers deal with events of resources. Here, there are three types of events as Add, Update, and Delete
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			// Put the resource object into a key
+			event.key, err = cache.MetaNamespaceKeyFunc(obj)
+			event.function = create
+			log.Infof("Add permission: %s", event.key)
+			if err == nil {
+				// Add the key to the queue
+				queue.Add(event)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// The status updates of the handler don't require the role bindings to be reconciled, unlike the redelivery
+			// of the permission on resync
+			if reflect.DeepEqual(oldObj.(*apps_v1alpha.Permission).Spec, newObj.(*apps_v1alpha.Permission).Spec) && !loop.IsResync(oldObj, newObj) {
+				return
+			}
+			event.key, err = cache.MetaNamespaceKeyFunc(newObj)
+			event.function = update
+			log.Infof("Update permission: %s", event.key)
+			if err == nil {
+				if loop.IsResync(oldObj, newObj) {
+					loop.AddWithJitter(queue, event)
+				} else {
+					queue.Add(event)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			// DeletionHandlingMetaNamsespaceKeyFunc helps to check the existence of the object while it is still contained in the index.
+			// Put the resource object into a key
+			event.key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			event.function = delete
+			log.Infof("Delete permission: %s", event.key)
+			if err == nil {
+				// The role bindings of the permission are found by its name and namespace
+				event.deleted.namespace, event.deleted.name, err = cache.SplitMetaNamespaceKey(event.key)
+				// The suspended permission keeps its role bindings, even once deleted
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				permission, ok := obj.(*apps_v1alpha.Permission)
+				event.deleted.suspended = ok && suspension.IsSuspended(permission)
+				if err == nil {
+					queue.Add(event)
+				}
+			}
+		},
+	})
+	controller := controller{
+		logger:   log.NewEntry(log.New()),
+		informer: informer,
+		queue:    queue,
+		handler:  permissionHandler,
+	}
+
+	return &controller
+}
+
+// Run starts the controller loop
+func (c *controller) run(stopCh <-chan struct{}) {
+	// A Go panic which includes logging and terminating
+	defer utilruntime.HandleCrash()
+	// Shutdown after all goroutines have done
+	defer c.queue.ShutDown()
+	c.logger.Info("run: initiating")
+	c.handler.Init()
+	// Run the informer to list and watch resources
+	go c.informer.Run(stopCh)
+
+	// Synchronization to settle resources one, the process exits to be restarted if the API server is unreachable
+	if !loop.WaitForCacheSync(c.logger, stopCh, c.informer.HasSynced) {
+		utilruntime.HandleError(fmt.Errorf("Error syncing cache"))
+		return
+	}
+	c.logger.Info("run: cache sync complete")
+	// Operate the runWorker
+	go wait.Until(c.runWorker, time.Second, stopCh)
+
+	<-stopCh
+}
+
+// To process new objects added to the queue
+func (c *controller) runWorker() {
+	log.Info("runWorker: starting")
+	// Run processNextItem for all the changes
+	for c.processNextItem() {
+		log.Info("runWorker: processing next item")
+	}
+
+	log.Info("runWorker: completed")
+}
+
+// This function deals with the queue and sends each item in it to the specified handler to be processed.
+func (c *controller) processNextItem() (processed bool) {
+	log.Info("processNextItem: start")
+	// Fetch the next item of the queue
+	event, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(event)
+	// Get the key string
+	keyRaw := event.(informerevent).key
+	// A panic of the handler fails the item rather than the worker, which goes on with the next one
+	defer loop.Recover(c.logger, "permission", keyRaw, func(err error) {
+		if c.queue.NumRequeues(event) < 5 {
+			c.queue.AddRateLimited(event)
+		} else {
+			c.queue.Forget(event)
+		}
+		processed = true
+	})
+	// Use the string key to get the object from the indexer
+	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
+	if err != nil {
+		if c.queue.NumRequeues(event.(informerevent).key) < 5 {
+			c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, retrying", event.(informerevent).key, err)
+			c.queue.AddRateLimited(event.(informerevent).key)
+		} else {
+			c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, no more retries", event.(informerevent).key, err)
+			c.queue.Forget(event.(informerevent).key)
+			utilruntime.HandleError(err)
+		}
+	}
+
+	if !exists {
+		if event.(informerevent).function == delete {
+			c.logger.Infof("Controller.processNextItem: object deleted detected: %s", keyRaw)
+			c.handler.ObjectDeleted(item, event.(informerevent).deleted)
+		}
+	} else {
+		if event.(informerevent).function == create {
+			c.logger.Infof("Controller.processNextItem: object created detected: %s", keyRaw)
+			c.handler.ObjectCreated(item)
+		} else if event.(informerevent).function == update {
+			c.logger.Infof("Controller.processNextItem: object updated detected: %s", keyRaw)
+			c.handler.ObjectUpdated(item)
+		}
+		// The permission that expires is reconciled again at its expiry to revoke its roles
+		if delay, ok := c.handler.Expiry(item); ok {
+			c.queue.AddAfter(informerevent{key: keyRaw, function: update}, delay)
+		}
+	}
+	c.queue.Forget(event.(informerevent).key)
+
+	return true
+}
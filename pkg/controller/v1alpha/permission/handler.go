@@ -0,0 +1,402 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package permission
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/authorization"
+	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/controller/v1alpha/team"
+	"edgenet/pkg/mailer"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
+	"edgenet/pkg/suspension"
+
+	log "github.com/Sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HandlerInterface interface contains the methods that are required
+type HandlerInterface interface {
+	Init() error
+	ObjectCreated(obj interface{})
+	ObjectUpdated(obj interface{})
+	ObjectDeleted(obj, deleted interface{})
+	Expiry(obj interface{}) (time.Duration, bool)
+}
+
+// Handler implementation
+type Handler struct {
+	clientset        kubernetes.Interface
+	edgenetClientset versioned.Interface
+	clock            clock.Clock
+}
+
+// permissionLabel tells the permission that has granted the role binding, whose authority the authority-name label tells
+const permissionLabel = "edge-net.io/permission"
+
+// GrantableLabel marks the cluster roles other than the roles of EdgeNet that permissions may grant when set to true,
+// so that an authority admin cannot bind cluster-admin or any other cluster role to a user
+const GrantableLabel = "edge-net.io/grantable"
+
+// Init handles any handler initialization
+func (t *Handler) Init() error {
+	log.Info("PermissionHandler.Init")
+	var err error
+	// The clientsets may be injected beforehand, such as those that the controllers in a process share
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
+	}
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
+	}
+	// The clock may be injected as well, so that tests control the expiry
+	if t.clock == nil {
+		t.clock = clock.RealClock{}
+	}
+	return err
+}
+
+// ObjectCreated is called when an object is created
+func (t *Handler) ObjectCreated(obj interface{}) {
+	log.Info("PermissionHandler.ObjectCreated")
+	// Create a copy of the permission object to make changes on it
+	permissionCopy := obj.(*apps_v1alpha.Permission).DeepCopy()
+	if suspension.IsSuspended(permissionCopy) {
+		log.Infof("Permission %s in %s is suspended, skipping", permissionCopy.GetName(), permissionCopy.GetNamespace())
+		return
+	}
+	t.reconcile(permissionCopy)
+}
+
+// ObjectUpdated is called when an object is updated
+func (t *Handler) ObjectUpdated(obj interface{}) {
+	log.Info("PermissionHandler.ObjectUpdated")
+	// Create a copy of the permission object to make changes on it
+	permissionCopy := obj.(*apps_v1alpha.Permission).DeepCopy()
+	if suspension.IsSuspended(permissionCopy) {
+		log.Infof("Permission %s in %s is suspended, skipping", permissionCopy.GetName(), permissionCopy.GetNamespace())
+		return
+	}
+	t.reconcile(permissionCopy)
+}
+
+// ObjectDeleted is called when an object is deleted, the role bindings that the permission has granted are revoked
+func (t *Handler) ObjectDeleted(obj, deleted interface{}) {
+	log.Info("PermissionHandler.ObjectDeleted")
+	deletedPermission := deleted.(deletedObject)
+	if deletedPermission.suspended {
+		log.Infof("Permission %s in %s is suspended, skipping", deletedPermission.name, deletedPermission.namespace)
+		return
+	}
+	authorityName, ok := namespace.AuthorityOf(deletedPermission.namespace)
+	if !ok {
+		return
+	}
+	for _, err := range t.applyRoleBindings(authorityName, deletedPermission.name, nil, nil) {
+		log.Infof("Permission %s in %s: %s", deletedPermission.name, deletedPermission.namespace, err)
+	}
+}
+
+// Expiry returns how long the roles of the permission remain granted, if it expires, so that the controller reconciles
+// the permission again once it has expired
+func (t *Handler) Expiry(obj interface{}) (time.Duration, bool) {
+	expiresAt := obj.(*apps_v1alpha.Permission).Spec.ExpiresAt
+	if expiresAt == nil {
+		return 0, false
+	}
+	remaining := expiresAt.Time.Sub(t.clock.Now())
+	return remaining, remaining > 0
+}
+
+// reconcile brings the role bindings of the permission in line with its bindings, the bindings that cannot be granted
+// are reported in the status while the others are granted
+func (t *Handler) reconcile(permissionCopy *apps_v1alpha.Permission) {
+	authorityName, err := t.authorityOf(permissionCopy)
+	if err != nil {
+		t.setStatus(permissionCopy, failure, []string{err.Error()})
+		return
+	}
+	authority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(authorityName, metav1.GetOptions{})
+	if err != nil {
+		t.setStatus(permissionCopy, failure, []string{fmt.Sprintf("Authority %s: %s", authorityName, err)})
+		return
+	}
+	if suspension.IsSuspended(authority) {
+		log.Infof("Authority %s of permission %s is suspended, skipping", authorityName, permissionCopy.GetName())
+		return
+	}
+	// The roles granted in a disabled authority are revoked until the authority is enabled again
+	if !authority.Status.Enabled {
+		errs := append([]error{fmt.Errorf("Authority %s is disabled", authorityName)}, t.applyRoleBindings(authorityName, permissionCopy.GetName(), nil, nil)...)
+		t.setStatus(permissionCopy, failure, errorMessages(errs))
+		return
+	}
+	if expiresAt := permissionCopy.Spec.ExpiresAt; expiresAt != nil && !t.clock.Now().Before(expiresAt.Time) {
+		errs := t.applyRoleBindings(authorityName, permissionCopy.GetName(), nil, nil)
+		if len(errs) != 0 {
+			t.setStatus(permissionCopy, failure, errorMessages(errs))
+			return
+		}
+		// The user is notified once, when the roles get revoked on expiry
+		if permissionCopy.Status.State != expired {
+			t.sendEmail(permissionCopy, authorityName, "permission-expiry")
+		}
+		t.setStatus(permissionCopy, expired, []string{fmt.Sprintf("Roles revoked on expiry at %s", expiresAt.Time.UTC().Format(time.RFC3339))})
+		return
+	}
+	if !permissionCopy.Spec.Enabled {
+		errs := t.applyRoleBindings(authorityName, permissionCopy.GetName(), nil, nil)
+		if len(errs) != 0 {
+			t.setStatus(permissionCopy, failure, errorMessages(errs))
+			return
+		}
+		t.setStatus(permissionCopy, disabled, []string{"Roles revoked"})
+		return
+	}
+	userAuthority := strings.ToLower(strings.TrimSpace(permissionCopy.Spec.Authority))
+	if userAuthority == "" {
+		userAuthority = authorityName
+	}
+	username := strings.ToLower(strings.TrimSpace(permissionCopy.Spec.Username))
+	// The roles of a user who doesn't exist are revoked, as they would refer to a service account that doesn't exist
+	desired := map[string]*rbacv1.RoleBinding{}
+	frozen := map[string]bool{}
+	var errs []error
+	if _, err := t.edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(userAuthority)).Get(username, metav1.GetOptions{}); err != nil {
+		errs = append(errs, fmt.Errorf("User %s of authority %s: %s", username, userAuthority, err))
+	} else {
+		subjects := registration.UserSubjects(namespace.AuthorityName(userAuthority), username)
+		for _, binding := range permissionCopy.Spec.Bindings {
+			roleBind, err := t.newRoleBinding(permissionCopy.GetName(), authorityName, binding, subjects)
+			if err != nil {
+				if _, ok := err.(suspendedError); ok {
+					frozen[binding.Namespace] = true
+				}
+				errs = append(errs, err)
+				continue
+			}
+			desired[fmt.Sprintf("%s/%s", roleBind.GetNamespace(), roleBind.GetName())] = roleBind
+		}
+	}
+	errs = append(errs, t.applyRoleBindings(authorityName, permissionCopy.GetName(), desired, frozen)...)
+	if len(errs) != 0 {
+		t.setStatus(permissionCopy, failure, errorMessages(errs))
+		return
+	}
+	t.setStatus(permissionCopy, success, []string{"Roles granted"})
+}
+
+// authorityOf returns the authority whose namespace the permission is in, it fails if the namespace doesn't exist or
+// isn't the namespace of an authority, such as a child namespace of a team
+func (t *Handler) authorityOf(permissionCopy *apps_v1alpha.Permission) (string, error) {
+	permissionNamespace, err := t.clientset.CoreV1().Namespaces().Get(permissionCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("Namespace %s: %s", permissionCopy.GetNamespace(), err)
+	}
+	if owner := permissionNamespace.Labels["owner"]; owner != "" && owner != "authority" {
+		return "", fmt.Errorf("Permission must be in the namespace of an authority, %s belongs to a %s", permissionCopy.GetNamespace(), owner)
+	}
+	authorityName, ok := namespace.AuthorityOfNamespace(permissionNamespace)
+	if !ok {
+		return "", fmt.Errorf("Permission must be in the namespace of an authority, %s isn't", permissionCopy.GetNamespace())
+	}
+	if labelled := permissionNamespace.Labels["authority-name"]; labelled != "" && labelled != authorityName {
+		return "", fmt.Errorf("Namespace %s is labelled with authority %s rather than %s", permissionCopy.GetNamespace(), labelled, authorityName)
+	}
+	return authorityName, nil
+}
+
+// newRoleBinding returns the role binding of the role in the namespace given, the namespace must belong to the authority
+// and the role must exist
+func (t *Handler) newRoleBinding(permissionName, authorityName string, binding apps_v1alpha.PermissionBinding, subjects []rbacv1.Subject) (*rbacv1.RoleBinding, error) {
+	targetNamespace, err := t.clientset.CoreV1().Namespaces().Get(binding.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Namespace %s: %s", binding.Namespace, err)
+	}
+	if targetNamespace.Labels["authority-name"] != authorityName {
+		return nil, fmt.Errorf("Namespace %s doesn't belong to authority %s", binding.Namespace, authorityName)
+	}
+	if targetNamespace.Labels["owner"] == "team" {
+		if err := t.checkTeamNotSuspended(targetNamespace, authorityName); err != nil {
+			return nil, err
+		}
+	}
+	roleName := strings.TrimSpace(binding.RoleRef)
+	clusterRoleName := roleName
+	named := false
+	// The roles that users hold refer to the cluster role of that role for the kind of the namespace
+	for _, namedRole := range registration.AllowedRoles() {
+		if strings.EqualFold(roleName, namedRole) {
+			// The names of the role bindings remain the same whatever the prefix of the cluster roles
+			roleName = fmt.Sprintf("%s-%s", targetNamespace.Labels["owner"], strings.ToLower(namedRole))
+			clusterRoleName = registration.ClusterRoleName(roleName)
+			named = true
+			break
+		}
+	}
+	clusterRole, err := t.clientset.RbacV1().ClusterRoles().Get(clusterRoleName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("Role %s in namespace %s doesn't exist", binding.RoleRef, binding.Namespace)
+		}
+		return nil, fmt.Errorf("Role %s in namespace %s: %s", binding.RoleRef, binding.Namespace, err)
+	}
+	// Any other cluster role must be marked as grantable, as it might give more than the roles of EdgeNet do
+	if grantable, _ := strconv.ParseBool(clusterRole.Labels[GrantableLabel]); !named && !grantable {
+		return nil, fmt.Errorf("Role %s in namespace %s isn't grantable, its cluster role lacks the %s=true label", binding.RoleRef, binding.Namespace, GrantableLabel)
+	}
+	roleBind := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: binding.Namespace, Name: fmt.Sprintf("permission-%s-%s", permissionName, roleName),
+			Labels: map[string]string{"authority-name": authorityName, permissionLabel: permissionName}},
+		Subjects: subjects,
+		RoleRef:  rbacv1.RoleRef{Kind: "ClusterRole", Name: clusterRoleName},
+	}
+	registration.SetManagedLabels(roleBind, "permission")
+	return roleBind, nil
+}
+
+// checkTeamNotSuspended fails when the team that the child namespace belongs to is suspended, as the controllers leave
+// the suspended teams untouched
+func (t *Handler) checkTeamNotSuspended(teamChildNamespace *corev1.Namespace, authorityName string) error {
+	teamNamespaceStr := teamChildNamespace.Labels[team.ParentNamespaceLabel]
+	if teamNamespaceStr == "" {
+		teamNamespaceStr = namespace.AuthorityName(authorityName)
+	}
+	teamName := teamChildNamespace.Labels["owner-name"]
+	teamCopy, err := t.edgenetClientset.AppsV1alpha().Teams(teamNamespaceStr).Get(teamName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Team %s of namespace %s: %s", teamName, teamChildNamespace.GetName(), err)
+	}
+	if suspension.IsSuspended(teamCopy) {
+		return suspendedError{fmt.Errorf("Team %s of namespace %s is suspended", teamName, teamChildNamespace.GetName())}
+	}
+	return nil
+}
+
+// suspendedError tells that the namespace of the binding is left untouched, so the role binding it has is kept
+type suspendedError struct {
+	error
+}
+
+// applyRoleBindings makes the role bindings that the permission has granted match the desired ones keyed by their
+// namespace and name, so nil revokes all of them. The role bindings of other permissions, and those in the frozen
+// namespaces, are left as they are.
+func (t *Handler) applyRoleBindings(authorityName, permissionName string, desired map[string]*rbacv1.RoleBinding, frozen map[string]bool) []error {
+	var errs []error
+	selector := fmt.Sprintf("%s,authority-name=%s,%s=%s", registration.ManagedSelector("permission"), authorityName, permissionLabel, permissionName)
+	roleBindingsRaw, err := t.clientset.RbacV1().RoleBindings(metav1.NamespaceAll).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return []error{fmt.Errorf("Couldn't list the role bindings granted: %s", err)}
+	}
+	existing := map[string]bool{}
+	for _, roleBindingRow := range roleBindingsRaw.Items {
+		if frozen[roleBindingRow.GetNamespace()] {
+			continue
+		}
+		key := fmt.Sprintf("%s/%s", roleBindingRow.GetNamespace(), roleBindingRow.GetName())
+		roleBind, ok := desired[key]
+		if ok && reflect.DeepEqual(roleBind.RoleRef, roleBindingRow.RoleRef) && reflect.DeepEqual(roleBind.Subjects, roleBindingRow.Subjects) {
+			existing[key] = true
+			continue
+		}
+		// The role reference cannot change, so the role binding that differs is recreated
+		err := t.clientset.RbacV1().RoleBindings(roleBindingRow.GetNamespace()).Delete(roleBindingRow.GetName(), &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("Couldn't revoke role binding %s: %s", key, err))
+		}
+	}
+	for key, roleBind := range desired {
+		if existing[key] {
+			continue
+		}
+		if _, err := t.clientset.RbacV1().RoleBindings(roleBind.GetNamespace()).Create(roleBind); err != nil && !errors.IsAlreadyExists(err) {
+			errs = append(errs, fmt.Errorf("Couldn't grant role binding %s: %s", key, err))
+		}
+	}
+	return errs
+}
+
+// sendEmail notifies the user of the permission, the user who is inactive or hasn't accepted the AUP isn't notified
+func (t *Handler) sendEmail(permissionCopy *apps_v1alpha.Permission, authorityName, subject string) {
+	userAuthority := strings.ToLower(strings.TrimSpace(permissionCopy.Spec.Authority))
+	if userAuthority == "" {
+		userAuthority = authorityName
+	}
+	username := strings.ToLower(strings.TrimSpace(permissionCopy.Spec.Username))
+	user, err := t.edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(userAuthority)).Get(username, metav1.GetOptions{})
+	if err != nil || !user.Status.Active || !user.Status.AUP {
+		return
+	}
+	recipients, invalid := mailer.ValidEmails(append([]string{user.Spec.Email}, user.Spec.AdditionalEmails...))
+	for _, err := range invalid {
+		log.Infof("Couldn't send %s email to %s: %s", subject, username, err)
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	// Set the HTML template variables
+	contentData := mailer.ResourceAllocationData{}
+	contentData.CommonData.Authority = userAuthority
+	contentData.CommonData.Username = username
+	contentData.CommonData.Name = fmt.Sprintf("%s %s", user.Spec.FirstName, user.Spec.LastName)
+	contentData.CommonData.Email = recipients
+	contentData.Authority = authorityName
+	contentData.Name = permissionCopy.GetName()
+	contentData.OwnerNamespace = permissionCopy.GetNamespace()
+	mailer.Send(subject, contentData)
+}
+
+// setStatus updates the status of the permission when it changes
+func (t *Handler) setStatus(permissionCopy *apps_v1alpha.Permission, state string, message []string) {
+	if permissionCopy.Status.State == state && reflect.DeepEqual(permissionCopy.Status.Message, message) {
+		return
+	}
+	permissionCopy.Status.State = state
+	permissionCopy.Status.Message = message
+	if _, err := t.edgenetClientset.AppsV1alpha().Permissions(permissionCopy.GetNamespace()).UpdateStatus(permissionCopy); err != nil {
+		log.Infof("Couldn't update the status of permission %s in %s: %s", permissionCopy.GetName(), permissionCopy.GetNamespace(), err)
+	}
+}
+
+// errorMessages returns the messages of the errors for the status
+func errorMessages(errs []error) []string {
+	message := []string{}
+	for _, err := range errs {
+		message = append(message, err.Error())
+	}
+	return message
+}
@@ -0,0 +1,329 @@
+package permission
+
+import (
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	"edgenet/pkg/mailer"
+	"edgenet/pkg/suspension"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+// sendRecorder counts the send attempts by template
+type sendRecorder struct {
+	sent map[string]int
+}
+
+func (r *sendRecorder) ObserveSend(template, result string, latency time.Duration) {
+	r.sent[template]++
+}
+
+// newTestHandler returns a handler of the cluster where the enabled authority edgenet has a team, and the roles of teams exist
+func newTestHandler(permission *apps_v1alpha.Permission) *Handler {
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	teamNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-team-demo",
+		Labels: map[string]string{"owner": "team", "owner-name": "demo", "authority-name": "edgenet"}}}
+	otherNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-lip6",
+		Labels: map[string]string{"owner": "authority", "owner-name": "lip6", "authority-name": "lip6"}}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace, teamNamespace, otherNamespace,
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "team-admin"}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "team-manager"}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "monitoring", Labels: map[string]string{GrantableLabel: "true"}}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin"}})
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "joe", Namespace: "authority-edgenet"}}
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"}, Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+	return &Handler{clientset: clientset, edgenetClientset: edgenettestclient.NewSimpleClientset(user, authority, team, permission)}
+}
+
+// granted returns the role references of the role bindings in the namespace given, by their names
+func granted(t *testing.T, handler *Handler, namespace string) map[string]string {
+	roleBindingsRaw, err := handler.clientset.RbacV1().RoleBindings(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	roleRefs := map[string]string{}
+	for _, roleBindingRow := range roleBindingsRaw.Items {
+		roleRefs[roleBindingRow.GetName()] = roleBindingRow.RoleRef.Name
+	}
+	return roleRefs
+}
+
+func TestGrant(t *testing.T) {
+	permission := &apps_v1alpha.Permission{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.PermissionSpec{Username: "joe", Enabled: true, Bindings: []apps_v1alpha.PermissionBinding{
+			{Namespace: "authority-edgenet-team-demo", RoleRef: "Admin"},
+			{Namespace: "authority-edgenet-team-demo", RoleRef: "monitoring"}}}}
+	handler := newTestHandler(permission)
+
+	handler.ObjectCreated(permission)
+	roleRefs := granted(t, handler, "authority-edgenet-team-demo")
+	if len(roleRefs) != 2 || roleRefs["permission-ops-team-admin"] != "team-admin" || roleRefs["permission-ops-monitoring"] != "monitoring" {
+		t.Errorf("role bindings are %v, expected the named role and the cluster role", roleRefs)
+	}
+	roleBinding, _ := handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Get("permission-ops-team-admin", metav1.GetOptions{})
+	if len(roleBinding.Subjects) != 2 || roleBinding.Subjects[0].Name != "joe" || roleBinding.Subjects[0].Namespace != "authority-edgenet" ||
+		roleBinding.Subjects[1].Name != "edgenet:authority-edgenet:joe" {
+		t.Errorf("subjects are %v, expected the service account of the user and the user of its certificate", roleBinding.Subjects)
+	}
+	permissionGranted, _ := handler.edgenetClientset.AppsV1alpha().Permissions("authority-edgenet").Get("ops", metav1.GetOptions{})
+	if permissionGranted.Status.State != success {
+		t.Errorf("status is %+v", permissionGranted.Status)
+	}
+}
+
+func TestGrantValidation(t *testing.T) {
+	// The team has no tech role, the cluster role doesn't exist, cluster-admin isn't grantable, and the namespace of lip6
+	// isn't that of the authority
+	permission := &apps_v1alpha.Permission{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.PermissionSpec{Username: "joe", Enabled: true, Bindings: []apps_v1alpha.PermissionBinding{
+			{Namespace: "authority-edgenet-team-demo", RoleRef: "tech"},
+			{Namespace: "authority-edgenet-team-demo", RoleRef: "cluster-reader"},
+			{Namespace: "authority-edgenet-team-demo", RoleRef: "cluster-admin"},
+			{Namespace: "authority-lip6", RoleRef: "monitoring"},
+			{Namespace: "authority-edgenet-team-demo", RoleRef: "manager"}}}}
+	handler := newTestHandler(permission)
+
+	handler.ObjectCreated(permission)
+	roleRefs := granted(t, handler, "authority-edgenet-team-demo")
+	if len(roleRefs) != 1 || roleRefs["permission-ops-team-manager"] != "team-manager" {
+		t.Errorf("role bindings are %v, expected the valid one only", roleRefs)
+	}
+	if roleRefs := granted(t, handler, "authority-lip6"); len(roleRefs) != 0 {
+		t.Errorf("role bindings %v granted in the namespace of another authority", roleRefs)
+	}
+	permissionGranted, _ := handler.edgenetClientset.AppsV1alpha().Permissions("authority-edgenet").Get("ops", metav1.GetOptions{})
+	if permissionGranted.Status.State != failure || len(permissionGranted.Status.Message) != 4 {
+		t.Errorf("status is %+v, expected the invalid bindings", permissionGranted.Status)
+	}
+}
+
+func TestUpdateRole(t *testing.T) {
+	permission := &apps_v1alpha.Permission{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.PermissionSpec{Username: "joe", Enabled: true, Bindings: []apps_v1alpha.PermissionBinding{
+			{Namespace: "authority-edgenet-team-demo", RoleRef: "admin"}}}}
+	handler := newTestHandler(permission)
+	// A role binding of another permission is left as it is
+	other := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "permission-other-team-admin", Namespace: "authority-edgenet-team-demo",
+		Labels: map[string]string{"app.kubernetes.io/managed-by": "edgenet", "edge-net.io/owner-kind": "permission",
+			"authority-name": "edgenet", permissionLabel: "other"}},
+		RoleRef: rbacv1.RoleRef{Kind: "ClusterRole", Name: "team-admin"}}
+	handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Create(other)
+
+	handler.ObjectCreated(permission)
+	permission.Spec.Bindings[0].RoleRef = "manager"
+	handler.ObjectUpdated(permission)
+	roleRefs := granted(t, handler, "authority-edgenet-team-demo")
+	expected := map[string]string{"permission-ops-team-manager": "team-manager", "permission-other-team-admin": "team-admin"}
+	if len(roleRefs) != len(expected) {
+		t.Fatalf("role bindings are %v, expected %v", roleRefs, expected)
+	}
+	for name, roleRef := range expected {
+		if roleRefs[name] != roleRef {
+			t.Errorf("role bindings are %v, expected %v", roleRefs, expected)
+		}
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	permission := &apps_v1alpha.Permission{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.PermissionSpec{Username: "joe", Enabled: true, Bindings: []apps_v1alpha.PermissionBinding{
+			{Namespace: "authority-edgenet-team-demo", RoleRef: "admin"}, {Namespace: "authority-edgenet", RoleRef: "monitoring"}}}}
+	handler := newTestHandler(permission)
+	unmanaged := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "monitoring", Namespace: "authority-edgenet"},
+		RoleRef: rbacv1.RoleRef{Kind: "ClusterRole", Name: "monitoring"}}
+	handler.clientset.RbacV1().RoleBindings("authority-edgenet").Create(unmanaged)
+
+	// Disabling the permission revokes its roles, and enabling it grants them again
+	handler.ObjectCreated(permission)
+	permission.Spec.Enabled = false
+	handler.ObjectUpdated(permission)
+	if roleRefs := granted(t, handler, "authority-edgenet-team-demo"); len(roleRefs) != 0 {
+		t.Errorf("role bindings %v left after disabling the permission", roleRefs)
+	}
+	permission.Spec.Enabled = true
+	handler.ObjectUpdated(permission)
+	if roleRefs := granted(t, handler, "authority-edgenet-team-demo"); len(roleRefs) != 1 {
+		t.Errorf("role bindings are %v after enabling the permission again", roleRefs)
+	}
+
+	handler.ObjectDeleted(nil, deletedObject{name: "ops", namespace: "authority-edgenet"})
+	if roleRefs := granted(t, handler, "authority-edgenet-team-demo"); len(roleRefs) != 0 {
+		t.Errorf("role bindings %v left after deleting the permission", roleRefs)
+	}
+	if roleRefs := granted(t, handler, "authority-edgenet"); len(roleRefs) != 1 || roleRefs["monitoring"] == "" {
+		t.Errorf("role bindings are %v, expected the one not granted by the permission", roleRefs)
+	}
+}
+
+func TestNonAuthorityNamespace(t *testing.T) {
+	tests := []struct {
+		namespace string
+		labels    map[string]string
+	}{
+		// A namespace of the cluster, not created for an authority
+		{"default", nil},
+		// The child namespace of a team, even though its name starts as that of an authority
+		{"authority-edgenet-team-demo", map[string]string{"owner": "team", "owner-name": "demo", "authority-name": "edgenet"}},
+		// A namespace named as that of an authority whose label tells another one
+		{"authority-rogue", map[string]string{"authority-name": "edgenet"}},
+		// A namespace that doesn't exist anymore
+		{"authority-gone", nil},
+	}
+	for _, test := range tests {
+		permission := &apps_v1alpha.Permission{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: test.namespace},
+			Spec: apps_v1alpha.PermissionSpec{Username: "joe", Authority: "edgenet", Enabled: true, Bindings: []apps_v1alpha.PermissionBinding{
+				{Namespace: "authority-edgenet-team-demo", RoleRef: "admin"}}}}
+		handler := newTestHandler(permission)
+		if test.namespace != "authority-gone" && test.namespace != "authority-edgenet-team-demo" {
+			handler.clientset.CoreV1().Namespaces().Create(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: test.namespace, Labels: test.labels}})
+		}
+
+		handler.ObjectCreated(permission)
+		if roleRefs := granted(t, handler, "authority-edgenet-team-demo"); len(roleRefs) != 0 {
+			t.Errorf("role bindings %v granted by the permission in %s", roleRefs, test.namespace)
+		}
+		permissionFailed, _ := handler.edgenetClientset.AppsV1alpha().Permissions(test.namespace).Get("ops", metav1.GetOptions{})
+		if permissionFailed.Status.State != failure || len(permissionFailed.Status.Message) != 1 {
+			t.Errorf("status of the permission in %s is %+v, expected the namespace error", test.namespace, permissionFailed.Status)
+		}
+	}
+}
+
+func TestDisabledAuthority(t *testing.T) {
+	permission := &apps_v1alpha.Permission{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.PermissionSpec{Username: "joe", Enabled: true, Bindings: []apps_v1alpha.PermissionBinding{
+			{Namespace: "authority-edgenet-team-demo", RoleRef: "admin"}}}}
+	handler := newTestHandler(permission)
+	handler.ObjectCreated(permission)
+
+	// The roles are revoked once the authority gets disabled, and the status tells why
+	authority, _ := handler.edgenetClientset.AppsV1alpha().Authorities().Get("edgenet", metav1.GetOptions{})
+	authority.Status.Enabled = false
+	handler.edgenetClientset.AppsV1alpha().Authorities().UpdateStatus(authority)
+	handler.ObjectUpdated(permission)
+	if roleRefs := granted(t, handler, "authority-edgenet-team-demo"); len(roleRefs) != 0 {
+		t.Errorf("role bindings %v left in the disabled authority", roleRefs)
+	}
+	permissionFailed, _ := handler.edgenetClientset.AppsV1alpha().Permissions("authority-edgenet").Get("ops", metav1.GetOptions{})
+	if permissionFailed.Status.State != failure || len(permissionFailed.Status.Message) != 1 || permissionFailed.Status.Message[0] != "Authority edgenet is disabled" {
+		t.Errorf("status is %+v, expected the disabled authority", permissionFailed.Status)
+	}
+}
+
+func TestSuspended(t *testing.T) {
+	newPermission := func() *apps_v1alpha.Permission {
+		return &apps_v1alpha.Permission{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "authority-edgenet"},
+			Spec: apps_v1alpha.PermissionSpec{Username: "joe", Enabled: true, Bindings: []apps_v1alpha.PermissionBinding{
+				{Namespace: "authority-edgenet-team-demo", RoleRef: "admin"}, {Namespace: "authority-edgenet", RoleRef: "monitoring"}}}}
+	}
+	suspend := map[string]string{suspension.Annotation: "true"}
+
+	// The suspended permission is left as it is, and keeps its role bindings once deleted
+	permission := newPermission()
+	handler := newTestHandler(permission)
+	handler.ObjectCreated(permission)
+	permission.SetAnnotations(suspend)
+	permission.Spec.Enabled = false
+	handler.ObjectUpdated(permission)
+	handler.ObjectDeleted(nil, deletedObject{name: "ops", namespace: "authority-edgenet", suspended: true})
+	if roleRefs := granted(t, handler, "authority-edgenet-team-demo"); len(roleRefs) != 1 {
+		t.Errorf("role bindings are %v, expected the suspended permission to keep them", roleRefs)
+	}
+
+	// Nothing is granted in a suspended authority
+	permission = newPermission()
+	handler = newTestHandler(permission)
+	authority, _ := handler.edgenetClientset.AppsV1alpha().Authorities().Get("edgenet", metav1.GetOptions{})
+	authority.SetAnnotations(suspend)
+	handler.edgenetClientset.AppsV1alpha().Authorities().Update(authority)
+	handler.ObjectCreated(permission)
+	if roleRefs := granted(t, handler, "authority-edgenet"); len(roleRefs) != 0 {
+		t.Errorf("role bindings %v granted in the suspended authority", roleRefs)
+	}
+
+	// The namespace of a suspended team is left as it is, while the other bindings are granted
+	permission = newPermission()
+	handler = newTestHandler(permission)
+	handler.ObjectCreated(permission)
+	handler.clientset.RbacV1().RoleBindings("authority-edgenet").Delete("permission-ops-monitoring", &metav1.DeleteOptions{})
+	team, _ := handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	team.SetAnnotations(suspend)
+	handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Update(team)
+	permission.Spec.Bindings[0].RoleRef = "manager"
+	handler.ObjectUpdated(permission)
+	if roleRefs := granted(t, handler, "authority-edgenet-team-demo"); len(roleRefs) != 1 || roleRefs["permission-ops-team-admin"] == "" {
+		t.Errorf("role bindings are %v, expected those in the namespace of the suspended team to be kept", roleRefs)
+	}
+	if roleRefs := granted(t, handler, "authority-edgenet"); len(roleRefs) != 1 {
+		t.Errorf("role bindings are %v, expected the one in the authority namespace", roleRefs)
+	}
+	permissionFailed, _ := handler.edgenetClientset.AppsV1alpha().Permissions("authority-edgenet").Get("ops", metav1.GetOptions{})
+	if permissionFailed.Status.State != failure || len(permissionFailed.Status.Message) != 1 {
+		t.Errorf("status is %+v, expected the suspended team", permissionFailed.Status)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFakeClock(now)
+	permission := &apps_v1alpha.Permission{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.PermissionSpec{Username: "joe", Enabled: true, ExpiresAt: &metav1.Time{Time: now.Add(time.Hour)},
+			Bindings: []apps_v1alpha.PermissionBinding{{Namespace: "authority-edgenet-team-demo", RoleRef: "admin"}}}}
+	handler := newTestHandler(permission)
+	handler.clock = fakeClock
+	user, _ := handler.edgenetClientset.AppsV1alpha().Users("authority-edgenet").Get("joe", metav1.GetOptions{})
+	user.Spec.Email = "joe@edge-net.org"
+	user.Status = apps_v1alpha.UserStatus{Active: true, AUP: true}
+	handler.edgenetClientset.AppsV1alpha().Users("authority-edgenet").Update(user)
+	recorder := &sendRecorder{sent: map[string]int{}}
+	defer mailer.SetMetricsRecorder(nil)
+	mailer.SetMetricsRecorder(recorder)
+	defer mailer.SetEnabled(true)
+	mailer.SetEnabled(true)
+
+	// The roles are granted until the expiry, at which the controller reconciles the permission again
+	handler.ObjectCreated(permission)
+	if roleRefs := granted(t, handler, "authority-edgenet-team-demo"); len(roleRefs) != 1 {
+		t.Errorf("role bindings are %v before the expiry", roleRefs)
+	}
+	if delay, ok := handler.Expiry(permission); !ok || delay != time.Hour {
+		t.Errorf("expiry is in %s, %t, expected in an hour", delay, ok)
+	}
+
+	fakeClock.Step(2 * time.Hour)
+	if _, ok := handler.Expiry(permission); ok {
+		t.Error("expiry still ahead after it has passed")
+	}
+	handler.ObjectUpdated(permission)
+	if roleRefs := granted(t, handler, "authority-edgenet-team-demo"); len(roleRefs) != 0 {
+		t.Errorf("role bindings %v left after the expiry", roleRefs)
+	}
+	permissionExpired, _ := handler.edgenetClientset.AppsV1alpha().Permissions("authority-edgenet").Get("ops", metav1.GetOptions{})
+	if permissionExpired.Status.State != expired {
+		t.Errorf("status is %+v, expected the expiry", permissionExpired.Status)
+	}
+	if recorder.sent["permission-expiry"] != 1 {
+		t.Errorf("expiry emails sent %d times, expected once", recorder.sent["permission-expiry"])
+	}
+	// The user isn't notified again when the expired permission is reconciled once more
+	handler.ObjectUpdated(permissionExpired)
+	if recorder.sent["permission-expiry"] != 1 {
+		t.Errorf("expiry emails sent %d times after another reconcile, expected once", recorder.sent["permission-expiry"])
+	}
+
+	// Extending the permission grants the roles again
+	permissionExpired.Spec.ExpiresAt = &metav1.Time{Time: fakeClock.Now().Add(time.Hour)}
+	handler.ObjectUpdated(permissionExpired)
+	if roleRefs := granted(t, handler, "authority-edgenet-team-demo"); len(roleRefs) != 1 {
+		t.Errorf("role bindings are %v after extending the permission", roleRefs)
+	}
+}
@@ -17,10 +17,8 @@ limitations under the License.
 package selectivedeployment
 
 import (
-	"encoding/json"
 	"fmt"
 	"reflect"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -28,7 +26,6 @@ import (
 	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
 	"edgenet/pkg/client/clientset/versioned"
-	"edgenet/pkg/node"
 
 	log "github.com/Sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
@@ -50,8 +47,8 @@ type HandlerInterface interface {
 
 // SDHandler is a implementation of Handler
 type SDHandler struct {
-	clientset        *kubernetes.Clientset
-	edgenetClientset *versioned.Clientset
+	clientset        kubernetes.Interface
+	edgenetClientset versioned.Interface
 	sdDet            sdDet
 	wgHandler        map[string]*sync.WaitGroup
 	wgRecovery       map[string]*sync.WaitGroup
@@ -80,15 +77,20 @@ func (t *SDHandler) Init() error {
 	t.wgHandler = make(map[string]*sync.WaitGroup)
 	t.wgRecovery = make(map[string]*sync.WaitGroup)
 	var err error
-	t.clientset, err = authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clientsets may be injected beforehand, such as those that the controllers in a process share
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
-	t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
 	return err
 }
@@ -625,11 +627,6 @@ func (t *SDHandler) setFilter(sdRow apps_v1alpha.SelectiveDeployment,
 	case "city", "state", "country", "continent":
 		// If the event type is delete then we don't need to run the part below
 		if event != "delete" {
-			labelKeySuffix := ""
-			if sdType == "state" || sdType == "country" {
-				labelKeySuffix = "-iso"
-			}
-			labelKey := strings.ToLower(fmt.Sprintf("edge-net.io/%s%s", sdType, labelKeySuffix))
 			// This gets the node list which includes the EdgeNet geolabels
 			nodesRaw, err := t.clientset.CoreV1().Nodes().List(metav1.ListOptions{FieldSelector: "spec.unschedulable!=true"})
 			if err != nil {
@@ -639,38 +636,10 @@ func (t *SDHandler) setFilter(sdRow apps_v1alpha.SelectiveDeployment,
 			sdCopy := sdRow.DeepCopy()
 			// This loop allows us to process each value defined at the object of selectivedeployment resource
 			for _, selectorRow := range sdRow.Spec.Selector {
-				counter := 0
-				// The loop to process each node separately
-			cityNodeLoop:
-				for _, nodeRow := range nodesRaw.Items {
-					taintBlock := false
-					for _, taint := range nodeRow.Spec.Taints {
-						if (taint.Key == "node-role.kubernetes.io/master" && taint.Effect == noSchedule) ||
-							(taint.Key == "node.kubernetes.io/unschedulable" && taint.Effect == noSchedule) {
-							taintBlock = true
-						}
-					}
-					conditionBlock := false
-					if node.GetConditionReadyStatus(nodeRow.DeepCopy()) != trueStr {
-						conditionBlock = true
-					}
-
-					if !conditionBlock && !taintBlock {
-						if contains(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"]) {
-							continue
-						}
-						if selectorRow.Value == nodeRow.Labels[labelKey] && selectorRow.Operator == "In" {
-							matchExpression.Values = append(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"])
-							counter++
-						} else if selectorRow.Value != nodeRow.Labels[labelKey] && selectorRow.Operator == "NotIn" {
-							matchExpression.Values = append(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"])
-							counter++
-						}
-						if selectorRow.Count != 0 && selectorRow.Count == counter {
-							break cityNodeLoop
-						}
-					}
-				}
+				// The nodes that the preceding selectors have picked are not counted again
+				matched, _ := MatchNodes(sdType, selectorRow, nodesRaw.Items, matchExpression.Values)
+				matchExpression.Values = append(matchExpression.Values, matched...)
+				counter := len(matched)
 
 				if selectorRow.Count != 0 && selectorRow.Count > counter {
 					updateSDStatus := func(sdCopy *apps_v1alpha.SelectiveDeployment) {
@@ -724,12 +693,10 @@ func (t *SDHandler) setFilter(sdRow apps_v1alpha.SelectiveDeployment,
 				panic(err.Error())
 			}
 
-			var polygon [][]float64
 			sdCopy := sdRow.DeepCopy()
 			// This loop allows us to process each polygon defined at the object of selectivedeployment resource
 			for _, selectorRow := range sdRow.Spec.Selector {
-				counter := 0
-				err = json.Unmarshal([]byte(selectorRow.Value), &polygon)
+				matched, err := MatchNodes(sdType, selectorRow, nodesRaw.Items, matchExpression.Values)
 				if err != nil {
 					updateSDStatus := func(sdCopy *apps_v1alpha.SelectiveDeployment) {
 						strLen := 16
@@ -757,56 +724,8 @@ func (t *SDHandler) setFilter(sdRow apps_v1alpha.SelectiveDeployment,
 					}
 					continue
 				}
-				// The loop to process each node separately
-			polyNodeLoop:
-				for _, nodeRow := range nodesRaw.Items {
-					taintBlock := false
-					for _, taint := range nodeRow.Spec.Taints {
-						if (taint.Key == "node-role.kubernetes.io/master" && taint.Effect == noSchedule) ||
-							(taint.Key == "node.kubernetes.io/unschedulable" && taint.Effect == noSchedule) {
-							taintBlock = true
-						}
-					}
-					conditionBlock := false
-					for _, conditionRow := range nodeRow.Status.Conditions {
-						if conditionType := conditionRow.Type; conditionType == "Ready" {
-							if conditionRow.Status != trueStr {
-								conditionBlock = true
-							}
-						}
-					}
-					if !conditionBlock && !taintBlock {
-						if nodeRow.Labels["edge-net.io/lon"] != "" && nodeRow.Labels["edge-net.io/lat"] != "" {
-							if contains(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"]) {
-								continue
-							}
-							// Because of alphanumeric limitations of Kubernetes on the labels we use "w", "e", "n", and "s" prefixes
-							// at the labels of latitude and longitude. Here is the place those prefixes are dropped away.
-							lonStr := nodeRow.Labels["edge-net.io/lon"]
-							lonStr = string(lonStr[1:])
-							latStr := nodeRow.Labels["edge-net.io/lat"]
-							latStr = string(latStr[1:])
-							if lon, err := strconv.ParseFloat(lonStr, 64); err == nil {
-								if lat, err := strconv.ParseFloat(latStr, 64); err == nil {
-									// boundbox is a rectangle which provides to check whether the point is inside polygon
-									// without taking all point of the polygon into consideration
-									boundbox := node.Boundbox(polygon)
-									status := node.GeoFence(boundbox, polygon, lon, lat)
-									if status && selectorRow.Operator == "In" {
-										matchExpression.Values = append(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"])
-										counter++
-									} else if !status && selectorRow.Operator == "NotIn" {
-										matchExpression.Values = append(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"])
-										counter++
-									}
-								}
-							}
-						}
-						if selectorRow.Count != 0 && selectorRow.Count == counter {
-							break polyNodeLoop
-						}
-					}
-				}
+				matchExpression.Values = append(matchExpression.Values, matched...)
+				counter := len(matched)
 
 				if selectorRow.Count != 0 && selectorRow.Count > counter {
 					updateSDStatus := func(sdCopy *apps_v1alpha.SelectiveDeployment) {
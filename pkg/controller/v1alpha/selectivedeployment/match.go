@@ -0,0 +1,145 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selectivedeployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/node"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SelectorMatch is the result of the evaluation of a selector against the nodes
+type SelectorMatch struct {
+	Selector apps_v1alpha.Selector `json:"selector"`
+	Nodes    []string              `json:"nodes"`
+	Count    int                   `json:"count"`
+	// Error tells why the selector cannot be evaluated, such as a malformed polygon
+	Error string `json:"error,omitempty"`
+}
+
+// MatchNodes returns the hostnames of the nodes that the selector of the selectivedeployment type given picks, up to
+// the count of the selector if it is set. The nodes that cannot run pods and those in skip, which the preceding
+// selectors have picked, are left out. It returns an error if the type is unknown or the polygon is malformed.
+func MatchNodes(sdType string, selector apps_v1alpha.Selector, nodes []corev1.Node, skip []string) ([]string, error) {
+	var matches func(nodeRow corev1.Node) bool
+	switch sdType = strings.ToLower(sdType); sdType {
+	case "city", "state", "country", "continent":
+		labelKeySuffix := ""
+		if sdType == "state" || sdType == "country" {
+			labelKeySuffix = "-iso"
+		}
+		labelKey := fmt.Sprintf("edge-net.io/%s%s", sdType, labelKeySuffix)
+		matches = func(nodeRow corev1.Node) bool {
+			return selector.Value == nodeRow.Labels[labelKey]
+		}
+	case "polygon":
+		var polygon [][]float64
+		if err := json.Unmarshal([]byte(selector.Value), &polygon); err != nil {
+			return nil, fmt.Errorf("GeoJSON format error: %s", err)
+		}
+		// boundbox is a rectangle which provides to check whether the point is inside polygon
+		// without taking all point of the polygon into consideration
+		boundbox := node.Boundbox(polygon)
+		matches = func(nodeRow corev1.Node) bool {
+			lon, lat, ok := nodeCoordinates(nodeRow)
+			return ok && node.GeoFence(boundbox, polygon, lon, lat)
+		}
+	default:
+		return nil, fmt.Errorf("unknown selectivedeployment type %q", sdType)
+	}
+
+	matched := []string{}
+	for _, nodeRow := range nodes {
+		if selector.Count != 0 && selector.Count == len(matched) {
+			break
+		}
+		hostname := nodeRow.Labels["kubernetes.io/hostname"]
+		if !isSchedulable(nodeRow) || contains(skip, hostname) || contains(matched, hostname) {
+			continue
+		}
+		// The nodes without coordinates are neither in nor out of a polygon
+		if _, _, ok := nodeCoordinates(nodeRow); sdType == "polygon" && !ok {
+			continue
+		}
+		if (selector.Operator == "In" && matches(nodeRow)) || (selector.Operator == "NotIn" && !matches(nodeRow)) {
+			matched = append(matched, hostname)
+		}
+	}
+	return matched, nil
+}
+
+// DryRun evaluates the selectors of the selectivedeployment against the current nodes without configuring any
+// controller, so that users can see how many and which nodes they would get
+func DryRun(clientset kubernetes.Interface, sdCopy *apps_v1alpha.SelectiveDeployment) ([]SelectorMatch, error) {
+	nodesRaw, err := clientset.CoreV1().Nodes().List(metav1.ListOptions{FieldSelector: "spec.unschedulable!=true"})
+	if err != nil {
+		return nil, err
+	}
+	results := []SelectorMatch{}
+	picked := []string{}
+	for _, selectorRow := range sdCopy.Spec.Selector {
+		result := SelectorMatch{Selector: selectorRow, Nodes: []string{}}
+		matched, err := MatchNodes(sdCopy.Spec.Type, selectorRow, nodesRaw.Items, picked)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Nodes = matched
+			result.Count = len(matched)
+			picked = append(picked, matched...)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// isSchedulable checks whether the node is ready and free of the taints that keep pods away
+func isSchedulable(nodeRow corev1.Node) bool {
+	for _, taint := range nodeRow.Spec.Taints {
+		if (taint.Key == "node-role.kubernetes.io/master" || taint.Key == "node.kubernetes.io/unschedulable") && taint.Effect == noSchedule {
+			return false
+		}
+	}
+	return node.GetConditionReadyStatus(nodeRow.DeepCopy()) == trueStr
+}
+
+// nodeCoordinates returns the longitude and latitude of the node from its labels
+func nodeCoordinates(nodeRow corev1.Node) (float64, float64, bool) {
+	lonStr := nodeRow.Labels["edge-net.io/lon"]
+	latStr := nodeRow.Labels["edge-net.io/lat"]
+	if lonStr == "" || latStr == "" {
+		return 0, 0, false
+	}
+	// Because of alphanumeric limitations of Kubernetes on the labels we use "w", "e", "n", and "s" prefixes
+	// at the labels of latitude and longitude. Here is the place those prefixes are dropped away.
+	lon, err := strconv.ParseFloat(lonStr[1:], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(latStr[1:], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lon, lat, true
+}
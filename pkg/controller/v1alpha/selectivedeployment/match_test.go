@@ -0,0 +1,96 @@
+package selectivedeployment
+
+import (
+	"reflect"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func newGeoNode(hostname, city, lon, lat string, ready bool, taints ...corev1.Taint) corev1.Node {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: hostname, Labels: map[string]string{"kubernetes.io/hostname": hostname,
+			"edge-net.io/city": city, "edge-net.io/lon": lon, "edge-net.io/lat": lat}},
+		Spec:   corev1.NodeSpec{Taints: taints},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}}},
+	}
+}
+
+func TestMatchNodes(t *testing.T) {
+	nodes := []corev1.Node{
+		newGeoNode("paris-1", "Paris", "e2.35", "n48.85", true),
+		newGeoNode("paris-2", "Paris", "e2.29", "n48.86", true),
+		newGeoNode("paris-3", "Paris", "e2.40", "n48.83", false),
+		newGeoNode("paris-4", "Paris", "e2.31", "n48.84", true, corev1.Taint{Key: "node-role.kubernetes.io/master", Effect: corev1.TaintEffectNoSchedule}),
+		newGeoNode("lyon-1", "Lyon", "e4.83", "n45.76", true),
+		newGeoNode("nowhere-1", "", "", "", true),
+	}
+	square := "[[2, 48], [3, 48], [3, 49], [2, 49]]"
+	cases := []struct {
+		sdType   string
+		selector apps_v1alpha.Selector
+		skip     []string
+		expected []string
+	}{
+		// The nodes that aren't ready or that are tainted are left out
+		{"City", apps_v1alpha.Selector{Value: "Paris", Operator: "In"}, nil, []string{"paris-1", "paris-2"}},
+		{"city", apps_v1alpha.Selector{Value: "Paris", Operator: "In", Count: 1}, nil, []string{"paris-1"}},
+		{"city", apps_v1alpha.Selector{Value: "Paris", Operator: "In"}, []string{"paris-1"}, []string{"paris-2"}},
+		{"city", apps_v1alpha.Selector{Value: "Paris", Operator: "NotIn"}, nil, []string{"lyon-1", "nowhere-1"}},
+		{"polygon", apps_v1alpha.Selector{Value: square, Operator: "In"}, nil, []string{"paris-1", "paris-2"}},
+		// The nodes without coordinates are never picked by polygons
+		{"polygon", apps_v1alpha.Selector{Value: square, Operator: "NotIn"}, nil, []string{"lyon-1"}},
+		{"city", apps_v1alpha.Selector{Value: "Berlin", Operator: "In"}, nil, []string{}},
+	}
+	for _, c := range cases {
+		matched, err := MatchNodes(c.sdType, c.selector, nodes, c.skip)
+		if err != nil {
+			t.Errorf("%s selector %+v failed: %s", c.sdType, c.selector, err)
+		} else if !reflect.DeepEqual(matched, c.expected) {
+			t.Errorf("%s selector %+v matched %v, expected %v", c.sdType, c.selector, matched, c.expected)
+		}
+	}
+	if _, err := MatchNodes("polygon", apps_v1alpha.Selector{Value: "[[2, 48],", Operator: "In"}, nodes, nil); err == nil {
+		t.Error("malformed polygon evaluated")
+	}
+	if _, err := MatchNodes("planet", apps_v1alpha.Selector{Value: "Earth", Operator: "In"}, nodes, nil); err == nil {
+		t.Error("unknown type evaluated")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	paris1, paris2, lyon := newGeoNode("paris-1", "Paris", "e2.35", "n48.85", true), newGeoNode("paris-2", "Paris", "e2.29", "n48.86", true),
+		newGeoNode("lyon-1", "Lyon", "e4.83", "n45.76", true)
+	clientset := testclient.NewSimpleClientset(&paris1, &paris2, &lyon)
+	sd := &apps_v1alpha.SelectiveDeployment{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec: apps_v1alpha.SelectiveDeploymentSpec{Type: "city", Selector: []apps_v1alpha.Selector{
+			{Value: "Paris", Operator: "In", Count: 1}, {Value: "Lyon", Operator: "NotIn"}}}}
+	results, err := DryRun(clientset, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second selector doesn't pick the node that the first one has picked
+	expected := [][]string{{"paris-1"}, {"paris-2"}}
+	if len(results) != len(expected) {
+		t.Fatalf("results are %+v", results)
+	}
+	for i, result := range results {
+		if result.Count != len(expected[i]) || !reflect.DeepEqual(result.Nodes, expected[i]) {
+			t.Errorf("selector %+v matched %v, expected %v", result.Selector, result.Nodes, expected[i])
+		}
+	}
+	// Nothing gets created by a dry run
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() != "list" {
+			t.Errorf("dry run did %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package slice
+
+import (
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	"edgenet/pkg/mailer"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+// sendRecorder counts the send attempts by template
+type sendRecorder struct {
+	sent map[string]int
+}
+
+func (r *sendRecorder) ObserveSend(template, result string, latency time.Duration) {
+	r.sent[template]++
+}
+
+// newExpiryHandler returns a handler whose clock is at now, with a slice of a user expiring in a week
+func newExpiryHandler(now time.Time) (*Handler, *clock.FakeClock, *apps_v1alpha.Slice) {
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Email: "john.doe@edge-net.org"},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	expires := metav1.NewTime(now.Add(7 * 24 * time.Hour))
+	slice := &apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "exp", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.SliceSpec{Profile: "Low", Users: []apps_v1alpha.SliceUsers{{Authority: "edgenet", Username: "johndoe"}}},
+		Status: apps_v1alpha.SliceStatus{Expires: &expires}}
+	fakeClock := clock.NewFakeClock(now)
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(user, slice),
+		clock:            fakeClock,
+	}
+	handler.Init()
+	return handler, fakeClock, slice
+}
+
+func TestWarningThenExpire(t *testing.T) {
+	handler, fakeClock, slice := newExpiryHandler(time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC))
+	recorder := &sendRecorder{sent: map[string]int{}}
+	defer mailer.SetMetricsRecorder(nil)
+	mailer.SetMetricsRecorder(recorder)
+	defer mailer.SetEnabled(true)
+	mailer.SetEnabled(true)
+	defer SetWarningInterval(warningInterval)
+	SetWarningInterval(48 * time.Hour)
+
+	// Out of the warning interval nothing happens
+	sliceCopy := handler.checkExpiry(slice.DeepCopy())
+	if recorder.sent["slice-reminder"] != 0 || sliceCopy.Status.WarningSent {
+		t.Errorf("warned %d times a week before the expiry", recorder.sent["slice-reminder"])
+	}
+
+	fakeClock.Step(6 * 24 * time.Hour)
+	sliceCopy = handler.checkExpiry(sliceCopy)
+	if recorder.sent["slice-reminder"] != 1 {
+		t.Errorf("warned %d times a day before the expiry, expected once", recorder.sent["slice-reminder"])
+	}
+	sliceUpdated, _ := handler.edgenetClientset.AppsV1alpha().Slices("authority-edgenet").Get("exp", metav1.GetOptions{})
+	if !sliceUpdated.Status.WarningSent {
+		t.Error("warning not recorded in the status")
+	}
+
+	fakeClock.Step(24 * time.Hour)
+	handler.checkExpiry(sliceCopy)
+	if _, err := handler.edgenetClientset.AppsV1alpha().Slices("authority-edgenet").Get("exp", metav1.GetOptions{}); err == nil {
+		t.Error("expired slice not removed")
+	}
+	if recorder.sent["slice-reminder"] != 1 {
+		t.Errorf("warned %d times in total, expected once", recorder.sent["slice-reminder"])
+	}
+}
+
+func TestWarningNotRepeated(t *testing.T) {
+	handler, fakeClock, slice := newExpiryHandler(time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC))
+	recorder := &sendRecorder{sent: map[string]int{}}
+	defer mailer.SetMetricsRecorder(nil)
+	mailer.SetMetricsRecorder(recorder)
+	defer mailer.SetEnabled(true)
+	mailer.SetEnabled(true)
+
+	fakeClock.Step(5 * 24 * time.Hour)
+	handler.checkExpiry(slice.DeepCopy())
+	// The slice as the controller reads it again after a restart
+	sliceUpdated, _ := handler.edgenetClientset.AppsV1alpha().Slices("authority-edgenet").Get("exp", metav1.GetOptions{})
+	fakeClock.Step(time.Hour)
+	handler.checkExpiry(sliceUpdated)
+	if recorder.sent["slice-reminder"] != 1 {
+		t.Errorf("warned %d times, expected once", recorder.sent["slice-reminder"])
+	}
+}
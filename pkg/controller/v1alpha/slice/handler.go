@@ -27,13 +27,18 @@ import (
 	"edgenet/pkg/client/clientset/versioned"
 	"edgenet/pkg/controller/v1alpha/totalresourcequota"
 	"edgenet/pkg/mailer"
+	"edgenet/pkg/namespace"
 	"edgenet/pkg/registration"
+	"edgenet/pkg/suspension"
 
 	log "github.com/Sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 )
 
 // HandlerInterface interface contains the methods that are required
@@ -46,26 +51,44 @@ type HandlerInterface interface {
 
 // Handler implementation
 type Handler struct {
-	clientset         *kubernetes.Clientset
-	edgenetClientset  *versioned.Clientset
+	clientset         kubernetes.Interface
+	edgenetClientset  versioned.Interface
 	lowResourceQuota  *corev1.ResourceQuota
 	medResourceQuota  *corev1.ResourceQuota
 	highResourceQuota *corev1.ResourceQuota
+	clock             clock.Clock
+}
+
+// warningInterval is how long before the expiry of a slice its users are warned
+var warningInterval = 72 * time.Hour
+
+// SetWarningInterval configures how long before the expiry of a slice its users are warned
+func SetWarningInterval(interval time.Duration) {
+	warningInterval = interval
 }
 
 // Init handles any handler initialization
 func (t *Handler) Init() error {
 	log.Info("SliceHandler.Init")
 	var err error
-	t.clientset, err = authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clientsets may be injected beforehand, such as those that the controllers in a process share
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
-	t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
+	}
+	// The clock may be injected as well, so that tests control the expiry
+	if t.clock == nil {
+		t.clock = clock.RealClock{}
 	}
 	t.lowResourceQuota = &corev1.ResourceQuota{}
 	t.lowResourceQuota.Name = "slice-low-quota"
@@ -102,19 +125,33 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 	log.Info("SliceHandler.ObjectCreated")
 	// Create a copy of the slice object to make changes on it
 	sliceCopy := obj.(*apps_v1alpha.Slice).DeepCopy()
+	if suspension.IsSuspended(sliceCopy) {
+		log.Infof("Slice %s in %s is suspended, skipping", sliceCopy.GetName(), sliceCopy.GetNamespace())
+		return
+	}
 	// Find the authority from the namespace in which the object is
 	sliceOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(sliceCopy.GetNamespace(), metav1.GetOptions{})
-	sliceOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(sliceOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
-	sliceChildNamespaceStr := fmt.Sprintf("%s-slice-%s", sliceCopy.GetNamespace(), sliceCopy.GetName())
+	sliceOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(sliceOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err == nil && !sliceOwnerAuthority.Status.Enabled {
+		// The slices of a disabled authority are kept until the authority is enabled again or deleted
+		log.Infof("Authority of slice %s in %s is disabled, skipping", sliceCopy.GetName(), sliceCopy.GetNamespace())
+		return
+	}
+	sliceChildNamespaceStr := namespace.ChildName(sliceCopy.GetNamespace(), "slice", sliceCopy.GetName())
 	// The section below checks whether the slice belongs to a team or directly to a authority. After then, set the value as enabled
 	// if the authority and the team (if it is an owner) enabled.
 	var sliceOwnerEnabled bool
 	if sliceOwnerNamespace.Labels["owner"] == "team" {
 		sliceOwnerEnabled = sliceOwnerAuthority.Status.Enabled
 		if sliceOwnerEnabled {
-			sliceOwnerTeam, _ := t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", sliceOwnerNamespace.Labels["authority-name"])).
+			sliceOwnerTeam, err := t.edgenetClientset.AppsV1alpha().Teams(namespace.AuthorityName(sliceOwnerNamespace.Labels["authority-name"])).
 				Get(sliceOwnerNamespace.Labels["owner-name"], metav1.GetOptions{})
-			sliceOwnerEnabled = sliceOwnerTeam.Status.Enabled
+			if err == nil && !sliceOwnerTeam.Status.Enabled {
+				// The slices of a disabled team are suspended by the team until it is enabled again or deleted
+				log.Infof("Team of slice %s in %s is disabled, skipping", sliceCopy.GetName(), sliceCopy.GetNamespace())
+				return
+			}
+			sliceOwnerEnabled = err == nil
 		}
 	} else {
 		sliceOwnerEnabled = sliceOwnerAuthority.Status.Enabled
@@ -133,6 +170,8 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 				// Namespace labels indicate this namespace created by a slice, not by a authority or team
 				namespaceLabels := map[string]string{"owner": "slice", "owner-name": sliceCopy.GetName(), "authority-name": sliceOwnerNamespace.Labels["authority-name"]}
 				sliceChildNamespace.SetLabels(namespaceLabels)
+				// The slice namespace inherits the labels and annotations of its owner, which come from the authority
+				namespace.PropagateMetadata(sliceOwnerNamespace, sliceChildNamespace)
 				sliceChildNamespaceCreated, err := t.clientset.CoreV1().Namespaces().Create(sliceChildNamespace)
 				if err == nil {
 					// Create rolebindings according to the users who participate in the slice and are authority-admin and managers of the authority
@@ -167,10 +206,19 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 	log.Info("SliceHandler.ObjectUpdated")
 	// Create a copy of the slice object to make changes on it
 	sliceCopy := obj.(*apps_v1alpha.Slice).DeepCopy()
+	if suspension.IsSuspended(sliceCopy) {
+		log.Infof("Slice %s in %s is suspended, skipping", sliceCopy.GetName(), sliceCopy.GetNamespace())
+		return
+	}
 	// Find the authority from the namespace in which the object is
 	sliceOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(sliceCopy.GetNamespace(), metav1.GetOptions{})
-	sliceOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(sliceOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
-	sliceChildNamespaceStr := fmt.Sprintf("%s-slice-%s", sliceCopy.GetNamespace(), sliceCopy.GetName())
+	sliceOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(sliceOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err == nil && !sliceOwnerAuthority.Status.Enabled {
+		// The slices of a disabled authority are kept until the authority is enabled again or deleted
+		log.Infof("Authority of slice %s in %s is disabled, skipping", sliceCopy.GetName(), sliceCopy.GetNamespace())
+		return
+	}
+	sliceChildNamespaceStr := namespace.ChildName(sliceCopy.GetNamespace(), "slice", sliceCopy.GetName())
 	fieldUpdated := updated.(fields)
 	// The section below checks whether the slice belongs to a team or directly to a authority. After then, set the value as enabled
 	// if the authority and the team (if it is an owner) enabled.
@@ -178,9 +226,14 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 	if sliceOwnerNamespace.Labels["owner"] == "team" {
 		sliceOwnerEnabled = sliceOwnerAuthority.Status.Enabled
 		if sliceOwnerEnabled {
-			sliceOwnerTeam, _ := t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", sliceOwnerNamespace.Labels["authority-name"])).
+			sliceOwnerTeam, err := t.edgenetClientset.AppsV1alpha().Teams(namespace.AuthorityName(sliceOwnerNamespace.Labels["authority-name"])).
 				Get(sliceOwnerNamespace.Labels["owner-name"], metav1.GetOptions{})
-			sliceOwnerEnabled = sliceOwnerTeam.Status.Enabled
+			if err == nil && !sliceOwnerTeam.Status.Enabled {
+				// The slices of a disabled team are suspended by the team until it is enabled again or deleted
+				log.Infof("Team of slice %s in %s is disabled, skipping", sliceCopy.GetName(), sliceCopy.GetNamespace())
+				return
+			}
+			sliceOwnerEnabled = err == nil
 		}
 	} else {
 		sliceOwnerEnabled = sliceOwnerAuthority.Status.Enabled
@@ -241,7 +294,7 @@ func (t *Handler) checkResourcesAvailabilityForSlice(sliceCopy *apps_v1alpha.Sli
 	TRQCopy, err := t.edgenetClientset.AppsV1alpha().TotalResourceQuotas().Get(authorityName, metav1.GetOptions{})
 	quotaExceeded := true
 	if err == nil {
-		TRQHandler := totalresourcequota.Handler{}
+		TRQHandler := totalresourcequota.NewHandler(t.clientset, t.edgenetClientset)
 		err = TRQHandler.Init()
 		if err == nil {
 			switch sliceCopy.Spec.Profile {
@@ -259,12 +312,13 @@ func (t *Handler) checkResourcesAvailabilityForSlice(sliceCopy *apps_v1alpha.Sli
 
 // setConstrainsByProfile allocates the resources corresponding to the slice profile and defines the expiration date
 func (t *Handler) setConstrainsByProfile(childNamespace string, sliceCopy *apps_v1alpha.Slice) *apps_v1alpha.Slice {
+	formerExpires := sliceCopy.Status.Expires.DeepCopy()
 	switch sliceCopy.Spec.Profile {
 	case "Low":
 		// Set the timeout which is 6 weeks for medium profile slices
 		if sliceCopy.Status.Renew || sliceCopy.Status.Expires == nil {
 			sliceCopy.Status.Expires = &metav1.Time{
-				Time: time.Now().Add(1344 * time.Hour),
+				Time: t.clock.Now().Add(1344 * time.Hour),
 			}
 		} else {
 			sliceCopy.Status.Expires = &metav1.Time{
@@ -276,7 +330,7 @@ func (t *Handler) setConstrainsByProfile(childNamespace string, sliceCopy *apps_
 		// Set the timeout which is 4 weeks for medium profile slices
 		if sliceCopy.Status.Renew || sliceCopy.Status.Expires == nil {
 			sliceCopy.Status.Expires = &metav1.Time{
-				Time: time.Now().Add(672 * time.Hour),
+				Time: t.clock.Now().Add(672 * time.Hour),
 			}
 		} else {
 			sliceCopy.Status.Expires = &metav1.Time{
@@ -288,7 +342,7 @@ func (t *Handler) setConstrainsByProfile(childNamespace string, sliceCopy *apps_
 		// Set the timeout which is 2 weeks for high profile slices
 		if sliceCopy.Status.Renew || sliceCopy.Status.Expires == nil {
 			sliceCopy.Status.Expires = &metav1.Time{
-				Time: time.Now().Add(336 * time.Hour),
+				Time: t.clock.Now().Add(336 * time.Hour),
 			}
 		} else {
 			sliceCopy.Status.Expires = &metav1.Time{
@@ -298,18 +352,43 @@ func (t *Handler) setConstrainsByProfile(childNamespace string, sliceCopy *apps_
 		t.clientset.CoreV1().ResourceQuotas(childNamespace).Create(t.highResourceQuota)
 	}
 	sliceCopy.Status.Renew = false
-	sliceCopyUpdate, _ := t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).UpdateStatus(sliceCopy)
-	return sliceCopyUpdate
+	// The users get warned again about the new expiry
+	if formerExpires == nil || sliceCopy.Status.Expires == nil || !formerExpires.Time.Equal(sliceCopy.Status.Expires.Time) {
+		sliceCopy.Status.WarningSent = false
+	}
+	return t.updateStatus(sliceCopy)
+}
+
+// updateStatus writes the status of the slice, which is re-applied to the latest version of the slice
+// if the object has been modified concurrently
+func (t *Handler) updateStatus(sliceCopy *apps_v1alpha.Slice) *apps_v1alpha.Slice {
+	status := sliceCopy.Status.DeepCopy()
+	var sliceCopyUpdated *apps_v1alpha.Slice
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		sliceCopyUpdated, err = t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).UpdateStatus(sliceCopy)
+		if errors.IsConflict(err) {
+			if sliceLatest, getErr := t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).Get(sliceCopy.GetName(), metav1.GetOptions{}); getErr == nil {
+				sliceCopy = sliceLatest.DeepCopy()
+				sliceCopy.Status = *status.DeepCopy()
+			}
+		}
+		return err
+	})
+	if err != nil {
+		log.Infof("Couldn't update the status of slice %s in %s: %s", sliceCopy.GetName(), sliceCopy.GetNamespace(), err)
+	}
+	return sliceCopyUpdated
 }
 
 // runUserInteractions creates user role bindings according to the roles and send emails separately
 func (t *Handler) runUserInteractions(sliceCopy *apps_v1alpha.Slice, sliceChildNamespaceStr, ownerAuthority, sliceOwner, sliceOwnerName, operation string, firstCreation bool) {
 	// This part for the users who participate in the slice
 	for _, sliceUser := range sliceCopy.Spec.Users {
-		user, err := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", sliceUser.Authority)).Get(sliceUser.Username, metav1.GetOptions{})
+		user, err := t.edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(sliceUser.Authority)).Get(sliceUser.Username, metav1.GetOptions{})
 		if err == nil && user.Status.Active && user.Status.AUP {
 			if operation == "slice-creation" {
-				registration.CreateRoleBindingsByRoles(user.DeepCopy(), sliceChildNamespaceStr, "Slice")
+				registration.CreateRoleBindingsByRoles(user.DeepCopy(), sliceChildNamespaceStr, "Slice", t.clientset)
 			}
 			if !(operation == "slice-creation" && !firstCreation) {
 				t.sendEmail(sliceUser.Username, sliceUser.Authority, ownerAuthority, sliceCopy.GetNamespace(), sliceCopy.GetName(), sliceChildNamespaceStr, operation)
@@ -319,12 +398,12 @@ func (t *Handler) runUserInteractions(sliceCopy *apps_v1alpha.Slice, sliceChildN
 
 	if !(sliceOwner == "team" && operation != "slice-creation") {
 		// For those who are authority-admin and managers of the authority
-		userRaw, err := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", ownerAuthority)).List(metav1.ListOptions{})
+		userRaw, err := t.edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(ownerAuthority)).List(metav1.ListOptions{})
 		if err == nil {
 			for _, userRow := range userRaw.Items {
 				if userRow.Status.Active && userRow.Status.AUP && (containsRole(userRow.Spec.Roles, "admin") || containsRole(userRow.Spec.Roles, "manager")) {
 					if operation == "slice-creation" {
-						registration.CreateRoleBindingsByRoles(userRow.DeepCopy(), sliceChildNamespaceStr, "Slice")
+						registration.CreateRoleBindingsByRoles(userRow.DeepCopy(), sliceChildNamespaceStr, "Slice", t.clientset)
 						//mailSubject = "creation"
 					}
 					/*if !(operation == "slice-creation" && !firstCreation) && !(operation == "slice-creation" && sliceOwner == "team") {
@@ -348,14 +427,22 @@ func (t *Handler) setOwnerReferences(childNamespace *corev1.Namespace) []metav1.
 
 // sendEmail to send notification to participants
 func (t *Handler) sendEmail(sliceUsername, sliceUserAuthority, sliceAuthority, sliceOwnerNamespace, sliceName, sliceNamespace, subject string) {
-	user, err := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", sliceUserAuthority)).Get(sliceUsername, metav1.GetOptions{})
+	user, err := t.edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(sliceUserAuthority)).Get(sliceUsername, metav1.GetOptions{})
 	if err == nil && user.Status.Active && user.Status.AUP {
+		// A malformed address would fail at the SMTP level, so it is skipped, as is the user without any valid address
+		recipients, invalid := mailer.ValidEmails(append([]string{user.Spec.Email}, user.Spec.AdditionalEmails...))
+		for _, err := range invalid {
+			log.Infof("Couldn't send %s email to %s: %s", subject, sliceUsername, err)
+		}
+		if len(recipients) == 0 {
+			return
+		}
 		// Set the HTML template variables
 		contentData := mailer.ResourceAllocationData{}
 		contentData.CommonData.Authority = sliceUserAuthority
 		contentData.CommonData.Username = sliceUsername
 		contentData.CommonData.Name = fmt.Sprintf("%s %s", user.Spec.FirstName, user.Spec.LastName)
-		contentData.CommonData.Email = []string{user.Spec.Email}
+		contentData.CommonData.Email = recipients
 		contentData.Authority = sliceAuthority
 		contentData.Name = sliceName
 		contentData.OwnerNamespace = sliceOwnerNamespace
@@ -371,8 +458,10 @@ func (t *Handler) runTimeout(sliceCopy *apps_v1alpha.Slice) {
 	var timeout <-chan time.Time
 	var reminder <-chan time.Time
 	if sliceCopy.Status.Expires != nil {
-		timeout = time.After(time.Until(sliceCopy.Status.Expires.Time))
-		reminder = time.After(time.Until(sliceCopy.Status.Expires.Time.Add(time.Hour * -72)))
+		timeout = t.clock.After(sliceCopy.Status.Expires.Time.Sub(t.clock.Now()))
+		if !sliceCopy.Status.WarningSent {
+			reminder = t.clock.After(sliceCopy.Status.Expires.Time.Add(-warningInterval).Sub(t.clock.Now()))
+		}
 	}
 	closeChannels := func() {
 		close(timeoutRenewed)
@@ -402,9 +491,12 @@ func (t *Handler) runTimeout(sliceCopy *apps_v1alpha.Slice) {
 							}
 						}
 
-						if updatedSlice.Status.Expires.Time.Sub(time.Now()) >= 0 {
-							timeout = time.After(time.Until(updatedSlice.Status.Expires.Time))
-							reminder = time.After(time.Until(updatedSlice.Status.Expires.Time.Add(time.Hour * -72)))
+						if updatedSlice.Status.Expires.Time.Sub(t.clock.Now()) >= 0 {
+							timeout = t.clock.After(updatedSlice.Status.Expires.Time.Sub(t.clock.Now()))
+							reminder = nil
+							if !updatedSlice.Status.WarningSent {
+								reminder = t.clock.After(updatedSlice.Status.Expires.Time.Add(-warningInterval).Sub(t.clock.Now()))
+							}
 							timeoutRenewed <- true
 						}
 					}
@@ -427,22 +519,20 @@ timeoutLoop:
 		case <-timeoutRenewed:
 			break timeoutOptions
 		case <-reminder:
-			sliceOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(sliceCopy.GetNamespace(), metav1.GetOptions{})
-			sliceChildNamespaceStr := fmt.Sprintf("%s-slice-%s", sliceCopy.GetNamespace(), sliceCopy.GetName())
-			t.runUserInteractions(sliceCopy, sliceChildNamespaceStr, sliceOwnerNamespace.Labels["authority-name"], sliceOwnerNamespace.Labels["owner"], sliceOwnerNamespace.Labels["owner-name"], "slice-reminder", false)
+			sliceCopy = t.checkExpiry(sliceCopy)
 			break timeoutOptions
 		case <-timeout:
-			t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).Delete(sliceCopy.GetName(), &metav1.DeleteOptions{})
+			sliceCopy = t.checkExpiry(sliceCopy)
 			break timeoutOptions
 		case <-terminated:
 			watchSlice.Stop()
 			sliceOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(sliceCopy.GetNamespace(), metav1.GetOptions{})
-			sliceChildNamespaceStr := fmt.Sprintf("%s-slice-%s", sliceCopy.GetNamespace(), sliceCopy.GetName())
+			sliceChildNamespaceStr := namespace.ChildName(sliceCopy.GetNamespace(), "slice", sliceCopy.GetName())
 			t.runUserInteractions(sliceCopy, sliceChildNamespaceStr, sliceOwnerNamespace.Labels["authority-name"], sliceOwnerNamespace.Labels["owner"], sliceOwnerNamespace.Labels["owner-name"], "slice-deletion", false)
 			t.clientset.CoreV1().Namespaces().Delete(sliceChildNamespaceStr, &metav1.DeleteOptions{})
 			TRQCopy, err := t.edgenetClientset.AppsV1alpha().TotalResourceQuotas().Get(sliceOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
 			if err == nil {
-				TRQHandler := totalresourcequota.Handler{}
+				TRQHandler := totalresourcequota.NewHandler(t.clientset, t.edgenetClientset)
 				err = TRQHandler.Init()
 				if err == nil {
 					TRQHandler.ResourceConsumptionControl(TRQCopy, 0, 0)
@@ -454,6 +544,35 @@ timeoutLoop:
 	}
 }
 
+// checkExpiry removes the slice that has expired, and warns its users once within the warning interval before the expiry.
+// The warning is recorded in the status, so that it isn't sent again when the controller restarts. It returns the slice
+// as it is after the warning.
+func (t *Handler) checkExpiry(sliceCopy *apps_v1alpha.Slice) *apps_v1alpha.Slice {
+	if sliceCopy.Status.Expires == nil {
+		return sliceCopy
+	}
+	now := t.clock.Now()
+	if !now.Before(sliceCopy.Status.Expires.Time) {
+		t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).Delete(sliceCopy.GetName(), &metav1.DeleteOptions{})
+		return sliceCopy
+	}
+	if sliceCopy.Status.WarningSent || now.Before(sliceCopy.Status.Expires.Time.Add(-warningInterval)) {
+		return sliceCopy
+	}
+	sliceOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(sliceCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		log.Infof("Couldn't warn the users of slice %s in %s about its expiry: %s", sliceCopy.GetName(), sliceCopy.GetNamespace(), err)
+		return sliceCopy
+	}
+	sliceChildNamespaceStr := namespace.ChildName(sliceCopy.GetNamespace(), "slice", sliceCopy.GetName())
+	t.runUserInteractions(sliceCopy, sliceChildNamespaceStr, sliceOwnerNamespace.Labels["authority-name"], sliceOwnerNamespace.Labels["owner"], sliceOwnerNamespace.Labels["owner-name"], "slice-reminder", false)
+	sliceCopy.Status.WarningSent = true
+	if sliceCopyUpdated := t.updateStatus(sliceCopy); sliceCopyUpdated != nil {
+		sliceCopy = sliceCopyUpdated
+	}
+	return sliceCopy
+}
+
 // To check whether user is holder of a role
 func containsRole(roles []string, value string) bool {
 	for _, ele := range roles {
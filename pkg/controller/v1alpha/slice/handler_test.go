@@ -0,0 +1,118 @@
+package slice
+
+import (
+	"fmt"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	"edgenet/pkg/suspension"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestObjectCreated(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	TRQ := &apps_v1alpha.TotalResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Spec: apps_v1alpha.TotalResourceQuotaSpec{Enabled: true,
+			Claim: []apps_v1alpha.TotalResourceDetails{{Name: "Default", CPU: "12000m", Memory: "12Gi"}}}}
+	slice := &apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "exp", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.SliceSpec{Profile: "Low"}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, TRQ, slice),
+	}
+	// Init keeps the clientsets injected
+	handler.Init()
+
+	handler.ObjectCreated(slice)
+	childNamespace, err := handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-slice-exp", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("slice namespace not created: %s", err)
+	}
+	if childNamespace.Labels["owner"] != "slice" || childNamespace.Labels["owner-name"] != "exp" || childNamespace.Labels["authority-name"] != "edgenet" {
+		t.Errorf("unexpected slice namespace labels: %v", childNamespace.Labels)
+	}
+	if _, err := handler.clientset.CoreV1().ResourceQuotas("authority-edgenet-slice-exp").Get("slice-low-quota", metav1.GetOptions{}); err != nil {
+		t.Errorf("resource quota of the profile not created: %s", err)
+	}
+	sliceUpdated, _ := handler.edgenetClientset.AppsV1alpha().Slices("authority-edgenet").Get("exp", metav1.GetOptions{})
+	if sliceUpdated.Status.Expires == nil {
+		t.Error("expiration date not set")
+	}
+}
+
+func TestObjectCreatedStatusConflict(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	TRQ := &apps_v1alpha.TotalResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Spec: apps_v1alpha.TotalResourceQuotaSpec{Enabled: true,
+			Claim: []apps_v1alpha.TotalResourceDetails{{Name: "Default", CPU: "12000m", Memory: "12Gi"}}}}
+	slice := &apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "exp", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.SliceSpec{Profile: "Low"}}
+	// The slice has been modified concurrently since the handler received it
+	sliceModified := slice.DeepCopy()
+	sliceModified.SetLabels(map[string]string{"modified": "true"})
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, TRQ, sliceModified)
+	// The first status update fails because of the concurrent modification
+	attempts := 0
+	edgenetClientset.PrependReactor("update", "slices", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" {
+			return false, nil, nil
+		}
+		attempts++
+		if attempts == 1 {
+			return true, nil, errors.NewConflict(apps_v1alpha.Resource("slices"), slice.GetName(), fmt.Errorf("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenetClientset,
+	}
+	handler.Init()
+
+	handler.ObjectCreated(slice)
+	if attempts != 2 {
+		t.Errorf("status updated in %d attempts, expected 2", attempts)
+	}
+	sliceUpdated, _ := handler.edgenetClientset.AppsV1alpha().Slices("authority-edgenet").Get("exp", metav1.GetOptions{})
+	if sliceUpdated.Status.Expires == nil {
+		t.Error("slice status lost on conflict")
+	}
+	if sliceUpdated.Labels["modified"] != "true" {
+		t.Errorf("concurrent modification overwritten: %v", sliceUpdated.Labels)
+	}
+}
+
+func TestSuspendedSliceUntouched(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	slice := &apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "exp", Namespace: "authority-edgenet",
+		Annotations: map[string]string{suspension.Annotation: "true"}},
+		Spec: apps_v1alpha.SliceSpec{Profile: "Low"}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace)
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, slice)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+	handler.Init()
+
+	handler.ObjectCreated(slice)
+	handler.ObjectUpdated(slice, fields{})
+	for _, action := range append(clientset.Actions(), edgenetClientset.Actions()...) {
+		if action.GetVerb() != "get" && action.GetVerb() != "list" && action.GetVerb() != "watch" {
+			t.Errorf("suspended slice mutated: %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
@@ -18,33 +18,54 @@ package team
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"math/rand"
 	"os"
 	"os/signal"
 	"reflect"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/client/clientset/versioned"
 	appsinformer_v1 "edgenet/pkg/client/informers/externalversions/apps/v1alpha"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
+	"edgenet/pkg/events"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
+	"edgenet/pkg/suspension"
 
 	log "github.com/Sirupsen/logrus"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
 
 // The main structure of controller
 type controller struct {
-	logger   *log.Entry
-	queue    workqueue.RateLimitingInterface
-	informer cache.SharedIndexInformer
-	handler  HandlerInterface
+	logger          *log.Entry
+	queue           workqueue.RateLimitingInterface
+	informer        cache.SharedIndexInformer
+	handler         HandlerInterface
+	shutdownTimeout time.Duration
+	workers         int
+	keyLocks        *keyLocks
+	state           *reconcileState
+	// authorityLocks serializes the teams in the same namespace, nil to process them in parallel
+	authorityLocks *keyLocks
+	// userInformer watches the users so that the teams whose groups they belong to get reconciled, nil to watch the teams only
+	userInformer cache.SharedIndexInformer
 }
 
 // The main structure of informerEvent
@@ -57,6 +78,7 @@ type informerevent struct {
 // This contains the fields to check whether they are updated
 type fields struct {
 	enabled bool
+	resync  bool
 	users   userData
 	object  objectData
 }
@@ -71,15 +93,155 @@ type objectData struct {
 	name           string
 	ownerNamespace string
 	childNamespace string
+	uid            string
+	suspended      bool
 }
 
 // Constant variables for events
-const create = "create"
-const update = "update"
-const delete = "delete"
+const createEvent = "create"
+const updateEvent = "update"
+const deleteEvent = "delete"
 
-// Start function is entry point of the controller
-func Start() {
+// Constant variables for the team status
+const failure = "Failure"
+
+// Constant variables for the access of the users in the team status
+const accessBound = "bound"
+const accessInactive = "skipped-inactive"
+const accessNoAUP = "skipped-no-aup"
+const accessNotFound = "not-found"
+const accessFailed = "failed"
+
+// accessAuthorityNotFound is the access of a user whose authority doesn't exist, such as after the authority was renamed
+const accessAuthorityNotFound = "authority-not-found"
+
+// networkIsolation makes the controller create network policies that isolate the child namespaces of teams
+var networkIsolation bool
+
+// SetNetworkIsolation configures whether the child namespaces of teams get isolated from each other
+func SetNetworkIsolation(enabled bool) {
+	networkIsolation = enabled
+}
+
+// unresolvedNotification makes the controller email the authority-admin and managers of the team authority when
+// users of the team refer to an authority that doesn't exist
+var unresolvedNotification bool
+
+// SetUnresolvedNotification configures whether the owners of a team get an email about the users whose authority doesn't exist
+func SetUnresolvedNotification(enabled bool) {
+	unresolvedNotification = enabled
+}
+
+// orphanSweep makes the controller delete the child namespaces of the teams that were deleted while it wasn't running
+// once it starts, as the deletion events of those teams are missed. It is off unless enabled, since it deletes namespaces
+// that no event asked to delete.
+var orphanSweep = false
+
+// SetOrphanSweep configures whether the child namespaces left by the teams deleted in the meantime get deleted at start
+func SetOrphanSweep(enabled bool) {
+	orphanSweep = enabled
+}
+
+// authoritySerialization makes the workers process the teams of the same authority one at a time, as they update the
+// role bindings in the shared namespace of the authority, while the teams of different authorities proceed in parallel
+var authoritySerialization = true
+
+// SetAuthoritySerialization configures whether the teams of the same authority get processed one at a time
+func SetAuthoritySerialization(enabled bool) {
+	authoritySerialization = enabled
+}
+
+// shutdownTimeout bounds the time to wait for the item in process to complete on shutdown
+var shutdownTimeout = 30 * time.Second
+
+// SetShutdownTimeout configures the maximum time to wait for the item in process to complete on shutdown, 0 to wait forever
+func SetShutdownTimeout(timeout time.Duration) {
+	shutdownTimeout = timeout
+}
+
+// authorityFilter is the authority whose teams the controller processes alone, such as for debugging or a staged
+// rollout, empty to process the teams of all authorities
+var authorityFilter string
+
+// SetAuthorityFilter configures the authority whose teams the controller processes, empty for all authorities
+func SetAuthorityFilter(authority string) {
+	authorityFilter = authority
+}
+
+// inAuthority returns the filter of the events of the objects in the namespace of the authority given, which the
+// empty authority doesn't filter
+func inAuthority(authority string) func(obj interface{}) bool {
+	return func(obj interface{}) bool {
+		if authority == "" {
+			return true
+		}
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		object, err := meta.Accessor(obj)
+		if err != nil {
+			return false
+		}
+		objectAuthority, ok := namespace.AuthorityOf(object.GetNamespace())
+		return ok && objectAuthority == authority
+	}
+}
+
+// clusterRoleManagement makes the controller create the cluster roles of teams and keep their rules up to date,
+// which the clusters whose RBAC is managed externally, such as by a GitOps tool, disable to provide the roles themselves
+var clusterRoleManagement = true
+
+// SetClusterRoleManagement configures whether the controller creates and updates the cluster roles, or assumes they exist
+func SetClusterRoleManagement(enabled bool) {
+	clusterRoleManagement = enabled
+}
+
+// watchNamespace and watchLabelSelector scope the controller to a shard of the teams, such as those of a single
+// authority, the empty values stand for all of them
+var watchNamespace, watchLabelSelector string
+
+// AddFlags defines the options of the team controller in the flag set given, under the names with the prefix so that
+// they don't conflict with those of the other controllers in the same process
+func AddFlags(fs *flag.FlagSet, prefix string) {
+	fs.StringVar(&watchNamespace, prefix+"namespace", watchNamespace, "namespace of the teams to watch, such as that of a single authority, empty to watch all namespaces")
+	fs.StringVar(&watchLabelSelector, prefix+"label-selector", watchLabelSelector, "label selector of the teams to watch, empty to watch all teams")
+	fs.StringVar(&authorityFilter, prefix+"authority", authorityFilter, "name of the authority whose teams to process alone, such as for debugging or a staged rollout, empty to process those of all authorities")
+	fs.BoolVar(&networkIsolation, prefix+"network-isolation", networkIsolation, "create network policies that isolate the child namespaces of teams")
+	fs.BoolVar(&unresolvedNotification, prefix+"unresolved-notification", unresolvedNotification, "email the authority-admin and managers of a team authority about the users of the team whose authority doesn't exist")
+	fs.BoolVar(&orphanSweep, prefix+"orphan-sweep", orphanSweep, "delete the child namespaces whose team doesn't exist at start")
+	fs.BoolVar(&authoritySerialization, prefix+"serialize-authority", authoritySerialization, "process the teams of the same authority one at a time, as they share the role bindings of its namespace")
+	fs.BoolVar(&clusterRoleManagement, prefix+"manage-cluster-roles", clusterRoleManagement, "create the cluster roles of teams and keep their rules up to date, disable when they are managed externally such as by a GitOps tool")
+	fs.DurationVar(&shutdownTimeout, prefix+"shutdown-timeout", shutdownTimeout, "maximum time to wait for the item in process to complete on shutdown, 0 to wait forever")
+	fs.Int64Var(&listPageSize, prefix+"list-page-size", listPageSize, "number of users and teams that each list call fetches, so that large authorities are gone through a page at a time, 0 to fetch all at once")
+}
+
+// newInformer creates the team informer which was generated by the code generator to list and watch team resources,
+// only the teams in the namespace that match the label selector get listed, the empty values stand for all of them.
+// The teams are indexed by their users, see IndexedTeamsForUser.
+func newInformer(edgenetClientset versioned.Interface, resyncPeriod time.Duration, watchNamespace, labelSelector string) cache.SharedIndexInformer {
+	if watchNamespace == "" {
+		watchNamespace = metav1.NamespaceAll
+	}
+	return appsinformer_v1.NewFilteredTeamInformer(
+		edgenetClientset,
+		watchNamespace,
+		resyncPeriod,
+		cache.Indexers{UserIndex: UserIndexFunc},
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = labelSelector
+		},
+	)
+}
+
+// Start function is entry point of the controller, the informer redelivers all teams at
+// the resync period of the control loop so that drifted child resources get rebuilt, the
+// controller exits if the cache doesn't sync within the cache sync timeout of the loop,
+// and the workers process distinct teams in parallel. The namespace and the label selector,
+// empty to watch all teams, scope the controller to a shard such as a single authority
+func Start(settings *config.Config) {
+	if err := loop.Configure(settings); err != nil {
+		log.Fatal(err.Error())
+	}
 	clientset, err := authorization.CreateClientSet()
 	if err != nil {
 		log.Println(err.Error())
@@ -90,145 +252,329 @@ func Start() {
 		log.Println(err.Error())
 		panic(err.Error())
 	}
+	if err := authorization.EnsureCRDs(edgenetClientset.Discovery(), apps_v1alpha.SchemeGroupVersion.WithResource("teams")); err != nil {
+		log.Fatal(err.Error())
+	}
 
-	teamHandler := &Handler{}
-	// Create the team informer which was generated by the code generator to list and watch team resources
-	informer := appsinformer_v1.NewTeamInformer(
-		edgenetClientset,
-		metav1.NamespaceAll,
-		0,
-		cache.Indexers{},
-	)
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	stopped := make(chan struct{})
+	// Run the controller loop as a background task to start processing resources
+	go func() {
+		defer close(stopped)
+		Run(clientset, edgenetClientset, settings, stopCh)
+	}()
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+	// The process exits once the item in process completes
+	close(stopCh)
+	<-stopped
+}
+
+// Run creates the controller with the clientsets given and runs it until the stop channel closes,
+// which allows the controller to share the clientsets and the process with other controllers
+func Run(clientset kubernetes.Interface, edgenetClientset versioned.Interface, settings *config.Config, stopCh <-chan struct{}) {
+	var err error
+	teamHandler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset, networkIsolation: networkIsolation, unresolvedNotification: unresolvedNotification}
+	// A malformed selector would make the informer fail to list forever
+	if _, err := labels.Parse(watchLabelSelector); err != nil {
+		log.Errorf("Invalid label selector %q: %s", watchLabelSelector, err)
+		return
+	}
+	if orphanSweep {
+		// The controller of a single authority leaves the child namespaces of the others alone
+		teamHandler.sweepOrphanedNamespaces(watchNamespace, authorityFilter)
+	}
+	informer := newInformer(edgenetClientset, loop.ResyncPeriod(), watchNamespace, watchLabelSelector)
 	// Create a work queue which contains a key of the resource to be handled by the handler
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	queue := &instrumentedQueue{RateLimitingInterface: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), state: state}
 	var event informerevent
-	// Event handlers deal with events of resources. In here, we take into consideration of adding and updating nodes
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			// Put the resource object into a key
-			event.key, err = cache.MetaNamespaceKeyFunc(obj)
-			event.function = create
-			log.Infof("Add team: %s", event.key)
-			if err == nil {
-				// Add the key to the queue
-				queue.Add(event)
-			}
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			event.key, err = cache.MetaNamespaceKeyFunc(newObj)
-			event.function = update
-			// Find out whether the fields updated
-			event.change.enabled = false
-			event.change.users.status = false
-			event.change.users.deleted = ""
-			event.change.users.added = ""
-			if oldObj.(*apps_v1alpha.Team).Status.Enabled != newObj.(*apps_v1alpha.Team).Status.Enabled {
-				event.change.enabled = true
-			}
-			if !reflect.DeepEqual(oldObj.(*apps_v1alpha.Team).Spec.Users, newObj.(*apps_v1alpha.Team).Spec.Users) {
+	// Event handlers deal with events of resources. In here, we take into consideration of adding and updating nodes.
+	// The teams of the other authorities don't get enqueued when the controller is scoped to a single authority.
+	informer.AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: inAuthority(authorityFilter),
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				// Put the resource object into a key
+				event.key, err = cache.MetaNamespaceKeyFunc(obj)
+				event.function = createEvent
+				log.Infof("Add team: %s", event.key)
+				if err == nil {
+					// Add the key to the queue
+					queue.Add(event)
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				event.key, err = cache.MetaNamespaceKeyFunc(newObj)
+				event.function = updateEvent
+				// Find out whether the fields updated
+				event.change.enabled = false
+				event.change.resync = false
+				event.change.users.status = false
+				event.change.users.deleted = ""
+				event.change.users.added = ""
+				// The informer redelivers the same version of object on each resync
+				event.change.resync = loop.IsResync(oldObj, newObj)
+				if oldObj.(*apps_v1alpha.Team).Status.Enabled != newObj.(*apps_v1alpha.Team).Status.Enabled {
+					event.change.enabled = true
+				}
+				if !reflect.DeepEqual(oldObj.(*apps_v1alpha.Team).Spec.Users, newObj.(*apps_v1alpha.Team).Spec.Users) {
+					event.change.users.status = true
+					sliceDeleted, sliceAdded := dry(oldObj.(*apps_v1alpha.Team).Spec.Users, newObj.(*apps_v1alpha.Team).Spec.Users)
+					sliceDeletedJSON, err := json.Marshal(sliceDeleted)
+					if err == nil {
+						event.change.users.deleted = string(sliceDeletedJSON)
+					}
+					sliceAddedJSON, err := json.Marshal(sliceAdded)
+					if err == nil {
+						event.change.users.added = string(sliceAddedJSON)
+					}
+				}
+				log.Infof("Update team: %s", event.key)
+				if err == nil {
+					if event.change.resync {
+						loop.AddWithJitter(queue, event)
+					} else {
+						queue.Add(event)
+					}
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				// DeletionHandlingMetaNamsespaceKeyFunc helps to check the existence of the object while it is still contained in the index.
+				// Put the resource object into a key
+				event.key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+				event.function = deleteEvent
 				event.change.users.status = true
-				sliceDeleted, sliceAdded := dry(oldObj.(*apps_v1alpha.Team).Spec.Users, newObj.(*apps_v1alpha.Team).Spec.Users)
-				sliceDeletedJSON, err := json.Marshal(sliceDeleted)
+				event.change.users.deleted = ""
+				sliceDeletedJSON, err := json.Marshal(obj.(*apps_v1alpha.Team).Spec.Users)
 				if err == nil {
 					event.change.users.deleted = string(sliceDeletedJSON)
 				}
-				sliceAddedJSON, err := json.Marshal(sliceAdded)
+				event.change.object.name = obj.(*apps_v1alpha.Team).GetName()
+				event.change.object.ownerNamespace = obj.(*apps_v1alpha.Team).GetNamespace()
+				event.change.object.childNamespace = namespace.ChildName(obj.(*apps_v1alpha.Team).GetNamespace(), "team", obj.(*apps_v1alpha.Team).GetName())
+				event.change.object.uid = string(obj.(*apps_v1alpha.Team).GetUID())
+				event.change.object.suspended = suspension.IsSuspended(obj.(*apps_v1alpha.Team))
+				event.change.enabled = obj.(*apps_v1alpha.Team).Status.Enabled
+				log.Infof("Delete team: %s", event.key)
 				if err == nil {
-					event.change.users.added = string(sliceAddedJSON)
+					queue.Add(event)
 				}
+			},
+		},
+	})
+	// The changes of the users in the groups of teams reconcile those teams, which grants or revokes their access
+	userInformer := appsinformer_v1.NewUserInformer(edgenetClientset, metav1.NamespaceAll, 0, cache.Indexers{})
+	userInformer.AddEventHandler(groupMembershipHandler(informer.GetStore(), queue))
+	controller := controller{
+		logger:          log.NewEntry(log.New()),
+		informer:        informer,
+		userInformer:    userInformer,
+		queue:           queue,
+		handler:         teamHandler,
+		shutdownTimeout: shutdownTimeout,
+		workers:         settings.Workers,
+		keyLocks:        newKeyLocks(),
+		state:           state,
+	}
+	if authoritySerialization {
+		controller.authorityLocks = newKeyLocks()
+	}
+
+	if clusterRoleManagement {
+		ensureClusterRoles(clientset)
+	}
+
+	controller.run(stopCh)
+}
+
+// groupMembershipHandler returns the event handler of the users that enqueues the teams whose groups the user
+// belongs to, before or after the change, as an update without any change of the fields so that no email is sent
+func groupMembershipHandler(teams cache.Store, queue workqueue.Interface) cache.ResourceEventHandlerFuncs {
+	filter := inAuthority(authorityFilter)
+	enqueue := func(users ...*apps_v1alpha.User) {
+		teamsInAuthority := []interface{}{}
+		for _, obj := range teams.List() {
+			if filter(obj) {
+				teamsInAuthority = append(teamsInAuthority, obj)
 			}
-			log.Infof("Update team: %s", event.key)
-			if err == nil {
-				queue.Add(event)
+		}
+		for _, key := range groupTeams(teamsInAuthority, users...) {
+			queue.Add(informerevent{key: key, function: updateEvent})
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			enqueue(obj.(*apps_v1alpha.User))
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldUser, newUser := oldObj.(*apps_v1alpha.User), newObj.(*apps_v1alpha.User)
+			// Only the roles and the status of the users decide on their access
+			if reflect.DeepEqual(oldUser.Spec.Roles, newUser.Spec.Roles) && oldUser.Status.Active == newUser.Status.Active && oldUser.Status.AUP == newUser.Status.AUP {
+				return
 			}
+			enqueue(oldUser, newUser)
 		},
 		DeleteFunc: func(obj interface{}) {
-			// DeletionHandlingMetaNamsespaceKeyFunc helps to check the existence of the object while it is still contained in the index.
-			// Put the resource object into a key
-			event.key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-			event.function = delete
-			event.change.users.status = true
-			event.change.users.deleted = ""
-			sliceDeletedJSON, err := json.Marshal(obj.(*apps_v1alpha.Team).Spec.Users)
-			if err == nil {
-				event.change.users.deleted = string(sliceDeletedJSON)
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
 			}
-			event.change.object.name = obj.(*apps_v1alpha.Team).GetName()
-			event.change.object.ownerNamespace = obj.(*apps_v1alpha.Team).GetNamespace()
-			event.change.object.childNamespace = fmt.Sprintf("%s-team-%s", obj.(*apps_v1alpha.Team).GetNamespace(), obj.(*apps_v1alpha.Team).GetName())
-			event.change.enabled = obj.(*apps_v1alpha.Team).Status.Enabled
-			log.Infof("Delete team: %s", event.key)
-			if err == nil {
-				queue.Add(event)
+			if user, ok := obj.(*apps_v1alpha.User); ok {
+				enqueue(user)
 			}
 		},
-	})
-	controller := controller{
-		logger:   log.NewEntry(log.New()),
-		informer: informer,
-		queue:    queue,
-		handler:  teamHandler,
-	}
-
-	// Cluster Roles for Teams
-	// Authority admin
-	policyRule := []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"slices", "slices/status"}, Verbs: []string{"*"}}}
-	teamRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "team-admin"},
-		Rules: policyRule}
-	_, err = clientset.RbacV1().ClusterRoles().Create(teamRole)
-	if err != nil {
-		log.Infof("Couldn't create team-admin cluster role: %s", err)
 	}
-	// Authority Manager
-	policyRule = []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"slices", "slices/status"}, Verbs: []string{"*"}}}
-	teamRole = &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "team-manager"},
-		Rules: policyRule}
-	_, err = clientset.RbacV1().ClusterRoles().Create(teamRole)
-	if err != nil {
-		log.Infof("Couldn't create team-manager cluster role: %s", err)
+}
+
+// groupTeams returns the keys of the teams that have a group any of the users belongs to
+func groupTeams(teams []interface{}, users ...*apps_v1alpha.User) []string {
+	keys := []string{}
+	for _, obj := range teams {
+		teamRow := obj.(*apps_v1alpha.Team)
+		if !teamHasGroupMember(teamRow, users) {
+			continue
+		}
+		if key, err := cache.MetaNamespaceKeyFunc(teamRow); err == nil {
+			keys = append(keys, key)
+		}
 	}
-	// Authority User
-	policyRule = []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"slices", "slices/status"}, Verbs: []string{"*"}}}
-	teamRole = &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "team-user"},
-		Rules: policyRule}
-	_, err = clientset.RbacV1().ClusterRoles().Create(teamRole)
-	if err != nil {
-		log.Infof("Couldn't create team-user cluster role: %s", err)
+	return keys
+}
+
+// teamHasGroupMember checks whether any of the users belongs to a group of the team. The group without an authority
+// takes the users in the namespace of the team, as the teams are in the namespaces of their authorities.
+func teamHasGroupMember(teamRow *apps_v1alpha.Team, users []*apps_v1alpha.User) bool {
+	for _, group := range teamRow.Spec.Groups {
+		for _, user := range users {
+			userAuthority, _ := namespace.AuthorityOf(user.GetNamespace())
+			sameAuthority := user.GetNamespace() == teamRow.GetNamespace()
+			if strings.TrimSpace(group.Authority) != "" {
+				sameAuthority = groupAuthority(group, "") == userAuthority
+			}
+			if sameAuthority && inGroup(group, user) {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	// A channel to terminate elegantly
-	stopCh := make(chan struct{})
-	defer close(stopCh)
-	// Run the controller loop as a background task to start processing resources
-	go controller.run(stopCh)
-	// A channel to observe OS signals for smooth shut down
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, syscall.SIGTERM)
-	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
+// ensureClusterRoles creates the cluster roles that the role bindings of teams refer to,
+// and brings the rules of the existing ones up to date
+func ensureClusterRoles(clientset kubernetes.Interface) {
+	for _, teamRole := range clusterRoles() {
+		registration.SetManagedLabels(teamRole, "team")
+		if err := registration.EnsureClusterRole(teamRole, clientset); err != nil {
+			log.Infof("Couldn't create %s cluster role: %s", teamRole.GetName(), err)
+		}
+	}
+}
+
+// clusterRoles returns the cluster roles for teams, which grant the privileges from the most to the least
+func clusterRoles() []*rbacv1.ClusterRole {
+	// Team admin has full control over the slices and the teams nested in the team, and sees the users
+	policyRule := []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"slices", "slices/status", "teams", "teams/status"}, Verbs: []string{"*"}},
+		{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"users"}, Verbs: []string{"get", "list", "watch"}}}
+	teamAdmin := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: registration.ClusterRoleName("team-admin")}, Rules: policyRule}
+	// Team manager runs the slices, and sees the nested teams
+	policyRule = []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"slices", "slices/status"}, Verbs: []string{"*"}},
+		{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"teams"}, Verbs: []string{"get", "list", "watch"}}}
+	teamManager := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: registration.ClusterRoleName("team-manager")}, Rules: policyRule}
+	// Team user sees the slices only
+	policyRule = []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"slices", "slices/status"}, Verbs: []string{"get", "list", "watch"}}}
+	teamUser := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: registration.ClusterRoleName("team-user")}, Rules: policyRule}
+	return []*rbacv1.ClusterRole{teamAdmin, teamManager, teamUser}
 }
 
 // Run starts the controller loop
 func (c *controller) run(stopCh <-chan struct{}) {
 	// A Go panic which includes logging and terminating
 	defer utilruntime.HandleCrash()
-	// Shutdown after all goroutines have done
-	defer c.queue.ShutDown()
 	c.logger.Info("run: initiating")
 	c.handler.Init()
 	// Run the informer to list and watch resources
 	go c.informer.Run(stopCh)
+	if c.userInformer != nil {
+		go c.userInformer.Run(stopCh)
+	}
 
-	// Synchronization to settle resources one
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+	// Synchronization to settle resources one, the process exits to be restarted if the API server is unreachable
+	if !loop.WaitForCacheSync(c.logger, stopCh, c.informer.HasSynced) {
 		utilruntime.HandleError(fmt.Errorf("Error syncing cache"))
+		c.queue.ShutDown()
 		return
 	}
 	c.logger.Info("run: cache sync complete")
-	// Operate the runWorker
-	go wait.Until(c.runWorker, time.Second, stopCh)
+	// Operate the runWorkers, each of which processes a team at a time
+	var workers sync.WaitGroup
+	for i := 0; i < c.workers || i == 0; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			wait.Until(c.runWorker, time.Second, stopCh)
+		}()
+	}
 
 	<-stopCh
+	// Shutting the queue down lets the worker return after the item in process rather than being interrupted mid-way
+	c.queue.ShutDown()
+	if !waitForWorkers(&workers, c.shutdownTimeout) {
+		c.logger.Errorf("run: the item in process couldn't complete in %s", c.shutdownTimeout)
+	}
+}
+
+// lockRetryDelay is how long the event of a team waits in the queue when another event of the team or of its
+// authority is in process
+const lockRetryDelay = 500 * time.Millisecond
+
+// keyLocks serializes the processing of the events that share a key among the workers, such as those of the same team,
+// while the events of different keys proceed in parallel
+type keyLocks struct {
+	mutex      sync.Mutex
+	processing map[string]bool
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{processing: map[string]bool{}}
+}
+
+// tryLock takes the key unless another worker processes it, and returns whether it did
+func (k *keyLocks) tryLock(key string) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if k.processing[key] {
+		return false
+	}
+	k.processing[key] = true
+	return true
+}
+
+func (k *keyLocks) unlock(key string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	delete(k.processing, key)
+}
+
+// waitForWorkers waits for the workers to return until the timeout expires, zero timeout waits forever
+func waitForWorkers(workers *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	if timeout <= 0 {
+		<-done
+		return true
+	}
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
 // To process new objects added to the queue
@@ -243,7 +589,7 @@ func (c *controller) runWorker() {
 }
 
 // This function deals with the queue and sends each item in it to the specified handler to be processed.
-func (c *controller) processNextItem() bool {
+func (c *controller) processNextItem() (processed bool) {
 	log.Info("processNextItem: start")
 	// Fetch the next item of the queue
 	event, quit := c.queue.Get()
@@ -253,9 +599,31 @@ func (c *controller) processNextItem() bool {
 	defer c.queue.Done(event)
 	// Get the key string
 	keyRaw := event.(informerevent).key
+	// A panic of the handler fails the item rather than the worker, which goes on with the next one
+	defer loop.Recover(c.logger.WithField("function", event.(informerevent).function), "team", keyRaw, func(err error) {
+		c.handlerPanicked(event.(informerevent), err)
+		processed = true
+	})
+	// The queue only keeps the same event from being processed concurrently, the other events of the team and those
+	// of the teams in the same authority get back to the queue until the event in process completes, so that the
+	// worker goes on with the other teams rather than waiting
+	if !c.keyLocks.tryLock(keyRaw) {
+		c.queue.AddAfter(event, lockRetryDelay)
+		return true
+	}
+	defer c.keyLocks.unlock(keyRaw)
+	if c.authorityLocks != nil {
+		teamNamespace, _, _ := cache.SplitMetaNamespaceKey(keyRaw)
+		if !c.authorityLocks.tryLock(teamNamespace) {
+			c.queue.AddAfter(event, lockRetryDelay)
+			return true
+		}
+		defer c.authorityLocks.unlock(teamNamespace)
+	}
 	// Use the string key to get the object from the indexer
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	if err != nil {
+		c.state.reconciled(keyRaw, exists, err)
 		if c.queue.NumRequeues(event.(informerevent).key) < 5 {
 			c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, retrying", event.(informerevent).key, err)
 			c.queue.AddRateLimited(event.(informerevent).key)
@@ -267,24 +635,52 @@ func (c *controller) processNextItem() bool {
 	}
 
 	if !exists {
-		if event.(informerevent).function == delete {
+		if event.(informerevent).function == deleteEvent {
 			c.logger.Infof("Controller.processNextItem: object deleted detected: %s", keyRaw)
 			c.handler.ObjectDeleted(item, event.(informerevent).change)
 		}
 	} else {
-		if event.(informerevent).function == create {
+		if event.(informerevent).function == createEvent {
 			c.logger.Infof("Controller.processNextItem: object created detected: %s", keyRaw)
-			c.handler.ObjectCreated(item)
-		} else if event.(informerevent).function == update {
+			if err := c.handler.ObjectCreated(item); err != nil {
+				c.state.reconciled(keyRaw, exists, err)
+				events.Publish("Team", keyRaw, event.(informerevent).function, err)
+				c.requeue(event.(informerevent), err)
+				return true
+			}
+		} else if event.(informerevent).function == updateEvent {
 			c.logger.Infof("Controller.processNextItem: object updated detected: %s", keyRaw)
 			c.handler.ObjectUpdated(item, event.(informerevent).change)
 		}
 	}
+	c.state.reconciled(keyRaw, exists, nil)
+	events.Publish("Team", keyRaw, event.(informerevent).function, nil)
 	c.queue.Forget(event.(informerevent).key)
+	// Reset the retries of the event which has been requeued by the handler failures
+	c.queue.Forget(event)
 
 	return true
 }
 
+// handlerPanicked records the panic of the handler in processing the event as a failure, and requeues the event
+func (c *controller) handlerPanicked(event informerevent, err error) {
+	c.state.reconciled(event.key, true, err)
+	events.Publish("Team", event.key, event.function, err)
+	c.requeue(event, err)
+}
+
+// requeue adds the event back to the queue with rate limiting unless the failure is terminal or it has been retried enough
+func (c *controller) requeue(event informerevent, err error) {
+	if !isTerminal(err) && c.queue.NumRequeues(event) < 5 {
+		c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, retrying", event.key, err)
+		c.queue.AddRateLimited(event)
+		return
+	}
+	c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, no more retries", event.key, err)
+	c.queue.Forget(event)
+	utilruntime.HandleError(err)
+}
+
 // dry function remove the same values of the old and new objects from the old object to have
 // the slice of deleted and added values.
 func dry(oldSlice []apps_v1alpha.TeamUsers, newSlice []apps_v1alpha.TeamUsers) ([]apps_v1alpha.TeamUsers, []apps_v1alpha.TeamUsers) {
@@ -294,7 +690,7 @@ func dry(oldSlice []apps_v1alpha.TeamUsers, newSlice []apps_v1alpha.TeamUsers) (
 	for _, oldValue := range oldSlice {
 		exists := false
 		for _, newValue := range newSlice {
-			if oldValue.Authority == newValue.Authority && oldValue.Username == newValue.Username {
+			if NormalizeUser(oldValue) == NormalizeUser(newValue) {
 				exists = true
 			}
 		}
@@ -305,7 +701,7 @@ func dry(oldSlice []apps_v1alpha.TeamUsers, newSlice []apps_v1alpha.TeamUsers) (
 	for _, newValue := range newSlice {
 		exists := false
 		for _, oldValue := range oldSlice {
-			if newValue.Authority == oldValue.Authority && newValue.Username == oldValue.Username {
+			if NormalizeUser(newValue) == NormalizeUser(oldValue) {
 				exists = true
 			}
 		}
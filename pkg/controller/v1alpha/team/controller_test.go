@@ -0,0 +1,575 @@
+package team
+
+import (
+	"expvar"
+	"flag"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	appsinformer_v1 "edgenet/pkg/client/informers/externalversions/apps/v1alpha"
+	"edgenet/pkg/config"
+	"edgenet/pkg/registration"
+
+	log "github.com/Sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// slowHandler takes its time to process the teams created
+type slowHandler struct {
+	started   chan struct{}
+	completed chan struct{}
+	delay     time.Duration
+}
+
+func (h *slowHandler) Init() error { return nil }
+
+func (h *slowHandler) ObjectCreated(obj interface{}) error {
+	close(h.started)
+	time.Sleep(h.delay)
+	close(h.completed)
+	return nil
+}
+
+func (h *slowHandler) ObjectUpdated(obj, updated interface{}) {}
+
+func (h *slowHandler) ObjectDeleted(obj, deleted interface{}) {}
+
+func TestRunCompletesItemOnShutdown(t *testing.T) {
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+	informer := appsinformer_v1.NewTeamInformer(edgenettestclient.NewSimpleClientset(team), metav1.NamespaceAll, 0, cache.Indexers{})
+	handler := &slowHandler{started: make(chan struct{}), completed: make(chan struct{}), delay: 300 * time.Millisecond}
+	c := controller{
+		logger:          log.NewEntry(log.New()),
+		informer:        informer,
+		queue:           workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		handler:         handler,
+		shutdownTimeout: 5 * time.Second,
+		keyLocks:        newKeyLocks(),
+		state:           newReconcileState(),
+	}
+	c.queue.Add(informerevent{key: "authority-edgenet/demo", function: createEvent})
+	stopCh := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		c.run(stopCh)
+		close(returned)
+	}()
+
+	// Shut down while the handler is processing the item
+	<-handler.started
+	close(stopCh)
+	<-returned
+	select {
+	case <-handler.completed:
+	default:
+		t.Error("run returned before the item in process completed")
+	}
+}
+
+// concurrencyHandler records how many teams, and how many events of each team, are processed at once
+type concurrencyHandler struct {
+	mutex      sync.Mutex
+	processing map[string]int
+	total      int
+	maxTotal   int
+	maxPerKey  map[string]int
+	processed  sync.WaitGroup
+}
+
+func (h *concurrencyHandler) Init() error { return nil }
+
+func (h *concurrencyHandler) process(obj interface{}) {
+	defer h.processed.Done()
+	key, _ := cache.MetaNamespaceKeyFunc(obj)
+	h.mutex.Lock()
+	h.processing[key]++
+	h.total++
+	if h.processing[key] > h.maxPerKey[key] {
+		h.maxPerKey[key] = h.processing[key]
+	}
+	if h.total > h.maxTotal {
+		h.maxTotal = h.total
+	}
+	h.mutex.Unlock()
+	time.Sleep(200 * time.Millisecond)
+	h.mutex.Lock()
+	h.processing[key]--
+	h.total--
+	h.mutex.Unlock()
+}
+
+func (h *concurrencyHandler) ObjectCreated(obj interface{}) error {
+	h.process(obj)
+	return nil
+}
+
+func (h *concurrencyHandler) ObjectUpdated(obj, updated interface{}) { h.process(obj) }
+
+func (h *concurrencyHandler) ObjectDeleted(obj, deleted interface{}) {}
+
+func TestRunWorkersInParallel(t *testing.T) {
+	edgenetClientset := edgenettestclient.NewSimpleClientset(
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "alpha", Namespace: "authority-edgenet"}},
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "beta", Namespace: "authority-edgenet"}},
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "gamma", Namespace: "authority-edgenet"}})
+	informer := appsinformer_v1.NewTeamInformer(edgenetClientset, metav1.NamespaceAll, 0, cache.Indexers{})
+	handler := &concurrencyHandler{processing: map[string]int{}, maxPerKey: map[string]int{}}
+	c := controller{
+		logger:          log.NewEntry(log.New()),
+		informer:        informer,
+		queue:           workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		handler:         handler,
+		shutdownTimeout: 5 * time.Second,
+		workers:         4,
+		keyLocks:        newKeyLocks(),
+		state:           newReconcileState(),
+	}
+	// Two distinct events of alpha along with the events of the other teams
+	events := []informerevent{
+		{key: "authority-edgenet/alpha", function: createEvent},
+		{key: "authority-edgenet/alpha", function: updateEvent, change: fields{resync: true}},
+		{key: "authority-edgenet/beta", function: createEvent},
+		{key: "authority-edgenet/gamma", function: createEvent},
+	}
+	handler.processed.Add(len(events))
+	for _, event := range events {
+		c.queue.Add(event)
+	}
+	stopCh := make(chan struct{})
+	go c.run(stopCh)
+	handler.processed.Wait()
+	close(stopCh)
+
+	if handler.maxTotal < 2 {
+		t.Errorf("distinct teams processed one at a time with %d workers", c.workers)
+	}
+	if handler.maxPerKey["authority-edgenet/alpha"] != 1 {
+		t.Errorf("events of the same team processed concurrently: %d at once", handler.maxPerKey["authority-edgenet/alpha"])
+	}
+}
+
+func TestKeyLocks(t *testing.T) {
+	locks := newKeyLocks()
+	if !locks.tryLock("authority-edgenet") || !locks.tryLock("authority-lip6") {
+		t.Fatal("distinct keys not taken at once")
+	}
+	if locks.tryLock("authority-edgenet") {
+		t.Error("key taken while another worker holds it")
+	}
+	locks.unlock("authority-edgenet")
+	if !locks.tryLock("authority-edgenet") {
+		t.Error("key not taken after its release")
+	}
+	locks.unlock("authority-edgenet")
+	locks.unlock("authority-lip6")
+	// The keys released are forgotten
+	if len(locks.processing) != 0 {
+		t.Errorf("keys kept after their release: %v", locks.processing)
+	}
+}
+
+func TestLockedEventRequeued(t *testing.T) {
+	edgenetClientset := edgenettestclient.NewSimpleClientset(
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "alpha", Namespace: "authority-edgenet"}})
+	informer := appsinformer_v1.NewTeamInformer(edgenetClientset, metav1.NamespaceAll, 0, cache.Indexers{})
+	handler := &concurrencyHandler{processing: map[string]int{}, maxPerKey: map[string]int{}}
+	c := controller{
+		logger:         log.NewEntry(log.New()),
+		informer:       informer,
+		queue:          workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		handler:        handler,
+		keyLocks:       newKeyLocks(),
+		authorityLocks: newKeyLocks(),
+		state:          newReconcileState(),
+	}
+	// Another worker processes a team of the same authority
+	c.authorityLocks.tryLock("authority-edgenet")
+	c.queue.Add(informerevent{key: "authority-edgenet/alpha", function: createEvent})
+
+	// The worker gets back the event to the queue rather than waiting for the authority
+	returned := make(chan struct{})
+	go func() {
+		c.processNextItem()
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(lockRetryDelay / 2):
+		t.Fatal("worker waits for the lock of the authority")
+	}
+	if handler.total != 0 || c.keyLocks.tryLock("authority-edgenet/alpha") == false {
+		t.Error("event processed or its team kept locked while the authority is locked")
+	}
+	c.keyLocks.unlock("authority-edgenet/alpha")
+	c.authorityLocks.unlock("authority-edgenet")
+	// The event comes back once the delay expires
+	time.Sleep(2 * lockRetryDelay)
+	if c.queue.Len() != 1 {
+		t.Fatalf("%d events in the queue, expected the event of the team", c.queue.Len())
+	}
+	if event, _ := c.queue.Get(); event.(informerevent).key != "authority-edgenet/alpha" {
+		t.Errorf("requeued %v, expected the event of the team", event)
+	}
+}
+
+// panickingHandler panics in processing the team named, as a nil pointer dereference does, and records the others
+type panickingHandler struct {
+	panicOn   string
+	processed []string
+}
+
+func (h *panickingHandler) Init() error { return nil }
+
+func (h *panickingHandler) ObjectCreated(obj interface{}) error {
+	teamRow := obj.(*apps_v1alpha.Team)
+	if teamRow.GetName() == h.panicOn {
+		var owner *apps_v1alpha.Authority
+		_ = owner.GetName()
+	}
+	h.processed = append(h.processed, teamRow.GetName())
+	return nil
+}
+
+func (h *panickingHandler) ObjectUpdated(obj, updated interface{}) {}
+
+func (h *panickingHandler) ObjectDeleted(obj, deleted interface{}) {}
+
+func TestRecoverHandlerPanic(t *testing.T) {
+	informer := appsinformer_v1.NewTeamInformer(edgenettestclient.NewSimpleClientset(), metav1.NamespaceAll, 0, cache.Indexers{})
+	informer.GetIndexer().Add(&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "alpha", Namespace: "authority-edgenet"}})
+	informer.GetIndexer().Add(&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "beta", Namespace: "authority-edgenet"}})
+	handler := &panickingHandler{panicOn: "alpha"}
+	c := controller{
+		logger:   log.NewEntry(log.New()),
+		informer: informer,
+		queue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		handler:  handler,
+		keyLocks: newKeyLocks(),
+		state:    newReconcileState(),
+	}
+	panicked := informerevent{key: "authority-edgenet/alpha", function: createEvent}
+	c.queue.Add(panicked)
+	c.queue.Add(informerevent{key: "authority-edgenet/beta", function: createEvent})
+	panics := expvar.Get("edgenet_controller_panics_total").(*expvar.Map)
+	before, _ := panics.Get("team").(*expvar.Int)
+	var panicsBefore int64
+	if before != nil {
+		panicsBefore = before.Value()
+	}
+
+	// The worker goes on with the next team after the panic
+	for i := 0; i < 2; i++ {
+		if !c.processNextItem() {
+			t.Fatal("worker stopped after the panic")
+		}
+	}
+	if len(handler.processed) != 1 || handler.processed[0] != "beta" {
+		t.Errorf("processed %v, expected the team after the panic", handler.processed)
+	}
+	if c.queue.NumRequeues(panicked) != 1 {
+		t.Error("team whose handler panicked not requeued")
+	}
+	if after := panics.Get("team").(*expvar.Int).Value(); after != panicsBefore+1 {
+		t.Errorf("%d panics counted, expected %d", after, panicsBefore+1)
+	}
+	recentErrors := c.state.snapshot().RecentErrors
+	if len(recentErrors) != 1 || recentErrors[0].Key != "authority-edgenet/alpha" || !strings.Contains(recentErrors[0].Error, "panicked") {
+		t.Errorf("recent errors are %v, expected the panic", recentErrors)
+	}
+	// The lock of the team is released so that its retry can proceed
+	if !c.keyLocks.tryLock("authority-edgenet/alpha") {
+		t.Error("lock of the team held after the panic")
+	}
+}
+
+func TestInformerScope(t *testing.T) {
+	teams := []runtime.Object{
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet", Labels: map[string]string{"shard": "a"}}},
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "authority-edgenet", Labels: map[string]string{"shard": "b"}}},
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-lip6", Labels: map[string]string{"shard": "a"}}},
+	}
+	cases := []struct {
+		namespace     string
+		labelSelector string
+		expected      []string
+	}{
+		{"", "", []string{"authority-edgenet/demo", "authority-edgenet/other", "authority-lip6/demo"}},
+		{"authority-edgenet", "", []string{"authority-edgenet/demo", "authority-edgenet/other"}},
+		{"", "shard=a", []string{"authority-edgenet/demo", "authority-lip6/demo"}},
+		{"authority-edgenet", "shard=a", []string{"authority-edgenet/demo"}},
+	}
+	for _, c := range cases {
+		informer := newInformer(edgenettestclient.NewSimpleClientset(teams...), 0, c.namespace, c.labelSelector)
+		stopCh := make(chan struct{})
+		go informer.Run(stopCh)
+		if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+			t.Fatal("cache not synced")
+		}
+		keys := informer.GetStore().ListKeys()
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, c.expected) {
+			t.Errorf("namespace %q and selector %q: expected %v, got %v", c.namespace, c.labelSelector, c.expected, keys)
+		}
+		close(stopCh)
+	}
+}
+
+func TestEnsureClusterRolesUpdatesStaleRules(t *testing.T) {
+	// A role left by an earlier release, which granted the users read access only
+	staleRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "team-user"},
+		Rules: []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"slices"}, Verbs: []string{"get", "list"}}}}
+	clientset := testclient.NewSimpleClientset(staleRole)
+
+	ensureClusterRoles(clientset)
+	for _, expected := range clusterRoles() {
+		clusterRole, err := clientset.RbacV1().ClusterRoles().Get(expected.GetName(), metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("%s cluster role not created: %s", expected.GetName(), err)
+		} else if !reflect.DeepEqual(clusterRole.Rules, expected.Rules) {
+			t.Errorf("%s cluster role has the rules %v, expected %v", expected.GetName(), clusterRole.Rules, expected.Rules)
+		}
+	}
+	// The roles up to date are left alone
+	clientset.ClearActions()
+	ensureClusterRoles(clientset)
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("cluster role updated although its rules are up to date: %v", action)
+		}
+	}
+}
+
+// allows checks whether any of the rules grants the verb on the resource
+func allows(rules []rbacv1.PolicyRule, resource, verb string) bool {
+	for _, rule := range rules {
+		for _, ruleResource := range rule.Resources {
+			for _, ruleVerb := range rule.Verbs {
+				if ruleResource == resource && (ruleVerb == verb || ruleVerb == "*") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func TestClusterRolePrivileges(t *testing.T) {
+	rules := map[string][]rbacv1.PolicyRule{}
+	for _, clusterRole := range clusterRoles() {
+		rules[clusterRole.GetName()] = clusterRole.Rules
+	}
+	data := []struct {
+		resource string
+		verb     string
+		roles    []string
+	}{
+		{"slices", "get", []string{"team-admin", "team-manager", "team-user"}},
+		{"slices", "create", []string{"team-admin", "team-manager"}},
+		{"slices", "delete", []string{"team-admin", "team-manager"}},
+		{"slices/status", "update", []string{"team-admin", "team-manager"}},
+		{"teams", "list", []string{"team-admin", "team-manager"}},
+		{"teams", "create", []string{"team-admin"}},
+		{"teams", "update", []string{"team-admin"}},
+		{"users", "list", []string{"team-admin"}},
+		{"users", "update", []string{}},
+	}
+	for _, test := range data {
+		for _, role := range []string{"team-admin", "team-manager", "team-user"} {
+			expected := false
+			for _, allowedRole := range test.roles {
+				expected = expected || allowedRole == role
+			}
+			if allowed := allows(rules[role], test.resource, test.verb); allowed != expected {
+				t.Errorf("%s allowed to %s %s: %t, expected %t", role, test.verb, test.resource, allowed, expected)
+			}
+		}
+	}
+}
+
+func TestClusterRolePrefix(t *testing.T) {
+	registration.SetClusterRolePrefix("edgenet:")
+	defer registration.SetClusterRolePrefix("")
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "joe", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.UserSpec{Roles: []string{"Admin", "Manager", "User"}}, Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "joe"}}}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, user, team),
+	}
+
+	ensureClusterRoles(handler.clientset)
+	handler.reconcile(team.DeepCopy())
+	clusterRoles := map[string]bool{}
+	clusterRolesRaw, _ := handler.clientset.RbacV1().ClusterRoles().List(metav1.ListOptions{})
+	for _, clusterRoleRow := range clusterRolesRaw.Items {
+		if !strings.HasPrefix(clusterRoleRow.GetName(), "edgenet:") {
+			t.Errorf("cluster role %s created without the prefix", clusterRoleRow.GetName())
+		}
+		clusterRoles[clusterRoleRow.GetName()] = true
+	}
+	// Each role binding refers to a cluster role that the controller has created
+	roleBindingsRaw, _ := handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").List(metav1.ListOptions{})
+	if len(roleBindingsRaw.Items) != 3 {
+		t.Errorf("expected a role binding per role, got %d", len(roleBindingsRaw.Items))
+	}
+	for _, roleBindingRow := range roleBindingsRaw.Items {
+		if !clusterRoles[roleBindingRow.RoleRef.Name] {
+			t.Errorf("role binding %s refers to %s, which isn't among the cluster roles %v", roleBindingRow.GetName(), roleBindingRow.RoleRef.Name, clusterRoles)
+		}
+		if strings.Contains(roleBindingRow.GetName(), "edgenet:") {
+			t.Errorf("role binding %s named after the prefixed cluster role", roleBindingRow.GetName())
+		}
+	}
+}
+
+func TestGroupMembershipEnqueuesTeams(t *testing.T) {
+	teams := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	teams.Add(&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "techs", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Groups: []apps_v1alpha.TeamGroup{{Roles: []string{"Tech"}}}}})
+	teams.Add(&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "partners", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Groups: []apps_v1alpha.TeamGroup{{Authority: "lip6"}}}})
+	teams.Add(&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "listed", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "joe"}}}})
+	newUser := func(namespace string, roles ...string) *apps_v1alpha.User {
+		return &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "joe", Namespace: namespace},
+			Spec: apps_v1alpha.UserSpec{Roles: roles}, Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	}
+	queued := func(queue workqueue.Interface) []string {
+		keys := []string{}
+		for queue.Len() > 0 {
+			item, _ := queue.Get()
+			keys = append(keys, item.(informerevent).key)
+			queue.Done(item)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	cases := []struct {
+		name     string
+		old, new *apps_v1alpha.User
+		expected []string
+	}{
+		{"role granted", newUser("authority-edgenet", "User"), newUser("authority-edgenet", "User", "Tech"), []string{"authority-edgenet/techs"}},
+		{"role revoked", newUser("authority-edgenet", "Tech"), newUser("authority-edgenet", "User"), []string{"authority-edgenet/techs"}},
+		{"roles unchanged", newUser("authority-edgenet", "Tech"), newUser("authority-edgenet", "Tech"), []string{}},
+		{"other authority", newUser("authority-lip6", "User"), newUser("authority-lip6", "Manager"), []string{"authority-edgenet/partners"}},
+	}
+	for _, c := range cases {
+		queue := workqueue.New()
+		groupMembershipHandler(teams, queue).OnUpdate(c.old, c.new)
+		if keys := queued(queue); !reflect.DeepEqual(keys, c.expected) {
+			t.Errorf("%s: enqueued %v, expected %v", c.name, keys, c.expected)
+		}
+	}
+
+	// A new user in the group reconciles the team as well
+	queue := workqueue.New()
+	groupMembershipHandler(teams, queue).OnAdd(newUser("authority-edgenet", "Tech"))
+	if keys := queued(queue); !reflect.DeepEqual(keys, []string{"authority-edgenet/techs"}) {
+		t.Errorf("enqueued %v on creation", keys)
+	}
+}
+
+func TestAuthorityFilter(t *testing.T) {
+	defer SetAuthorityFilter("")
+	SetAuthorityFilter("edgenet")
+	newTeam := func(namespace, name string) *apps_v1alpha.Team {
+		return &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: apps_v1alpha.TeamSpec{Groups: []apps_v1alpha.TeamGroup{{Roles: []string{"Tech"}}}}}
+	}
+	handled := []string{}
+	record := func(obj interface{}) {
+		key, _ := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		handled = append(handled, key)
+	}
+	handler := cache.FilteringResourceEventHandler{
+		FilterFunc: inAuthority(authorityFilter),
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    record,
+			UpdateFunc: func(oldObj, newObj interface{}) { record(newObj) },
+			DeleteFunc: record,
+		},
+	}
+	handler.OnAdd(newTeam("authority-edgenet", "demo"))
+	handler.OnAdd(newTeam("authority-lip6", "demo"))
+	handler.OnUpdate(newTeam("authority-lip6", "demo"), newTeam("authority-lip6", "demo"))
+	handler.OnDelete(newTeam("authority-lip6", "demo"))
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "authority-lip6/other", Obj: newTeam("authority-lip6", "other")})
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "authority-edgenet/other", Obj: newTeam("authority-edgenet", "other")})
+	// The authority whose name starts with that of the filter is another authority
+	handler.OnAdd(newTeam("authority-edgenet-lab", "demo"))
+	if expected := []string{"authority-edgenet/demo", "authority-edgenet/other"}; !reflect.DeepEqual(handled, expected) {
+		t.Errorf("handled %v, expected the teams of the authority only %v", handled, expected)
+	}
+
+	// The changes of the users don't enqueue the teams of the other authorities either
+	teams := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	teams.Add(newTeam("authority-edgenet", "techs"))
+	teams.Add(newTeam("authority-lip6", "techs"))
+	queue := workqueue.New()
+	groupMembershipHandler(teams, queue).OnAdd(&apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "joe", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.UserSpec{Roles: []string{"Tech"}}})
+	groupMembershipHandler(teams, queue).OnAdd(&apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "joe", Namespace: "authority-lip6"},
+		Spec: apps_v1alpha.UserSpec{Roles: []string{"Tech"}}})
+	if queue.Len() != 1 {
+		t.Fatalf("enqueued %d teams, expected that of the authority only", queue.Len())
+	}
+	if item, _ := queue.Get(); item.(informerevent).key != "authority-edgenet/techs" {
+		t.Errorf("enqueued %s", item.(informerevent).key)
+	}
+
+	// No authority processes all teams
+	if !inAuthority("")(newTeam("authority-lip6", "demo")) {
+		t.Error("team filtered without an authority")
+	}
+}
+
+func TestClusterRoleManagementDisabled(t *testing.T) {
+	SetClusterRoleManagement(false)
+	defer SetClusterRoleManagement(true)
+	clientset := testclient.NewSimpleClientset()
+	// The controller stops right after the start, which has ensured the cluster roles if they are managed
+	stopCh := make(chan struct{})
+	close(stopCh)
+	Run(clientset, edgenettestclient.NewSimpleClientset(), config.Default(), stopCh)
+	for _, action := range clientset.Actions() {
+		if action.GetResource().Resource == "clusterroles" {
+			t.Errorf("cluster roles written while managed externally: %s", action.GetVerb())
+		}
+	}
+}
+
+func TestAddFlags(t *testing.T) {
+	defer func(namespace, authority string, isolation bool) {
+		watchNamespace, authorityFilter, networkIsolation = namespace, authority, isolation
+	}(watchNamespace, authorityFilter, networkIsolation)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	AddFlags(fs, "team-")
+	if err := fs.Parse([]string{"--team-namespace", "authority-lip6", "--team-authority", "lip6", "--team-network-isolation"}); err != nil {
+		t.Fatal(err)
+	}
+	if watchNamespace != "authority-lip6" || authorityFilter != "lip6" || !networkIsolation {
+		t.Errorf("options are %q, %q, and %t, expected the flag values", watchNamespace, authorityFilter, networkIsolation)
+	}
+	// The options left out keep their defaults
+	if !authoritySerialization || shutdownTimeout != 30*time.Second {
+		t.Error("options left out of the command line changed")
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package team
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// NamespaceCreateError is returned when the child namespace of a team cannot be created
+type NamespaceCreateError struct {
+	Namespace string
+	Err       error
+}
+
+func (e *NamespaceCreateError) Error() string {
+	return fmt.Sprintf("Couldn't create child namespace %s: %s", e.Namespace, e.Err)
+}
+
+// Unwrap returns the underlying cause
+func (e *NamespaceCreateError) Unwrap() error {
+	return e.Err
+}
+
+// RoleBindingError is returned when the role bindings of a user cannot be created in the child namespace
+type RoleBindingError struct {
+	Namespace string
+	Username  string
+	Err       error
+}
+
+func (e *RoleBindingError) Error() string {
+	return fmt.Sprintf("Couldn't create the role bindings of %s in %s: %s", e.Username, e.Namespace, e.Err)
+}
+
+// Unwrap returns the underlying cause
+func (e *RoleBindingError) Unwrap() error {
+	return e.Err
+}
+
+// GroupReadError is returned when the users of a group of the team cannot be listed, in which case the role bindings are
+// left as they are rather than revoking the access of the users in the group
+type GroupReadError struct {
+	Authority string
+	Err       error
+}
+
+func (e *GroupReadError) Error() string {
+	return fmt.Sprintf("Couldn't list the users of authority %s in the team groups: %s", e.Authority, e.Err)
+}
+
+// Unwrap returns the underlying cause
+func (e *GroupReadError) Unwrap() error {
+	return e.Err
+}
+
+// AuthorityReadError is returned when the authority of a team cannot be read, which differs from the authority being
+// disabled as the access of the users must be kept
+type AuthorityReadError struct {
+	Namespace string
+	Authority string
+	Err       error
+}
+
+func (e *AuthorityReadError) Error() string {
+	if e.Authority == "" {
+		return fmt.Sprintf("Couldn't read the authority of namespace %s: %s", e.Namespace, e.Err)
+	}
+	return fmt.Sprintf("Couldn't read authority %s: %s", e.Authority, e.Err)
+}
+
+// Unwrap returns the underlying cause
+func (e *AuthorityReadError) Unwrap() error {
+	return e.Err
+}
+
+// StatusUpdateError is returned when the status of a team cannot be written once the team has been reconciled
+type StatusUpdateError struct {
+	Team string
+	Err  error
+}
+
+func (e *StatusUpdateError) Error() string {
+	return fmt.Sprintf("Couldn't update the status of team %s: %s", e.Team, e.Err)
+}
+
+// Unwrap returns the underlying cause
+func (e *StatusUpdateError) Unwrap() error {
+	return e.Err
+}
+
+// MailError is returned when a notification cannot be sent to a user
+type MailError struct {
+	Subject  string
+	Username string
+	Err      error
+}
+
+func (e *MailError) Error() string {
+	return fmt.Sprintf("Couldn't send %s email to %s: %s", e.Subject, e.Username, e.Err)
+}
+
+// Unwrap returns the underlying cause
+func (e *MailError) Unwrap() error {
+	return e.Err
+}
+
+// isTerminal tells whether retrying cannot resolve the failure, which is the case when the API server rejects
+// the object itself as malformed. An object that already exists or a request that is forbidden may well succeed
+// once the conflicting object is gone or the permissions are granted, so they are retried.
+func isTerminal(err error) bool {
+	var cause error
+	switch typedErr := err.(type) {
+	case *NamespaceCreateError:
+		cause = typedErr.Err
+	case *RoleBindingError:
+		cause = typedErr.Err
+	default:
+		return false
+	}
+	return errors.IsInvalid(cause) || errors.IsBadRequest(cause)
+}
+
+// ImportRowError is returned when a row of the users to import into a team is malformed, the row is skipped
+type ImportRowError struct {
+	Row int
+	Err error
+}
+
+func (e *ImportRowError) Error() string {
+	return fmt.Sprintf("Row %d skipped: %s", e.Row, e.Err)
+}
+
+// Unwrap returns the underlying cause
+func (e *ImportRowError) Unwrap() error {
+	return e.Err
+}
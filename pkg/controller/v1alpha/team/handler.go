@@ -19,110 +19,87 @@ package team
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 
 	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
 	"edgenet/pkg/client/clientset/versioned"
 	"edgenet/pkg/mailer"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/notifier"
 	"edgenet/pkg/registration"
+	"edgenet/pkg/suspension"
 
 	log "github.com/Sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 )
 
+// ParentNamespaceLabel tells the namespace of the team that a child namespace has been created for, as the teams can be
+// nested in the child namespaces of other teams
+const ParentNamespaceLabel = "edge-net.io/parent-namespace"
+
+// EnablingAnnotation marks the child namespace that has been created for a team until the status of the team tells that
+// it is enabled, so that a team whose status write has been lost isn't taken as disabled on purpose
+const EnablingAnnotation = "edge-net.io/enabling"
+
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init() error
-	ObjectCreated(obj interface{})
+	ObjectCreated(obj interface{}) error
 	ObjectUpdated(obj, updated interface{})
 	ObjectDeleted(obj, deleted interface{})
 }
 
 // Handler implementation
 type Handler struct {
-	clientset        *kubernetes.Clientset
-	edgenetClientset *versioned.Clientset
-	resourceQuota    *corev1.ResourceQuota
+	clientset        kubernetes.Interface
+	edgenetClientset versioned.Interface
+	networkIsolation bool
+	// unresolvedNotification makes the handler email the owners of a team about its users whose authority doesn't exist
+	unresolvedNotification bool
 }
 
 // Init handles any handler initialization
 func (t *Handler) Init() error {
 	log.Info("TeamHandler.Init")
 	var err error
-	t.clientset, err = authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clientsets may have been given to share them with other controllers
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
-	t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
-	}
-	t.resourceQuota = &corev1.ResourceQuota{}
-	t.resourceQuota.Name = "team-quota"
-	t.resourceQuota.Spec = corev1.ResourceQuotaSpec{
-		Hard: map[corev1.ResourceName]resource.Quantity{
-			"cpu":                           resource.MustParse("5m"),
-			"memory":                        resource.MustParse("1Mi"),
-			"requests.storage":              resource.MustParse("1Mi"),
-			"pods":                          resource.Quantity{Format: "0"},
-			"count/persistentvolumeclaims":  resource.Quantity{Format: "0"},
-			"count/services":                resource.Quantity{Format: "0"},
-			"count/configmaps":              resource.Quantity{Format: "0"},
-			"count/replicationcontrollers":  resource.Quantity{Format: "0"},
-			"count/deployments.apps":        resource.Quantity{Format: "0"},
-			"count/deployments.extensions":  resource.Quantity{Format: "0"},
-			"count/replicasets.apps":        resource.Quantity{Format: "0"},
-			"count/replicasets.extensions":  resource.Quantity{Format: "0"},
-			"count/statefulsets.apps":       resource.Quantity{Format: "0"},
-			"count/statefulsets.extensions": resource.Quantity{Format: "0"},
-			"count/jobs.batch":              resource.Quantity{Format: "0"},
-			"count/cronjobs.batch":          resource.Quantity{Format: "0"},
-		},
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
 	return err
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the error returned tells the controller whether to retry
+func (t *Handler) ObjectCreated(obj interface{}) error {
 	log.Info("TeamHandler.ObjectCreated")
 	// Create a copy of the team object to make changes on it
 	teamCopy := obj.(*apps_v1alpha.Team).DeepCopy()
-	// Find the authority from the namespace in which the object is
-	teamOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(teamCopy.GetNamespace(), metav1.GetOptions{})
-	teamOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(teamOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
-	// Check if the authority is active
-	if teamOwnerAuthority.Status.Enabled && !teamCopy.Status.Enabled {
-		// If the service restarts, it creates all objects again
-		// Because of that, this section covers a variety of possibilities
-		_, err := t.clientset.CoreV1().Namespaces().Get(fmt.Sprintf("%s-team-%s", teamCopy.GetNamespace(), teamCopy.GetName()), metav1.GetOptions{})
-		if err != nil {
-			// When a team is deleted, the owner references feature allows the namespace to be automatically removed. Additionally,
-			// when all users who participate in the team are disabled, the team is automatically removed because of the owner references.
-			// Enable the team
-			teamCopy.Status.Enabled = true
-			defer t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).UpdateStatus(teamCopy)
-			// Each namespace created by teams have an indicator as "team" to provide singularity
-			teamChildNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-team-%s", teamCopy.GetNamespace(), teamCopy.GetName())}}
-			// Namespace labels indicate this namespace created by a team, not by a authority or slice
-			namespaceLabels := map[string]string{"owner": "team", "owner-name": teamCopy.GetName(), "authority-name": teamOwnerNamespace.Labels["authority-name"]}
-			teamChildNamespace.SetLabels(namespaceLabels)
-			teamChildNamespaceCreated, err := t.clientset.CoreV1().Namespaces().Create(teamChildNamespace)
-			if err != nil {
-				t.runUserInteractions(teamCopy, teamChildNamespaceCreated.GetName(), teamOwnerNamespace.Labels["authority-name"],
-					teamOwnerNamespace.Labels["owner"], teamOwnerNamespace.Labels["owner-name"], "team-crash", true)
-				t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Delete(teamCopy.GetName(), &metav1.DeleteOptions{})
-				return
-			}
-		}
-	} else if !teamOwnerAuthority.Status.Enabled {
-		t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Delete(teamCopy.GetName(), &metav1.DeleteOptions{})
+	if suspension.IsSuspended(teamCopy) {
+		log.Infof("Team %s in %s is suspended, skipping", teamCopy.GetName(), teamCopy.GetNamespace())
+		return nil
 	}
+	return t.reconcile(teamCopy)
 }
 
 // ObjectUpdated is called when an object is updated
@@ -130,39 +107,191 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 	log.Info("TeamHandler.ObjectUpdated")
 	// Create a copy of the team object to make changes on it
 	teamCopy := obj.(*apps_v1alpha.Team).DeepCopy()
-	// Find the authority from the namespace in which the object is
-	teamOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(teamCopy.GetNamespace(), metav1.GetOptions{})
-	teamOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(teamOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
-	teamChildNamespaceStr := fmt.Sprintf("%s-team-%s", teamCopy.GetNamespace(), teamCopy.GetName())
+	if suspension.IsSuspended(teamCopy) {
+		log.Infof("Team %s in %s is suspended, skipping", teamCopy.GetName(), teamCopy.GetNamespace())
+		return
+	}
+	if err := t.reconcile(teamCopy); err != nil {
+		log.Infof("Couldn't reconcile team %s in %s: %s", teamCopy.GetName(), teamCopy.GetNamespace(), err)
+	}
+	// The emails depend on the change that the event brings, unlike the state of the team
 	fieldUpdated := updated.(fields)
-	// Check if the authority and team are active
-	if teamOwnerAuthority.Status.Enabled && teamCopy.Status.Enabled {
-		if fieldUpdated.users.status || fieldUpdated.enabled {
-			// Delete all existing role bindings in the team (child) namespace
-			t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).DeleteCollection(&metav1.DeleteOptions{}, metav1.ListOptions{})
-			// Create rolebindings according to the users who participate in the team and are authority-admin and managers of the authority
-			t.runUserInteractions(teamCopy, teamChildNamespaceStr, teamOwnerNamespace.Labels["authority-name"], teamOwnerNamespace.Labels["owner"], teamOwnerNamespace.Labels["owner-name"], "team-creation", fieldUpdated.enabled)
-			// Send emails to those who have been added to, or removed from the slice.
-			var deletedUserList []apps_v1alpha.TeamUsers
-			json.Unmarshal([]byte(fieldUpdated.users.deleted), &deletedUserList)
-			var addedUserList []apps_v1alpha.TeamUsers
-			json.Unmarshal([]byte(fieldUpdated.users.added), &addedUserList)
-			if len(deletedUserList) > 0 {
-				for _, deletedUser := range deletedUserList {
-					t.sendEmail(deletedUser.Username, deletedUser.Authority, teamOwnerNamespace.Labels["authority-name"], teamCopy.GetNamespace(), teamCopy.GetName(), teamChildNamespaceStr, "team-removal")
-				}
+	if !teamCopy.Status.Enabled || !(fieldUpdated.users.status || fieldUpdated.enabled || fieldUpdated.resync) {
+		return
+	}
+	// The reconciliation has already reported the failure to read the namespace or the authority, and the emails wait
+	// for the next event in that case
+	teamOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(teamCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	teamOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(teamOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil || !teamOwnerAuthority.Status.Enabled {
+		return
+	}
+	teamChildNamespaceStr := namespace.ChildName(teamCopy.GetNamespace(), "team", teamCopy.GetName())
+	var errs []error
+	if fieldUpdated.resync {
+		t.deleteOrphanedNamespaces(teamCopy.GetNamespace(), teamOwnerNamespace.Labels["authority-name"])
+		// The invitations that couldn't be sent are retried at each resync
+		errs = append(errs, t.resendInvitations(teamCopy, teamOwnerNamespace.Labels["authority-name"])...)
+	}
+	if fieldUpdated.enabled {
+		errs = append(errs, t.invite(teamCopy, teamCopy.Spec.Users, teamOwnerNamespace.Labels["authority-name"])...)
+	}
+	if fieldUpdated.users.status {
+		// Send emails to those who have been added to, or removed from the team.
+		var deletedUserList []apps_v1alpha.TeamUsers
+		json.Unmarshal([]byte(fieldUpdated.users.deleted), &deletedUserList)
+		var addedUserList []apps_v1alpha.TeamUsers
+		json.Unmarshal([]byte(fieldUpdated.users.added), &addedUserList)
+		for _, deletedUser := range deletedUserList {
+			if err := t.sendEmail(occurrence(teamCopy), deletedUser.Username, deletedUser.Authority, teamOwnerNamespace.Labels["authority-name"], teamCopy.GetNamespace(), teamCopy.GetName(), teamChildNamespaceStr, "team-removal"); err != nil {
+				errs = append(errs, err)
 			}
-			if len(addedUserList) > 0 {
-				for _, addedUser := range addedUserList {
-					t.sendEmail(addedUser.Username, addedUser.Authority, teamOwnerNamespace.Labels["authority-name"], teamCopy.GetNamespace(), teamCopy.GetName(), teamChildNamespaceStr, "team-creation")
-				}
+		}
+		if !fieldUpdated.enabled {
+			errs = append(errs, t.invite(teamCopy, addedUserList, teamOwnerNamespace.Labels["authority-name"])...)
+		}
+	}
+	for _, err := range errs {
+		log.Infof("Team %s in %s: %s", teamCopy.GetName(), teamCopy.GetNamespace(), err)
+	}
+}
+
+// reconcile converges the child namespace of the team, its metadata, quota, network policies, and role bindings, along with
+// the team status, toward the state that the team and its authority call for. It doesn't depend on the event that triggered it,
+// and it only writes what differs from the desired state, so that running it again on a reconciled team changes nothing
+func (t *Handler) reconcile(teamCopy *apps_v1alpha.Team) error {
+	// Find the authority from the namespace in which the object is
+	teamOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(teamCopy.GetNamespace(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		// The namespace of the authority is being deleted, which takes the team along with it
+		log.Infof("Team %s in %s: namespace not found, skipping", teamCopy.GetName(), teamCopy.GetNamespace())
+		return nil
+	} else if err != nil {
+		err = &AuthorityReadError{Namespace: teamCopy.GetNamespace(), Err: err}
+		t.setFailure(teamCopy, err.Error())
+		return err
+	}
+	authorityName := teamOwnerNamespace.Labels["authority-name"]
+	teamOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(authorityName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		// The authority that cannot be read may well be enabled, so the access of the users is kept until the retry
+		err = &AuthorityReadError{Namespace: teamCopy.GetNamespace(), Authority: authorityName, Err: err}
+		t.setFailure(teamCopy, err.Error())
+		return err
+	}
+	// Check if the authority is active, the authority that no longer exists is no more active
+	teamChildNamespaceStr := namespace.ChildName(teamCopy.GetNamespace(), "team", teamCopy.GetName())
+	if err != nil || !teamOwnerAuthority.Status.Enabled {
+		// The team of a disabled authority is kept along with its namespace and slices, only its users lose their access
+		// until the authority is enabled again
+		t.deleteManagedRoleBindings(teamChildNamespaceStr)
+		t.setObserved(teamCopy)
+		return nil
+	}
+	if err := namespace.ValidateName(teamChildNamespaceStr); err != nil {
+		t.setFailure(teamCopy, fmt.Sprintf("Child namespace of the team cannot be created: %s", err))
+		return nil
+	}
+	teamChildNamespace, err := t.clientset.CoreV1().Namespaces().Get(teamChildNamespaceStr, metav1.GetOptions{})
+	if err == nil && !isChildNamespaceOf(teamChildNamespace, teamCopy, authorityName) {
+		// A namespace with the same name belongs to another resource, such as a team of an authority whose name shares the prefix
+		t.setFailure(teamCopy, fmt.Sprintf("Child namespace %s is already in use by another resource", teamChildNamespaceStr))
+		return nil
+	} else if err != nil && !errors.IsNotFound(err) {
+		// The namespace may exist, so the team waits for the next attempt rather than trying to create it
+		err = &NamespaceCreateError{Namespace: teamChildNamespaceStr, Err: err}
+		t.setFailure(teamCopy, err.Error())
+		return err
+	} else if err == nil && !teamCopy.Status.Enabled && !isEnabling(teamChildNamespace) {
+		// The team that has its namespace but is disabled has been disabled on purpose, so its users lose their access.
+		// The namespace that is still marked as enabling belongs to a new team whose status write has been lost, which
+		// gets reconciled as such.
+		t.revokeAccess(teamChildNamespaceStr)
+		t.setObserved(teamCopy)
+		return nil
+	} else if err != nil {
+		// When a team is deleted, the owner references feature allows the namespace to be automatically removed. Additionally,
+		// when all users who participate in the team are disabled, the team is automatically removed because of the owner references.
+		teamChildNamespace = newChildNamespace(teamCopy, authorityName)
+		namespace.PropagateMetadata(teamOwnerNamespace, teamChildNamespace)
+		teamChildNamespace, err = t.clientset.CoreV1().Namespaces().Create(teamChildNamespace)
+		if errors.IsAlreadyExists(err) {
+			// The namespace has been created since it was read, such as by an earlier attempt whose response was lost,
+			// which is fine as long as it belongs to the team
+			teamChildNamespace, err = t.clientset.CoreV1().Namespaces().Get(teamChildNamespaceStr, metav1.GetOptions{})
+			if err == nil && !isChildNamespaceOf(teamChildNamespace, teamCopy, authorityName) {
+				t.setFailure(teamCopy, fmt.Sprintf("Child namespace %s is already in use by another resource", teamChildNamespaceStr))
+				return nil
+			}
+		}
+		if err != nil {
+			err = &NamespaceCreateError{Namespace: teamChildNamespaceStr, Err: err}
+			if isTerminal(err) && !teamCopy.Status.Enabled {
+				// The team cannot have its namespace, so it gets removed after informing the users
+				t.runUserInteractions(teamCopy, teamChildNamespaceStr, authorityName, "team-crash")
+				t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Delete(teamCopy.GetName(), &metav1.DeleteOptions{})
+				return err
 			}
+			// The team stays as it is until the namespace gets created on a retry
+			t.setFailure(teamCopy, err.Error())
+			return err
 		}
-	} else if teamOwnerAuthority.Status.Enabled && !teamCopy.Status.Enabled {
-		t.edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).DeleteCollection(&metav1.DeleteOptions{}, metav1.ListOptions{})
-		t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).DeleteCollection(&metav1.DeleteOptions{}, metav1.ListOptions{})
-	} else if !teamOwnerAuthority.Status.Enabled {
-		t.edgenetClientset.AppsV1alpha().Teams(teamChildNamespaceStr).Delete(teamCopy.GetName(), &metav1.DeleteOptions{})
+	} else {
+		t.ensureChildNamespaceMetadata(teamCopy, teamOwnerNamespace, teamChildNamespace)
+	}
+	t.ensureResourceQuota(teamCopy, teamChildNamespaceStr)
+	if t.networkIsolation {
+		t.ensureNetworkPolicies(teamChildNamespace)
+	}
+	users, errs := t.ensureRoleBindings(teamCopy, teamChildNamespaceStr, authorityName)
+	// The slices that the disabling of the team suspended get their role bindings back
+	t.restoreSlices(teamChildNamespaceStr, authorityName)
+	// Enable the team, which clears the failure of the previous attempts unless the role bindings couldn't be created
+	status := apps_v1alpha.TeamStatus{Enabled: true, Users: users, ObservedGeneration: teamCopy.GetGeneration()}
+	for _, err := range errs {
+		log.Infof("Team %s in %s: %s", teamCopy.GetName(), teamCopy.GetNamespace(), err)
+		status.State = failure
+		status.Message = append(status.Message, err.Error())
+	}
+	// The users whose authority doesn't exist don't fail the team, yet they are told apart so that the references get fixed
+	unresolved := unresolvedUsers(users)
+	for _, userStatus := range unresolved {
+		status.Message = append(status.Message, fmt.Sprintf("User %s refers to authority %s, which doesn't exist", userStatus.Username, userStatus.Authority))
+	}
+	if t.unresolvedNotification {
+		t.notifyUnresolved(teamCopy, teamChildNamespaceStr, authorityName, unresolved)
+	}
+	// The status that couldn't be written is retried, and the namespace remains marked as enabling until it is written
+	if err := t.setStatus(teamCopy, status); err != nil {
+		return &StatusUpdateError{Team: teamKey(teamCopy), Err: err}
+	}
+	t.clearEnabling(teamChildNamespace)
+	return nil
+}
+
+// isEnabling tells whether the child namespace has been created for a team whose enabling hasn't been recorded yet
+func isEnabling(teamChildNamespace *corev1.Namespace) bool {
+	_, enabling := teamChildNamespace.GetAnnotations()[EnablingAnnotation]
+	return enabling
+}
+
+// clearEnabling removes the enabling mark of the child namespace once the status of the team tells that it is enabled
+func (t *Handler) clearEnabling(teamChildNamespace *corev1.Namespace) {
+	if !isEnabling(teamChildNamespace) {
+		return
+	}
+	// The namespace may have been updated since it was read, by the sync of its metadata
+	namespaceLatest, err := t.clientset.CoreV1().Namespaces().Get(teamChildNamespace.GetName(), metav1.GetOptions{})
+	if err != nil || !isEnabling(namespaceLatest) {
+		return
+	}
+	namespaceCopy := namespaceLatest.DeepCopy()
+	delete(namespaceCopy.Annotations, EnablingAnnotation)
+	if _, err := t.clientset.CoreV1().Namespaces().Update(namespaceCopy); err != nil {
+		log.Infof("Couldn't clear the enabling mark of child namespace %s: %s", teamChildNamespace.GetName(), err)
 	}
 }
 
@@ -170,62 +299,639 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 func (t *Handler) ObjectDeleted(obj, deleted interface{}) {
 	log.Info("TeamHandler.ObjectDeleted")
 	fieldDeleted := deleted.(fields)
+	if fieldDeleted.object.suspended {
+		log.Infof("Team %s in %s is suspended, skipping", fieldDeleted.object.name, fieldDeleted.object.ownerNamespace)
+		return
+	}
 	t.clientset.CoreV1().Namespaces().Delete(fieldDeleted.object.childNamespace, &metav1.DeleteOptions{})
 	// If there are users who participate in the team and team is enabled
 	if fieldDeleted.users.status && fieldDeleted.enabled {
-		teamOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(fieldDeleted.object.ownerNamespace, metav1.GetOptions{})
+		teamOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(fieldDeleted.object.ownerNamespace, metav1.GetOptions{})
+		if err != nil {
+			// The authority of the team is unknown without its namespace, so the users aren't informed
+			log.Infof("Couldn't inform the users of team %s in %s about its deletion: %s", fieldDeleted.object.name, fieldDeleted.object.ownerNamespace, err)
+			return
+		}
 		var deletedUserList []apps_v1alpha.SliceUsers
 		json.Unmarshal([]byte(fieldDeleted.users.deleted), &deletedUserList)
 		if len(deletedUserList) > 0 {
+			// The deletion is an occurrence of its own, apart from the generations of the team
+			deletion := fmt.Sprintf("%s/%s/%s/deletion", fieldDeleted.object.ownerNamespace, fieldDeleted.object.name, fieldDeleted.object.uid)
 			for _, deletedUser := range deletedUserList {
-				t.sendEmail(deletedUser.Username, deletedUser.Authority, teamOwnerNamespace.Labels["authority-name"], fieldDeleted.object.ownerNamespace, fieldDeleted.object.name, fieldDeleted.object.childNamespace, "team-deletion")
+				t.sendEmail(deletion, deletedUser.Username, deletedUser.Authority, teamOwnerNamespace.Labels["authority-name"], fieldDeleted.object.ownerNamespace, fieldDeleted.object.name, fieldDeleted.object.childNamespace, "team-deletion")
 			}
 		}
 	}
 }
 
-// runUserInteractions creates user role bindings according to the roles
-func (t *Handler) runUserInteractions(teamCopy *apps_v1alpha.Team, teamChildNamespaceStr, ownerAuthority, teamOwner, teamOwnerName, operation string, enabled bool) {
-	// This part creates the rolebindings for the users who participate in the team
+// teamKey returns the key of the team, as the controller knows it
+func teamKey(teamCopy *apps_v1alpha.Team) string {
+	return fmt.Sprintf("%s/%s", teamCopy.GetNamespace(), teamCopy.GetName())
+}
+
+// newChildNamespace returns the namespace to be created for the team
+func newChildNamespace(teamCopy *apps_v1alpha.Team, authorityName string) *corev1.Namespace {
+	// Each namespace created by teams have an indicator as "team" to provide singularity
+	teamChildNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace.ChildName(teamCopy.GetNamespace(), "team", teamCopy.GetName())}}
+	// Namespace labels indicate this namespace created by a team, not by a authority or slice
+	namespaceLabels := map[string]string{"owner": "team", "owner-name": teamCopy.GetName(), "authority-name": authorityName,
+		ParentNamespaceLabel: teamCopy.GetNamespace()}
+	teamChildNamespace.SetLabels(namespaceLabels)
+	teamChildNamespace.SetAnnotations(map[string]string{EnablingAnnotation: "true"})
+	registration.SetManagedLabels(teamChildNamespace, "team")
+	teamChildNamespace.SetOwnerReferences(namespaceOwnerReferences(teamCopy))
+	return teamChildNamespace
+}
+
+// isChildNamespaceOf checks whether the namespace was created for the team, as the labels tell the owner of the namespace
+func isChildNamespaceOf(childNamespace *corev1.Namespace, teamCopy *apps_v1alpha.Team, authorityName string) bool {
+	labels := childNamespace.GetLabels()
+	return labels["owner"] == "team" && labels["owner-name"] == teamCopy.GetName() && labels["authority-name"] == authorityName
+}
+
+// parentNamespaceOf returns the namespace of the team that the child namespace has been created for. The namespaces
+// created before the parent label existed belong to the top-level teams of the authority when their name tells so,
+// otherwise their parent is unknown.
+func parentNamespaceOf(childNamespace *corev1.Namespace) (string, bool) {
+	labels := childNamespace.GetLabels()
+	if parent, ok := labels[ParentNamespaceLabel]; ok {
+		return parent, parent != ""
+	}
+	authorityNamespaceStr := namespace.AuthorityName(labels["authority-name"])
+	if labels["authority-name"] != "" && childNamespace.GetName() == namespace.ChildName(authorityNamespaceStr, "team", labels["owner-name"]) {
+		return authorityNamespaceStr, true
+	}
+	return "", false
+}
+
+// deleteOrphanedNamespaces removes the team namespaces created from the namespace whose names don't match any of its teams,
+// such as the ones left behind by a team that has been recreated under another name. The child namespaces of the teams
+// nested in other namespaces are left to the resync of those teams.
+func (t *Handler) deleteOrphanedNamespaces(teamNamespaceStr, authorityName string) {
+	teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(teamNamespaceStr).List(metav1.ListOptions{})
+	if err != nil {
+		log.Infof("Couldn't list the teams in %s to find orphaned namespaces: %s", teamNamespaceStr, err)
+		return
+	}
+	childNamespaces := map[string]bool{}
+	for _, teamRow := range teamsRaw.Items {
+		childNamespaces[namespace.ChildName(teamRow.GetNamespace(), "team", teamRow.GetName())] = true
+	}
+	namespacesRaw, err := t.clientset.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: fmt.Sprintf("owner=team,authority-name=%s", authorityName)})
+	if err != nil {
+		log.Infof("Couldn't list the team namespaces of %s: %s", authorityName, err)
+		return
+	}
+	for _, namespaceRow := range namespacesRaw.Items {
+		if parent, ok := parentNamespaceOf(&namespaceRow); !ok || parent != teamNamespaceStr {
+			continue
+		}
+		if childNamespaces[namespaceRow.GetName()] || namespaceRow.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+		log.Infof("Child namespace %s doesn't match any team in %s, deleting", namespaceRow.GetName(), teamNamespaceStr)
+		if err := t.clientset.CoreV1().Namespaces().Delete(namespaceRow.GetName(), &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			log.Infof("Couldn't delete orphaned namespace %s: %s", namespaceRow.GetName(), err)
+		}
+	}
+}
+
+// sweepOrphanedNamespaces removes the child namespaces whose team doesn't exist, such as those of the teams deleted while
+// the controller wasn't running, whose deletion events are missed. Unlike deleteOrphanedNamespaces, it covers the
+// authorities that have no team left. The team is looked up in the namespace that the child namespace was created from,
+// which covers the nested teams, and the namespaces whose parent is unknown are kept. A non-empty namespace limits the
+// sweep to the child namespaces of the teams in that namespace, and a non-empty authority to those of the authority.
+func (t *Handler) sweepOrphanedNamespaces(watchNamespace, authorityName string) {
+	labelSelector := "owner=team"
+	if authorityName != "" {
+		labelSelector = fmt.Sprintf("%s,authority-name=%s", labelSelector, authorityName)
+	}
+	namespacesRaw, err := t.clientset.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		log.Infof("Couldn't list the team namespaces to find orphaned ones: %s", err)
+		return
+	}
+	for _, namespaceRow := range namespacesRaw.Items {
+		teamNamespaceStr, ok := parentNamespaceOf(&namespaceRow)
+		if !ok || (watchNamespace != "" && teamNamespaceStr != watchNamespace) || namespaceRow.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+		// Only the team that cannot be found leaves its namespace behind, any other error keeps the namespace
+		_, err := t.edgenetClientset.AppsV1alpha().Teams(teamNamespaceStr).Get(namespaceRow.Labels["owner-name"], metav1.GetOptions{})
+		if !errors.IsNotFound(err) {
+			continue
+		}
+		log.Infof("Team %s/%s of child namespace %s not found, deleting", teamNamespaceStr, namespaceRow.Labels["owner-name"], namespaceRow.GetName())
+		if err := t.clientset.CoreV1().Namespaces().Delete(namespaceRow.GetName(), &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			log.Infof("Couldn't delete orphaned namespace %s: %s", namespaceRow.GetName(), err)
+		}
+	}
+}
+
+// ensureChildNamespaceMetadata keeps the labels and annotations that the child namespace inherits from the authority namespace,
+// and the team as its owner, in sync
+func (t *Handler) ensureChildNamespaceMetadata(teamCopy *apps_v1alpha.Team, teamOwnerNamespace, teamChildNamespace *corev1.Namespace) {
+	changed := namespace.PropagateMetadata(teamOwnerNamespace, teamChildNamespace)
+	// The namespaces created by the earlier versions of the handler lack the management labels
+	if registration.SetManagedLabels(teamChildNamespace, "team") {
+		changed = true
+	}
+	if teamChildNamespace.Labels[ParentNamespaceLabel] != teamCopy.GetNamespace() {
+		if teamChildNamespace.Labels == nil {
+			teamChildNamespace.Labels = map[string]string{}
+		}
+		teamChildNamespace.Labels[ParentNamespaceLabel] = teamCopy.GetNamespace()
+		changed = true
+	}
+	if ownerReferences := namespaceOwnerReferences(teamCopy); !reflect.DeepEqual(teamChildNamespace.GetOwnerReferences(), ownerReferences) {
+		teamChildNamespace.SetOwnerReferences(ownerReferences)
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if _, err := t.clientset.CoreV1().Namespaces().Update(teamChildNamespace); err != nil {
+		log.Infof("Couldn't sync the metadata of child namespace %s: %s", teamChildNamespace.GetName(), err)
+	}
+}
+
+// ensureResourceQuota applies the quota of the team, which the admission webhook defaults from the authority policy, to its child namespace.
+// The quota is named after the team and labeled as its own, so that the handler leaves the quotas of others alone
+func (t *Handler) ensureResourceQuota(teamCopy *apps_v1alpha.Team, teamChildNamespaceStr string) {
+	if teamCopy.Spec.ResourceQuota == nil {
+		return
+	}
+	quotaName := resourceQuotaName(teamCopy)
+	resourceQuota, err := t.clientset.CoreV1().ResourceQuotas(teamChildNamespaceStr).Get(quotaName, metav1.GetOptions{})
+	if err == nil {
+		if !isResourceQuotaOf(resourceQuota, teamCopy) {
+			log.Infof("Resource quota %s in %s doesn't belong to team %s, leaving it", quotaName, teamChildNamespaceStr, teamCopy.GetName())
+			return
+		}
+		if apiequality.Semantic.DeepEqual(resourceQuota.Spec.Hard, teamCopy.Spec.ResourceQuota.Hard) &&
+			apiequality.Semantic.DeepEqual(resourceQuota.Spec.Scopes, teamCopy.Spec.ResourceQuota.Scopes) {
+			t.deleteLegacyResourceQuota(teamCopy, teamChildNamespaceStr)
+			return
+		}
+		resourceQuota.Spec = *teamCopy.Spec.ResourceQuota.DeepCopy()
+		_, err = t.clientset.CoreV1().ResourceQuotas(teamChildNamespaceStr).Update(resourceQuota)
+	} else if errors.IsNotFound(err) {
+		resourceQuota = &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: quotaName,
+			Labels: map[string]string{"owner": "team", "owner-name": teamCopy.GetName()}}, Spec: *teamCopy.Spec.ResourceQuota.DeepCopy()}
+		registration.SetManagedLabels(resourceQuota, "team")
+		_, err = t.clientset.CoreV1().ResourceQuotas(teamChildNamespaceStr).Create(resourceQuota)
+	}
+	if err != nil {
+		log.Infof("Couldn't apply the resource quota of team %s: %s", teamCopy.GetName(), err)
+		return
+	}
+	t.deleteLegacyResourceQuota(teamCopy, teamChildNamespaceStr)
+}
+
+// legacyResourceQuotaHard is the default quota that the earlier versions of the handler applied under a fixed name
+var legacyResourceQuotaHard = corev1.ResourceList{
+	"cpu":                           resource.MustParse("5m"),
+	"memory":                        resource.MustParse("1Mi"),
+	"requests.storage":              resource.MustParse("1Mi"),
+	"pods":                          resource.MustParse("0"),
+	"count/persistentvolumeclaims":  resource.MustParse("0"),
+	"count/services":                resource.MustParse("0"),
+	"count/configmaps":              resource.MustParse("0"),
+	"count/replicationcontrollers":  resource.MustParse("0"),
+	"count/deployments.apps":        resource.MustParse("0"),
+	"count/deployments.extensions":  resource.MustParse("0"),
+	"count/replicasets.apps":        resource.MustParse("0"),
+	"count/replicasets.extensions":  resource.MustParse("0"),
+	"count/statefulsets.apps":       resource.MustParse("0"),
+	"count/statefulsets.extensions": resource.MustParse("0"),
+	"count/jobs.batch":              resource.MustParse("0"),
+	"count/cronjobs.batch":          resource.MustParse("0"),
+}
+
+// deleteLegacyResourceQuota removes the quota that the earlier versions of the handler created under a fixed name,
+// which would otherwise keep restricting the namespace along with the quota of the team. The quota of that name is
+// taken as legacy only if it is unlabeled and holds either the old default or the quota of the team, which the
+// earlier versions applied, so that a quota of the same name created by an operator is left alone
+func (t *Handler) deleteLegacyResourceQuota(teamCopy *apps_v1alpha.Team, teamChildNamespaceStr string) {
+	resourceQuota, err := t.clientset.CoreV1().ResourceQuotas(teamChildNamespaceStr).Get("team-quota", metav1.GetOptions{})
+	if err != nil || len(resourceQuota.GetLabels()) > 0 || len(resourceQuota.Spec.Scopes) > 0 || resourceQuota.Spec.ScopeSelector != nil {
+		return
+	}
+	oldDefault := apiequality.Semantic.DeepEqual(resourceQuota.Spec.Hard, legacyResourceQuotaHard)
+	teamQuota := teamCopy.Spec.ResourceQuota != nil && apiequality.Semantic.DeepEqual(resourceQuota.Spec.Hard, teamCopy.Spec.ResourceQuota.Hard)
+	if !oldDefault && !teamQuota {
+		log.Infof("Resource quota team-quota in %s isn't that of the earlier versions, leaving it", teamChildNamespaceStr)
+		return
+	}
+	if err := t.clientset.CoreV1().ResourceQuotas(teamChildNamespaceStr).Delete("team-quota", &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		log.Infof("Couldn't delete the legacy resource quota in %s: %s", teamChildNamespaceStr, err)
+	}
+}
+
+// resourceQuotaName returns the name of the quota that the team applies to its child namespace
+func resourceQuotaName(teamCopy *apps_v1alpha.Team) string {
+	return fmt.Sprintf("team-quota-%s", teamCopy.GetName())
+}
+
+// isResourceQuotaOf checks whether the quota was created for the team, as the labels tell its owner
+func isResourceQuotaOf(resourceQuota *corev1.ResourceQuota, teamCopy *apps_v1alpha.Team) bool {
+	labels := resourceQuota.GetLabels()
+	return labels["owner"] == "team" && labels["owner-name"] == teamCopy.GetName()
+}
+
+// ensureNetworkPolicies isolates the child namespace by denying all ingress traffic but the one from the same namespace,
+// the policies belong to the namespace to be removed along with it
+func (t *Handler) ensureNetworkPolicies(teamChildNamespace *corev1.Namespace) {
+	ownerReferences := []metav1.OwnerReference{*metav1.NewControllerRef(teamChildNamespace, corev1.SchemeGroupVersion.WithKind("Namespace"))}
+	policies := []*networkingv1.NetworkPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-deny", OwnerReferences: ownerReferences},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "allow-same-namespace", OwnerReferences: ownerReferences},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{},
+				Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		},
+	}
+	for _, policy := range policies {
+		if _, err := t.clientset.NetworkingV1().NetworkPolicies(teamChildNamespace.GetName()).Get(policy.GetName(), metav1.GetOptions{}); err == nil {
+			continue
+		}
+		registration.SetManagedLabels(policy, "team")
+		if _, err := t.clientset.NetworkingV1().NetworkPolicies(teamChildNamespace.GetName()).Create(policy); err != nil && !errors.IsAlreadyExists(err) {
+			log.Infof("Couldn't create network policy %s in %s: %s", policy.GetName(), teamChildNamespace.GetName(), err)
+		}
+	}
+}
+
+// ensureRoleBindings makes the role bindings in the child namespace match the roles of the users who participate in the team,
+// and of the authority-admin and managers of the authority. It returns the access that each user of the team has got,
+// along with the failures as RoleBindingError
+func (t *Handler) ensureRoleBindings(teamCopy *apps_v1alpha.Team, teamChildNamespaceStr, ownerAuthority string) ([]apps_v1alpha.TeamUserStatus, []error) {
+	desired := map[string]*rbacv1.RoleBinding{}
+	owners := map[string]*apps_v1alpha.User{}
+	addUser := func(userCopy *apps_v1alpha.User) {
+		for _, roleBind := range registration.RoleBindingsByRoles(userCopy, teamChildNamespaceStr, "Team") {
+			desired[roleBind.GetName()] = roleBind
+			owners[roleBind.GetName()] = userCopy
+		}
+	}
+	// This part covers the users who participate in the team, the reason why a user doesn't get access is kept for the status
+	var users []apps_v1alpha.TeamUserStatus
+	authorityExists := map[string]bool{}
 	for _, teamUser := range teamCopy.Spec.Users {
-		user, err := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", teamUser.Authority)).Get(teamUser.Username, metav1.GetOptions{})
-		if err == nil && user.Status.Active && user.Status.AUP {
-			if operation == "team-creation" {
-				registration.CreateRoleBindingsByRoles(user.DeepCopy(), teamChildNamespaceStr, "Team")
+		teamUser = NormalizeUser(teamUser)
+		userStatus := apps_v1alpha.TeamUserStatus{Authority: teamUser.Authority, Username: teamUser.Username}
+		user, err := t.edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(teamUser.Authority)).Get(teamUser.Username, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			// A user that cannot be found may refer to an authority that was renamed or removed, which the owners need to know
+			exists, checked := authorityExists[teamUser.Authority]
+			if !checked {
+				_, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(teamUser.Authority, metav1.GetOptions{})
+				exists = !errors.IsNotFound(err)
+				authorityExists[teamUser.Authority] = exists
 			}
-
-			if !(operation == "team-creation" && !enabled) {
-				t.sendEmail(teamUser.Username, teamUser.Authority, ownerAuthority, teamCopy.GetNamespace(), teamCopy.GetName(), teamChildNamespaceStr, operation)
+			userStatus.Access = accessNotFound
+			if !exists {
+				userStatus.Access = accessAuthorityNotFound
 			}
+		} else if err != nil {
+			userStatus.Access = accessFailed
+		} else if !user.Status.Active {
+			userStatus.Access = accessInactive
+		} else if !user.Status.AUP {
+			userStatus.Access = accessNoAUP
+		} else {
+			userStatus.Access = accessBound
+			addUser(user.DeepCopy())
 		}
+		users = append(users, userStatus)
 	}
-	// To create the rolebindings for the users who are authority-admin and managers of the authority
-	userRaw, err := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", ownerAuthority)).List(metav1.ListOptions{})
+	// The members of the groups are those at the time, so that the team follows the changes of their roles
+	for _, group := range teamCopy.Spec.Groups {
+		groupAuthority := groupAuthority(group, ownerAuthority)
+		err := forEachUser(t.edgenetClientset, namespace.AuthorityName(groupAuthority), func(userRow *apps_v1alpha.User) {
+			if userRow.Status.Active && userRow.Status.AUP && inGroup(group, userRow) {
+				addUser(userRow.DeepCopy())
+			}
+		})
+		if err != nil {
+			return users, []error{&GroupReadError{Authority: groupAuthority, Err: err}}
+		}
+	}
+	// To cover the users who are authority-admin and managers of the authority
+	forEachUser(t.edgenetClientset, namespace.AuthorityName(ownerAuthority), func(userRow *apps_v1alpha.User) {
+		if userRow.Status.Active && userRow.Status.AUP && (containsRole(userRow.Spec.Roles, "admin") || containsRole(userRow.Spec.Roles, "manager")) {
+			addUser(userRow.DeepCopy())
+		}
+	})
+
+	// Only the role bindings that the controller manages are compared with the desired ones
+	existing := map[string]bool{}
+	roleBindingsRaw, err := t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).List(metav1.ListOptions{LabelSelector: registration.ManagedSelector("team")})
 	if err == nil {
-		for _, userRow := range userRaw.Items {
-			if userRow.Status.Active && userRow.Status.AUP && (containsRole(userRow.Spec.Roles, "admin") || containsRole(userRow.Spec.Roles, "manager")) {
-				registration.CreateRoleBindingsByRoles(userRow.DeepCopy(), teamChildNamespaceStr, "Team")
+		for _, roleBindingRow := range roleBindingsRaw.Items {
+			roleBind, ok := desired[roleBindingRow.GetName()]
+			if ok && reflect.DeepEqual(roleBind.RoleRef, roleBindingRow.RoleRef) && reflect.DeepEqual(roleBind.Subjects, roleBindingRow.Subjects) {
+				existing[roleBindingRow.GetName()] = true
+				continue
+			}
+			// The role reference cannot change, so the role binding that differs is recreated
+			t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).Delete(roleBindingRow.GetName(), &metav1.DeleteOptions{})
+		}
+	}
+	var errs []error
+	failed := map[string]bool{}
+	for name, roleBind := range desired {
+		owner := fmt.Sprintf("%s/%s", owners[name].GetNamespace(), owners[name].GetName())
+		if existing[name] || failed[owner] {
+			continue
+		}
+		_, err := t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).Create(roleBind)
+		if errors.IsAlreadyExists(err) {
+			// The role binding was created before the controller labeled the role bindings it manages
+			t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).Delete(roleBind.GetName(), &metav1.DeleteOptions{})
+			_, err = t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).Create(roleBind)
+		}
+		if err != nil && !errors.IsAlreadyExists(err) {
+			failed[owner] = true
+			errs = append(errs, &RoleBindingError{Namespace: teamChildNamespaceStr, Username: owners[name].GetName(), Err: err})
+		}
+	}
+	for i, userStatus := range users {
+		if userStatus.Access == accessBound && failed[fmt.Sprintf("%s/%s", namespace.AuthorityName(userStatus.Authority), userStatus.Username)] {
+			users[i].Access = accessFailed
+		}
+	}
+	return users, errs
+}
+
+// unresolvedUsers returns the users whose authority doesn't exist
+func unresolvedUsers(users []apps_v1alpha.TeamUserStatus) []apps_v1alpha.TeamUserStatus {
+	unresolved := []apps_v1alpha.TeamUserStatus{}
+	for _, userStatus := range users {
+		if userStatus.Access == accessAuthorityNotFound {
+			unresolved = append(unresolved, userStatus)
+		}
+	}
+	return unresolved
+}
+
+// notifyUnresolved emails the authority-admin and managers of the team authority about the users whose authority doesn't
+// exist. Only the users that the status doesn't already tell as such are reported, so that the owners are emailed once.
+func (t *Handler) notifyUnresolved(teamCopy *apps_v1alpha.Team, teamChildNamespaceStr, ownerAuthority string, unresolved []apps_v1alpha.TeamUserStatus) {
+	reported := map[string]bool{}
+	for _, userStatus := range unresolvedUsers(teamCopy.Status.Users) {
+		reported[fmt.Sprintf("%s/%s", userStatus.Authority, userStatus.Username)] = true
+	}
+	newlyUnresolved := []string{}
+	for _, userStatus := range unresolved {
+		if reference := fmt.Sprintf("%s/%s", userStatus.Authority, userStatus.Username); !reported[reference] {
+			newlyUnresolved = append(newlyUnresolved, reference)
+		}
+	}
+	if len(newlyUnresolved) == 0 {
+		return
+	}
+	err := forEachUser(t.edgenetClientset, namespace.AuthorityName(ownerAuthority), func(userRow *apps_v1alpha.User) {
+		if !userRow.Status.Active || !userRow.Status.AUP || !(containsRole(userRow.Spec.Roles, "admin") || containsRole(userRow.Spec.Roles, "manager")) {
+			return
+		}
+		recipients, _ := mailer.ValidEmails(append([]string{userRow.Spec.Email}, userRow.Spec.AdditionalEmails...))
+		if len(recipients) == 0 {
+			return
+		}
+		contentData := mailer.ResourceAllocationData{}
+		contentData.CommonData.Authority = ownerAuthority
+		contentData.CommonData.Username = userRow.GetName()
+		contentData.CommonData.Name = fmt.Sprintf("%s %s", userRow.Spec.FirstName, userRow.Spec.LastName)
+		contentData.CommonData.Email = recipients
+		contentData.Authority = ownerAuthority
+		contentData.Name = teamCopy.GetName()
+		contentData.OwnerNamespace = teamCopy.GetNamespace()
+		contentData.ChildNamespace = teamChildNamespaceStr
+		contentData.Users = newlyUnresolved
+		key := fmt.Sprintf("%s/%s/%s", occurrence(teamCopy), userRow.GetName(), strings.Join(newlyUnresolved, ","))
+		if err := mailer.Enqueue(key, "team-authority-unresolved", contentData); err != nil {
+			log.Infof("Team %s in %s: %s", teamCopy.GetName(), teamCopy.GetNamespace(), &MailError{Subject: "team-authority-unresolved", Username: userRow.GetName(), Err: err})
+		}
+	})
+	if err != nil {
+		log.Infof("Couldn't inform the owners of team %s in %s about the unresolved users: %s", teamCopy.GetName(), teamCopy.GetNamespace(), err)
+	}
+}
+
+// revokeAccess suspends the slices of a disabled team and removes the role bindings from its child namespace, the slices
+// are deleted along with the namespace only when the team is deleted
+func (t *Handler) revokeAccess(teamChildNamespaceStr string) {
+	t.suspendSlices(teamChildNamespaceStr)
+	t.deleteManagedRoleBindings(teamChildNamespaceStr)
+}
+
+// deleteManagedRoleBindings removes the role bindings that the team controller manages in the child namespace, the other
+// role bindings, such as those of the slices or those an admin creates, are left as they are
+func (t *Handler) deleteManagedRoleBindings(teamChildNamespaceStr string) {
+	roleBindingsRaw, err := t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).List(metav1.ListOptions{LabelSelector: registration.ManagedSelector("team")})
+	if err != nil {
+		return
+	}
+	for _, roleBindingRow := range roleBindingsRaw.Items {
+		t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).Delete(roleBindingRow.GetName(), &metav1.DeleteOptions{})
+	}
+}
+
+// setFailure marks the team as failed with the message given
+func (t *Handler) setFailure(teamCopy *apps_v1alpha.Team, message string) {
+	log.Infof("Team %s in %s failed: %s", teamCopy.GetName(), teamCopy.GetNamespace(), message)
+	t.setStatus(teamCopy, apps_v1alpha.TeamStatus{Enabled: teamCopy.Status.Enabled, State: failure, Message: []string{message}, Users: teamCopy.Status.Users,
+		ObservedGeneration: teamCopy.Status.ObservedGeneration})
+}
+
+// setObserved records the generation of the team as reconciled, the rest of the status is kept as it is
+func (t *Handler) setObserved(teamCopy *apps_v1alpha.Team) {
+	status := teamCopy.Status.DeepCopy()
+	status.ObservedGeneration = teamCopy.GetGeneration()
+	t.setStatus(teamCopy, *status)
+}
+
+// setStatus writes the status given unless the team already has it, the pending invitations are kept. The time of the
+// reconciliation is left out of the comparison, as writing it each time would trigger another reconciliation endlessly.
+func (t *Handler) setStatus(teamCopy *apps_v1alpha.Team, status apps_v1alpha.TeamStatus) error {
+	status.PendingInvitations = teamCopy.Status.PendingInvitations
+	if teamCopy.Status.Enabled == status.Enabled && teamCopy.Status.State == status.State &&
+		strings.Join(teamCopy.Status.Message, "\n") == strings.Join(status.Message, "\n") && reflect.DeepEqual(teamCopy.Status.Users, status.Users) &&
+		teamCopy.Status.ObservedGeneration == status.ObservedGeneration {
+		return nil
+	}
+	reconcileTime := metav1.Now()
+	status.LastReconcileTime = &reconcileTime
+	teamCopy.Status = status
+	return t.updateStatus(teamCopy)
+}
+
+// updateStatus writes the status of the team, which is re-applied to the latest version of the team
+// if the object has been modified concurrently
+func (t *Handler) updateStatus(teamCopy *apps_v1alpha.Team) error {
+	status := teamCopy.Status.DeepCopy()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		_, err := t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).UpdateStatus(teamCopy)
+		if errors.IsConflict(err) {
+			if teamLatest, getErr := t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Get(teamCopy.GetName(), metav1.GetOptions{}); getErr == nil {
+				teamCopy = teamLatest.DeepCopy()
+				teamCopy.Status = *status.DeepCopy()
 			}
 		}
+		return err
+	})
+	if err != nil {
+		log.Infof("Couldn't update the status of team %s in %s: %s", teamCopy.GetName(), teamCopy.GetNamespace(), err)
+	}
+	return err
+}
+
+// runUserInteractions sends the email of the operation to the users who participate in the team, and returns the failures as MailError
+func (t *Handler) runUserInteractions(teamCopy *apps_v1alpha.Team, teamChildNamespaceStr, ownerAuthority, operation string) []error {
+	var errs []error
+	for _, teamUser := range teamCopy.Spec.Users {
+		if err := t.sendEmail(occurrence(teamCopy), teamUser.Username, teamUser.Authority, ownerAuthority, teamCopy.GetNamespace(), teamCopy.GetName(), teamChildNamespaceStr, operation); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// invite sends the invitation email to the users, those whom it couldn't be sent to become pending invitations
+// in the team status, and those who got it are no longer pending. It returns the failures as MailError
+func (t *Handler) invite(teamCopy *apps_v1alpha.Team, users []apps_v1alpha.TeamUsers, ownerAuthority string) []error {
+	teamChildNamespaceStr := namespace.ChildName(teamCopy.GetNamespace(), "team", teamCopy.GetName())
+	pending := map[apps_v1alpha.TeamUsers]bool{}
+	for _, pendingUser := range teamCopy.Status.PendingInvitations {
+		pending[pendingUser] = true
+	}
+	var errs []error
+	changed := false
+	for _, user := range users {
+		err := t.sendEmail(occurrence(teamCopy), user.Username, user.Authority, ownerAuthority, teamCopy.GetNamespace(), teamCopy.GetName(), teamChildNamespaceStr, "team-creation")
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if failed := err != nil; pending[user] != failed {
+			pending[user] = failed
+			changed = true
+		}
+	}
+	if changed {
+		teamCopy.Status.PendingInvitations = pendingInvitations(teamCopy, pending)
+		t.updateStatus(teamCopy)
+	}
+	return errs
+}
+
+// resendInvitations sends the pending invitations of the team again, the users who have left the team are dropped
+func (t *Handler) resendInvitations(teamCopy *apps_v1alpha.Team, ownerAuthority string) []error {
+	if len(teamCopy.Status.PendingInvitations) == 0 {
+		return nil
+	}
+	invited := []apps_v1alpha.TeamUsers{}
+	for _, pendingUser := range teamCopy.Status.PendingInvitations {
+		if containsUser(teamCopy.Spec.Users, pendingUser) {
+			invited = append(invited, pendingUser)
+		}
+	}
+	if len(invited) != len(teamCopy.Status.PendingInvitations) {
+		teamCopy.Status.PendingInvitations = invited
+		t.updateStatus(teamCopy)
+	}
+	return t.invite(teamCopy, invited, ownerAuthority)
+}
+
+// pendingInvitations returns the users of the team that are pending, in the order of the team
+func pendingInvitations(teamCopy *apps_v1alpha.Team, pending map[apps_v1alpha.TeamUsers]bool) []apps_v1alpha.TeamUsers {
+	pendingUsers := []apps_v1alpha.TeamUsers{}
+	for _, teamUser := range teamCopy.Spec.Users {
+		if pending[teamUser] {
+			pendingUsers = append(pendingUsers, teamUser)
+		}
+	}
+	return pendingUsers
+}
+
+// ResendInvitations sends the pending invitations of the team again, which lets an admin retry them rather than
+// waiting for the next resync. It returns the first failure, the invitations that fail remain pending
+func ResendInvitations(clientset kubernetes.Interface, edgenetClientset versioned.Interface, teamNamespace, teamName string) error {
+	teamRaw, err := edgenetClientset.AppsV1alpha().Teams(teamNamespace).Get(teamName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	teamOwnerNamespace, err := clientset.CoreV1().Namespaces().Get(teamNamespace, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	t := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+	if errs := t.resendInvitations(teamRaw.DeepCopy(), teamOwnerNamespace.Labels["authority-name"]); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Reconcile converges the team at once rather than waiting for its next event, such as to restore the access
+// to the teams of an authority that is enabled again
+func Reconcile(clientset kubernetes.Interface, edgenetClientset versioned.Interface, teamNamespace, teamName string) error {
+	teamRaw, err := edgenetClientset.AppsV1alpha().Teams(teamNamespace).Get(teamName, metav1.GetOptions{})
+	if err != nil {
+		return err
 	}
+	t := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+	return t.reconcile(teamRaw.DeepCopy())
+}
+
+// occurrence returns the key of the emails about the current generation of the team, so that a reconcile that is
+// retried doesn't send them again while a later change of the team does
+func occurrence(teamCopy *apps_v1alpha.Team) string {
+	return fmt.Sprintf("%s/%s/%s/%d", teamCopy.GetNamespace(), teamCopy.GetName(), teamCopy.GetUID(), teamCopy.GetGeneration())
 }
 
-// sendEmail to send notification to participants
-func (t *Handler) sendEmail(teamUsername, teamUserAuthority, teamAuthority, teamOwnerNamespace, teamName, teamChildNamespace, subject string) {
-	user, err := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", teamUserAuthority)).Get(teamUsername, metav1.GetOptions{})
+// sendEmail to send notification to participants about the occurrence, the error is a MailError
+func (t *Handler) sendEmail(occurrence, teamUsername, teamUserAuthority, teamAuthority, teamOwnerNamespace, teamName, teamChildNamespace, subject string) error {
+	teamUser := NormalizeUser(apps_v1alpha.TeamUsers{Authority: teamUserAuthority, Username: teamUsername})
+	teamUserAuthority, teamUsername = teamUser.Authority, teamUser.Username
+	user, err := t.edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(teamUserAuthority)).Get(teamUsername, metav1.GetOptions{})
 	if err == nil && user.Status.Active && user.Status.AUP {
+		// A malformed address would fail at the SMTP level, so it is skipped, as is the user without any valid address
+		recipients, invalid := mailer.ValidEmails(append([]string{user.Spec.Email}, user.Spec.AdditionalEmails...))
+		for _, err := range invalid {
+			log.Infof("Couldn't send %s email to %s: %s", subject, teamUsername, err)
+		}
+		if len(recipients) == 0 {
+			return nil
+		}
 		// Set the HTML template variables
 		contentData := mailer.ResourceAllocationData{}
 		contentData.CommonData.Authority = teamUserAuthority
 		contentData.CommonData.Username = teamUsername
 		contentData.CommonData.Name = fmt.Sprintf("%s %s", user.Spec.FirstName, user.Spec.LastName)
-		contentData.CommonData.Email = []string{user.Spec.Email}
+		contentData.CommonData.Email = recipients
 		contentData.Authority = teamAuthority
 		contentData.Name = teamName
 		contentData.OwnerNamespace = teamOwnerNamespace
 		contentData.ChildNamespace = teamChildNamespace
-		mailer.Send(subject, contentData)
+		// The authority of the team selects the sinks, with an outbox configured the email is persisted here and
+		// sent in the background
+		authority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(teamAuthority, metav1.GetOptions{})
+		key := fmt.Sprintf("%s/%s/%s", occurrence, teamUserAuthority, teamUsername)
+		err := notifier.ForAuthority(authority).Notify(key, subject, contentData)
+		if err != nil {
+			return &MailError{Subject: subject, Username: teamUsername, Err: err}
+		}
 	}
+	return nil
 }
 
 // setOwnerReferences returns the users and the team as owners
@@ -233,7 +939,8 @@ func (t *Handler) setOwnerReferences(teamCopy *apps_v1alpha.Team) ([]metav1.Owne
 	// The following section makes users who participate in that team become the team owners
 	ownerReferences := []metav1.OwnerReference{}
 	for _, teamUser := range teamCopy.Spec.Users {
-		user, err := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", teamUser.Authority)).Get(teamUser.Username, metav1.GetOptions{})
+		teamUser = NormalizeUser(teamUser)
+		user, err := t.edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(teamUser.Authority)).Get(teamUser.Username, metav1.GetOptions{})
 		if err == nil && user.Status.Active && user.Status.AUP {
 			newTeamRef := *metav1.NewControllerRef(user.DeepCopy(), apps_v1alpha.SchemeGroupVersion.WithKind("User"))
 			takeControl := false
@@ -241,12 +948,52 @@ func (t *Handler) setOwnerReferences(teamCopy *apps_v1alpha.Team) ([]metav1.Owne
 			ownerReferences = append(ownerReferences, newTeamRef)
 		}
 	}
+	return ownerReferences, namespaceOwnerReferences(teamCopy)
+}
+
+// namespaceOwnerReferences returns the team as the controlling owner of its child namespace. The users are
+// owners of the team, so the team is the only owner in charge of the child namespace among the references
+func namespaceOwnerReferences(teamCopy *apps_v1alpha.Team) []metav1.OwnerReference {
 	// The section below makes team who created the child namespace become the namespace owner
 	newNamespaceRef := *metav1.NewControllerRef(teamCopy, apps_v1alpha.SchemeGroupVersion.WithKind("Team"))
-	takeControl := false
-	newNamespaceRef.Controller = &takeControl
-	namespaceOwnerReferences := []metav1.OwnerReference{newNamespaceRef}
-	return ownerReferences, namespaceOwnerReferences
+	return []metav1.OwnerReference{newNamespaceRef}
+}
+
+// NormalizeUser returns the reference to the user as the names of the objects it refers to are, trimmed and lowercase,
+// so that a stray capital letter or space in the team spec doesn't leave the user out
+func NormalizeUser(user apps_v1alpha.TeamUsers) apps_v1alpha.TeamUsers {
+	return apps_v1alpha.TeamUsers{Authority: strings.ToLower(strings.TrimSpace(user.Authority)), Username: strings.ToLower(strings.TrimSpace(user.Username))}
+}
+
+// groupAuthority returns the authority of the users in the group, which is the authority of the team unless the group tells
+func groupAuthority(group apps_v1alpha.TeamGroup, ownerAuthority string) string {
+	if authority := strings.ToLower(strings.TrimSpace(group.Authority)); authority != "" {
+		return authority
+	}
+	return ownerAuthority
+}
+
+// inGroup checks whether the user holds any of the roles of the group, the group without roles takes all users in
+func inGroup(group apps_v1alpha.TeamGroup, userCopy *apps_v1alpha.User) bool {
+	if len(group.Roles) == 0 {
+		return true
+	}
+	for _, role := range group.Roles {
+		if containsRole(userCopy.Spec.Roles, strings.TrimSpace(role)) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsUser checks whether the user participates in the team
+func containsUser(users []apps_v1alpha.TeamUsers, value apps_v1alpha.TeamUsers) bool {
+	for _, user := range users {
+		if NormalizeUser(user) == NormalizeUser(value) {
+			return true
+		}
+	}
+	return false
 }
 
 // To check whether user is holder of a role
@@ -0,0 +1,1237 @@
+package team
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	"edgenet/pkg/mailer"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/suspension"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestObjectCreated(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{ResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("5m")}}}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team),
+	}
+	// Init keeps the clientsets injected
+	handler.Init()
+
+	handler.ObjectCreated(team)
+	childNamespace, err := handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("child namespace not created: %s", err)
+	}
+	if childNamespace.Labels["owner"] != "team" || childNamespace.Labels["owner-name"] != "demo" {
+		t.Errorf("unexpected child namespace labels: %v", childNamespace.Labels)
+	}
+	resourceQuota, err := handler.clientset.CoreV1().ResourceQuotas("authority-edgenet-team-demo").Get("team-quota-demo", metav1.GetOptions{})
+	if err != nil {
+		t.Errorf("resource quota of the team not created: %s", err)
+	} else if cpu := resourceQuota.Spec.Hard["cpu"]; cpu.String() != "5m" {
+		t.Errorf("unexpected resource quota: %v", resourceQuota.Spec.Hard)
+	}
+	teamUpdated, _ := handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if !teamUpdated.Status.Enabled {
+		t.Errorf("team not enabled: %+v", teamUpdated.Status)
+	}
+}
+
+func TestObjectCreatedCustomNameFormats(t *testing.T) {
+	defer namespace.SetNameFormats("authority-%s", "%s-%s-%s")
+	if err := namespace.SetNameFormats("east-authority-%s", "east-%s-%s-%s"); err != nil {
+		t.Fatal(err)
+	}
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "east-authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "east-authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Email: "john.doe@edge-net.org", Roles: []string{"Manager"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "east-authority-edgenet"}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, user, team),
+	}
+	handler.Init()
+	mailer.SetEnabled(false)
+	defer mailer.SetEnabled(true)
+
+	handler.ObjectCreated(team)
+	if _, err := handler.clientset.CoreV1().Namespaces().Get("east-east-authority-edgenet-team-demo", metav1.GetOptions{}); err != nil {
+		t.Fatalf("child namespace not created by the format: %s", err)
+	}
+	// The managers of the authority are found in the authority namespace that the format makes
+	roleBindings, _ := handler.clientset.RbacV1().RoleBindings("east-east-authority-edgenet-team-demo").List(metav1.ListOptions{})
+	if len(roleBindings.Items) == 0 {
+		t.Error("role bindings of the authority managers not created")
+	}
+}
+
+func TestUpdateRecreatesChildNamespace(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team),
+	}
+
+	// The child namespace, which is missing, gets recreated on any update
+	handler.ObjectUpdated(team, fields{})
+	childNamespace, err := handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("child namespace not recreated on update: %s", err)
+	}
+	if childNamespace.Labels["owner"] != "team" || childNamespace.Labels["owner-name"] != "demo" || childNamespace.Labels["authority-name"] != "edgenet" {
+		t.Errorf("unexpected child namespace labels: %v", childNamespace.Labels)
+	}
+}
+
+func TestObjectCreatedLongNames(t *testing.T) {
+	authorityName := strings.Repeat("a", 45)
+	authorityNamespaceStr := fmt.Sprintf("authority-%s", authorityName)
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: authorityName},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: authorityNamespaceStr,
+		Labels: map[string]string{"owner": "authority", "owner-name": authorityName, "authority-name": authorityName}}}
+	teams := []*apps_v1alpha.Team{
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("b", 40), Namespace: authorityNamespaceStr}},
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("b", 41), Namespace: authorityNamespaceStr}},
+	}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, teams[0], teams[1]),
+	}
+
+	childNamespaces := map[string]bool{}
+	for _, team := range teams {
+		handler.ObjectCreated(team)
+		teamChildNamespaceStr := namespace.ChildName(team.GetNamespace(), "team", team.GetName())
+		if len(teamChildNamespaceStr) > 63 {
+			t.Fatalf("child namespace name %s exceeds the limit", teamChildNamespaceStr)
+		}
+		if _, err := handler.clientset.CoreV1().Namespaces().Get(teamChildNamespaceStr, metav1.GetOptions{}); err != nil {
+			t.Errorf("child namespace of team %s not created: %s", team.GetName(), err)
+		}
+		childNamespaces[teamChildNamespaceStr] = true
+	}
+	if len(childNamespaces) != len(teams) {
+		t.Errorf("child namespaces collide: %v", childNamespaces)
+	}
+}
+
+func TestObjectCreatedNamespaceCollision(t *testing.T) {
+	// Team "b-team-c" of authority "a" and team "c" of authority "a-team-b" map to the same child namespace
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "a"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-a",
+		Labels: map[string]string{"owner": "authority", "owner-name": "a", "authority-name": "a"}}}
+	collidingNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-a-team-b-team-c",
+		Labels: map[string]string{"owner": "team", "owner-name": "c", "authority-name": "a-team-b"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "b-team-c", Namespace: "authority-a"}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace, collidingNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team),
+	}
+
+	handler.ObjectCreated(team)
+	teamUpdated, _ := handler.edgenetClientset.AppsV1alpha().Teams("authority-a").Get("b-team-c", metav1.GetOptions{})
+	if teamUpdated.Status.Enabled || teamUpdated.Status.State != failure || len(teamUpdated.Status.Message) == 0 {
+		t.Errorf("team enabled in spite of the collision: %+v", teamUpdated.Status)
+	}
+}
+
+func TestChildNamespaceControllerReference(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet", UID: "demo-uid"}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team),
+	}
+
+	handler.ObjectCreated(team)
+	childNamespace, err := handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("child namespace not created: %s", err)
+	}
+	controllerRefs := []metav1.OwnerReference{}
+	for _, ownerRef := range childNamespace.GetOwnerReferences() {
+		if ownerRef.Controller != nil && *ownerRef.Controller {
+			controllerRefs = append(controllerRefs, ownerRef)
+		}
+	}
+	if len(controllerRefs) != 1 {
+		t.Fatalf("expected exactly one controller owner reference, got %v", childNamespace.GetOwnerReferences())
+	}
+	if controllerRefs[0].Kind != "Team" || controllerRefs[0].Name != "demo" || controllerRefs[0].UID != "demo-uid" {
+		t.Errorf("unexpected controller owner reference: %+v", controllerRefs[0])
+	}
+}
+
+func TestChildNamespaceMetadataPropagation(t *testing.T) {
+	namespace.SetPropagationPrefix("policy.edge-net.io/")
+	defer namespace.SetPropagationPrefix("")
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet",
+			"policy.edge-net.io/cost-center": "lip6"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team),
+	}
+
+	// The child namespace inherits the labels with the prefix on creation, but not its owner labels
+	handler.ObjectCreated(team)
+	childNamespace, err := handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("child namespace not created: %s", err)
+	}
+	if childNamespace.Labels["policy.edge-net.io/cost-center"] != "lip6" || childNamespace.Labels["owner"] != "team" {
+		t.Errorf("unexpected child namespace labels on creation: %v", childNamespace.Labels)
+	}
+	// A change in the authority namespace reaches the child namespace on the next update
+	authorityNamespace.Labels["policy.edge-net.io/cost-center"] = "inria"
+	authorityNamespace.Labels["policy.edge-net.io/region"] = "eu"
+	handler.clientset.CoreV1().Namespaces().Update(authorityNamespace)
+	team.Status.Enabled = true
+	handler.ObjectUpdated(team, fields{resync: true})
+	childNamespace, _ = handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{})
+	if childNamespace.Labels["policy.edge-net.io/cost-center"] != "inria" || childNamespace.Labels["policy.edge-net.io/region"] != "eu" {
+		t.Errorf("child namespace labels out of sync: %v", childNamespace.Labels)
+	}
+	// So does a removal
+	authorityNamespace.Labels = map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet",
+		"policy.edge-net.io/cost-center": "inria"}
+	handler.clientset.CoreV1().Namespaces().Update(authorityNamespace)
+	handler.ObjectUpdated(team, fields{resync: true})
+	childNamespace, _ = handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{})
+	if _, exists := childNamespace.Labels["policy.edge-net.io/region"]; exists {
+		t.Errorf("label removed from the authority namespace remains: %v", childNamespace.Labels)
+	}
+}
+
+func TestChildNamespaceNetworkPolicies(t *testing.T) {
+	for _, networkIsolation := range []bool{true, false} {
+		authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+			Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+		authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+			Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+		team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+		handler := &Handler{
+			clientset:        testclient.NewSimpleClientset(authorityNamespace),
+			edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team),
+			networkIsolation: networkIsolation,
+		}
+
+		handler.ObjectCreated(team)
+		policies, _ := handler.clientset.NetworkingV1().NetworkPolicies("authority-edgenet-team-demo").List(metav1.ListOptions{})
+		if !networkIsolation {
+			if len(policies.Items) != 0 {
+				t.Errorf("network policies created without network isolation: %v", policies.Items)
+			}
+			continue
+		}
+		names := map[string]bool{}
+		for _, policy := range policies.Items {
+			names[policy.GetName()] = true
+			if ownerRefs := policy.GetOwnerReferences(); len(ownerRefs) != 1 || ownerRefs[0].Kind != "Namespace" || ownerRefs[0].Name != "authority-edgenet-team-demo" {
+				t.Errorf("network policy %s isn't owned by the child namespace: %v", policy.GetName(), ownerRefs)
+			}
+		}
+		if !names["default-deny"] || !names["allow-same-namespace"] {
+			t.Errorf("unexpected network policies in the child namespace: %v", names)
+		}
+	}
+}
+
+func TestResyncDeletesOrphanedNamespaces(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	// The team "demo" has been recreated as "renamed", which left the namespace of "demo" behind
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "renamed", Namespace: "authority-edgenet"},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	newChild := newChildNamespace(team, "edgenet")
+	orphan := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-team-demo",
+		Labels: map[string]string{"owner": "team", "owner-name": "demo", "authority-name": "edgenet"}}}
+	// The namespaces of other authorities and of slices aren't concerned
+	otherAuthority := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-other-team-demo",
+		Labels: map[string]string{"owner": "team", "owner-name": "demo", "authority-name": "other"}}}
+	slice := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-slice-exp",
+		Labels: map[string]string{"owner": "slice", "owner-name": "exp", "authority-name": "edgenet"}}}
+	// The team "lab" is nested in the child namespace of "renamed", and its own child namespace belongs to the same authority
+	nested := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "lab", Namespace: newChild.GetName()},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	nestedChild := newChildNamespace(nested, "edgenet")
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace, newChild, nestedChild, orphan, otherAuthority, slice),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team, nested),
+	}
+
+	// The resync of the nested team leaves the namespaces created from the authority namespace alone
+	handler.ObjectUpdated(nested, fields{resync: true})
+	if _, err := handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{}); err != nil {
+		t.Errorf("namespace of another level deleted on the resync of a nested team: %s", err)
+	}
+	handler.ObjectUpdated(team, fields{resync: true})
+	if _, err := handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{}); err == nil {
+		t.Error("orphaned child namespace not deleted on resync")
+	}
+	for _, name := range []string{"authority-edgenet-team-renamed", nestedChild.GetName(), "authority-other-team-demo", "authority-edgenet-slice-exp"} {
+		if _, err := handler.clientset.CoreV1().Namespaces().Get(name, metav1.GetOptions{}); err != nil {
+			t.Errorf("namespace %s deleted on resync: %s", name, err)
+		}
+	}
+}
+
+func TestObjectCreatedStatusConflict(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+	// The team has been modified concurrently since the handler received it
+	teamModified := team.DeepCopy()
+	teamModified.SetLabels(map[string]string{"modified": "true"})
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, teamModified)
+	// The first status update fails because of the concurrent modification
+	attempts := 0
+	edgenetClientset.PrependReactor("update", "teams", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" {
+			return false, nil, nil
+		}
+		attempts++
+		if attempts == 1 {
+			return true, nil, errors.NewConflict(apps_v1alpha.Resource("teams"), team.GetName(), fmt.Errorf("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenetClientset,
+	}
+
+	handler.ObjectCreated(team)
+	if attempts != 2 {
+		t.Errorf("status updated in %d attempts, expected 2", attempts)
+	}
+	teamUpdated, _ := handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if !teamUpdated.Status.Enabled {
+		t.Errorf("team status lost on conflict: %+v", teamUpdated.Status)
+	}
+	if teamUpdated.Labels["modified"] != "true" {
+		t.Errorf("concurrent modification overwritten: %v", teamUpdated.Labels)
+	}
+}
+
+func TestObjectUpdatedReportsErrors(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Roles: []string{"User"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "johndoe"}}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace, newChildNamespace(team, "edgenet"))
+	clientset.PrependReactor("create", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(rbacv1.Resource("rolebindings"), "", fmt.Errorf("denied"))
+	})
+	handler := &Handler{
+		clientset:        clientset,
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, user, team),
+	}
+
+	handler.ObjectUpdated(team, fields{users: userData{status: true}})
+	teamUpdated, _ := handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if teamUpdated.Status.State != failure {
+		t.Errorf("team not failed when the role bindings couldn't be created: %+v", teamUpdated.Status)
+	}
+	reported := false
+	for _, message := range teamUpdated.Status.Message {
+		if strings.HasPrefix(message, "Couldn't create the role bindings of johndoe") {
+			reported = true
+		}
+	}
+	if !reported {
+		t.Errorf("role binding error not in the team status: %v", teamUpdated.Status.Message)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	cases := []struct {
+		err      error
+		terminal bool
+	}{
+		{&NamespaceCreateError{Namespace: "demo", Err: errors.NewAlreadyExists(corev1.Resource("namespaces"), "demo")}, false},
+		{&NamespaceCreateError{Namespace: "demo", Err: errors.NewServerTimeout(corev1.Resource("namespaces"), "create", 1)}, false},
+		{&NamespaceCreateError{Namespace: "demo", Err: errors.NewInvalid(corev1.SchemeGroupVersion.WithKind("Namespace").GroupKind(), "demo", nil)}, true},
+		{&RoleBindingError{Namespace: "demo", Username: "johndoe", Err: errors.NewForbidden(rbacv1.Resource("rolebindings"), "", fmt.Errorf("denied"))}, false},
+		{&RoleBindingError{Namespace: "demo", Username: "johndoe", Err: errors.NewBadRequest("malformed")}, true},
+		{&MailError{Subject: "team-creation", Username: "johndoe", Err: fmt.Errorf("connection refused")}, false},
+		{fmt.Errorf("unknown"), false},
+	}
+	for _, c := range cases {
+		if isTerminal(c.err) != c.terminal {
+			t.Errorf("%s: expected terminal to be %t", c.err, c.terminal)
+		}
+	}
+}
+
+func TestObjectCreatedNamespaceFailure(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace)
+	// The API server fails to create the namespace once
+	failures := 1
+	clientset.PrependReactor("create", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, errors.NewServerTimeout(corev1.Resource("namespaces"), "create", 1)
+		}
+		return false, nil, nil
+	})
+	handler := &Handler{
+		clientset:        clientset,
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team),
+	}
+
+	err := handler.ObjectCreated(team)
+	if _, ok := err.(*NamespaceCreateError); !ok || isTerminal(err) {
+		t.Fatalf("expected a namespace create error to retry, got %v", err)
+	}
+	teamUpdated, _ := handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if teamUpdated.Status.Enabled {
+		t.Error("team enabled without its child namespace")
+	}
+	if teamUpdated.Status.State != failure || len(teamUpdated.Status.Message) != 1 ||
+		!strings.Contains(teamUpdated.Status.Message[0], "authority-edgenet-team-demo") {
+		t.Errorf("unexpected team status: %+v", teamUpdated.Status)
+	}
+	// The retry creates the namespace and enables the team
+	if err := handler.ObjectCreated(teamUpdated); err != nil {
+		t.Fatalf("retry failed: %s", err)
+	}
+	if _, err := handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{}); err != nil {
+		t.Errorf("child namespace not created on retry: %s", err)
+	}
+	teamUpdated, _ = handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if !teamUpdated.Status.Enabled || teamUpdated.Status.State == failure || len(teamUpdated.Status.Message) != 0 {
+		t.Errorf("team not enabled on retry: %+v", teamUpdated.Status)
+	}
+}
+
+func TestObjectCreatedNamespaceRace(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+	other := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "authority-edgenet"}}
+	// The namespace has been created by an earlier attempt, yet the handler reads it as missing
+	newHandler := func(childNamespace *corev1.Namespace) *Handler {
+		clientset := testclient.NewSimpleClientset(authorityNamespace, childNamespace)
+		missing := true
+		clientset.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if name := action.(k8stesting.GetAction).GetName(); name != "authority-edgenet-team-demo" || !missing {
+				return false, nil, nil
+			}
+			missing = false
+			return true, nil, errors.NewNotFound(corev1.Resource("namespaces"), "authority-edgenet-team-demo")
+		})
+		return &Handler{clientset: clientset, edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team)}
+	}
+
+	handler := newHandler(newChildNamespace(team, "edgenet"))
+	if err := handler.ObjectCreated(team); err != nil {
+		t.Fatalf("namespace of the team taken as a failure: %s", err)
+	}
+	teamUpdated, err := handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if err != nil || !teamUpdated.Status.Enabled {
+		t.Errorf("team not enabled along with its namespace: %v", err)
+	}
+
+	// The namespace of another resource fails the team, which is kept
+	foreign := newChildNamespace(other, "edgenet")
+	foreign.SetName("authority-edgenet-team-demo")
+	handler = newHandler(foreign)
+	handler.ObjectCreated(team)
+	teamUpdated, err = handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("team deleted as its namespace is in use: %s", err)
+	}
+	if teamUpdated.Status.Enabled || teamUpdated.Status.State != failure {
+		t.Errorf("unexpected team status: %+v", teamUpdated.Status)
+	}
+}
+
+func TestObjectCreatedNamespaceForbidden(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace)
+	// The controller lacks the permission to create namespaces until it is granted
+	clientset.PrependReactor("create", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(corev1.Resource("namespaces"), "authority-edgenet-team-demo", fmt.Errorf("denied"))
+	})
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team)}
+
+	err := handler.ObjectCreated(team)
+	if err == nil || isTerminal(err) {
+		t.Errorf("error is %v, expected a retry", err)
+	}
+	if _, err := handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{}); err != nil {
+		t.Errorf("team deleted as its namespace is forbidden: %s", err)
+	}
+}
+
+func TestSuspendedTeamUntouched(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet",
+		Annotations: map[string]string{suspension.Annotation: "true"}}}
+	enabledTeam := team.DeepCopy()
+	enabledTeam.Status.Enabled = true
+	childNamespace := newChildNamespace(team, "edgenet")
+	clientset := testclient.NewSimpleClientset(authorityNamespace, childNamespace)
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, team)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+
+	handler.ObjectCreated(team)
+	handler.ObjectUpdated(enabledTeam, fields{resync: true, enabled: true, users: userData{status: true}})
+	handler.ObjectDeleted(nil, fields{users: userData{status: true}, enabled: true,
+		object: objectData{name: "demo", ownerNamespace: "authority-edgenet", childNamespace: childNamespace.GetName(), suspended: true}})
+	for _, action := range append(clientset.Actions(), edgenetClientset.Actions()...) {
+		if action.GetVerb() != "get" && action.GetVerb() != "list" && action.GetVerb() != "watch" {
+			t.Errorf("suspended team mutated: %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+func TestReconcileIdempotent(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Roles: []string{"User"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	manager := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "janedoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Roles: []string{"Manager"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	for _, enabled := range []bool{false, true} {
+		team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+			Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "johndoe"}},
+				ResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("5m")}}},
+			Status: apps_v1alpha.TeamStatus{Enabled: enabled}}
+		clientset := testclient.NewSimpleClientset(authorityNamespace)
+		edgenetClientset := edgenettestclient.NewSimpleClientset(authority, user, manager, team)
+		handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset, networkIsolation: true}
+
+		if err := handler.reconcile(team.DeepCopy()); err != nil {
+			t.Fatalf("reconcile failed: %s", err)
+		}
+		roleBindings, _ := clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").List(metav1.ListOptions{})
+		if len(roleBindings.Items) != 2 {
+			t.Errorf("expected the role bindings of the user and the manager, got %d", len(roleBindings.Items))
+		}
+		// The second run starts from the team as the first one left it
+		teamReconciled, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+		if !teamReconciled.Status.Enabled {
+			t.Fatalf("team not enabled: %+v", teamReconciled.Status)
+		}
+		clientset.ClearActions()
+		edgenetClientset.ClearActions()
+		if err := handler.reconcile(teamReconciled); err != nil {
+			t.Fatalf("second reconcile failed: %s", err)
+		}
+		for _, action := range append(clientset.Actions(), edgenetClientset.Actions()...) {
+			if action.GetVerb() != "get" && action.GetVerb() != "list" {
+				t.Errorf("second reconcile mutated: %s %s", action.GetVerb(), action.GetResource().Resource)
+			}
+		}
+	}
+}
+
+func TestLostStatusWrite(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Roles: []string{"User"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "johndoe"}}}}
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, user, team)
+	// The status writes fail until the API server recovers
+	unavailable := true
+	edgenetClientset.PrependReactor("update", "teams", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" || !unavailable {
+			return false, nil, nil
+		}
+		return true, nil, fmt.Errorf("unavailable")
+	})
+	handler := &Handler{clientset: testclient.NewSimpleClientset(authorityNamespace), edgenetClientset: edgenetClientset}
+
+	// The namespace gets created while the status that enables the team is lost, which the controller retries. The
+	// namespace remains marked as enabling, so the retry doesn't take the team as disabled on purpose.
+	err := handler.ObjectCreated(team)
+	if _, ok := err.(*StatusUpdateError); !ok {
+		t.Fatalf("error is %v, expected the status update to be retried", err)
+	}
+	unavailable = false
+	if err := handler.ObjectCreated(team); err != nil {
+		t.Fatalf("retry failed: %s", err)
+	}
+	teamUpdated, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if !teamUpdated.Status.Enabled {
+		t.Errorf("team not enabled on retry: %+v", teamUpdated.Status)
+	}
+	if childNamespace, _ := handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{}); isEnabling(childNamespace) {
+		t.Errorf("child namespace still marked as enabling: %v", childNamespace.GetAnnotations())
+	}
+	if roleBindings, _ := handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").List(metav1.ListOptions{}); len(roleBindings.Items) != 1 {
+		t.Errorf("expected the role binding of the user, got %d", len(roleBindings.Items))
+	}
+
+	// The team disabled once reconciled loses the access of its users
+	teamUpdated.Status.Enabled = false
+	if err := handler.reconcile(teamUpdated); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	if roleBindings, _ := handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").List(metav1.ListOptions{}); len(roleBindings.Items) != 0 {
+		t.Errorf("role bindings kept in the disabled team: %d", len(roleBindings.Items))
+	}
+}
+
+func TestObservedGeneration(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet", Generation: 1}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace)
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, team)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+	observed := func() apps_v1alpha.TeamStatus {
+		teamReconciled, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+		return teamReconciled.Status
+	}
+
+	if err := handler.reconcile(team.DeepCopy()); err != nil {
+		t.Fatal(err)
+	}
+	status := observed()
+	if status.ObservedGeneration != 1 || status.LastReconcileTime == nil {
+		t.Fatalf("status is %+v, expected the first generation observed", status)
+	}
+	// A change of the spec is observed once it is reconciled
+	teamChanged, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	teamChanged.Spec.Description = "changed"
+	teamChanged.SetGeneration(2)
+	teamChanged, _ = edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Update(teamChanged)
+	if observed().ObservedGeneration != 1 {
+		t.Error("generation observed before the reconciliation")
+	}
+	if err := handler.reconcile(teamChanged.DeepCopy()); err != nil {
+		t.Fatal(err)
+	}
+	if status := observed(); status.ObservedGeneration != 2 {
+		t.Errorf("observed generation is %d, expected 2", status.ObservedGeneration)
+	}
+	// The failed reconciliation leaves the latest change unobserved
+	teamChanged, _ = edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	teamChanged.SetGeneration(3)
+	clientset.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewTimeoutError("request timed out", 1)
+	})
+	handler.reconcile(teamChanged.DeepCopy())
+	if status := observed(); status.State != failure || status.ObservedGeneration != 2 {
+		t.Errorf("status is %+v, expected the failure with the second generation observed", status)
+	}
+}
+
+func TestResendInvitations(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Email: "john.doe@edge-net.org", Roles: []string{"User"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	teamUser := apps_v1alpha.TeamUsers{Authority: "edgenet", Username: "johndoe"}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{teamUser}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace, newChildNamespace(team, "edgenet"))
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, user, team)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+
+	// The mailer fails to send the invitation as the SMTP server isn't configured
+	defer mailer.SetEnabled(true)
+	mailer.SetEnabled(true)
+	handler.ObjectUpdated(team, fields{enabled: true})
+	teamUpdated, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if len(teamUpdated.Status.PendingInvitations) != 1 || teamUpdated.Status.PendingInvitations[0] != teamUser {
+		t.Fatalf("failed invitation not pending: %+v", teamUpdated.Status)
+	}
+	// The invitation stays pending as long as it fails
+	if err := ResendInvitations(clientset, edgenetClientset, "authority-edgenet", "demo"); err == nil {
+		t.Error("failed resend reported as successful")
+	}
+	teamUpdated, _ = edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if len(teamUpdated.Status.PendingInvitations) != 1 {
+		t.Errorf("pending invitation lost on a failed resend: %+v", teamUpdated.Status)
+	}
+	// The successful resend clears the pending invitation, the mailer only logs the email when disabled
+	mailer.SetEnabled(false)
+	if err := ResendInvitations(clientset, edgenetClientset, "authority-edgenet", "demo"); err != nil {
+		t.Fatalf("resend failed: %s", err)
+	}
+	teamUpdated, _ = edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if len(teamUpdated.Status.PendingInvitations) != 0 {
+		t.Errorf("pending invitation not cleared: %+v", teamUpdated.Status)
+	}
+	if !teamUpdated.Status.Enabled {
+		t.Errorf("team status altered by the resend: %+v", teamUpdated.Status)
+	}
+}
+
+func TestResourceQuotasOfTeams(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	demo := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.TeamSpec{ResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("5m")}}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	lab := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "lab", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.TeamSpec{ResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("8m")}}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	// A quota that someone else created in the namespace of lab under the name the team would use
+	foreign := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "team-quota-lab", Namespace: "authority-edgenet-team-lab"},
+		Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("1")}}}
+	// And the quota of the earlier versions of the handler in the namespace of demo
+	legacy := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "team-quota", Namespace: "authority-edgenet-team-demo"},
+		Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("5m")}}}
+	// And a quota that an operator created in the namespace of ops under the legacy name
+	ops := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.TeamSpec{ResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("5m")}}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	operated := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "team-quota", Namespace: "authority-edgenet-team-ops"},
+		Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"pods": resource.MustParse("2")}}}
+	handler := &Handler{
+		clientset: testclient.NewSimpleClientset(authorityNamespace, newChildNamespace(demo, "edgenet"), newChildNamespace(lab, "edgenet"),
+			newChildNamespace(ops, "edgenet"), foreign, legacy, operated),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, demo, lab, ops),
+	}
+
+	handler.reconcile(demo.DeepCopy())
+	handler.reconcile(lab.DeepCopy())
+	handler.reconcile(ops.DeepCopy())
+	demoQuota, err := handler.clientset.CoreV1().ResourceQuotas("authority-edgenet-team-demo").Get("team-quota-demo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("quota of demo not created: %s", err)
+	}
+	if cpu := demoQuota.Spec.Hard["cpu"]; cpu.String() != "5m" {
+		t.Errorf("unexpected quota of demo: %v", demoQuota.Spec.Hard)
+	}
+	if _, err := handler.clientset.CoreV1().ResourceQuotas("authority-edgenet-team-demo").Get("team-quota", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("legacy quota of demo not removed: %v", err)
+	}
+	foreignQuota, _ := handler.clientset.CoreV1().ResourceQuotas("authority-edgenet-team-lab").Get("team-quota-lab", metav1.GetOptions{})
+	if cpu := foreignQuota.Spec.Hard["cpu"]; cpu.String() != "1" {
+		t.Errorf("quota that doesn't belong to lab overwritten: %v", foreignQuota.Spec.Hard)
+	}
+	if _, err := handler.clientset.CoreV1().ResourceQuotas("authority-edgenet-team-ops").Get("team-quota", metav1.GetOptions{}); err != nil {
+		t.Errorf("quota of the operator removed as legacy: %v", err)
+	}
+	quotas, _ := handler.clientset.CoreV1().ResourceQuotas("").List(metav1.ListOptions{})
+	if len(quotas.Items) != 4 {
+		t.Errorf("expected the quotas of demo and ops, the foreign quota and that of the operator, got %d quotas", len(quotas.Items))
+	}
+
+	// The old default is legacy too, whatever the quota of the team
+	demo.Spec.ResourceQuota.Hard["cpu"] = resource.MustParse("10m")
+	handler.clientset.CoreV1().ResourceQuotas("authority-edgenet-team-demo").Create(&corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-quota"}, Spec: corev1.ResourceQuotaSpec{Hard: legacyResourceQuotaHard.DeepCopy()}})
+	handler.reconcile(demo.DeepCopy())
+	if _, err := handler.clientset.CoreV1().ResourceQuotas("authority-edgenet-team-demo").Get("team-quota", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("legacy quota of the old default not removed: %v", err)
+	}
+}
+
+func TestUserAccessStatus(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	newUser := func(name string, active, aup bool) *apps_v1alpha.User {
+		return &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "authority-edgenet"},
+			Spec:   apps_v1alpha.UserSpec{Roles: []string{"User"}},
+			Status: apps_v1alpha.UserStatus{Active: active, AUP: aup}}
+	}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{
+			{Authority: "edgenet", Username: "joe"}, {Authority: "edgenet", Username: "ann"}, {Authority: "edgenet", Username: "bob"},
+			{Authority: "edgenet", Username: "eve"}, {Authority: "edgenet", Username: "tom"}},
+			ResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("5m")}}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace)
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, team,
+		newUser("joe", true, true), newUser("ann", false, true), newUser("bob", true, false), newUser("tom", true, true))
+	// The role binding of tom is rejected
+	clientset.PrependReactor("create", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		roleBinding := action.(k8stesting.CreateAction).GetObject().(*rbacv1.RoleBinding)
+		if strings.Contains(roleBinding.GetName(), "tom") {
+			return true, nil, errors.NewForbidden(rbacv1.Resource("rolebindings"), roleBinding.GetName(), fmt.Errorf("denied"))
+		}
+		return false, nil, nil
+	})
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+
+	if err := handler.reconcile(team.DeepCopy()); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	teamReconciled, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	expected := []apps_v1alpha.TeamUserStatus{
+		{Authority: "edgenet", Username: "joe", Access: "bound"},
+		{Authority: "edgenet", Username: "ann", Access: "skipped-inactive"},
+		{Authority: "edgenet", Username: "bob", Access: "skipped-no-aup"},
+		{Authority: "edgenet", Username: "eve", Access: "not-found"},
+		{Authority: "edgenet", Username: "tom", Access: "failed"},
+	}
+	if len(teamReconciled.Status.Users) != len(expected) {
+		t.Fatalf("user statuses are %+v, expected %+v", teamReconciled.Status.Users, expected)
+	}
+	for i, userStatus := range teamReconciled.Status.Users {
+		if userStatus != expected[i] {
+			t.Errorf("status of user %s is %+v, expected %+v", userStatus.Username, userStatus, expected[i])
+		}
+	}
+	if _, err := clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Get("authority-edgenet-joe-team-user", metav1.GetOptions{}); err != nil {
+		t.Errorf("role binding of the bound user not created: %s", err)
+	}
+}
+
+func TestNormalizedUserReferences(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	newUser := func(name string) *apps_v1alpha.User {
+		return &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "authority-edgenet"},
+			Spec:   apps_v1alpha.UserSpec{Roles: []string{"User"}},
+			Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	}
+	// The references have a stray capital letter or space
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{
+			{Authority: "EdgeNet", Username: "joe"}, {Authority: "edgenet ", Username: " Ann"}, {Authority: "edgenet", Username: "BOB"}}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace)
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, team, newUser("joe"), newUser("ann"), newUser("bob"))
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+
+	if err := handler.reconcile(team.DeepCopy()); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	teamReconciled, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	for _, userStatus := range teamReconciled.Status.Users {
+		if userStatus.Access != "bound" || userStatus.Authority != "edgenet" {
+			t.Errorf("status of user %q is %+v, expected bound", userStatus.Username, userStatus)
+		}
+		if _, err := clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Get(fmt.Sprintf("authority-edgenet-%s-team-user", userStatus.Username), metav1.GetOptions{}); err != nil {
+			t.Errorf("role binding of %s not created: %s", userStatus.Username, err)
+		}
+	}
+	ownerReferences, _ := handler.setOwnerReferences(team.DeepCopy())
+	if len(ownerReferences) != 3 {
+		t.Errorf("%d users own the team, expected 3", len(ownerReferences))
+	}
+
+	// Fixing the case of a reference neither removes nor invites the user
+	fixed := []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "joe"}, {Authority: "edgenet", Username: "ann"}, {Authority: "edgenet", Username: "bob"}}
+	if deleted, added := dry(team.Spec.Users, fixed); len(deleted) != 0 || len(added) != 0 {
+		t.Errorf("users %v deleted and %v added by fixing the case", deleted, added)
+	}
+	if !containsUser(team.Spec.Users, apps_v1alpha.TeamUsers{Authority: "edgenet", Username: "ann"}) {
+		t.Error("user with a stray space not in the team")
+	}
+}
+
+// sendRecorder counts the send attempts by template
+type sendRecorder struct {
+	sent map[string]int
+}
+
+func (r *sendRecorder) ObserveSend(template, result string, latency time.Duration) {
+	r.sent[template]++
+}
+
+func TestUnresolvedAuthority(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	manager := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Email: "john.doe@edge-net.org", Roles: []string{"Manager"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	// The authority of ann was renamed, that of eve still exists
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "lip6", Username: "ann"}, {Authority: "edgenet", Username: "eve"}}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, manager, team)
+	handler := &Handler{clientset: testclient.NewSimpleClientset(authorityNamespace), edgenetClientset: edgenetClientset, unresolvedNotification: true}
+	recorder := &sendRecorder{sent: map[string]int{}}
+	defer mailer.SetMetricsRecorder(nil)
+	mailer.SetMetricsRecorder(recorder)
+
+	if err := handler.reconcile(team.DeepCopy()); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	teamReconciled, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	expected := []apps_v1alpha.TeamUserStatus{
+		{Authority: "lip6", Username: "ann", Access: "authority-not-found"},
+		{Authority: "edgenet", Username: "eve", Access: "not-found"},
+	}
+	if !reflect.DeepEqual(teamReconciled.Status.Users, expected) {
+		t.Errorf("user statuses are %+v, expected %+v", teamReconciled.Status.Users, expected)
+	}
+	if !teamReconciled.Status.Enabled || teamReconciled.Status.State == failure {
+		t.Errorf("team failed because of the unresolved user: %+v", teamReconciled.Status)
+	}
+	if len(teamReconciled.Status.Message) != 1 || !strings.Contains(teamReconciled.Status.Message[0], "lip6") {
+		t.Errorf("unresolved reference not in the status messages: %v", teamReconciled.Status.Message)
+	}
+	if recorder.sent["team-authority-unresolved"] != 1 {
+		t.Errorf("%d emails sent to the owners, expected 1", recorder.sent["team-authority-unresolved"])
+	}
+
+	// The owners are informed once about the same users
+	if err := handler.reconcile(teamReconciled.DeepCopy()); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	if recorder.sent["team-authority-unresolved"] != 1 {
+		t.Errorf("owners informed again: %d emails", recorder.sent["team-authority-unresolved"])
+	}
+}
+
+func TestGroupMembership(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "joe", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.UserSpec{Roles: []string{"User"}}, Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	// The team takes the technicians of its authority in, rather than listing them
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.TeamSpec{Groups: []apps_v1alpha.TeamGroup{{Roles: []string{"Tech"}}}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace)
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, user, team)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+
+	if err := handler.reconcile(team.DeepCopy()); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	if _, err := clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Get("authority-edgenet-joe-team-user", metav1.GetOptions{}); err == nil {
+		t.Error("role binding created for the user out of the group")
+	}
+
+	// The user becomes a technician, the team stays as it is
+	user.Spec.Roles = []string{"User", "Tech"}
+	edgenetClientset.AppsV1alpha().Users("authority-edgenet").Update(user)
+	teamReconciled, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if err := handler.reconcile(teamReconciled.DeepCopy()); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	if _, err := clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Get("authority-edgenet-joe-team-user", metav1.GetOptions{}); err != nil {
+		t.Errorf("role binding of the group member not created: %s", err)
+	}
+
+	// The users of a group are read at every reconciliation, an error to read them fails the team
+	edgenetClientset.PrependReactor("list", "users", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("unavailable")
+	})
+	teamReconciled, _ = edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if err := handler.reconcile(teamReconciled.DeepCopy()); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	teamReconciled, _ = edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if teamReconciled.Status.State != failure || len(teamReconciled.Status.Message) == 0 ||
+		!strings.Contains(teamReconciled.Status.Message[0], "group") {
+		t.Errorf("group read error not in the status: %+v", teamReconciled.Status)
+	}
+}
+
+func TestUpdateKeepsUnmanagedRoleBindings(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "joe", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.UserSpec{Roles: []string{"User"}}, Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "joe"}},
+			ResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("5m")}}}}
+	// An admin has bound a role in the child namespace, and the team has had a member who left since
+	adminRoleBinding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "monitoring", Namespace: "authority-edgenet-team-demo"},
+		Subjects: []rbacv1.Subject{{Kind: "ServiceAccount", Name: "prometheus", Namespace: "monitoring"}}}
+	staleRoleBinding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-ann-team-user", Namespace: "authority-edgenet-team-demo",
+		Labels: map[string]string{"app.kubernetes.io/managed-by": "edgenet", "edge-net.io/owner-kind": "team"}},
+		Subjects: []rbacv1.Subject{{Kind: "ServiceAccount", Name: "ann", Namespace: "authority-edgenet"}}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace, adminRoleBinding, staleRoleBinding),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team, user),
+	}
+	roleBindingExists := func(name string) bool {
+		_, err := handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Get(name, metav1.GetOptions{})
+		return err == nil
+	}
+
+	handler.ObjectCreated(team)
+	team, _ = handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	handler.ObjectUpdated(team, fields{users: userData{status: true}})
+	roleBinding, err := handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Get("authority-edgenet-joe-team-user", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("role binding of the member not created: %s", err)
+	} else if roleBinding.Labels["app.kubernetes.io/managed-by"] != "edgenet" || roleBinding.Labels["edge-net.io/owner-kind"] != "team" {
+		t.Errorf("role binding of the member labeled %v", roleBinding.Labels)
+	}
+	if roleBindingExists("authority-edgenet-ann-team-user") {
+		t.Error("role binding of the former member remains")
+	}
+	if !roleBindingExists("monitoring") {
+		t.Error("role binding that the team doesn't manage deleted on update")
+	}
+
+	// Disabling the authority revokes the access of the members only
+	authority.Status.Enabled = false
+	handler.edgenetClientset.AppsV1alpha().Authorities().UpdateStatus(authority)
+	handler.ObjectUpdated(team, fields{resync: true})
+	if roleBindingExists("authority-edgenet-joe-team-user") {
+		t.Error("role binding of the member remains in the team of a disabled authority")
+	}
+	if !roleBindingExists("monitoring") {
+		t.Error("role binding that the team doesn't manage deleted along with the access of the members")
+	}
+}
+
+func TestAuthorityReadFailure(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "joe", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.UserSpec{Roles: []string{"User"}}, Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "joe"}},
+			ResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("5m")}}}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team, user),
+	}
+	handler.ObjectCreated(team)
+	if _, err := handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Get("authority-edgenet-joe-team-user", metav1.GetOptions{}); err != nil {
+		t.Fatalf("role binding of the member not created: %s", err)
+	}
+
+	// The API server fails to return the authority, which doesn't mean the authority is disabled
+	handler.edgenetClientset.(*edgenettestclient.Clientset).PrependReactor("get", "authorities", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewServiceUnavailable("etcd unavailable")
+	})
+	team, _ = handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	err := handler.ObjectCreated(team)
+	if _, ok := err.(*AuthorityReadError); !ok || isTerminal(err) {
+		t.Errorf("error is %v, expected an authority read error to requeue", err)
+	}
+	handler.ObjectUpdated(team, fields{resync: true})
+	if _, err := handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{}); err != nil {
+		t.Errorf("team deleted as the authority couldn't be read: %s", err)
+	}
+	if _, err := handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Get("authority-edgenet-joe-team-user", metav1.GetOptions{}); err != nil {
+		t.Errorf("access of the member revoked as the authority couldn't be read: %s", err)
+	}
+}
+
+func TestOwnerNamespaceNotFound(t *testing.T) {
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "joe"}}}}
+	clientset := testclient.NewSimpleClientset()
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenettestclient.NewSimpleClientset(team)}
+
+	// The team whose authority namespace is gone is skipped rather than retried
+	if err := handler.ObjectCreated(team); err != nil {
+		t.Errorf("error is %v, expected the team to be skipped", err)
+	}
+	handler.ObjectUpdated(team, fields{resync: true, enabled: true, users: userData{status: true}})
+	handler.ObjectDeleted(nil, fields{users: userData{status: true, deleted: `[{"authority":"edgenet","username":"joe"}]`}, enabled: true,
+		object: objectData{name: "demo", ownerNamespace: "authority-edgenet", childNamespace: "authority-edgenet-team-demo"}})
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "create" {
+			t.Errorf("%s created for the team without its authority namespace", action.GetResource().Resource)
+		}
+	}
+}
+
+func TestOwnerNamespaceReadFailure(t *testing.T) {
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+	clientset := testclient.NewSimpleClientset()
+	clientset.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewTimeoutError("request timed out", 1)
+	})
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenettestclient.NewSimpleClientset(team)}
+
+	err := handler.ObjectCreated(team)
+	if _, ok := err.(*AuthorityReadError); !ok || isTerminal(err) {
+		t.Errorf("error is %v, expected an authority read error to requeue", err)
+	}
+	teamUpdated, _ := handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if teamUpdated.Status.State != failure || len(teamUpdated.Status.Message) != 1 || !strings.Contains(teamUpdated.Status.Message[0], "request timed out") {
+		t.Errorf("status is %v, expected the failure to read the namespace", teamUpdated.Status)
+	}
+	handler.ObjectDeleted(nil, fields{users: userData{status: true, deleted: `[{"authority":"edgenet","username":"joe"}]`}, enabled: true,
+		object: objectData{name: "demo", ownerNamespace: "authority-edgenet", childNamespace: "authority-edgenet-team-demo"}})
+}
+
+func TestManagedLabels(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "joe", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.UserSpec{Roles: []string{"User"}}, Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "joe"}},
+			ResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("5m")}}}}
+	handler := &Handler{
+		clientset:        testclient.NewSimpleClientset(authorityNamespace),
+		edgenetClientset: edgenettestclient.NewSimpleClientset(authority, team, user),
+		networkIsolation: true,
+	}
+	handler.ObjectCreated(team)
+
+	managed := func(kind string, object metav1.Object, err error) {
+		if err != nil {
+			t.Errorf("%s not created: %s", kind, err)
+		} else if labels := object.GetLabels(); labels["app.kubernetes.io/managed-by"] != "edgenet" || labels["edge-net.io/owner-kind"] != "team" {
+			t.Errorf("%s %s labeled %v", kind, object.GetName(), labels)
+		}
+	}
+	childNamespace, err := handler.clientset.CoreV1().Namespaces().Get("authority-edgenet-team-demo", metav1.GetOptions{})
+	managed("namespace", childNamespace, err)
+	resourceQuota, err := handler.clientset.CoreV1().ResourceQuotas("authority-edgenet-team-demo").Get("team-quota-demo", metav1.GetOptions{})
+	managed("resource quota", resourceQuota, err)
+	networkPolicy, err := handler.clientset.NetworkingV1().NetworkPolicies("authority-edgenet-team-demo").Get("default-deny", metav1.GetOptions{})
+	managed("network policy", networkPolicy, err)
+	roleBinding, err := handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").Get("authority-edgenet-joe-team-user", metav1.GetOptions{})
+	managed("role binding", roleBinding, err)
+}
+
+func TestSweepOrphanedNamespaces(t *testing.T) {
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+	// The team "lab" is nested in the child namespace of "demo"
+	nested := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "lab", Namespace: "authority-edgenet-team-demo"}}
+	newChild := func(authorityName, teamName string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("authority-%s-team-%s", authorityName, teamName),
+			Labels: map[string]string{"owner": "team", "owner-name": teamName, "authority-name": authorityName}}}
+	}
+	// The team "gone" was deleted while the controller was down, and lip6 has no team left
+	slice := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-slice-gone",
+		Labels: map[string]string{"owner": "slice", "owner-name": "gone", "authority-name": "edgenet"}}}
+	nestedGone := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "gone", Namespace: "authority-edgenet-team-demo"}}
+	// The parent of an unlabeled namespace whose name isn't that of a top-level team is unknown
+	unknown := newChild("edgenet", "unknown")
+	unknown.SetName("authority-edgenet-team-demo-team-unknown")
+	newHandler := func() *Handler {
+		return &Handler{
+			clientset: testclient.NewSimpleClientset(newChild("edgenet", "demo"), newChild("edgenet", "gone"), newChild("lip6", "gone"), slice,
+				newChildNamespace(nested, "edgenet"), newChildNamespace(nestedGone, "edgenet"), unknown),
+			edgenetClientset: edgenettestclient.NewSimpleClientset(team, nested),
+		}
+	}
+	exists := func(handler *Handler, name string) bool {
+		_, err := handler.clientset.CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+		return err == nil
+	}
+
+	handler := newHandler()
+	handler.sweepOrphanedNamespaces("", "")
+	for _, name := range []string{"authority-edgenet-team-gone", "authority-lip6-team-gone", "authority-edgenet-team-demo-team-gone"} {
+		if exists(handler, name) {
+			t.Errorf("orphaned namespace %s not deleted", name)
+		}
+	}
+	for _, name := range []string{"authority-edgenet-team-demo", "authority-edgenet-slice-gone", "authority-edgenet-team-demo-team-lab",
+		"authority-edgenet-team-demo-team-unknown"} {
+		if !exists(handler, name) {
+			t.Errorf("namespace %s deleted", name)
+		}
+	}
+
+	// The controller scoped to a namespace leaves the namespaces created from the others alone
+	handler = newHandler()
+	handler.sweepOrphanedNamespaces("authority-edgenet", "")
+	if exists(handler, "authority-edgenet-team-gone") || !exists(handler, "authority-lip6-team-gone") || !exists(handler, "authority-edgenet-team-demo-team-gone") {
+		t.Error("orphans swept out of the namespace watched")
+	}
+
+	// The controller scoped to an authority sweeps its nested teams as well
+	handler = newHandler()
+	handler.sweepOrphanedNamespaces("", "edgenet")
+	if exists(handler, "authority-edgenet-team-gone") || exists(handler, "authority-edgenet-team-demo-team-gone") || !exists(handler, "authority-lip6-team-gone") {
+		t.Error("orphans swept out of the authority")
+	}
+
+	// The namespaces are kept when the teams cannot be read
+	handler = newHandler()
+	handler.edgenetClientset.(*edgenettestclient.Clientset).PrependReactor("get", "teams", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("unavailable")
+	})
+	handler.sweepOrphanedNamespaces("", "")
+	if !exists(handler, "authority-edgenet-team-gone") {
+		t.Error("namespace deleted although its team couldn't be read")
+	}
+}
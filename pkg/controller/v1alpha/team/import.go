@@ -0,0 +1,158 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package team
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/client/clientset/versioned"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+)
+
+// ParseTeamUsers reads a list of users given either as a JSON array of {"authority", "username"} objects or as CSV
+// rows of authority,username with an optional header. The malformed rows are skipped, and returned as ImportRowError.
+// The error is set only if the payload cannot be read at all.
+func ParseTeamUsers(payload []byte) ([]apps_v1alpha.TeamUsers, []error, error) {
+	if trimmed := bytes.TrimSpace(payload); len(trimmed) > 0 && trimmed[0] == '[' {
+		return parseTeamUsersJSON(trimmed)
+	}
+	return parseTeamUsersCSV(payload)
+}
+
+func parseTeamUsersJSON(payload []byte) ([]apps_v1alpha.TeamUsers, []error, error) {
+	rows := []json.RawMessage{}
+	if err := json.Unmarshal(payload, &rows); err != nil {
+		return nil, nil, fmt.Errorf("malformed JSON list of users: %s", err)
+	}
+	users := []apps_v1alpha.TeamUsers{}
+	var errs []error
+	for i, row := range rows {
+		user := apps_v1alpha.TeamUsers{}
+		err := json.Unmarshal(row, &user)
+		if err == nil {
+			user = NormalizeUser(user)
+			err = validateTeamUser(user)
+		}
+		if err != nil {
+			errs = append(errs, &ImportRowError{Row: i + 1, Err: err})
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, errs, nil
+}
+
+func parseTeamUsersCSV(payload []byte) ([]apps_v1alpha.TeamUsers, []error, error) {
+	reader := csv.NewReader(bytes.NewReader(payload))
+	// The rows with a wrong number of fields are reported rather than failing the whole payload
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	users := []apps_v1alpha.TeamUsers{}
+	var errs []error
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if _, isParseError := err.(*csv.ParseError); !isParseError {
+				return nil, nil, err
+			}
+			errs = append(errs, &ImportRowError{Row: row, Err: err})
+			continue
+		}
+		if len(record) != 2 {
+			errs = append(errs, &ImportRowError{Row: row, Err: fmt.Errorf("%d fields, expected authority and username", len(record))})
+			continue
+		}
+		user := NormalizeUser(apps_v1alpha.TeamUsers{Authority: record[0], Username: record[1]})
+		if row == 1 && strings.EqualFold(user.Authority, "authority") && strings.EqualFold(user.Username, "username") {
+			continue
+		}
+		if err := validateTeamUser(user); err != nil {
+			errs = append(errs, &ImportRowError{Row: row, Err: err})
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, errs, nil
+}
+
+// validateTeamUser checks that the authority and the username can be the names of the objects they refer to
+func validateTeamUser(user apps_v1alpha.TeamUsers) error {
+	if msgs := validation.IsDNS1123Subdomain(user.Authority); len(msgs) > 0 {
+		return fmt.Errorf("authority %q is invalid: %s", user.Authority, strings.Join(msgs, ", "))
+	}
+	if msgs := validation.IsDNS1123Subdomain(user.Username); len(msgs) > 0 {
+		return fmt.Errorf("username %q is invalid: %s", user.Username, strings.Join(msgs, ", "))
+	}
+	return nil
+}
+
+// MergeTeamUsers appends the users who aren't in the team yet to its spec, and returns the number of users added
+func MergeTeamUsers(teamCopy *apps_v1alpha.Team, users []apps_v1alpha.TeamUsers) int {
+	members := map[apps_v1alpha.TeamUsers]bool{}
+	for _, teamUser := range teamCopy.Spec.Users {
+		members[NormalizeUser(teamUser)] = true
+	}
+	added := 0
+	for _, user := range users {
+		if members[NormalizeUser(user)] {
+			continue
+		}
+		members[NormalizeUser(user)] = true
+		teamCopy.Spec.Users = append(teamCopy.Spec.Users, user)
+		added++
+	}
+	return added
+}
+
+// ImportTeamUsers parses the payload as ParseTeamUsers does and merges the users into the team, the merge is
+// re-applied to the latest version of the team if the object has been modified concurrently.
+// It returns the number of users added along with the malformed rows skipped.
+func ImportTeamUsers(edgenetClientset versioned.Interface, teamNamespace, teamName string, payload []byte) (int, []error, error) {
+	users, rowErrs, err := ParseTeamUsers(payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	added := 0
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		teamRaw, err := edgenetClientset.AppsV1alpha().Teams(teamNamespace).Get(teamName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		teamCopy := teamRaw.DeepCopy()
+		added = MergeTeamUsers(teamCopy, users)
+		if added == 0 {
+			return nil
+		}
+		_, err = edgenetClientset.AppsV1alpha().Teams(teamNamespace).Update(teamCopy)
+		return err
+	})
+	if err != nil {
+		return 0, rowErrs, err
+	}
+	return added, rowErrs, nil
+}
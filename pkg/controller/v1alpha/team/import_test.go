@@ -0,0 +1,88 @@
+package team
+
+import (
+	"reflect"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseTeamUsers(t *testing.T) {
+	joe := apps_v1alpha.TeamUsers{Authority: "edgenet", Username: "joe"}
+	ann := apps_v1alpha.TeamUsers{Authority: "lip6", Username: "ann"}
+	cases := []struct {
+		payload   string
+		expected  []apps_v1alpha.TeamUsers
+		skipped   []int
+		malformed bool
+	}{
+		{"authority,username\nedgenet,joe\nlip6, ann\n", []apps_v1alpha.TeamUsers{joe, ann}, nil, false},
+		{"edgenet,joe\nlip6,ann", []apps_v1alpha.TeamUsers{joe, ann}, nil, false},
+		// The rows with missing or extra fields, or invalid names, are skipped
+		{"edgenet,joe\nedgenet\nlip6,ann,extra\nedgenet,Joe Doe\n,ann\nlip6,ann\n", []apps_v1alpha.TeamUsers{joe, ann}, []int{2, 3, 4, 5}, false},
+		{"edgenet,joe\n\"edgenet,ann\nlip6,ann\n", []apps_v1alpha.TeamUsers{joe}, []int{2}, false},
+		// The names are trimmed and lowercased as those of the objects they refer to
+		{"EdgeNet, JOE \n LIP6 ,Ann", []apps_v1alpha.TeamUsers{joe, ann}, nil, false},
+		{`[{"authority": " EdgeNet", "username": "Joe "}, {"authority": "lip6", "username": "ANN"}]`, []apps_v1alpha.TeamUsers{joe, ann}, nil, false},
+		{`[{"authority": "edgenet", "username": "joe"}, {"authority": "lip6", "username": "ann"}]`, []apps_v1alpha.TeamUsers{joe, ann}, nil, false},
+		{` [{"authority": "edgenet", "username": "joe"}, {"authority": "lip6"}, "ann", {"authority": "lip6", "username": "ann"}]`,
+			[]apps_v1alpha.TeamUsers{joe, ann}, []int{2, 3}, false},
+		{`[{"authority": "edgenet", "username": "joe"}`, nil, nil, true},
+		{"", []apps_v1alpha.TeamUsers{}, nil, false},
+	}
+	for _, c := range cases {
+		users, errs, err := ParseTeamUsers([]byte(c.payload))
+		if c.malformed {
+			if err == nil {
+				t.Errorf("malformed payload %q parsed: %v", c.payload, users)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("payload %q not parsed: %s", c.payload, err)
+			continue
+		}
+		if !reflect.DeepEqual(users, c.expected) {
+			t.Errorf("payload %q parsed as %v, expected %v", c.payload, users, c.expected)
+		}
+		skipped := []int{}
+		for _, err := range errs {
+			rowErr, ok := err.(*ImportRowError)
+			if !ok {
+				t.Errorf("unexpected error %s", err)
+				continue
+			}
+			skipped = append(skipped, rowErr.Row)
+		}
+		if len(skipped) != len(c.skipped) || (len(skipped) > 0 && !reflect.DeepEqual(skipped, c.skipped)) {
+			t.Errorf("payload %q skipped rows %v, expected %v", c.payload, skipped, c.skipped)
+		}
+	}
+}
+
+func TestImportTeamUsers(t *testing.T) {
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "lab", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "joe"}}}}
+	edgenetClientset := edgenettestclient.NewSimpleClientset(team)
+
+	// The current member and the duplicate row are added once
+	added, errs, err := ImportTeamUsers(edgenetClientset, "authority-edgenet", "lab", []byte("edgenet,joe\nlip6,ann\nlip6,ann\nlip6\n"))
+	if err != nil || added != 1 || len(errs) != 1 {
+		t.Fatalf("import added %d users, skipped %v, failed with %v, expected 1 user added and 1 row skipped", added, errs, err)
+	}
+	teamCopy, _ := edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("lab", metav1.GetOptions{})
+	expected := []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "joe"}, {Authority: "lip6", Username: "ann"}}
+	if !reflect.DeepEqual(teamCopy.Spec.Users, expected) {
+		t.Errorf("team users are %v, expected %v", teamCopy.Spec.Users, expected)
+	}
+	// Importing the same users again leaves the team as is, whatever their case
+	if added, _, err := ImportTeamUsers(edgenetClientset, "authority-edgenet", "lab", []byte("lip6,ann\nLIP6, Ann")); err != nil || added != 0 {
+		t.Errorf("import of the members added %d users, failed with %v", added, err)
+	}
+	if _, _, err := ImportTeamUsers(edgenetClientset, "authority-edgenet", "missing", []byte("lip6,ann")); err == nil {
+		t.Error("users imported into a missing team")
+	}
+}
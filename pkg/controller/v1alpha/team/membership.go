@@ -0,0 +1,103 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package team
+
+import (
+	"fmt"
+	"sort"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/namespace"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// UserIndex is the name of the index of the teams by the users listed in them, whose function is UserIndexFunc
+const UserIndex = "user"
+
+// userIndexKey returns the key of the user in UserIndex
+func userIndexKey(authority, username string) string {
+	user := NormalizeUser(apps_v1alpha.TeamUsers{Authority: authority, Username: username})
+	return fmt.Sprintf("%s/%s", user.Authority, user.Username)
+}
+
+// UserIndexFunc indexes the teams by the users listed in them, so that an informer given the index finds the teams
+// of a user without going through all of them
+func UserIndexFunc(obj interface{}) ([]string, error) {
+	teamObj, ok := obj.(*apps_v1alpha.Team)
+	if !ok {
+		return nil, fmt.Errorf("%T isn't a team", obj)
+	}
+	keys := []string{}
+	for _, teamUser := range teamObj.Spec.Users {
+		keys = append(keys, userIndexKey(teamUser.Authority, teamUser.Username))
+	}
+	return keys, nil
+}
+
+// ListTeamsForUser returns the teams in the authority namespaces that list the user, a user may participate in the
+// teams of other authorities. The teams are sorted by their namespace and name.
+func ListTeamsForUser(edgenetClientset versioned.Interface, authority, username string) ([]apps_v1alpha.Team, error) {
+	teams := []apps_v1alpha.Team{}
+	key := userIndexKey(authority, username)
+	err := forEachTeam(edgenetClientset, metav1.NamespaceAll, func(teamRow *apps_v1alpha.Team) {
+		if _, ok := namespace.AuthorityOf(teamRow.GetNamespace()); !ok {
+			return
+		}
+		for _, teamUser := range teamRow.Spec.Users {
+			if userIndexKey(teamUser.Authority, teamUser.Username) == key {
+				teams = append(teams, *teamRow)
+				break
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortTeams(teams)
+	return teams, nil
+}
+
+// IndexedTeamsForUser returns the teams in the authority namespaces that list the user from the indexer of a team
+// informer, which must have UserIndex. The teams are sorted by their namespace and name.
+func IndexedTeamsForUser(indexer cache.Indexer, authority, username string) ([]apps_v1alpha.Team, error) {
+	objects, err := indexer.ByIndex(UserIndex, userIndexKey(authority, username))
+	if err != nil {
+		return nil, err
+	}
+	teams := []apps_v1alpha.Team{}
+	for _, obj := range objects {
+		teamObj := obj.(*apps_v1alpha.Team)
+		if _, ok := namespace.AuthorityOf(teamObj.GetNamespace()); ok {
+			teams = append(teams, *teamObj.DeepCopy())
+		}
+	}
+	sortTeams(teams)
+	return teams, nil
+}
+
+// sortTeams sorts the teams by their namespace and name
+func sortTeams(teams []apps_v1alpha.Team) {
+	sort.Slice(teams, func(i, j int) bool {
+		if teams[i].GetNamespace() != teams[j].GetNamespace() {
+			return teams[i].GetNamespace() < teams[j].GetNamespace()
+		}
+		return teams[i].GetName() < teams[j].GetName()
+	})
+}
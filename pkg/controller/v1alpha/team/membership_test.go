@@ -0,0 +1,69 @@
+package team
+
+import (
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// membershipTeams are the teams of two authorities, in which joe of edgenet participates in some, along with a team
+// in a namespace that isn't that of an authority
+func membershipTeams() []*apps_v1alpha.Team {
+	newTeam := func(namespace, name string, users ...apps_v1alpha.TeamUsers) *apps_v1alpha.Team {
+		return &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Spec: apps_v1alpha.TeamSpec{Users: users}}
+	}
+	joe := apps_v1alpha.TeamUsers{Authority: "edgenet", Username: "joe"}
+	ann := apps_v1alpha.TeamUsers{Authority: "lip6", Username: "ann"}
+	return []*apps_v1alpha.Team{
+		newTeam("authority-lip6", "ops", ann, apps_v1alpha.TeamUsers{Authority: " EdgeNet", Username: "Joe "}),
+		newTeam("authority-edgenet", "demo", joe),
+		newTeam("authority-edgenet", "bench", ann),
+		// The user of another authority with the same name isn't joe
+		newTeam("authority-edgenet", "lab", apps_v1alpha.TeamUsers{Authority: "lip6", Username: "joe"}),
+		newTeam("default", "stray", joe),
+	}
+}
+
+func TestListTeamsForUser(t *testing.T) {
+	edgenetClientset := edgenettestclient.NewSimpleClientset()
+	for _, teamObj := range membershipTeams() {
+		edgenetClientset.AppsV1alpha().Teams(teamObj.GetNamespace()).Create(teamObj)
+	}
+	teams, err := ListTeamsForUser(edgenetClientset, "edgenet", "joe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(teams) != 2 || teams[0].GetNamespace() != "authority-edgenet" || teams[0].GetName() != "demo" ||
+		teams[1].GetNamespace() != "authority-lip6" || teams[1].GetName() != "ops" {
+		t.Errorf("teams are %v, expected demo of edgenet and ops of lip6", teams)
+	}
+	if teams, _ := ListTeamsForUser(edgenetClientset, "edgenet", "eve"); len(teams) != 0 {
+		t.Errorf("teams of a user who participates in none are %v", teams)
+	}
+}
+
+func TestIndexedTeamsForUser(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{UserIndex: UserIndexFunc})
+	for _, teamObj := range membershipTeams() {
+		indexer.Add(teamObj)
+	}
+	teams, err := IndexedTeamsForUser(indexer, "EdgeNet", "joe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(teams) != 2 || teams[0].GetName() != "demo" || teams[1].GetName() != "ops" {
+		t.Errorf("teams are %v, expected demo of edgenet and ops of lip6", teams)
+	}
+	teams, _ = IndexedTeamsForUser(indexer, "lip6", "ann")
+	if len(teams) != 2 || teams[0].GetName() != "bench" || teams[1].GetName() != "ops" {
+		t.Errorf("teams are %v, expected bench of edgenet and ops of lip6", teams)
+	}
+	// The indexer without the index fails rather than finding no team
+	if _, err := IndexedTeamsForUser(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}), "edgenet", "joe"); err == nil {
+		t.Error("teams found without the user index")
+	}
+}
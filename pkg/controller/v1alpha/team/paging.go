@@ -0,0 +1,71 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package team
+
+import (
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/client/clientset/versioned"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// listPageSize is the number of objects that each list call fetches, so that the users and teams of large authorities
+// are gone through a page at a time rather than loaded at once
+var listPageSize int64 = 500
+
+// SetListPageSize configures the number of objects that each list call fetches, 0 to fetch all of them at once
+func SetListPageSize(size int64) {
+	listPageSize = size
+}
+
+// forEachUser calls the function given for each user in the namespace, all namespaces if empty, page by page. The
+// listing stops at the first error, after the users of the pages before have been gone through.
+func forEachUser(edgenetClientset versioned.Interface, namespace string, fn func(userRow *apps_v1alpha.User)) error {
+	options := metav1.ListOptions{Limit: listPageSize}
+	for {
+		usersRaw, err := edgenetClientset.AppsV1alpha().Users(namespace).List(options)
+		if err != nil {
+			return err
+		}
+		for i := range usersRaw.Items {
+			fn(&usersRaw.Items[i])
+		}
+		if usersRaw.Continue == "" {
+			return nil
+		}
+		options.Continue = usersRaw.Continue
+	}
+}
+
+// forEachTeam calls the function given for each team in the namespace, all namespaces if empty, page by page as
+// forEachUser does
+func forEachTeam(edgenetClientset versioned.Interface, namespace string, fn func(teamRow *apps_v1alpha.Team)) error {
+	options := metav1.ListOptions{Limit: listPageSize}
+	for {
+		teamsRaw, err := edgenetClientset.AppsV1alpha().Teams(namespace).List(options)
+		if err != nil {
+			return err
+		}
+		for i := range teamsRaw.Items {
+			fn(&teamsRaw.Items[i])
+		}
+		if teamsRaw.Continue == "" {
+			return nil
+		}
+		options.Continue = teamsRaw.Continue
+	}
+}
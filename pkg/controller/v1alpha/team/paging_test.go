@@ -0,0 +1,75 @@
+package team
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// pageUsers makes the clientset serve the users given in pages of the size given, as the API server does when the
+// list calls set a limit. The fake clientset doesn't keep the limit and the continue token of the calls, so the pages
+// are served in order and the calls are counted.
+func pageUsers(edgenetClientset *edgenettestclient.Clientset, users []apps_v1alpha.User, size int) *int {
+	calls := 0
+	edgenetClientset.PrependReactor("list", "users", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		start := calls * size
+		calls++
+		if start > len(users) {
+			return true, nil, fmt.Errorf("page %d listed past the last one", calls)
+		}
+		end := start + size
+		userList := &apps_v1alpha.UserList{}
+		if end < len(users) {
+			userList.Continue = strconv.Itoa(end)
+		} else {
+			end = len(users)
+		}
+		userList.Items = users[start:end]
+		return true, userList, nil
+	})
+	return &calls
+}
+
+func TestEnsureRoleBindingsManyUsers(t *testing.T) {
+	defer SetListPageSize(listPageSize)
+	SetListPageSize(100)
+	users := []apps_v1alpha.User{}
+	for i := 0; i < 250; i++ {
+		users = append(users, apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("manager%d", i), Namespace: "authority-edgenet"},
+			Spec: apps_v1alpha.UserSpec{Roles: []string{"Manager"}}, Status: apps_v1alpha.UserStatus{Active: true, AUP: true}})
+	}
+	edgenetClientset := edgenettestclient.NewSimpleClientset()
+	calls := pageUsers(edgenetClientset, users, 100)
+	handler := &Handler{clientset: testclient.NewSimpleClientset(), edgenetClientset: edgenetClientset}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}
+
+	if _, errs := handler.ensureRoleBindings(team, "authority-edgenet-team-demo", "edgenet"); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if *calls != 3 {
+		t.Errorf("users listed in %d calls, expected a call for each of the 3 pages", *calls)
+	}
+	roleBindingsRaw, _ := handler.clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").List(metav1.ListOptions{})
+	if len(roleBindingsRaw.Items) != len(users) {
+		t.Errorf("%d role bindings created, expected one for each of the %d managers", len(roleBindingsRaw.Items), len(users))
+	}
+}
+
+func TestForEachUserError(t *testing.T) {
+	edgenetClientset := edgenettestclient.NewSimpleClientset()
+	edgenetClientset.PrependReactor("list", "users", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("too many requests")
+	})
+	visited := 0
+	if err := forEachUser(edgenetClientset, "authority-edgenet", func(*apps_v1alpha.User) { visited++ }); err == nil || visited != 0 {
+		t.Errorf("error is %v and %d users visited, expected the list error", err, visited)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package team
+
+import (
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
+
+	log "github.com/Sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SuspendedAnnotation marks the slices that the team suspended on its disabling, which tells them apart from those
+// that are suspended for another reason when the team is enabled again
+const SuspendedAnnotation = "edge-net.io/suspended-by-team"
+
+// suspendSlices marks the slices of a disabled team as suspended and removes the role bindings that the controllers
+// created in their namespaces, while the slices and their namespaces remain along with the workloads and the role
+// bindings that others created in them
+func (t *Handler) suspendSlices(teamChildNamespaceStr string) {
+	slicesRaw, err := t.edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).List(metav1.ListOptions{})
+	if err != nil {
+		log.Infof("Couldn't list the slices in %s to suspend: %s", teamChildNamespaceStr, err)
+		return
+	}
+	for _, sliceRow := range slicesRaw.Items {
+		sliceCopy := sliceRow.DeepCopy()
+		if _, suspended := sliceCopy.GetAnnotations()[SuspendedAnnotation]; !suspended {
+			annotations := map[string]string{SuspendedAnnotation: "true"}
+			for key, value := range sliceCopy.GetAnnotations() {
+				annotations[key] = value
+			}
+			sliceCopy.SetAnnotations(annotations)
+			if _, err := t.edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).Update(sliceCopy); err != nil {
+				log.Infof("Couldn't mark slice %s in %s as suspended: %s", sliceCopy.GetName(), teamChildNamespaceStr, err)
+			}
+		}
+		sliceChildNamespaceStr := namespace.ChildName(teamChildNamespaceStr, "slice", sliceCopy.GetName())
+		roleBindingsRaw, err := t.clientset.RbacV1().RoleBindings(sliceChildNamespaceStr).List(metav1.ListOptions{LabelSelector: registration.ManagedSelector("slice")})
+		if err != nil {
+			continue
+		}
+		for _, roleBindingRow := range roleBindingsRaw.Items {
+			t.clientset.RbacV1().RoleBindings(sliceChildNamespaceStr).Delete(roleBindingRow.GetName(), &metav1.DeleteOptions{})
+		}
+	}
+}
+
+// restoreSlices brings back the role bindings in the namespaces of the slices that the team suspended, as the slice
+// controller creates them, and unmarks the slices. The slices that the team hasn't suspended are left as they are.
+func (t *Handler) restoreSlices(teamChildNamespaceStr, authorityName string) {
+	slicesRaw, err := t.edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).List(metav1.ListOptions{})
+	if err != nil {
+		log.Infof("Couldn't list the slices in %s to restore: %s", teamChildNamespaceStr, err)
+		return
+	}
+	for _, sliceRow := range slicesRaw.Items {
+		if _, suspended := sliceRow.GetAnnotations()[SuspendedAnnotation]; !suspended {
+			continue
+		}
+		sliceCopy := sliceRow.DeepCopy()
+		RestoreSliceRoleBindings(t.clientset, t.edgenetClientset, sliceCopy, authorityName)
+		annotations := map[string]string{}
+		for key, value := range sliceCopy.GetAnnotations() {
+			if key != SuspendedAnnotation {
+				annotations[key] = value
+			}
+		}
+		sliceCopy.SetAnnotations(annotations)
+		if _, err := t.edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).Update(sliceCopy); err != nil {
+			log.Infof("Couldn't unmark slice %s in %s as suspended: %s", sliceCopy.GetName(), teamChildNamespaceStr, err)
+		}
+	}
+}
+
+// RestoreSliceRoleBindings binds the users who participate in the slice and the authority-admins and managers of the
+// authority to the slice namespace, as the slice controller does on creation, for the team and authority controllers
+// to restore the slices that they suspended
+func RestoreSliceRoleBindings(clientset kubernetes.Interface, edgenetClientset versioned.Interface, sliceCopy *apps_v1alpha.Slice, authorityName string) {
+	sliceChildNamespaceStr := namespace.ChildName(sliceCopy.GetNamespace(), "slice", sliceCopy.GetName())
+	for _, sliceUser := range sliceCopy.Spec.Users {
+		user, err := edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(sliceUser.Authority)).Get(sliceUser.Username, metav1.GetOptions{})
+		if err == nil && user.Status.Active && user.Status.AUP {
+			registration.CreateRoleBindingsByRoles(user.DeepCopy(), sliceChildNamespaceStr, "Slice", clientset)
+		}
+	}
+	err := forEachUser(edgenetClientset, namespace.AuthorityName(authorityName), func(userRow *apps_v1alpha.User) {
+		if userRow.Status.Active && userRow.Status.AUP && (containsRole(userRow.Spec.Roles, "admin") || containsRole(userRow.Spec.Roles, "manager")) {
+			registration.CreateRoleBindingsByRoles(userRow.DeepCopy(), sliceChildNamespaceStr, "Slice", clientset)
+		}
+	})
+	if err != nil {
+		log.Infof("Couldn't list the users of authority %s to restore slice %s: %s", authorityName, sliceCopy.GetName(), err)
+	}
+}
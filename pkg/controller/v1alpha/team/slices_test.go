@@ -0,0 +1,87 @@
+package team
+
+import (
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/registration"
+	"edgenet/pkg/suspension"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestToggleTeamSuspendsSlices(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	authorityNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels: map[string]string{"owner": "authority", "owner-name": "edgenet", "authority-name": "edgenet"}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Roles: []string{"User"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	manager := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "janedoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Roles: []string{"Manager"}},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "johndoe"}}},
+		Status: apps_v1alpha.TeamStatus{Enabled: true}}
+	teamChildNamespaceStr := namespace.ChildName(team.GetNamespace(), "team", team.GetName())
+	slice := &apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "exp", Namespace: teamChildNamespaceStr},
+		Spec: apps_v1alpha.SliceSpec{Profile: "Low", Users: []apps_v1alpha.SliceUsers{{Authority: "edgenet", Username: "johndoe"}}}}
+	// The slice that an operator has suspended stays suspended when the team is enabled again
+	paused := &apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "paused", Namespace: teamChildNamespaceStr,
+		Annotations: map[string]string{suspension.Annotation: "true"}}}
+	sliceChildNamespaceStr := namespace.ChildName(teamChildNamespaceStr, "slice", "exp")
+	sliceRoleBinding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "edgenet-johndoe-slice-user", Namespace: sliceChildNamespaceStr}}
+	registration.SetManagedLabels(sliceRoleBinding, "slice")
+	// The role binding that an operator created in the slice namespace is none of the controllers' business
+	operatorRoleBinding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "monitoring", Namespace: sliceChildNamespaceStr}}
+	clientset := testclient.NewSimpleClientset(authorityNamespace, newChildNamespace(team, "edgenet"), sliceRoleBinding, operatorRoleBinding)
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, user, manager, team, slice, paused)
+	handler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+	if err := handler.reconcile(team.DeepCopy()); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	team, _ = edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("demo", metav1.GetOptions{})
+
+	team.Status.Enabled = false
+	if err := handler.reconcile(team.DeepCopy()); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	for _, name := range []string{"exp", "paused"} {
+		sliceSuspended, err := edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("slice %s deleted on disabling: %s", name, err)
+		}
+		if sliceSuspended.GetAnnotations()[SuspendedAnnotation] != "true" {
+			t.Errorf("slice %s not marked as suspended: %v", name, sliceSuspended.GetAnnotations())
+		}
+	}
+	if roleBindings, _ := clientset.RbacV1().RoleBindings(sliceChildNamespaceStr).List(metav1.ListOptions{}); len(roleBindings.Items) != 1 || roleBindings.Items[0].GetName() != "monitoring" {
+		t.Errorf("expected the role binding of the operator alone in the suspended slice, got %v", roleBindings.Items)
+	}
+	// Reconciling the disabled team again leaves the slices suspended
+	if err := handler.reconcile(team.DeepCopy()); err != nil {
+		t.Fatalf("second reconcile failed: %s", err)
+	}
+
+	team.Status.Enabled = true
+	if err := handler.reconcile(team.DeepCopy()); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+	sliceRestored, _ := edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).Get("exp", metav1.GetOptions{})
+	if _, suspended := sliceRestored.GetAnnotations()[SuspendedAnnotation]; suspended {
+		t.Errorf("slice still marked as suspended: %v", sliceRestored.GetAnnotations())
+	}
+	if roleBindings, _ := clientset.RbacV1().RoleBindings(sliceChildNamespaceStr).List(metav1.ListOptions{}); len(roleBindings.Items) != 3 {
+		t.Errorf("expected the role bindings of the user, the manager, and the operator in the restored slice, got %d", len(roleBindings.Items))
+	}
+	pausedRestored, _ := edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).Get("paused", metav1.GetOptions{})
+	if !suspension.IsSuspended(pausedRestored) {
+		t.Errorf("slice suspended by an operator resumed: %v", pausedRestored.GetAnnotations())
+	}
+}
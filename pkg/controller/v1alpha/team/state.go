@@ -0,0 +1,158 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package team
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// maxRecentErrors bounds the number of errors that the state keeps
+const maxRecentErrors = 50
+
+// State is a snapshot of what the controller is doing, it carries the keys of the teams, the times, and the
+// error messages only, never the objects themselves, so that nothing secret leaks through the debug endpoint
+type State struct {
+	Queued         []QueuedKey          `json:"queued"`
+	LastReconciled map[string]time.Time `json:"lastReconciled"`
+	RecentErrors   []ReconcileError     `json:"recentErrors"`
+}
+
+// QueuedKey is a team waiting in the queue, since the time given
+type QueuedKey struct {
+	Key   string    `json:"key"`
+	Since time.Time `json:"since"`
+}
+
+// ReconcileError is a failure in processing a team
+type ReconcileError struct {
+	Key   string    `json:"key"`
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// reconcileState records the instrumentation of processNextItem
+type reconcileState struct {
+	mutex          sync.Mutex
+	queued         map[string]time.Time
+	lastReconciled map[string]time.Time
+	recentErrors   []ReconcileError
+}
+
+func newReconcileState() *reconcileState {
+	return &reconcileState{queued: map[string]time.Time{}, lastReconciled: map[string]time.Time{}}
+}
+
+// state is shared by the controller of the process and the debug endpoint
+var state = newReconcileState()
+
+// DebugState returns the keys in the queue of the team controller, the last time each team has been reconciled,
+// and the recent errors
+func DebugState() State {
+	return state.snapshot()
+}
+
+func (s *reconcileState) enqueued(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// The key keeps its place in the queue when added again
+	if _, exists := s.queued[key]; !exists {
+		s.queued[key] = time.Now()
+	}
+}
+
+func (s *reconcileState) dequeued(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.queued, key)
+}
+
+// reconciled records the outcome of processing the team, the team that is gone is forgotten
+func (s *reconcileState) reconciled(key string, exists bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	if exists {
+		s.lastReconciled[key] = now
+	} else {
+		delete(s.lastReconciled, key)
+	}
+	if err != nil {
+		s.recentErrors = append(s.recentErrors, ReconcileError{Key: key, Time: now, Error: err.Error()})
+		if len(s.recentErrors) > maxRecentErrors {
+			s.recentErrors = s.recentErrors[len(s.recentErrors)-maxRecentErrors:]
+		}
+	}
+}
+
+func (s *reconcileState) snapshot() State {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := State{Queued: []QueuedKey{}, LastReconciled: map[string]time.Time{}, RecentErrors: []ReconcileError{}}
+	for key, since := range s.queued {
+		snapshot.Queued = append(snapshot.Queued, QueuedKey{Key: key, Since: since})
+	}
+	sort.Slice(snapshot.Queued, func(i, j int) bool { return snapshot.Queued[i].Since.Before(snapshot.Queued[j].Since) })
+	for key, reconciled := range s.lastReconciled {
+		snapshot.LastReconciled[key] = reconciled
+	}
+	snapshot.RecentErrors = append(snapshot.RecentErrors, s.recentErrors...)
+	return snapshot
+}
+
+// instrumentedQueue records the keys that go in and out of the queue
+type instrumentedQueue struct {
+	workqueue.RateLimitingInterface
+	state *reconcileState
+}
+
+func (q *instrumentedQueue) Add(item interface{}) {
+	q.state.enqueued(queueKey(item))
+	q.RateLimitingInterface.Add(item)
+}
+
+func (q *instrumentedQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.state.enqueued(queueKey(item))
+	q.RateLimitingInterface.AddAfter(item, duration)
+}
+
+func (q *instrumentedQueue) AddRateLimited(item interface{}) {
+	q.state.enqueued(queueKey(item))
+	q.RateLimitingInterface.AddRateLimited(item)
+}
+
+func (q *instrumentedQueue) Get() (interface{}, bool) {
+	item, shutdown := q.RateLimitingInterface.Get()
+	if item != nil {
+		q.state.dequeued(queueKey(item))
+	}
+	return item, shutdown
+}
+
+// queueKey returns the key of the team that the item of the queue stands for
+func queueKey(item interface{}) string {
+	switch typedItem := item.(type) {
+	case informerevent:
+		return typedItem.key
+	case string:
+		return typedItem
+	}
+	return ""
+}
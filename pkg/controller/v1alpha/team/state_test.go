@@ -0,0 +1,99 @@
+package team
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	appsinformer_v1 "edgenet/pkg/client/informers/externalversions/apps/v1alpha"
+
+	log "github.com/Sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// failingHandler fails to process the teams created
+type failingHandler struct{}
+
+func (h *failingHandler) Init() error { return nil }
+
+func (h *failingHandler) ObjectCreated(obj interface{}) error {
+	return fmt.Errorf("namespace quota exceeded")
+}
+
+func (h *failingHandler) ObjectUpdated(obj, updated interface{}) {}
+
+func (h *failingHandler) ObjectDeleted(obj, deleted interface{}) {}
+
+func TestDebugState(t *testing.T) {
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet",
+		Annotations: map[string]string{"token": "s3cr3t"}}}
+	informer := appsinformer_v1.NewTeamInformer(edgenettestclient.NewSimpleClientset(team), metav1.NamespaceAll, 0, cache.Indexers{})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		t.Fatal("cache not synced")
+	}
+	reconcileState := newReconcileState()
+	c := controller{
+		logger:   log.NewEntry(log.New()),
+		informer: informer,
+		queue:    &instrumentedQueue{RateLimitingInterface: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), state: reconcileState},
+		handler:  &failingHandler{},
+		keyLocks: newKeyLocks(),
+		state:    reconcileState,
+	}
+	defer c.queue.ShutDown()
+
+	c.queue.Add(informerevent{key: "authority-edgenet/demo", function: createEvent})
+	snapshot := reconcileState.snapshot()
+	if len(snapshot.Queued) != 1 || snapshot.Queued[0].Key != "authority-edgenet/demo" {
+		t.Errorf("unexpected keys in the queue: %v", snapshot.Queued)
+	}
+	before := time.Now()
+	c.processNextItem()
+	snapshot = reconcileState.snapshot()
+	if reconciled, ok := snapshot.LastReconciled["authority-edgenet/demo"]; !ok || reconciled.Before(before) {
+		t.Errorf("reconcile time not recorded: %v", snapshot.LastReconciled)
+	}
+	if len(snapshot.RecentErrors) != 1 || snapshot.RecentErrors[0].Error != "namespace quota exceeded" {
+		t.Errorf("unexpected recent errors: %v", snapshot.RecentErrors)
+	}
+	// The failed team is back in the queue to be retried
+	if len(snapshot.Queued) != 1 {
+		t.Errorf("failed team not requeued: %v", snapshot.Queued)
+	}
+	// Only the keys, times and errors are exposed, not the objects
+	encoded, _ := json.Marshal(snapshot)
+	if strings.Contains(string(encoded), "s3cr3t") {
+		t.Errorf("object content leaked: %s", encoded)
+	}
+}
+
+func TestRecentErrorsBounded(t *testing.T) {
+	reconcileState := newReconcileState()
+	for i := 0; i < maxRecentErrors+10; i++ {
+		reconcileState.reconciled(fmt.Sprintf("authority-edgenet/team-%d", i), true, fmt.Errorf("error %d", i))
+	}
+	snapshot := reconcileState.snapshot()
+	if len(snapshot.RecentErrors) != maxRecentErrors || snapshot.RecentErrors[0].Error != "error 10" {
+		t.Errorf("recent errors not bounded to the latest: %d, first %v", len(snapshot.RecentErrors), snapshot.RecentErrors[0])
+	}
+	// A team that is gone is forgotten
+	reconcileState.reconciled("authority-edgenet/team-0", false, nil)
+	if _, ok := reconcileState.snapshot().LastReconciled["authority-edgenet/team-0"]; ok {
+		t.Error("deleted team still in the state")
+	}
+	// Nor do the keys out of the queue remain
+	reconcileState.enqueued("authority-edgenet/team-0")
+	reconcileState.dequeued("authority-edgenet/team-0")
+	if _, ok := reconcileState.lastReconciled["authority-edgenet/team-0"]; ok || len(reconcileState.queued) != 0 {
+		t.Errorf("keys kept in the state: %v, %v", reconcileState.queued, reconcileState.lastReconciled)
+	}
+}
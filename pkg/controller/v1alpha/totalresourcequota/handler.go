@@ -25,6 +25,7 @@ import (
 	"edgenet/pkg/authorization"
 	"edgenet/pkg/client/clientset/versioned"
 	"edgenet/pkg/mailer"
+	"edgenet/pkg/namespace"
 
 	log "github.com/Sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
@@ -43,24 +44,34 @@ type HandlerInterface interface {
 
 // Handler implementation
 type Handler struct {
-	clientset        *kubernetes.Clientset
-	edgenetClientset *versioned.Clientset
+	clientset        kubernetes.Interface
+	edgenetClientset versioned.Interface
 	resourceQuota    *corev1.ResourceQuota
 }
 
+// NewHandler returns a handler that uses the clientsets given, such as the ones of another handler
+func NewHandler(clientset kubernetes.Interface, edgenetClientset versioned.Interface) *Handler {
+	return &Handler{clientset: clientset, edgenetClientset: edgenetClientset}
+}
+
 // Init handles any handler initialization
 func (t *Handler) Init() error {
 	log.Info("TotalResourceQuotaHandler.Init")
 	var err error
-	t.clientset, err = authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clientsets may be injected beforehand, such as those that the controllers in a process share
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
-	t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
 	return err
 }
@@ -163,15 +174,15 @@ func (t *Handler) prohibitResourceUsage(TRQCopy *apps_v1alpha.TotalResourceQuota
 		TRQCopy.Status.Message = append(TRQCopy.Status.Message, "Total resource quota disabled")
 	}
 	// Delete all slices of authority
-	err := t.edgenetClientset.AppsV1alpha().Slices(fmt.Sprintf("authority-%s", TRQCopy.GetName())).DeleteCollection(&metav1.DeleteOptions{}, metav1.ListOptions{})
+	err := t.edgenetClientset.AppsV1alpha().Slices(namespace.AuthorityName(TRQCopy.GetName())).DeleteCollection(&metav1.DeleteOptions{}, metav1.ListOptions{})
 	if err != nil {
 		log.Printf("Slice deletion failed in authority %s", TRQCopy.GetName())
 		t.sendEmail("", "", "", "", TRQCopy.GetName(), "", "", "", "slice-collection-deletion-failed")
 	}
-	teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", TRQCopy.GetName())).List(metav1.ListOptions{})
+	teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(namespace.AuthorityName(TRQCopy.GetName())).List(metav1.ListOptions{})
 	if len(teamsRaw.Items) != 0 {
 		for _, teamRow := range teamsRaw.Items {
-			teamChildNamespaceStr := fmt.Sprintf("%s-team-%s", teamRow.GetNamespace(), teamRow.GetName())
+			teamChildNamespaceStr := namespace.ChildName(teamRow.GetNamespace(), "team", teamRow.GetName())
 			err = t.edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).DeleteCollection(&metav1.DeleteOptions{}, metav1.ListOptions{})
 			if err != nil {
 				log.Printf("Slice deletion failed in %s", teamChildNamespaceStr)
@@ -283,10 +294,10 @@ func (t *Handler) calculateTotalQuota(TRQCopy *apps_v1alpha.TotalResourceQuota)
 func (t *Handler) calculateConsumedResources(TRQCopy *apps_v1alpha.TotalResourceQuota) (int64, int64) {
 	var consumedCPU int64
 	var consumedMemory int64
-	slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(fmt.Sprintf("authority-%s", TRQCopy.GetName())).List(metav1.ListOptions{})
+	slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(namespace.AuthorityName(TRQCopy.GetName())).List(metav1.ListOptions{})
 	if len(slicesRaw.Items) != 0 {
 		for _, slicesRow := range slicesRaw.Items {
-			sliceChildNamespaceStr := fmt.Sprintf("%s-slice-%s", slicesRow.GetNamespace(), slicesRow.GetName())
+			sliceChildNamespaceStr := namespace.ChildName(slicesRow.GetNamespace(), "slice", slicesRow.GetName())
 			// Check out the resource quotas in the slice namespace rather than the slice profile
 			resourceQuotasRaw, _ := t.clientset.CoreV1().ResourceQuotas(sliceChildNamespaceStr).List(metav1.ListOptions{})
 			if len(resourceQuotasRaw.Items) != 0 {
@@ -297,14 +308,14 @@ func (t *Handler) calculateConsumedResources(TRQCopy *apps_v1alpha.TotalResource
 			}
 		}
 	}
-	teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", TRQCopy.GetName())).List(metav1.ListOptions{})
+	teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(namespace.AuthorityName(TRQCopy.GetName())).List(metav1.ListOptions{})
 	if len(teamsRaw.Items) != 0 {
 		for _, teamRow := range teamsRaw.Items {
-			teamChildNamespaceStr := fmt.Sprintf("%s-team-%s", teamRow.GetNamespace(), teamRow.GetName())
+			teamChildNamespaceStr := namespace.ChildName(teamRow.GetNamespace(), "team", teamRow.GetName())
 			slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).List(metav1.ListOptions{})
 			if len(slicesRaw.Items) != 0 {
 				for _, slicesRow := range slicesRaw.Items {
-					sliceChildNamespaceStr := fmt.Sprintf("%s-slice-%s", slicesRow.GetNamespace(), slicesRow.GetName())
+					sliceChildNamespaceStr := namespace.ChildName(slicesRow.GetNamespace(), "slice", slicesRow.GetName())
 					resourceQuotasRaw, _ := t.clientset.CoreV1().ResourceQuotas(sliceChildNamespaceStr).List(metav1.ListOptions{})
 					if len(resourceQuotasRaw.Items) != 0 {
 						for _, resourceQuotasRow := range resourceQuotasRaw.Items {
@@ -361,7 +372,7 @@ func (t *Handler) balanceResourceConsumption(TRQCopy *apps_v1alpha.TotalResource
 	var oldestSlice apps_v1alpha.Slice
 	log.Println("balanceResourceConsumption")
 	// Get the oldest slice in the authority namespace
-	slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(fmt.Sprintf("authority-%s", TRQCopy.GetName())).List(metav1.ListOptions{})
+	slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(namespace.AuthorityName(TRQCopy.GetName())).List(metav1.ListOptions{})
 	if len(slicesRaw.Items) != 0 {
 		for i, sliceRow := range slicesRaw.Items {
 			if i == 0 {
@@ -376,10 +387,10 @@ func (t *Handler) balanceResourceConsumption(TRQCopy *apps_v1alpha.TotalResource
 		}
 	}
 	// Get the oldest slice in the team namespaces
-	teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", TRQCopy.GetName())).List(metav1.ListOptions{})
+	teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(namespace.AuthorityName(TRQCopy.GetName())).List(metav1.ListOptions{})
 	if len(teamsRaw.Items) != 0 {
 		for _, teamRow := range teamsRaw.Items {
-			teamChildNamespaceStr := fmt.Sprintf("authority-%s-team-%s", TRQCopy.GetName(), teamRow.GetName())
+			teamChildNamespaceStr := namespace.ChildName(namespace.AuthorityName(TRQCopy.GetName()), "team", teamRow.GetName())
 			slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).List(metav1.ListOptions{})
 			if len(slicesRaw.Items) != 0 {
 				for _, sliceRow := range slicesRaw.Items {
@@ -393,10 +404,10 @@ func (t *Handler) balanceResourceConsumption(TRQCopy *apps_v1alpha.TotalResource
 	}
 	// Delete the oldest slice and send a notification email
 	err := t.edgenetClientset.AppsV1alpha().Slices(oldestSlice.GetNamespace()).Delete(oldestSlice.GetName(), &metav1.DeleteOptions{})
-	sliceChildNamespaceStr := fmt.Sprintf("%s-slice-%s", oldestSlice.GetNamespace(), oldestSlice.GetName())
+	sliceChildNamespaceStr := namespace.ChildName(oldestSlice.GetNamespace(), "slice", oldestSlice.GetName())
 	if err == nil {
 		for _, sliceUser := range oldestSlice.Spec.Users {
-			user, err := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", sliceUser.Authority)).Get(sliceUser.Username, metav1.GetOptions{})
+			user, err := t.edgenetClientset.AppsV1alpha().Users(namespace.AuthorityName(sliceUser.Authority)).Get(sliceUser.Username, metav1.GetOptions{})
 			if err == nil && user.Status.Active && user.Status.AUP {
 				t.sendEmail(sliceUser.Username, fmt.Sprintf("%s %s", user.Spec.FirstName, user.Spec.LastName), user.Spec.Email, sliceUser.Authority,
 					TRQCopy.GetName(), oldestSlice.GetNamespace(), oldestSlice.GetName(), sliceChildNamespaceStr, "slice-total-quota-exceeded")
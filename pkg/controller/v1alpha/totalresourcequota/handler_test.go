@@ -0,0 +1,37 @@
+package totalresourcequota
+
+import (
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestObjectCreated(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	TRQ := &apps_v1alpha.TotalResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Spec: apps_v1alpha.TotalResourceQuotaSpec{Enabled: true,
+			Claim: []apps_v1alpha.TotalResourceDetails{{Name: "Default", CPU: "12000m", Memory: "12Gi"}}}}
+	// A slice consumes a quarter of the quota
+	slice := &apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "exp", Namespace: "authority-edgenet"}}
+	sliceQuota := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "slice-medium-quota", Namespace: "authority-edgenet-slice-exp"},
+		Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse("3000m"), "memory": resource.MustParse("3Gi")}}}
+	handler := NewHandler(testclient.NewSimpleClientset(sliceQuota), edgenettestclient.NewSimpleClientset(authority, TRQ, slice))
+	// Init keeps the clientsets injected
+	handler.Init()
+
+	handler.ObjectCreated(TRQ)
+	TRQUpdated, err := handler.edgenetClientset.AppsV1alpha().TotalResourceQuotas().Get("edgenet", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("total resource quota removed: %s", err)
+	}
+	if TRQUpdated.Status.State != success || TRQUpdated.Status.Exceeded || TRQUpdated.Status.Used.CPU != 25 || TRQUpdated.Status.Used.Memory != 25 {
+		t.Errorf("unexpected total resource quota status: %+v", TRQUpdated.Status)
+	}
+}
@@ -26,12 +26,16 @@ import (
 
 	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
+	"edgenet/pkg/client/clientset/versioned"
 	appsinformer_v1 "edgenet/pkg/client/informers/externalversions/apps/v1alpha"
+	"edgenet/pkg/config"
+	"edgenet/pkg/controller/loop"
 
 	log "github.com/Sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
@@ -41,7 +45,9 @@ type controller struct {
 	logger   *log.Entry
 	queue    workqueue.RateLimitingInterface
 	informer cache.SharedIndexInformer
-	handler  HandlerInterface
+	// The informers of the teams, slices, and role bindings that the handler looks up those of a user in
+	listers []cache.SharedIndexInformer
+	handler HandlerInterface
 }
 
 // The main structure of informerevent
@@ -51,12 +57,18 @@ type informerevent struct {
 	updated  fields
 }
 
-// This contains the fields to check whether they are updated
+// This contains the fields to check whether they are updated, and those of the object to be used after it is gone
 type fields struct {
 	active bool
 	aup    bool
 	roles  bool
 	email  bool
+	object objectData
+}
+
+type objectData struct {
+	name      string
+	namespace string
 }
 
 // Constant variables for events
@@ -67,14 +79,49 @@ const failure = "Failure"
 const success = "Successful"
 
 // Start function is entry point of the controller
-func Start() {
+func Start(settings *config.Config) {
+	if err := loop.Configure(settings); err != nil {
+		log.Fatal(err.Error())
+	}
+	clientset, err := authorization.CreateClientSet()
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
 	edgenetClientset, err := authorization.CreateEdgeNetClientSet()
 	if err != nil {
 		log.Println(err.Error())
 		panic(err.Error())
 	}
+	if err := authorization.EnsureCRDs(edgenetClientset.Discovery(), apps_v1alpha.SchemeGroupVersion.WithResource("users")); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	// Run the controller loop as a background task to start processing resources
+	go Run(clientset, edgenetClientset, settings, stopCh)
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+}
 
-	userHandler := &Handler{}
+// Run creates the controller with the clientsets given and runs it until the stop channel closes,
+// which allows the controller to share the clientsets and the process with other controllers
+func Run(clientset kubernetes.Interface, edgenetClientset versioned.Interface, _ *config.Config, stopCh <-chan struct{}) {
+	newController(clientset, edgenetClientset).run(stopCh)
+}
+
+// newController creates the controller along with its handler, both of which use the clientsets given
+func newController(clientset kubernetes.Interface, edgenetClientset versioned.Interface) *controller {
+	var err error
+	teamInformer := newTeamInformer(edgenetClientset)
+	sliceInformer := newSliceInformer(edgenetClientset)
+	roleBindingInformer := newRoleBindingInformer(clientset)
+	userHandler := &Handler{clientset: clientset, edgenetClientset: edgenetClientset, teams: teamInformer.GetIndexer(), slices: sliceInformer.GetIndexer(), roleBindings: roleBindingInformer.GetIndexer()}
 	// Create the user informer which was generated by the code generator to list and watch user resources
 	informer := appsinformer_v1.NewUserInformer(
 		edgenetClientset,
@@ -127,6 +174,8 @@ func Start() {
 			// Put the resource object into a key
 			event.key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 			event.function = delete
+			userNamespace, userName, _ := cache.SplitMetaNamespaceKey(event.key)
+			event.updated.object = objectData{name: userName, namespace: userNamespace}
 			log.Infof("Delete user: %s", event.key)
 			if err == nil {
 				queue.Add(event)
@@ -136,20 +185,12 @@ func Start() {
 	controller := controller{
 		logger:   log.NewEntry(log.New()),
 		informer: informer,
+		listers:  []cache.SharedIndexInformer{teamInformer, sliceInformer, roleBindingInformer},
 		queue:    queue,
 		handler:  userHandler,
 	}
 
-	// A channel to terminate elegantly
-	stopCh := make(chan struct{})
-	defer close(stopCh)
-	// Run the controller loop as a background task to start processing resources
-	go controller.run(stopCh)
-	// A channel to observe OS signals for smooth shut down
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, syscall.SIGTERM)
-	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
+	return &controller
 }
 
 // Run starts the controller loop
@@ -162,9 +203,14 @@ func (c *controller) run(stopCh <-chan struct{}) {
 	c.handler.Init()
 	// Run the informer to list and watch resources
 	go c.informer.Run(stopCh)
+	cacheSyncs := []cache.InformerSynced{c.informer.HasSynced}
+	for _, lister := range c.listers {
+		go lister.Run(stopCh)
+		cacheSyncs = append(cacheSyncs, lister.HasSynced)
+	}
 
-	// Synchronization to settle resources one
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+	// Synchronization to settle resources one, the process exits to be restarted if the API server is unreachable
+	if !loop.WaitForCacheSync(c.logger, stopCh, cacheSyncs...) {
 		utilruntime.HandleError(fmt.Errorf("Error syncing cache"))
 		return
 	}
@@ -187,7 +233,7 @@ func (c *controller) runWorker() {
 }
 
 // This function deals with the queue and sends each item in it to the specified handler to be processed.
-func (c *controller) processNextItem() bool {
+func (c *controller) processNextItem() (processed bool) {
 	log.Info("processNextItem: start")
 	// Fetch the next item of the queue
 	event, quit := c.queue.Get()
@@ -197,6 +243,15 @@ func (c *controller) processNextItem() bool {
 	defer c.queue.Done(event)
 	// Get the key string
 	keyRaw := event.(informerevent).key
+	// A panic of the handler fails the item rather than the worker, which goes on with the next one
+	defer loop.Recover(c.logger, "user", keyRaw, func(err error) {
+		if c.queue.NumRequeues(event) < 5 {
+			c.queue.AddRateLimited(event)
+		} else {
+			c.queue.Forget(event)
+		}
+		processed = true
+	})
 	// Use the string key to get the object from the indexer
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	if err != nil {
@@ -213,7 +268,7 @@ func (c *controller) processNextItem() bool {
 	if !exists {
 		if event.(informerevent).function == delete {
 			c.logger.Infof("Controller.processNextItem: object deleted detected: %s", keyRaw)
-			c.handler.ObjectDeleted(item)
+			c.handler.ObjectDeleted(item, event.(informerevent).updated)
 		}
 	} else {
 		if event.(informerevent).function == create {
@@ -20,13 +20,16 @@ import (
 	"fmt"
 	"math/rand"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
 	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/controller/v1alpha/team"
 	"edgenet/pkg/mailer"
+	"edgenet/pkg/namespace"
 	"edgenet/pkg/registration"
 
 	log "github.com/Sirupsen/logrus"
@@ -34,6 +37,8 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
 )
 
 // HandlerInterface interface contains the methods that are required
@@ -41,28 +46,41 @@ type HandlerInterface interface {
 	Init() error
 	ObjectCreated(obj interface{})
 	ObjectUpdated(obj, updated interface{})
-	ObjectDeleted(obj interface{})
+	ObjectDeleted(obj, deleted interface{})
 }
 
+// EmailVerifiedAnnotation marks the users whose email address has been verified before they were created, such as
+// those of the registration requests, the other users get activated once they verify their email address
+const EmailVerifiedAnnotation = "edge-net.io/email-verified"
+
 // Handler implementation
 type Handler struct {
-	clientset        *kubernetes.Clientset
-	edgenetClientset *versioned.Clientset
+	clientset        kubernetes.Interface
+	edgenetClientset versioned.Interface
+	// The indexers of the informers that the handler looks up the teams, slices, and role bindings of a user in
+	teams        cache.Indexer
+	slices       cache.Indexer
+	roleBindings cache.Indexer
 }
 
 // Init handles any handler initialization
 func (t *Handler) Init() error {
 	log.Info("UserHandler.Init")
 	var err error
-	t.clientset, err = authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clientsets may be injected beforehand, such as those that the controllers in a process share
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
-	t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
 	return err
 }
@@ -136,9 +154,9 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 					}
 				}
 			}
-			// Activate user
+			// Activate the user, or the email verification does once the user verifies the email address
 			defer t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).UpdateStatus(userCopy)
-			userCopy.Status.Active = true
+			userCopy.Status.Active = t.verifyNewUser(userCopy, userOwnerNamespace.Labels["authority-name"])
 			// Create the main service account for permanent use
 			// In next versions, there will be a method to renew the token of this service account for security
 			_, err = registration.CreateServiceAccount(userCopy, "main")
@@ -159,8 +177,22 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 					case <-time.Tick(30 * time.Second):
 						serviceAccount, _ := t.clientset.CoreV1().ServiceAccounts(userCopy.GetNamespace()).Get(userCopy.GetName(), metav1.GetOptions{})
 						if len(serviceAccount.Secrets) > 0 {
-							// Create kubeconfig file according to the web service account
-							registration.CreateConfig(serviceAccount)
+							// Create kubeconfig file with a client certificate signed by the cluster CA for the request of the
+							// user, or with the token of the service account if the user hasn't made one or it cannot be issued
+							issued := false
+							if csrPEM := userCopy.GetAnnotations()[registration.CertificateRequestAnnotation]; csrPEM != "" {
+								caCert, err := registration.ServiceAccountCA(t.clientset, serviceAccount)
+								if err == nil {
+									_, err = registration.CreateCertificateConfig(t.clientset, userCopy, []byte(csrPEM), caCert)
+								}
+								if err != nil {
+									log.Printf("Certificate of user %s in %s not issued: %s", userCopy.GetName(), userCopy.GetNamespace(), err)
+								}
+								issued = err == nil
+							}
+							if !issued {
+								registration.CreateConfig(serviceAccount)
+							}
 							t.sendEmail(userCopy, userOwnerNamespace.Labels["authority-name"], "", "user-registration-successful")
 							break checkTokenTimer
 						}
@@ -219,18 +251,16 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 				log.Infof("Couldn't deactivate user %s in %s: %s", userCopy.GetName(), userCopy.GetNamespace(), err)
 				t.sendEmail(userCopy, userOwnerNamespace.Labels["authority-name"], "", "user-deactivation-failure")
 			}
-			t.setEmailVerification(userCopy, userOwnerNamespace.Labels["authority-name"])
+			t.setEmailVerification(userCopy, userOwnerNamespace.Labels["authority-name"], "user-email-verification-update")
 		}
 
 		if userCopy.Status.Active && userCopy.Status.AUP {
 			// To manipulate role bindings according to the changes
 			if fieldUpdated.active || fieldUpdated.aup || fieldUpdated.roles {
-				slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(userCopy.GetNamespace()).List(metav1.ListOptions{})
-				teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(userCopy.GetNamespace()).List(metav1.ListOptions{})
 				if fieldUpdated.roles {
-					t.deleteRoleBindings(userCopy, slicesRaw, teamsRaw)
+					t.deleteStaleRoleBindings(userCopy)
 				}
-				t.createRoleBindings(userCopy, slicesRaw, teamsRaw, userOwnerAuthority.GetName())
+				t.createRoleBindings(userCopy, userOwnerAuthority.GetName())
 				if fieldUpdated.active {
 					t.createAUPRoleBinding(userCopy)
 				}
@@ -238,9 +268,7 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 		} else if !userCopy.Status.Active || !userCopy.Status.AUP {
 			// To manipulate role bindings according to the changes
 			if (userCopy.Status.Active == false && fieldUpdated.active) || (userCopy.Status.AUP == false && fieldUpdated.aup) {
-				slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(userCopy.GetNamespace()).List(metav1.ListOptions{})
-				teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(userCopy.GetNamespace()).List(metav1.ListOptions{})
-				t.deleteRoleBindings(userCopy, slicesRaw, teamsRaw)
+				t.deleteRoleBindings(userCopy)
 			}
 			// To create AUP role binding for the user
 			if userCopy.Status.Active && fieldUpdated.active {
@@ -253,14 +281,69 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 	}
 }
 
-// ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+// ObjectDeleted is called when an object is deleted, the access of the user is revoked right away rather than waiting for
+// the garbage collector to remove the role bindings that the user owns
+func (t *Handler) ObjectDeleted(obj, deleted interface{}) {
 	log.Info("UserHandler.ObjectDeleted")
 	// Mail notification, TBD
+	fieldDeleted := deleted.(fields)
+	userCopy := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: fieldDeleted.object.name, Namespace: fieldDeleted.object.namespace}}
+	// The authority namespace may be gone along with the authority, in which case its name tells the authority
+	ownerAuthority, _ := namespace.AuthorityOf(userCopy.GetNamespace())
+	if userOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(userCopy.GetNamespace(), metav1.GetOptions{}); err == nil {
+		ownerAuthority = userOwnerNamespace.Labels["authority-name"]
+	}
+	t.removeFromTeams(userCopy, ownerAuthority)
+	// The user is no more active, so its AUP role binding goes as well
+	t.deleteRoleBindings(userCopy)
+}
+
+// removeFromTeams removes the user from the teams of all authorities in which the user participates
+func (t *Handler) removeFromTeams(userCopy *apps_v1alpha.User, ownerAuthority string) {
+	teams, err := team.IndexedTeamsForUser(t.teams, ownerAuthority, userCopy.GetName())
+	if err != nil {
+		log.Infof("Couldn't find the teams to remove user %s in %s: %s", userCopy.GetName(), userCopy.GetNamespace(), err)
+		return
+	}
+	for _, teamRow := range teams {
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			teamUsers := []apps_v1alpha.TeamUsers{}
+			for _, teamUser := range teamRow.Spec.Users {
+				if normalized := team.NormalizeUser(teamUser); normalized.Authority != ownerAuthority || normalized.Username != userCopy.GetName() {
+					teamUsers = append(teamUsers, teamUser)
+				}
+			}
+			if len(teamUsers) == len(teamRow.Spec.Users) {
+				return nil
+			}
+			teamRow.Spec.Users = teamUsers
+			_, err := t.edgenetClientset.AppsV1alpha().Teams(teamRow.GetNamespace()).Update(&teamRow)
+			if errors.IsConflict(err) {
+				if teamLatest, getErr := t.edgenetClientset.AppsV1alpha().Teams(teamRow.GetNamespace()).Get(teamRow.GetName(), metav1.GetOptions{}); getErr == nil {
+					teamRow = *teamLatest
+				}
+			}
+			return err
+		})
+		if err != nil {
+			log.Infof("Couldn't remove user %s in %s from team %s in %s: %s", userCopy.GetName(), userCopy.GetNamespace(), teamRow.GetName(), teamRow.GetNamespace(), err)
+		}
+	}
 }
 
-// setEmailVerification to provide one-time code for verification
-func (t *Handler) setEmailVerification(userCopy *apps_v1alpha.User, authorityName string) {
+// verifyNewUser returns whether the new user has already verified the email address, otherwise it sends the user
+// the code to verify it
+func (t *Handler) verifyNewUser(userCopy *apps_v1alpha.User, authorityName string) bool {
+	if verified, _ := strconv.ParseBool(userCopy.GetAnnotations()[EmailVerifiedAnnotation]); verified {
+		return true
+	}
+	t.setEmailVerification(userCopy, authorityName, "user-email-verification")
+	return false
+}
+
+// setEmailVerification to provide one-time code for verification, the subject tells whether the user is new or has
+// changed the email address
+func (t *Handler) setEmailVerification(userCopy *apps_v1alpha.User, authorityName, subject string) {
 	// The section below is a part of the method which provides email verification
 	// Email verification code is a security point for email verification. The user
 	// object creates an email verification object with a name which is
@@ -274,85 +357,88 @@ func (t *Handler) setEmailVerification(userCopy *apps_v1alpha.User, authorityNam
 	emailVerification.Spec.Identifier = userCopy.GetName()
 	_, err := t.edgenetClientset.AppsV1alpha().EmailVerifications(userCopy.GetNamespace()).Create(emailVerification.DeepCopy())
 	if err == nil {
-		t.sendEmail(userCopy, authorityName, emailVerificationCode, "user-email-verification-update")
+		t.sendEmail(userCopy, authorityName, emailVerificationCode, subject)
 	} else {
-		t.sendEmail(userCopy, authorityName, "", "user-email-verification-update-malfunction")
+		t.sendEmail(userCopy, authorityName, "", fmt.Sprintf("%s-malfunction", subject))
 	}
 }
 
-// createRoleBindings creates user role bindings according to the roles
-func (t *Handler) createRoleBindings(userCopy *apps_v1alpha.User, slicesRaw *apps_v1alpha.SliceList, teamsRaw *apps_v1alpha.TeamList, ownerAuthority string) {
+// createRoleBindings creates user role bindings according to the roles in the teams and slices of all authorities
+// in which the user participates, and in those of its authority if the user is an authority-admin or a manager
+func (t *Handler) createRoleBindings(userCopy *apps_v1alpha.User, ownerAuthority string) {
 	// Create role bindings independent of user roles
-	registration.CreateSpecificRoleBindings(userCopy)
-	// This part creates the rolebindings one by one in different namespaces
-	createLoop := func(slicesRaw *apps_v1alpha.SliceList, namespacePrefix string) {
-		for _, sliceRow := range slicesRaw.Items {
-			for _, sliceUser := range sliceRow.Spec.Users {
-				// If the user participates in the slice or it is an Authority-admin or a Manager of the owner authority
-				if (sliceUser.Authority == ownerAuthority && sliceUser.Username == userCopy.GetName()) ||
-					(userCopy.GetNamespace() == sliceRow.GetNamespace() && (containsRole(userCopy.Spec.Roles, "admin") || containsRole(userCopy.Spec.Roles, "manager"))) {
-					registration.CreateRoleBindingsByRoles(userCopy, fmt.Sprintf("%s-slice-%s", namespacePrefix, sliceRow.GetName()), "Slice")
-				}
-			}
+	registration.CreateSpecificRoleBindings(userCopy, t.clientset)
+	// Create the rolebindings in the authority namespace
+	registration.CreateRoleBindingsByRoles(userCopy, userCopy.GetNamespace(), "Authority", t.clientset)
+	authorityManager := containsRole(userCopy.Spec.Roles, "admin") || containsRole(userCopy.Spec.Roles, "manager")
+	// The teams of all authorities in which the user participates, a user may participate in the teams of other authorities
+	teamNamespaces := map[string]bool{}
+	teams, _ := team.IndexedTeamsForUser(t.teams, ownerAuthority, userCopy.GetName())
+	for _, teamRow := range teams {
+		teamNamespaces[namespace.ChildName(teamRow.GetNamespace(), "team", teamRow.GetName())] = true
+	}
+	// An Authority-admin or a Manager of the owner authority gets access to all teams of the authority
+	if authorityManager {
+		for _, teamRow := range indexedTeams(t.teams, cache.NamespaceIndex, userCopy.GetNamespace()) {
+			teamNamespaces[namespace.ChildName(teamRow.GetNamespace(), "team", teamRow.GetName())] = true
 		}
 	}
-	// Create the rolebindings in the authority namespace
-	registration.CreateRoleBindingsByRoles(userCopy, userCopy.GetNamespace(), "Authority")
-	createLoop(slicesRaw, userCopy.GetNamespace())
-	// List the teams in the authority namespace
-	for _, teamRow := range teamsRaw.Items {
-		for _, teamUser := range teamRow.Spec.Users {
-			// If the user participates in the team or it is an Authority-admin or a Manager of the owner authority
-			if (teamUser.Authority == ownerAuthority && teamUser.Username == userCopy.GetName()) ||
-				(userCopy.GetNamespace() == teamRow.GetNamespace() && (containsRole(userCopy.Spec.Roles, "admin") || containsRole(userCopy.Spec.Roles, "manager"))) {
-				registration.CreateRoleBindingsByRoles(userCopy, fmt.Sprintf("%s-team-%s", userCopy.GetNamespace(), teamRow.GetName()), "Team")
+	for teamNamespace := range teamNamespaces {
+		registration.CreateRoleBindingsByRoles(userCopy, teamNamespace, "Team", t.clientset)
+	}
+	// The slices of all authorities in which the user participates, both in the authority namespaces and team namespaces
+	sliceNamespaces := map[string]bool{}
+	for _, sliceRow := range indexedSlices(t.slices, sliceUserIndex, fmt.Sprintf("%s/%s", ownerAuthority, userCopy.GetName())) {
+		sliceNamespaces[namespace.ChildName(sliceRow.GetNamespace(), "slice", sliceRow.GetName())] = true
+	}
+	if authorityManager {
+		// The namespace labels tell the namespaces of the authority, team namespaces don't have a common prefix as
+		// long names get truncated
+		namespacesRaw, _ := t.clientset.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: fmt.Sprintf("authority-name=%s", ownerAuthority)})
+		for _, namespaceRow := range namespacesRaw.Items {
+			for _, sliceRow := range indexedSlices(t.slices, cache.NamespaceIndex, namespaceRow.GetName()) {
+				sliceNamespaces[namespace.ChildName(sliceRow.GetNamespace(), "slice", sliceRow.GetName())] = true
 			}
 		}
-		// List the slices in the team namespace
-		teamSlicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(fmt.Sprintf("%s-team-%s", userCopy.GetNamespace(), teamRow.GetName())).List(metav1.ListOptions{})
-		createLoop(teamSlicesRaw, fmt.Sprintf("%s-team-%s", userCopy.GetNamespace(), teamRow.GetName()))
+	}
+	for sliceNamespace := range sliceNamespaces {
+		registration.CreateRoleBindingsByRoles(userCopy, sliceNamespace, "Slice", t.clientset)
 	}
 }
 
-// deleteRoleBindings removes user role bindings in the namespaces related
-func (t *Handler) deleteRoleBindings(userCopy *apps_v1alpha.User, slicesRaw *apps_v1alpha.SliceList, teamsRaw *apps_v1alpha.TeamList) {
+// deleteRoleBindings removes user role bindings in all namespaces, so that the user loses access to the teams and
+// slices of other authorities as well
+func (t *Handler) deleteRoleBindings(userCopy *apps_v1alpha.User) {
 	// To delete the cluster role binding which allows user to get the authority object
 	t.clientset.RbacV1().ClusterRoleBindings().Delete(fmt.Sprintf("%s-%s-for-authority", userCopy.GetNamespace(), userCopy.GetName()), &metav1.DeleteOptions{})
-	// This part deletes the rolebindings one by one
-	deletionLoop := func(roleBindings *rbacv1.RoleBindingList) {
-		for _, roleBindingRow := range roleBindings.Items {
-			for _, roleBindingSubject := range roleBindingRow.Subjects {
-				if roleBindingSubject.Kind == "ServiceAccount" && (roleBindingSubject.Name == userCopy.GetName()) &&
-					roleBindingSubject.Namespace == userCopy.GetNamespace() {
-					t.clientset.RbacV1().RoleBindings(roleBindingRow.GetNamespace()).Delete(roleBindingRow.GetName(), &metav1.DeleteOptions{})
-					break
-				}
-			}
-		}
-	}
 	// Unless the user gets deactivated it has access to edit the AUP
-	roleBindingListOptions := metav1.ListOptions{}
-	if userCopy.Status.Active {
-		roleBindingListOptions = metav1.ListOptions{FieldSelector: fmt.Sprintf("metadata.name!=%s-user-aup-%s", userCopy.GetNamespace(), userCopy.GetName())}
-	}
-	// List the rolebindings in the authority namespace
-	roleBindings, _ := t.clientset.RbacV1().RoleBindings(userCopy.GetNamespace()).List(roleBindingListOptions)
-	deletionLoop(roleBindings)
-	// List the rolebindings in the slice namespaces which directly created by slices in the authority namespace
-	for _, sliceRow := range slicesRaw.Items {
-		roleBindings, _ := t.clientset.RbacV1().RoleBindings(fmt.Sprintf("%s-slice-%s", userCopy.GetNamespace(), sliceRow.GetName())).List(metav1.ListOptions{})
-		deletionLoop(roleBindings)
+	AUPRoleBindingName := fmt.Sprintf("%s-user-aup-%s", userCopy.GetNamespace(), userCopy.GetName())
+	for _, roleBindingRow := range userRoleBindings(t.roleBindings, userCopy) {
+		if userCopy.Status.Active && roleBindingRow.GetNamespace() == userCopy.GetNamespace() && roleBindingRow.GetName() == AUPRoleBindingName {
+			continue
+		}
+		t.clientset.RbacV1().RoleBindings(roleBindingRow.GetNamespace()).Delete(roleBindingRow.GetName(), &metav1.DeleteOptions{})
 	}
-	for _, teamRow := range teamsRaw.Items {
-		// List the rolebindings in the team namespace
-		roleBindings, _ := t.clientset.RbacV1().RoleBindings(teamRow.GetNamespace()).List(metav1.ListOptions{})
-		deletionLoop(roleBindings)
-		// List the rolebindings in the slice namespaces which created by slices in the team namespace
-		teamSlicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(fmt.Sprintf("%s-team-%s", userCopy.GetNamespace(), teamRow.GetName())).List(metav1.ListOptions{})
-		for _, teamSliceRow := range teamSlicesRaw.Items {
-			roleBindings, _ := t.clientset.RbacV1().RoleBindings(fmt.Sprintf("%s-team-%s-slice-%s", userCopy.GetNamespace(), teamRow.GetName(), teamSliceRow.GetName())).List(metav1.ListOptions{})
-			deletionLoop(roleBindings)
+}
+
+// deleteStaleRoleBindings removes the role bindings of the user in all namespaces that stand for the roles the user
+// no longer holds, the role bindings of the roles the user still holds are kept
+func (t *Handler) deleteStaleRoleBindings(userCopy *apps_v1alpha.User) {
+	prefix := fmt.Sprintf("%s-%s-", userCopy.GetNamespace(), userCopy.GetName())
+	for _, roleBindingRow := range userRoleBindings(t.roleBindings, userCopy) {
+		if !strings.HasPrefix(roleBindingRow.GetName(), prefix) {
+			continue
+		}
+		// The role bindings by roles are named after the type of the namespace and the role
+		roleName := strings.TrimPrefix(roleBindingRow.GetName(), prefix)
+		namespaceType := strings.SplitN(roleName, "-", 2)[0]
+		if namespaceType != "authority" && namespaceType != "team" && namespaceType != "slice" {
+			continue
+		}
+		if containsRole(userCopy.Spec.Roles, strings.TrimPrefix(roleName, namespaceType+"-")) {
+			continue
 		}
+		t.clientset.RbacV1().RoleBindings(roleBindingRow.GetNamespace()).Delete(roleBindingRow.GetName(), &metav1.DeleteOptions{})
 	}
 }
 
@@ -364,7 +450,7 @@ func (t *Handler) createAUPRoleBinding(userCopy *apps_v1alpha.User) {
 		// roleName to get user-specific AUP role which allows user to only get the AUP object related to itself
 		roleName := fmt.Sprintf("user-aup-%s", userCopy.GetName())
 		roleRef := rbacv1.RoleRef{Kind: "Role", Name: roleName}
-		rbSubjects := []rbacv1.Subject{{Kind: "ServiceAccount", Name: userCopy.GetName(), Namespace: userCopy.GetNamespace()}}
+		rbSubjects := registration.UserSubjects(userCopy.GetNamespace(), userCopy.GetName())
 		roleBind := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: userCopy.GetNamespace(), Name: fmt.Sprintf("%s-%s", userCopy.GetNamespace(), roleName)},
 			Subjects: rbSubjects, RoleRef: roleRef}
 		// When a user is deleted, the owner references feature allows the related role binding to be automatically removed
@@ -386,7 +472,7 @@ func (t *Handler) sendEmail(userCopy *apps_v1alpha.User, authorityName, emailVer
 	collective.CommonData.Username = userCopy.GetName()
 	collective.CommonData.Name = fmt.Sprintf("%s %s", userCopy.Spec.FirstName, userCopy.Spec.LastName)
 	collective.CommonData.Email = []string{userCopy.Spec.Email}
-	if subject == "user-email-verification-update" {
+	if subject == "user-email-verification" || subject == "user-email-verification-update" {
 		verifyContent := mailer.VerifyContentData{}
 		verifyContent.Code = emailVerificationCode
 		verifyContent.CommonData = collective.CommonData
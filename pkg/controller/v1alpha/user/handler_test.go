@@ -0,0 +1,239 @@
+package user
+
+import (
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	"edgenet/pkg/mailer"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestHandler returns a handler whose indexers hold the teams, slices, and role bindings of the clientsets, sync
+// brings them up to date with the clientsets as the informers do after the handler writes
+func newTestHandler(clientset *testclient.Clientset, edgenetClientset *edgenettestclient.Clientset) (*Handler, func()) {
+	handler := &Handler{
+		clientset:        clientset,
+		edgenetClientset: edgenetClientset,
+		teams:            newTeamInformer(edgenetClientset).GetIndexer(),
+		slices:           newSliceInformer(edgenetClientset).GetIndexer(),
+		roleBindings:     newRoleBindingInformer(clientset).GetIndexer(),
+	}
+	sync := func() {
+		teams := []interface{}{}
+		teamsRaw, _ := edgenetClientset.AppsV1alpha().Teams("").List(metav1.ListOptions{})
+		for i := range teamsRaw.Items {
+			teams = append(teams, &teamsRaw.Items[i])
+		}
+		handler.teams.Replace(teams, "")
+		slices := []interface{}{}
+		slicesRaw, _ := edgenetClientset.AppsV1alpha().Slices("").List(metav1.ListOptions{})
+		for i := range slicesRaw.Items {
+			slices = append(slices, &slicesRaw.Items[i])
+		}
+		handler.slices.Replace(slices, "")
+		roleBindings := []interface{}{}
+		roleBindingsRaw, _ := clientset.RbacV1().RoleBindings("").List(metav1.ListOptions{})
+		for i := range roleBindingsRaw.Items {
+			roleBindings = append(roleBindings, &roleBindingsRaw.Items[i])
+		}
+		handler.roleBindings.Replace(roleBindings, "")
+	}
+	sync()
+	return handler, sync
+}
+
+func newAuthorityNamespace(name, labelOwner, authorityName string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name,
+		Labels: map[string]string{"owner": labelOwner, "authority-name": authorityName}}}
+}
+
+func TestAUPChangeTogglesRoleBindings(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	otherAuthority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "other"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	// The user participates in a team and a slice of another authority
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-other"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "johndoe"}}}}
+	slice := &apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "exp", Namespace: "authority-other-team-demo"},
+		Spec: apps_v1alpha.SliceSpec{Users: []apps_v1alpha.SliceUsers{{Authority: "edgenet", Username: "johndoe"}}}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Roles: []string{"User"}, Email: "john.doe@edge-net.org"},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	AUP := &apps_v1alpha.AcceptableUsePolicy{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.AcceptableUsePolicySpec{Accepted: true}}
+	AUPRoleBinding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-user-aup-johndoe", Namespace: "authority-edgenet"},
+		Subjects: []rbacv1.Subject{{Kind: "ServiceAccount", Name: "johndoe", Namespace: "authority-edgenet"}}}
+	clientset := testclient.NewSimpleClientset(
+		newAuthorityNamespace("authority-edgenet", "authority", "edgenet"),
+		newAuthorityNamespace("authority-other", "authority", "other"),
+		newAuthorityNamespace("authority-other-team-demo", "team", "other"),
+		newAuthorityNamespace("authority-other-team-demo-slice-exp", "slice", "other"),
+		AUPRoleBinding)
+	handler, sync := newTestHandler(clientset, edgenettestclient.NewSimpleClientset(authority, otherAuthority, team, slice, user, AUP))
+	roleBindingExists := func(namespace, name string) bool {
+		_, err := handler.clientset.RbacV1().RoleBindings(namespace).Get(name, metav1.GetOptions{})
+		return err == nil
+	}
+	roleBindings := map[string]string{
+		"authority-other-team-demo":           "authority-edgenet-johndoe-team-user",
+		"authority-other-team-demo-slice-exp": "authority-edgenet-johndoe-slice-user",
+		"authority-edgenet":                   "authority-edgenet-johndoe-authority-user",
+	}
+
+	// Accepting the AUP grants access to the team and slice of the other authority
+	sync()
+	handler.ObjectUpdated(user, fields{aup: true})
+	for namespace, name := range roleBindings {
+		if !roleBindingExists(namespace, name) {
+			t.Errorf("role binding %s in %s not created on AUP acceptance", name, namespace)
+		}
+	}
+	// Revoking the AUP removes the access everywhere, except the access to the AUP itself
+	AUP.Spec.Accepted = false
+	handler.edgenetClientset.AppsV1alpha().AcceptableUsePolicies("authority-edgenet").Update(AUP)
+	user.Status.AUP = false
+	handler.edgenetClientset.AppsV1alpha().Users("authority-edgenet").UpdateStatus(user)
+	sync()
+	handler.ObjectUpdated(user, fields{aup: true})
+	for namespace, name := range roleBindings {
+		if roleBindingExists(namespace, name) {
+			t.Errorf("role binding %s in %s remains after AUP revocation", name, namespace)
+		}
+	}
+	if !roleBindingExists("authority-edgenet", "authority-edgenet-user-aup-johndoe") {
+		t.Error("AUP role binding removed while the user is active")
+	}
+	// Accepting the AUP again restores the access
+	AUP.Spec.Accepted = true
+	handler.edgenetClientset.AppsV1alpha().AcceptableUsePolicies("authority-edgenet").Update(AUP)
+	user.Status.AUP = true
+	handler.edgenetClientset.AppsV1alpha().Users("authority-edgenet").UpdateStatus(user)
+	sync()
+	handler.ObjectUpdated(user, fields{aup: true})
+	for namespace, name := range roleBindings {
+		if !roleBindingExists(namespace, name) {
+			t.Errorf("role binding %s in %s not restored on AUP acceptance", name, namespace)
+		}
+	}
+}
+
+func TestRoleChangeReconcilesRoleBindings(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Roles: []string{"User"}, Email: "john.doe@edge-net.org"},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	AUPRoleBinding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-user-aup-johndoe", Namespace: "authority-edgenet"},
+		Subjects: []rbacv1.Subject{{Kind: "ServiceAccount", Name: "johndoe", Namespace: "authority-edgenet"}}}
+	handler, sync := newTestHandler(testclient.NewSimpleClientset(newAuthorityNamespace("authority-edgenet", "authority", "edgenet"), AUPRoleBinding), edgenettestclient.NewSimpleClientset(authority, user))
+	roleBindingExists := func(name string) bool {
+		_, err := handler.clientset.RbacV1().RoleBindings("authority-edgenet").Get(name, metav1.GetOptions{})
+		return err == nil
+	}
+	cases := []struct {
+		roles    []string
+		expected map[string]bool
+	}{
+		{[]string{"User"}, map[string]bool{"authority-edgenet-johndoe-authority-user": true, "authority-edgenet-johndoe-authority-manager": false}},
+		{[]string{"User", "Manager"}, map[string]bool{"authority-edgenet-johndoe-authority-user": true, "authority-edgenet-johndoe-authority-manager": true}},
+		{[]string{"Manager"}, map[string]bool{"authority-edgenet-johndoe-authority-user": false, "authority-edgenet-johndoe-authority-manager": true}},
+	}
+	for _, c := range cases {
+		user.Spec.Roles = c.roles
+		handler.edgenetClientset.AppsV1alpha().Users("authority-edgenet").Update(user)
+		sync()
+		handler.ObjectUpdated(user, fields{roles: true})
+		for name, expected := range c.expected {
+			if roleBindingExists(name) != expected {
+				t.Errorf("role binding %s exists: %t, expected %t for the roles %v", name, !expected, expected, c.roles)
+			}
+		}
+		if !roleBindingExists("authority-edgenet-user-aup-johndoe") {
+			t.Errorf("AUP role binding removed on the role change to %v", c.roles)
+		}
+	}
+}
+
+func TestRoleBindingsFromIndexers(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Status: apps_v1alpha.AuthorityStatus{Enabled: true}}
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec:   apps_v1alpha.UserSpec{Roles: []string{"Manager"}, Email: "john.doe@edge-net.org"},
+		Status: apps_v1alpha.UserStatus{Active: true, AUP: true}}
+	clientset := testclient.NewSimpleClientset(newAuthorityNamespace("authority-edgenet", "authority", "edgenet"))
+	edgenetClientset := edgenettestclient.NewSimpleClientset(authority, user)
+	handler, _ := newTestHandler(clientset, edgenetClientset)
+	clientset.ClearActions()
+	edgenetClientset.ClearActions()
+
+	// The teams, slices, and role bindings of the user come from the indexers rather than cluster-wide lists
+	handler.ObjectUpdated(user, fields{roles: true})
+	for _, action := range append(clientset.Actions(), edgenetClientset.Actions()...) {
+		switch action.GetResource().Resource {
+		case "teams", "slices", "rolebindings":
+			if action.GetVerb() == "list" {
+				t.Errorf("%s listed in %q on a user update", action.GetResource().Resource, action.GetNamespace())
+			}
+		}
+	}
+}
+
+func TestObjectDeletedRevokesAccess(t *testing.T) {
+	// The user participates in a team of another authority along with a user who stays
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-other"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "Edgenet", Username: "johndoe"}, {Authority: "other", Username: "johndoe"}}}}
+	ownTeam := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "solo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{Users: []apps_v1alpha.TeamUsers{{Authority: "edgenet", Username: "johndoe"}}}}
+	newRoleBinding := func(namespace, name, userNamespace string) *rbacv1.RoleBinding {
+		return &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Subjects: []rbacv1.Subject{{Kind: "ServiceAccount", Name: "johndoe", Namespace: userNamespace}}}
+	}
+	clientset := testclient.NewSimpleClientset(
+		newAuthorityNamespace("authority-edgenet", "authority", "edgenet"),
+		newRoleBinding("authority-edgenet", "authority-edgenet-user-aup-johndoe", "authority-edgenet"),
+		newRoleBinding("authority-edgenet", "authority-edgenet-johndoe-authority-user", "authority-edgenet"),
+		newRoleBinding("authority-other-team-demo", "authority-edgenet-johndoe-team-user", "authority-edgenet"),
+		newRoleBinding("authority-other-team-demo-slice-exp", "authority-edgenet-johndoe-slice-user", "authority-edgenet"),
+		newRoleBinding("authority-other-team-demo", "authority-other-johndoe-team-user", "authority-other"))
+	handler, sync := newTestHandler(clientset, edgenettestclient.NewSimpleClientset(team, ownTeam))
+
+	sync()
+	handler.ObjectDeleted(nil, fields{object: objectData{name: "johndoe", namespace: "authority-edgenet"}})
+	teamUpdated, _ := handler.edgenetClientset.AppsV1alpha().Teams("authority-other").Get("demo", metav1.GetOptions{})
+	if len(teamUpdated.Spec.Users) != 1 || teamUpdated.Spec.Users[0].Authority != "other" {
+		t.Errorf("team users are %v, expected the user of the other authority only", teamUpdated.Spec.Users)
+	}
+	ownTeamUpdated, _ := handler.edgenetClientset.AppsV1alpha().Teams("authority-edgenet").Get("solo", metav1.GetOptions{})
+	if ownTeamUpdated.Spec.Users == nil || len(ownTeamUpdated.Spec.Users) != 0 {
+		t.Errorf("team users are %v, expected none", ownTeamUpdated.Spec.Users)
+	}
+	roleBindings, _ := handler.clientset.RbacV1().RoleBindings("").List(metav1.ListOptions{})
+	if len(roleBindings.Items) != 1 || roleBindings.Items[0].GetName() != "authority-other-johndoe-team-user" {
+		t.Errorf("role bindings are %v, expected that of the namesake in the other authority only", roleBindings.Items)
+	}
+}
+
+func TestNewUserEmailVerification(t *testing.T) {
+	mailer.SetEnabled(false)
+	defer mailer.SetEnabled(true)
+	handler, _ := newTestHandler(testclient.NewSimpleClientset(newAuthorityNamespace("authority-edgenet", "authority", "edgenet")), edgenettestclient.NewSimpleClientset())
+	verified := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet",
+		Annotations: map[string]string{EmailVerifiedAnnotation: "true"}}}
+	if !handler.verifyNewUser(verified, "edgenet") {
+		t.Error("user with a verified email address not activated")
+	}
+	unverified := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "janedoe", Namespace: "authority-edgenet"}}
+	if handler.verifyNewUser(unverified, "edgenet") {
+		t.Error("user with an unverified email address activated")
+	}
+	emailVerifications, _ := handler.edgenetClientset.AppsV1alpha().EmailVerifications("authority-edgenet").List(metav1.ListOptions{})
+	if len(emailVerifications.Items) != 1 || emailVerifications.Items[0].Spec.Identifier != "janedoe" {
+		t.Errorf("email verifications are %v, expected one for janedoe", emailVerifications.Items)
+	}
+}
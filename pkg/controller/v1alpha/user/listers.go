@@ -0,0 +1,128 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"fmt"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/client/clientset/versioned"
+	appsinformer_v1 "edgenet/pkg/client/informers/externalversions/apps/v1alpha"
+	"edgenet/pkg/controller/v1alpha/team"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// sliceUserIndex is the name of the index of the slices by the users listed in them
+const sliceUserIndex = "user"
+
+// sliceUserIndexFunc indexes the slices by the users listed in them, as the role bindings of a user are created in
+// the slices of all authorities in which the user participates
+func sliceUserIndexFunc(obj interface{}) ([]string, error) {
+	sliceObj, ok := obj.(*apps_v1alpha.Slice)
+	if !ok {
+		return nil, fmt.Errorf("%T isn't a slice", obj)
+	}
+	keys := []string{}
+	for _, sliceUser := range sliceObj.Spec.Users {
+		keys = append(keys, fmt.Sprintf("%s/%s", sliceUser.Authority, sliceUser.Username))
+	}
+	return keys, nil
+}
+
+// subjectIndex is the name of the index of the role bindings by the service accounts they bind, which stand for users
+const subjectIndex = "subject"
+
+// subjectIndexFunc indexes the role bindings by the namespace and the name of the service accounts they bind
+func subjectIndexFunc(obj interface{}) ([]string, error) {
+	roleBindingObj, ok := obj.(*rbacv1.RoleBinding)
+	if !ok {
+		return nil, fmt.Errorf("%T isn't a role binding", obj)
+	}
+	keys := []string{}
+	for _, subject := range roleBindingObj.Subjects {
+		if subject.Kind == "ServiceAccount" {
+			keys = append(keys, fmt.Sprintf("%s/%s", subject.Namespace, subject.Name))
+		}
+	}
+	return keys, nil
+}
+
+// newTeamInformer creates the informer of the teams, indexed by their users and namespaces, which the handler looks
+// up the teams of a user in rather than listing those of all authorities on each event
+func newTeamInformer(edgenetClientset versioned.Interface) cache.SharedIndexInformer {
+	return appsinformer_v1.NewTeamInformer(edgenetClientset, metav1.NamespaceAll, 0,
+		cache.Indexers{team.UserIndex: team.UserIndexFunc, cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// newSliceInformer creates the informer of the slices, indexed by their users and namespaces
+func newSliceInformer(edgenetClientset versioned.Interface) cache.SharedIndexInformer {
+	return appsinformer_v1.NewSliceInformer(edgenetClientset, metav1.NamespaceAll, 0,
+		cache.Indexers{sliceUserIndex: sliceUserIndexFunc, cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// newRoleBindingInformer creates the informer of the role bindings, indexed by the service accounts they bind
+func newRoleBindingInformer(clientset kubernetes.Interface) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return clientset.RbacV1().RoleBindings(metav1.NamespaceAll).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return clientset.RbacV1().RoleBindings(metav1.NamespaceAll).Watch(options)
+			},
+		},
+		&rbacv1.RoleBinding{},
+		0,
+		cache.Indexers{subjectIndex: subjectIndexFunc},
+	)
+}
+
+// indexedSlices returns the slices from the index given under the key
+func indexedSlices(indexer cache.Indexer, index, key string) []*apps_v1alpha.Slice {
+	objects, _ := indexer.ByIndex(index, key)
+	slices := []*apps_v1alpha.Slice{}
+	for _, obj := range objects {
+		slices = append(slices, obj.(*apps_v1alpha.Slice))
+	}
+	return slices
+}
+
+// indexedTeams returns the teams from the index given under the key
+func indexedTeams(indexer cache.Indexer, index, key string) []*apps_v1alpha.Team {
+	objects, _ := indexer.ByIndex(index, key)
+	teams := []*apps_v1alpha.Team{}
+	for _, obj := range objects {
+		teams = append(teams, obj.(*apps_v1alpha.Team))
+	}
+	return teams
+}
+
+// userRoleBindings returns the role bindings of the user from the index of the role bindings
+func userRoleBindings(indexer cache.Indexer, userCopy *apps_v1alpha.User) []*rbacv1.RoleBinding {
+	objects, _ := indexer.ByIndex(subjectIndex, fmt.Sprintf("%s/%s", userCopy.GetNamespace(), userCopy.GetName()))
+	roleBindings := []*rbacv1.RoleBinding{}
+	for _, obj := range objects {
+		roleBindings = append(roleBindings, obj.(*rbacv1.RoleBinding))
+	}
+	return roleBindings
+}
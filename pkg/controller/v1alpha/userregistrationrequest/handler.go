@@ -25,7 +25,9 @@ import (
 	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
 	"edgenet/pkg/authorization"
 	"edgenet/pkg/client/clientset/versioned"
+	userctl "edgenet/pkg/controller/v1alpha/user"
 	"edgenet/pkg/mailer"
+	"edgenet/pkg/registration"
 
 	log "github.com/Sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -42,23 +44,28 @@ type HandlerInterface interface {
 
 // Handler implementation
 type Handler struct {
-	clientset        *kubernetes.Clientset
-	edgenetClientset *versioned.Clientset
+	clientset        kubernetes.Interface
+	edgenetClientset versioned.Interface
 }
 
 // Init handles any handler initialization
 func (t *Handler) Init() error {
 	log.Info("URRHandler.Init")
 	var err error
-	t.clientset, err = authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	// The clientsets may be injected beforehand, such as those that the controllers in a process share
+	if t.clientset == nil {
+		t.clientset, err = authorization.CreateClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
-	t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	if t.edgenetClientset == nil {
+		t.edgenetClientset, err = authorization.CreateEdgeNetClientSet()
+		if err != nil {
+			log.Println(err.Error())
+			panic(err.Error())
+		}
 	}
 	return err
 }
@@ -119,8 +126,15 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 		// Check again if the email address is already taken
 		exists, message := t.checkDuplicateObject(URRCopy, URROwnerNamespace.Labels["authority-name"])
 		if !exists {
+			// The user who asks for no role gets the default roles of the authority
+			roles, rolesErr := registration.UserRoles(URRCopy.Spec.Roles, URROwnerAuthority)
 			// Check whether the request for user registration approved
-			if URRCopy.Status.Approved {
+			if URRCopy.Status.Approved && rolesErr != nil {
+				message := []string{"User creation failed", rolesErr.Error()}
+				statusChange = URRCopy.Status.State != failure || !reflect.DeepEqual(URRCopy.Status.Message, message)
+				URRCopy.Status.State = failure
+				URRCopy.Status.Message = message
+			} else if URRCopy.Status.Approved {
 				// Create a user on authority
 				user := apps_v1alpha.User{}
 				user.SetName(URRCopy.GetName())
@@ -128,8 +142,10 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 				user.Spec.Email = URRCopy.Spec.Email
 				user.Spec.FirstName = URRCopy.Spec.FirstName
 				user.Spec.LastName = URRCopy.Spec.LastName
-				user.Spec.Roles = URRCopy.Spec.Roles
+				user.Spec.Roles = roles
 				user.Spec.URL = URRCopy.Spec.URL
+				// The email address has been verified along with the registration request
+				user.SetAnnotations(map[string]string{userctl.EmailVerifiedAnnotation: "true"})
 				_, err := t.edgenetClientset.AppsV1alpha().Users(URRCopy.GetNamespace()).Create(user.DeepCopy())
 				if err == nil {
 					t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).Delete(URRCopy.GetName(), &metav1.DeleteOptions{})
@@ -0,0 +1,145 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Constant variables for the results of processing an object
+const Success = "success"
+const Failure = "failure"
+
+// Event is the outcome of processing an object by a controller, it carries the key of the object and the error
+// message only, never the object itself
+type Event struct {
+	Kind   string    `json:"kind"`
+	Key    string    `json:"key"`
+	Action string    `json:"action"`
+	Result string    `json:"result"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"timestamp"`
+}
+
+// bufferSize is the number of events that a subscriber can fall behind by, the events beyond are dropped for
+// that subscriber so that a slow client holds neither the controllers nor an unbounded amount of memory
+var bufferSize = 100
+
+// SetBufferSize configures the number of events kept for each subscriber, it applies to the new subscribers
+func SetBufferSize(size int) {
+	if size < 1 {
+		size = 1
+	}
+	bufferSize = size
+}
+
+// subscriber receives the events on its channel and counts those it missed
+type subscriber struct {
+	events  chan Event
+	dropped int
+}
+
+var subscribers = map[*subscriber]bool{}
+var mutex sync.Mutex
+
+// Subscribe returns the channel of the events published from now on, and the function that ends the subscription
+func Subscribe() (<-chan Event, func()) {
+	s := &subscriber{events: make(chan Event, bufferSize)}
+	mutex.Lock()
+	subscribers[s] = true
+	mutex.Unlock()
+	return s.events, func() {
+		mutex.Lock()
+		delete(subscribers, s)
+		mutex.Unlock()
+	}
+}
+
+// Publish sends the outcome of processing the object to the subscribers, it doesn't wait for any of them.
+// It costs a lock only when nobody subscribes.
+func Publish(kind, key, action string, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(subscribers) == 0 {
+		return
+	}
+	event := Event{Kind: kind, Key: key, Action: action, Result: Success, Time: time.Now()}
+	if err != nil {
+		event.Result = Failure
+		event.Error = err.Error()
+	}
+	for s := range subscribers {
+		select {
+		case s.events <- event:
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// dropped returns the number of events that the subscriber of the channel missed since the last call
+func dropped(events <-chan Event) int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for s := range subscribers {
+		if s.events == events {
+			count := s.dropped
+			s.dropped = 0
+			return count
+		}
+	}
+	return 0
+}
+
+// ServeSSE streams the events to the client as server-sent events until the client goes away. The events that
+// the client is too slow to receive are reported by a dropped event with their count
+func ServeSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	events, unsubscribe := Subscribe()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if count := dropped(events); count > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"count\":%d}\n\n", count)
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: reconcile\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublish(t *testing.T) {
+	// Nobody listens, so the event goes nowhere
+	Publish("Team", "authority-edgenet/demo", "create", nil)
+
+	first, unsubscribeFirst := Subscribe()
+	second, unsubscribeSecond := Subscribe()
+	defer unsubscribeSecond()
+	Publish("Team", "authority-edgenet/demo", "create", fmt.Errorf("namespace quota exceeded"))
+	for _, events := range []<-chan Event{first, second} {
+		select {
+		case event := <-events:
+			if event.Kind != "Team" || event.Key != "authority-edgenet/demo" || event.Action != "create" ||
+				event.Result != Failure || event.Error != "namespace quota exceeded" || event.Time.IsZero() {
+				t.Errorf("unexpected event %v", event)
+			}
+		default:
+			t.Error("event not received by a subscriber")
+		}
+	}
+	unsubscribeFirst()
+	Publish("Team", "authority-edgenet/demo", "update", nil)
+	if len(first) != 0 {
+		t.Error("event received after the subscription ended")
+	}
+	if event := <-second; event.Result != Success || event.Error != "" {
+		t.Errorf("unexpected event %v", event)
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	defer SetBufferSize(bufferSize)
+	SetBufferSize(2)
+	events, unsubscribe := Subscribe()
+	defer unsubscribe()
+	for i := 0; i < 5; i++ {
+		Publish("Team", fmt.Sprintf("authority-edgenet/team-%d", i), "update", nil)
+	}
+	// The subscriber keeps the oldest events up to its buffer, and the others are counted
+	if len(events) != 2 {
+		t.Errorf("%d events buffered, expected 2", len(events))
+	}
+	if count := dropped(events); count != 3 {
+		t.Errorf("%d events dropped, expected 3", count)
+	}
+	if count := dropped(events); count != 0 {
+		t.Errorf("dropped events counted again: %d", count)
+	}
+}
+
+func TestServeSSE(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(ServeSSE))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("content type is %s", contentType)
+	}
+	// The headers arrive once the client has subscribed
+	Publish("Authority", "edgenet", "create", nil)
+
+	reader := bufio.NewReader(response.Body)
+	eventLine, err := reader.ReadString('\n')
+	if err != nil || eventLine != "event: reconcile\n" {
+		t.Fatalf("event line is %q: %v", eventLine, err)
+	}
+	dataLine, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(dataLine, "data: ") {
+		t.Fatalf("data line is %q: %v", dataLine, err)
+	}
+	event := Event{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(dataLine, "data: ")), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Kind != "Authority" || event.Key != "edgenet" || event.Result != Success {
+		t.Errorf("unexpected event %v", event)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"strings"
+
+	"edgenet/pkg/namespace"
+)
+
+// Attachment is a file attached to an email, such as the kubeconfig of a user
+type Attachment struct {
+	Filename string
+	// MimeType is the content type of the file, application/octet-stream if empty
+	MimeType string
+	Content  []byte
+}
+
+// The line length of the base64 encoded attachments, as MIME limits the lines to 76 characters
+const base64LineLength = 76
+
+// kubeconfigDir is the directory of the kubeconfig files that the registration writes for the users
+var kubeconfigDir = "../../assets/kubeconfigs"
+
+// kubeconfigAttachment returns the kubeconfig file created for the user to attach it to the registration email
+func kubeconfigAttachment(registrationData CommonContentData) (Attachment, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("%s/edgenet-%s-%s.cfg", kubeconfigDir, namespace.AuthorityName(registrationData.CommonData.Authority),
+		registrationData.CommonData.Username))
+	if err != nil {
+		return Attachment{}, fmt.Errorf("Mailer: kubeconfig of %s cannot be attached: %s", registrationData.CommonData.Username, err)
+	}
+	return Attachment{Filename: "edgenet-kubeconfig.cfg", MimeType: "text/plain; charset=\"utf-8\"", Content: content}, nil
+}
+
+// attach turns the single-part email that the content functions render into a multipart one, in which the HTML body
+// is followed by the attachments
+func attach(message bytes.Buffer, attachments []Attachment) bytes.Buffer {
+	rendered := message.String()
+	// The headers of the email end with the MIME version, those of the HTML body follow it
+	mimeVersion := "MIME-Version: 1.0\r\n"
+	split := strings.Index(rendered, mimeVersion) + len(mimeVersion)
+	headers, html := rendered[:split], rendered[split:]
+	bodyHeaders := "Content-Type: text/html; charset=\"utf-8\"\r\nContent-Transfer-Encoding: 8bit\r\n"
+	html = strings.TrimPrefix(strings.TrimPrefix(html, bodyHeaders), "\r\n")
+
+	delimiter := generateRandomString(20)
+	var body bytes.Buffer
+	body.WriteString(headers)
+	body.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", delimiter))
+	body.WriteString(fmt.Sprintf("\r\n--%s\r\n%s\r\n%s\r\n", delimiter, bodyHeaders, html))
+	for _, attachment := range attachments {
+		mimeType := attachment.MimeType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		body.WriteString(fmt.Sprintf("--%s\r\n", delimiter))
+		body.WriteString(fmt.Sprintf("Content-Type: %s\r\n", mimeType))
+		body.WriteString("Content-Transfer-Encoding: base64\r\n")
+		body.WriteString(fmt.Sprintf("Content-Disposition: %s\r\n\r\n", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})))
+		encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+		for len(encoded) > base64LineLength {
+			body.WriteString(encoded[:base64LineLength] + "\r\n")
+			encoded = encoded[base64LineLength:]
+		}
+		body.WriteString(encoded + "\r\n")
+	}
+	body.WriteString(fmt.Sprintf("--%s--\r\n", delimiter))
+	return body
+}
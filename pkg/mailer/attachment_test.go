@@ -0,0 +1,129 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureSMTP renders the team emails as stubSMTP does and returns the messages delivered
+func captureSMTP(t *testing.T) *[]string {
+	stubSMTP(t)
+	messages := []string{}
+	transport = func(smtpServer smtpServer, to []string, body bytes.Buffer) error {
+		messages = append(messages, body.String())
+		return nil
+	}
+	return &messages
+}
+
+// readParts parses the multipart email and returns its parts along with their decoded content
+func readParts(t *testing.T, message string) ([]*multipart.Part, [][]byte) {
+	parsed, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("email of type %s not multipart: %v", mediaType, err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	parts := []*multipart.Part{}
+	contents := [][]byte{}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		content, _ := ioutil.ReadAll(part)
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			content, err = base64.StdEncoding.DecodeString(strings.Replace(string(content), "\r\n", "", -1))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		parts = append(parts, part)
+		contents = append(contents, content)
+	}
+	return parts, contents
+}
+
+func TestSendWithAttachments(t *testing.T) {
+	messages := captureSMTP(t)
+	contentData := ResourceAllocationData{Name: "demo"}
+	contentData.CommonData.Email = []string{"john.doe@edge-net.org"}
+	certificate := bytes.Repeat([]byte("-----BEGIN CERTIFICATE-----\n"), 10)
+	attachments := []Attachment{
+		{Filename: "edgenet.crt", MimeType: "application/x-pem-file", Content: certificate},
+		{Filename: "notes.bin", Content: []byte{0, 1, 2}},
+	}
+	if err := SendWithAttachments("team-creation", contentData, attachments); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 1 {
+		t.Fatalf("%d emails delivered", len(*messages))
+	}
+	for _, line := range strings.Split((*messages)[0], "\r\n") {
+		if len(line) > 998 {
+			t.Errorf("line of %d characters exceeds the limit of SMTP", len(line))
+		}
+	}
+	parts, contents := readParts(t, (*messages)[0])
+	if len(parts) != 3 {
+		t.Fatalf("%d parts, expected the body and the attachments", len(parts))
+	}
+	if !strings.HasPrefix(parts[0].Header.Get("Content-Type"), "text/html") || string(contents[0]) != "<p>demo</p>" {
+		t.Errorf("body part is %v: %q", parts[0].Header, contents[0])
+	}
+	if parts[1].Header.Get("Content-Type") != "application/x-pem-file" || parts[1].FileName() != "edgenet.crt" ||
+		!strings.HasPrefix(parts[1].Header.Get("Content-Disposition"), "attachment") || !bytes.Equal(contents[1], certificate) {
+		t.Errorf("attachment part is %v: %q", parts[1].Header, contents[1])
+	}
+	if parts[2].Header.Get("Content-Type") != "application/octet-stream" || parts[2].FileName() != "notes.bin" || !bytes.Equal(contents[2], []byte{0, 1, 2}) {
+		t.Errorf("attachment part without type is %v: %q", parts[2].Header, contents[2])
+	}
+
+	// The emails without attachments remain single-part
+	if err := Send("team-creation", contentData); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains((*messages)[1], "multipart") {
+		t.Errorf("email without attachments is multipart:\n%s", (*messages)[1])
+	}
+}
+
+func TestRegistrationKubeconfigAttachment(t *testing.T) {
+	messages := captureSMTP(t)
+	dir, err := ioutil.TempDir("", "kubeconfigs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(original string) { kubeconfigDir = original }(kubeconfigDir)
+	kubeconfigDir = dir
+	ioutil.WriteFile(filepath.Join(dir, "edgenet-authority-edgenet-johndoe.cfg"), []byte("apiVersion: v1\nkind: Config\n"), 0600)
+	ioutil.WriteFile(filepath.Join(templateDir, "user-registration.html"), []byte(`<p>{{.CommonData.Username}}</p>`), 0644)
+	contentData := CommonContentData{}
+	contentData.CommonData = commonData{Authority: "edgenet", Username: "johndoe", Email: []string{"john.doe@edge-net.org"}}
+
+	if err := Send("user-registration-successful", contentData); err != nil {
+		t.Fatal(err)
+	}
+	parts, contents := readParts(t, (*messages)[0])
+	if len(parts) != 2 || parts[1].FileName() != "edgenet-kubeconfig.cfg" || string(contents[1]) != "apiVersion: v1\nkind: Config\n" {
+		t.Errorf("kubeconfig not attached: %d parts", len(parts))
+	}
+
+	// The email without its kubeconfig fails rather than going out incomplete
+	contentData.CommonData.Username = "janedoe"
+	if err := Send("user-registration-successful", contentData); err == nil || len(*messages) != 1 {
+		t.Errorf("registration email sent without the kubeconfig: %v", err)
+	}
+}
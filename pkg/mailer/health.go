@@ -0,0 +1,63 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// pingTimeout bounds the health check of the SMTP server, so that a probe doesn't hang on an unresponsive server
+var pingTimeout = 5 * time.Second
+
+// SetPingTimeout configures how long the health check waits for the SMTP server to connect and reply
+func SetPingTimeout(timeout time.Duration) {
+	pingTimeout = timeout
+}
+
+// Ping connects to the configured SMTP server and greets it by EHLO without sending any email, the error tells why the
+// server cannot be reached. There is nothing to check while the emails are disabled.
+func Ping() error {
+	if !enabled {
+		return nil
+	}
+	smtpServer, err := readSMTPServer()
+	if err != nil {
+		return fmt.Errorf("Mailer: SMTP configuration cannot be read: %s", err)
+	}
+	conn, err := net.DialTimeout("tcp", smtpServer.address(), pingTimeout)
+	if err != nil {
+		return fmt.Errorf("Mailer: SMTP server %s unreachable: %s", smtpServer.address(), err)
+	}
+	// The deadline covers the greeting and the replies of the server as well
+	conn.SetDeadline(time.Now().Add(pingTimeout))
+	client, err := smtp.NewClient(conn, smtpServer.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Mailer: SMTP server %s didn't greet: %s", smtpServer.address(), err)
+	}
+	defer client.Close()
+	if err := client.Hello("localhost"); err != nil {
+		return fmt.Errorf("Mailer: SMTP server %s rejected EHLO: %s", smtpServer.address(), err)
+	}
+	if err := client.Quit(); err != nil {
+		return fmt.Errorf("Mailer: SMTP server %s didn't close the session: %s", smtpServer.address(), err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package mailer
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP configures the mailer with the SMTP server at the address given
+func fakeSMTP(t *testing.T, address string) {
+	dir, err := ioutil.TempDir("", "smtp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	host, port, _ := net.SplitHostPort(address)
+	config := fmt.Sprintf("host: %s\nport: \"%s\"\nfrom: no-reply@edge-net.org\n", host, port)
+	ioutil.WriteFile(filepath.Join(dir, "smtp.yaml"), []byte(config), 0644)
+	originalPath, originalEnabled, originalTimeout := smtpConfigPath, enabled, pingTimeout
+	t.Cleanup(func() { smtpConfigPath, enabled, pingTimeout = originalPath, originalEnabled, originalTimeout })
+	smtpConfigPath = filepath.Join(dir, "smtp.yaml")
+	SetEnabled(true)
+	SetPingTimeout(time.Second)
+}
+
+// serveSMTP accepts the connections and answers the commands of a session, greeting the clients unless silent
+func serveSMTP(t *testing.T, silent bool) (net.Listener, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	commands := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if silent {
+					time.Sleep(2 * time.Second)
+					return
+				}
+				fmt.Fprint(conn, "220 smtp.edge-net.org ESMTP\r\n")
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					command := strings.Fields(line)[0]
+					commands <- command
+					switch command {
+					case "EHLO":
+						fmt.Fprint(conn, "250 smtp.edge-net.org\r\n")
+					case "QUIT":
+						fmt.Fprint(conn, "221 Bye\r\n")
+						return
+					default:
+						fmt.Fprint(conn, "502 Not implemented\r\n")
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener, commands
+}
+
+func TestPing(t *testing.T) {
+	listener, commands := serveSMTP(t, false)
+	fakeSMTP(t, listener.Addr().String())
+	if err := Ping(); err != nil {
+		t.Fatalf("server that accepts unreachable: %s", err)
+	}
+	close(commands)
+	sent := []string{}
+	for command := range commands {
+		sent = append(sent, command)
+	}
+	// The session ends without any mail transaction
+	if strings.Join(sent, " ") != "EHLO QUIT" {
+		t.Errorf("commands sent are %v, expected EHLO and QUIT only", sent)
+	}
+}
+
+func TestPingRefused(t *testing.T) {
+	// The port of the closed listener refuses the connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	fakeSMTP(t, address)
+	if err := Ping(); err == nil || !strings.Contains(err.Error(), "unreachable") {
+		t.Errorf("server that refuses reported as %v", err)
+	}
+
+	// There is nothing to check while the emails are disabled
+	SetEnabled(false)
+	if err := Ping(); err != nil {
+		t.Errorf("disabled mailer unhealthy: %s", err)
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	listener, _ := serveSMTP(t, true)
+	fakeSMTP(t, listener.Addr().String())
+	SetPingTimeout(100 * time.Millisecond)
+	start := time.Now()
+	if err := Ping(); err == nil {
+		t.Error("server that never greets reported as reachable")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ping took %s despite the timeout", elapsed)
+	}
+}
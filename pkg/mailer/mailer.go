@@ -19,14 +19,18 @@ package mailer
 import (
 	"bytes"
 	"crypto/tls"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
-	"io/ioutil"
 	"log"
 	"math/rand"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	yaml "gopkg.in/yaml.v2"
@@ -52,6 +56,8 @@ type ResourceAllocationData struct {
 	OwnerNamespace string
 	ChildNamespace string
 	Authority      string
+	// Users are those the email is about, such as the users of a team whose authority cannot be found, as authority/username
+	Users []string
 }
 
 // MultiProviderData to set the node contribution variables
@@ -59,8 +65,10 @@ type MultiProviderData struct {
 	CommonData commonData
 	Name       string
 	Host       string
-	Status     string
-	Message    []string
+	// Node is the name of the node that the contribution makes join the cluster
+	Node    string
+	Status  string
+	Message []string
 }
 
 // VerifyContentData to set the verification-specific variables
@@ -85,26 +93,270 @@ type smtpServer struct {
 	To       string `yaml:"to"`
 }
 
+// enabled lets the emails go out, the MAILER_DISABLED environment variable turns them off in staging and test clusters
+var enabled = !disabledByEnv()
+
+// transport delivers the rendered emails, which tests replace to observe the deliveries
+var transport = deliver
+
+// smtpConfigPath is the yaml config file of the SMTP server, which tests replace
+var smtpConfigPath = "../../config/smtp.yaml"
+
+func disabledByEnv() bool {
+	disabled, err := strconv.ParseBool(os.Getenv("MAILER_DISABLED"))
+	return err == nil && disabled
+}
+
+// SetEnabled configures whether the emails get sent, when disabled Send only logs the email it would send
+func SetEnabled(value bool) {
+	enabled = value
+}
+
+// intendedRecipients returns the addresses of the users whom the content is for
+func intendedRecipients(contentData interface{}) []string {
+	switch data := contentData.(type) {
+	case CommonContentData:
+		return data.CommonData.Email
+	case ResourceAllocationData:
+		return data.CommonData.Email
+	case MultiProviderData:
+		return data.CommonData.Email
+	case VerifyContentData:
+		return data.CommonData.Email
+	}
+	return []string{}
+}
+
+// InvalidEmailError is returned when an email address is malformed, so that it is rejected before the delivery
+type InvalidEmailError struct {
+	Address string
+}
+
+func (e *InvalidEmailError) Error() string {
+	return fmt.Sprintf("Mailer: invalid email address %q", e.Address)
+}
+
+// ValidateEmail checks whether the address is a single bare email address, such as "john.doe@edge-net.org"
+func ValidateEmail(address string) error {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address || strings.ContainsAny(address, " \t\r\n") {
+		return &InvalidEmailError{Address: address}
+	}
+	domain := address[strings.LastIndex(address, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return &InvalidEmailError{Address: address}
+	}
+	return nil
+}
+
+// ValidEmails returns the addresses that are well-formed in their order, along with the errors of the malformed ones
+func ValidEmails(addresses []string) ([]string, []error) {
+	valid := []string{}
+	var errs []error
+	for _, address := range addresses {
+		if err := ValidateEmail(address); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		valid = append(valid, address)
+	}
+	return valid, errs
+}
+
+// templateDir is the directory of the HTML templates, each of which is named after the email it renders
+var templateDir = "../../assets/templates/email"
+
+// SetTemplateDir configures the directory to load the email templates from, which lets operators customize them without recompiling
+func SetTemplateDir(dir string) {
+	templateDir = dir
+}
+
+// parseTemplate loads the template of the email from the template directory
+func parseTemplate(name string) (*template.Template, error) {
+	path := filepath.Join(templateDir, fmt.Sprintf("%s.html", name))
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("template of %s email not found in %s: %s", name, templateDir, err)
+	}
+	return template.ParseFiles(path)
+}
+
+// auditAddress receives a blind copy of every email sent, empty to send none
+var auditAddress string
+
+// SetAuditAddress configures the mailbox that receives a blind copy of every email for auditing, empty to disable
+func SetAuditAddress(address string) {
+	auditAddress = address
+}
+
+// envelopeRecipients returns the addresses to deliver the email to, which include the audit address
+// that, unlike the others, doesn't appear in the headers
+func envelopeRecipients(to []string) []string {
+	recipients := append([]string{}, to...)
+	if auditAddress != "" {
+		recipients = append(recipients, auditAddress)
+	}
+	return recipients
+}
+
 // address to get URI of smtp server
 func (s *smtpServer) address() string {
 	return fmt.Sprintf("%s:%s", s.Host, s.Port)
 }
 
-// Send function consumed by the custom resources to send emails
-func Send(subject string, contentData interface{}) {
-	// The code below inits the SMTP configuration for sending emails
-	// The path of the yaml config file of smtp server
-	file, err := os.Open("../../config/smtp.yaml")
-	if err != nil {
-		log.Printf("Mailer: unexpected error executing command: %v", err)
-		return
+// Send function consumed by the custom resources to send emails, the error tells why the email couldn't be sent.
+// The email that the server rejects temporarily, such as by greylisting, is retried in the background after a delay,
+// in which case the error is a DeferredError as the email isn't delivered yet.
+func Send(subject string, contentData interface{}) error {
+	return SendWithAttachments(subject, contentData, nil)
+}
+
+// SendWithAttachments sends the email as Send does, along with the files given attached to it
+func SendWithAttachments(subject string, contentData interface{}, attachments []Attachment) error {
+	// The email beyond the rate limit is sent once the limit allows it
+	if wait := limiter.reserve(subject, intendedRecipients(contentData)); wait > 0 {
+		log.Printf("Mailer: rate limit of %s emails to %s reached, deferring the email for %s", subject, intendedRecipients(contentData), wait)
+		schedule(wait, func() {
+			if err := SendWithAttachments(subject, contentData, attachments); err != nil && !IsDeferred(err) {
+				log.Printf("Mailer: deferred %s email not sent: %s", subject, err)
+			}
+		})
+		return &DeferredError{Subject: subject, Delay: wait, Err: errRateLimited}
+	}
+	err := attemptWithAttachments(subject, contentData, attachments)
+	if IsTemporary(err) && greylistRetries > 0 {
+		log.Printf("Mailer: %s email deferred by the server, retrying in %s: %s", subject, greylistDelay, err)
+		scheduleRetry(subject, contentData, attachments, greylistRetries)
+		return &DeferredError{Subject: subject, Delay: greylistDelay, Err: err}
 	}
-	decoder := yaml.NewDecoder(file)
+	return err
+}
+
+// sendOnce makes a single attempt to send the email, the email beyond the rate limit or rejected temporarily by
+// the server is left to the caller to retry, which the error being a DeferredError tells
+func sendOnce(subject string, contentData interface{}) error {
+	if wait := limiter.reserve(subject, intendedRecipients(contentData)); wait > 0 {
+		return &DeferredError{Subject: subject, Delay: wait, Err: errRateLimited}
+	}
+	err := attempt(subject, contentData)
+	if IsTemporary(err) {
+		return &DeferredError{Subject: subject, Delay: greylistDelay, Err: err}
+	}
+	return err
+}
+
+// errRateLimited is the cause of the emails deferred by the rate limit
+var errRateLimited = errors.New("rate limit reached")
+
+// DeferredError tells that the email isn't delivered yet, as the rate limit was reached or the server rejected it
+// temporarily, and that it is worth retrying after the delay
+type DeferredError struct {
+	Subject string
+	Delay   time.Duration
+	Err     error
+}
+
+func (e *DeferredError) Error() string {
+	return fmt.Sprintf("Mailer: %s email deferred for %s: %s", e.Subject, e.Delay, e.Err)
+}
+
+func (e *DeferredError) Unwrap() error {
+	return e.Err
+}
+
+// IsDeferred tells whether the email isn't delivered yet but is worth retrying, see DeferredError
+func IsDeferred(err error) bool {
+	var deferred *DeferredError
+	return errors.As(err, &deferred)
+}
+
+// attempt sends the email once and records the attempt
+func attempt(subject string, contentData interface{}) error {
+	return attemptWithAttachments(subject, contentData, nil)
+}
+
+// attemptWithAttachments sends the email along with the attachments once and records the attempt
+func attemptWithAttachments(subject string, contentData interface{}, attachments []Attachment) error {
+	if !enabled {
+		log.Printf("Mailer: emails are disabled, %s email to %s not sent", subject, intendedRecipients(contentData))
+		return nil
+	}
+	start := time.Now()
+	err := send(subject, contentData, attachments)
+	result := success
+	if IsTemporary(err) {
+		result = deferred
+	} else if err != nil {
+		result = failure
+	}
+	metrics.ObserveSend(subject, result, time.Since(start))
+	return err
+}
+
+// greylistDelay is how long the email that the server rejects temporarily waits before it is retried, as the servers
+// that greylist accept the same email only once some time has passed
+var greylistDelay = 5 * time.Minute
+
+// greylistRetries is how many times Send retries the email that the server keeps rejecting temporarily
+var greylistRetries = 3
+
+// SetGreylistRetry configures the delay before retrying the emails that the server rejects temporarily with a 4xx
+// reply, and how many times Send retries them, 0 to not retry. The outbox retries them after the delay until its
+// attempts are exhausted.
+func SetGreylistRetry(delay time.Duration, retries int) {
+	greylistDelay = delay
+	greylistRetries = retries
+}
+
+// schedule runs the retry after the delay, which tests replace to run it at once
+var schedule = func(delay time.Duration, retry func()) {
+	time.AfterFunc(delay, retry)
+}
+
+// scheduleRetry retries the email after the greylist delay, as many times as left while it is rejected temporarily
+func scheduleRetry(subject string, contentData interface{}, attachments []Attachment, left int) {
+	schedule(greylistDelay, func() {
+		err := attemptWithAttachments(subject, contentData, attachments)
+		if IsTemporary(err) && left > 1 {
+			scheduleRetry(subject, contentData, attachments, left-1)
+			return
+		}
+		if err != nil {
+			log.Printf("Mailer: %s email not sent after the retries: %s", subject, err)
+		}
+	})
+}
+
+// IsTemporary tells whether the SMTP server rejected the email with a 4xx reply, which is worth retrying later
+func IsTemporary(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 400 && reply.Code < 500
+}
+
+// IsPermanent tells whether the SMTP server rejected the email with a 5xx reply, which retrying doesn't change
+func IsPermanent(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 500
+}
+
+// readSMTPServer reads the SMTP configuration from its yaml config file
+func readSMTPServer() (smtpServer, error) {
 	var smtpServer smtpServer
-	err = decoder.Decode(&smtpServer)
+	file, err := os.Open(smtpConfigPath)
+	if err != nil {
+		return smtpServer, err
+	}
+	defer file.Close()
+	err = yaml.NewDecoder(file).Decode(&smtpServer)
+	return smtpServer, err
+}
+
+// send renders the email of the subject and delivers it along with the attachments
+func send(subject string, contentData interface{}, attachments []Attachment) error {
+	// The code below inits the SMTP configuration for sending emails
+	smtpServer, err := readSMTPServer()
 	if err != nil {
 		log.Printf("Mailer: unexpected error executing command: %v", err)
-		return
+		return err
 	}
 
 	// This section determines which email to send whom
@@ -112,43 +364,67 @@ func Send(subject string, contentData interface{}) {
 	var body bytes.Buffer
 	switch subject {
 	case "user-email-verification", "user-email-verification-update":
-		to, body = setUserEmailVerificationContent(contentData, smtpServer.From, subject)
+		to, body, err = setUserEmailVerificationContent(contentData, smtpServer.From, subject)
 	case "user-email-verified-alert", "user-email-verified-notification":
-		to, body = setUserVerifiedAlertContent(contentData, smtpServer.From, []string{smtpServer.To}, subject)
+		to, body, err = setUserVerifiedAlertContent(contentData, smtpServer.From, []string{smtpServer.To}, subject)
 	case "user-registration-successful":
-		to, body = setUserRegistrationContent(contentData, smtpServer.From)
+		to, body, err = setUserRegistrationContent(contentData, smtpServer.From)
+		if err == nil {
+			// The kubeconfig created for the user comes first
+			var kubeconfig Attachment
+			kubeconfig, err = kubeconfigAttachment(contentData.(CommonContentData))
+			attachments = append([]Attachment{kubeconfig}, attachments...)
+		}
 	case "authority-email-verification":
-		to, body = setAuthorityEmailVerificationContent(contentData, smtpServer.From)
+		to, body, err = setAuthorityEmailVerificationContent(contentData, smtpServer.From)
 	case "authority-email-verified-alert":
-		to, body = setAuthorityVerifiedAlertContent(contentData, smtpServer.From, []string{smtpServer.To})
+		to, body, err = setAuthorityVerifiedAlertContent(contentData, smtpServer.From, []string{smtpServer.To})
 	case "authority-creation-successful":
-		to, body = setAuthorityRequestContent(contentData, smtpServer.From)
+		to, body, err = setAuthorityRequestContent(contentData, smtpServer.From)
 	case "acceptable-use-policy-accepted":
-		to, body = setAUPConfirmationContent(contentData, smtpServer.From)
+		to, body, err = setAUPConfirmationContent(contentData, smtpServer.From)
 	case "acceptable-use-policy-renewal":
-		to, body = setAUPRenewalContent(contentData, smtpServer.From)
+		to, body, err = setAUPRenewalContent(contentData, smtpServer.From)
 	case "acceptable-use-policy-expired":
-		to, body = setAUPExpiredContent(contentData, smtpServer.From)
+		to, body, err = setAUPExpiredContent(contentData, smtpServer.From)
+	case "acceptable-use-policy-update":
+		to, body, err = setAUPUpdateContent(contentData, smtpServer.From)
 	case "slice-creation", "slice-removal", "slice-reminder", "slice-deletion", "slice-crash", "slice-total-quota-exceeded", "slice-lack-of-quota",
 		"slice-deletion-failed", "slice-collection-deletion-failed":
-		to, body = setSliceContent(contentData, smtpServer.From, []string{smtpServer.To}, subject)
-	case "team-creation", "team-removal", "team-deletion", "team-crash":
-		to, body = setTeamContent(contentData, smtpServer.From, subject)
-	case "node-contribution-successful", "node-contribution-failure", "node-contribution-failure-support":
-		to, body = setNodeContributionContent(contentData, smtpServer.From, []string{smtpServer.To}, subject)
+		to, body, err = setSliceContent(contentData, smtpServer.From, []string{smtpServer.To}, subject)
+	case "team-creation", "team-removal", "team-deletion", "team-crash", "team-authority-unresolved":
+		to, body, err = setTeamContent(contentData, smtpServer.From, subject)
+	case "permission-expiry":
+		to, body, err = setPermissionContent(contentData, smtpServer.From, subject)
+	case "node-contribution-successful", "node-contribution-failure", "node-contribution-failure-support", "node-contribution-unreachable":
+		to, body, err = setNodeContributionContent(contentData, smtpServer.From, []string{smtpServer.To}, subject)
 	case "authority-validation-failure-name", "authority-validation-failure-email", "authority-email-verification-malfunction",
 		"authority-creation-failure", "authority-email-verification-dubious":
-		to, body = setAuthorityFailureContent(contentData, smtpServer.From, []string{smtpServer.To}, subject)
+		to, body, err = setAuthorityFailureContent(contentData, smtpServer.From, []string{smtpServer.To}, subject)
 	case "user-validation-failure-name", "user-validation-failure-email", "user-email-verification-malfunction", "user-creation-failure", "user-serviceaccount-failure",
 		"user-kubeconfig-failure", "user-email-verification-dubious", "user-email-verification-update-malfunction", "user-deactivation-failure":
-		to, body = setUserFailureContent(contentData, smtpServer.From, []string{smtpServer.To}, subject)
+		to, body, err = setUserFailureContent(contentData, smtpServer.From, []string{smtpServer.To}, subject)
+	default:
+		err = fmt.Errorf("Mailer: no email defined for %s", subject)
+	}
+	if err != nil {
+		log.Printf("Mailer: couldn't render %s email: %v", subject, err)
+		return err
 	}
+	if len(attachments) > 0 {
+		body = attach(body, attachments)
+	}
+
+	return transport(smtpServer, to, body)
+}
 
+// deliver sends the email through the SMTP server
+func deliver(smtpServer smtpServer, to []string, body bytes.Buffer) error {
 	// Create a new Client connected to the SMTP server
 	client, err := smtp.Dial(smtpServer.address())
 	if err != nil {
 		log.Println(err)
-		return
+		return err
 	}
 	// Check if the server supports TLS
 	if ok, _ := client.Extension("STARTTLS"); ok {
@@ -156,7 +432,7 @@ func Send(subject string, contentData interface{}) {
 		cfg := &tls.Config{ServerName: smtpServer.Host, InsecureSkipVerify: true}
 		if err = client.StartTLS(cfg); err != nil {
 			log.Println(err)
-			return
+			return err
 		}
 	}
 	// Check if the server supports SMTP authentication
@@ -165,40 +441,41 @@ func Send(subject string, contentData interface{}) {
 		auth := smtp.PlainAuth("", smtpServer.Username, smtpServer.Password, smtpServer.Host)
 		if err = client.Auth(auth); err != nil {
 			log.Println(err)
-			return
+			return err
 		}
 	}
 	// The part below starts a mail transaction by using the provided email address
 	if err = client.Mail(smtpServer.From); err != nil {
 		log.Println(err)
-		return
+		return err
 	}
-	// Add recipients to the email
-	for _, addr := range to {
+	// Add recipients to the email along with the blind copy for auditing
+	for _, addr := range envelopeRecipients(to) {
 		if err = client.Rcpt(addr); err != nil {
 			log.Println(err)
-			return
+			return err
 		}
 	}
 	// To write the mail headers and body
 	w, err := client.Data()
 	if err != nil {
 		log.Println(err)
-		return
+		return err
 	}
 	_, err = w.Write(body.Bytes())
 	if err != nil {
 		log.Println(err)
-		return
+		return err
 	}
 	err = w.Close()
 	if err != nil {
 		log.Println(err)
-		return
+		return err
 	}
 	// Close the connection to the server
 	client.Quit()
 	log.Printf("Mailer: email sent to  %s!", to)
+	return nil
 }
 
 // setCommonEmailHeaders to create an email body by subject and common headers
@@ -233,10 +510,13 @@ func setCommonEmailHeaders(subject string, from string, to []string, delimiter s
 }
 
 // setUserFailureContent to create an email body related to failures during user creation
-func setUserFailureContent(contentData interface{}, from string, to []string, subject string) ([]string, bytes.Buffer) {
+func setUserFailureContent(contentData interface{}, from string, to []string, subject string) ([]string, bytes.Buffer, error) {
 	NCData := contentData.(CommonContentData)
 	// The HTML template
-	t, _ := template.ParseFiles(fmt.Sprintf("../../assets/templates/email/%s.html", subject))
+	t, err := parseTemplate(subject)
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	title := "[EdgeNet Admin] User Creation Failure"
 	if subject == "user-validation-failure-name" || subject == "user-validation-failure-email" ||
@@ -246,16 +526,21 @@ func setUserFailureContent(contentData interface{}, from string, to []string, su
 		to = NCData.CommonData.Email
 	}
 	body := setCommonEmailHeaders(title, from, to, delimiter)
-	t.Execute(&body, NCData)
+	if err := t.Execute(&body, NCData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setAuthorityFailureContent to create an email body related to failures during authority creation
-func setAuthorityFailureContent(contentData interface{}, from string, to []string, subject string) ([]string, bytes.Buffer) {
+func setAuthorityFailureContent(contentData interface{}, from string, to []string, subject string) ([]string, bytes.Buffer, error) {
 	NCData := contentData.(CommonContentData)
 	// The HTML template
-	t, _ := template.ParseFiles(fmt.Sprintf("../../assets/templates/email/%s.html", subject))
+	t, err := parseTemplate(subject)
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	title := "[EdgeNet Admin] Authority Establishment Failure"
 	if subject == "authority-validation-failure-name" || subject == "authority-validation-failure-email" {
@@ -264,16 +549,21 @@ func setAuthorityFailureContent(contentData interface{}, from string, to []strin
 		to = NCData.CommonData.Email
 	}
 	body := setCommonEmailHeaders(title, from, to, delimiter)
-	t.Execute(&body, NCData)
+	if err := t.Execute(&body, NCData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setNodeContributionContent to create an email body related to the node contribution notification
-func setNodeContributionContent(contentData interface{}, from string, to []string, subject string) ([]string, bytes.Buffer) {
+func setNodeContributionContent(contentData interface{}, from string, to []string, subject string) ([]string, bytes.Buffer, error) {
 	NCData := contentData.(MultiProviderData)
 	// The HTML template
-	t, _ := template.ParseFiles(fmt.Sprintf("../../assets/templates/email/%s.html", subject))
+	t, err := parseTemplate(subject)
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	title := "[EdgeNet] Node contribution event"
 	switch subject {
@@ -286,20 +576,28 @@ func setNodeContributionContent(contentData interface{}, from string, to []strin
 		title = "[EdgeNet] Node Contribution - Failed"
 	case "node-contribution-failure-support":
 		title = "[EdgeNet Admin] Node Contribution - Failure"
+	case "node-contribution-unreachable":
+		to = NCData.CommonData.Email
+		title = "[EdgeNet] Node Contribution - Unreachable"
 	}
 	body := setCommonEmailHeaders(title, from, to, delimiter)
-	t.Execute(&body, NCData)
+	if err := t.Execute(&body, NCData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setTeamContent to create an email body related to the team invitation
-func setTeamContent(contentData interface{}, from, subject string) ([]string, bytes.Buffer) {
+func setTeamContent(contentData interface{}, from, subject string) ([]string, bytes.Buffer, error) {
 	teamData := contentData.(ResourceAllocationData)
 	// This represents receivers' email addresses
 	to := teamData.CommonData.Email
 	// The HTML template
-	t, _ := template.ParseFiles(fmt.Sprintf("../../assets/templates/email/%s.html", subject))
+	t, err := parseTemplate(subject)
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	title := "[EdgeNet] Team event"
 	switch subject {
@@ -311,18 +609,49 @@ func setTeamContent(contentData interface{}, from, subject string) ([]string, by
 		title = "[EdgeNet] Team deleted"
 	case "team-crash":
 		title = "[EdgeNet] Team creation failed"
+	case "team-authority-unresolved":
+		title = "[EdgeNet] Team users unresolved"
 	}
 	body := setCommonEmailHeaders(title, from, to, delimiter)
-	t.Execute(&body, teamData)
+	if err := t.Execute(&body, teamData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
+}
+
+// setPermissionContent to create an email body related to the permission emails
+func setPermissionContent(contentData interface{}, from, subject string) ([]string, bytes.Buffer, error) {
+	permissionData := contentData.(ResourceAllocationData)
+	// This represents receivers' email addresses
+	to := permissionData.CommonData.Email
+	// The HTML template
+	t, err := parseTemplate(subject)
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
+	delimiter := ""
+	title := "[EdgeNet] Permission event"
+	switch subject {
+	case "permission-expiry":
+		title = "[EdgeNet] Permission expired"
+	}
+	body := setCommonEmailHeaders(title, from, to, delimiter)
+	if err := t.Execute(&body, permissionData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
+
+	return to, body, nil
 }
 
 // setSliceContent to create an email body related to the slice emails
-func setSliceContent(contentData interface{}, from string, to []string, subject string) ([]string, bytes.Buffer) {
+func setSliceContent(contentData interface{}, from string, to []string, subject string) ([]string, bytes.Buffer, error) {
 	sliceData := contentData.(ResourceAllocationData)
 	// The HTML template
-	t, _ := template.ParseFiles(fmt.Sprintf("../../assets/templates/email/%s.html", subject))
+	t, err := parseTemplate(subject)
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	title := "[EdgeNet] Slice event"
 	switch subject {
@@ -352,128 +681,173 @@ func setSliceContent(contentData interface{}, from string, to []string, subject
 		title = "[EdgeNet] Slice deletion failed"
 	}
 	body := setCommonEmailHeaders(title, from, to, delimiter)
-	t.Execute(&body, sliceData)
+	if err := t.Execute(&body, sliceData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setAUPConfirmationContent to create an email body related to the acceptable use policy confirmation
-func setAUPConfirmationContent(contentData interface{}, from string) ([]string, bytes.Buffer) {
+func setAUPConfirmationContent(contentData interface{}, from string) ([]string, bytes.Buffer, error) {
 	AUPData := contentData.(CommonContentData)
 	// This represents receivers' email addresses
 	to := AUPData.CommonData.Email
 	// The HTML template
-	t, _ := template.ParseFiles("../../assets/templates/email/acceptable-use-policy-confirmation.html")
+	t, err := parseTemplate("acceptable-use-policy-confirmation")
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	body := setCommonEmailHeaders("[EdgeNet] Acceptable Use Policy Confirmed", from, to, delimiter)
-	t.Execute(&body, AUPData)
+	if err := t.Execute(&body, AUPData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setAUPExpiredContent to create an email body related to the acceptable use policy expired
-func setAUPExpiredContent(contentData interface{}, from string) ([]string, bytes.Buffer) {
+func setAUPExpiredContent(contentData interface{}, from string) ([]string, bytes.Buffer, error) {
 	AUPData := contentData.(CommonContentData)
 	// This represents receivers' email addresses
 	to := AUPData.CommonData.Email
 	// The HTML template
-	t, _ := template.ParseFiles("../../assets/templates/email/acceptable-use-policy-expired.html")
+	t, err := parseTemplate("acceptable-use-policy-expired")
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	body := setCommonEmailHeaders("[EdgeNet] Acceptable Use Policy Expired", from, to, delimiter)
-	t.Execute(&body, AUPData)
+	if err := t.Execute(&body, AUPData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
+
+	return to, body, nil
+}
+
+// setAUPUpdateContent to create an email body related to the acceptable use policy update
+func setAUPUpdateContent(contentData interface{}, from string) ([]string, bytes.Buffer, error) {
+	AUPData := contentData.(CommonContentData)
+	// This represents receivers' email addresses
+	to := AUPData.CommonData.Email
+	// The HTML template
+	t, err := parseTemplate("acceptable-use-policy-update")
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
+	delimiter := ""
+	body := setCommonEmailHeaders("[EdgeNet] Acceptable Use Policy Updated", from, to, delimiter)
+	if err := t.Execute(&body, AUPData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setAUPRenewalContent to create an email body related to the acceptable use policy renewal
-func setAUPRenewalContent(contentData interface{}, from string) ([]string, bytes.Buffer) {
+func setAUPRenewalContent(contentData interface{}, from string) ([]string, bytes.Buffer, error) {
 	AUPData := contentData.(CommonContentData)
 	// This represents receivers' email addresses
 	to := AUPData.CommonData.Email
 	// The HTML template
-	t, _ := template.ParseFiles("../../assets/templates/email/acceptable-use-policy-renewal.html")
+	t, err := parseTemplate("acceptable-use-policy-renewal")
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	body := setCommonEmailHeaders("[EdgeNet] Acceptable Use Policy Expiring", from, to, delimiter)
-	t.Execute(&body, AUPData)
+	if err := t.Execute(&body, AUPData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setAuthorityRequestContent to create an email body related to the authority creation activity
-func setAuthorityRequestContent(contentData interface{}, from string) ([]string, bytes.Buffer) {
+func setAuthorityRequestContent(contentData interface{}, from string) ([]string, bytes.Buffer, error) {
 	registrationData := contentData.(CommonContentData)
 	// This represents receivers' email addresses
 	to := registrationData.CommonData.Email
 	// The HTML template
-	t, _ := template.ParseFiles("../../assets/templates/email/authority-creation.html")
+	t, err := parseTemplate("authority-creation")
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	body := setCommonEmailHeaders("[EdgeNet] Authority Successfully Created", from, to, delimiter)
-	t.Execute(&body, registrationData)
+	if err := t.Execute(&body, registrationData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setAuthorityEmailVerificationContent to create an email body related to the email verification
-func setAuthorityEmailVerificationContent(contentData interface{}, from string) ([]string, bytes.Buffer) {
+func setAuthorityEmailVerificationContent(contentData interface{}, from string) ([]string, bytes.Buffer, error) {
 	verificationData := contentData.(VerifyContentData)
 	// This represents receivers' email addresses
 	to := verificationData.CommonData.Email
 	// The HTML template
-	t, _ := template.ParseFiles("../../assets/templates/email/authority-email-verification.html")
+	t, err := parseTemplate("authority-email-verification")
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	body := setCommonEmailHeaders("[EdgeNet] Authority Registration Request - Do You Confirm?", from, to, delimiter)
-	t.Execute(&body, verificationData)
+	if err := t.Execute(&body, verificationData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setAuthorityVerifiedAlertContent to create an email body related to the email verified alert
-func setAuthorityVerifiedAlertContent(contentData interface{}, from string, to []string) ([]string, bytes.Buffer) {
+func setAuthorityVerifiedAlertContent(contentData interface{}, from string, to []string) ([]string, bytes.Buffer, error) {
 	alertData := contentData.(CommonContentData)
 	// The HTML template
-	t, _ := template.ParseFiles("../../assets/templates/email/authority-email-verified-alert.html")
+	t, err := parseTemplate("authority-email-verified-alert")
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	body := setCommonEmailHeaders("[EdgeNet Admin] Authority Request - Email Verified", from, to, delimiter)
-	t.Execute(&body, alertData)
+	if err := t.Execute(&body, alertData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setUserRegistrationContent to create an email body related to the user registration activity
-func setUserRegistrationContent(contentData interface{}, from string) ([]string, bytes.Buffer) {
+func setUserRegistrationContent(contentData interface{}, from string) ([]string, bytes.Buffer, error) {
 	registrationData := contentData.(CommonContentData)
 	// This represents receivers' email addresses
 	to := registrationData.CommonData.Email
 	// The HTML template
-	t, _ := template.ParseFiles("../../assets/templates/email/user-registration.html")
-	delimiter := generateRandomString(10)
+	t, err := parseTemplate("user-registration")
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
+	delimiter := ""
 	body := setCommonEmailHeaders("[EdgeNet] User Registration Successful", from, to, delimiter)
-	t.Execute(&body, registrationData)
-
-	headers := fmt.Sprintf("--%s\r\n", delimiter)
-	headers += "Content-Type: text/plain; charset=\"utf-8\"\r\n"
-	headers += "Content-Transfer-Encoding: base64\r\n"
-	headers += "Content-Disposition: attachment;filename=\"edgenet-kubeconfig.cfg\"\r\n"
-	// Read the kubeconfig file created for web authentication
-	// It will be in the attachment of email
-	rawFile, fileErr := ioutil.ReadFile(fmt.Sprintf("../../assets/kubeconfigs/edgenet-authority-%s-%s.cfg", registrationData.CommonData.Authority,
-		registrationData.CommonData.Username))
-	if fileErr != nil {
-		log.Panic(fileErr)
+	if err := t.Execute(&body, registrationData); err != nil {
+		return nil, bytes.Buffer{}, err
 	}
-	attachment := "\r\n" + base64.StdEncoding.EncodeToString(rawFile)
-	body.Write([]byte(fmt.Sprintf("%s%s\r\n\r\n--%s--", headers, attachment, delimiter)))
 
-	return to, body
+	return to, body, nil
 }
 
 // setUserEmailVerificationContent to create an email body related to the email verification
-func setUserEmailVerificationContent(contentData interface{}, from, subject string) ([]string, bytes.Buffer) {
+func setUserEmailVerificationContent(contentData interface{}, from, subject string) ([]string, bytes.Buffer, error) {
 	verificationData := contentData.(VerifyContentData)
 	// This represents receivers' email addresses
 	to := verificationData.CommonData.Email
 	// The HTML template
-	t, _ := template.ParseFiles(fmt.Sprintf("../../assets/templates/email/%s.html", subject))
+	t, err := parseTemplate(subject)
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	title := "[EdgeNet] Email Verification"
 	switch subject {
@@ -483,25 +857,32 @@ func setUserEmailVerificationContent(contentData interface{}, from, subject stri
 		title = "[EdgeNet] User Updated - Email Verification"
 	}
 	body := setCommonEmailHeaders(title, from, to, delimiter)
-	t.Execute(&body, verificationData)
+	if err := t.Execute(&body, verificationData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // setUserVerifiedAlertContent to create an email body related to the email verified alert
-func setUserVerifiedAlertContent(contentData interface{}, from string, to []string, subject string) ([]string, bytes.Buffer) {
+func setUserVerifiedAlertContent(contentData interface{}, from string, to []string, subject string) ([]string, bytes.Buffer, error) {
 	alertData := contentData.(CommonContentData)
 	// This represents receivers' email addresses
 	if len(alertData.CommonData.Email) > 0 {
 		to = alertData.CommonData.Email
 	}
 	// The HTML template
-	t, _ := template.ParseFiles(fmt.Sprintf("../../assets/templates/email/%s.html", subject))
+	t, err := parseTemplate(subject)
+	if err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 	delimiter := ""
 	body := setCommonEmailHeaders("[EdgeNet] User Email Verified", from, to, delimiter)
-	t.Execute(&body, alertData)
+	if err := t.Execute(&body, alertData); err != nil {
+		return nil, bytes.Buffer{}, err
+	}
 
-	return to, body
+	return to, body, nil
 }
 
 // generateRandomString to have a unique string
@@ -1,10 +1,15 @@
 package mailer
 import (
-	
-	"testing"
-	"strings"
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/textproto"
+	"os"
+	"path/filepath"
 	"regexp"
-	"fmt"
+	"strings"
+	"testing"
+	"time"
 )
 func TestGenerateRandomString(t *testing.T) {
 
@@ -33,3 +38,289 @@ func TestGenerateRandomString(t *testing.T) {
 	}
 }
 }
+
+func TestTemplateDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetTemplateDir(templateDir)
+	SetTemplateDir(dir)
+	content := `<p>Hello {{.CommonData.Name}}, you joined {{.Name}} of {{.Authority}} in {{.ChildNamespace}}</p>`
+	if err := ioutil.WriteFile(filepath.Join(dir, "team-creation.html"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	contentData := ResourceAllocationData{Name: "demo", Authority: "edgenet", ChildNamespace: "authority-edgenet-team-demo"}
+	contentData.CommonData.Name = "John Doe"
+	contentData.CommonData.Email = []string{"john.doe@edge-net.org"}
+
+	to, body, err := setTeamContent(contentData, "no-reply@edge-net.org", "team-creation")
+	if err != nil {
+		t.Fatalf("template not rendered: %s", err)
+	}
+	if len(to) != 1 || to[0] != "john.doe@edge-net.org" {
+		t.Errorf("unexpected recipients: %v", to)
+	}
+	if !strings.Contains(body.String(), "Hello John Doe, you joined demo of edgenet in authority-edgenet-team-demo") {
+		t.Errorf("unexpected body: %s", body.String())
+	}
+	// A missing template is an error rather than an empty email
+	if _, _, err := setTeamContent(contentData, "no-reply@edge-net.org", "team-removal"); err == nil || !strings.Contains(err.Error(), "team-removal") {
+		t.Errorf("expected an error naming the missing template, got %v", err)
+	}
+}
+
+func TestAuditAddress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetTemplateDir(templateDir)
+	SetTemplateDir(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "team-creation.html"), []byte(`<p>{{.Name}}</p>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// No blind copy is sent by default
+	if recipients := envelopeRecipients([]string{"john.doe@edge-net.org"}); len(recipients) != 1 {
+		t.Errorf("unexpected recipients without audit address: %v", recipients)
+	}
+	defer SetAuditAddress("")
+	SetAuditAddress("audit@edge-net.org")
+	contentData := ResourceAllocationData{Name: "demo"}
+	contentData.CommonData.Email = []string{"john.doe@edge-net.org"}
+	to, body, err := setTeamContent(contentData, "no-reply@edge-net.org", "team-creation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients := envelopeRecipients(to)
+	if len(recipients) != 2 || recipients[1] != "audit@edge-net.org" {
+		t.Errorf("audit address not among the recipients: %v", recipients)
+	}
+	if len(to) != 1 {
+		t.Errorf("audit address added to the primary recipients: %v", to)
+	}
+	if strings.Contains(body.String(), "audit@edge-net.org") {
+		t.Errorf("audit address exposed in the headers: %s", body.String())
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	cases := []struct {
+		address string
+		valid   bool
+	}{
+		{"john.doe@edge-net.org", true},
+		{"john.doe+team@lip6.fr", true},
+		{"j@sub.edge-net.org", true},
+		{"", false},
+		{"john.doe", false},
+		{"john.doe@", false},
+		{"@edge-net.org", false},
+		{"john doe@edge-net.org", false},
+		{"john.doe@localhost", false},
+		{"john.doe@edge-net.org.", false},
+		{"John Doe <john.doe@edge-net.org>", false},
+		{"john.doe@edge-net.org, jane.doe@edge-net.org", false},
+	}
+	for _, c := range cases {
+		err := ValidateEmail(c.address)
+		if c.valid && err != nil {
+			t.Errorf("%q: unexpected error %s", c.address, err)
+		}
+		if !c.valid {
+			if _, ok := err.(*InvalidEmailError); !ok {
+				t.Errorf("%q: expected an invalid email error, got %v", c.address, err)
+			}
+		}
+	}
+}
+
+func TestSendDisabled(t *testing.T) {
+	deliveries := 0
+	defer func(original func(smtpServer, []string, bytes.Buffer) error) { transport = original }(transport)
+	transport = func(smtpServer smtpServer, to []string, body bytes.Buffer) error {
+		deliveries++
+		return nil
+	}
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	defer SetEnabled(enabled)
+	SetEnabled(false)
+
+	contentData := ResourceAllocationData{Name: "demo"}
+	contentData.CommonData.Email = []string{"john.doe@edge-net.org"}
+	if err := Send("team-creation", contentData); err != nil {
+		t.Errorf("disabled mailer failed: %s", err)
+	}
+	if deliveries != 0 {
+		t.Errorf("%d emails delivered while the mailer is disabled", deliveries)
+	}
+	if !strings.Contains(logged.String(), "team-creation") || !strings.Contains(logged.String(), "john.doe@edge-net.org") {
+		t.Errorf("intended email not logged: %s", logged.String())
+	}
+}
+
+func TestMultipleRecipients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetTemplateDir(templateDir)
+	SetTemplateDir(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "team-creation.html"), []byte(`<p>{{.Name}}</p>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The user has a personal and an institutional address, the malformed one is left out
+	recipients, invalid := ValidEmails([]string{"john.doe@edge-net.org", "john.doe@lip6.fr", "john.doe"})
+	if len(recipients) != 2 || len(invalid) != 1 {
+		t.Fatalf("unexpected recipients %v and errors %v", recipients, invalid)
+	}
+	contentData := ResourceAllocationData{Name: "demo"}
+	contentData.CommonData.Email = recipients
+	to, body, err := setTeamContent(contentData, "no-reply@edge-net.org", "team-creation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body.String(), "To: john.doe@edge-net.org, john.doe@lip6.fr\r\n") {
+		t.Errorf("both addresses not in the To header: %s", body.String())
+	}
+	if envelope := envelopeRecipients(to); len(envelope) != 2 {
+		t.Errorf("the message isn't addressed to both recipients: %v", envelope)
+	}
+}
+
+func TestTeamAuthorityUnresolvedContent(t *testing.T) {
+	contentData := ResourceAllocationData{Name: "demo", Users: []string{"lip6/ann", "nyu/bob"}}
+	contentData.CommonData.Email = []string{"john.doe@edge-net.org"}
+	to, body, err := setTeamContent(contentData, "no-reply@edge-net.org", "team-authority-unresolved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(to) != 1 || !strings.Contains(body.String(), "Subject: [EdgeNet] Team users unresolved") {
+		t.Errorf("email not addressed to the owner: %v", to)
+	}
+	for _, user := range contentData.Users {
+		if !strings.Contains(body.String(), user) {
+			t.Errorf("user %s not in the email", user)
+		}
+	}
+}
+
+func TestNodeContributionContent(t *testing.T) {
+	tests := []struct {
+		subject string
+		title   string
+		status  string
+		message []string
+	}{
+		{"node-contribution-successful", "[EdgeNet] Node Contribution - Successful", "Successful", []string{"Node installation successful"}},
+		{"node-contribution-failure", "[EdgeNet] Node Contribution - Failed", "Failure", []string{"SSH connection failed: i/o timeout"}},
+	}
+	for _, test := range tests {
+		contentData := MultiProviderData{Name: "lab", Host: "192.0.2.10", Node: "lip6.lab.edge-net.io", Status: test.status, Message: test.message}
+		contentData.CommonData.Email = []string{"john.doe@edge-net.org"}
+		to, body, err := setNodeContributionContent(contentData, "no-reply@edge-net.org", []string{"support@edge-net.org"}, test.subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(to) != 1 || to[0] != "john.doe@edge-net.org" || !strings.Contains(body.String(), "Subject: "+test.title) {
+			t.Errorf("%s email not addressed to the contributor: %v", test.subject, to)
+		}
+		for _, expected := range append([]string{contentData.Node, contentData.Host, test.status}, test.message...) {
+			if !strings.Contains(body.String(), expected) {
+				t.Errorf("%s not in the %s email", expected, test.subject)
+			}
+		}
+	}
+}
+
+// stubSMTP renders the team emails by a template of the name and replies to the deliveries as told in order,
+// the retries run at once and their delays are returned
+func stubSMTP(t *testing.T, replies ...error) (*int, *[]time.Duration) {
+	dir, err := ioutil.TempDir("", "mailer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	ioutil.WriteFile(filepath.Join(dir, "team-creation.html"), []byte(`<p>{{.Name}}</p>`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "smtp.yaml"), []byte("host: localhost\nport: \"25\"\nfrom: no-reply@edge-net.org\n"), 0644)
+	originalDir, originalPath, originalTransport, originalSchedule := templateDir, smtpConfigPath, transport, schedule
+	originalEnabled, originalDelay, originalRetries := enabled, greylistDelay, greylistRetries
+	t.Cleanup(func() {
+		templateDir, smtpConfigPath, transport, schedule = originalDir, originalPath, originalTransport, originalSchedule
+		enabled, greylistDelay, greylistRetries = originalEnabled, originalDelay, originalRetries
+	})
+	SetTemplateDir(dir)
+	smtpConfigPath = filepath.Join(dir, "smtp.yaml")
+	SetEnabled(true)
+	deliveries := 0
+	transport = func(smtpServer smtpServer, to []string, body bytes.Buffer) error {
+		deliveries++
+		if deliveries <= len(replies) {
+			return replies[deliveries-1]
+		}
+		return nil
+	}
+	delays := []time.Duration{}
+	schedule = func(delay time.Duration, retry func()) {
+		delays = append(delays, delay)
+		retry()
+	}
+	return &deliveries, &delays
+}
+
+func TestGreylisting(t *testing.T) {
+	greylisted := &textproto.Error{Code: 421, Msg: "4.7.0 Greylisted, try again later"}
+	deliveries, delays := stubSMTP(t, greylisted)
+	SetGreylistRetry(10*time.Minute, 3)
+	contentData := ResourceAllocationData{Name: "demo"}
+	contentData.CommonData.Email = []string{"john.doe@edge-net.org"}
+
+	// The greylisted email goes out on the retry after the delay, and isn't reported as delivered meanwhile
+	if err := Send("team-creation", contentData); !IsDeferred(err) || !IsTemporary(err) {
+		t.Errorf("greylisted email not deferred: %v", err)
+	}
+	if *deliveries != 2 {
+		t.Errorf("%d deliveries, expected the greylisted one and the retry", *deliveries)
+	}
+	if len(*delays) != 1 || (*delays)[0] != 10*time.Minute {
+		t.Errorf("retries scheduled after %v, expected one after the delay", *delays)
+	}
+
+	// The retries stop once exhausted
+	deliveries, delays = stubSMTP(t, greylisted, greylisted, greylisted, greylisted, greylisted)
+	SetGreylistRetry(time.Minute, 2)
+	Send("team-creation", contentData)
+	if *deliveries != 3 || len(*delays) != 2 {
+		t.Errorf("%d deliveries after %d retries, expected the retries configured", *deliveries, len(*delays))
+	}
+
+	// Without an outbox, the email enqueued is left pending to the caller rather than retried in the background
+	SetOutbox(nil)
+	deliveries, delays = stubSMTP(t, greylisted)
+	if err := Enqueue("demo/john.doe", "team-creation", contentData); !IsDeferred(err) {
+		t.Errorf("greylisted email not deferred: %v", err)
+	}
+	if *deliveries != 1 || len(*delays) != 0 {
+		t.Errorf("%d deliveries with %d retries, expected the caller to retry", *deliveries, len(*delays))
+	}
+}
+
+func TestPermanentRejection(t *testing.T) {
+	rejected := &textproto.Error{Code: 550, Msg: "5.1.1 Mailbox unavailable"}
+	deliveries, delays := stubSMTP(t, rejected)
+	contentData := ResourceAllocationData{Name: "demo"}
+	contentData.CommonData.Email = []string{"john.doe@edge-net.org"}
+
+	err := Send("team-creation", contentData)
+	if !IsPermanent(err) || IsTemporary(err) {
+		t.Errorf("error %v not a permanent rejection", err)
+	}
+	if *deliveries != 1 || len(*delays) != 0 {
+		t.Errorf("%d deliveries with %d retries, expected the rejected one only", *deliveries, len(*delays))
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mailer
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Constant variables for the results of the send attempts
+const success = "success"
+const failure = "failure"
+const deferred = "deferred"
+
+// MetricsRecorder records the send attempts, a recorder backed by a Prometheus registry can be plugged in
+type MetricsRecorder interface {
+	// ObserveSend records the attempt to send the email of the template, its result, and how long it took
+	ObserveSend(template, result string, latency time.Duration)
+}
+
+// latencyBuckets are the upper bounds of the send latency histogram in seconds
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metrics publishes the send attempts along with the other variables on /debug/vars by default
+var metrics MetricsRecorder = publishedMetrics()
+
+// SetMetricsRecorder configures the recorder of the send attempts, nil restores the one published on /debug/vars
+func SetMetricsRecorder(recorder MetricsRecorder) {
+	if recorder == nil {
+		recorder = publishedMetrics()
+	}
+	metrics = recorder
+}
+
+var published *expvarMetrics
+var publishOnce sync.Once
+
+// publishedMetrics returns the recorder whose variables are published, expvar allows publishing a name once only
+func publishedMetrics() *expvarMetrics {
+	publishOnce.Do(func() {
+		published = newExpvarMetrics()
+		expvar.Publish("edgenet_mailer_send_total", published.total)
+		expvar.Publish("edgenet_mailer_send_duration_seconds", published.duration)
+	})
+	return published
+}
+
+// expvarMetrics counts the send attempts by template and result, and keeps the histogram of their latency by template,
+// in which each bucket counts the attempts that took up to its bound as Prometheus histograms do
+type expvarMetrics struct {
+	total    *expvar.Map
+	duration *expvar.Map
+	mutex    sync.Mutex
+}
+
+func newExpvarMetrics() *expvarMetrics {
+	return &expvarMetrics{total: new(expvar.Map).Init(), duration: new(expvar.Map).Init()}
+}
+
+func (m *expvarMetrics) ObserveSend(template, result string, latency time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	results, ok := m.total.Get(template).(*expvar.Map)
+	if !ok {
+		results = new(expvar.Map).Init()
+		m.total.Set(template, results)
+	}
+	results.Add(result, 1)
+
+	histogram, ok := m.duration.Get(template).(*expvar.Map)
+	if !ok {
+		histogram = new(expvar.Map).Init()
+		for _, bound := range latencyBuckets {
+			histogram.Add(fmt.Sprintf("le_%g", bound), 0)
+		}
+		m.duration.Set(template, histogram)
+	}
+	seconds := latency.Seconds()
+	for _, bound := range latencyBuckets {
+		if seconds <= bound {
+			histogram.Add(fmt.Sprintf("le_%g", bound), 1)
+		}
+	}
+	histogram.Add("le_+Inf", 1)
+	histogram.AddFloat("sum", seconds)
+	histogram.Add("count", 1)
+}
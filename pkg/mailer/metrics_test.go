@@ -0,0 +1,106 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"expvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeRecorder keeps the send attempts by template and result
+type fakeRecorder struct {
+	attempts map[string]map[string]int
+}
+
+func (f *fakeRecorder) ObserveSend(template, result string, latency time.Duration) {
+	if f.attempts[template] == nil {
+		f.attempts[template] = map[string]int{}
+	}
+	f.attempts[template][result]++
+}
+
+func TestSendMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "team-creation.html"), []byte(`<p>{{.Name}}</p>`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "smtp.yaml"), []byte("host: localhost\nport: \"25\"\nfrom: no-reply@edge-net.org\n"), 0644)
+	defer SetTemplateDir(templateDir)
+	SetTemplateDir(dir)
+	defer func(original string) { smtpConfigPath = original }(smtpConfigPath)
+	smtpConfigPath = filepath.Join(dir, "smtp.yaml")
+	var deliveryErr error
+	defer func(original func(smtpServer, []string, bytes.Buffer) error) { transport = original }(transport)
+	transport = func(smtpServer smtpServer, to []string, body bytes.Buffer) error {
+		return deliveryErr
+	}
+	defer SetEnabled(enabled)
+	SetEnabled(true)
+	recorder := &fakeRecorder{attempts: map[string]map[string]int{}}
+	SetMetricsRecorder(recorder)
+	defer SetMetricsRecorder(nil)
+
+	contentData := ResourceAllocationData{Name: "demo"}
+	contentData.CommonData.Email = []string{"john.doe@edge-net.org"}
+	Send("team-creation", contentData)
+	Send("team-creation", contentData)
+	deliveryErr = errors.New("connection refused")
+	Send("team-creation", contentData)
+	// The email without a template fails to render
+	Send("team-removal", contentData)
+	expected := map[string]map[string]int{
+		"team-creation": {"success": 2, "failure": 1},
+		"team-removal":  {"failure": 1},
+	}
+	for template, results := range expected {
+		for result, count := range results {
+			if recorder.attempts[template][result] != count {
+				t.Errorf("%d %s attempts recorded for %s, expected %d", recorder.attempts[template][result], result, template, count)
+			}
+		}
+	}
+	// The disabled mailer doesn't attempt to send
+	SetEnabled(false)
+	Send("team-deletion", contentData)
+	if _, ok := recorder.attempts["team-deletion"]; ok {
+		t.Error("attempt recorded while the mailer is disabled")
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	metrics := newExpvarMetrics()
+	metrics.ObserveSend("team-creation", "success", 200*time.Millisecond)
+	metrics.ObserveSend("team-creation", "success", 3*time.Second)
+	metrics.ObserveSend("team-creation", "failure", time.Minute)
+
+	results := metrics.total.Get("team-creation").(*expvar.Map)
+	if results.Get("success").String() != "2" || results.Get("failure").String() != "1" {
+		t.Errorf("unexpected counters %s", results)
+	}
+	histogram := metrics.duration.Get("team-creation").(*expvar.Map)
+	buckets := map[string]string{"le_0.1": "0", "le_0.25": "1", "le_2.5": "1", "le_5": "2", "le_30": "2", "le_+Inf": "3", "count": "3"}
+	for bucket, count := range buckets {
+		if value := histogram.Get(bucket); value == nil || value.String() != count {
+			t.Errorf("bucket %s is %v, expected %s", bucket, value, count)
+		}
+	}
+	if histogram.Get("sum").String() != "63.2" {
+		t.Errorf("sum is %s, expected 63.2", histogram.Get("sum"))
+	}
+	// The published recorder is the same one whichever the number of times it is restored
+	SetMetricsRecorder(nil)
+	if publishedMetrics() != metricsOrNil() || expvar.Get("edgenet_mailer_send_total") == nil {
+		t.Error("recorder not published")
+	}
+}
+
+func metricsOrNil() *expvarMetrics {
+	recorder, _ := metrics.(*expvarMetrics)
+	return recorder
+}
@@ -0,0 +1,389 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mailer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// maxOutboxAttempts is the number of deliveries tried before a message is given up on
+const maxOutboxAttempts = 10
+
+// sentRetention is how long the sent messages, and those given up on, are kept in the outbox, during which the message
+// of the same key isn't sent again
+const sentRetention = 24 * time.Hour
+
+// claimTimeout is how long a claim on a message holds, after which the drain that claimed it, such as that of a
+// controller which crashed while sending, is assumed gone and the message can be claimed again
+const claimTimeout = 5 * time.Minute
+
+// OutboxMessage is an email waiting in the outbox, or sent recently, along with its delivery attempts
+type OutboxMessage struct {
+	Subject   string          `json:"subject"`
+	Kind      string          `json:"kind"`
+	Content   json.RawMessage `json:"content"`
+	Enqueued  time.Time       `json:"enqueued"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError,omitempty"`
+	Sent      *time.Time      `json:"sent,omitempty"`
+	// NextAttempt is the earliest time to retry the message that the server has rejected temporarily
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+	// Rejected tells that the server has rejected the message permanently, so it isn't retried
+	Rejected bool `json:"rejected,omitempty"`
+	// Claimed is the time that a drain claimed the message to send it, the other drains leave the message alone
+	// until the claim is released or times out
+	Claimed *time.Time `json:"claimed,omitempty"`
+}
+
+// Outbox persists the emails in a config map so that those not sent yet survive the restarts of the controllers
+type Outbox struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+	// send delivers a message, which tests replace to observe the deliveries
+	send  func(subject string, contentData interface{}) error
+	mutex sync.Mutex
+}
+
+// NewOutbox returns the outbox kept in the config map of the namespace, the config map is created on the first message
+func NewOutbox(clientset kubernetes.Interface, namespace, name string) *Outbox {
+	return &Outbox{clientset: clientset, namespace: namespace, name: name, send: attempt}
+}
+
+// outbox is nil by default, in which case the emails are sent right away
+var outbox *Outbox
+
+// SetOutbox configures the outbox that Enqueue puts the emails into, nil to send them right away
+func SetOutbox(value *Outbox) {
+	outbox = value
+}
+
+// Enqueue puts the email into the outbox if any, which retries it until it is delivered. Otherwise it makes a single
+// attempt to send the email, and the email that isn't delivered yet is left pending to the caller by a DeferredError,
+// such as the invitations that the team keeps pending. The key identifies the occurrence that the email is about,
+// such as a user joining a team, see Outbox.Enqueue
+func Enqueue(key, subject string, contentData interface{}) error {
+	if outbox == nil {
+		return sendOnce(subject, contentData)
+	}
+	return outbox.Enqueue(key, subject, contentData)
+}
+
+// Enqueue persists the email to be sent by Drain. The key identifies the occurrence that the email is about, so that
+// enqueuing the email of a key that is already in the outbox, such as by a reconcile that is retried, has no effect
+// while the same email about another occurrence is a distinct message
+func (o *Outbox) Enqueue(key, subject string, contentData interface{}) error {
+	if key == "" {
+		return fmt.Errorf("Mailer: %s email enqueued without a key", subject)
+	}
+	kind, err := contentKind(contentData)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(contentData)
+	if err != nil {
+		return err
+	}
+	id := messageID(subject, key)
+	return o.update(func(messages map[string]*OutboxMessage) bool {
+		if _, exists := messages[id]; exists {
+			return false
+		}
+		messages[id] = &OutboxMessage{Subject: subject, Kind: kind, Content: content, Enqueued: time.Now().UTC()}
+		return true
+	})
+}
+
+// Run drains the outbox periodically until the stop channel is closed, the first drain retries what the
+// previous run of the controller left unsent
+func (o *Outbox) Run(period time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := o.Drain(); err != nil {
+			log.Printf("Mailer: couldn't drain the outbox %s/%s: %s", o.namespace, o.name, err)
+		}
+	}, period, stopCh)
+}
+
+// Drain sends the messages not sent yet and marks them sent, the failed ones are retried on the next drain unless
+// the server has rejected them, either permanently or temporarily until the greylist delay passes. Each message is
+// claimed in the config map before it is sent, so that the drains of the controllers sharing the outbox don't send
+// the same message. The message whose drain stopped between sending and marking it sent goes out again once the claim
+// times out.
+func (o *Outbox) Drain() error {
+	// The drains of this controller take turns rather than contend for the claims
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	messages, err := o.messages()
+	if err != nil {
+		return err
+	}
+	for id, message := range messages {
+		if !claimable(message, time.Now()) {
+			continue
+		}
+		claimed, err := o.claim(id)
+		if err != nil {
+			return err
+		} else if !claimed {
+			continue
+		}
+		contentData, err := decodeContent(message.Kind, message.Content)
+		if err == nil {
+			// The message beyond the rate limit waits for a later drain without counting as an attempt
+			if wait := limiter.reserve(message.Subject, intendedRecipients(contentData)); wait > 0 {
+				log.Printf("Mailer: rate limit of %s emails to %s reached, deferring the email for %s", message.Subject, intendedRecipients(contentData), wait)
+				if err := o.release(id); err != nil {
+					return err
+				}
+				continue
+			}
+			err = o.send(message.Subject, contentData)
+		}
+		if err != nil {
+			log.Printf("Mailer: attempt %d to send %s email failed: %s", message.Attempts+1, message.Subject, err)
+			if err := o.markFailed(id, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := o.markSent(id); err != nil {
+			return err
+		}
+	}
+	return o.prune()
+}
+
+// claimable tells whether the message is due to be sent and no other drain holds a claim on it
+func claimable(message *OutboxMessage, now time.Time) bool {
+	if message.Sent != nil || message.Rejected || message.Attempts >= maxOutboxAttempts {
+		return false
+	}
+	if message.NextAttempt != nil && now.Before(*message.NextAttempt) {
+		return false
+	}
+	return message.Claimed == nil || now.Sub(*message.Claimed) > claimTimeout
+}
+
+// claim marks the message as being sent by this drain and returns whether the claim succeeded. The update fails
+// on conflict with that of another drain, in which case the claim is checked again against the message it stored.
+func (o *Outbox) claim(id string) (bool, error) {
+	claimed := false
+	err := o.update(func(messages map[string]*OutboxMessage) bool {
+		now := time.Now().UTC()
+		message, exists := messages[id]
+		claimed = exists && claimable(message, now)
+		if claimed {
+			message.Claimed = &now
+		}
+		return claimed
+	})
+	return claimed && err == nil, err
+}
+
+// release removes the claim on the message that is left for a later drain
+func (o *Outbox) release(id string) error {
+	return o.update(func(messages map[string]*OutboxMessage) bool {
+		message, exists := messages[id]
+		if !exists || message.Claimed == nil {
+			return false
+		}
+		message.Claimed = nil
+		return true
+	})
+}
+
+// markSent records that the message has been sent, marking it again keeps the time of the first delivery
+func (o *Outbox) markSent(id string) error {
+	return o.update(func(messages map[string]*OutboxMessage) bool {
+		message, exists := messages[id]
+		if !exists || message.Sent != nil {
+			return false
+		}
+		sent := time.Now().UTC()
+		message.Sent = &sent
+		message.Claimed = nil
+		message.Attempts++
+		message.LastError = ""
+		message.NextAttempt = nil
+		return true
+	})
+}
+
+// markFailed records the failed attempt to send the message, the message that the server has rejected temporarily
+// waits for the greylist delay, and the one rejected permanently is given up
+func (o *Outbox) markFailed(id string, failure error) error {
+	return o.update(func(messages map[string]*OutboxMessage) bool {
+		message, exists := messages[id]
+		if !exists || message.Sent != nil {
+			return false
+		}
+		message.Claimed = nil
+		message.Attempts++
+		message.LastError = failure.Error()
+		message.NextAttempt = nil
+		if IsTemporary(failure) {
+			nextAttempt := time.Now().UTC().Add(greylistDelay)
+			message.NextAttempt = &nextAttempt
+		} else if IsPermanent(failure) {
+			message.Rejected = true
+			log.Printf("Mailer: %s email rejected by the server", message.Subject)
+		} else if message.Attempts >= maxOutboxAttempts {
+			log.Printf("Mailer: %s email given up after %d attempts", message.Subject, message.Attempts)
+		}
+		return true
+	})
+}
+
+// prune removes the messages sent before the retention period, and those given up on that were enqueued before it
+func (o *Outbox) prune() error {
+	return o.update(func(messages map[string]*OutboxMessage) bool {
+		changed := false
+		for id, message := range messages {
+			sent := message.Sent != nil && time.Since(*message.Sent) > sentRetention
+			givenUp := message.Sent == nil && (message.Rejected || message.Attempts >= maxOutboxAttempts) && time.Since(message.Enqueued) > sentRetention
+			if sent || givenUp {
+				delete(messages, id)
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+// messages returns the messages in the outbox by their IDs
+func (o *Outbox) messages() (map[string]*OutboxMessage, error) {
+	configMap, err := o.clientset.CoreV1().ConfigMaps(o.namespace).Get(o.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return map[string]*OutboxMessage{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeMessages(configMap)
+}
+
+// update applies the change to the messages and stores them if changed, which creates the config map if missing
+func (o *Outbox) update(change func(messages map[string]*OutboxMessage) bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := o.clientset.CoreV1().ConfigMaps(o.namespace).Get(o.name, metav1.GetOptions{})
+		create := errors.IsNotFound(err)
+		if create {
+			configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: o.name, Namespace: o.namespace}}
+		} else if err != nil {
+			return err
+		}
+		messages, err := decodeMessages(configMap)
+		if err != nil {
+			return err
+		}
+		if !change(messages) {
+			return nil
+		}
+		configMap.Data = map[string]string{}
+		for id, message := range messages {
+			encoded, err := json.Marshal(message)
+			if err != nil {
+				return err
+			}
+			configMap.Data[id] = string(encoded)
+		}
+		if create {
+			_, err = o.clientset.CoreV1().ConfigMaps(o.namespace).Create(configMap)
+			// Another controller has created it meanwhile, the retry merges the change
+			if errors.IsAlreadyExists(err) {
+				return errors.NewConflict(corev1.Resource("configmaps"), o.name, err)
+			}
+			return err
+		}
+		_, err = o.clientset.CoreV1().ConfigMaps(o.namespace).Update(configMap)
+		return err
+	})
+}
+
+func decodeMessages(configMap *corev1.ConfigMap) (map[string]*OutboxMessage, error) {
+	messages := map[string]*OutboxMessage{}
+	for id, encoded := range configMap.Data {
+		message := &OutboxMessage{}
+		if err := json.Unmarshal([]byte(encoded), message); err != nil {
+			return nil, fmt.Errorf("message %s of the outbox is malformed: %s", id, err)
+		}
+		messages[id] = message
+	}
+	return messages, nil
+}
+
+// messageID derives the ID from the subject and the key so that the email about an occurrence is enqueued once
+func messageID(subject, key string) string {
+	hash := sha256.Sum256([]byte(subject + "/" + key))
+	return hex.EncodeToString(hash[:16])
+}
+
+// contentKind returns the name of the type of the content, by which Drain decodes it back
+func contentKind(contentData interface{}) (string, error) {
+	switch contentData.(type) {
+	case CommonContentData:
+		return "CommonContentData", nil
+	case ResourceAllocationData:
+		return "ResourceAllocationData", nil
+	case MultiProviderData:
+		return "MultiProviderData", nil
+	case VerifyContentData:
+		return "VerifyContentData", nil
+	case ValidationFailureContentData:
+		return "ValidationFailureContentData", nil
+	}
+	return "", fmt.Errorf("Mailer: content of type %T cannot be enqueued", contentData)
+}
+
+func decodeContent(kind string, content []byte) (interface{}, error) {
+	var err error
+	switch kind {
+	case "CommonContentData":
+		contentData := CommonContentData{}
+		err = json.Unmarshal(content, &contentData)
+		return contentData, err
+	case "ResourceAllocationData":
+		contentData := ResourceAllocationData{}
+		err = json.Unmarshal(content, &contentData)
+		return contentData, err
+	case "MultiProviderData":
+		contentData := MultiProviderData{}
+		err = json.Unmarshal(content, &contentData)
+		return contentData, err
+	case "VerifyContentData":
+		contentData := VerifyContentData{}
+		err = json.Unmarshal(content, &contentData)
+		return contentData, err
+	case "ValidationFailureContentData":
+		contentData := ValidationFailureContentData{}
+		err = json.Unmarshal(content, &contentData)
+		return contentData, err
+	}
+	return nil, fmt.Errorf("Mailer: unknown content kind %s", kind)
+}
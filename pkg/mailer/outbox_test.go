@@ -0,0 +1,290 @@
+package mailer
+
+import (
+	"errors"
+	"net/textproto"
+	"reflect"
+	"testing"
+	"time"
+
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeSender records the emails sent and fails as many times as told beforehand
+type fakeSender struct {
+	sent     []interface{}
+	failures int
+}
+
+func (f *fakeSender) send(subject string, contentData interface{}) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("smtp server unavailable")
+	}
+	f.sent = append(f.sent, contentData)
+	return nil
+}
+
+func invitation() ResourceAllocationData {
+	contentData := ResourceAllocationData{}
+	contentData.CommonData.Authority = "edgenet"
+	contentData.CommonData.Username = "joe"
+	contentData.CommonData.Email = []string{"joe@edge-net.org"}
+	contentData.Name = "lab"
+	contentData.OwnerNamespace = "authority-edgenet"
+	contentData.ChildNamespace = "authority-edgenet-team-lab"
+	return contentData
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	clientset := testclient.NewSimpleClientset()
+	// The controller enqueues the invitation and crashes before sending it
+	crashed := NewOutbox(clientset, "edgenet", "outbox")
+	crashed.send = func(subject string, contentData interface{}) error {
+		t.Errorf("%s email sent before the crash", subject)
+		return nil
+	}
+	if err := crashed.Enqueue("lab/joe", "team-creation", invitation()); err != nil {
+		t.Fatalf("enqueue failed: %s", err)
+	}
+
+	// The restarted controller finds the invitation in the config map and retries until it goes out
+	sender := &fakeSender{failures: 1}
+	restarted := NewOutbox(clientset, "edgenet", "outbox")
+	restarted.send = sender.send
+	if err := restarted.Drain(); err != nil {
+		t.Fatalf("drain failed: %s", err)
+	}
+	if len(sender.sent) != 0 {
+		t.Fatalf("email sent despite the failure: %v", sender.sent)
+	}
+	messages, _ := restarted.messages()
+	for _, message := range messages {
+		if message.Sent != nil || message.Attempts != 1 || message.LastError == "" {
+			t.Errorf("failed attempt not recorded: %+v", message)
+		}
+	}
+	if err := restarted.Drain(); err != nil {
+		t.Fatalf("drain failed: %s", err)
+	}
+	if len(sender.sent) != 1 || !reflect.DeepEqual(sender.sent[0], invitation()) {
+		t.Fatalf("sent %v, expected the invitation once", sender.sent)
+	}
+	messages, _ = restarted.messages()
+	if len(messages) != 1 {
+		t.Fatalf("%d messages in the outbox, expected 1", len(messages))
+	}
+	for _, message := range messages {
+		if message.Sent == nil || message.Attempts != 2 || message.LastError != "" {
+			t.Errorf("delivery not recorded: %+v", message)
+		}
+	}
+}
+
+func TestOutboxIdempotence(t *testing.T) {
+	sender := &fakeSender{}
+	outbox := NewOutbox(testclient.NewSimpleClientset(), "edgenet", "outbox")
+	outbox.send = sender.send
+	// The same invitation enqueued by a reconcile that is retried is a single message
+	for i := 0; i < 2; i++ {
+		if err := outbox.Enqueue("lab/joe", "team-creation", invitation()); err != nil {
+			t.Fatalf("enqueue failed: %s", err)
+		}
+	}
+	if messages, _ := outbox.messages(); len(messages) != 1 {
+		t.Fatalf("%d messages in the outbox, expected 1", len(messages))
+	}
+	outbox.Drain()
+	// Neither the drains nor the enqueues after the delivery send it again
+	outbox.Enqueue("lab/joe", "team-creation", invitation())
+	outbox.Drain()
+	if len(sender.sent) != 1 {
+		t.Errorf("invitation sent %d times, expected once", len(sender.sent))
+	}
+
+	messages, _ := outbox.messages()
+	for id, message := range messages {
+		sent := *message.Sent
+		if err := outbox.markSent(id); err != nil {
+			t.Fatalf("marking sent again failed: %s", err)
+		}
+		if err := outbox.markFailed(id, errors.New("late failure")); err != nil {
+			t.Fatalf("marking failed after sent failed: %s", err)
+		}
+		marked, _ := outbox.messages()
+		if !marked[id].Sent.Equal(sent) || marked[id].Attempts != message.Attempts || marked[id].LastError != "" {
+			t.Errorf("message marked again: %+v, expected %+v", marked[id], message)
+		}
+	}
+	// Another email to the same user is a distinct message
+	other := invitation()
+	other.Name = "other"
+	outbox.Enqueue("other/joe", "team-creation", other)
+	if messages, _ := outbox.messages(); len(messages) != 2 {
+		t.Errorf("%d messages in the outbox, expected 2", len(messages))
+	}
+	// The same email about another occurrence, such as the user invited again, is a distinct message too
+	outbox.Enqueue("lab/joe/rejoined", "team-creation", invitation())
+	if messages, _ := outbox.messages(); len(messages) != 3 {
+		t.Errorf("%d messages in the outbox, expected 3", len(messages))
+	}
+	if err := outbox.Enqueue("", "team-creation", invitation()); err == nil {
+		t.Error("email enqueued without a key")
+	}
+}
+
+func TestOutboxPrune(t *testing.T) {
+	outbox := NewOutbox(testclient.NewSimpleClientset(), "edgenet", "outbox")
+	outbox.send = (&fakeSender{}).send
+	expired := time.Now().Add(-sentRetention - time.Hour)
+	recent := time.Now()
+	outbox.update(func(messages map[string]*OutboxMessage) bool {
+		messages["sent"] = &OutboxMessage{Subject: "team-creation", Enqueued: expired, Sent: &expired}
+		messages["rejected"] = &OutboxMessage{Subject: "team-creation", Enqueued: expired, Attempts: 1, Rejected: true}
+		messages["given-up"] = &OutboxMessage{Subject: "team-creation", Enqueued: expired, Attempts: maxOutboxAttempts}
+		messages["recently-rejected"] = &OutboxMessage{Subject: "team-creation", Enqueued: recent, Attempts: 1, Rejected: true}
+		messages["greylisted"] = &OutboxMessage{Subject: "team-creation", Enqueued: expired, Attempts: 1, NextAttempt: &recent}
+		return true
+	})
+	if err := outbox.prune(); err != nil {
+		t.Fatalf("prune failed: %s", err)
+	}
+	messages, _ := outbox.messages()
+	for _, id := range []string{"sent", "rejected", "given-up"} {
+		if _, exists := messages[id]; exists {
+			t.Errorf("%s message kept after the retention period", id)
+		}
+	}
+	for _, id := range []string{"recently-rejected", "greylisted"} {
+		if _, exists := messages[id]; !exists {
+			t.Errorf("%s message pruned", id)
+		}
+	}
+}
+
+func TestEnqueueWithoutOutbox(t *testing.T) {
+	SetOutbox(nil)
+	SetEnabled(false)
+	defer SetEnabled(true)
+	if err := Enqueue("lab/joe", "team-creation", invitation()); err != nil {
+		t.Errorf("enqueue without an outbox failed: %s", err)
+	}
+	if err := NewOutbox(testclient.NewSimpleClientset(), "edgenet", "outbox").Enqueue("lab/joe", "team-creation", "content"); err == nil {
+		t.Error("content of an unknown type enqueued")
+	}
+}
+
+func TestOutboxGreylisting(t *testing.T) {
+	defer SetGreylistRetry(greylistDelay, greylistRetries)
+	SetGreylistRetry(time.Hour, 3)
+	replies := []error{&textproto.Error{Code: 421, Msg: "Greylisted"}}
+	sent := 0
+	outbox := NewOutbox(testclient.NewSimpleClientset(), "edgenet", "outbox")
+	outbox.send = func(subject string, contentData interface{}) error {
+		if len(replies) != 0 {
+			reply := replies[0]
+			replies = replies[1:]
+			return reply
+		}
+		sent++
+		return nil
+	}
+	outbox.Enqueue("lab/joe", "team-creation", invitation())
+
+	// The greylisted message waits for the delay rather than being retried on the next drain
+	outbox.Drain()
+	outbox.Drain()
+	messages, _ := outbox.messages()
+	for id, message := range messages {
+		if sent != 0 || message.Attempts != 1 || message.NextAttempt == nil {
+			t.Fatalf("greylisted message not deferred: %+v", message)
+		}
+		outbox.update(func(messages map[string]*OutboxMessage) bool {
+			elapsed := time.Now().Add(-time.Minute)
+			messages[id].NextAttempt = &elapsed
+			return true
+		})
+	}
+	outbox.Drain()
+	if sent != 1 {
+		t.Errorf("greylisted message sent %d times after the delay, expected once", sent)
+	}
+
+	// The message rejected permanently is given up at once
+	replies = []error{&textproto.Error{Code: 550, Msg: "Mailbox unavailable"}}
+	other := invitation()
+	other.Name = "other"
+	outbox.Enqueue("other/joe", "team-creation", other)
+	outbox.Drain()
+	outbox.Drain()
+	messages, _ = outbox.messages()
+	for _, message := range messages {
+		if message.Sent == nil && (!message.Rejected || message.Attempts != 1) {
+			t.Errorf("rejected message retried: %+v", message)
+		}
+	}
+	if sent != 1 {
+		t.Errorf("rejected message sent")
+	}
+}
+
+func TestOutboxSharedByControllers(t *testing.T) {
+	clientset := testclient.NewSimpleClientset()
+	// Two controllers drain the same outbox, the second one while the first is sending
+	sent := 0
+	first := NewOutbox(clientset, "edgenet", "outbox")
+	second := NewOutbox(clientset, "edgenet", "outbox")
+	second.send = func(subject string, contentData interface{}) error {
+		sent++
+		return nil
+	}
+	first.send = func(subject string, contentData interface{}) error {
+		if err := second.Drain(); err != nil {
+			t.Errorf("drain of the second controller failed: %s", err)
+		}
+		sent++
+		return nil
+	}
+	first.Enqueue("lab/joe", "team-creation", invitation())
+
+	if err := first.Drain(); err != nil {
+		t.Fatalf("drain failed: %s", err)
+	}
+	if sent != 1 {
+		t.Errorf("email sent %d times, expected once", sent)
+	}
+	messages, _ := first.messages()
+	for _, message := range messages {
+		if message.Sent == nil || message.Claimed != nil {
+			t.Errorf("delivery not recorded: %+v", message)
+		}
+	}
+}
+
+func TestOutboxStaleClaim(t *testing.T) {
+	sender := &fakeSender{}
+	outbox := NewOutbox(testclient.NewSimpleClientset(), "edgenet", "outbox")
+	outbox.send = sender.send
+	outbox.Enqueue("lab/joe", "team-creation", invitation())
+	claim := func(claimed time.Time) {
+		outbox.update(func(messages map[string]*OutboxMessage) bool {
+			for _, message := range messages {
+				message.Claimed = &claimed
+			}
+			return true
+		})
+	}
+
+	// The message that another controller is sending is left alone
+	claim(time.Now())
+	outbox.Drain()
+	if len(sender.sent) != 0 {
+		t.Fatalf("message claimed by another controller sent: %v", sender.sent)
+	}
+	// The controller that claimed the message is gone once the claim times out
+	claim(time.Now().Add(-claimTimeout - time.Minute))
+	outbox.Drain()
+	if len(sender.sent) != 1 {
+		t.Errorf("message of the stale claim sent %d times, expected once", len(sender.sent))
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mailer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimiter counts the emails of each template that each recipient has got within the period, so that a burst of
+// identical emails, such as one that a misconfigured resync triggers, doesn't get the server blocklisted as a spammer
+type rateLimiter struct {
+	// limit is the number of emails of a template per recipient and period, 0 for no limit
+	limit int
+	// templates override the limit of the templates given, 0 for no limit
+	templates map[string]int
+	period    time.Duration
+	sent      map[string][]time.Time
+	mutex     sync.Mutex
+}
+
+// limiter has no limit by default
+var limiter = &rateLimiter{sent: map[string][]time.Time{}}
+
+// now returns the current time, which tests replace to move the time forward
+var now = time.Now
+
+// SetRateLimit configures how many emails of each template a recipient gets within the period at most, the excess is
+// deferred until the period allows it. The limits given by template override the default one, 0 removes the limit.
+func SetRateLimit(limit int, period time.Duration, templates map[string]int) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.limit = limit
+	limiter.period = period
+	limiter.templates = templates
+	limiter.sent = map[string][]time.Time{}
+}
+
+// reserve counts the email of the template to the recipients and returns 0 if none of them has reached the limit,
+// otherwise it counts nothing and returns how long to wait until all of them can get it
+func (l *rateLimiter) reserve(template string, recipients []string) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	limit := l.limit
+	if templateLimit, ok := l.templates[template]; ok {
+		limit = templateLimit
+	}
+	if limit <= 0 || l.period <= 0 {
+		return 0
+	}
+	current := now()
+	var wait time.Duration
+	for _, recipient := range recipients {
+		key := fmt.Sprintf("%s/%s", template, recipient)
+		// The emails sent before the period don't count anymore
+		recent := l.sent[key][:0]
+		for _, sent := range l.sent[key] {
+			if current.Sub(sent) < l.period {
+				recent = append(recent, sent)
+			}
+		}
+		l.sent[key] = recent
+		if len(recent) >= limit {
+			if untilFree := recent[len(recent)-limit].Add(l.period).Sub(current); untilFree > wait {
+				wait = untilFree
+			}
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+	for _, recipient := range recipients {
+		key := fmt.Sprintf("%s/%s", template, recipient)
+		l.sent[key] = append(l.sent[key], current)
+	}
+	return 0
+}
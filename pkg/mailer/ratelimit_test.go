@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitDefersExcess(t *testing.T) {
+	deliveries, _ := stubSMTP(t)
+	current := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	defer func(original func() time.Time) { now = original }(now)
+	now = func() time.Time { return current }
+	// The deferred emails are held to be run once the time has moved forward
+	var deferred []func()
+	var delays []time.Duration
+	schedule = func(delay time.Duration, retry func()) {
+		delays = append(delays, delay)
+		deferred = append(deferred, retry)
+	}
+	SetRateLimit(2, time.Minute, nil)
+	defer SetRateLimit(0, 0, nil)
+	johnDoe := ResourceAllocationData{Name: "demo"}
+	johnDoe.CommonData.Email = []string{"john.doe@edge-net.org"}
+	janeDoe := ResourceAllocationData{Name: "demo"}
+	janeDoe.CommonData.Email = []string{"jane.doe@edge-net.org"}
+
+	for i := 0; i < 3; i++ {
+		if err := Send("team-creation", johnDoe); err != nil && (i < 2 || !IsDeferred(err)) {
+			t.Fatal(err)
+		}
+		current = current.Add(10 * time.Second)
+	}
+	if *deliveries != 2 || len(delays) != 1 {
+		t.Fatalf("%d deliveries and %d deferred, expected the third email deferred", *deliveries, len(delays))
+	}
+	// The third email waits until the first one is out of the period
+	if delays[0] != 40*time.Second {
+		t.Errorf("email deferred for %s, expected 40s", delays[0])
+	}
+	// The limit applies to each recipient separately
+	if err := Send("team-creation", janeDoe); err != nil || *deliveries != 3 {
+		t.Errorf("email to another recipient not sent: %d deliveries, %v", *deliveries, err)
+	}
+
+	current = current.Add(delays[0])
+	deferred[0]()
+	if *deliveries != 4 || len(delays) != 1 {
+		t.Errorf("%d deliveries and %d deferred, expected the deferred email sent", *deliveries, len(delays))
+	}
+}
+
+func TestRateLimitByTemplate(t *testing.T) {
+	deliveries, _ := stubSMTP(t)
+	deferrals := 0
+	schedule = func(delay time.Duration, retry func()) { deferrals++ }
+	SetRateLimit(1, time.Hour, map[string]int{"team-creation": 0})
+	defer SetRateLimit(0, 0, nil)
+	contentData := ResourceAllocationData{Name: "demo"}
+	contentData.CommonData.Email = []string{"john.doe@edge-net.org"}
+
+	// The template without a limit isn't deferred despite the default limit
+	for i := 0; i < 5; i++ {
+		Send("team-creation", contentData)
+	}
+	if *deliveries != 5 || deferrals != 0 {
+		t.Errorf("%d deliveries and %d deferrals, expected all the emails of the unlimited template sent", *deliveries, deferrals)
+	}
+
+	if got := limiter.reserve("slice-reminder", []string{"a@edge-net.org", "b@edge-net.org"}); got != 0 {
+		t.Errorf("first email deferred for %s", got)
+	}
+	// An email to several recipients waits for all of them, and nothing is counted while it waits
+	if got := limiter.reserve("slice-reminder", []string{"c@edge-net.org", "a@edge-net.org"}); got == 0 {
+		t.Error("email to a recipient at the limit not deferred")
+	}
+	if got := limiter.reserve("slice-reminder", []string{"c@edge-net.org"}); got != 0 {
+		t.Errorf("recipient counted by a deferred email: deferred for %s", got)
+	}
+}
@@ -17,15 +17,25 @@ limitations under the License.
 package namespace
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
 	"log"
+	"regexp"
+	"strings"
 
 	"k8s.io/client-go/kubernetes"
 
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+// The length of the hash suffix appended to the child namespace names that exceed the limit
+const childNameHashLength = 10
+
 
 // Create function checks namespace occupied or not and uses clientset to create a namespace
 func Create(name string, clientset kubernetes.Interface) (string, error) {
@@ -104,3 +114,178 @@ func GetNamespaceByName(name string, clientset kubernetes.Interface) (string, er
 	}
 }
 
+// The formats of the namespace names. That of the authority namespaces takes the authority name, and that of the
+// child namespaces takes the parent namespace, the kind, and the name of the resource, in that order unless the
+// format indexes them as in "%[3]s-%[1]s". Clusters that share a registry in a federation can include their
+// identifier in the formats so that their namespace names don't collide.
+var authorityNameFormat = "authority-%s"
+var childNameFormat = "%s-%s-%s"
+
+// SetNameFormats configures the formats of the authority namespace names and of the child namespace names. It
+// returns an error and keeps the former formats if either format leaves out a name or makes invalid namespace names.
+func SetNameFormats(authorityFormat, childFormat string) error {
+	if strings.Count(authorityFormat, "%") != 1 || strings.Count(authorityFormat, "%s") != 1 {
+		return fmt.Errorf("authority namespace format %q must contain the authority name as %%s only", authorityFormat)
+	}
+	if err := ValidateName(fmt.Sprintf(authorityFormat, "edgenet")); err != nil {
+		return fmt.Errorf("authority namespace format %q: %s", authorityFormat, err)
+	}
+	sample := fmt.Sprintf(childFormat, "parent", "kind", "name")
+	if strings.Contains(sample, "%!") || !strings.Contains(sample, "parent") || !strings.Contains(sample, "kind") || !strings.Contains(sample, "name") {
+		return fmt.Errorf("child namespace format %q must contain the parent namespace, the kind, and the name", childFormat)
+	}
+	if err := ValidateName(sample); err != nil {
+		return fmt.Errorf("child namespace format %q: %s", childFormat, err)
+	}
+	authorityNameFormat = authorityFormat
+	childNameFormat = childFormat
+	return nil
+}
+
+// The formats of the namespace names given by the options, which LoadNameFormats applies once they are parsed
+var authorityNameFormatOption, childNameFormatOption string
+
+// AddFlags declares the options of the namespace name formats in the flag set given, so that the commands of the
+// controllers share them
+func AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&authorityNameFormatOption, "authority-namespace-format", authorityNameFormat, "format of the authority namespace names, which takes the authority name, such as east-authority-%s to include the cluster in a federation")
+	fs.StringVar(&childNameFormatOption, "child-namespace-format", childNameFormat, "format of the child namespace names, which takes the parent namespace, the kind, such as team, and the name of the resource")
+}
+
+// LoadNameFormats configures the formats of the namespace names from the options once they are parsed, see SetNameFormats
+func LoadNameFormats() error {
+	return SetNameFormats(authorityNameFormatOption, childNameFormatOption)
+}
+
+// AuthorityName returns the name of the namespace of the authority
+func AuthorityName(authority string) string {
+	return fmt.Sprintf(authorityNameFormat, authority)
+}
+
+// AuthorityOf returns the authority whose namespace has the name given, and whether the name is that of an
+// authority namespace
+func AuthorityOf(namespace string) (string, bool) {
+	affixes := strings.SplitN(authorityNameFormat, "%s", 2)
+	if len(namespace) <= len(affixes[0])+len(affixes[1]) || !strings.HasPrefix(namespace, affixes[0]) || !strings.HasSuffix(namespace, affixes[1]) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(namespace, affixes[0]), affixes[1]), true
+}
+
+// The kinds of the resources that own child namespaces
+var childKinds = []string{"team", "slice"}
+
+// AuthorityOfNamespace derives the authority to which the namespace belongs, which its authority-name label should
+// tell, from its name and owner labels. The child namespaces of teams and slices tell it by the parent namespace in
+// their names, and the authority namespaces by their names. It returns false when the authority cannot be derived,
+// such as for the child names truncated to fit in the limit, or for a namespace without owner labels that is named
+// as a child namespace, as the part of the name that is the authority is ambiguous then.
+func AuthorityOfNamespace(namespace *apiv1.Namespace) (string, bool) {
+	labels := namespace.GetLabels()
+	switch owner := labels["owner"]; owner {
+	case "team", "slice":
+		return authorityOfChild(namespace.GetName(), owner, labels["owner-name"])
+	case "", "authority":
+		if owner == "" {
+			for _, kind := range childKinds {
+				if _, ok := authorityOfChild(namespace.GetName(), kind, ""); ok {
+					return "", false
+				}
+			}
+		}
+		return AuthorityOf(namespace.GetName())
+	}
+	return "", false
+}
+
+// authorityOfChild returns the authority of the child namespace that a resource of the kind and name given creates in
+// the namespace of the authority, an empty name matches the child namespaces of any resource of the kind
+func authorityOfChild(childName, kind, name string) (string, bool) {
+	// The markers stand for the authority and the resource name, namespace names cannot contain them
+	const authorityMarker, nameMarker = "\x00", "\x01"
+	if name == "" {
+		name = nameMarker
+	}
+	pattern := regexp.QuoteMeta(fmt.Sprintf(childNameFormat, AuthorityName(authorityMarker), kind, name))
+	pattern = strings.Replace(pattern, authorityMarker, "(.+)", 1)
+	pattern = strings.Replace(pattern, nameMarker, ".+", 1)
+	matches := regexp.MustCompile("^" + pattern + "$").FindStringSubmatch(childName)
+	if matches == nil {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// ChildName returns the name of the namespace that a resource creates in its parent namespace, such as
+// "<parent>-team-<name>". The name is kept as is when it fits in the namespace name limit. Otherwise, it is
+// truncated and suffixed by a hash of the full name, so the result is deterministic and long parent and
+// resource names that share a prefix don't end up in the same namespace.
+func ChildName(parent, kind, name string) string {
+	childName := fmt.Sprintf(childNameFormat, parent, kind, name)
+	if len(childName) <= validation.DNS1123LabelMaxLength {
+		return childName
+	}
+	hash := sha256.Sum256([]byte(childName))
+	prefix := strings.TrimRight(childName[:validation.DNS1123LabelMaxLength-childNameHashLength-1], "-.")
+	return fmt.Sprintf("%s-%s", prefix, hex.EncodeToString(hash[:])[:childNameHashLength])
+}
+
+// ChildNamesCollide tells whether two resources of the kind with distinct names in the parent namespace would share
+// a child namespace. It happens when a name is the truncated and hashed form of the other one, as ChildName returns.
+func ChildNamesCollide(parent, kind, name, other string) bool {
+	return name != other && ChildName(parent, kind, name) == ChildName(parent, kind, other)
+}
+
+// ValidateName returns an error if the name cannot be used as a namespace name
+func ValidateName(name string) error {
+	if msgs := validation.IsDNS1123Label(name); len(msgs) > 0 {
+		return fmt.Errorf("namespace name %q is invalid: %s", name, strings.Join(msgs, ", "))
+	}
+	return nil
+}
+
+// propagationPrefix selects the labels and annotations that child namespaces inherit from their parents,
+// such as the cost center or the region of an authority, none of them if empty
+var propagationPrefix string
+
+// SetPropagationPrefix configures the prefix of the label and annotation keys to propagate to child namespaces
+func SetPropagationPrefix(prefix string) {
+	propagationPrefix = prefix
+}
+
+// PropagateMetadata copies the labels and annotations with the propagation prefix from the parent
+// namespace to the child namespace, and removes those that the parent no longer has.
+// It returns whether the child namespace has changed.
+func PropagateMetadata(parent, child *apiv1.Namespace) bool {
+	if propagationPrefix == "" {
+		return false
+	}
+	labels, labelsChanged := propagate(parent.GetLabels(), child.GetLabels())
+	annotations, annotationsChanged := propagate(parent.GetAnnotations(), child.GetAnnotations())
+	child.SetLabels(labels)
+	child.SetAnnotations(annotations)
+	return labelsChanged || annotationsChanged
+}
+
+// propagate returns the child map synced with the keys of the parent map that have the propagation prefix
+func propagate(parent, child map[string]string) (map[string]string, bool) {
+	changed := false
+	synced := map[string]string{}
+	for key, value := range child {
+		if _, exists := parent[key]; strings.HasPrefix(key, propagationPrefix) && !exists {
+			changed = true
+			continue
+		}
+		synced[key] = value
+	}
+	for key, value := range parent {
+		if current, exists := synced[key]; strings.HasPrefix(key, propagationPrefix) && (!exists || current != value) {
+			synced[key] = value
+			changed = true
+		}
+	}
+	if len(synced) == 0 && child == nil {
+		return nil, changed
+	}
+	return synced, changed
+}
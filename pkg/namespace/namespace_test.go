@@ -1,7 +1,10 @@
 package namespace
 import (
+	"flag"
 	"testing"
 	"fmt"
+	"reflect"
+	"strings"
 	testclient "k8s.io/client-go/kubernetes/fake"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -114,3 +117,217 @@ func TestGetNamespaceByName(t *testing.T) {
 		}
 	}
 }
+
+func TestChildName(t *testing.T) {
+	longAuthority := fmt.Sprintf("authority-%s", strings.Repeat("a", 45))
+	longTeam := strings.Repeat("b", 40)
+	cases := []struct {
+		parent   string
+		name     string
+		expected string
+	}{
+		{"authority-edgenet", "demo", "authority-edgenet-team-demo"},
+		{longAuthority, longTeam, ""},
+		{longAuthority, longTeam + "c", ""},
+	}
+	names := map[string]bool{}
+	for _, c := range cases {
+		output := ChildName(c.parent, "team", c.name)
+		if c.expected != "" && output != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, output)
+		}
+		if err := ValidateName(output); err != nil {
+			t.Error(err)
+		}
+		if output != ChildName(c.parent, "team", c.name) {
+			t.Errorf("%s is not deterministic", output)
+		}
+		if names[output] {
+			t.Errorf("%s collides", output)
+		}
+		names[output] = true
+	}
+	if err := ValidateName(fmt.Sprintf("%s-team-%s", longAuthority, longTeam)); err == nil {
+		t.Error("name longer than the limit passed the validation")
+	}
+}
+
+func TestChildNamesCollide(t *testing.T) {
+	longTeam := strings.Repeat("b", 50)
+	// A team named after the truncated child namespace of another one gets the same namespace untruncated
+	squatter := strings.TrimPrefix(ChildName("authority-edgenet", "team", longTeam), "authority-edgenet-team-")
+	cases := []struct {
+		name     string
+		other    string
+		expected bool
+	}{
+		{"demo", "demo", false},
+		{"demo", "other", false},
+		{longTeam, longTeam + "c", false},
+		{longTeam, squatter, true},
+		{squatter, longTeam, true},
+	}
+	for _, c := range cases {
+		if output := ChildNamesCollide("authority-edgenet", "team", c.name, c.other); output != c.expected {
+			t.Errorf("ChildNamesCollide(%s, %s) = %t, expected %t", c.name, c.other, output, c.expected)
+		}
+	}
+	// The names collide only after truncation
+	if fmt.Sprintf("authority-edgenet-team-%s", longTeam) == fmt.Sprintf("authority-edgenet-team-%s", squatter) {
+		t.Error("names collide before truncation")
+	}
+}
+
+func TestPropagateMetadata(t *testing.T) {
+	SetPropagationPrefix("policy.edge-net.io/")
+	defer SetPropagationPrefix("")
+	parent := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet",
+		Labels:      map[string]string{"owner": "authority", "policy.edge-net.io/cost-center": "lip6", "policy.edge-net.io/region": "eu"},
+		Annotations: map[string]string{"policy.edge-net.io/contact": "ops@edge-net.org", "note": "not propagated"}}}
+	child := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-team-demo",
+		Labels: map[string]string{"owner": "team", "policy.edge-net.io/region": "us", "policy.edge-net.io/removed": "true"}}}
+
+	if !PropagateMetadata(parent, child) {
+		t.Fatal("child namespace reported unchanged")
+	}
+	expectedLabels := map[string]string{"owner": "team", "policy.edge-net.io/cost-center": "lip6", "policy.edge-net.io/region": "eu"}
+	if !reflect.DeepEqual(child.Labels, expectedLabels) {
+		t.Errorf("child labels are %v, expected %v", child.Labels, expectedLabels)
+	}
+	expectedAnnotations := map[string]string{"policy.edge-net.io/contact": "ops@edge-net.org"}
+	if !reflect.DeepEqual(child.Annotations, expectedAnnotations) {
+		t.Errorf("child annotations are %v, expected %v", child.Annotations, expectedAnnotations)
+	}
+	if PropagateMetadata(parent, child) {
+		t.Error("child namespace in sync reported changed")
+	}
+	// Nothing propagates without a prefix
+	SetPropagationPrefix("")
+	parent.Labels["policy.edge-net.io/region"] = "asia"
+	if PropagateMetadata(parent, child) || child.Labels["policy.edge-net.io/region"] != "eu" {
+		t.Error("labels propagated without a prefix")
+	}
+}
+
+func TestSetNameFormats(t *testing.T) {
+	defer SetNameFormats(authorityNameFormat, childNameFormat)
+	cases := []struct {
+		authorityFormat string
+		childFormat     string
+		valid           bool
+	}{
+		{"east-authority-%s", "%[1]s-%[3]s-%[2]s", true},
+		{"authority-%s-east", "east-%s-%s-%s", true},
+		{"authority", "%s-%s-%s", false},
+		{"authority-%s-%d", "%s-%s-%s", false},
+		{"Authority-%s", "%s-%s-%s", false},
+		{"authority-%s", "%s-%s", false},
+		{"authority-%s", "%[1]s-%[3]s", false},
+		{"authority-%s", "%s_%s_%s", false},
+	}
+	for _, c := range cases {
+		SetNameFormats("authority-%s", "%s-%s-%s")
+		err := SetNameFormats(c.authorityFormat, c.childFormat)
+		if c.valid && err != nil {
+			t.Errorf("formats %q and %q rejected: %s", c.authorityFormat, c.childFormat, err)
+		} else if !c.valid && err == nil {
+			t.Errorf("formats %q and %q accepted", c.authorityFormat, c.childFormat)
+		} else if !c.valid && (AuthorityName("edgenet") != "authority-edgenet" || ChildName("authority-edgenet", "team", "demo") != "authority-edgenet-team-demo") {
+			t.Errorf("former formats not kept after %q and %q", c.authorityFormat, c.childFormat)
+		}
+	}
+}
+
+func TestCustomNameFormats(t *testing.T) {
+	defer SetNameFormats(authorityNameFormat, childNameFormat)
+	if err := SetNameFormats("east-authority-%s", "%[1]s-%[3]s-%[2]s"); err != nil {
+		t.Fatal(err)
+	}
+	authorityNamespace := AuthorityName("edgenet")
+	if authorityNamespace != "east-authority-edgenet" {
+		t.Errorf("authority namespace is %s", authorityNamespace)
+	}
+	if output := ChildName(authorityNamespace, "team", "demo"); output != "east-authority-edgenet-demo-team" {
+		t.Errorf("child namespace is %s", output)
+	}
+	// The names beyond the limit still get truncated and hashed
+	if err := ValidateName(ChildName(authorityNamespace, "team", strings.Repeat("b", 60))); err != nil {
+		t.Error(err)
+	}
+	cases := []struct {
+		namespace string
+		authority string
+		ok        bool
+	}{
+		{"east-authority-edgenet", "edgenet", true},
+		{"authority-edgenet", "", false},
+		{"east-authority-", "", false},
+		{"east-authority-edgenet-demo-team", "edgenet-demo-team", true},
+	}
+	for _, c := range cases {
+		if authority, ok := AuthorityOf(c.namespace); authority != c.authority || ok != c.ok {
+			t.Errorf("AuthorityOf(%s) = %s, %t, expected %s, %t", c.namespace, authority, ok, c.authority, c.ok)
+		}
+	}
+}
+
+func TestAuthorityOfNamespace(t *testing.T) {
+	newNamespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	cases := []struct {
+		namespace *corev1.Namespace
+		authority string
+		ok        bool
+	}{
+		// The namespaces missing the authority-name label, as if created out-of-band
+		{newNamespace("authority-edgenet", nil), "edgenet", true},
+		{newNamespace("authority-edgenet", map[string]string{"owner": "authority", "owner-name": "edgenet"}), "edgenet", true},
+		{newNamespace("authority-edgenet-team-demo", map[string]string{"owner": "team", "owner-name": "demo"}), "edgenet", true},
+		{newNamespace("authority-edge-net-slice-exp", map[string]string{"owner": "slice", "owner-name": "exp"}), "edge-net", true},
+		// The name tells the authority whatever the label, which may be wrong
+		{newNamespace("authority-lip6-team-demo", map[string]string{"owner": "team", "owner-name": "demo", "authority-name": "edgenet"}), "lip6", true},
+		// The child namespace without owner labels is ambiguous, as an authority may be named edgenet-team-demo
+		{newNamespace("authority-edgenet-team-demo", nil), "", false},
+		{newNamespace("authority-edgenet-team-other", map[string]string{"owner": "team", "owner-name": "demo"}), "", false},
+		{newNamespace(ChildName("authority-edgenet", "team", strings.Repeat("a", 60)), map[string]string{"owner": "team", "owner-name": strings.Repeat("a", 60)}), "", false},
+		{newNamespace("kube-system", nil), "", false},
+		{newNamespace("authority-edgenet", map[string]string{"owner": "node"}), "", false},
+	}
+	for _, c := range cases {
+		if authority, ok := AuthorityOfNamespace(c.namespace); authority != c.authority || ok != c.ok {
+			t.Errorf("AuthorityOfNamespace(%s, %v) = %s, %t, expected %s, %t", c.namespace.GetName(), c.namespace.GetLabels(), authority, ok, c.authority, c.ok)
+		}
+	}
+
+	// The formats tell where the authority is in the names
+	defer SetNameFormats(authorityNameFormat, childNameFormat)
+	if err := SetNameFormats("east-authority-%s", "%[1]s-%[3]s-%[2]s"); err != nil {
+		t.Fatal(err)
+	}
+	child := newNamespace("east-authority-edgenet-demo-team", map[string]string{"owner": "team", "owner-name": "demo"})
+	if authority, ok := AuthorityOfNamespace(child); authority != "edgenet" || !ok {
+		t.Errorf("authority of %s is %s, %t", child.GetName(), authority, ok)
+	}
+}
+
+func TestNameFormatFlags(t *testing.T) {
+	defer SetNameFormats(authorityNameFormat, childNameFormat)
+	fs := flag.NewFlagSet("controller", flag.ContinueOnError)
+	AddFlags(fs)
+	if err := fs.Parse([]string{"--authority-namespace-format", "east-authority-%s"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadNameFormats(); err != nil {
+		t.Fatal(err)
+	}
+	if AuthorityName("edgenet") != "east-authority-edgenet" || ChildName("east-authority-edgenet", "team", "demo") != "east-authority-edgenet-team-demo" {
+		t.Errorf("formats not loaded from the options: %s, %s", AuthorityName("edgenet"), ChildName("east-authority-edgenet", "team", "demo"))
+	}
+	if err := fs.Parse([]string{"--child-namespace-format", "%s-%s"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadNameFormats(); err == nil {
+		t.Error("invalid format option loaded")
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// mirrorPodAnnotation marks the static pods that the kubelet runs, which the API server cannot evict
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// Drainer cordons a node and evicts its pods through the eviction API, so that the pod disruption budgets are respected
+type Drainer struct {
+	Clientset kubernetes.Interface
+	// Timeout is the time limit for the pods to be evicted and to terminate
+	Timeout time.Duration
+	// PollInterval is the interval to retry the evictions that a disruption budget blocks, and to check the pods that terminate
+	PollInterval time.Duration
+}
+
+// Cordon marks the node as unschedulable so that no new pods land on it
+func (d *Drainer) Cordon(nodeName string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		nodeRaw, err := d.Clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err != nil || nodeRaw.Spec.Unschedulable {
+			return err
+		}
+		nodeCopy := nodeRaw.DeepCopy()
+		nodeCopy.Spec.Unschedulable = true
+		_, err = d.Clientset.CoreV1().Nodes().Update(nodeCopy)
+		return err
+	})
+}
+
+// Drain cordons the node and evicts the pods on it, except those of daemon sets and the static pods, then waits for
+// them to terminate. It returns an error if the pods are still there once the timeout expires, such as when
+// a disruption budget doesn't allow their eviction, in which case the node stays cordoned.
+func (d *Drainer) Drain(nodeName string) error {
+	if err := d.Cordon(nodeName); err != nil {
+		return err
+	}
+	pods, err := d.podsToEvict(nodeName)
+	if err != nil {
+		return err
+	}
+	// The pods are told apart by their UIDs, as a controller such as a stateful set may create a pod of the same name
+	// once the one on the node is gone
+	pending := map[types.UID]corev1.Pod{}
+	for _, podRow := range pods {
+		pending[podRow.GetUID()] = podRow
+	}
+	evicted := map[types.UID]bool{}
+	err = wait.PollImmediate(d.PollInterval, d.Timeout, func() (bool, error) {
+		for uid, podRow := range pending {
+			if !evicted[uid] {
+				uid := uid
+				eviction := &policyv1beta1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: podRow.GetName(), Namespace: podRow.GetNamespace()},
+					DeleteOptions: &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}}}
+				err := d.Clientset.CoreV1().Pods(podRow.GetNamespace()).Evict(eviction)
+				if errors.IsTooManyRequests(err) {
+					// A disruption budget blocks the eviction for now
+					continue
+				} else if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+					// The precondition fails with a conflict when the pod of the name is another one
+					return false, err
+				}
+				evicted[uid] = true
+			}
+			podRaw, err := d.Clientset.CoreV1().Pods(podRow.GetNamespace()).Get(podRow.GetName(), metav1.GetOptions{})
+			if errors.IsNotFound(err) || (err == nil && podRaw.GetUID() != uid) {
+				delete(pending, uid)
+			} else if err != nil {
+				return false, err
+			}
+		}
+		return len(pending) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		remaining := []string{}
+		for _, podRow := range pending {
+			remaining = append(remaining, fmt.Sprintf("%s/%s", podRow.GetNamespace(), podRow.GetName()))
+		}
+		return fmt.Errorf("node %s not drained in %s, pods remaining: %v", nodeName, d.Timeout, remaining)
+	}
+	return err
+}
+
+// DrainAndDelete drains the node and removes it from the cluster once its pods are gone
+func (d *Drainer) DrainAndDelete(nodeName string) error {
+	if err := d.Drain(nodeName); errors.IsNotFound(err) {
+		// The node has never joined, or it has been removed already
+		return nil
+	} else if err != nil {
+		return err
+	}
+	log.Printf("Node %s drained, deleting", nodeName)
+	err := d.Clientset.CoreV1().Nodes().Delete(nodeName, &metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// podsToEvict returns the pods running on the node that the eviction concerns
+func (d *Drainer) podsToEvict(nodeName string) ([]corev1.Pod, error) {
+	podsRaw, err := d.Clientset.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{FieldSelector: fmt.Sprintf("spec.nodeName=%s", nodeName)})
+	if err != nil {
+		return nil, err
+	}
+	pods := []corev1.Pod{}
+	for _, podRow := range podsRaw.Items {
+		if podRow.Spec.NodeName != nodeName || podRow.Status.Phase == corev1.PodSucceeded || podRow.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		// The daemon set controller would run the pod again on the node, and the kubelet owns the static pods
+		if _, ok := podRow.GetAnnotations()[mirrorPodAnnotation]; ok {
+			continue
+		}
+		if controllerRef := metav1.GetControllerOf(&podRow); controllerRef != nil && controllerRef.Kind == "DaemonSet" {
+			continue
+		}
+		pods = append(pods, podRow)
+	}
+	return pods, nil
+}
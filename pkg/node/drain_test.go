@@ -0,0 +1,120 @@
+package node
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newDrainClientset returns a clientset with a node that runs a pod of a deployment, a pod of a daemon set, and a static pod.
+// The pods evicted, which the map records, terminate at once unless a disruption budget blocks their eviction.
+func newDrainClientset(blocked bool) (*testclient.Clientset, map[string]bool) {
+	contributedNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "lip6.node-1.edge-net.io"}}
+	isController := true
+	appPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "authority-lip6", UID: "app-1"},
+		Spec: corev1.PodSpec{NodeName: "lip6.node-1.edge-net.io"}}
+	daemonPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "kube-proxy", Namespace: "kube-system",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "kube-proxy", Controller: &isController}}},
+		Spec: corev1.PodSpec{NodeName: "lip6.node-1.edge-net.io"}}
+	staticPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "kube-system",
+		Annotations: map[string]string{mirrorPodAnnotation: "etcd"}}, Spec: corev1.PodSpec{NodeName: "lip6.node-1.edge-net.io"}}
+	otherPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "authority-lip6"},
+		Spec: corev1.PodSpec{NodeName: "lip6.node-2.edge-net.io"}}
+	clientset := testclient.NewSimpleClientset(contributedNode, appPod, daemonPod, staticPod, otherPod)
+	evicted := map[string]bool{}
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		if blocked {
+			return true, nil, errors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 10)
+		}
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1beta1.Eviction)
+		evicted[fmt.Sprintf("%s/%s", eviction.GetNamespace(), eviction.GetName())] = true
+		return true, nil, nil
+	})
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		name := action.(k8stesting.GetAction).GetName()
+		if evicted[fmt.Sprintf("%s/%s", action.GetNamespace(), name)] {
+			return true, nil, errors.NewNotFound(corev1.Resource("pods"), name)
+		}
+		return false, nil, nil
+	})
+	return clientset, evicted
+}
+
+func TestDrainAndDelete(t *testing.T) {
+	clientset, evicted := newDrainClientset(false)
+	drainer := &Drainer{Clientset: clientset, Timeout: time.Second, PollInterval: 10 * time.Millisecond}
+	if err := drainer.DrainAndDelete("lip6.node-1.edge-net.io"); err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 1 || !evicted["authority-lip6/app"] {
+		t.Errorf("pods evicted are %v, expected the pod of the deployment on the node only", evicted)
+	}
+	if _, err := clientset.CoreV1().Nodes().Get("lip6.node-1.edge-net.io", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Error("node not deleted once drained")
+	}
+	// The node that is gone has nothing to drain
+	if err := drainer.DrainAndDelete("lip6.node-1.edge-net.io"); err != nil {
+		t.Errorf("error for the node removed already: %s", err)
+	}
+}
+
+func TestDrainBlockedByDisruptionBudget(t *testing.T) {
+	clientset, evicted := newDrainClientset(true)
+	drainer := &Drainer{Clientset: clientset, Timeout: 100 * time.Millisecond, PollInterval: 10 * time.Millisecond}
+	err := drainer.DrainAndDelete("lip6.node-1.edge-net.io")
+	if err == nil || !strings.Contains(err.Error(), "authority-lip6/app") {
+		t.Fatalf("error is %v, expected the timeout with the pod remaining", err)
+	}
+	// The node stays in the cluster, cordoned, along with its pod
+	contributedNode, err := clientset.CoreV1().Nodes().Get("lip6.node-1.edge-net.io", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("node deleted although it isn't drained: %s", err)
+	}
+	if !contributedNode.Spec.Unschedulable {
+		t.Error("node not cordoned")
+	}
+	if len(evicted) != 0 {
+		t.Errorf("pods evicted despite the disruption budget: %v", evicted)
+	}
+}
+
+func TestDrainPodReplaced(t *testing.T) {
+	clientset, evicted := newDrainClientset(false)
+	preconditions := []types.UID{}
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if eviction, ok := action.(k8stesting.CreateAction).GetObject().(*policyv1beta1.Eviction); ok && eviction.DeleteOptions != nil && eviction.DeleteOptions.Preconditions != nil {
+			preconditions = append(preconditions, *eviction.DeleteOptions.Preconditions.UID)
+		}
+		return false, nil, nil
+	})
+	// The stateful set creates a pod of the same name on another node as soon as the one evicted is gone
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		name := action.(k8stesting.GetAction).GetName()
+		if evicted[fmt.Sprintf("%s/%s", action.GetNamespace(), name)] {
+			return true, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: action.GetNamespace(), UID: "app-2"},
+				Spec: corev1.PodSpec{NodeName: "lip6.node-2.edge-net.io"}}, nil
+		}
+		return false, nil, nil
+	})
+	drainer := &Drainer{Clientset: clientset, Timeout: 100 * time.Millisecond, PollInterval: 10 * time.Millisecond}
+	if err := drainer.Drain("lip6.node-1.edge-net.io"); err != nil {
+		t.Fatalf("pod replaced taken as the one remaining: %s", err)
+	}
+	// The eviction concerns the pod on the node alone rather than any pod of the name
+	if len(preconditions) != 1 || preconditions[0] != "app-1" {
+		t.Errorf("UIDs of the eviction preconditions are %v, expected that of the pod on the node", preconditions)
+	}
+}
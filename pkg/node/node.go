@@ -25,7 +25,9 @@ import (
 	"log"
 	"math"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"k8s.io/client-go/kubernetes"
 	"edgenet/pkg/authorization"
@@ -37,8 +39,42 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/retry"
 )
 
+// The default rate of geolocation lookups, in requests per second, and the burst allowed
+const defaultGeolocationQPS = 10
+const defaultGeolocationBurst = 10
+
+// geolocationLimiter is shared by the geolocation lookups of all nodes to smooth out the bursts,
+// such as the one on startup, which would otherwise trip the rate limit of the provider
+var geolocationLimiter = flowcontrol.NewTokenBucketRateLimiter(defaultGeolocationQPS, defaultGeolocationBurst)
+var geolocationLimiterMutex sync.RWMutex
+
+// SetGeolocationRateLimit configures the rate of geolocation lookups in requests per second,
+// a rate that isn't positive removes the limit
+func SetGeolocationRateLimit(qps float32, burst int) {
+	geolocationLimiterMutex.Lock()
+	defer geolocationLimiterMutex.Unlock()
+	if qps <= 0 {
+		geolocationLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	geolocationLimiter = flowcontrol.NewTokenBucketRateLimiter(qps, burst)
+}
+
+// waitGeolocationLookup blocks until the rate limit allows another lookup
+func waitGeolocationLookup() {
+	geolocationLimiterMutex.RLock()
+	limiter := geolocationLimiter
+	geolocationLimiterMutex.RUnlock()
+	limiter.Accept()
+}
+
 // JSON structure of patch operation
 type patchStringValue struct {
 	Op    string `json:"op"`
@@ -89,12 +125,7 @@ func Boundbox(points [][]float64) []float64 {
 }
 
 // setNodeLabels uses client-go to patch nodes by processing a labels map
-func setNodeLabels(hostname string, labels map[string]string) bool {
-	clientset, err := authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
-	}
+func setNodeLabels(hostname string, labels map[string]string, clientset kubernetes.Interface) bool {
 	// Create a patch slice and initialize it to the label size
 	nodePatchArr := make([]patchStringValue, len(labels))
 	nodePatch := patchStringValue{}
@@ -111,7 +142,7 @@ func setNodeLabels(hostname string, labels map[string]string) bool {
 
 	// Patch the nodes with the arguments:
 	// hostname, patch type, and patch data
-	_, err = clientset.CoreV1().Nodes().Patch(hostname, types.JSONPatchType, nodesJSON)
+	_, err := clientset.CoreV1().Nodes().Patch(hostname, types.JSONPatchType, nodesJSON)
 	if err != nil {
 		log.Println(err.Error())
 		panic(err.Error())
@@ -119,23 +150,197 @@ func setNodeLabels(hostname string, labels map[string]string) bool {
 	return true
 }
 
-// GetGeolocationByIP return geolabels by taking advantage of GeoLite database
-func GetGeolocationByIP(hostname string, ipStr string) bool {
+// Annotations to declare the location of a node, which, when present, take precedence over the IP-based lookup.
+// They are meant for the nodes behind NAT whose IP addresses point to the location of the ISP.
+// Latitude and longitude are in decimal degrees, the other annotations hold the values of the corresponding labels.
+const (
+	DeclaredLatitudeAnnotation  = "edge-net.io/declared-lat"
+	DeclaredLongitudeAnnotation = "edge-net.io/declared-lon"
+	DeclaredCountryAnnotation   = "edge-net.io/declared-country-iso"
+	DeclaredStateAnnotation     = "edge-net.io/declared-state-iso"
+	DeclaredCityAnnotation      = "edge-net.io/declared-city"
+	DeclaredContinentAnnotation = "edge-net.io/declared-continent"
+)
+
+// GetDeclaredGeolocation returns the geolabels built from the location declared by the node annotations,
+// the second value is false if the node doesn't declare a valid latitude and longitude
+func GetDeclaredGeolocation(obj *corev1.Node) (map[string]string, bool) {
+	latStr, latExists := obj.Annotations[DeclaredLatitudeAnnotation]
+	lonStr, lonExists := obj.Annotations[DeclaredLongitudeAnnotation]
+	if !latExists || !lonExists {
+		return nil, false
+	}
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		log.Printf("Node %s declares an invalid latitude: %s", obj.GetName(), latStr)
+		return nil, false
+	}
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		log.Printf("Node %s declares an invalid longitude: %s", obj.GetName(), lonStr)
+		return nil, false
+	}
+	lon, lat := formatCoordinates(longitude, latitude)
+	geoLabels := map[string]string{
+		"edge-net.io~1lon": lon,
+		"edge-net.io~1lat": lat,
+	}
+	// The rest of the location is optional
+	optionalLabels := map[string]string{
+		DeclaredCountryAnnotation:   "edge-net.io~1country-iso",
+		DeclaredStateAnnotation:     "edge-net.io~1state-iso",
+		DeclaredCityAnnotation:      "edge-net.io~1city",
+		DeclaredContinentAnnotation: "edge-net.io~1continent",
+	}
+	for annotation, label := range optionalLabels {
+		if value := strings.TrimSpace(obj.Annotations[annotation]); value != "" {
+			geoLabels[label] = strings.Replace(value, " ", "_", -1)
+		}
+	}
+	return geoLabels, true
+}
+
+// SetDeclaredGeolocation attaches the geolabels of the location declared by the node annotations,
+// it returns false if there is no valid declaration
+func SetDeclaredGeolocation(obj *corev1.Node, clientset kubernetes.Interface) bool {
+	geoLabels, declared := GetDeclaredGeolocation(obj)
+	if !declared {
+		return false
+	}
+	return setNodeLabels(obj.GetName(), geoLabels, clientset)
+}
+
+// Annotations to record where the geolabels of a node come from and when they were resolved
+const (
+	GeoSourceAnnotation     = "edge-net.io/geo-source"
+	GeoResolvedAtAnnotation = "edge-net.io/geo-resolved-at"
+	GeoSourceDeclared       = "declared"
+	GeoSourceExternalIP     = "external-ip"
+	GeoSourceInternalIP     = "internal-ip"
+	GeoSourcePending        = "pending"
+)
+
+// SetGeolocationSource annotates the node with the source of its geolabels and the time of resolution
+func SetGeolocationSource(hostname string, source string, clientset kubernetes.Interface) bool {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				GeoSourceAnnotation:     source,
+				GeoResolvedAtAnnotation: time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	}
+	patchJSON, _ := json.Marshal(patch)
+	_, err := clientset.CoreV1().Nodes().Patch(hostname, types.MergePatchType, patchJSON)
+	if err != nil {
+		log.Println(err.Error())
+		return false
+	}
+	return true
+}
+
+// SetGeolocationPending marks the geolocation of the node as pending until a lookup succeeds,
+// the time of the last resolution, if any, remains
+func SetGeolocationPending(hostname string, clientset kubernetes.Interface) bool {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				GeoSourceAnnotation: GeoSourcePending,
+			},
+		},
+	}
+	patchJSON, _ := json.Marshal(patch)
+	_, err := clientset.CoreV1().Nodes().Patch(hostname, types.MergePatchType, patchJSON)
+	if err != nil {
+		log.Println(err.Error())
+		return false
+	}
+	return true
+}
+
+// GeoPendingTaintKey is the taint that keeps the pods off a node until its geolabels are attached,
+// so that no pod gets placed by a geolocation that the node doesn't have yet
+const GeoPendingTaintKey = "edge-net.io/geo-pending"
+
+// SetGeoPendingTaint taints the node with the geo-pending taint unless it already has it
+func SetGeoPendingTaint(hostname string, clientset kubernetes.Interface) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		nodeRaw, err := clientset.CoreV1().Nodes().Get(hostname, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for _, taint := range nodeRaw.Spec.Taints {
+			if taint.Key == GeoPendingTaintKey {
+				return nil
+			}
+		}
+		nodeCopy := nodeRaw.DeepCopy()
+		nodeCopy.Spec.Taints = append(nodeCopy.Spec.Taints, corev1.Taint{Key: GeoPendingTaintKey, Effect: corev1.TaintEffectNoSchedule})
+		_, err = clientset.CoreV1().Nodes().Update(nodeCopy)
+		return err
+	})
+}
+
+// RemoveGeoPendingTaint removes the geo-pending taint from the node, if any
+func RemoveGeoPendingTaint(hostname string, clientset kubernetes.Interface) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		nodeRaw, err := clientset.CoreV1().Nodes().Get(hostname, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		taints := []corev1.Taint{}
+		for _, taint := range nodeRaw.Spec.Taints {
+			if taint.Key != GeoPendingTaintKey {
+				taints = append(taints, taint)
+			}
+		}
+		if len(taints) == len(nodeRaw.Spec.Taints) {
+			return nil
+		}
+		nodeCopy := nodeRaw.DeepCopy()
+		nodeCopy.Spec.Taints = taints
+		_, err = clientset.CoreV1().Nodes().Update(nodeCopy)
+		return err
+	})
+}
+
+// formatCoordinates returns the longitude and latitude in the format of the geolabels
+func formatCoordinates(longitude, latitude float64) (string, string) {
+	var lon string
+	var lat string
+	if longitude >= 0 {
+		lon = fmt.Sprintf("e%.6f", longitude)
+	} else {
+		lon = fmt.Sprintf("w%.6f", longitude)
+	}
+	if latitude >= 0 {
+		lat = fmt.Sprintf("n%.6f", latitude)
+	} else {
+		lat = fmt.Sprintf("s%.6f", latitude)
+	}
+	return lon, lat
+}
+
+// GetGeolocationByIP return geolabels by taking advantage of GeoLite database,
+// the error is for a lookup that couldn't take place and is worth retrying, such as when the provider is unavailable
+func GetGeolocationByIP(hostname string, ipStr string, clientset kubernetes.Interface) (bool, error) {
+	// Wait for the turn of this lookup
+	waitGeolocationLookup()
 	// Parse IP address
 	ip := net.ParseIP(ipStr)
 	// Open GeoLite database
 	db, err := geoip2.Open("../../assets/database/GeoLite2-City/GeoLite2-City.mmdb")
 	if err != nil {
-		log.Fatal(err)
-		return false
+		log.Println(err)
+		return false, err
 	}
 	// Close the database as a final job
 	defer db.Close()
 	// Get the geolocation information by IP
 	record, err := db.City(ip)
 	if err != nil {
-		log.Fatal(err)
-		return false
+		log.Println(err)
+		return false, err
 	}
 
 	// Patch for being compatible with Kubernetes alphanumeric characters limitations
@@ -143,18 +348,7 @@ func GetGeolocationByIP(hostname string, ipStr string) bool {
 	country := record.Country.IsoCode
 	state := record.Country.IsoCode
 	city := strings.Replace(record.City.Names["en"], " ", "_", -1)
-	var lon string
-	var lat string
-	if record.Location.Longitude >= 0 {
-		lon = fmt.Sprintf("e%.6f", record.Location.Longitude)
-	} else {
-		lon = fmt.Sprintf("w%.6f", record.Location.Longitude)
-	}
-	if record.Location.Latitude >= 0 {
-		lat = fmt.Sprintf("n%.6f", record.Location.Latitude)
-	} else {
-		lat = fmt.Sprintf("s%.6f", record.Location.Latitude)
-	}
+	lon, lat := formatCoordinates(record.Location.Longitude, record.Location.Latitude)
 	if len(record.Subdivisions) > 0 {
 		state = record.Subdivisions[0].IsoCode
 	}
@@ -169,15 +363,18 @@ func GetGeolocationByIP(hostname string, ipStr string) bool {
 		"edge-net.io~1lat":         lat,
 	}
 
+	// The names that the database lacks come from the reverse geocoding of the coordinates, if enabled
+	reverseGeocodeLabels(record.Location.Latitude, record.Location.Longitude, geoLabels)
+
 	// Attach geolabels to the node
-	result := setNodeLabels(hostname, geoLabels)
+	result := setNodeLabels(hostname, geoLabels, clientset)
 	// If the result is different than the expected, return false
 	// The expected result is having a different longitude and latitude than zero
 	// Zero value typically means there isn't any result meaningful
 	if record.Location.Longitude == 0 && record.Location.Latitude == 0 {
-		return false
+		return false, nil
 	}
-	return result
+	return result, nil
 }
 
 // CompareIPAddresses makes a comparison between old and new objects of the node
@@ -2,12 +2,12 @@ package node
 
 import (
   	"testing"
-	"encoding/json"
+	"reflect"
+	"time"
 	testclient "k8s.io/client-go/kubernetes/fake"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
-	"fmt"
 	)
 func TestUnique(t *testing.T) {
     var tests = []struct{
@@ -220,3 +220,41 @@ func TestGetConditionReadyStatus(t *testing.T){
   }
 
 }
+
+func TestGetDeclaredGeolocation(t *testing.T) {
+	data := []struct {
+		annotations map[string]string
+		expected    map[string]string
+		declared    bool
+	}{
+		{nil, nil, false},
+		{map[string]string{DeclaredLatitudeAnnotation: "48.846"}, nil, false},
+		{map[string]string{DeclaredLatitudeAnnotation: "148.846", DeclaredLongitudeAnnotation: "2.357"}, nil, false},
+		{map[string]string{DeclaredLatitudeAnnotation: "48.846", DeclaredLongitudeAnnotation: "2.357"},
+			map[string]string{"edge-net.io~1lat": "n48.846000", "edge-net.io~1lon": "e2.357000"}, true},
+		{map[string]string{DeclaredLatitudeAnnotation: "-33.86", DeclaredLongitudeAnnotation: "-70.64", DeclaredCountryAnnotation: "CL", DeclaredCityAnnotation: "Santiago de Chile"},
+			map[string]string{"edge-net.io~1lat": "s-33.860000", "edge-net.io~1lon": "w-70.640000", "edge-net.io~1country-iso": "CL", "edge-net.io~1city": "Santiago_de_Chile"}, true},
+	}
+	for _, test := range data {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Annotations: test.annotations}}
+		labels, declared := GetDeclaredGeolocation(node)
+		if declared != test.declared || !reflect.DeepEqual(labels, test.expected) {
+			t.Errorf("GetDeclaredGeolocation(%v) = %v, %t; expected %v, %t", test.annotations, labels, declared, test.expected, test.declared)
+		}
+	}
+}
+
+func TestGeolocationRateLimit(t *testing.T) {
+	SetGeolocationRateLimit(20, 1)
+	defer SetGeolocationRateLimit(defaultGeolocationQPS, defaultGeolocationBurst)
+	clientset := testclient.NewSimpleClientset()
+	lookups := 5
+	start := time.Now()
+	for i := 0; i < lookups; i++ {
+		GetGeolocationByIP("node-1", "10.0.0.1", clientset)
+	}
+	// The first lookup takes the single token of the burst, each of the others waits for a new token
+	if elapsed, expected := time.Since(start), time.Duration(lookups-1)*time.Second/20; elapsed < expected {
+		t.Errorf("%d lookups took %s, expected at least %s", lookups, elapsed, expected)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// CountryTaintKey is the taint that keeps the pods off the nodes located outside the allowed countries
+const CountryTaintKey = "edge-net.io/country-disallowed"
+
+// CountryPolicyAnnotation records why the country policy keeps the pods off the node
+const CountryPolicyAnnotation = "edge-net.io/country-policy"
+
+// allowedCountries are the ISO codes of the countries where the nodes take pods, nil allows all countries
+var allowedCountries map[string]bool
+var allowedCountriesMutex sync.RWMutex
+
+// SetAllowedCountries configures the ISO codes of the countries where the nodes take pods, such as for data residency,
+// an empty list allows all countries
+func SetAllowedCountries(countries []string) {
+	allowedCountriesMutex.Lock()
+	defer allowedCountriesMutex.Unlock()
+	allowedCountries = nil
+	for _, country := range countries {
+		if country = strings.ToUpper(strings.TrimSpace(country)); country != "" {
+			if allowedCountries == nil {
+				allowedCountries = map[string]bool{}
+			}
+			allowedCountries[country] = true
+		}
+	}
+}
+
+// CheckCountry tells whether the nodes in the country of the ISO code may take pods, along with the reason if they
+// may not. While a list is configured, a node of unknown country may not, as its residency cannot be asserted.
+func CheckCountry(countryISO string) (bool, string) {
+	allowedCountriesMutex.RLock()
+	defer allowedCountriesMutex.RUnlock()
+	if allowedCountries == nil {
+		return true, ""
+	}
+	countryISO = strings.ToUpper(strings.TrimSpace(countryISO))
+	if countryISO == "" {
+		return false, "country unknown, the allowed countries cannot be asserted"
+	}
+	if !allowedCountries[countryISO] {
+		return false, fmt.Sprintf("country %s not in the allowed countries", countryISO)
+	}
+	return true, ""
+}
+
+// EnforceCountryPolicy taints the node whose country-iso label is outside the allowed countries and records the
+// reason in its annotation, or removes both once the node is allowed. It returns whether the node is allowed.
+func EnforceCountryPolicy(hostname string, clientset kubernetes.Interface) (bool, error) {
+	var allowed bool
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		nodeRaw, err := clientset.CoreV1().Nodes().Get(hostname, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		nodeCopy := nodeRaw.DeepCopy()
+		var reason string
+		allowed, reason = CheckCountry(nodeCopy.Labels["edge-net.io/country-iso"])
+		taints := []corev1.Taint{}
+		for _, taint := range nodeCopy.Spec.Taints {
+			if taint.Key != CountryTaintKey {
+				taints = append(taints, taint)
+			}
+		}
+		if allowed {
+			if len(taints) == len(nodeCopy.Spec.Taints) && nodeCopy.Annotations[CountryPolicyAnnotation] == "" {
+				return nil
+			}
+			nodeCopy.Spec.Taints = taints
+			delete(nodeCopy.Annotations, CountryPolicyAnnotation)
+		} else {
+			if len(taints) != len(nodeCopy.Spec.Taints) && nodeCopy.Annotations[CountryPolicyAnnotation] == reason {
+				return nil
+			}
+			nodeCopy.Spec.Taints = append(taints, corev1.Taint{Key: CountryTaintKey, Effect: corev1.TaintEffectNoSchedule})
+			if nodeCopy.Annotations == nil {
+				nodeCopy.Annotations = map[string]string{}
+			}
+			nodeCopy.Annotations[CountryPolicyAnnotation] = reason
+		}
+		_, err = clientset.CoreV1().Nodes().Update(nodeCopy)
+		return err
+	})
+	return allowed, err
+}
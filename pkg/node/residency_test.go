@@ -0,0 +1,91 @@
+package node
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckCountry(t *testing.T) {
+	defer SetAllowedCountries(nil)
+	// No list allows all countries, even the unknown one
+	for _, country := range []string{"FR", "US", ""} {
+		if allowed, _ := CheckCountry(country); !allowed {
+			t.Errorf("country %q disallowed without a list", country)
+		}
+	}
+
+	SetAllowedCountries([]string{"fr", " DE ", ""})
+	tests := []struct {
+		country string
+		allowed bool
+	}{
+		{"FR", true},
+		{"de", true},
+		{"US", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		allowed, reason := CheckCountry(test.country)
+		if allowed != test.allowed {
+			t.Errorf("country %q allowed is %t, expected %t", test.country, allowed, test.allowed)
+		}
+		if !allowed && reason == "" {
+			t.Errorf("country %q disallowed without a reason", test.country)
+		}
+	}
+}
+
+func hasCountryTaint(nodeObj *corev1.Node) bool {
+	for _, taint := range nodeObj.Spec.Taints {
+		if taint.Key == CountryTaintKey {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEnforceCountryPolicy(t *testing.T) {
+	defer SetAllowedCountries(nil)
+	SetAllowedCountries([]string{"FR"})
+	nodeObj := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"edge-net.io/country-iso": "US"}},
+		Spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: "node.kubernetes.io/unreachable", Effect: corev1.TaintEffectNoExecute}}}}
+	clientset := testclient.NewSimpleClientset(nodeObj)
+
+	allowed, err := EnforceCountryPolicy("node-1", clientset)
+	if err != nil || allowed {
+		t.Fatalf("node in US allowed is %t: %v", allowed, err)
+	}
+	nodeUpdated, _ := clientset.CoreV1().Nodes().Get("node-1", metav1.GetOptions{})
+	if !hasCountryTaint(nodeUpdated) {
+		t.Error("disallowed node not tainted")
+	}
+	if nodeUpdated.Annotations[CountryPolicyAnnotation] == "" {
+		t.Error("reason not recorded")
+	}
+	// Enforcing again doesn't taint twice
+	EnforceCountryPolicy("node-1", clientset)
+	nodeUpdated, _ = clientset.CoreV1().Nodes().Get("node-1", metav1.GetOptions{})
+	if len(nodeUpdated.Spec.Taints) != 2 {
+		t.Errorf("taints are %v", nodeUpdated.Spec.Taints)
+	}
+
+	// The node moved into an allowed country takes pods again, the other taints remain
+	nodeUpdated.Labels["edge-net.io/country-iso"] = "FR"
+	clientset.CoreV1().Nodes().Update(nodeUpdated)
+	if allowed, err := EnforceCountryPolicy("node-1", clientset); err != nil || !allowed {
+		t.Fatalf("node in FR allowed is %t: %v", allowed, err)
+	}
+	nodeUpdated, _ = clientset.CoreV1().Nodes().Get("node-1", metav1.GetOptions{})
+	if hasCountryTaint(nodeUpdated) {
+		t.Error("allowed node still tainted")
+	}
+	if _, exists := nodeUpdated.Annotations[CountryPolicyAnnotation]; exists {
+		t.Error("reason remains on the allowed node")
+	}
+	if len(nodeUpdated.Spec.Taints) != 1 || nodeUpdated.Spec.Taints[0].Key != "node.kubernetes.io/unreachable" {
+		t.Errorf("other taints not kept: %v", nodeUpdated.Spec.Taints)
+	}
+}
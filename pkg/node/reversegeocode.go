@@ -0,0 +1,177 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Place is the location found at a pair of coordinates, any of its fields can be empty
+type Place struct {
+	City       string
+	Country    string
+	CountryISO string
+}
+
+// ReverseGeocoder turns coordinates in decimal degrees into the place they point to
+type ReverseGeocoder interface {
+	ReverseGeocode(latitude, longitude float64) (Place, error)
+}
+
+// reverseGeocoder is nil by default, in which case the geolabels come from the geo-IP database only
+var reverseGeocoder ReverseGeocoder
+var reverseGeocoderMutex sync.RWMutex
+
+// SetReverseGeocoder configures the provider that names the places of the coordinates the geo-IP database returns,
+// the places are cached as the nodes nearby share them, nil disables reverse geocoding
+func SetReverseGeocoder(provider ReverseGeocoder) {
+	reverseGeocoderMutex.Lock()
+	defer reverseGeocoderMutex.Unlock()
+	if provider == nil {
+		reverseGeocoder = nil
+		return
+	}
+	reverseGeocoder = &cachedReverseGeocoder{provider: provider, places: map[string]Place{}}
+}
+
+// reverseGeocodeLabels completes the geolabels with the names of the place at the coordinates, the labels that the
+// geo-IP database has already filled take precedence, and a failed lookup leaves the geolabels as they are
+func reverseGeocodeLabels(latitude, longitude float64, geoLabels map[string]string) {
+	reverseGeocoderMutex.RLock()
+	provider := reverseGeocoder
+	reverseGeocoderMutex.RUnlock()
+	if provider == nil || (latitude == 0 && longitude == 0) {
+		return
+	}
+	place, err := provider.ReverseGeocode(latitude, longitude)
+	if err != nil {
+		log.Printf("Reverse geocoding of %f, %f failed: %s", latitude, longitude, err)
+		return
+	}
+	names := map[string]string{
+		"edge-net.io~1city":        place.City,
+		"edge-net.io~1country":     place.Country,
+		"edge-net.io~1country-iso": strings.ToUpper(place.CountryISO),
+	}
+	for label, name := range names {
+		if geoLabels[label] != "" || name == "" {
+			continue
+		}
+		value := strings.Replace(strings.TrimSpace(name), " ", "_", -1)
+		// Names such as those with accents cannot be label values
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			log.Printf("Place name %q cannot be a label value: %s", name, strings.Join(errs, ", "))
+			continue
+		}
+		geoLabels[label] = value
+	}
+}
+
+// cachedReverseGeocoder keeps the places found by the coordinates rounded to about a kilometer,
+// the failures aren't cached so that they are retried on the next lookup
+type cachedReverseGeocoder struct {
+	provider ReverseGeocoder
+	mutex    sync.Mutex
+	places   map[string]Place
+}
+
+func (c *cachedReverseGeocoder) ReverseGeocode(latitude, longitude float64) (Place, error) {
+	key := fmt.Sprintf("%.2f,%.2f", latitude, longitude)
+	c.mutex.Lock()
+	place, cached := c.places[key]
+	c.mutex.Unlock()
+	if cached {
+		return place, nil
+	}
+	place, err := c.provider.ReverseGeocode(latitude, longitude)
+	if err != nil {
+		return place, err
+	}
+	c.mutex.Lock()
+	c.places[key] = place
+	c.mutex.Unlock()
+	return place, nil
+}
+
+// NominatimGeocoder looks up the places through the reverse endpoint of a Nominatim server
+type NominatimGeocoder struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewNominatimGeocoder returns a reverse geocoder for the Nominatim server at the URL
+func NewNominatimGeocoder(serverURL string) *NominatimGeocoder {
+	return &NominatimGeocoder{URL: strings.TrimSuffix(serverURL, "/"), Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// ReverseGeocode returns the nearest city and the country at the coordinates
+func (n *NominatimGeocoder) ReverseGeocode(latitude, longitude float64) (Place, error) {
+	query := url.Values{}
+	query.Set("format", "jsonv2")
+	query.Set("lat", fmt.Sprintf("%f", latitude))
+	query.Set("lon", fmt.Sprintf("%f", longitude))
+	query.Set("zoom", "10")
+	query.Set("accept-language", "en")
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/reverse?%s", n.URL, query.Encode()), nil)
+	if err != nil {
+		return Place{}, err
+	}
+	// The usage policy of Nominatim requires the requests to identify the application
+	request.Header.Set("User-Agent", "edgenet-nodelabeler")
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return Place{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return Place{}, fmt.Errorf("reverse geocoding responded with %s", response.Status)
+	}
+	var result struct {
+		Error   string `json:"error"`
+		Address struct {
+			City        string `json:"city"`
+			Town        string `json:"town"`
+			Village     string `json:"village"`
+			Country     string `json:"country"`
+			CountryCode string `json:"country_code"`
+		} `json:"address"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return Place{}, err
+	}
+	if result.Error != "" {
+		return Place{}, fmt.Errorf("reverse geocoding failed: %s", result.Error)
+	}
+	place := Place{City: result.Address.City, Country: result.Address.Country, CountryISO: result.Address.CountryCode}
+	// The smaller places have no city, the nearest town or village stands for it
+	if place.City == "" {
+		place.City = result.Address.Town
+	}
+	if place.City == "" {
+		place.City = result.Address.Village
+	}
+	return place, nil
+}
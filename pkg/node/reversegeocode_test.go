@@ -0,0 +1,107 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// fakeReverseGeocoder returns the same place for any coordinates, or the error if any, and counts the lookups
+type fakeReverseGeocoder struct {
+	place   Place
+	err     error
+	lookups int
+}
+
+func (f *fakeReverseGeocoder) ReverseGeocode(latitude, longitude float64) (Place, error) {
+	f.lookups++
+	return f.place, f.err
+}
+
+func TestReverseGeocodeLabels(t *testing.T) {
+	data := []struct {
+		provider *fakeReverseGeocoder
+		labels   map[string]string
+		expected map[string]string
+	}{
+		// The coordinates only
+		{&fakeReverseGeocoder{place: Place{City: "Paris", Country: "France", CountryISO: "fr"}},
+			map[string]string{"edge-net.io~1city": "", "edge-net.io~1country-iso": ""},
+			map[string]string{"edge-net.io~1city": "Paris", "edge-net.io~1country": "France", "edge-net.io~1country-iso": "FR"}},
+		// The names of the geo-IP database take precedence
+		{&fakeReverseGeocoder{place: Place{City: "Ivry-sur-Seine", Country: "France", CountryISO: "FR"}},
+			map[string]string{"edge-net.io~1city": "Paris", "edge-net.io~1country-iso": "FR"},
+			map[string]string{"edge-net.io~1city": "Paris", "edge-net.io~1country": "France", "edge-net.io~1country-iso": "FR"}},
+		// The names that cannot be label values are skipped, the spaces give way to underscores
+		{&fakeReverseGeocoder{place: Place{City: "São Paulo", Country: "United States"}},
+			map[string]string{"edge-net.io~1city": ""},
+			map[string]string{"edge-net.io~1city": "", "edge-net.io~1country": "United_States"}},
+		// A failure leaves the labels as they are
+		{&fakeReverseGeocoder{err: errors.New("provider unavailable")},
+			map[string]string{"edge-net.io~1city": ""},
+			map[string]string{"edge-net.io~1city": ""}},
+	}
+	defer SetReverseGeocoder(nil)
+	for _, test := range data {
+		SetReverseGeocoder(test.provider)
+		reverseGeocodeLabels(48.846, 2.357, test.labels)
+		if !reflect.DeepEqual(test.labels, test.expected) {
+			t.Errorf("reverseGeocodeLabels with %+v = %v, expected %v", test.provider.place, test.labels, test.expected)
+		}
+	}
+}
+
+func TestReverseGeocodeDisabled(t *testing.T) {
+	SetReverseGeocoder(nil)
+	labels := map[string]string{"edge-net.io~1city": ""}
+	reverseGeocodeLabels(48.846, 2.357, labels)
+	if !reflect.DeepEqual(labels, map[string]string{"edge-net.io~1city": ""}) {
+		t.Errorf("labels changed without a reverse geocoder: %v", labels)
+	}
+}
+
+func TestReverseGeocodeCache(t *testing.T) {
+	provider := &fakeReverseGeocoder{place: Place{City: "Paris"}}
+	SetReverseGeocoder(provider)
+	defer SetReverseGeocoder(nil)
+	// The nodes a few meters apart share the place, the one in another city has its own lookup
+	for _, coordinates := range [][]float64{{48.8461, 2.3571}, {48.8462, 2.3572}, {45.764, 4.835}} {
+		reverseGeocodeLabels(coordinates[0], coordinates[1], map[string]string{})
+	}
+	if provider.lookups != 2 {
+		t.Errorf("%d lookups, expected 2", provider.lookups)
+	}
+	// The failures aren't cached
+	provider.err = errors.New("provider unavailable")
+	reverseGeocodeLabels(40.7, -74.0, map[string]string{})
+	reverseGeocodeLabels(40.7, -74.0, map[string]string{})
+	if provider.lookups != 4 {
+		t.Errorf("%d lookups, expected the failed lookup to be retried", provider.lookups)
+	}
+}
+
+func TestNominatimGeocoder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/reverse" || r.URL.Query().Get("lat") != "48.846000" || r.Header.Get("User-Agent") == "" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"address": {"town": "Ivry-sur-Seine", "country": "France", "country_code": "fr"}}`)
+	}))
+	defer server.Close()
+
+	place, err := NewNominatimGeocoder(server.URL+"/").ReverseGeocode(48.846, 2.357)
+	if err != nil {
+		t.Fatalf("reverse geocoding failed: %s", err)
+	}
+	if expected := (Place{City: "Ivry-sur-Seine", Country: "France", CountryISO: "fr"}); place != expected {
+		t.Errorf("place is %+v, expected %+v", place, expected)
+	}
+	server.Close()
+	if _, err := NewNominatimGeocoder(server.URL).ReverseGeocode(48.846, 2.357); err == nil {
+		t.Error("no error with the server down")
+	}
+}
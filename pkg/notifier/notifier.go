@@ -0,0 +1,139 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/mailer"
+)
+
+// Notifier delivers the notification of the subject, whose content data is that of the mailer templates. The key
+// identifies the occurrence that the notification is about, by which the sinks that persist it deliver it once
+type Notifier interface {
+	Notify(key, subject string, contentData interface{}) error
+}
+
+// Email notifies by the mailer, through its outbox if one is configured
+type Email struct{}
+
+// Notify sends the email of the subject
+func (Email) Notify(key, subject string, contentData interface{}) error {
+	return mailer.Enqueue(key, subject, contentData)
+}
+
+// Slack posts the notifications to the incoming webhook of a Slack channel
+type Slack struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewSlack returns the notifier posting to the incoming webhook at the URL
+func NewSlack(webhookURL string) *Slack {
+	return &Slack{URL: webhookURL, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Notify posts the message formatted from the content data, each notification is posted as it comes regardless of the key
+func (s *Slack) Notify(key, subject string, contentData interface{}) error {
+	body, err := json.Marshal(map[string]string{"text": Format(subject, contentData)})
+	if err != nil {
+		return err
+	}
+	response, err := s.Client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("slack webhook responded with %s", response.Status)
+	}
+	return nil
+}
+
+// Fanout delivers the notifications to each of its notifiers, a sink that fails doesn't keep the others from
+// delivering
+type Fanout []Notifier
+
+// Notify delivers the notification to all the sinks and returns the errors of those that fail
+func (f Fanout) Notify(key, subject string, contentData interface{}) error {
+	var failures []string
+	for _, sink := range f {
+		if err := sink.Notify(key, subject, contentData); err != nil {
+			log.Printf("Notifier: %s notification not delivered by %T: %s", subject, sink, err)
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) != 0 {
+		return fmt.Errorf("%s notification not delivered: %s", subject, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// ForAuthority returns the notifier of the sinks that the authority selects, email only if it selects none
+func ForAuthority(authority *apps_v1alpha.Authority) Notifier {
+	if authority == nil || authority.Spec.Notifications == nil {
+		return Email{}
+	}
+	notifications := authority.Spec.Notifications
+	sinks := Fanout{}
+	if !notifications.DisableEmail {
+		sinks = append(sinks, Email{})
+	}
+	if notifications.SlackWebhookURL != "" {
+		sinks = append(sinks, NewSlack(notifications.SlackWebhookURL))
+	}
+	return sinks
+}
+
+// Format returns the plain text message of the notification, the verification codes are left out as they belong
+// in the emails to the users only
+func Format(subject string, contentData interface{}) string {
+	switch data := contentData.(type) {
+	case mailer.ResourceAllocationData:
+		message := fmt.Sprintf("[EdgeNet] %s: %s in %s", subject, data.Name, data.OwnerNamespace)
+		if data.ChildNamespace != "" {
+			message = fmt.Sprintf("%s, namespace %s", message, data.ChildNamespace)
+		}
+		if data.CommonData.Username != "" {
+			message = fmt.Sprintf("%s, for %s of %s", message, data.CommonData.Username, data.CommonData.Authority)
+		}
+		if len(data.Users) != 0 {
+			message = fmt.Sprintf("%s, users: %s", message, strings.Join(data.Users, ", "))
+		}
+		return message
+	case mailer.MultiProviderData:
+		message := fmt.Sprintf("[EdgeNet] %s: node %s (%s) %s", subject, data.Name, data.Host, data.Status)
+		if len(data.Message) != 0 {
+			message = fmt.Sprintf("%s, %s", message, strings.Join(data.Message, "; "))
+		}
+		return message
+	case mailer.VerifyContentData:
+		return fmt.Sprintf("[EdgeNet] %s: %s of %s", subject, data.CommonData.Username, data.CommonData.Authority)
+	case mailer.CommonContentData:
+		return fmt.Sprintf("[EdgeNet] %s: %s of %s", subject, data.CommonData.Username, data.CommonData.Authority)
+	case mailer.ValidationFailureContentData:
+		return fmt.Sprintf("[EdgeNet] %s: %s %s", subject, data.Kind, data.Name)
+	}
+	return fmt.Sprintf("[EdgeNet] %s", subject)
+}
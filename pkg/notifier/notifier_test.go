@@ -0,0 +1,122 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/mailer"
+)
+
+// slackServer records the messages posted to the fake incoming webhook, which responds with the status given
+func slackServer(t *testing.T, status int, messages *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%s request with %s content", r.Method, r.Header.Get("Content-Type"))
+		}
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("payload not decoded: %s", err)
+		}
+		*messages = append(*messages, payload["text"])
+		w.WriteHeader(status)
+	}))
+}
+
+func teamCreation() mailer.ResourceAllocationData {
+	contentData := mailer.ResourceAllocationData{}
+	contentData.CommonData.Authority = "edgenet"
+	contentData.CommonData.Username = "johndoe"
+	contentData.Authority = "edgenet"
+	contentData.Name = "demo"
+	contentData.OwnerNamespace = "authority-edgenet"
+	contentData.ChildNamespace = "authority-edgenet-team-demo"
+	return contentData
+}
+
+func TestSlack(t *testing.T) {
+	var messages []string
+	server := slackServer(t, http.StatusOK, &messages)
+	defer server.Close()
+
+	if err := NewSlack(server.URL).Notify("lab/joe", "team-creation", teamCreation()); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("%d messages posted, expected one", len(messages))
+	}
+	for _, expected := range []string{"team-creation", "demo", "authority-edgenet-team-demo", "johndoe"} {
+		if !strings.Contains(messages[0], expected) {
+			t.Errorf("message %q doesn't mention %s", messages[0], expected)
+		}
+	}
+
+	// The verification code is kept out of the channel
+	verification := mailer.VerifyContentData{Code: "s3cr3t"}
+	verification.CommonData.Username = "johndoe"
+	if message := Format("user-email-verification", verification); strings.Contains(message, "s3cr3t") {
+		t.Errorf("message %q reveals the code", message)
+	}
+
+	rejecting := slackServer(t, http.StatusForbidden, &messages)
+	defer rejecting.Close()
+	if err := NewSlack(rejecting.URL).Notify("lab/joe", "team-creation", teamCreation()); err == nil {
+		t.Error("rejected post not reported")
+	}
+}
+
+// recorder is a sink that records the subjects it is notified of
+type recorder struct {
+	subjects []string
+}
+
+func (r *recorder) Notify(key, subject string, contentData interface{}) error {
+	r.subjects = append(r.subjects, subject)
+	return nil
+}
+
+func TestForAuthority(t *testing.T) {
+	mailer.SetEnabled(false)
+	defer mailer.SetEnabled(true)
+	var messages []string
+	server := slackServer(t, http.StatusOK, &messages)
+	defer server.Close()
+
+	authority := &apps_v1alpha.Authority{}
+	if _, ok := ForAuthority(authority).(Email); !ok {
+		t.Error("authority without notifications not notified by email")
+	}
+	if _, ok := ForAuthority(nil).(Email); !ok {
+		t.Error("unknown authority not notified by email")
+	}
+
+	authority.Spec.Notifications = &apps_v1alpha.Notifications{SlackWebhookURL: server.URL}
+	sinks, ok := ForAuthority(authority).(Fanout)
+	if !ok || len(sinks) != 2 {
+		t.Fatalf("sinks are %v, expected email and slack", sinks)
+	}
+	if err := sinks.Notify("lab/joe", "team-creation", teamCreation()); err != nil {
+		t.Error(err)
+	}
+	if len(messages) != 1 {
+		t.Errorf("%d messages posted, expected one", len(messages))
+	}
+
+	authority.Spec.Notifications.DisableEmail = true
+	if sinks := ForAuthority(authority).(Fanout); len(sinks) != 1 {
+		t.Errorf("sinks are %v, expected slack only", sinks)
+	}
+
+	// A failing sink doesn't keep the others from delivering
+	delivered := &recorder{}
+	failing := NewSlack("http://127.0.0.1:0")
+	if err := (Fanout{failing, delivered}).Notify("lab/joe", "team-creation", teamCreation()); err == nil {
+		t.Error("failure not reported")
+	}
+	if len(delivered.subjects) != 1 {
+		t.Error("notification not delivered after the failure")
+	}
+}
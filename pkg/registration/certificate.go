@@ -0,0 +1,236 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	custconfig "edgenet/pkg/config"
+
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/client-go/util/cert"
+	"sigs.k8s.io/yaml"
+)
+
+// CertificateRequestAnnotation holds the PEM encoded certificate signing request that the user has made with a key of
+// its own, the cluster signs it so that the private key never leaves the user
+const CertificateRequestAnnotation = "edge-net.io/certificate-request"
+
+// The interval and the time limit to wait for the cluster to sign an approved certificate signing request
+var certificatePollInterval = 2 * time.Second
+var certificateTimeout = 5 * time.Minute
+
+// certificateValidity bounds how long the certificates that the cluster issues to the users may remain valid
+var certificateValidity = 365 * 24 * time.Hour
+
+// SetCertificateValidity configures how long the user certificates may remain valid at most, the certificate that the
+// cluster signs for longer is rejected
+func SetCertificateValidity(validity time.Duration) {
+	certificateValidity = validity
+}
+
+// kubeconfigDir is where the kubeconfig files that the mailer attaches are written, which tests replace
+var kubeconfigDir = "../../assets/kubeconfigs"
+
+// clusterServer returns the name and the server of the cluster, which tests replace
+var clusterServer = custconfig.GetClusterServerOfCurrentContext
+
+// CertificateUser returns the name of the user that the certificate of the user authenticates, which is distinct from
+// the service account of the user so that the certificate cannot act on behalf of any other identity
+func CertificateUser(namespace, name string) string {
+	return fmt.Sprintf("edgenet:%s:%s", namespace, name)
+}
+
+// UserSubjects returns the subjects that stand for the user in role bindings, the service account of the user and the
+// user that its certificate authenticates
+func UserSubjects(namespace, name string) []rbacv1.Subject {
+	return []rbacv1.Subject{
+		{Kind: "ServiceAccount", Name: name, Namespace: namespace},
+		{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: CertificateUser(namespace, name)},
+	}
+}
+
+// ValidateCSR checks that the certificate signing request is signed by its key and only asks for the identity of the user
+func ValidateCSR(userCopy *apps_v1alpha.User, csrPEM []byte) error {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != cert.CertificateRequestBlockType {
+		return fmt.Errorf("certificate signing request of user %s isn't PEM encoded", userCopy.GetName())
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return err
+	}
+	if err := request.CheckSignature(); err != nil {
+		return err
+	}
+	if expected := CertificateUser(userCopy.GetNamespace(), userCopy.GetName()); request.Subject.CommonName != expected {
+		return fmt.Errorf("certificate signing request is for %s rather than %s", request.Subject.CommonName, expected)
+	}
+	// The organizations are the groups of the user, which would grant what the groups are bound to
+	if len(request.Subject.Organization) != 0 {
+		return fmt.Errorf("certificate signing request of user %s asks for groups %v", userCopy.GetName(), request.Subject.Organization)
+	}
+	if len(request.DNSNames) != 0 || len(request.EmailAddresses) != 0 || len(request.IPAddresses) != 0 || len(request.URIs) != 0 {
+		return fmt.Errorf("certificate signing request of user %s asks for alternative names", userCopy.GetName())
+	}
+	return nil
+}
+
+// RequestCertificate submits the certificate signing request of the user to the cluster, a former request of the user
+// is replaced so that the certificate can be issued again
+func RequestCertificate(clientset kubernetes.Interface, userCopy *apps_v1alpha.User, csrPEM []byte) (*certificatesv1beta1.CertificateSigningRequest, error) {
+	name := fmt.Sprintf("%s-%s", userCopy.GetNamespace(), userCopy.GetName())
+	err := clientset.CertificatesV1beta1().CertificateSigningRequests().Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	csr := &certificatesv1beta1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: certificatesv1beta1.CertificateSigningRequestSpec{
+			Request: csrPEM,
+			Usages:  []certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageKeyEncipherment, certificatesv1beta1.UsageClientAuth},
+		},
+	}
+	return clientset.CertificatesV1beta1().CertificateSigningRequests().Create(csr)
+}
+
+// ApproveCertificate approves the certificate signing request so that the cluster signs it by its CA
+func ApproveCertificate(clientset kubernetes.Interface, csr *certificatesv1beta1.CertificateSigningRequest) (*certificatesv1beta1.CertificateSigningRequest, error) {
+	csrCopy := csr.DeepCopy()
+	for _, condition := range csrCopy.Status.Conditions {
+		if condition.Type == certificatesv1beta1.CertificateApproved {
+			return csrCopy, nil
+		}
+	}
+	csrCopy.Status.Conditions = append(csrCopy.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{
+		Type:           certificatesv1beta1.CertificateApproved,
+		Reason:         "EdgeNetUserRegistration",
+		Message:        "Approved by EdgeNet for the registered user",
+		LastUpdateTime: metav1.Now(),
+	})
+	return clientset.CertificatesV1beta1().CertificateSigningRequests().UpdateApproval(csrCopy)
+}
+
+// ServiceAccountCA returns the CA certificate in the token secret of the service account
+func ServiceAccountCA(clientset kubernetes.Interface, serviceAccount *corev1.ServiceAccount) ([]byte, error) {
+	for _, accountSecret := range serviceAccount.Secrets {
+		secret, err := clientset.CoreV1().Secrets(serviceAccount.GetNamespace()).Get(accountSecret.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if caCert, ok := secret.Data["ca.crt"]; ok && secret.Type == corev1.SecretTypeServiceAccountToken {
+			return caCert, nil
+		}
+	}
+	return nil, fmt.Errorf("service account %s in %s doesn't have a token secret", serviceAccount.GetName(), serviceAccount.GetNamespace())
+}
+
+// waitForCertificate returns the certificate once the cluster has signed the request, the certificate that remains
+// valid for longer than the bound is rejected
+func waitForCertificate(clientset kubernetes.Interface, name string) ([]byte, error) {
+	var certPEM []byte
+	err := wait.PollImmediate(certificatePollInterval, certificateTimeout, func() (bool, error) {
+		csr, err := clientset.CertificatesV1beta1().CertificateSigningRequests().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, condition := range csr.Status.Conditions {
+			if condition.Type == certificatesv1beta1.CertificateDenied {
+				return false, fmt.Errorf("certificate signing request %s denied: %s", name, condition.Message)
+			}
+		}
+		certPEM = csr.Status.Certificate
+		return len(certPEM) > 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	certs, err := cert.ParseCertsPEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if limit := time.Now().Add(certificateValidity); certs[0].NotAfter.After(limit) {
+		return nil, fmt.Errorf("certificate of %s remains valid until %s, beyond the bound of %s", name, certs[0].NotAfter.UTC().Format(time.RFC3339), certificateValidity)
+	}
+	return certPEM, nil
+}
+
+// ClientKeyFile returns the file of the private key that the kubeconfig of the user refers to, next to the kubeconfig
+func ClientKeyFile(userCopy *apps_v1alpha.User) string {
+	return fmt.Sprintf("edgenet-%s.key", userCopy.GetName())
+}
+
+// MakeCertificateConfig returns a kubeconfig that authenticates the user by the certificate given, with the namespace
+// of the user as that of the context. The kubeconfig refers to the private key of the user by its file, as the key
+// stays with the user.
+func MakeCertificateConfig(server, cluster string, caCert []byte, userCopy *apps_v1alpha.User, certPEM []byte) ([]byte, error) {
+	contextName := fmt.Sprintf("%s@%s", userCopy.GetName(), cluster)
+	newKubeConfig := clientcmdapiv1.Config{
+		Kind:       "Config",
+		APIVersion: "v1",
+		Clusters: []clientcmdapiv1.NamedCluster{{Name: cluster,
+			Cluster: clientcmdapiv1.Cluster{Server: server, CertificateAuthorityData: caCert}}},
+		AuthInfos: []clientcmdapiv1.NamedAuthInfo{{Name: userCopy.GetName(),
+			AuthInfo: clientcmdapiv1.AuthInfo{ClientCertificateData: certPEM, ClientKey: ClientKeyFile(userCopy)}}},
+		Contexts: []clientcmdapiv1.NamedContext{{Name: contextName,
+			Context: clientcmdapiv1.Context{Cluster: cluster, AuthInfo: userCopy.GetName(), Namespace: userCopy.GetNamespace()}}},
+		CurrentContext: contextName,
+	}
+	return yaml.Marshal(newKubeConfig)
+}
+
+// CreateCertificateConfig has the cluster CA sign the certificate signing request of the user, and writes the kubeconfig
+// that uses the certificate where the mailer attaches it to the registration email. The CA certificate is the one the
+// clients verify the server by. The kubeconfig holds no private key, the user adds its own.
+func CreateCertificateConfig(clientset kubernetes.Interface, userCopy *apps_v1alpha.User, csrPEM, caCert []byte) ([]byte, error) {
+	if err := ValidateCSR(userCopy, csrPEM); err != nil {
+		return nil, err
+	}
+	csr, err := RequestCertificate(clientset, userCopy, csrPEM)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = ApproveCertificate(clientset, csr); err != nil {
+		return nil, err
+	}
+	certPEM, err := waitForCertificate(clientset, csr.GetName())
+	if err != nil {
+		return nil, err
+	}
+	cluster, server, err := clusterServer()
+	if err != nil {
+		return nil, err
+	}
+	kubeconfig, err := MakeCertificateConfig(server, cluster, caCert, userCopy, certPEM)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(fmt.Sprintf("%s/edgenet-%s-%s.cfg", kubeconfigDir, userCopy.GetNamespace(), userCopy.GetName()), kubeconfig, 0600)
+	return kubeconfig, err
+}
@@ -0,0 +1,233 @@
+package registration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/client-go/util/cert"
+	"sigs.k8s.io/yaml"
+)
+
+// testCA signs the certificate signing requests as the cluster does once they are approved
+type testCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := cert.NewSelfSignedCACert(cert.Config{CommonName: "kubernetes"}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{key: key, cert: caCert}
+}
+
+func (ca *testCA) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+func (ca *testCA) sign(csrPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(csrPEM)
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      request.Subject,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, request.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// newSigningClientset returns a clientset whose cluster signs the requests on approval, or denies them
+func newSigningClientset(t *testing.T, ca *testCA, deny bool) *testclient.Clientset {
+	clientset := testclient.NewSimpleClientset()
+	clientset.PrependReactor("update", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "approval" {
+			return false, nil, nil
+		}
+		csr := action.(k8stesting.UpdateAction).GetObject().(*certificatesv1beta1.CertificateSigningRequest)
+		if deny {
+			csr.Status.Conditions = []certificatesv1beta1.CertificateSigningRequestCondition{{Type: certificatesv1beta1.CertificateDenied, Message: "not allowed"}}
+			return false, nil, nil
+		}
+		certPEM, err := ca.sign(csr.Spec.Request)
+		if err != nil {
+			t.Errorf("request not signed: %s", err)
+		}
+		csr.Status.Certificate = certPEM
+		return false, nil, nil
+	})
+	return clientset
+}
+
+// newCSR returns the certificate signing request that a user makes with a key of its own
+func newCSR(t *testing.T, subject pkix.Name, dnsNames []string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM, err := cert.MakeCSR(key, &subject, dnsNames, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csrPEM
+}
+
+func TestValidateCSR(t *testing.T) {
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"}}
+	if err := ValidateCSR(user, newCSR(t, pkix.Name{CommonName: "edgenet:authority-edgenet:johndoe"}, nil)); err != nil {
+		t.Errorf("request for the user rejected: %s", err)
+	}
+	// The request cannot stand for another identity, join groups, or name hosts
+	invalid := map[string][]byte{
+		"service account": newCSR(t, pkix.Name{CommonName: "system:serviceaccount:authority-edgenet:johndoe"}, nil),
+		"other user":      newCSR(t, pkix.Name{CommonName: "edgenet:authority-edgenet:janedoe"}, nil),
+		"groups":          newCSR(t, pkix.Name{CommonName: "edgenet:authority-edgenet:johndoe", Organization: []string{"system:masters"}}, nil),
+		"alternative":     newCSR(t, pkix.Name{CommonName: "edgenet:authority-edgenet:johndoe"}, []string{"edgenet.example"}),
+		"not PEM":         []byte("johndoe"),
+	}
+	for name, csrPEM := range invalid {
+		if err := ValidateCSR(user, csrPEM); err == nil {
+			t.Errorf("request with %s accepted", name)
+		}
+	}
+}
+
+func TestUserSubjects(t *testing.T) {
+	subjects := UserSubjects("authority-edgenet", "johndoe")
+	if len(subjects) != 2 || subjects[0].Kind != "ServiceAccount" || subjects[0].Name != "johndoe" ||
+		subjects[1].Kind != "User" || subjects[1].Name != "edgenet:authority-edgenet:johndoe" {
+		t.Errorf("subjects are %v, expected the service account and the user of the certificate", subjects)
+	}
+}
+
+func TestApproveCertificate(t *testing.T) {
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"}}
+	clientset := testclient.NewSimpleClientset()
+	csrPEM := newCSR(t, pkix.Name{CommonName: CertificateUser(user.GetNamespace(), user.GetName())}, nil)
+	csr, err := RequestCertificate(clientset, user, csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approved, err := ApproveCertificate(clientset, csr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Approving again leaves the conditions as they are
+	approved, _ = ApproveCertificate(clientset, approved)
+	if len(approved.Status.Conditions) != 1 || approved.Status.Conditions[0].Type != certificatesv1beta1.CertificateApproved {
+		t.Errorf("conditions are %v, expected the approval only", approved.Status.Conditions)
+	}
+	// Requesting the certificate again replaces the former request
+	if _, err := RequestCertificate(clientset, user, csrPEM); err != nil {
+		t.Errorf("certificate not requested again: %s", err)
+	}
+}
+
+func TestCreateCertificateConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfigs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(dir string) { kubeconfigDir = dir }(kubeconfigDir)
+	kubeconfigDir = dir
+	defer func(lookup func() (string, string, error)) { clusterServer = lookup }(clusterServer)
+	clusterServer = func() (string, string, error) { return "kubernetes", "https://edgenet.example:6443", nil }
+	defer func(interval, timeout time.Duration) { certificatePollInterval, certificateTimeout = interval, timeout }(certificatePollInterval, certificateTimeout)
+	certificatePollInterval, certificateTimeout = 10*time.Millisecond, 100*time.Millisecond
+
+	ca := newTestCA(t)
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"}}
+	csrPEM := newCSR(t, pkix.Name{CommonName: CertificateUser(user.GetNamespace(), user.GetName())}, nil)
+	kubeconfig, err := CreateCertificateConfig(newSigningClientset(t, ca, false), user, csrPEM, ca.certPEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(filepath.Join(dir, "edgenet-authority-edgenet-johndoe.cfg"))
+	if err != nil || string(written) != string(kubeconfig) {
+		t.Errorf("kubeconfig not written for the mailer: %v", err)
+	}
+	config := clientcmdapiv1.Config{}
+	if err := yaml.Unmarshal(kubeconfig, &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Clusters) != 1 || config.Clusters[0].Cluster.Server != "https://edgenet.example:6443" ||
+		string(config.Clusters[0].Cluster.CertificateAuthorityData) != string(ca.certPEM()) {
+		t.Errorf("clusters are %v", config.Clusters)
+	}
+	if len(config.Contexts) != 1 || config.Contexts[0].Name != config.CurrentContext || config.Contexts[0].Context.Namespace != "authority-edgenet" {
+		t.Errorf("contexts are %v, expected the current one in the namespace of the user", config.Contexts)
+	}
+	if len(config.AuthInfos) != 1 || config.AuthInfos[0].Name != "johndoe" {
+		t.Fatalf("auth infos are %v", config.AuthInfos)
+	}
+	authInfo := config.AuthInfos[0].AuthInfo
+	clientCerts, err := cert.ParseCertsPEM(authInfo.ClientCertificateData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if _, err := clientCerts[0].Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("client certificate not signed by the cluster CA: %s", err)
+	}
+	if clientCerts[0].Subject.CommonName != "edgenet:authority-edgenet:johndoe" {
+		t.Errorf("certificate issued for %s", clientCerts[0].Subject.CommonName)
+	}
+	// The private key stays with the user, the kubeconfig refers to it by its file
+	if len(authInfo.ClientKeyData) != 0 || authInfo.ClientKey != "edgenet-johndoe.key" {
+		t.Errorf("client key is %q with %d bytes of data, expected the file of the user", authInfo.ClientKey, len(authInfo.ClientKeyData))
+	}
+
+	// A denied request fails rather than waiting for the certificate
+	if _, err := CreateCertificateConfig(newSigningClientset(t, ca, true), user, csrPEM, ca.certPEM()); err == nil {
+		t.Error("kubeconfig created from a denied request")
+	}
+	// The request for another identity isn't submitted
+	clientset := newSigningClientset(t, ca, false)
+	forged := newCSR(t, pkix.Name{CommonName: "system:serviceaccount:authority-edgenet:johndoe"}, nil)
+	if _, err := CreateCertificateConfig(clientset, user, forged, ca.certPEM()); err == nil {
+		t.Error("kubeconfig created from a request for another identity")
+	}
+	if csrs, _ := clientset.CertificatesV1beta1().CertificateSigningRequests().List(metav1.ListOptions{}); len(csrs.Items) != 0 {
+		t.Errorf("requests %v submitted for another identity", csrs.Items)
+	}
+	// The certificate valid for longer than the bound is rejected, the test CA signs them for an hour
+	defer SetCertificateValidity(certificateValidity)
+	SetCertificateValidity(30 * time.Minute)
+	if _, err := CreateCertificateConfig(newSigningClientset(t, ca, false), user, csrPEM, ca.certPEM()); err == nil {
+		t.Error("kubeconfig created with a certificate beyond the validity bound")
+	}
+}
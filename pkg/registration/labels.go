@@ -0,0 +1,54 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The labels of the resources that the controllers create, which tell them apart from those that admins create
+const (
+	// ManagedByLabel is the standard label of the tool that manages the resource
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedBy is the value of ManagedByLabel for the resources of the controllers
+	ManagedBy = "edgenet"
+	// OwnerKindLabel tells the kind of the object for which the controller created the resource, such as team
+	OwnerKindLabel = "edge-net.io/owner-kind"
+)
+
+// SetManagedLabels adds the management labels to the resource that a controller creates for an object of the kind given,
+// and returns whether they were missing
+func SetManagedLabels(object metav1.Object, ownerKind string) bool {
+	labels := object.GetLabels()
+	if labels[ManagedByLabel] == ManagedBy && labels[OwnerKindLabel] == ownerKind {
+		return false
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ManagedByLabel] = ManagedBy
+	labels[OwnerKindLabel] = ownerKind
+	object.SetLabels(labels)
+	return true
+}
+
+// ManagedSelector returns the label selector of the resources that the controllers create for the objects of the kind given
+func ManagedSelector(ownerKind string) string {
+	return fmt.Sprintf("%s=%s,%s=%s", ManagedByLabel, ManagedBy, OwnerKindLabel, ownerKind)
+}
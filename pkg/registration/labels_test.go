@@ -0,0 +1,59 @@
+package registration
+
+import (
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSetManagedLabels(t *testing.T) {
+	roleBinding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "demo", Labels: map[string]string{"owner": "team"}}}
+	if !SetManagedLabels(roleBinding, "team") {
+		t.Error("missing labels not reported")
+	}
+	expected := map[string]string{"owner": "team", "app.kubernetes.io/managed-by": "edgenet", "edge-net.io/owner-kind": "team"}
+	for key, value := range expected {
+		if roleBinding.Labels[key] != value {
+			t.Errorf("labels are %v, expected %v", roleBinding.Labels, expected)
+		}
+	}
+	if SetManagedLabels(roleBinding, "team") {
+		t.Error("labels reported missing once set")
+	}
+	if ManagedSelector("team") != "app.kubernetes.io/managed-by=edgenet,edge-net.io/owner-kind=team" {
+		t.Errorf("selector is %s", ManagedSelector("team"))
+	}
+}
+
+func TestEnsureClusterRoleLabels(t *testing.T) {
+	rules := []rbacv1.PolicyRule{{APIGroups: []string{"apps.edgenet.io"}, Resources: []string{"teams"}, Verbs: []string{"get"}}}
+	// The cluster role was created before it got labeled
+	clientset := testclient.NewSimpleClientset(&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "team-user"}, Rules: rules})
+	clusterRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "team-user"}, Rules: rules}
+	SetManagedLabels(clusterRole, "team")
+	if err := EnsureClusterRole(clusterRole, clientset); err != nil {
+		t.Fatal(err)
+	}
+	clusterRoleLabeled, _ := clientset.RbacV1().ClusterRoles().Get("team-user", metav1.GetOptions{})
+	if clusterRoleLabeled.Labels[OwnerKindLabel] != "team" || clusterRoleLabeled.Labels[ManagedByLabel] != "edgenet" {
+		t.Errorf("labels of the existing cluster role are %v", clusterRoleLabeled.Labels)
+	}
+}
+
+func TestRoleBindingsByRolesLabels(t *testing.T) {
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.UserSpec{Roles: []string{"User", "Manager"}}}
+	roleBindings := RoleBindingsByRoles(user, "authority-edgenet-team-demo", "Team")
+	if len(roleBindings) != 2 {
+		t.Fatalf("role bindings are %v, expected one for each role", roleBindings)
+	}
+	for _, roleBinding := range roleBindings {
+		if roleBinding.Labels[OwnerKindLabel] != "team" || roleBinding.Labels[ManagedByLabel] != "edgenet" {
+			t.Errorf("labels of role binding %s are %v", roleBinding.GetName(), roleBinding.Labels)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"edgenet/pkg/namespace"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EffectivePermissions are the roles that a user holds across the cluster and in each namespace
+type EffectivePermissions struct {
+	Authority string `json:"authority"`
+	Username  string `json:"username"`
+	// Cluster are the roles held by the cluster role bindings, which apply to all namespaces
+	Cluster []Grant `json:"cluster"`
+	// Namespaces are the roles held by the role bindings, sorted by namespace
+	Namespaces []NamespaceGrants `json:"namespaces"`
+}
+
+// NamespaceGrants are the roles held in a namespace, whose owner labels tell the authority, team, or slice it is for
+type NamespaceGrants struct {
+	Namespace string  `json:"namespace"`
+	Owner     string  `json:"owner,omitempty"`
+	OwnerName string  `json:"ownerName,omitempty"`
+	Grants    []Grant `json:"grants"`
+}
+
+// Grant is a role held through a binding
+type Grant struct {
+	Binding  string `json:"binding"`
+	RoleKind string `json:"roleKind"`
+	Role     string `json:"role"`
+}
+
+// GetEffectivePermissions returns the roles that the user of the authority holds by the role bindings and the cluster
+// role bindings whose subjects are the service account of the user, either by its kind or by the name that its
+// certificate authenticates, or the group of the service accounts in the namespace of the user. The groups of all the
+// service accounts and of all the authenticated users are left out, as every user holds their roles.
+func GetEffectivePermissions(clientset kubernetes.Interface, authority, username string) (*EffectivePermissions, error) {
+	userNamespace := namespace.AuthorityName(authority)
+	holds := func(subjects []rbacv1.Subject) bool {
+		for _, subject := range subjects {
+			switch {
+			case subject.Kind == rbacv1.ServiceAccountKind && subject.Name == username && subject.Namespace == userNamespace,
+				subject.Kind == rbacv1.UserKind && subject.Name == fmt.Sprintf("system:serviceaccount:%s:%s", userNamespace, username),
+				subject.Kind == rbacv1.GroupKind && subject.Name == fmt.Sprintf("system:serviceaccounts:%s", userNamespace):
+				return true
+			}
+		}
+		return false
+	}
+	permissions := &EffectivePermissions{Authority: authority, Username: username, Cluster: []Grant{}, Namespaces: []NamespaceGrants{}}
+
+	clusterRoleBindingsRaw, err := clientset.RbacV1().ClusterRoleBindings().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, clusterRoleBindingRow := range clusterRoleBindingsRaw.Items {
+		if holds(clusterRoleBindingRow.Subjects) {
+			permissions.Cluster = append(permissions.Cluster, Grant{Binding: clusterRoleBindingRow.GetName(),
+				RoleKind: clusterRoleBindingRow.RoleRef.Kind, Role: clusterRoleBindingRow.RoleRef.Name})
+		}
+	}
+	sortGrants(permissions.Cluster)
+
+	roleBindingsRaw, err := clientset.RbacV1().RoleBindings(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	byNamespace := map[string][]Grant{}
+	for _, roleBindingRow := range roleBindingsRaw.Items {
+		if holds(roleBindingRow.Subjects) {
+			byNamespace[roleBindingRow.GetNamespace()] = append(byNamespace[roleBindingRow.GetNamespace()],
+				Grant{Binding: roleBindingRow.GetName(), RoleKind: roleBindingRow.RoleRef.Kind, Role: roleBindingRow.RoleRef.Name})
+		}
+	}
+	for namespaceName, grants := range byNamespace {
+		namespaceGrants := NamespaceGrants{Namespace: namespaceName, Grants: grants}
+		// The namespace that is gone meanwhile is listed without its owner
+		if namespaceRaw, err := clientset.CoreV1().Namespaces().Get(namespaceName, metav1.GetOptions{}); err == nil {
+			namespaceGrants.Owner = namespaceRaw.Labels["owner"]
+			namespaceGrants.OwnerName = namespaceRaw.Labels["owner-name"]
+		}
+		sortGrants(namespaceGrants.Grants)
+		permissions.Namespaces = append(permissions.Namespaces, namespaceGrants)
+	}
+	sort.Slice(permissions.Namespaces, func(i, j int) bool {
+		return permissions.Namespaces[i].Namespace < permissions.Namespaces[j].Namespace
+	})
+	return permissions, nil
+}
+
+func sortGrants(grants []Grant) {
+	sort.Slice(grants, func(i, j int) bool { return grants[i].Binding < grants[j].Binding })
+}
+
+// ServeEffectivePermissions responds with the effective permissions of the user that the authority and username
+// query parameters tell
+func ServeEffectivePermissions(clientset kubernetes.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authority, username := r.URL.Query().Get("authority"), r.URL.Query().Get("username")
+		if authority == "" || username == "" {
+			http.Error(w, "authority and username are required", http.StatusBadRequest)
+			return
+		}
+		permissions, err := GetEffectivePermissions(clientset, authority, username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(permissions); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
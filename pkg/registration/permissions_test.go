@@ -0,0 +1,99 @@
+package registration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+// newPermissionsClientset returns a clientset where joe of edgenet holds roles in the authority, a team, and a slice,
+// along with the roles of others
+func newPermissionsClientset() *testclient.Clientset {
+	joe := rbacv1.Subject{Kind: "ServiceAccount", Name: "joe", Namespace: "authority-edgenet"}
+	namespaceOf := func(name, owner, ownerName string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"owner": owner, "owner-name": ownerName, "authority-name": "edgenet"}}}
+	}
+	roleBinding := func(namespace, name, role string, subjects ...rbacv1.Subject) *rbacv1.RoleBinding {
+		return &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Subjects: subjects,
+			RoleRef: rbacv1.RoleRef{Kind: "ClusterRole", Name: role}}
+	}
+	return testclient.NewSimpleClientset(
+		namespaceOf("authority-edgenet", "authority", "edgenet"),
+		namespaceOf("authority-edgenet-team-lab", "team", "lab"),
+		namespaceOf("authority-edgenet-slice-demo", "slice", "demo"),
+		roleBinding("authority-edgenet", "authority-edgenet-joe-authority-manager", "authority-manager", joe),
+		roleBinding("authority-edgenet", "authority-edgenet-ann-authority-admin", "authority-admin",
+			rbacv1.Subject{Kind: "ServiceAccount", Name: "ann", Namespace: "authority-edgenet"}),
+		roleBinding("authority-edgenet-team-lab", "authority-edgenet-joe-team-admin", "team-admin", joe),
+		roleBinding("authority-edgenet-team-lab", "permission-ops-monitoring", "monitoring",
+			rbacv1.Subject{Kind: "ServiceAccount", Name: "ann", Namespace: "authority-edgenet"}, joe),
+		// The certificate of the user authenticates it by the name of its service account
+		roleBinding("authority-edgenet-slice-demo", "slice-user", "slice-user",
+			rbacv1.Subject{Kind: "User", Name: "system:serviceaccount:authority-edgenet:joe"}),
+		// joe of another authority is someone else
+		roleBinding("authority-edgenet-slice-demo", "slice-admin", "slice-admin",
+			rbacv1.Subject{Kind: "ServiceAccount", Name: "joe", Namespace: "authority-lip6"}),
+		// Every service account is in the group, which tells nothing about joe
+		roleBinding("authority-edgenet-slice-demo", "everyone", "view",
+			rbacv1.Subject{Kind: "Group", Name: "system:serviceaccounts"}),
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-joe-for-authority"}, Subjects: []rbacv1.Subject{joe},
+			RoleRef: rbacv1.RoleRef{Kind: "ClusterRole", Name: "authority-edgenet"}},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-ann-for-authority"},
+			Subjects: []rbacv1.Subject{{Kind: "ServiceAccount", Name: "ann", Namespace: "authority-edgenet"}},
+			RoleRef:  rbacv1.RoleRef{Kind: "ClusterRole", Name: "authority-edgenet"}})
+}
+
+func TestGetEffectivePermissions(t *testing.T) {
+	permissions, err := GetEffectivePermissions(newPermissionsClientset(), "edgenet", "joe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedCluster := []Grant{{Binding: "authority-edgenet-joe-for-authority", RoleKind: "ClusterRole", Role: "authority-edgenet"}}
+	if !reflect.DeepEqual(permissions.Cluster, expectedCluster) {
+		t.Errorf("cluster roles are %v, expected %v", permissions.Cluster, expectedCluster)
+	}
+	expected := []NamespaceGrants{
+		{Namespace: "authority-edgenet", Owner: "authority", OwnerName: "edgenet", Grants: []Grant{
+			{Binding: "authority-edgenet-joe-authority-manager", RoleKind: "ClusterRole", Role: "authority-manager"}}},
+		{Namespace: "authority-edgenet-slice-demo", Owner: "slice", OwnerName: "demo", Grants: []Grant{
+			{Binding: "slice-user", RoleKind: "ClusterRole", Role: "slice-user"}}},
+		{Namespace: "authority-edgenet-team-lab", Owner: "team", OwnerName: "lab", Grants: []Grant{
+			{Binding: "authority-edgenet-joe-team-admin", RoleKind: "ClusterRole", Role: "team-admin"},
+			{Binding: "permission-ops-monitoring", RoleKind: "ClusterRole", Role: "monitoring"}}},
+	}
+	if !reflect.DeepEqual(permissions.Namespaces, expected) {
+		t.Errorf("roles are %+v, expected %+v", permissions.Namespaces, expected)
+	}
+
+	// The user without any role holds none
+	permissions, _ = GetEffectivePermissions(newPermissionsClientset(), "edgenet", "bob")
+	if len(permissions.Cluster) != 0 || len(permissions.Namespaces) != 0 {
+		t.Errorf("roles of bob are %+v", permissions)
+	}
+}
+
+func TestServeEffectivePermissions(t *testing.T) {
+	handler := ServeEffectivePermissions(newPermissionsClientset())
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/debug/permissions?authority=edgenet&username=joe", nil))
+	permissions := EffectivePermissions{}
+	if err := json.NewDecoder(recorder.Body).Decode(&permissions); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("response %d not decoded: %v", recorder.Code, err)
+	}
+	if permissions.Username != "joe" || len(permissions.Namespaces) != 3 {
+		t.Errorf("permissions are %+v", permissions)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/debug/permissions?username=joe", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("request without the authority responded with %d", recorder.Code)
+	}
+}
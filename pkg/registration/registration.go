@@ -32,32 +32,44 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/cert"
 	kubeconfigutil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
 	cmdconfig "k8s.io/kubernetes/pkg/kubectl/cmd/config"
 )
 
+// clusterRolePrefix is prepended to the names of the cluster roles that the controllers create, so that
+// they don't collide with those of other systems in a shared cluster
+var clusterRolePrefix string
+
+// SetClusterRolePrefix configures the prefix of the cluster role names, such as "edgenet:"
+func SetClusterRolePrefix(prefix string) {
+	clusterRolePrefix = prefix
+}
+
+// ClusterRoleName returns the name of the cluster role along with the prefix configured
+func ClusterRoleName(name string) string {
+	return clusterRolePrefix + name
+}
+
 // CreateSpecificRoleBindings generates role bindings to allow users to access their user objects and the authority to which they belong
-func CreateSpecificRoleBindings(userCopy *apps_v1alpha.User) {
-	clientset, err := authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
-	}
+func CreateSpecificRoleBindings(userCopy *apps_v1alpha.User, clientset kubernetes.Interface) {
 	// When a user is deleted, the owner references feature allows the related objects to be automatically removed
 	userOwnerReferences := setOwnerReferences(userCopy)
-	// Put the service account dedicated to the user into the role bind subjects
-	rbSubjects := []rbacv1.Subject{{Kind: "ServiceAccount", Name: userCopy.GetName(), Namespace: userCopy.GetNamespace()}}
+	// Put the service account dedicated to the user, and the user of its certificate, into the role bind subjects
+	rbSubjects := UserSubjects(userCopy.GetNamespace(), userCopy.GetName())
 	// This section allows the user to get user object that belongs to him. The role, which gets used by the binding object,
 	// generated by the user controller when the user object created.
 	roleName := fmt.Sprintf("user-%s", userCopy.GetName())
 	roleRef := rbacv1.RoleRef{Kind: "Role", Name: roleName}
 	roleBind := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: userCopy.GetNamespace(), Name: fmt.Sprintf("%s-%s", userCopy.GetNamespace(), roleName),
 		OwnerReferences: userOwnerReferences}, Subjects: rbSubjects, RoleRef: roleRef}
-	_, err = clientset.RbacV1().RoleBindings(userCopy.GetNamespace()).Create(roleBind)
+	SetManagedLabels(roleBind, "user")
+	_, err := clientset.RbacV1().RoleBindings(userCopy.GetNamespace()).Create(roleBind)
 	if err != nil {
 		log.Printf("Couldn't create %s role binding in namespace of %s: %s", roleName, userCopy.GetNamespace(), userCopy.GetName())
 		log.Println(err.Error())
@@ -66,9 +78,10 @@ func CreateSpecificRoleBindings(userCopy *apps_v1alpha.User) {
 	// generated by the authority controller when the authority object created.
 	userOwnerNamespace, _ := clientset.CoreV1().Namespaces().Get(userCopy.GetNamespace(), metav1.GetOptions{})
 	roleName = fmt.Sprintf("authority-%s", userOwnerNamespace.Labels["authority-name"])
-	roleRef = rbacv1.RoleRef{Kind: "ClusterRole", Name: roleName}
+	roleRef = rbacv1.RoleRef{Kind: "ClusterRole", Name: ClusterRoleName(roleName)}
 	clusterRoleBind := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%s-for-authority", userCopy.GetNamespace(), userCopy.GetName()),
 		OwnerReferences: userOwnerReferences}, Subjects: rbSubjects, RoleRef: roleRef}
+	SetManagedLabels(clusterRoleBind, "user")
 	_, err = clientset.RbacV1().ClusterRoleBindings().Create(clusterRoleBind)
 	if err != nil {
 		log.Printf("Couldn't create %s role binding in namespace of %s: %s", roleName, userCopy.GetNamespace(), userCopy.GetName())
@@ -76,30 +89,107 @@ func CreateSpecificRoleBindings(userCopy *apps_v1alpha.User) {
 	}
 }
 
-// CreateRoleBindingsByRoles generates the rolebindings according to user roles in the namespace specified
-func CreateRoleBindingsByRoles(userCopy *apps_v1alpha.User, namespace string, namespaceType string) {
-	clientset, err := authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+// CreateRoleBindingsByRoles generates the rolebindings according to user roles in the namespace specified,
+// and returns the first error that occurs while the rest of the role bindings are still created. The role bindings
+// that already exist are kept, so it is safe to call on every reconcile.
+func CreateRoleBindingsByRoles(userCopy *apps_v1alpha.User, namespace string, namespaceType string, clientset kubernetes.Interface) error {
+	var firstErr error
+	for _, roleBind := range RoleBindingsByRoles(userCopy, namespace, namespaceType) {
+		if err := EnsureRoleBinding(roleBind, clientset); err != nil {
+			log.Printf("Couldn't create %s role binding in namespace of %s: %s - %s", roleBind.RoleRef.Name, namespace, userCopy.GetNamespace(), userCopy.GetName())
+			log.Println(err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
+	return firstErr
+}
+
+// RoleBindingsByRoles returns the rolebindings that the user roles require in the namespace specified
+func RoleBindingsByRoles(userCopy *apps_v1alpha.User, namespace string, namespaceType string) []*rbacv1.RoleBinding {
 	// When a user is deleted, the owner references feature allows the related objects to be automatically removed
 	ownerReferences := setOwnerReferences(userCopy)
-	// Put the service account dedicated to the user into the role bind subjects
-	rbSubjects := []rbacv1.Subject{{Kind: "ServiceAccount", Name: userCopy.GetName(), Namespace: userCopy.GetNamespace()}}
-	// This loop creates role bindings depending on roles
+	// Put the service account dedicated to the user, and the user of its certificate, into the role bind subjects
+	rbSubjects := UserSubjects(userCopy.GetNamespace(), userCopy.GetName())
+	roleBindings := []*rbacv1.RoleBinding{}
+	// This loop makes a role binding for each role
 	for _, userRole := range userCopy.Spec.Roles {
 		// Roles are pre-generated by the controllers
 		roleName := fmt.Sprintf("%s-%s", strings.ToLower(namespaceType), strings.ToLower(userRole))
-		roleRef := rbacv1.RoleRef{Kind: "ClusterRole", Name: roleName}
+		// The names of the role bindings remain the same whatever the prefix of the cluster roles
+		roleRef := rbacv1.RoleRef{Kind: "ClusterRole", Name: ClusterRoleName(roleName)}
 		roleBind := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: fmt.Sprintf("%s-%s-%s", userCopy.GetNamespace(), userCopy.GetName(), roleName),
 			OwnerReferences: ownerReferences}, Subjects: rbSubjects, RoleRef: roleRef}
-		_, err = clientset.RbacV1().RoleBindings(namespace).Create(roleBind)
-		if err != nil {
-			log.Printf("Couldn't create %s role binding in namespace of %s: %s - %s", userRole, namespace, userCopy.GetNamespace(), userCopy.GetName())
-			log.Println(err.Error())
+		// The role bindings belong to the kind of the namespace, whose controller manages them
+		SetManagedLabels(roleBind, strings.ToLower(namespaceType))
+		roleBindings = append(roleBindings, roleBind)
+	}
+	return roleBindings
+}
+
+// EnsureClusterRole creates the cluster role, or updates the rules and labels of the existing one when they differ,
+// so that the roles that the controllers generate follow the rules of the release running
+func EnsureClusterRole(clusterRole *rbacv1.ClusterRole, clientset kubernetes.Interface) error {
+	_, err := clientset.RbacV1().ClusterRoles().Create(clusterRole)
+	if err == nil || !errors.IsAlreadyExists(err) {
+		return err
+	}
+	existingRole, err := clientset.RbacV1().ClusterRoles().Get(clusterRole.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	labels := existingRole.GetLabels()
+	labelsChanged := false
+	for key, value := range clusterRole.GetLabels() {
+		if current, ok := labels[key]; !ok || current != value {
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[key] = value
+			labelsChanged = true
+		}
+	}
+	if !labelsChanged && apiequality.Semantic.DeepEqual(existingRole.Rules, clusterRole.Rules) {
+		return nil
+	}
+	existingRole.SetLabels(labels)
+	existingRole.Rules = clusterRole.Rules
+	if _, err = clientset.RbacV1().ClusterRoles().Update(existingRole); err != nil {
+		return err
+	}
+	log.Printf("%s cluster role updated", clusterRole.GetName())
+	return nil
+}
+
+// EnsureRoleBinding creates the role binding, or brings the existing one in line with it. The role reference of a role
+// binding cannot change, so the one that refers to another role is recreated.
+func EnsureRoleBinding(roleBind *rbacv1.RoleBinding, clientset kubernetes.Interface) error {
+	_, err := clientset.RbacV1().RoleBindings(roleBind.GetNamespace()).Create(roleBind)
+	if err == nil || !errors.IsAlreadyExists(err) {
+		return err
+	}
+	existingRoleBind, err := clientset.RbacV1().RoleBindings(roleBind.GetNamespace()).Get(roleBind.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if !apiequality.Semantic.DeepEqual(existingRoleBind.RoleRef, roleBind.RoleRef) {
+		if err := clientset.RbacV1().RoleBindings(roleBind.GetNamespace()).Delete(roleBind.GetName(), &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
 		}
+		_, err = clientset.RbacV1().RoleBindings(roleBind.GetNamespace()).Create(roleBind)
+		return err
+	}
+	if apiequality.Semantic.DeepEqual(existingRoleBind.Subjects, roleBind.Subjects) &&
+		apiequality.Semantic.DeepEqual(existingRoleBind.GetLabels(), roleBind.GetLabels()) &&
+		apiequality.Semantic.DeepEqual(existingRoleBind.GetOwnerReferences(), roleBind.GetOwnerReferences()) {
+		return nil
 	}
+	existingRoleBind.Subjects = roleBind.Subjects
+	existingRoleBind.SetLabels(roleBind.GetLabels())
+	existingRoleBind.SetOwnerReferences(roleBind.GetOwnerReferences())
+	_, err = clientset.RbacV1().RoleBindings(roleBind.GetNamespace()).Update(existingRoleBind)
+	return err
 }
 
 // CreateServiceAccount makes a service account to serve the user. This functionality covers two types of service accounts
@@ -114,6 +204,7 @@ func CreateServiceAccount(userCopy *apps_v1alpha.User, accountType string) (*cor
 	name := userCopy.GetName()
 	ownerReferences := setOwnerReferences(userCopy)
 	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, OwnerReferences: ownerReferences}}
+	SetManagedLabels(serviceAccount, "user")
 	serviceAccountCreated, err := clientset.CoreV1().ServiceAccounts(userCopy.GetNamespace()).Create(serviceAccount)
 	if err != nil {
 		log.Println(err.Error())
@@ -195,7 +286,13 @@ func setOwnerReferences(objCopy interface{}) []metav1.OwnerReference {
 // this function creates user role and role bindings for the namespace. Lastly, this checks the namespace
 // created successfully or not.
 func MakeUser(user string) ([]byte, int) {
-	userNamespace, err := namespace.Create(user)
+	clientset, err := authorization.CreateClientSet()
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+
+	userNamespace, err := namespace.Create(user, clientset)
 	if err != nil {
 		log.Printf("Namespace %s couldn't be created.", user)
 		resultMap := map[string]string{"status": "Failure"}
@@ -219,12 +316,6 @@ func MakeUser(user string) ([]byte, int) {
 		return result, 500
 	}
 
-	clientset, err := authorization.CreateClientSet()
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
-	}
-
 	rbSubjects := []rbacv1.Subject{{Kind: "ServiceAccount", Name: "default", Namespace: user}}
 	roleBindRef := rbacv1.RoleRef{Kind: "ClusterRole", Name: "admin"}
 	var roleBind *rbacv1.RoleBinding
@@ -251,7 +342,7 @@ func MakeUser(user string) ([]byte, int) {
 		return result, 500
 	}
 
-	exist, err := namespace.GetNamespaceByName(user)
+	exist, err := namespace.GetNamespaceByName(user, clientset)
 	if err == nil && exist == "true" {
 		resultMap := map[string]string{"status": "Acknowledged"}
 		result, _ := json.Marshal(resultMap)
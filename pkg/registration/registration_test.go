@@ -0,0 +1,54 @@
+package registration
+
+import (
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateRoleBindingsByRolesTwice(t *testing.T) {
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.UserSpec{Roles: []string{"Manager"}}}
+	clientset := testclient.NewSimpleClientset()
+	// A resync calls it again without deleting the role bindings beforehand
+	for i := 0; i < 2; i++ {
+		if err := CreateRoleBindingsByRoles(user, "authority-edgenet-team-demo", "Team", clientset); err != nil {
+			t.Fatalf("call %d failed: %s", i+1, err)
+		}
+	}
+	roleBindingsRaw, _ := clientset.RbacV1().RoleBindings("authority-edgenet-team-demo").List(metav1.ListOptions{})
+	if len(roleBindingsRaw.Items) != 1 || roleBindingsRaw.Items[0].RoleRef.Name != "team-manager" {
+		t.Errorf("role bindings are %v, expected a single one of the manager role", roleBindingsRaw.Items)
+	}
+}
+
+func TestEnsureRoleBinding(t *testing.T) {
+	subjects := []rbacv1.Subject{{Kind: "ServiceAccount", Name: "johndoe", Namespace: "authority-edgenet"}}
+	// The existing role binding refers to another role and has no subjects
+	clientset := testclient.NewSimpleClientset(&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		RoleRef: rbacv1.RoleRef{Kind: "ClusterRole", Name: "team-user"}})
+	roleBind := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Subjects: subjects, RoleRef: rbacv1.RoleRef{Kind: "ClusterRole", Name: "team-user"}}
+	SetManagedLabels(roleBind, "team")
+	if err := EnsureRoleBinding(roleBind, clientset); err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := clientset.RbacV1().RoleBindings("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if len(updated.Subjects) != 1 || updated.Labels[OwnerKindLabel] != "team" {
+		t.Errorf("role binding is %+v, expected the subjects and labels updated", updated)
+	}
+
+	// The role reference cannot be updated, so the role binding is recreated
+	roleBind.RoleRef.Name = "team-manager"
+	if err := EnsureRoleBinding(roleBind, clientset); err != nil {
+		t.Fatal(err)
+	}
+	recreated, _ := clientset.RbacV1().RoleBindings("authority-edgenet").Get("demo", metav1.GetOptions{})
+	if recreated.RoleRef.Name != "team-manager" {
+		t.Errorf("role reference is %s, expected team-manager", recreated.RoleRef.Name)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration
+
+import (
+	"fmt"
+	"strings"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+)
+
+// allowedRoles are the roles that users can hold, for each of which the controllers generate the cluster roles of the
+// kinds of namespaces
+var allowedRoles = []string{"Admin", "Manager", "Tech", "User"}
+
+// AllowedRoles returns the roles that users can hold, which the webhook and the controllers share
+func AllowedRoles() []string {
+	return append([]string{}, allowedRoles...)
+}
+
+// defaultRoles are the roles of the users who register without any, unless their authority sets its own
+var defaultRoles = []string{"User"}
+
+// SetDefaultRoles configures the roles of the users who register without any, which must be allowed roles
+func SetDefaultRoles(roles []string) error {
+	validated, err := ValidateRoles(roles)
+	if err != nil {
+		return err
+	}
+	if len(validated) == 0 {
+		return fmt.Errorf("default roles cannot be empty")
+	}
+	defaultRoles = validated
+	return nil
+}
+
+// ValidateRoles checks that the roles are allowed ones, whatever their case, and returns them as they are spelled in
+// the allowed roles without duplicates. The error lists all the roles that aren't allowed.
+func ValidateRoles(roles []string) ([]string, error) {
+	validated := []string{}
+	invalid := []string{}
+	seen := map[string]bool{}
+	for _, role := range roles {
+		role = strings.TrimSpace(role)
+		allowed := ""
+		for _, allowedRole := range allowedRoles {
+			if strings.EqualFold(role, allowedRole) {
+				allowed = allowedRole
+				break
+			}
+		}
+		if allowed == "" {
+			invalid = append(invalid, fmt.Sprintf("%q", role))
+			continue
+		}
+		if !seen[allowed] {
+			seen[allowed] = true
+			validated = append(validated, allowed)
+		}
+	}
+	if len(invalid) != 0 {
+		return nil, fmt.Errorf("roles %s aren't allowed, the roles are %s", strings.Join(invalid, ", "), strings.Join(allowedRoles, ", "))
+	}
+	return validated, nil
+}
+
+// UserRoles returns the validated roles of a user who registers in the authority given, those that the authority sets
+// by default, or else the ones configured, if the user asks for none
+func UserRoles(roles []string, authorityCopy *apps_v1alpha.Authority) ([]string, error) {
+	if len(roles) == 0 && authorityCopy != nil {
+		roles = authorityCopy.Spec.DefaultRoles
+	}
+	if len(roles) == 0 {
+		roles = defaultRoles
+	}
+	return ValidateRoles(roles)
+}
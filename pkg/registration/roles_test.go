@@ -0,0 +1,59 @@
+package registration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+)
+
+func TestValidateRoles(t *testing.T) {
+	roles, err := ValidateRoles([]string{" manager", "TECH", "Manager"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roles, []string{"Manager", "Tech"}) {
+		t.Errorf("roles are %v, expected them spelled as allowed without duplicates", roles)
+	}
+	if _, err := ValidateRoles([]string{"User", "root", "superuser"}); err == nil || !strings.Contains(err.Error(), `"root", "superuser"`) {
+		t.Errorf("error is %v, expected the roles that aren't allowed", err)
+	}
+	if roles, err := ValidateRoles(nil); err != nil || len(roles) != 0 {
+		t.Errorf("roles are %v and error is %v, expected no role", roles, err)
+	}
+}
+
+func TestUserRoles(t *testing.T) {
+	defer SetDefaultRoles(defaultRoles)
+	authority := &apps_v1alpha.Authority{}
+	// The roles configured apply unless the authority sets its own
+	if roles, _ := UserRoles(nil, authority); !reflect.DeepEqual(roles, []string{"User"}) {
+		t.Errorf("roles are %v, expected the default User role", roles)
+	}
+	if err := SetDefaultRoles([]string{"tech"}); err != nil {
+		t.Fatal(err)
+	}
+	if roles, _ := UserRoles([]string{}, nil); !reflect.DeepEqual(roles, []string{"Tech"}) {
+		t.Errorf("roles are %v, expected the roles configured", roles)
+	}
+	authority.Spec.DefaultRoles = []string{"Manager"}
+	if roles, _ := UserRoles(nil, authority); !reflect.DeepEqual(roles, []string{"Manager"}) {
+		t.Errorf("roles are %v, expected the default roles of the authority", roles)
+	}
+	// The roles that the user asks for are kept, as long as they are allowed
+	if roles, _ := UserRoles([]string{"user"}, authority); !reflect.DeepEqual(roles, []string{"User"}) {
+		t.Errorf("roles are %v, expected those of the user", roles)
+	}
+	authority.Spec.DefaultRoles = []string{"Owner"}
+	if _, err := UserRoles(nil, authority); err == nil {
+		t.Error("default roles of the authority that aren't allowed accepted")
+	}
+
+	if err := SetDefaultRoles([]string{"Guest"}); err == nil {
+		t.Error("default roles that aren't allowed configured")
+	}
+	if err := SetDefaultRoles(nil); err == nil {
+		t.Error("empty default roles configured")
+	}
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package suspension
+
+import (
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Annotation pauses the reconciliation of an object when set to true, which lets operators
+// debug a misbehaving object without the controllers touching it
+const Annotation = "edge-net.io/suspend"
+
+// IsSuspended tells whether the object is annotated to be left untouched by the controllers
+func IsSuspended(obj metav1.Object) bool {
+	if obj == nil {
+		return false
+	}
+	suspended, err := strconv.ParseBool(obj.GetAnnotations()[Annotation])
+	return err == nil && suspended
+}
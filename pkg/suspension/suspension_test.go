@@ -0,0 +1,28 @@
+package suspension
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsSuspended(t *testing.T) {
+	cases := []struct {
+		annotations map[string]string
+		expected    bool
+	}{
+		{nil, false},
+		{map[string]string{Annotation: "true"}, true},
+		{map[string]string{Annotation: "True"}, true},
+		{map[string]string{Annotation: "false"}, false},
+		{map[string]string{Annotation: "yes"}, false},
+		{map[string]string{"edge-net.io/other": "true"}, false},
+	}
+	for _, c := range cases {
+		obj := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Annotations: c.annotations}}
+		if IsSuspended(obj) != c.expected {
+			t.Errorf("annotations %v: expected suspended to be %t", c.annotations, c.expected)
+		}
+	}
+}
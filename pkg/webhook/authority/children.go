@@ -0,0 +1,76 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authority
+
+import (
+	"fmt"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/namespace"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Children are the teams and slices of an authority that are still in use
+type Children struct {
+	// Teams are the names of the enabled teams
+	Teams []string
+	// Slices are the slices that haven't expired, as namespace/name
+	Slices []string
+}
+
+// Empty tells whether the authority has no child in use
+func (c Children) Empty() bool {
+	return len(c.Teams) == 0 && len(c.Slices) == 0
+}
+
+// ActiveChildren returns the enabled teams of the authority, and the slices that haven't expired yet in the authority
+// namespace and in the child namespaces of the teams, which would go away along with the authority
+func ActiveChildren(edgenetClientset versioned.Interface, authorityName string, now time.Time) (Children, error) {
+	children := Children{Teams: []string{}, Slices: []string{}}
+	authorityNamespace := namespace.AuthorityName(authorityName)
+	teamsRaw, err := edgenetClientset.AppsV1alpha().Teams(authorityNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return children, err
+	}
+	sliceNamespaces := []string{authorityNamespace}
+	for _, teamRow := range teamsRaw.Items {
+		if teamRow.Status.Enabled {
+			children.Teams = append(children.Teams, teamRow.GetName())
+		}
+		sliceNamespaces = append(sliceNamespaces, namespace.ChildName(authorityNamespace, "team", teamRow.GetName()))
+	}
+	for _, sliceNamespace := range sliceNamespaces {
+		slicesRaw, err := edgenetClientset.AppsV1alpha().Slices(sliceNamespace).List(metav1.ListOptions{})
+		if err != nil {
+			return children, err
+		}
+		for _, sliceRow := range slicesRaw.Items {
+			if isActive(sliceRow, now) {
+				children.Slices = append(children.Slices, fmt.Sprintf("%s/%s", sliceRow.GetNamespace(), sliceRow.GetName()))
+			}
+		}
+	}
+	return children, nil
+}
+
+// isActive tells whether the slice hasn't expired yet, the slice without an expiry date is yet to be set up
+func isActive(sliceRow apps_v1alpha.Slice, now time.Time) bool {
+	return sliceRow.Status.Expires == nil || sliceRow.Status.Expires.Time.After(now)
+}
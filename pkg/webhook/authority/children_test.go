@@ -0,0 +1,41 @@
+package authority
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestActiveChildren(t *testing.T) {
+	now := time.Now()
+	expired := metav1.NewTime(now.Add(-time.Hour))
+	expires := metav1.NewTime(now.Add(time.Hour))
+	edgenetClientset := edgenettestclient.NewSimpleClientset(
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}, Status: apps_v1alpha.TeamStatus{Enabled: true}},
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "disabled", Namespace: "authority-edgenet"}},
+		&apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "exp", Namespace: "authority-edgenet"}, Status: apps_v1alpha.SliceStatus{Expires: &expires}},
+		&apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: "authority-edgenet"}, Status: apps_v1alpha.SliceStatus{Expires: &expired}},
+		&apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "lab", Namespace: "authority-edgenet-team-disabled"}},
+		// The children of other authorities aren't concerned
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-lip6"}, Status: apps_v1alpha.TeamStatus{Enabled: true}},
+		&apps_v1alpha.Slice{ObjectMeta: metav1.ObjectMeta{Name: "exp", Namespace: "authority-lip6"}},
+	)
+
+	children, err := ActiveChildren(edgenetClientset, "edgenet", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Children{Teams: []string{"demo"}, Slices: []string{"authority-edgenet/exp", "authority-edgenet-team-disabled/lab"}}
+	if !reflect.DeepEqual(children, expected) {
+		t.Errorf("expected %+v, got %+v", expected, children)
+	}
+	children, err = ActiveChildren(edgenetClientset, "empty", now)
+	if err != nil || !children.Empty() {
+		t.Errorf("authority without children has %+v, %v", children, err)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authority
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/webhook"
+
+	log "github.com/Sirupsen/logrus"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Path is where the webhook receives the admission reviews of authority deletions
+const Path = "/validate-authority"
+
+// ForceDeleteAnnotation lets an authority be deleted along with its teams and slices in use when set to true
+const ForceDeleteAnnotation = "edge-net.io/force-delete"
+
+// Webhook rejects the deletion of the authorities that still have teams or slices in use
+type Webhook struct {
+	edgenetClientset versioned.Interface
+}
+
+// NewWebhook returns a webhook that looks up the children of the authorities by the clientset given
+func NewWebhook(edgenetClientset versioned.Interface) *Webhook {
+	return &Webhook{edgenetClientset: edgenetClientset}
+}
+
+// ServeHTTP responds to an admission review with whether the authority can be deleted
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	webhook.ServeReview(rw, r, w.validate)
+}
+
+// validate returns the response to an authority deletion, which is denied with the list of the children in use
+func (w *Webhook) validate(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	if request.Operation != admissionv1beta1.Delete {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	authority := &apps_v1alpha.Authority{}
+	if len(request.OldObject.Raw) > 0 {
+		if err := json.Unmarshal(request.OldObject.Raw, authority); err != nil {
+			return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: err.Error()}}
+		}
+	} else {
+		// The API servers that don't send the object being deleted leave it to be fetched
+		authorityRaw, err := w.edgenetClientset.AppsV1alpha().Authorities().Get(request.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return &admissionv1beta1.AdmissionResponse{Allowed: true}
+		} else if err != nil {
+			return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: fmt.Sprintf("authority %s unavailable: %s", request.Name, err)}}
+		}
+		authority = authorityRaw
+	}
+	if forced, err := strconv.ParseBool(authority.GetAnnotations()[ForceDeleteAnnotation]); err == nil && forced {
+		log.Infof("Authority %s deleted by force", authority.GetName())
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	children, err := ActiveChildren(w.edgenetClientset, authority.GetName(), time.Now())
+	if err != nil {
+		// Rejecting the deletion is safer than letting it remove workloads that may be running
+		return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: fmt.Sprintf("children of authority %s unavailable: %s", authority.GetName(), err)}}
+	}
+	if children.Empty() {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: denialMessage(authority.GetName(), children)}}
+}
+
+// denialMessage lists the children that block the deletion of the authority
+func denialMessage(authorityName string, children Children) string {
+	blocking := []string{}
+	if len(children.Teams) > 0 {
+		blocking = append(blocking, fmt.Sprintf("enabled teams %s", strings.Join(children.Teams, ", ")))
+	}
+	if len(children.Slices) > 0 {
+		blocking = append(blocking, fmt.Sprintf("slices %s", strings.Join(children.Slices, ", ")))
+	}
+	return fmt.Sprintf("authority %s still has %s, annotate it with %s=true to delete it anyway",
+		authorityName, strings.Join(blocking, " and "), ForceDeleteAnnotation)
+}
+
+// Serve runs the webhook over TLS, as the API server requires, until it fails
+func Serve(port int, certFile, keyFile string, edgenetClientset versioned.Interface) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, NewWebhook(edgenetClientset))
+	log.Infof("Serving the authority webhook on port %d", port)
+	return http.ListenAndServeTLS(fmt.Sprintf(":%d", port), certFile, keyFile, mux)
+}
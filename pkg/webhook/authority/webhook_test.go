@@ -0,0 +1,57 @@
+package authority
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func review(t *testing.T, webhook *Webhook, authority *apps_v1alpha.Authority) *admissionv1beta1.AdmissionResponse {
+	authorityJSON, _ := json.Marshal(authority)
+	reviewJSON, _ := json.Marshal(admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{
+		UID: "review-uid", Name: authority.GetName(), Operation: admissionv1beta1.Delete, OldObject: runtime.RawExtension{Raw: authorityJSON}}})
+	recorder := httptest.NewRecorder()
+	webhook.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(reviewJSON)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("webhook responded with %d: %s", recorder.Code, recorder.Body.String())
+	}
+	result := admissionv1beta1.AdmissionReview{}
+	json.Unmarshal(recorder.Body.Bytes(), &result)
+	if result.Response == nil || result.Response.UID != "review-uid" {
+		t.Fatalf("unexpected admission review: %s", recorder.Body.String())
+	}
+	return result.Response
+}
+
+func TestWebhookValidate(t *testing.T) {
+	webhook := NewWebhook(edgenettestclient.NewSimpleClientset(
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}, Status: apps_v1alpha.TeamStatus{Enabled: true}},
+		&apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "lab", Namespace: "authority-edgenet"}, Status: apps_v1alpha.TeamStatus{Enabled: true}}))
+
+	// The deletion is denied with the list of the blocking teams
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"}}
+	response := review(t, webhook, authority)
+	if response.Allowed || response.Result == nil || !strings.Contains(response.Result.Message, "enabled teams demo, lab") ||
+		!strings.Contains(response.Result.Message, ForceDeleteAnnotation) {
+		t.Errorf("deletion of the authority with enabled teams not denied as expected: %+v", response)
+	}
+	// Unless forced
+	authority.SetAnnotations(map[string]string{ForceDeleteAnnotation: "true"})
+	if response := review(t, webhook, authority); !response.Allowed {
+		t.Errorf("forced deletion denied: %+v", response)
+	}
+	// The authority without children in use goes
+	if response := review(t, webhook, &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "lip6"}}); !response.Allowed {
+		t.Errorf("deletion of the authority without children denied: %+v", response)
+	}
+}
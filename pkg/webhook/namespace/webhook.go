@@ -0,0 +1,120 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespace
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"edgenet/pkg/client/clientset/versioned"
+	edgenetnamespace "edgenet/pkg/namespace"
+	"edgenet/pkg/webhook"
+
+	log "github.com/Sirupsen/logrus"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Path is where the webhook receives the admission reviews of namespace creations and updates
+const Path = "/mutate-namespace"
+
+// Webhook sets the authority-name label of the authority namespaces and of the child namespaces of teams and slices,
+// which the handlers find the authority of a namespace by
+type Webhook struct {
+	edgenetClientset versioned.Interface
+}
+
+// NewWebhook returns a webhook that looks up the owners of the child namespaces by the clientset given
+func NewWebhook(edgenetClientset versioned.Interface) *Webhook {
+	return &Webhook{edgenetClientset: edgenetClientset}
+}
+
+// ServeHTTP responds to an admission review with the patch that sets the authority-name label, if it is wrong
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	webhook.ServeReview(rw, r, w.mutate)
+}
+
+// mutate returns the response to a namespace creation or update, along with a patch if the label gets set. The
+// namespaces whose authority cannot be derived are admitted as they are.
+func (w *Webhook) mutate(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	namespace := &corev1.Namespace{}
+	if err := json.Unmarshal(request.Object.Raw, namespace); err != nil {
+		return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: err.Error()}}
+	}
+	authorityName, ok := edgenetnamespace.AuthorityOfNamespace(namespace)
+	if !ok {
+		authorityName, ok = w.authorityOfOwner(namespace)
+	}
+	if !ok || namespace.Labels["authority-name"] == authorityName {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	log.Infof("Authority-name label of namespace %s set to %s", namespace.GetName(), authorityName)
+	operation := webhook.PatchOperation{Op: "add", Path: "/metadata/labels/authority-name", Value: authorityName}
+	if namespace.Labels == nil {
+		operation = webhook.PatchOperation{Op: "add", Path: "/metadata/labels", Value: map[string]string{"authority-name": authorityName}}
+	}
+	patch, _ := json.Marshal([]webhook.PatchOperation{operation})
+	patchType := admissionv1beta1.PatchTypeJSONPatch
+	return &admissionv1beta1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &patchType}
+}
+
+// authorityOfOwner finds the authority of the child namespace whose name was truncated to fit in the limit, by the
+// namespace of the team or the slice that owns it
+func (w *Webhook) authorityOfOwner(namespace *corev1.Namespace) (string, bool) {
+	kind, name := namespace.Labels["owner"], namespace.Labels["owner-name"]
+	var ownerNamespaces []string
+	switch kind {
+	case "team":
+		teamsRaw, err := w.edgenetClientset.AppsV1alpha().Teams(metav1.NamespaceAll).List(metav1.ListOptions{})
+		if err != nil {
+			log.Infof("Couldn't list the teams to find the owner of namespace %s: %s", namespace.GetName(), err)
+			return "", false
+		}
+		for _, teamRow := range teamsRaw.Items {
+			if teamRow.GetName() == name {
+				ownerNamespaces = append(ownerNamespaces, teamRow.GetNamespace())
+			}
+		}
+	case "slice":
+		slicesRaw, err := w.edgenetClientset.AppsV1alpha().Slices(metav1.NamespaceAll).List(metav1.ListOptions{})
+		if err != nil {
+			log.Infof("Couldn't list the slices to find the owner of namespace %s: %s", namespace.GetName(), err)
+			return "", false
+		}
+		for _, sliceRow := range slicesRaw.Items {
+			if sliceRow.GetName() == name {
+				ownerNamespaces = append(ownerNamespaces, sliceRow.GetNamespace())
+			}
+		}
+	}
+	for _, ownerNamespace := range ownerNamespaces {
+		if edgenetnamespace.ChildName(ownerNamespace, kind, name) == namespace.GetName() {
+			return edgenetnamespace.AuthorityOf(ownerNamespace)
+		}
+	}
+	return "", false
+}
+
+// Serve runs the webhook over TLS, as the API server requires, until it fails
+func Serve(port int, certFile, keyFile string, edgenetClientset versioned.Interface) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, NewWebhook(edgenetClientset))
+	log.Infof("Serving the namespace webhook on port %d", port)
+	return http.ListenAndServeTLS(fmt.Sprintf(":%d", port), certFile, keyFile, mux)
+}
@@ -0,0 +1,101 @@
+package namespace
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	edgenetnamespace "edgenet/pkg/namespace"
+	"edgenet/pkg/webhook"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func review(t *testing.T, webhook *Webhook, namespace *corev1.Namespace) *admissionv1beta1.AdmissionResponse {
+	namespaceJSON, _ := json.Marshal(namespace)
+	reviewJSON, _ := json.Marshal(admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{
+		UID: "review-uid", Name: namespace.GetName(), Operation: admissionv1beta1.Create, Object: runtime.RawExtension{Raw: namespaceJSON}}})
+	recorder := httptest.NewRecorder()
+	webhook.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(reviewJSON)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("webhook responded with %d: %s", recorder.Code, recorder.Body.String())
+	}
+	result := admissionv1beta1.AdmissionReview{}
+	json.Unmarshal(recorder.Body.Bytes(), &result)
+	if result.Response == nil || result.Response.UID != "review-uid" {
+		t.Fatalf("unexpected admission review: %s", recorder.Body.String())
+	}
+	return result.Response
+}
+
+// patched returns the namespace as the patch of the response leaves it
+func patched(t *testing.T, namespace *corev1.Namespace, response *admissionv1beta1.AdmissionResponse) *corev1.Namespace {
+	if !response.Allowed {
+		t.Fatalf("namespace %s not admitted: %+v", namespace.GetName(), response.Result)
+	}
+	namespaceCopy := namespace.DeepCopy()
+	if response.Patch == nil {
+		return namespaceCopy
+	}
+	patch := []webhook.PatchOperation{}
+	json.Unmarshal(response.Patch, &patch)
+	for _, operation := range patch {
+		switch {
+		case operation.Op == "add" && operation.Path == "/metadata/labels":
+			namespaceCopy.Labels = map[string]string{}
+			for key, value := range operation.Value.(map[string]interface{}) {
+				namespaceCopy.Labels[key] = value.(string)
+			}
+		case operation.Op == "add" && operation.Path == "/metadata/labels/authority-name":
+			namespaceCopy.Labels["authority-name"] = operation.Value.(string)
+		default:
+			t.Errorf("unexpected patch operation %+v", operation)
+		}
+	}
+	return namespaceCopy
+}
+
+func TestWebhookMutate(t *testing.T) {
+	longName := strings.Repeat("a", 60)
+	team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: longName, Namespace: "authority-edgenet"}}
+	webhook := NewWebhook(edgenettestclient.NewSimpleClientset(team))
+	cases := []struct {
+		namespace *corev1.Namespace
+		expected  string
+	}{
+		// The namespaces missing the label get it
+		{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet"}}, "edgenet"},
+		{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-team-demo",
+			Labels: map[string]string{"owner": "team", "owner-name": "demo"}}}, "edgenet"},
+		// The wrong label gets corrected
+		{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-lip6-slice-exp",
+			Labels: map[string]string{"owner": "slice", "owner-name": "exp", "authority-name": "edgenet"}}}, "lip6"},
+		// The truncated names are resolved by the owners
+		{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: edgenetnamespace.ChildName("authority-edgenet", "team", longName),
+			Labels: map[string]string{"owner": "team", "owner-name": longName}}}, "edgenet"},
+		// The others are left as they are
+		{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}}, ""},
+		{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet-team-gone",
+			Labels: map[string]string{"owner": "team", "owner-name": longName}}}, ""},
+	}
+	for _, c := range cases {
+		response := review(t, webhook, c.namespace)
+		if label := patched(t, c.namespace, response).Labels["authority-name"]; label != c.expected {
+			t.Errorf("authority-name label of %s is %q, expected %q", c.namespace.GetName(), label, c.expected)
+		}
+	}
+
+	// The correct label is left untouched
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "authority-edgenet", Labels: map[string]string{"authority-name": "edgenet"}}}
+	if response := review(t, webhook, namespace); !response.Allowed || response.Patch != nil {
+		t.Errorf("namespace with the label patched: %+v", response)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook provides the parts of the admission webhooks that they share
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+)
+
+// PatchOperation is the JSON structure of a patch operation that a mutating webhook responds with
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ServeReview decodes the admission review of the request and responds with the review that admit returns
+func ServeReview(rw http.ResponseWriter, r *http.Request, admit func(*admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	review := admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(rw, "malformed admission review", http.StatusBadRequest)
+		return
+	}
+	review.Response = admit(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+	reviewJSON, _ := json.Marshal(review)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(reviewJSON)
+}
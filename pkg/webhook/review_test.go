@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+)
+
+func TestServeReview(t *testing.T) {
+	allow := func(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	reviewJSON, _ := json.Marshal(admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{UID: "review-uid"}})
+	recorder := httptest.NewRecorder()
+	ServeReview(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(reviewJSON)), allow)
+	result := admissionv1beta1.AdmissionReview{}
+	json.Unmarshal(recorder.Body.Bytes(), &result)
+	if recorder.Code != http.StatusOK || result.Response == nil || !result.Response.Allowed || result.Response.UID != "review-uid" {
+		t.Errorf("unexpected admission review: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if result.Request != nil {
+		t.Error("request sent back along with the response")
+	}
+
+	// A review without a request cannot be responded to
+	for _, body := range []string{"{}", "not json"} {
+		recorder = httptest.NewRecorder()
+		ServeReview(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body))), allow)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("malformed review %q responded with %d", body, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package team
+
+import (
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// DefaultResourceQuota sets the resource quota of a team that doesn't specify one, from the policy of its authority,
+// or from the default quota if the authority has no policy. It returns whether the team has changed.
+func DefaultResourceQuota(team *apps_v1alpha.Team, authority *apps_v1alpha.Authority) bool {
+	if team.Spec.ResourceQuota != nil {
+		return false
+	}
+	if authority != nil && authority.Spec.TeamResourceQuota != nil {
+		team.Spec.ResourceQuota = authority.Spec.TeamResourceQuota.DeepCopy()
+	} else {
+		resourceQuota := defaultResourceQuotaSpec()
+		team.Spec.ResourceQuota = &resourceQuota
+	}
+	return true
+}
+
+// defaultResourceQuotaSpec returns the quota for the teams of authorities without a policy,
+// teams are for organizing slices, so their namespaces hardly allow any workload
+func defaultResourceQuotaSpec() corev1.ResourceQuotaSpec {
+	return corev1.ResourceQuotaSpec{
+		Hard: map[corev1.ResourceName]resource.Quantity{
+			"cpu":                           resource.MustParse("5m"),
+			"memory":                        resource.MustParse("1Mi"),
+			"requests.storage":              resource.MustParse("1Mi"),
+			"pods":                          resource.MustParse("0"),
+			"count/persistentvolumeclaims":  resource.MustParse("0"),
+			"count/services":                resource.MustParse("0"),
+			"count/configmaps":              resource.MustParse("0"),
+			"count/replicationcontrollers":  resource.MustParse("0"),
+			"count/deployments.apps":        resource.MustParse("0"),
+			"count/deployments.extensions":  resource.MustParse("0"),
+			"count/replicasets.apps":        resource.MustParse("0"),
+			"count/replicasets.extensions":  resource.MustParse("0"),
+			"count/statefulsets.apps":       resource.MustParse("0"),
+			"count/statefulsets.extensions": resource.MustParse("0"),
+			"count/jobs.batch":              resource.MustParse("0"),
+			"count/cronjobs.batch":          resource.MustParse("0"),
+		},
+	}
+}
@@ -0,0 +1,56 @@
+package team
+
+import (
+	"reflect"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newResourceQuotaSpec(cpu, memory string) *corev1.ResourceQuotaSpec {
+	return &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"cpu": resource.MustParse(cpu), "memory": resource.MustParse(memory)}}
+}
+
+func TestDefaultResourceQuota(t *testing.T) {
+	policy := newResourceQuotaSpec("2000m", "2Gi")
+	explicit := newResourceQuotaSpec("1000m", "1Gi")
+	defaultSpec := defaultResourceQuotaSpec()
+	data := []struct {
+		quota     *corev1.ResourceQuotaSpec
+		authority *apps_v1alpha.Authority
+		expected  *corev1.ResourceQuotaSpec
+		changed   bool
+	}{
+		// Teams that specify a quota are left untouched
+		{explicit, &apps_v1alpha.Authority{Spec: apps_v1alpha.AuthoritySpec{TeamResourceQuota: policy}}, explicit, false},
+		{explicit, nil, explicit, false},
+		// The others get the authority policy, or the default quota if there is no policy
+		{nil, &apps_v1alpha.Authority{Spec: apps_v1alpha.AuthoritySpec{TeamResourceQuota: policy}}, policy, true},
+		{nil, &apps_v1alpha.Authority{}, &defaultSpec, true},
+		{nil, nil, &defaultSpec, true},
+	}
+	for _, test := range data {
+		team := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+			Spec: apps_v1alpha.TeamSpec{ResourceQuota: test.quota}}
+		if changed := DefaultResourceQuota(team, test.authority); changed != test.changed {
+			t.Errorf("DefaultResourceQuota changed the team: %t, expected %t", changed, test.changed)
+		}
+		if !reflect.DeepEqual(team.Spec.ResourceQuota, test.expected) {
+			t.Errorf("team resource quota is %v, expected %v", team.Spec.ResourceQuota, test.expected)
+		}
+	}
+}
+
+func TestDefaultResourceQuotaCopiesPolicy(t *testing.T) {
+	authority := &apps_v1alpha.Authority{Spec: apps_v1alpha.AuthoritySpec{TeamResourceQuota: newResourceQuotaSpec("2000m", "2Gi")}}
+	team := &apps_v1alpha.Team{}
+	DefaultResourceQuota(team, authority)
+	team.Spec.ResourceQuota.Hard["cpu"] = resource.MustParse("8000m")
+	if cpu := authority.Spec.TeamResourceQuota.Hard["cpu"]; cpu.String() != "2" {
+		t.Errorf("authority policy altered through the team: %s", cpu.String())
+	}
+}
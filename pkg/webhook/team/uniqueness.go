@@ -0,0 +1,87 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package team
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/webhook"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ValidationPath is where the webhook receives the admission reviews of team creations and updates
+const ValidationPath = "/validate-team"
+
+// ValidationWebhook rejects the teams whose child namespace would be that of another team in the same authority
+type ValidationWebhook struct {
+	edgenetClientset versioned.Interface
+}
+
+// NewValidationWebhook returns a webhook that looks up the teams of the authorities by the clientset given
+func NewValidationWebhook(edgenetClientset versioned.Interface) *ValidationWebhook {
+	return &ValidationWebhook{edgenetClientset: edgenetClientset}
+}
+
+// ServeHTTP responds to an admission review with whether the team gets a child namespace of its own
+func (w *ValidationWebhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	webhook.ServeReview(rw, r, w.validate)
+}
+
+// validate returns the response to a team creation or update, which is denied if the child namespace is taken
+func (w *ValidationWebhook) validate(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	if request.Operation != admissionv1beta1.Create && request.Operation != admissionv1beta1.Update {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	team := &apps_v1alpha.Team{}
+	if err := json.Unmarshal(request.Object.Raw, team); err != nil {
+		return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: err.Error()}}
+	}
+	// The namespace of the admission request is the one of the team, which the object may leave out on creation
+	team.SetNamespace(request.Namespace)
+	colliding, err := CollidingTeam(w.edgenetClientset, team)
+	if err != nil {
+		// Rejecting the team is safer than letting two teams share a namespace
+		return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: fmt.Sprintf("teams in %s unavailable: %s", request.Namespace, err)}}
+	}
+	if colliding == "" {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: fmt.Sprintf("team %s would share the child namespace %s with team %s",
+		team.GetName(), namespace.ChildName(team.GetNamespace(), "team", team.GetName()), colliding)}}
+}
+
+// CollidingTeam returns the name of the team in the same authority that has the child namespace of the team given,
+// or an empty string if none has
+func CollidingTeam(edgenetClientset versioned.Interface, team *apps_v1alpha.Team) (string, error) {
+	teamsRaw, err := edgenetClientset.AppsV1alpha().Teams(team.GetNamespace()).List(metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, teamRow := range teamsRaw.Items {
+		if namespace.ChildNamesCollide(team.GetNamespace(), "team", team.GetName(), teamRow.GetName()) {
+			return teamRow.GetName(), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,68 @@
+package team
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+	"edgenet/pkg/namespace"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func validationReview(t *testing.T, webhook *ValidationWebhook, operation admissionv1beta1.Operation, team *apps_v1alpha.Team) *admissionv1beta1.AdmissionResponse {
+	teamJSON, _ := json.Marshal(team)
+	reviewJSON, _ := json.Marshal(admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{
+		UID: "review-uid", Namespace: team.GetNamespace(), Operation: operation, Object: runtime.RawExtension{Raw: teamJSON}}})
+	recorder := httptest.NewRecorder()
+	webhook.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, ValidationPath, bytes.NewReader(reviewJSON)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("webhook responded with %d: %s", recorder.Code, recorder.Body.String())
+	}
+	result := admissionv1beta1.AdmissionReview{}
+	json.Unmarshal(recorder.Body.Bytes(), &result)
+	if result.Response == nil || result.Response.UID != "review-uid" {
+		t.Fatalf("unexpected admission review: %s", recorder.Body.String())
+	}
+	return result.Response
+}
+
+func TestWebhookValidateUniqueness(t *testing.T) {
+	longName := strings.Repeat("lab", 17)
+	// The name of the squatter is the truncated child namespace of the long name, which fits as is
+	squatter := strings.TrimPrefix(namespace.ChildName("authority-edgenet", "team", longName), "authority-edgenet-team-")
+	existing := &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: longName, Namespace: "authority-edgenet"}}
+	webhook := NewValidationWebhook(edgenettestclient.NewSimpleClientset(existing))
+
+	cases := []struct {
+		operation admissionv1beta1.Operation
+		team      *apps_v1alpha.Team
+		allowed   bool
+	}{
+		{admissionv1beta1.Create, &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: squatter, Namespace: "authority-edgenet"}}, false},
+		{admissionv1beta1.Update, &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: squatter, Namespace: "authority-edgenet"}}, false},
+		// The team doesn't collide with itself, nor with the teams of other authorities
+		{admissionv1beta1.Update, existing, true},
+		{admissionv1beta1.Create, &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: squatter, Namespace: "authority-other"}}, true},
+		// The names that share the truncated prefix get distinct hashes
+		{admissionv1beta1.Create, &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: longName + "x", Namespace: "authority-edgenet"}}, true},
+		{admissionv1beta1.Create, &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}}, true},
+		{admissionv1beta1.Delete, &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: squatter, Namespace: "authority-edgenet"}}, true},
+	}
+	for _, c := range cases {
+		response := validationReview(t, webhook, c.operation, c.team)
+		if response.Allowed != c.allowed {
+			t.Errorf("%s of team %s in %s allowed: %t, expected %t", c.operation, c.team.GetName(), c.team.GetNamespace(), response.Allowed, c.allowed)
+		}
+		if !c.allowed && (response.Result == nil || !strings.Contains(response.Result.Message, longName)) {
+			t.Errorf("denial doesn't name the colliding team: %+v", response.Result)
+		}
+	}
+}
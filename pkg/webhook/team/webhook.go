@@ -0,0 +1,87 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package team
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/client/clientset/versioned"
+	"edgenet/pkg/namespace"
+	"edgenet/pkg/webhook"
+
+	log "github.com/Sirupsen/logrus"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Path is where the webhook receives the admission reviews of team creations
+const Path = "/mutate-team"
+
+// Webhook defaults the resource quota of the teams being created
+type Webhook struct {
+	edgenetClientset versioned.Interface
+}
+
+// NewWebhook returns a webhook that reads the authority policies by the clientset given
+func NewWebhook(edgenetClientset versioned.Interface) *Webhook {
+	return &Webhook{edgenetClientset: edgenetClientset}
+}
+
+// ServeHTTP responds to an admission review with the patch that defaults the resource quota, if missing
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	webhook.ServeReview(rw, r, w.mutate)
+}
+
+// mutate returns the response to a team creation, along with a patch if the team gets the authority policy
+func (w *Webhook) mutate(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	team := &apps_v1alpha.Team{}
+	if err := json.Unmarshal(request.Object.Raw, team); err != nil {
+		return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: err.Error()}}
+	}
+	// Teams are in the namespaces of their authorities
+	authorityName, ok := namespace.AuthorityOf(request.Namespace)
+	if !ok {
+		authorityName = request.Namespace
+	}
+	authority, err := w.edgenetClientset.AppsV1alpha().Authorities().Get(authorityName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		// Rejecting the team is safer than letting it go with a quota that may exceed the policy
+		return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: fmt.Sprintf("policy of authority %s unavailable: %s", authorityName, err)}}
+	} else if err != nil {
+		authority = nil
+	}
+	if !DefaultResourceQuota(team, authority) {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	log.Infof("Resource quota of team %s in %s defaulted", team.GetName(), request.Namespace)
+	patch, _ := json.Marshal([]webhook.PatchOperation{{Op: "add", Path: "/spec/resourceQuota", Value: team.Spec.ResourceQuota}})
+	patchType := admissionv1beta1.PatchTypeJSONPatch
+	return &admissionv1beta1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &patchType}
+}
+
+// Serve runs the webhook over TLS, as the API server requires, until it fails
+func Serve(port int, certFile, keyFile string, edgenetClientset versioned.Interface) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, NewWebhook(edgenetClientset))
+	mux.Handle(ValidationPath, NewValidationWebhook(edgenetClientset))
+	log.Infof("Serving the team webhook on port %d", port)
+	return http.ListenAndServeTLS(fmt.Sprintf(":%d", port), certFile, keyFile, mux)
+}
@@ -0,0 +1,61 @@
+package team
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	edgenettestclient "edgenet/pkg/client/clientset/versioned/fake"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func review(t *testing.T, webhook *Webhook, team *apps_v1alpha.Team) *admissionv1beta1.AdmissionResponse {
+	teamJSON, _ := json.Marshal(team)
+	reviewJSON, _ := json.Marshal(admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{
+		UID: "review-uid", Namespace: team.GetNamespace(), Operation: admissionv1beta1.Create, Object: runtime.RawExtension{Raw: teamJSON}}})
+	recorder := httptest.NewRecorder()
+	webhook.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(reviewJSON)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("webhook responded with %d: %s", recorder.Code, recorder.Body.String())
+	}
+	result := admissionv1beta1.AdmissionReview{}
+	json.Unmarshal(recorder.Body.Bytes(), &result)
+	if result.Response == nil || result.Response.UID != "review-uid" {
+		t.Fatalf("unexpected admission review: %s", recorder.Body.String())
+	}
+	return result.Response
+}
+
+func TestWebhookMutate(t *testing.T) {
+	authority := &apps_v1alpha.Authority{ObjectMeta: metav1.ObjectMeta{Name: "edgenet"},
+		Spec: apps_v1alpha.AuthoritySpec{TeamResourceQuota: newResourceQuotaSpec("2000m", "2Gi")}}
+	webhook := NewWebhook(edgenettestclient.NewSimpleClientset(authority))
+
+	// The team without a quota gets the one of the authority policy
+	response := review(t, webhook, &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"}})
+	if !response.Allowed || response.PatchType == nil || *response.PatchType != admissionv1beta1.PatchTypeJSONPatch {
+		t.Fatalf("team not patched: %+v", response)
+	}
+	patch := []struct {
+		Op    string                       `json:"op"`
+		Path  string                       `json:"path"`
+		Value map[string]map[string]string `json:"value"`
+	}{}
+	json.Unmarshal(response.Patch, &patch)
+	if len(patch) != 1 || patch[0].Op != "add" || patch[0].Path != "/spec/resourceQuota" ||
+		patch[0].Value["hard"]["cpu"] != "2" || patch[0].Value["hard"]["memory"] != "2Gi" {
+		t.Errorf("unexpected patch: %s", response.Patch)
+	}
+	// The team that specifies a quota is left untouched
+	response = review(t, webhook, &apps_v1alpha.Team{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.TeamSpec{ResourceQuota: newResourceQuotaSpec("1000m", "1Gi")}})
+	if !response.Allowed || response.Patch != nil {
+		t.Errorf("team with a quota patched: %+v", response)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+	"edgenet/pkg/registration"
+	"edgenet/pkg/webhook"
+
+	log "github.com/Sirupsen/logrus"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Path is where the webhook receives the admission reviews of user creations and updates
+const Path = "/validate-user"
+
+// Webhook rejects the users whose roles aren't among the roles that users can hold, as such a role would grant nothing
+type Webhook struct{}
+
+// NewWebhook returns a webhook that validates the roles of users
+func NewWebhook() *Webhook {
+	return &Webhook{}
+}
+
+// ServeHTTP responds to an admission review with whether the roles of the user are allowed
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	webhook.ServeReview(rw, r, w.validate)
+}
+
+// validate returns the response to a user creation or update, which is denied with the roles that aren't allowed
+func (w *Webhook) validate(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	if request.Operation != admissionv1beta1.Create && request.Operation != admissionv1beta1.Update {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	user := &apps_v1alpha.User{}
+	if err := json.Unmarshal(request.Object.Raw, user); err != nil {
+		return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: err.Error()}}
+	}
+	if _, err := registration.ValidateRoles(user.Spec.Roles); err != nil {
+		log.Infof("User %s in %s rejected: %s", user.GetName(), request.Namespace, err)
+		return &admissionv1beta1.AdmissionResponse{Result: &metav1.Status{Message: fmt.Sprintf("user %s: %s", user.GetName(), err)}}
+	}
+	return &admissionv1beta1.AdmissionResponse{Allowed: true}
+}
+
+// Serve runs the webhook over TLS, as the API server requires, until it fails
+func Serve(port int, certFile, keyFile string) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, NewWebhook())
+	log.Infof("Serving the user webhook on port %d", port)
+	return http.ListenAndServeTLS(fmt.Sprintf(":%d", port), certFile, keyFile, mux)
+}
@@ -0,0 +1,59 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apps_v1alpha "edgenet/pkg/apis/apps/v1alpha"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func review(t *testing.T, operation admissionv1beta1.Operation, roles []string) *admissionv1beta1.AdmissionResponse {
+	user := &apps_v1alpha.User{ObjectMeta: metav1.ObjectMeta{Name: "johndoe", Namespace: "authority-edgenet"},
+		Spec: apps_v1alpha.UserSpec{Roles: roles}}
+	userJSON, _ := json.Marshal(user)
+	reviewJSON, _ := json.Marshal(admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{
+		UID: "review-uid", Name: user.GetName(), Namespace: user.GetNamespace(), Operation: operation, Object: runtime.RawExtension{Raw: userJSON}}})
+	recorder := httptest.NewRecorder()
+	NewWebhook().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(reviewJSON)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("webhook responded with %d: %s", recorder.Code, recorder.Body.String())
+	}
+	result := admissionv1beta1.AdmissionReview{}
+	json.Unmarshal(recorder.Body.Bytes(), &result)
+	if result.Response == nil || result.Response.UID != "review-uid" {
+		t.Fatalf("unexpected admission review: %s", recorder.Body.String())
+	}
+	return result.Response
+}
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		operation admissionv1beta1.Operation
+		roles     []string
+		allowed   bool
+	}{
+		{admissionv1beta1.Create, []string{"Admin"}, true},
+		{admissionv1beta1.Create, []string{"manager", " Tech", "User"}, true},
+		{admissionv1beta1.Update, []string{"User"}, true},
+		{admissionv1beta1.Create, []string{"Superuser"}, false},
+		{admissionv1beta1.Update, []string{"User", "admins"}, false},
+		{admissionv1beta1.Update, []string{""}, false},
+	}
+	for _, test := range tests {
+		response := review(t, test.operation, test.roles)
+		if response.Allowed != test.allowed {
+			t.Errorf("%s of the user with roles %q allowed is %t, expected %t: %+v", test.operation, test.roles, response.Allowed, test.allowed, response.Result)
+		}
+		if !test.allowed && (response.Result == nil || !strings.Contains(response.Result.Message, "johndoe")) {
+			t.Errorf("denial of roles %q doesn't tell the user: %+v", test.roles, response.Result)
+		}
+	}
+}